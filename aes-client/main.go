@@ -1,381 +1,162 @@
 package main
 
 import (
-	"bytes"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/sha256"
-	"crypto/x509"
-	"encoding/base64"
-	"encoding/json"
-	"fmt"
-	"io"
+	"flag"
 	"log"
-	"net/http"
-	"time"
-
-	"github.com/cloudflare/circl/kem/kyber/kyber768"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-)
-
-var (
-	// Prometheusメトリクス
-	rsaEncryptedKeySize = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "client_rsa_encrypted_key_size_bytes",
-			Help: "Size of AES key encrypted with RSA in bytes",
-		},
-	)
-	mlkemEncryptedKeySize = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "client_mlkem_encrypted_key_size_bytes",
-			Help: "Size of AES key encrypted with ML-KEM in bytes",
-		},
-	)
-	rsaPublicKeySize = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "client_rsa_public_key_size_bytes",
-			Help: "Size of RSA public key in bytes",
-		},
-	)
-	mlkemPublicKeySize = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "client_mlkem_public_key_size_bytes",
-			Help: "Size of ML-KEM public key in bytes",
-		},
-	)
-	rsaEncryptionDuration = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "client_rsa_encryption_duration_seconds",
-			Help: "Duration of RSA encryption operation in seconds",
-		},
-	)
-	mlkemEncapsulationDuration = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "client_mlkem_encapsulation_duration_seconds",
-			Help: "Duration of ML-KEM encapsulation operation in seconds",
-		},
-	)
-	encryptionDurationRatio = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "client_encryption_duration_ratio",
-			Help: "Ratio of ML-KEM to RSA encryption duration (ML-KEM / RSA)",
-		},
-	)
-	encryptedKeySizeRatio = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "client_encrypted_key_size_ratio",
-			Help: "Ratio of ML-KEM to RSA encrypted key size (ML-KEM / RSA)",
-		},
-	)
-	publicKeySizeRatio = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "client_public_key_size_ratio",
-			Help: "Ratio of ML-KEM to RSA public key size (ML-KEM / RSA)",
-		},
-	)
-	rsaEncryptionDurationAvg = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "client_rsa_encryption_duration_avg_seconds",
-			Help: "Average duration of RSA encryption operations in seconds",
-		},
-	)
-	mlkemEncapsulationDurationAvg = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "client_mlkem_encapsulation_duration_avg_seconds",
-			Help: "Average duration of ML-KEM encapsulation operations in seconds",
-		},
-	)
-	encryptionCounter = promauto.NewCounter(
-		prometheus.CounterOpts{
-			Name: "client_encryption_operations_total",
-			Help: "Total number of encryption operations",
-		},
-	)
+	"os"
+
+	"github.com/keyi1000/PQC_grafana/annotation"
+	"github.com/keyi1000/PQC_grafana/benchclient"
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/keyi1000/PQC_grafana/features"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/mlkemserver"
+	"github.com/keyi1000/PQC_grafana/rsaserver"
+	"github.com/keyi1000/PQC_grafana/soak"
 )
 
-// 平均計算用の累積値
-var (
-	rsaTotalDuration   float64
-	mlkemTotalDuration float64
-	operationCount     int
-)
-
-// 公開鍵のレスポンス構造体
-type PublicKeyResponse struct {
-	PublicKey string `json:"public_key"`
-	KeySize   int    `json:"key_size"`
-}
-
-// 暗号化データの送信構造体
-type EncryptedData struct {
-	EncryptedAESKey  string `json:"encrypted_aes_key"` // RSAで暗号化されたAES鍵
-	EncryptedMessage string `json:"encrypted_message"` // AESで暗号化されたメッセージ
-	IV               string `json:"iv"`                // AESの初期化ベクトル
-}
-
 func main() {
-	// Prometheusメトリクスサーバーを起動
-	go func() {
-		http.Handle("/metrics", promhttp.Handler())
-		log.Println("メトリクスサーバーを起動: http://localhost:8082/metrics")
-		if err := http.ListenAndServe(":8082", nil); err != nil {
-			log.Printf("メトリクスサーバーエラー: %v", err)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "encrypt-dir":
+			encryptDirMain(os.Args[2:])
+			return
+		case "verify":
+			verifyMain(os.Args[2:])
+			return
 		}
-	}()
-
-	// サーバーが起動するまで待機
-	fmt.Println("RSAサーバーの起動を待機中...")
-	time.Sleep(3 * time.Second)
-
-	fmt.Println("\n=== ハイブリッド暗号化を1秒毎に実行します ===")
-
-	counter := 0
-	ticker := time.NewTicker(1000 * time.Millisecond)
-	defer ticker.Stop()
-
-	// 暗号化するメッセージ
-	messages := []string{
-		"量子コンピュータに対抗するポスト量子暗号",
 	}
 
-	for range ticker.C {
-		counter++
-		message := messages[counter%len(messages)]
-
-		fmt.Printf("\n========== 暗号化 #%d ==========\n", counter)
-		startTime := time.Now()
-		encryptionCounter.Inc()
-
-		// Step 1: RSA公開鍵を取得
-		rsaPublicKey, rsaPubKeyBytes, err := fetchPublicKey("http://rsa-server:8080/public-key")
-		if err != nil {
-			log.Printf("RSA公開鍵の取得に失敗: %v", err)
-			continue
-		}
-		rsaPublicKeySize.Set(float64(len(rsaPubKeyBytes)))
-		fmt.Printf("[%s] ✓ RSA公開鍵を取得 (%dバイト)\n", time.Since(startTime), len(rsaPubKeyBytes))
-
-		// Step 1.5: ML-KEM公開鍵も取得
-		mlkemPublicKey, mlkemPubKeyBytes, err := fetchMLKEMPublicKey("http://ml-kem-server:8081/public-key")
+	cfg := benchclient.DefaultConfig()
+	flag.StringVar(&cfg.RSAURL, "rsa-url", cfg.RSAURL, "RSA公開鍵を取得するURL")
+	flag.StringVar(&cfg.MLKEMURL, "mlkem-url", cfg.MLKEMURL, "ML-KEM公開鍵を取得するURL")
+	flag.StringVar(&cfg.DualURL, "dual-url", cfg.DualURL, "二重保護サーバーの公開鍵を取得するURL（空の場合は計測しない）")
+	flag.StringVar(&cfg.ECDHURL, "ecdh-url", cfg.ECDHURL, "ECDH（P-256）サーバーの公開鍵を取得するURL（空の場合は計測しない）")
+	flag.DurationVar(&cfg.Interval, "interval", cfg.Interval, "ハイブリッド暗号化を実行する間隔")
+	flag.BoolVar(&cfg.NewConnPerRequest, "new-conn", false, "Keep-Aliveを無効化し、公開鍵の取得ごとに新しい接続を張る")
+	flag.IntVar(&cfg.BreakerThreshold, "breaker-threshold", cfg.BreakerThreshold, "サーキットブレーカーを開くまでの連続失敗回数")
+	flag.DurationVar(&cfg.BreakerCooldown, "breaker-cooldown", cfg.BreakerCooldown, "サーキットブレーカーが開いてから半開状態で再試行するまでの時間")
+	flag.IntVar(&cfg.RekeyEvery, "rekey-every", cfg.RekeyEvery, "長期間のセッションでNメッセージごとに鍵を更新する模擬を行う（0の場合は毎回鍵合意する）")
+	flag.StringVar(&cfg.KEMsURL, "kems-url", cfg.KEMsURL, "登録されたすべてのKEMで鍵交換を行うサーバーの/kemsのURL（空の場合は実行しない）")
+	flag.Func("interop", "相互運用性を確認する外部のKEMエンドポイント（name,format,public-key-url,decapsulate-url[,kem]、formatはjson / raw / pem、複数指定可）", func(s string) error {
+		t, err := benchclient.ParseInteropTarget(s)
 		if err != nil {
-			log.Printf("ML-KEM公開鍵の取得に失敗: %v", err)
-			continue
-		}
-		mlkemPublicKeySize.Set(float64(len(mlkemPubKeyBytes)))
-		fmt.Printf("[%s] ✓ ML-KEM公開鍵を取得 (%dバイト)\n", time.Since(startTime), len(mlkemPubKeyBytes))
-
-		// Step 2: AES鍵を生成（256ビット = 32バイト）
-		aesKey := make([]byte, 32)
-		if _, err := io.ReadFull(rand.Reader, aesKey); err != nil {
-			log.Printf("AES鍵の生成に失敗: %v", err)
-			continue
+			return err
 		}
-		fmt.Printf("[%s] ✓ AES-256鍵を生成\n", time.Since(startTime))
-
-		// Step 3: AESでメッセージを暗号化
-		encryptedMessage, iv, err := encryptAES([]byte(message), aesKey)
+		cfg.InteropTargets = append(cfg.InteropTargets, t)
+		return nil
+	})
+	flag.BoolVar(&cfg.CMSOutput, "cms", false, "暗号化データをCMSのEnvelopedData（RSAはKeyTransRecipientInfo、ML-KEMはKEMRecipientInfo）としても作成し、サイズを記録する")
+	flag.BoolVar(&cfg.Calibrate, "calibrate", false, "セッションごとに暗号処理を行わない同じ形のHTTPとJSONの往復（/calibrate）も計測し、基準値として記録する")
+	flag.BoolVar(&cfg.KeySignature, "verify-key-signature", false, "ML-KEM公開鍵のレスポンスのML-DSA署名をカプセル化の前に検証する")
+	flag.StringVar(&cfg.MLKEMSigningKey, "mlkem-signing-key", "", "-verify-key-signature で使うML-KEMサーバーのML-DSA-65公開鍵（Base64、空の場合は最初に/signing-keyから取得した鍵を信頼する）")
+	cfg.Netem.RegisterFlags(flag.CommandLine, "")
+	flag.StringVar(&cfg.RSADatagramAddr, "rsa-udp-addr", "", "RSAサーバーのデータグラムのUDPアドレス（指定するとUDPでも鍵合意を計測する、例: rsa-server:9080）")
+	flag.StringVar(&cfg.MLKEMDatagramAddr, "mlkem-udp-addr", "", "ML-KEMサーバーのデータグラムのUDPアドレス（指定するとUDPでも鍵合意を計測する、例: ml-kem-server:9081）")
+	cfg.Datagram.RegisterFlags(flag.CommandLine)
+	flag.Func("unix-socket", "URLのホストへの接続をUnixドメインソケットに向ける（host=/path/to.sock、例: rsa-server=/run/pqc/rsa.sock、複数指定可）", func(s string) error {
+		host, path, err := benchclient.ParseUnixSocket(s)
 		if err != nil {
-			log.Printf("AES暗号化に失敗: %v", err)
-			continue
+			return err
 		}
-		fmt.Printf("[%s] ✓ メッセージをAES暗号化 (%dバイト)\n", time.Since(startTime), len(encryptedMessage))
-
-		// Step 4: RSAでAES鍵を暗号化
-		rsaEncryptStart := time.Now()
-		rsaEncryptedAESKey, err := encryptRSA(rsaPublicKey, aesKey)
-		rsaEncryptDuration := time.Since(rsaEncryptStart)
-		if err != nil {
-			log.Printf("RSA暗号化に失敗: %v", err)
-			continue
+		if cfg.UnixSockets == nil {
+			cfg.UnixSockets = make(map[string]string)
 		}
-		rsaEncryptedKeySize.Set(float64(len(rsaEncryptedAESKey)))
-		rsaEncryptionDuration.Set(rsaEncryptDuration.Seconds())
-		fmt.Printf("[%s] ✓ AES鍵をRSA暗号化 (%dバイト, %v)\n", time.Since(startTime), len(rsaEncryptedAESKey), rsaEncryptDuration)
-
-		// Step 5: ML-KEMでAES鍵をカプセル化
-		mlkemEncapsulateStart := time.Now()
-		mlkemCiphertext, _, err := encryptMLKEM(mlkemPublicKey, aesKey)
-		mlkemEncapsulateDuration := time.Since(mlkemEncapsulateStart)
+		cfg.UnixSockets[host] = path
+		return nil
+	})
+	flag.StringVar(&cfg.RSAUnixSocket, "rsa-unix-socket", "", "同じホストのRSAサーバーのUnixドメインソケット（指定するとTCPを介さない鍵合意も計測する、例: /run/pqc/rsa.sock）")
+	flag.StringVar(&cfg.MLKEMUnixSocket, "mlkem-unix-socket", "", "同じホストのML-KEMサーバーのUnixドメインソケット（指定するとTCPを介さない鍵合意も計測する、例: /run/pqc/ml-kem.sock）")
+	flag.StringVar(&cfg.ResultsURL, "results-url", "", "計測結果をML-KEMのハイブリッド暗号化で保護して送る集約サーバーの公開鍵のURL（例: http://result-collector:8105/public-key、空の場合は送らない）")
+	flag.DurationVar(&cfg.ResultsInterval, "results-interval", cfg.ResultsInterval, "-results-url に計測結果をまとめて送る間隔")
+	flag.Func("aes-key-sizes", "暗号化ごとに順に使うAES鍵のサイズ（ビット、128・192・256をカンマ区切り、例: 128,256、既定は256のみ）", func(s string) (err error) {
+		cfg.AESKeySizes, err = benchclient.ParseAESKeySizes(s)
+		return err
+	})
+	flag.StringVar(&cfg.DataCipher, "data-cipher", cryptoutil.FamilyCBCHMAC, "メッセージの暗号化方式（aes-cbc-hmac / aes-gcm / aes-gcm-siv / chacha20-poly1305、AES-NIのない環境の比較にはchacha20-poly1305、ノンスの再利用への耐性の比較にはaes-gcm-siv）")
+	flag.StringVar(&cfg.NonceMode, "nonce-mode", cryptoutil.NonceRandom, "AEADのノンスの生成方式（random: 乱数、counter: 鍵ごとの固定部とカウンター、AES-CBCのIVは常に乱数）")
+	flag.StringVar(&cfg.KeyWrap, "key-wrap", "", "AES鍵のラップ方式（空: RSAはRSA-OAEPで直接、ML-KEMとECDHはAES-256-GCM、aes-kw: KEKを確立してからAESキーラップ（RFC 3394））")
+	flag.Float64Var(&cfg.RatioEWMAAlpha, "ratio-ewma-alpha", cfg.RatioEWMAAlpha, "ML-KEMとRSA・ECDHの比率の指数移動平均（client_ratio_ewma）の平滑化係数（0より大きく1以下、大きいほど直近の計測を重視する）")
+	metricsAddr := flag.String("metrics-addr", ":8082", "メトリクスの待ち受けアドレス（例: [::]:8082、unix:/run/pqc/client.sock）")
+	flag.BoolVar(&cfg.KeyNonce, "key-nonce", false, "公開鍵をPOSTでnonceを付けて取得し、レスポンスがnonceに結び付いていることを確認する（鍵の鮮度の確認）")
+	flag.BoolVar(&cfg.ConditionalFetch, "conditional-key-fetch", false, "公開鍵をIf-None-Matchを付けて取得し、変わっていなければ（304）前回の公開鍵を使う（staticモードのサーバーのみ）")
+	flag.BoolVar(&cfg.KeySet, "key-set", false, "RSA・ML-KEMの公開鍵をGET /keys の一覧（JWK Set）でまとめて取得してCache-Controlに従ってキャッシュし、セッションごとに順に使う（staticモードのサーバーのみ、ephemeralモードでは個別に取得する）")
+	flag.DurationVar(&cfg.KeyCacheTTL, "key-cache-ttl", cfg.KeyCacheTTL, "staticモードの公開鍵をキャッシュして使い回す時間（サーバーのCache-Controlのmax-ageが短ければそれに従い、ephemeralモードとno-storeの公開鍵はキャッシュしない、0の場合はキャッシュしない）")
+	flag.BoolVar(&cfg.FetchKeyPerSession, "fetch-key-every-session", false, "公開鍵のキャッシュと鍵の一覧を使わず、セッションごとに公開鍵を取得する（以前の動作、取得のネットワークの時間を毎回計測する）")
+	flag.BoolVar(&cfg.LegacyEnvelope, "legacy-envelope", false, "暗号化データの形式の版をAccept-Versionで交渉せず、versionのない暗号化データを送る（版を知らない古いクライアントの模擬）")
+	flag.BoolVar(&cfg.FIPS, "fips", false, "FIPS承認済みの方式（ML-KEM-768/1024、RSA 3072ビット以上、AES-256-GCM）だけを使い、承認されていない操作の試行を記録する")
+	flag.IntVar(&cfg.BatchSize, "batch", 0, "毎回ML-KEMサーバーの/encapsulate-batchでN回カプセル化させ、HTTPを除いた1回あたりの時間を記録する（最大10000、0の場合は実行しない）")
+	flag.Func("operation-mix", "1回の間隔で実行する操作の種類ごとの回数（例: encrypt=6,roundtrip=3,sign=1、encryptは暗号化のみ、roundtripはサーバーでの復号の確認まで、signはML-KEM公開鍵への署名と検証、指定しない場合は毎回roundtripを1回）", func(s string) error {
+		var err error
+		cfg.OperationMix, err = benchclient.ParseOperationMix(s)
+		return err
+	})
+	flag.Func("corpus", "暗号化するメッセージのコーパス（[name=]kind[:args]、kindはdefault / file:PATH / random:SIZE / repeat:PATTERN:COUNT / empty / unicode、複数指定可）", func(s string) error {
+		c, err := benchclient.ParseCorpus(s)
 		if err != nil {
-			log.Printf("ML-KEM暗号化に失敗: %v", err)
-			continue
-		}
-		mlkemEncryptedKeySize.Set(float64(len(mlkemCiphertext)))
-		mlkemEncapsulationDuration.Set(mlkemEncapsulateDuration.Seconds())
-		fmt.Printf("[%s] ✓ AES鍵をML-KEM暗号化 (%dバイト, %v)\n", time.Since(startTime), len(mlkemCiphertext), mlkemEncapsulateDuration)
-
-		// 累積平均を計算
-		operationCount++
-		rsaTotalDuration += rsaEncryptDuration.Seconds()
-		mlkemTotalDuration += mlkemEncapsulateDuration.Seconds()
-		rsaAvg := rsaTotalDuration / float64(operationCount)
-		mlkemAvg := mlkemTotalDuration / float64(operationCount)
-		rsaEncryptionDurationAvg.Set(rsaAvg)
-		mlkemEncapsulationDurationAvg.Set(mlkemAvg)
-
-		// 比較値を計算してメトリクスに記録
-		if rsaEncryptDuration.Seconds() > 0 {
-			durationRatio := mlkemEncapsulateDuration.Seconds() / rsaEncryptDuration.Seconds()
-			encryptionDurationRatio.Set(durationRatio)
-		}
-		if len(rsaEncryptedAESKey) > 0 {
-			keySizeRatio := float64(len(mlkemCiphertext)) / float64(len(rsaEncryptedAESKey))
-			encryptedKeySizeRatio.Set(keySizeRatio)
+			return err
 		}
-		if len(rsaPubKeyBytes) > 0 {
-			pubKeySizeRatio := float64(len(mlkemPubKeyBytes)) / float64(len(rsaPubKeyBytes))
-			publicKeySizeRatio.Set(pubKeySizeRatio)
-		}
-
-		// 結果のサマリー
-		totalTime := time.Since(startTime)
-		fmt.Printf("[%s] ✅ ハイブリッド暗号化完了\n", totalTime)
-		fmt.Printf("メッセージ: \"%s\"\n", message[:min(len(message), 30)]+"...")
-		fmt.Printf("📊 RSA公開鍵: %d バイト\n", len(rsaPubKeyBytes))
-		fmt.Printf("📊 ML-KEM公開鍵: %d バイト\n", len(mlkemPubKeyBytes))
-		fmt.Printf("📊 RSA暗号化AES鍵: %d バイト\n", len(rsaEncryptedAESKey))
-		fmt.Printf("📊 ML-KEM暗号化AES鍵: %d バイト\n", len(mlkemCiphertext))
-		fmt.Printf("📊 暗号文: %d バイト, IV: %d バイト\n", len(encryptedMessage), len(iv))
-	}
-}
-
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-}
-
-// RSA公開鍵を取得
-func fetchPublicKey(url string) (*rsa.PublicKey, []byte, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, nil, fmt.Errorf("HTTP GETエラー: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, nil, fmt.Errorf("HTTPステータスエラー: %d", resp.StatusCode)
+		cfg.Corpora = append(cfg.Corpora, c)
+		return nil
+	})
+	flag.DurationVar(&cfg.ScrapeInterval, "scrape-interval", 0, "Prometheusのスクレイプ間隔（指定すると-intervalの代わりにこの間隔を-ops-per-scrapeで割った間隔で暗号化する）")
+	flag.IntVar(&cfg.OpsPerScrape, "ops-per-scrape", 1, "-scrape-interval の1回のスクレイプあたりに暗号化する回数（1の場合はゲージの値が上書きされない）")
+	flag.IntVar(&cfg.Burst, "burst", 1, "1回のティックでN回続けて暗号化し、バーストの中での所要時間のパーセンタイルを記録する（ティックの間隔はN倍にして平均の実行頻度は変えない）")
+	flag.BoolVar(&cfg.FixedRate, "fixed-rate", false, "1回の実行が間隔を超えた場合に溜まったティックをまとめず、遅れた分を続けて実行して実行頻度を保つ（未実行の数をclient_loop_backlogに記録する）")
+	flag.Float64Var(&cfg.AdaptiveCV, "adaptive-cv", 0, "直近のセッションの所要時間の変動係数がこの値（例: 0.3）を超えている間は実行頻度を上げる（0の場合は無効）")
+	flag.IntVar(&cfg.AdaptiveMaxFactor, "adaptive-max-factor", cfg.AdaptiveMaxFactor, "-adaptive-cv で実行頻度を上げる最大の倍率")
+	loopback := flag.Bool("loopback", false, "サーバーのハンドラーをプロセス内で直接呼び出す計測も行い、ネットワークの寄与を分離する")
+	runID := flag.String("run-id", "", "すべてのメトリクスにrun_idラベルとして付与する実行ID（同じPrometheusで複数の計測を区別する）")
+	experiment := flag.String("experiment", "", "すべてのメトリクスにexperimentラベルとして付与する実験名")
+	flag.Func("metric-namespace", "すべてのメトリクス名の前に付ける名前空間（例: lab1 → lab1_client_...）", metrics.SetNamespace)
+	flag.Func("metric-prefix", "サービスのメトリクス名の接頭辞を上書きする（service=prefix、例: aes-client=fork_client_、複数指定可）", metrics.ParsePrefix)
+	flag.Func("metrics-auth", "/metricsにBasic認証を要求する（user:password、環境変数METRICS_AUTHでも指定できる）", metrics.SetBasicAuth)
+	noRuntimeMetrics := flag.Bool("no-runtime-metrics", false, "Goランタイムとプロセスのメトリクス（go_*、process_*）を公開しない")
+	nativeHistograms := flag.Bool("native-histograms", false, "所要時間のヒストグラムをネイティブヒストグラム（スパースなバケット）としても公開する（Prometheusでnative histogramsを有効にしてprotobuf形式で取得する）")
+	grafanaURL := flag.String("grafana-url", "", "鍵の更新や設定の変更をアノテーションとして送るGrafanaのURL（環境変数GRAFANA_URLでも指定できる、空の場合は送らない）")
+	grafanaToken := flag.String("grafana-token", "", "GrafanaのAPIトークン（環境変数GRAFANA_API_TOKENでも指定できる）")
+	soakMode := flag.Bool("soak", false, "長時間の連続運転でヒープ・ゴルーチン・ファイルディスクリプタの増加を監視し、リークの疑いを記録する")
+	soakConfig := soak.DefaultConfig()
+	flag.DurationVar(&soakConfig.SampleInterval, "soak-interval", soakConfig.SampleInterval, "-soak で使用量を記録する間隔")
+	flag.DurationVar(&soakConfig.Window, "soak-window", soakConfig.Window, "-soak でリークを判定する期間")
+	flag.StringVar(&cfg.ConfigFile, "config", "", "起動時とSIGHUPで読み込む設定ファイル（interval、payload_size、algorithms、各URLのJSON）")
+	flag.StringVar(&cfg.AdminToken, "admin-token", "", "POST /config に必要なBearerトークン（環境変数ADMIN_TOKENでも指定できる、空の場合は変更を受け付けない）")
+	flag.StringVar(&cfg.ServerToken, "server-token", "", "サーバーの -auth-token に対して送るoperatorのロールのBearerトークン（環境変数SERVER_TOKENでも指定できる）")
+	features.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if cfg.AdminToken == "" {
+		cfg.AdminToken = os.Getenv("ADMIN_TOKEN")
+	}
+	if cfg.ServerToken == "" {
+		cfg.ServerToken = os.Getenv("SERVER_TOKEN")
+	}
+	metrics.SetRunLabels(*runID, *experiment)
+	if *noRuntimeMetrics {
+		metrics.DisableRuntimeCollectors()
+	}
+	if *nativeHistograms {
+		metrics.EnableNativeHistograms()
+	}
+	if err := annotation.Configure(*grafanaURL, *grafanaToken); err != nil {
+		log.Fatal("設定エラー:", err)
+	}
+	annotation.PostVersion()
+	if *soakMode {
+		soak.Start(soakConfig)
+	}
+
+	if *loopback {
+		cfg.RSALoopback = rsaserver.NewHandler(rsaserver.DefaultConfig())
+		cfg.MLKEMLoopback = mlkemserver.NewHandler(mlkemserver.DefaultConfig())
 	}
 
-	var pubKeyResp PublicKeyResponse
-	if err := json.NewDecoder(resp.Body).Decode(&pubKeyResp); err != nil {
-		return nil, nil, fmt.Errorf("JSONデコードエラー: %w", err)
-	}
-
-	// Base64デコード
-	pubKeyBytes, err := base64.StdEncoding.DecodeString(pubKeyResp.PublicKey)
-	if err != nil {
-		return nil, nil, fmt.Errorf("Base64デコードエラー: %w", err)
-	}
-
-	// 公開鍵をパース
-	pubKeyInterface, err := x509.ParsePKIXPublicKey(pubKeyBytes)
-	if err != nil {
-		return nil, nil, fmt.Errorf("公開鍵のパースエラー: %w", err)
-	}
-
-	publicKey, ok := pubKeyInterface.(*rsa.PublicKey)
-	if !ok {
-		return nil, nil, fmt.Errorf("RSA公開鍵への変換エラー")
-	}
-
-	return publicKey, pubKeyBytes, nil
-}
-
-// ML-KEM公開鍵を取得
-func fetchMLKEMPublicKey(url string) (*kyber768.PublicKey, []byte, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, nil, fmt.Errorf("HTTP GETエラー: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, nil, fmt.Errorf("HTTPステータスエラー: %d", resp.StatusCode)
-	}
-
-	var pubKeyResp struct {
-		PublicKey string `json:"public_key"`
-		Algorithm string `json:"algorithm"`
-		KeySize   int    `json:"key_size"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&pubKeyResp); err != nil {
-		return nil, nil, fmt.Errorf("JSONデコードエラー: %w", err)
-	}
-
-	// Base64デコード
-	pubKeyBytes, err := base64.StdEncoding.DecodeString(pubKeyResp.PublicKey)
-	if err != nil {
-		return nil, nil, fmt.Errorf("Base64デコードエラー: %w", err)
-	}
-
-	// ML-KEM公開鍵をデシリアライズ
-	scheme := kyber768.Scheme()
-	publicKey, err := scheme.UnmarshalBinaryPublicKey(pubKeyBytes)
-	if err != nil {
-		return nil, nil, fmt.Errorf("公開鍵のデシリアライズエラー: %w", err)
-	}
-
-	mlkemPublicKey, ok := publicKey.(*kyber768.PublicKey)
-	if !ok {
-		return nil, nil, fmt.Errorf("ML-KEM公開鍵への変換エラー")
-	}
-
-	return mlkemPublicKey, pubKeyBytes, nil
-}
-
-// AESでデータを暗号化（AES-256-CBC）
-func encryptAES(plaintext []byte, key []byte) ([]byte, []byte, error) {
-	// AES暗号ブロックを作成
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	// パディングを追加
-	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
-	padtext := bytes.Repeat([]byte{byte(padding)}, padding)
-	plaintext = append(plaintext, padtext...)
-
-	// 初期化ベクトル（IV）を生成
-	iv := make([]byte, aes.BlockSize)
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		return nil, nil, err
-	}
-
-	// CBCモードで暗号化
-	ciphertext := make([]byte, len(plaintext))
-	mode := cipher.NewCBCEncrypter(block, iv)
-	mode.CryptBlocks(ciphertext, plaintext)
-
-	return ciphertext, iv, nil
-}
-
-// RSAで鍵を暗号化（OAEP）
-func encryptRSA(publicKey *rsa.PublicKey, data []byte) ([]byte, error) {
-	hash := sha256.New()
-	ciphertext, err := rsa.EncryptOAEP(hash, rand.Reader, publicKey, data, nil)
-	if err != nil {
-		return nil, err
-	}
-	return ciphertext, nil
-}
+	// Prometheusメトリクスサーバーを起動
+	go func() {
+		log.Printf("メトリクスサーバーを起動: %s/metrics", metrics.DisplayURL(*metricsAddr))
+		if err := metrics.ListenAndServe(*metricsAddr, benchclient.MetricsServerMux()); err != nil {
+			log.Printf("メトリクスサーバーエラー: %v", err)
+		}
+	}()
 
-// ML-KEMでカプセル化（暗号化）
-func encryptMLKEM(publicKey *kyber768.PublicKey, data []byte) ([]byte, []byte, error) {
-	scheme := kyber768.Scheme()
-	// カプセル化: 共有秘密鍵とカプセル化テキストを生成
-	ciphertext, sharedSecret, err := scheme.Encapsulate(publicKey)
-	if err != nil {
-		return nil, nil, err
-	}
-	// 実際のアプリケーションでは、sharedSecretを使ってdataを暗号化する
-	// ここでは比較のためカプセル化テキストのサイズを測定
-	return ciphertext, sharedSecret, nil
+	benchclient.Run(cfg)
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/benchclient"
+)
+
+// verify サブコマンド: 鍵合意のセッションをN回実行し、所要時間のパーセンタイルやサイズが閾値を超えた場合は0以外で終了する
+// Prometheusを使わずにデプロイのパイプラインで暗号処理の性能を確認するために使う
+func verifyMain(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	defaults := benchclient.DefaultConfig()
+	cfg := benchclient.VerifyConfig{URLs: map[string]string{}}
+	fs.IntVar(&cfg.Iterations, "n", 100, "鍵交換方式ごとに実行するセッションの回数")
+	fs.IntVar(&cfg.MessageSize, "message-size", 64, "暗号化するメッセージのサイズ（バイト）")
+	fs.Func("aes-key-sizes", "セッションごとに順に使うAES鍵のサイズ（ビット、128・192・256をカンマ区切り、例: 128,256、既定は256のみ）", func(s string) (err error) {
+		cfg.AESKeySizes, err = benchclient.ParseAESKeySizes(s)
+		return err
+	})
+	rsaURL := fs.String("rsa-url", defaults.RSAURL, "RSA公開鍵を取得するURL")
+	mlkemURL := fs.String("mlkem-url", defaults.MLKEMURL, "ML-KEM公開鍵を取得するURL")
+	dualURL := fs.String("dual-url", "", "二重保護サーバーの公開鍵を取得するURL")
+	ecdhURL := fs.String("ecdh-url", "", "ECDH（P-256）サーバーの公開鍵を取得するURL")
+	fs.Func("threshold", "閾値（algorithm.metric[.pNN]<limit、例: mlkem.encapsulate.p99<1ms、mlkem.envelope<2000、複数指定可）", func(s string) error {
+		t, err := benchclient.ParseThreshold(s)
+		if err != nil {
+			return err
+		}
+		cfg.Thresholds = append(cfg.Thresholds, t)
+		return nil
+	})
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "使い方: aes-client verify -threshold SPEC [-threshold SPEC ...] [flags]")
+		fmt.Fprintln(fs.Output(), "metric: fetch / encapsulate / send / server / confirm / session（所要時間、pNNが必要） / envelope / key_material / public_key（バイト、最大値）")
+		fmt.Fprintln(fs.Output(), "すべての閾値を満たした場合は0、満たさない閾値がある場合は1、セッションが失敗した場合は2で終了する")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if len(cfg.Thresholds) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cfg.URLs[benchclient.AlgorithmRSA] = *rsaURL
+	cfg.URLs[benchclient.AlgorithmMLKEM] = *mlkemURL
+	cfg.URLs[benchclient.AlgorithmDual] = *dualURL
+	cfg.URLs[benchclient.AlgorithmECDH] = *ecdhURL
+
+	results, err := benchclient.Verify(cfg)
+	if err != nil {
+		log.Printf("閾値の確認エラー: %v", err)
+		os.Exit(2)
+	}
+	failed := 0
+	for _, r := range results {
+		status := "OK  "
+		if !r.Passed {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Printf("%s %-32s 実測値 %s\n", status, r.Threshold.Spec, formatObserved(r))
+	}
+	if failed > 0 {
+		fmt.Printf("%d個の閾値を満たしませんでした（%d回）\n", failed, cfg.Iterations)
+		os.Exit(1)
+	}
+	fmt.Printf("すべての閾値を満たしました（%d回）\n", cfg.Iterations)
+}
+
+func formatObserved(r benchclient.ThresholdResult) string {
+	if r.Threshold.IsDuration() {
+		return time.Duration(r.Observed * float64(time.Second)).String()
+	}
+	return fmt.Sprintf("%.0fバイト", r.Observed)
+}
@@ -0,0 +1,163 @@
+// Package annotation は鍵の更新や設定の変更などの出来事をGrafanaのアノテーションとして送信する
+//
+// 性能の変化が起きた時刻にダッシュボード上で理由が分かるように、
+// タグ（pqc、サービス名、出来事の種類）を付けてPOST /api/annotations に送る
+// 送信は専用のゴルーチンで行い、Grafanaが応答しなくても計測には影響しない
+package annotation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "grafana-annotation"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は annotation_）
+var factory = metrics.NewFactory(ServiceName, "annotation_")
+
+// 出来事の種類（タグとメトリクスのラベルに使う）
+const (
+	EventKeyRotation     = "key_rotation"
+	EventAlgorithmSwitch = "algorithm_switch"
+	EventConfigReload    = "config_reload"
+	EventVersion         = "version"
+)
+
+var posts = factory.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "annotation_posts_total",
+		Help: "Total number of Grafana annotations, by event and result (success, failure or dropped)",
+	},
+	[]string{"event", "result"},
+)
+
+// 送信待ちのアノテーションの上限（超えた分は捨てる）
+const queueSize = 64
+
+// Grafanaのアノテーション
+type annotation struct {
+	Time  int64    `json:"time"` // Unixミリ秒
+	Tags  []string `json:"tags"`
+	Text  string   `json:"text"`
+	event string
+}
+
+var sender struct {
+	sync.Mutex
+	endpoint string
+	token    string
+	queue    chan annotation
+}
+
+var client = &http.Client{Timeout: 5 * time.Second}
+
+// アノテーションの送信先を設定する
+// grafanaURLが空の場合は環境変数GRAFANA_URLを使い、どちらも空の場合は送信しない
+// tokenが空の場合は環境変数GRAFANA_API_TOKENを使う（Grafanaのサービスアカウントのトークン）
+func Configure(grafanaURL, token string) error {
+	if grafanaURL == "" {
+		grafanaURL = os.Getenv("GRAFANA_URL")
+	}
+	if token == "" {
+		token = os.Getenv("GRAFANA_API_TOKEN")
+	}
+	if grafanaURL == "" {
+		return nil
+	}
+	u, err := url.Parse(grafanaURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("GrafanaのURLが不正です: %q", grafanaURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/annotations"
+
+	sender.Lock()
+	defer sender.Unlock()
+	sender.endpoint = u.String()
+	sender.token = token
+	if sender.queue == nil {
+		sender.queue = make(chan annotation, queueSize)
+		go send(sender.queue)
+	}
+	return nil
+}
+
+// 出来事をアノテーションとして送信する（送信先が設定されていない場合は何もしない）
+// 呼び出し元を待たせないように、キューがいっぱいの場合は捨てる
+func Post(service, event, text string) {
+	sender.Lock()
+	queue := sender.queue
+	sender.Unlock()
+	if queue == nil {
+		return
+	}
+	a := annotation{
+		Time:  time.Now().UnixMilli(),
+		Tags:  []string{"pqc", service, event},
+		Text:  text,
+		event: event,
+	}
+	select {
+	case queue <- a:
+	default:
+		posts.WithLabelValues(event, "dropped").Inc()
+	}
+}
+
+// 起動したバイナリのバージョンを送信する
+// デプロイの前後で性能が変わった場合に、どのビルドに切り替わったかをダッシュボードで確認できる
+func PostVersion() {
+	info := metrics.ReadBuildInfo()
+	Post(info.Binary, EventVersion, fmt.Sprintf("%s を起動しました（バージョン %s、コミット %s、Go %s、circl %s）",
+		info.Binary, info.Version, info.Commit, info.GoVersion, info.CirclVersion))
+}
+
+func send(queue <-chan annotation) {
+	for a := range queue {
+		if err := post(a); err != nil {
+			posts.WithLabelValues(a.event, "failure").Inc()
+			log.Printf("Grafanaへのアノテーションの送信に失敗 [%s]: %v", a.event, err)
+			continue
+		}
+		posts.WithLabelValues(a.event, "success").Inc()
+	}
+}
+
+func post(a annotation) error {
+	sender.Lock()
+	endpoint, token := sender.endpoint, sender.token
+	sender.Unlock()
+
+	body, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("JSONエンコードエラー: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP POSTエラー: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTPステータスエラー: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+// Package apidoc はサーバーのエンドポイント一覧から、OpenAPIの説明（/openapi.json）と
+// 最小限のインデックスページを生成する
+package apidoc
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// OpenAPIのバージョン
+const openAPIVersion = "3.0.3"
+
+// エンドポイントの説明
+// Request・Responseには構造体の値（またはnil）を指定し、JSONタグからスキーマを作成する
+type Endpoint struct {
+	Method      string
+	Path        string // パスパラメータは {name} で表す
+	Summary     string
+	Request     any    // リクエストボディ（nilの場合はなし）
+	Response    any    // 成功時のJSONレスポンス（nilの場合はContentTypeの本文）
+	ContentType string // レスポンスの形式（空の場合はResponseがあれば application/json、なければ text/plain）
+}
+
+// APIの説明
+type API struct {
+	Title       string
+	Description string
+	Endpoints   []Endpoint
+}
+
+// ハンドラーを登録し、エンドポイントの説明に追加する
+// 説明とルーティングを同じ場所で定義するため、/openapi.json と実際のハンドラーがずれない
+func (a *API) Handle(mux *http.ServeMux, e Endpoint, h http.Handler) {
+	a.Endpoints = append(a.Endpoints, e)
+	mux.Handle(e.Path, h)
+}
+
+// 説明だけを追加する（1つのハンドラーが複数のエンドポイントを持つ場合）
+func (a *API) Document(endpoints ...Endpoint) {
+	a.Endpoints = append(a.Endpoints, endpoints...)
+}
+
+// OpenAPI 3の説明を作成する
+func (a API) Spec() map[string]any {
+	paths := make(map[string]any)
+	for _, e := range a.Endpoints {
+		item, _ := paths[e.Path].(map[string]any)
+		if item == nil {
+			item = make(map[string]any)
+			paths[e.Path] = item
+		}
+		op := map[string]any{
+			"summary":   e.Summary,
+			"responses": map[string]any{"200": response(e)},
+		}
+		if params := pathParameters(e.Path); len(params) > 0 {
+			op["parameters"] = params
+		}
+		if e.Request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": Schema(e.Request)}},
+			}
+		}
+		item[strings.ToLower(e.Method)] = op
+	}
+	return map[string]any{
+		"openapi": openAPIVersion,
+		"info":    map[string]any{"title": a.Title, "description": a.Description, "version": "1"},
+		"paths":   paths,
+	}
+}
+
+func response(e Endpoint) map[string]any {
+	if e.Response != nil {
+		contentType := e.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		return map[string]any{
+			"description": "OK",
+			"content":     map[string]any{contentType: map[string]any{"schema": Schema(e.Response)}},
+		}
+	}
+	contentType := e.ContentType
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	return map[string]any{
+		"description": "OK",
+		"content":     map[string]any{contentType: map[string]any{}},
+	}
+}
+
+func pathParameters(path string) []any {
+	var params []any
+	for _, segment := range strings.Split(path, "/") {
+		if name, ok := strings.CutPrefix(segment, "{"); ok {
+			params = append(params, map[string]any{
+				"name":     strings.TrimSuffix(name, "}"),
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]any{"type": "string"},
+			})
+		}
+	}
+	return params
+}
+
+// 値の型からJSONスキーマを作成する（JSONタグのない公開フィールドはフィールド名を使う）
+func Schema(v any) map[string]any {
+	return schemaOf(reflect.TypeOf(v))
+}
+
+func schemaOf(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]any)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			properties[name] = schemaOf(f.Type)
+		}
+		return map[string]any{"type": "object", "properties": properties}
+	}
+	return map[string]any{}
+}
+
+// /openapi.json のハンドラー
+func (a *API) SpecHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(a.Spec())
+	})
+}
+
+// リンクにできるのはパスパラメータのないGETだけ
+var indexTemplate = template.Must(template.New("index").Funcs(template.FuncMap{
+	"hasParam": func(path string) bool { return strings.Contains(path, "{") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+	<title>{{.Title}}</title>
+</head>
+<body>
+	<h1>{{.Title}}</h1>
+	<p>{{.Description}}</p>
+	<ul>
+	{{- range .Endpoints}}
+		<li>{{if and (eq .Method "GET") (not (hasParam .Path))}}<a href="{{.Path}}">{{.Method}} {{.Path}}</a>{{else}}{{.Method}} {{.Path}}{{end}} - {{.Summary}}</li>
+	{{- end}}
+	</ul>
+</body>
+</html>
+`))
+
+// エンドポイント一覧のインデックスページを書き込む
+func (a API) WriteIndex(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return indexTemplate.Execute(w, a)
+}
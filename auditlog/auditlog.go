@@ -0,0 +1,268 @@
+// Package auditlog はサーバーの秘密鍵による操作（復号・カプセル化の解除・鍵合意・署名）を
+// 追記のみのJSON Linesのファイルに記録する
+//
+// 各記録は直前の記録のハッシュを含めたSHA-256で連鎖させるため、途中の記録の改ざん・削除・並べ替えを
+// Verify（cmd/audit-log-verify）で検出できる。書き込みに失敗しても操作は止めず、失敗の回数を記録する
+package auditlog
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/internal/httpmw"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// サービス名（メトリクスのserviceラベル）
+const ServiceName = "audit-log"
+
+var factory = metrics.NewFactory(ServiceName, "audit_log_")
+
+// 操作の種類
+const (
+	OperationDecrypt      = "decrypt"       // RSA-OAEPによる復号
+	OperationDecapsulate  = "decapsulate"   // ML-KEMのカプセル化の解除
+	OperationKeyAgreement = "key_agreement" // 静的鍵によるECDH
+	OperationSign         = "sign"          // 長期署名鍵による署名
+)
+
+// 操作の結果
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// 最初の記録のprev_hash
+var genesisHash = strings.Repeat("0", sha256.Size*2)
+
+var (
+	entriesWritten = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "audit_log_entries_written_total",
+			Help: "Total number of private key operations written to the audit log, by origin service, operation (decrypt, decapsulate, key_agreement, sign) and result",
+		},
+		[]string{"origin_service", "operation", "result"},
+	)
+	writeFailures = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "audit_log_write_failures_total",
+			Help: "Total number of private key operations that could not be written to the audit log (the operation itself is not blocked), by origin service",
+		},
+		[]string{"origin_service"},
+	)
+	writeDuration = factory.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "audit_log_write_duration_seconds",
+			Help:    "Duration of hashing and appending one audit log entry in seconds",
+			Buckets: []float64{0.000005, 0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.005},
+		},
+	)
+)
+
+// 1件の記録（1行に1つ）
+// すべて文字列と整数にし、読み込んでから同じバイト列に書き戻せるようにする（ハッシュの検証のため）
+type Entry struct {
+	Seq       uint64 `json:"seq"`
+	Time      string `json:"time"` // RFC 3339（UTC、ナノ秒）
+	Service   string `json:"service"`
+	Operation string `json:"operation"`
+	KeyID     string `json:"key_id"`
+	Algorithm string `json:"algorithm"`
+	RequestID string `json:"request_id"`
+	Client    string `json:"client"` // TLSのクライアント証明書のCN、なければ接続元のアドレス
+	Result    string `json:"result"`
+	PrevHash  string `json:"prev_hash"`      // 直前の記録のhash（16進数）
+	Hash      string `json:"hash,omitempty"` // hashを除いた記録のJSONのSHA-256（16進数）
+}
+
+// 記録する操作
+type Event struct {
+	Service   string
+	Operation string
+	KeyID     string
+	Algorithm string
+	Err       error // nilの場合は成功
+}
+
+// 監査ログ（nilの場合は何も記録しない）
+type Log struct {
+	mu   sync.Mutex
+	w    io.Writer
+	seq  uint64
+	prev string
+}
+
+// ファイルに追記する（ファイルは所有者だけが読めるように作る）
+// 既存の記録がある場合は連鎖を検証してから最後の記録に続ける
+// サーバーの停止中に改ざん・削除された記録に正しく見える続きを書き足さないように、検証に失敗した場合はエラーを返す
+func Open(path string) (*Log, error) {
+	l := &Log{prev: genesisHash}
+	if f, err := os.Open(path); err == nil {
+		report, err := Verify(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("既存の監査ログの連鎖を検証できません（連鎖を続けられません）: %w", err)
+		}
+		l.seq, l.prev = uint64(report.Entries), report.LastHash
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("監査ログを開けません: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("監査ログを開けません: %w", err)
+	}
+	l.w = f
+	return l, nil
+}
+
+// ファイルを閉じる
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c, ok := l.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// リクエストに対する秘密鍵の操作を記録する
+func (l *Log) Record(r *http.Request, ev Event) {
+	if l == nil {
+		return
+	}
+	start := time.Now()
+	e := Entry{
+		Time:      start.UTC().Format(time.RFC3339Nano),
+		Service:   ev.Service,
+		Operation: ev.Operation,
+		KeyID:     ev.KeyID,
+		Algorithm: ev.Algorithm,
+		RequestID: httpmw.RequestID(r.Context()),
+		Client:    ClientIdentity(r),
+		Result:    ResultSuccess,
+	}
+	if ev.Err != nil {
+		e.Result = ResultFailure
+	}
+	if err := l.append(e); err != nil {
+		writeFailures.WithLabelValues(ev.Service).Inc()
+		log.Printf("[%s] 監査ログの書き込みエラー: %v", ServiceName, err)
+		return
+	}
+	writeDuration.Observe(time.Since(start).Seconds())
+	entriesWritten.WithLabelValues(e.Service, e.Operation, e.Result).Inc()
+}
+
+// 連番と直前のハッシュを付けて1行を書き込む（書き込めなかった場合は連鎖を進めない）
+func (l *Log) append(e Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e.Seq, e.PrevHash = l.seq, l.prev
+	hash, err := e.sum()
+	if err != nil {
+		return err
+	}
+	e.Hash = hash
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	l.seq, l.prev = e.Seq+1, hash
+	return nil
+}
+
+// hashを除いた記録のハッシュ
+func (e Entry) sum() (string, error) {
+	e.Hash = ""
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// 操作を要求したクライアント
+// TLSのクライアント証明書があればそのCN、なければ接続元のアドレス
+func ClientIdentity(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		if cn := r.TLS.PeerCertificates[0].Subject.CommonName; cn != "" {
+			return "cn=" + cn
+		}
+	}
+	return r.RemoteAddr
+}
+
+// 記録を順に読み込む
+func Scan(r io.Reader, fn func(Entry) error) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("%d行目の形式が不正です: %w", line, err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// 検証の結果
+type Report struct {
+	Entries  int    // 検証した記録の数
+	LastHash string // 最後の記録のhash（外部に控えておけば末尾の削除も検出できる）
+}
+
+// 連鎖を検証する（改ざん・削除・並べ替えがあれば最初に見つかった行をエラーで返す）
+func Verify(r io.Reader) (Report, error) {
+	report := Report{LastHash: genesisHash}
+	err := Scan(r, func(e Entry) error {
+		line := report.Entries + 1
+		if e.Seq != uint64(report.Entries) {
+			return fmt.Errorf("%d行目: 連番が%dではなく%dです（記録の削除または並べ替え）", line, report.Entries, e.Seq)
+		}
+		if e.PrevHash != report.LastHash {
+			return fmt.Errorf("%d行目: prev_hashが直前の記録のhashと一致しません（記録の削除・並べ替え・改ざん）", line)
+		}
+		hash, err := e.sum()
+		if err != nil {
+			return err
+		}
+		if hash != e.Hash {
+			return fmt.Errorf("%d行目: hashが記録の内容と一致しません（記録の改ざん）", line)
+		}
+		report.Entries++
+		report.LastHash = e.Hash
+		return nil
+	})
+	return report, err
+}
+
+// ファイルの連鎖を検証する
+func VerifyFile(path string) (Report, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Report{}, err
+	}
+	defer f.Close()
+	return Verify(f)
+}
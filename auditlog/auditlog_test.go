@@ -0,0 +1,64 @@
+package auditlog
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeEntries(t *testing.T, path string, n int) {
+	t.Helper()
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/decrypt", nil)
+	for range n {
+		l.Record(r, Event{Service: "audit-test", Operation: OperationDecrypt, KeyID: "k1", Algorithm: "RSA-OAEP-2048"})
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenContinuesChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	writeEntries(t, path, 2)
+	writeEntries(t, path, 2)
+	report, err := VerifyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Entries != 4 {
+		t.Fatalf("Entries = %d, want 4", report.Entries)
+	}
+}
+
+func TestOpenRejectsBrokenChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	writeEntries(t, path, 3)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(b), "\n")
+
+	tests := map[string]string{
+		"改ざん":     strings.Replace(string(b), `"key_id":"k1"`, `"key_id":"k2"`, 1),
+		"途中の削除":   lines[0] + lines[2],
+		"先頭の切り詰め": lines[1] + lines[2],
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if l, err := Open(path); err == nil {
+				l.Close()
+				t.Fatal("壊れた連鎖の監査ログを開けました")
+			}
+		})
+	}
+}
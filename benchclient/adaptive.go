@@ -0,0 +1,130 @@
+package benchclient
+
+import (
+	"log"
+	"math"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	latencyVariation = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_latency_coefficient_of_variation",
+			Help: "Coefficient of variation (standard deviation / mean) of the recent session durations used by adaptive sampling, by algorithm",
+		},
+		[]string{"algorithm"},
+	)
+	samplingRate = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_sampling_rate_ops_per_second",
+			Help: "Current target rate of encryptions per second, including the adaptive sampling factor and burst size",
+		},
+	)
+	samplingFactor = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_sampling_rate_factor",
+			Help: "Current multiplier applied to the configured encryption rate by adaptive sampling (1 when not raised)",
+		},
+	)
+)
+
+// 変動係数を求める直近のセッション数
+const adaptiveWindow = 30
+
+// 変動係数が閾値を超えている間は実行頻度を上げ、落ち着いたら元に戻す制御
+var adaptive struct {
+	sync.Mutex
+	threshold float64 // 変動係数の閾値（0の場合は無効）
+	maxFactor int
+	factor    int
+	samples   map[string][]float64 // 鍵交換方式 → 直近のセッションの所要時間（秒）
+}
+
+func initAdaptive(threshold float64, maxFactor int) {
+	adaptive.Lock()
+	defer adaptive.Unlock()
+	adaptive.threshold = threshold
+	adaptive.maxFactor = max(maxFactor, 1)
+	adaptive.factor = 1
+	adaptive.samples = make(map[string][]float64)
+	samplingFactor.Set(1)
+}
+
+func samplingFactorValue() int {
+	adaptive.Lock()
+	defer adaptive.Unlock()
+	return max(adaptive.factor, 1)
+}
+
+// セッションの所要時間を直近の窓に加える
+func observeAdaptive(algorithm string, seconds float64) {
+	adaptive.Lock()
+	defer adaptive.Unlock()
+	if adaptive.threshold <= 0 {
+		return
+	}
+	s := append(adaptive.samples[algorithm], seconds)
+	if len(s) > adaptiveWindow {
+		s = s[len(s)-adaptiveWindow:]
+	}
+	adaptive.samples[algorithm] = s
+}
+
+// 直近の変動係数から実行頻度の倍率を決める
+// いずれかの方式の変動係数が閾値を超えたら倍率を2倍に（上限maxFactor）、すべての方式で閾値の半分を下回ったら半分にする
+// 倍率が変わった場合は標本を捨ててtrueを返す
+func adaptSampling() bool {
+	adaptive.Lock()
+	defer adaptive.Unlock()
+	if adaptive.threshold <= 0 {
+		return false
+	}
+	worst, evaluated := 0.0, false
+	for algorithm, s := range adaptive.samples {
+		// 標本が少ないうちは判断しない
+		if len(s) < adaptiveWindow/3 {
+			continue
+		}
+		cv := coefficientOfVariation(s)
+		latencyVariation.WithLabelValues(algorithm).Set(cv)
+		worst, evaluated = math.Max(worst, cv), true
+	}
+	if !evaluated {
+		return false
+	}
+	factor := adaptive.factor
+	switch {
+	case worst > adaptive.threshold:
+		factor = min(factor*2, adaptive.maxFactor)
+	case worst < adaptive.threshold/2:
+		factor = max(factor/2, 1)
+	}
+	if factor == adaptive.factor {
+		return false
+	}
+	log.Printf("変動係数 %.2f（閾値 %.2f）により実行頻度の倍率を %d → %d に変更します", worst, adaptive.threshold, adaptive.factor, factor)
+	adaptive.factor = factor
+	samplingFactor.Set(float64(factor))
+	// 倍率を変えた後の標本が集まるまで次の判断をしない
+	clear(adaptive.samples)
+	return true
+}
+
+// 標準偏差を平均で割った値
+func coefficientOfVariation(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	if mean == 0 {
+		return 0
+	}
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sq/float64(len(values))) / mean
+}
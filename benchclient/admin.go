@@ -0,0 +1,187 @@
+package benchclient
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	pausedGauge = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_paused",
+			Help: "Whether the benchmark loop is paused (1) or running (0)",
+		},
+	)
+	intervalGauge = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_interval_seconds",
+			Help: "Current interval between benchmark runs in seconds",
+		},
+	)
+	payloadSizeGauge = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_payload_size_bytes",
+			Help: "Current size of the encrypted message in bytes (0 means the built-in message)",
+		},
+	)
+	adminActions = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_admin_actions_total",
+			Help: "Total number of admin actions (pause, resume, run), by result",
+		},
+		[]string{"action", "result"},
+	)
+)
+
+// 管理画面の操作
+const (
+	adminActionPause  = "pause"
+	adminActionResume = "resume"
+	adminActionRun    = "run"
+)
+
+// 間隔・メッセージのサイズ・一時停止の状態をメトリクスに記録する（liveのロックを取得した状態で呼ぶ）
+func recordLiveStateLocked() {
+	intervalGauge.Set(live.interval.Seconds())
+	payloadSizeGauge.Set(float64(live.payloadSize))
+	if live.paused {
+		pausedGauge.Set(1)
+	} else {
+		pausedGauge.Set(0)
+	}
+}
+
+// ベンチマークのループを一時停止・再開する
+func setPaused(paused bool) {
+	live.Lock()
+	defer live.Unlock()
+	live.paused = paused
+	recordLiveStateLocked()
+}
+
+func isPaused() bool {
+	live.RLock()
+	defer live.RUnlock()
+	return live.paused
+}
+
+// 一時停止中でも1回だけ実行するようにループに依頼する
+func triggerRun() error {
+	select {
+	case live.runOnce <- struct{}{}:
+		return nil
+	default:
+		return errors.New("実行の依頼が混み合っています")
+	}
+}
+
+// ベンチマークのループを操作する管理画面のハンドラー
+//
+//	GET  /admin        現在の状態と操作フォーム
+//	POST /admin/pause  一時停止
+//	POST /admin/resume 再開
+//	POST /admin/run    1回だけ実行する
+//
+// 操作にはPOST /config と同じBearerトークンが必要（間隔とメッセージのサイズの変更はPOST /config を使う）
+func AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/admin"), "/")
+		if action == "" {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			adminPage(w)
+			return
+		}
+		if action != adminActionPause && action != adminActionResume && action != adminActionRun {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorizedAdmin(r) {
+			adminActions.WithLabelValues(action, "unauthorized").Inc()
+			http.Error(w, "認証が必要です", http.StatusUnauthorized)
+			return
+		}
+		switch action {
+		case adminActionPause:
+			setPaused(true)
+			log.Println("ベンチマークを一時停止しました")
+		case adminActionResume:
+			setPaused(false)
+			log.Println("ベンチマークを再開しました")
+		case adminActionRun:
+			if err := triggerRun(); err != nil {
+				adminActions.WithLabelValues(action, "busy").Inc()
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+				return
+			}
+		}
+		adminActions.WithLabelValues(action, "success").Inc()
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// 管理画面
+// 操作はトークンを入力してfetchで送信する（トークンはブラウザに保存しない）
+func adminPage(w http.ResponseWriter) {
+	live.RLock()
+	state := "実行中"
+	if live.paused {
+		state = "一時停止中"
+	}
+	interval, payloadSize := live.interval, live.payloadSize
+	algorithms := strings.Join(sortedAlgorithms(), ", ")
+	live.RUnlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `
+	<!DOCTYPE html>
+	<html>
+	<head>
+		<meta charset="UTF-8">
+		<title>ハイブリッド暗号化クライアント 管理画面</title>
+	</head>
+	<body>
+		<h1>ハイブリッド暗号化クライアント 管理画面</h1>
+		<ul>
+			<li>状態: %s</li>
+			<li>間隔: %s</li>
+			<li>メッセージのサイズ: %dバイト（0の場合は既定のメッセージ）</li>
+			<li>経路: %s</li>
+		</ul>
+		<p>トークン: <input type="password" id="token"></p>
+		<p>
+			<button onclick="send('/admin/pause')">一時停止</button>
+			<button onclick="send('/admin/resume')">再開</button>
+			<button onclick="send('/admin/run')">1回実行</button>
+		</p>
+		<p>間隔: <input id="interval" value="%s"> <button onclick="send('/config', {interval: value('interval')})">変更</button></p>
+		<p>メッセージのサイズ: <input id="payload" type="number" min="0" max="%d" value="%d"> <button onclick="send('/config', {payload_size: Number(value('payload'))})">変更</button></p>
+		<p id="result"></p>
+		<script>
+		function value(id) { return document.getElementById(id).value; }
+		async function send(path, body) {
+			const res = await fetch(path, {
+				method: 'POST',
+				headers: {'Authorization': 'Bearer ' + value('token')},
+				body: body ? JSON.stringify(body) : null,
+			});
+			document.getElementById('result').textContent = res.ok ? '送信しました' : (await res.text());
+			if (res.ok) setTimeout(() => location.reload(), 500);
+		}
+		</script>
+	</body>
+	</html>
+	`, state, interval, payloadSize, html.EscapeString(algorithms), interval, maxPayloadSize, payloadSize)
+}
@@ -0,0 +1,135 @@
+package benchclient
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/keyi1000/PQC_grafana/entropy"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 既定のAES鍵のサイズ（ビット）
+const defaultAESKeyBits = 256
+
+var (
+	aesKeySizesConfigured = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_aes_key_size_configured",
+			Help: "Set to 1 for each AES data key size in bits the client rotates through",
+		},
+		[]string{"key_bits"},
+	)
+	aesEncryptByKeySize = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "client_aes_encrypt_duration_by_key_size_seconds",
+			Help:    "Duration of encrypting the message with AES (CBC-HMAC or GCM) in seconds, by AES key size in bits",
+			Buckets: []float64{0.000005, 0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.005},
+		},
+		[]string{"key_bits"},
+	)
+	sessionByKeySize = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "client_session_duration_by_aes_key_size_seconds",
+			Help:    "Duration of a key agreement session from the public key fetch to the decrypt confirmation in seconds, by algorithm and AES key size in bits",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+		},
+		[]string{"algorithm", "key_bits"},
+	)
+	wrappedKeyByKeySize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_wrapped_key_size_by_aes_key_size_bytes",
+			Help: "Size of the protected AES key (RSA-OAEP ciphertext or GCM-wrapped key) of the last session in bytes, by algorithm and AES key size in bits",
+		},
+		[]string{"algorithm", "key_bits"},
+	)
+)
+
+// 暗号化ごとに順に使うAES鍵のサイズ（ビット）
+var aesKeySizes = []int{defaultAESKeyBits}
+
+// AES鍵のサイズの一覧をパースする（例: 128,192,256）
+func ParseAESKeySizes(s string) ([]int, error) {
+	var sizes []int
+	for _, f := range strings.Split(s, ",") {
+		bits, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || !validAESKeyBits(bits) {
+			return nil, fmt.Errorf("AES鍵のサイズは128・192・256のいずれかを指定してください: %q", f)
+		}
+		sizes = append(sizes, bits)
+	}
+	return sizes, nil
+}
+
+func validAESKeyBits(bits int) bool {
+	_, ok := cryptoutil.DataCipherFor(cryptoutil.FamilyCBCHMAC, bits/8)
+	return bits%8 == 0 && ok
+}
+
+// 暗号化ごとに使うAES鍵のサイズを設定する（空の場合はAES-256のみ）
+func setAESKeySizes(sizes []int) error {
+	if len(sizes) == 0 {
+		sizes = []int{defaultAESKeyBits}
+	}
+	for _, bits := range sizes {
+		if !validAESKeyBits(bits) {
+			return fmt.Errorf("AES鍵のサイズは128・192・256のいずれかを指定してください: %d", bits)
+		}
+	}
+	aesKeySizes = sizes
+	aesKeySizesConfigured.Reset()
+	for _, bits := range sizes {
+		aesKeySizesConfigured.WithLabelValues(strconv.Itoa(bits)).Set(1)
+	}
+	return nil
+}
+
+// counter回目の暗号化で使うAES鍵のサイズ（ビット）
+func aesKeyBitsFor(counter int) int {
+	return aesKeySizes[counter%len(aesKeySizes)]
+}
+
+// counter回目の暗号化で使うデータ鍵を生成する（-aes-key-sizesで設定したサイズを順に使う）
+func newDataKey(counter int) ([]byte, error) {
+	key := make([]byte, aesKeyBitsFor(counter)/8)
+	if _, err := io.ReadFull(entropy.Reader(entropy.OperationAESKey), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// AES鍵のサイズごとのメッセージの暗号化時間を記録する（ChaCha20-Poly1305は記録しない）
+func observeAESEncrypt(msg *SealedMessage) {
+	if dataCipherFamily == cryptoutil.FamilyChaCha20Poly1305 {
+		return
+	}
+	aesEncryptByKeySize.WithLabelValues(strconv.Itoa(msg.keyBits())).Observe(msg.AESEncrypt.Seconds())
+}
+
+// AES鍵のサイズごとのセッションの所要時間と保護した鍵のサイズを記録する
+func observeSessionKeySize(algorithm string, msg *SealedMessage, res *SessionResult) {
+	if res == nil {
+		return
+	}
+	bits := strconv.Itoa(msg.keyBits())
+	sessionByKeySize.WithLabelValues(algorithm, bits).Observe(res.Timings.Total.Seconds())
+	wrappedKeyByKeySize.WithLabelValues(algorithm, bits).Set(float64(len(res.WrappedKey)))
+}
+
+// メッセージの暗号化に使った鍵のサイズ（ビット）
+func (m *SealedMessage) keyBits() int {
+	if c, ok := cryptoutil.LookupDataCipher(m.algorithm()); ok {
+		return c.KeySize * 8
+	}
+	return defaultAESKeyBits
+}
+
+// 暗号化データのalgorithmに指定する方式（指定がなければAES-256-CBC + HMAC-SHA256）
+func (m *SealedMessage) algorithm() string {
+	if m.Algorithm == "" {
+		return cryptoutil.AlgorithmCBCHMAC
+	}
+	return m.Algorithm
+}
@@ -0,0 +1,26 @@
+package benchclient
+
+import "testing"
+
+func TestNewDataKeyFollowsConfiguredSizes(t *testing.T) {
+	t.Cleanup(func() { setAESKeySizes(nil) })
+	if err := setAESKeySizes([]int{128, 192, 256}); err != nil {
+		t.Fatal(err)
+	}
+	for counter, want := range []int{16, 24, 32, 16} {
+		key, err := newDataKey(counter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(key) != want {
+			t.Fatalf("newDataKey(%d) = %dバイト, want %d", counter, len(key), want)
+		}
+		msg, err := sealMessage([]byte("message"), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := msg.keyBits(); got != want*8 {
+			t.Fatalf("keyBits = %d, want %d", got, want*8)
+		}
+	}
+}
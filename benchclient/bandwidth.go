@@ -0,0 +1,99 @@
+package benchclient
+
+import (
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/keyi1000/PQC_grafana/internal/httpmw"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 通信量の内訳（鍵の受け渡しとメッセージはwire.ComponentKeyMaterial・wire.ComponentCiphertext）
+const (
+	componentPublicKey = "public_key" // 公開鍵の取得（/public-key・/keys・/signing-keyの本文、nonceを含む）
+	componentEnvelope  = "envelope"   // 暗号化データのJSONの残り（フィールド名、鍵ID、方式、nonceなど）
+	componentResponse  = "response"   // 復号結果のレスポンスの本文
+	componentHeaders   = "headers"    // リクエスト行・ステータス行とヘッダー
+	componentOther     = "other"      // 結果のアップロードなど
+)
+
+var wireBytesTotal = factory.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "client_wire_bytes_total",
+		Help: "Total number of HTTP bytes sent to and received from the servers, by target (key exchange algorithm, or results for uploads), direction (sent, received) and component (public_key, key_material, ciphertext, envelope, response, headers, other); headers are sized as HTTP/1.1 without TLS and TCP overhead",
+	},
+	[]string{"target", "direction", "component"},
+)
+
+func recordWireBytes(target, direction, component string, n int) {
+	if n > 0 {
+		wireBytesTotal.WithLabelValues(target, direction, component).Add(float64(n))
+	}
+}
+
+// 送った暗号化データを鍵の受け渡し・メッセージ・残りのJSONに分けて記録する
+func recordEnvelopeBytes(target string, data *EncryptedData, size int) {
+	keyMaterial, ciphertext := data.FieldSizes()
+	recordWireBytes(target, "sent", wire.ComponentKeyMaterial, keyMaterial)
+	recordWireBytes(target, "sent", wire.ComponentCiphertext, ciphertext)
+	recordWireBytes(target, "sent", componentEnvelope, size-keyMaterial-ciphertext)
+}
+
+// URLのパスから本文の内訳を決める
+func bodyComponent(urlPath, direction string) string {
+	switch path.Base(urlPath) {
+	case "public-key", "keys", "signing-key":
+		return componentPublicKey
+	case "decrypt", "decapsulate":
+		if direction == "received" {
+			return componentResponse
+		}
+	}
+	return componentOther
+}
+
+// リクエストとレスポンスのヘッダーを記録し、レスポンスの本文は読み取った分を記録するようにする
+// リクエストの本文は呼び出し側で記録する（暗号化データは内訳に分けるため）
+// ハンドラーを直接呼び出した場合（レスポンスにリクエストがない）はネットワークを使わないため記録せず、falseを返す
+func countExchange(target string, resp *http.Response, bodySize int) bool {
+	if resp.Request == nil {
+		return false
+	}
+	recordWireBytes(target, "sent", componentHeaders, requestHeaderSize(resp.Request, bodySize))
+	recordWireBytes(target, "received", componentHeaders, len(resp.Proto)+len(" \r\n")+len(resp.Status)+httpmw.HeaderSize(resp.Header)+len("\r\n"))
+	resp.Body = &countingResponseBody{ReadCloser: resp.Body, target: target, component: bodyComponent(resp.Request.URL.Path, "received")}
+	return true
+}
+
+// HTTP/1.1で送るリクエスト行とヘッダーの大きさ
+// Transportが加えるHost・User-Agent・Content-Length・Accept-Encodingと、トークンを設定した場合のAuthorizationも含める
+func requestHeaderSize(req *http.Request, bodySize int) int {
+	n := len(req.Method) + len(req.URL.RequestURI()) + len("  HTTP/1.1\r\n") +
+		len("Host: \r\n") + len(req.URL.Host) + httpmw.HeaderSize(req.Header) + len("Accept-Encoding: gzip\r\n") + len("\r\n")
+	if req.Header.Get("User-Agent") == "" {
+		n += len("User-Agent: Go-http-client/1.1\r\n")
+	}
+	if bodySize > 0 {
+		n += len("Content-Length: \r\n") + len(strconv.Itoa(bodySize))
+	}
+	if serverToken != "" {
+		n += len("Authorization: Bearer \r\n") + len(serverToken)
+	}
+	return n
+}
+
+// 読み取ったレスポンスの本文の大きさを記録する
+type countingResponseBody struct {
+	io.ReadCloser
+	target    string
+	component string
+}
+
+func (b *countingResponseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	recordWireBytes(b.target, "received", b.component, n)
+	return n, err
+}
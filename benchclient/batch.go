@@ -0,0 +1,89 @@
+package benchclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/fips"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	batchServerPerOp = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_batch_server_per_op_seconds",
+			Help: "Average server-side duration of one operation in the latest batch in seconds (pure algorithm cost)",
+		},
+		[]string{"algorithm"},
+	)
+	batchAmortizedPerOp = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_batch_amortized_per_op_seconds",
+			Help: "Round trip of the latest batch request divided by the batch size in seconds",
+		},
+		[]string{"algorithm"},
+	)
+	batchOverheadPerOp = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_batch_overhead_per_op_seconds",
+			Help: "HTTP and JSON overhead of the latest batch request divided by the batch size in seconds",
+		},
+		[]string{"algorithm"},
+	)
+	batchOpsPerSecond = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_batch_ops_per_second",
+			Help: "Server-side throughput of the latest batch in operations per second",
+		},
+		[]string{"algorithm"},
+	)
+)
+
+// 1回の暗号化ごとにサーバーで実行させるカプセル化の回数（0の場合は実行しない）
+var batchSize int
+
+// ML-KEMサーバーにN回のカプセル化を実行させ、1回あたりの純粋な計算時間とHTTPの負担を分けて記録する
+func runBatch() error {
+	if batchSize == 0 || !algorithmEnabled(AlgorithmMLKEM) || fips.Enabled() {
+		return nil
+	}
+	batchURL, err := endpointURL(mlkemURL, "/encapsulate-batch")
+	if err != nil {
+		return atStage("batch", withCategory(categoryNetwork, fmt.Errorf("URLの作成エラー: %w", err)))
+	}
+	body, err := json.Marshal(wire.EncapsulateBatchRequest{Count: batchSize})
+	if err != nil {
+		return atStage("batch", withCategory(categoryDecode, fmt.Errorf("JSONエンコードエラー: %w", err)))
+	}
+
+	start := time.Now()
+	resp, err := httpClient.Post(batchURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return atStage("batch", withCategory(categoryNetwork, fmt.Errorf("HTTP POSTエラー: %w", err)))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return atStage("batch", withCategory(categoryServer, fmt.Errorf("HTTPステータスエラー: %d", resp.StatusCode)))
+	}
+	var batch wire.EncapsulateBatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		return atStage("batch", withCategory(categoryDecode, fmt.Errorf("JSONデコードエラー: %w", err)))
+	}
+	if batch.Count <= 0 {
+		return atStage("batch", withCategory(categoryServer, fmt.Errorf("カプセル化の回数が不正です: %d", batch.Count)))
+	}
+	roundTrip := time.Since(start)
+
+	n := time.Duration(batch.Count)
+	serverTotal := time.Duration(batch.TotalNanos)
+	batchServerPerOp.WithLabelValues(AlgorithmMLKEM).Set(time.Duration(batch.PerOpNanos).Seconds())
+	batchAmortizedPerOp.WithLabelValues(AlgorithmMLKEM).Set((roundTrip / n).Seconds())
+	batchOverheadPerOp.WithLabelValues(AlgorithmMLKEM).Set((max(roundTrip-serverTotal, 0) / n).Seconds())
+	batchOpsPerSecond.WithLabelValues(AlgorithmMLKEM).Set(batch.OpsPerSecond)
+	fmt.Printf("  バッチ %d回のカプセル化: 1回あたり %v（HTTPを含む往復の按分 %v）\n", batch.Count, time.Duration(batch.PerOpNanos), roundTrip/n)
+	return nil
+}
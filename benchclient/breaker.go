@@ -0,0 +1,145 @@
+package benchclient
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// サーキットブレーカーの状態
+type breakerState int
+
+const (
+	breakerClosed   breakerState = iota // 通常状態（リクエストを通す）
+	breakerOpen                         // 遮断状態（リクエストを通さない）
+	breakerHalfOpen                     // 試行状態（1回だけリクエストを通して復旧を確認）
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+var (
+	breakerStateGauge = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_circuit_breaker_state",
+			Help: "Circuit breaker state per target (0=closed, 1=open, 2=half-open)",
+		},
+		[]string{"target"},
+	)
+	breakerTransitions = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_circuit_breaker_transitions_total",
+			Help: "Total number of circuit breaker state transitions, by target and new state",
+		},
+		[]string{"target", "state"},
+	)
+	breakerRejected = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_circuit_breaker_rejected_total",
+			Help: "Total number of operations skipped because the circuit breaker was open",
+		},
+		[]string{"target"},
+	)
+)
+
+// ブレーカーが開いているためスキップしたことを示すエラー
+var errBreakerOpen = errors.New("サーキットブレーカーが開いているためスキップしました")
+
+// サーバーごとのサーキットブレーカー
+// 連続でthreshold回失敗すると開き、cooldown経過後に半開状態で1回だけ試行する
+type circuitBreaker struct {
+	mu        sync.Mutex
+	target    string
+	threshold int
+	cooldown  time.Duration
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+}
+
+func newCircuitBreaker(target string, threshold int, cooldown time.Duration) *circuitBreaker {
+	b := &circuitBreaker{
+		target:    target,
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+	breakerStateGauge.WithLabelValues(target).Set(float64(breakerClosed))
+	return b
+}
+
+// リクエストを通してよいか判定する
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			breakerRejected.WithLabelValues(b.target).Inc()
+			return false
+		}
+		b.setState(breakerHalfOpen)
+		return true
+	case breakerHalfOpen:
+		// 半開状態では試行中のリクエストの結果が出るまで他を通さない
+		breakerRejected.WithLabelValues(b.target).Inc()
+		return false
+	default:
+		return true
+	}
+}
+
+// 成功を記録する
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	if b.state != breakerClosed {
+		b.setState(breakerClosed)
+	}
+}
+
+// 失敗を記録する
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= b.threshold) {
+		b.openedAt = time.Now()
+		b.setState(breakerOpen)
+	}
+}
+
+// 状態を変更してメトリクスに反映する（mu を保持した状態で呼ぶこと）
+func (b *circuitBreaker) setState(state breakerState) {
+	b.state = state
+	breakerStateGauge.WithLabelValues(b.target).Set(float64(state))
+	breakerTransitions.WithLabelValues(b.target, state.String()).Inc()
+	log.Printf("サーキットブレーカー [%s] が %s 状態になりました", b.target, state)
+}
+
+// ブレーカーを通して処理を実行する
+func (b *circuitBreaker) do(fn func() error) error {
+	if !b.allow() {
+		return errBreakerOpen
+	}
+	if err := fn(); err != nil {
+		b.failure()
+		return err
+	}
+	b.success()
+	return nil
+}
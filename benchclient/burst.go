@@ -0,0 +1,100 @@
+package benchclient
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	burstSessionDuration = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_burst_session_duration_seconds",
+			Help: "Percentiles of the session duration within the latest burst of back-to-back encryptions, by algorithm and quantile (1 is the maximum)",
+		},
+		[]string{"algorithm", "quantile"},
+	)
+	burstSessions = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_burst_sessions",
+			Help: "Number of successful sessions within the latest burst, by algorithm",
+		},
+		[]string{"algorithm"},
+	)
+	burstDuration = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_burst_duration_seconds",
+			Help: "Wall-clock duration of the latest burst of back-to-back encryptions in seconds",
+		},
+	)
+	burstSizeGauge = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_burst_size",
+			Help: "Number of encryptions performed back-to-back per tick (1 when burst mode is disabled)",
+		},
+	)
+)
+
+// バーストで記録するパーセンタイル
+var burstQuantiles = []float64{50, 90, 99, 100}
+
+// 1回のティックで続けて実行する暗号化の回数
+var burstSize = 1
+
+// 実行中のバーストで成功したセッションの所要時間
+var burst struct {
+	sync.Mutex
+	start   time.Time
+	samples map[string][]float64 // 鍵交換方式 → セッションの所要時間（秒）
+}
+
+func setBurstSize(n int) {
+	burstSize = max(n, 1)
+	burstSizeGauge.Set(float64(burstSize))
+}
+
+// ティックの間隔（バーストの回数だけ延ばして平均の実行頻度を変えず、適応的サンプリングの倍率だけ縮める）
+func tickInterval() time.Duration {
+	interval := liveInterval() * time.Duration(burstSize) / time.Duration(samplingFactorValue())
+	samplingRate.Set(float64(burstSize) / interval.Seconds())
+	return interval
+}
+
+func startBurst() {
+	burst.Lock()
+	defer burst.Unlock()
+	burst.start = time.Now()
+	burst.samples = make(map[string][]float64)
+}
+
+// 成功したセッションの所要時間をバーストと適応的サンプリングの標本に加える
+func observeSession(algorithm string, res *SessionResult) {
+	if res == nil {
+		return
+	}
+	observeAdaptive(algorithm, res.Timings.Total.Seconds())
+	if burstSize <= 1 {
+		return
+	}
+	burst.Lock()
+	defer burst.Unlock()
+	burst.samples[algorithm] = append(burst.samples[algorithm], res.Timings.Total.Seconds())
+}
+
+// バーストの中でのパーセンタイルを記録する
+func finishBurst() {
+	if burstSize <= 1 {
+		return
+	}
+	burst.Lock()
+	defer burst.Unlock()
+	burstDuration.Set(time.Since(burst.start).Seconds())
+	for algorithm, values := range burst.samples {
+		burstSessions.WithLabelValues(algorithm).Set(float64(len(values)))
+		for _, q := range burstQuantiles {
+			burstSessionDuration.WithLabelValues(algorithm, strconv.FormatFloat(q/100, 'g', -1, 64)).Set(percentile(values, q))
+		}
+	}
+}
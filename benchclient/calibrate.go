@@ -0,0 +1,104 @@
+package benchclient
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	calibrationRoundTrip = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_calibration_round_trip_seconds",
+			Help: "Duration of the latest HTTP+JSON round trips shaped like a session (GET then POST /calibrate) without any cryptography in seconds",
+		},
+		[]string{"algorithm", "transport"},
+	)
+	calibrationDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "client_calibration_duration_seconds",
+			Help:    "Histogram of the HTTP+JSON baseline round trips (GET then POST /calibrate) in seconds; subtract from client_session_duration_seconds to estimate crypto time",
+			Buckets: []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+		},
+		[]string{"algorithm", "transport"},
+	)
+	calibrationFailures = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_calibration_failures_total",
+			Help: "Total number of failed calibration round trips",
+		},
+		[]string{"algorithm", "transport"},
+	)
+)
+
+// セッションのたびに同じ形の暗号処理を行わない往復を計測するか
+var calibrationEnabled bool
+
+// セッションと同じサイズの公開鍵の取得と暗号化データの送信を /calibrate に対して行い、往復時間を基準値として記録する
+// 失敗しても鍵合意の結果には影響させない
+func (s *Session) calibrate(res *SessionResult, msg *SealedMessage) {
+	elapsed, err := s.calibrationRoundTrip(res, msg)
+	if err != nil {
+		calibrationFailures.WithLabelValues(s.Algorithm, s.Transport).Inc()
+		log.Printf("基準値の計測に失敗 [%s/%s]: %v", s.Algorithm, s.Transport, err)
+		return
+	}
+	calibrationRoundTrip.WithLabelValues(s.Algorithm, s.Transport).Set(elapsed.Seconds())
+	calibrationDuration.WithLabelValues(s.Algorithm, s.Transport).Observe(elapsed.Seconds())
+}
+
+func (s *Session) calibrationRoundTrip(res *SessionResult, msg *SealedMessage) (time.Duration, error) {
+	calibrateURL, err := endpointURL(s.KeyURL, "/calibrate")
+	if err != nil {
+		return 0, err
+	}
+	// 送るデータは暗号化の前に組み立て、計測に含めない
+	data, err := res.encryptedData(msg)
+	if err != nil {
+		return 0, err
+	}
+	body, err := json.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+	size := base64.StdEncoding.EncodedLen(len(res.PublicKeyBytes))
+
+	start := time.Now()
+	resp, err := s.Client.Get(calibrateURL + "?size=" + strconv.Itoa(size))
+	if err != nil {
+		return 0, fmt.Errorf("HTTP GETエラー: %w", err)
+	}
+	var getResp wire.CalibrateResponse
+	if err := decodeCalibrateResponse(resp, &getResp); err != nil {
+		return 0, err
+	}
+	resp, err = s.Client.Post(calibrateURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("HTTP POSTエラー: %w", err)
+	}
+	var postResp wire.CalibrateResponse
+	if err := decodeCalibrateResponse(resp, &postResp); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+// /calibrate のレスポンスをデコードする（セッションと同じくJSONのデコードまでを計測に含める）
+func decodeCalibrateResponse(resp *http.Response, v *wire.CalibrateResponse) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTPステータスエラー: %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("JSONデコードエラー: %w", err)
+	}
+	return nil
+}
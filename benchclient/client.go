@@ -0,0 +1,847 @@
+// Package benchclient はRSAとML-KEMで鍵を保護するハイブリッド暗号化を定期的に実行し、
+// 比較用のメトリクスを記録するクライアントを提供する
+package benchclient
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/keyi1000/PQC_grafana/datagram"
+	"github.com/keyi1000/PQC_grafana/entropy"
+	"github.com/keyi1000/PQC_grafana/features"
+	"github.com/keyi1000/PQC_grafana/fips"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/netem"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "aes-client"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は client_）
+var factory = metrics.NewFactory(ServiceName, "client_")
+
+var (
+	// Prometheusメトリクス
+	rsaEncryptedKeySize = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_rsa_encrypted_key_size_bytes",
+			Help: "Size of AES key encrypted with RSA in bytes",
+		},
+	)
+	mlkemEncryptedKeySize = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_mlkem_encrypted_key_size_bytes",
+			Help: "Size of AES key encrypted with ML-KEM in bytes",
+		},
+	)
+	rsaPublicKeySize = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_rsa_public_key_size_bytes",
+			Help: "Size of RSA public key in bytes",
+		},
+	)
+	mlkemPublicKeySize = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_mlkem_public_key_size_bytes",
+			Help: "Size of ML-KEM public key in bytes",
+		},
+	)
+	rsaEncryptionDuration = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_rsa_encryption_duration_seconds",
+			Help: "Duration of RSA encryption operation in seconds",
+		},
+	)
+	mlkemEncapsulationDuration = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_mlkem_encapsulation_duration_seconds",
+			Help: "Duration of ML-KEM encapsulation operation in seconds",
+		},
+	)
+	encryptionDurationRatio = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_encryption_duration_ratio",
+			Help: "Ratio of ML-KEM to RSA encryption duration (ML-KEM / RSA)",
+		},
+	)
+	encryptedKeySizeRatio = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_encrypted_key_size_ratio",
+			Help: "Ratio of ML-KEM to RSA encrypted key size (ML-KEM / RSA)",
+		},
+	)
+	publicKeySizeRatio = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_public_key_size_ratio",
+			Help: "Ratio of ML-KEM to RSA public key size (ML-KEM / RSA)",
+		},
+	)
+	rsaEncryptionDurationAvg = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_rsa_encryption_duration_avg_seconds",
+			Help: "Average duration of RSA encryption operations in seconds",
+		},
+	)
+	mlkemEncapsulationDurationAvg = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_mlkem_encapsulation_duration_avg_seconds",
+			Help: "Average duration of ML-KEM encapsulation operations in seconds",
+		},
+	)
+	encryptionCounter = factory.NewCounter(
+		prometheus.CounterOpts{
+			Name: "client_encryption_operations_total",
+			Help: "Total number of encryption operations",
+		},
+	)
+)
+
+// 平均計算用の累積値
+var (
+	rsaTotalDuration    float64
+	mlkemTotalDuration  float64
+	rsaOperationCount   int
+	mlkemOperationCount int
+)
+
+// サーバーごとのサーキットブレーカー
+var (
+	rsaBreaker   *circuitBreaker
+	mlkemBreaker *circuitBreaker
+)
+
+// サーバーごとの鍵合意セッション
+var (
+	rsaSession   *Session
+	mlkemSession *Session
+)
+
+// 公開鍵のレスポンス構造体
+type PublicKeyResponse = wire.PublicKeyResponse
+
+// クライアントの設定
+type Config struct {
+	RSAURL             string          // RSA公開鍵を取得するURL
+	MLKEMURL           string          // ML-KEM公開鍵を取得するURL
+	DualURL            string          // 二重保護サーバーの公開鍵を取得するURL（空の場合は計測しない）
+	ECDHURL            string          // ECDHサーバーの公開鍵を取得するURL（空の場合は計測しない）
+	Interval           time.Duration   // 暗号化を実行する間隔
+	StartupDelay       time.Duration   // サーバーの起動を待つ時間
+	NewConnPerRequest  bool            // 公開鍵の取得ごとに新しい接続を張る
+	BreakerThreshold   int             // サーキットブレーカーを開くまでの連続失敗回数
+	BreakerCooldown    time.Duration   // サーキットブレーカーが半開状態になるまでの時間
+	RekeyEvery         int             // 0より大きい場合、長期間のセッションでこのメッセージ数ごとに鍵を更新する模擬を行う
+	OperationMix       OperationMix    // 1回の間隔で実行する暗号化のみ・往復・署名の操作の回数（空の場合は毎回往復を1回、RekeyEveryとは同時に使わない）
+	CMSOutput          bool            // 暗号化データをCMSのEnvelopedDataとしても作成し、サイズを記録する
+	KEMsURL            string          // 登録されたすべてのKEMで鍵交換を行うサーバーの/kemsのURL（空の場合は実行しない）
+	InteropTargets     []InteropTarget // 相互運用性を確認する外部のKEMエンドポイント
+	FIPS               bool            // FIPS承認済みの方式だけを使う（ハイブリッド暗号化の経路はスキップする）
+	ConfigFile         string          // 起動時とSIGHUPで読み込む実行中に変更できる設定（LiveConfigのJSON、空の場合は読み込まない）
+	AdminToken         string          // POST /config に必要なBearerトークン（空の場合は変更を受け付けない）
+	ServerToken        string          // サーバーのロールによる認可に送るBearerトークン（operatorのロール、空の場合は送らない）
+	BatchSize          int             // 0より大きい場合、毎回ML-KEMサーバーにこの回数のカプセル化を実行させ、1回あたりの時間を記録する
+	Corpora            []Corpus        // 暗号化するメッセージのコーパス（空の場合は既定の日本語の文）
+	KeyNonce           bool            // 公開鍵をPOSTでnonceを付けて取得し、レスポンスとの結び付きを確認する（二重保護サーバーは対象外）
+	ConditionalFetch   bool            // 公開鍵をIf-None-Matchを付けて取得し、304であれば前回のレスポンスを使う（KeyNonceと同時には使わない）
+	KeyCacheTTL        time.Duration   // staticモードの公開鍵をキャッシュして使い回す時間（サーバーのmax-ageが短ければそれに従う、0の場合はキャッシュしない）
+	FetchKeyPerSession bool            // キャッシュと鍵の一覧を使わず、セッションごとに公開鍵を取得する（以前の動作）
+	KeySet             bool            // RSA・ML-KEMの公開鍵をGET /keys の一覧でまとめて取得・キャッシュし、順に使う（KeyNonceと、KeySignatureを使うML-KEMは対象外）
+	LegacyEnvelope     bool            // 暗号化データの形式の版を交渉せず、versionのない暗号化データを送る（古いクライアントの模擬）
+	KeySignature       bool            // ML-KEM公開鍵のレスポンスのML-DSA署名をカプセル化の前に検証する
+	MLKEMSigningKey    string          // 署名の検証に使うML-KEMサーバーの署名鍵（Base64、空の場合は最初に/signing-keyから取得した鍵を信頼する）
+	Calibrate          bool            // セッションごとに暗号処理を行わない同じ形の往復（/calibrate）も計測し、基準値として記録する
+	Netem              netem.Config    // 公開鍵の取得などの接続に加える人工的な遅延とパケットロス（ゼロ値の場合は加えない）
+	RSADatagramAddr    string          // RSAサーバーのデータグラムのUDPアドレス（空の場合はデータグラムで計測しない）
+	MLKEMDatagramAddr  string          // ML-KEMサーバーのデータグラムのUDPアドレス（空の場合はデータグラムで計測しない）
+	Datagram           datagram.Config // データグラムの分割と再送の設定
+
+	// URLのホストからUnixドメインソケットのパスへの対応（例: rsa-server → /run/pqc/rsa.sock）
+	// 対応のあるホストへの接続はTCPの代わりにソケットを使う
+	UnixSockets map[string]string
+
+	// 設定するとセッションの結果をResultsIntervalごとにまとめ、集約サーバー（result-collector）に
+	// ML-KEMのハイブリッド暗号化で保護して送る（ResultsURLは集約サーバーの公開鍵のURL）
+	ResultsURL      string
+	ResultsInterval time.Duration
+
+	// 暗号化ごとに順に使うAES鍵のサイズ（ビット、128・192・256、空の場合は256のみ）
+	// NISTのレベル1のハイブリッド方式（ML-KEM-512 + AES-128など）と共通鍵の強度も揃えて比較する
+	AESKeySizes []int
+
+	// メッセージの暗号化方式（aes-cbc-hmac・aes-gcm・aes-gcm-siv・chacha20-poly1305、空の場合はaes-cbc-hmac）
+	// AES-NIのない環境ではChaCha20-Poly1305の方が速いことが多く、共通鍵暗号の性能も比較の軸にする
+	DataCipher string
+
+	// AEADのノンスの生成方式（random・counter、空の場合はrandom）
+	// AES-CBCのIVは予測できない必要があるため、どちらの場合も乱数を使う
+	NonceMode string
+
+	// AES鍵のラップ方式（aes-gcm・aes-kw、空の場合はRSAはRSA-OAEPで直接暗号化、ML-KEMとECDHはaes-gcm）
+	// aes-kwではRSAは使い捨てのKEKをRSA-OAEPで、KEMとECDHは共有秘密鍵から導出したKEKでAES鍵をAESキーラップ（RFC 3394）する
+	KeyWrap string
+
+	// 比率の指数移動平均（client_ratio_ewma）の平滑化係数（0より大きく1以下、大きいほど直近の計測を重視する、0の場合は0.1）
+	RatioEWMAAlpha float64
+
+	// 設定すると同じホストのサーバーにUnixドメインソケットでも鍵合意し、transport="unix" として記録する
+	RSAUnixSocket   string
+	MLKEMUnixSocket string
+
+	// 0より大きい場合、Intervalの代わりにPrometheusのスクレイプ間隔をOpsPerScrapeで割った間隔で暗号化する
+	// OpsPerScrapeを1にするとゲージの値がスクレイプの間に上書きされない
+	ScrapeInterval time.Duration
+	OpsPerScrape   int
+
+	// 1より大きい場合、1回のティックでこの回数の暗号化を続けて実行し、バーストの中でのパーセンタイルを記録する
+	// ティックの間隔はこの回数だけ延ばし、平均の実行頻度は変えない
+	Burst int
+
+	// 1回の実行が間隔を超えた場合に、溜まったティックを1回にまとめず（time.Tickerの動作）、
+	// 遅れた分を続けて実行して平均の実行頻度を保つ
+	FixedRate bool
+
+	// 0より大きい場合、直近のセッションの所要時間の変動係数がこの値を超えている間は
+	// 実行頻度を最大AdaptiveMaxFactor倍まで上げ、落ち着いたら元に戻す
+	AdaptiveCV        float64
+	AdaptiveMaxFactor int
+
+	// 設定するとネットワークを介さずにサーバーのハンドラーを直接呼び出す計測も行い、
+	// transport="inmemory" として記録する
+	RSALoopback   http.Handler
+	MLKEMLoopback http.Handler
+}
+
+// docker-compose環境向けのデフォルト設定
+func DefaultConfig() Config {
+	return Config{
+		RSAURL:            "http://rsa-server:8080/public-key",
+		MLKEMURL:          "http://ml-kem-server:8081/public-key",
+		Interval:          1000 * time.Millisecond,
+		Datagram:          datagram.DefaultConfig(),
+		StartupDelay:      3 * time.Second,
+		BreakerThreshold:  5,
+		BreakerCooldown:   10 * time.Second,
+		AdaptiveMaxFactor: 8,
+		ResultsInterval:   30 * time.Second,
+		RatioEWMAAlpha:    defaultRatioEWMAAlpha,
+		KeyCacheTTL:       DefaultKeyCacheTTL,
+	}
+}
+
+// 公開鍵を取得するURL
+var (
+	rsaURL   string
+	mlkemURL string
+)
+
+// RunContextを実行中かどうか
+var running atomic.Bool
+
+// ハイブリッド暗号化を一定間隔で実行し続ける
+func Run(cfg Config) {
+	if err := RunContext(context.Background(), cfg); err != nil {
+		log.Fatal("設定エラー:", err)
+	}
+}
+
+// ハイブリッド暗号化をctxがキャンセルされるまで一定間隔で実行する
+// 設定が不正な場合はエラーを、キャンセルされた場合はctx.Err()を返す
+// 計測の状態とメトリクスはパッケージで共有するため、同時に実行できるのは1つだけ
+func RunContext(ctx context.Context, cfg Config) error {
+	if !running.CompareAndSwap(false, true) {
+		return errors.New("計測は既に実行中です")
+	}
+	defer running.Store(false)
+	rsaURL = cfg.RSAURL
+	mlkemURL = cfg.MLKEMURL
+	cfg.Interval = dutyCycleInterval(cfg.Interval, cfg.ScrapeInterval, cfg.OpsPerScrape)
+	startDutyCycleTracking()
+	initLive(cfg)
+	if cfg.FIPS {
+		fips.Enable()
+	}
+	if err := cfg.Netem.Validate(); err != nil {
+		return err
+	}
+	serverToken = cfg.ServerToken
+	configureHTTPClient(cfg.NewConnPerRequest, netem.New(cfg.Netem), cfg.UnixSockets)
+	cmsOutput = cfg.CMSOutput
+	calibrationEnabled = cfg.Calibrate
+	keyNonceEnabled = cfg.KeyNonce
+	conditionalKeyFetchEnabled = cfg.ConditionalFetch
+	keySetEnabled = cfg.KeySet
+	keyCacheTTL = max(cfg.KeyCacheTTL, 0)
+	if cfg.FetchKeyPerSession {
+		keySetEnabled, keyCacheTTL = false, 0
+	}
+	legacyEnvelopeEnabled = cfg.LegacyEnvelope
+	keySignatureEnabled = cfg.KeySignature
+	if cfg.MLKEMSigningKey != "" {
+		if err := pinSigningKey(cfg.MLKEMSigningKey); err != nil {
+			return err
+		}
+	}
+	kemsURL = cfg.KEMsURL
+	if kemsURL != "" && !featureEnabled(features.KEMEndpoints) {
+		kemsURL = ""
+	}
+	batchSize = min(max(cfg.BatchSize, 0), wire.MaxBatchCount)
+	if batchSize > 0 && !featureEnabled(features.BatchEndpoint) {
+		batchSize = 0
+	}
+	interopTargets = cfg.InteropTargets
+	setBurstSize(cfg.Burst)
+	initAdaptive(cfg.AdaptiveCV, cfg.AdaptiveMaxFactor)
+	rsaBreaker = newCircuitBreaker("rsa", cfg.BreakerThreshold, cfg.BreakerCooldown)
+	mlkemBreaker = newCircuitBreaker("mlkem", cfg.BreakerThreshold, cfg.BreakerCooldown)
+	if cfg.DualURL != "" && featureEnabled(features.Dual) {
+		dualBreaker = newCircuitBreaker(AlgorithmDual, cfg.BreakerThreshold, cfg.BreakerCooldown)
+		dualSession = &Session{Algorithm: AlgorithmDual, Transport: transportNetwork, Client: httpClient, KeyURL: cfg.DualURL}
+	}
+	if cfg.ECDHURL != "" && featureEnabled(features.ECDH) {
+		ecdhBreaker = newCircuitBreaker(AlgorithmECDH, cfg.BreakerThreshold, cfg.BreakerCooldown)
+		ecdhSession = &Session{Algorithm: AlgorithmECDH, Transport: transportNetwork, Client: httpClient, KeyURL: cfg.ECDHURL}
+	}
+	rsaSession = &Session{Algorithm: AlgorithmRSA, Transport: transportNetwork, Client: httpClient, KeyURL: rsaURL}
+	mlkemSession = &Session{Algorithm: AlgorithmMLKEM, Transport: transportNetwork, Client: httpClient, KeyURL: mlkemURL}
+	if (cfg.RSALoopback != nil || cfg.MLKEMLoopback != nil) && !featureEnabled(features.Loopback) {
+		cfg.RSALoopback, cfg.MLKEMLoopback = nil, nil
+	}
+	if cfg.RSALoopback != nil {
+		rsaLoopbackSession = newInMemorySession(AlgorithmRSA, cfg.RSALoopback, rsaURL)
+	}
+	if cfg.MLKEMLoopback != nil {
+		mlkemLoopbackSession = newInMemorySession(AlgorithmMLKEM, cfg.MLKEMLoopback, mlkemURL)
+	}
+	if err := setAESKeySizes(cfg.AESKeySizes); err != nil {
+		return err
+	}
+	if err := setDataCipher(cfg.DataCipher); err != nil {
+		return err
+	}
+	if err := setKeyWrap(cfg.KeyWrap); err != nil {
+		return err
+	}
+	if cfg.NonceMode != "" {
+		if err := cryptoutil.SetNonceMode(cfg.NonceMode); err != nil {
+			return err
+		}
+	}
+	if cfg.RatioEWMAAlpha == 0 {
+		cfg.RatioEWMAAlpha = defaultRatioEWMAAlpha
+	}
+	if cfg.RatioEWMAAlpha < 0 || cfg.RatioEWMAAlpha > 1 {
+		return fmt.Errorf("比率の指数移動平均の平滑化係数は0より大きく1以下を指定してください: %v", cfg.RatioEWMAAlpha)
+	}
+	setRatioEWMAAlpha(cfg.RatioEWMAAlpha)
+	if cfg.ResultsURL != "" && cfg.ResultsInterval <= 0 {
+		return fmt.Errorf("計測結果を送る間隔は正の値を指定してください: %v", cfg.ResultsInterval)
+	}
+	if cfg.RSAUnixSocket != "" {
+		rsaUnixSession = newUnixSession(AlgorithmRSA, cfg.RSAUnixSocket, rsaURL)
+	}
+	if cfg.MLKEMUnixSocket != "" {
+		mlkemUnixSession = newUnixSession(AlgorithmMLKEM, cfg.MLKEMUnixSocket, mlkemURL)
+	}
+	if cfg.RSADatagramAddr != "" || cfg.MLKEMDatagramAddr != "" {
+		if !featureEnabled(features.Datagram) {
+			cfg.RSADatagramAddr, cfg.MLKEMDatagramAddr = "", ""
+		} else if err := cfg.Datagram.Validate(); err != nil {
+			return err
+		}
+	}
+	if cfg.RSADatagramAddr != "" {
+		rsaDatagramSession = newDatagramSession(AlgorithmRSA, cfg.RSADatagramAddr, cfg.Datagram)
+	}
+	if cfg.MLKEMDatagramAddr != "" {
+		mlkemDatagramSession = newDatagramSession(AlgorithmMLKEM, cfg.MLKEMDatagramAddr, cfg.Datagram)
+	}
+	if len(cfg.OperationMix) > 0 && cfg.RekeyEvery > 0 {
+		return errors.New("操作の混合と鍵更新の模擬は同時に指定できません")
+	}
+	setOperationMix(cfg.OperationMix)
+	rekeyInterval.Set(float64(cfg.RekeyEvery))
+	if cfg.RekeyEvery > 0 {
+		rsaChannel = newRekeyingChannel(rsaSession, rsaBreaker, cfg.RekeyEvery)
+		mlkemChannel = newRekeyingChannel(mlkemSession, mlkemBreaker, cfg.RekeyEvery)
+	}
+
+	// サーバーが起動するまで待機
+	fmt.Println("RSAサーバーの起動を待機中...")
+	select {
+	case <-time.After(cfg.StartupDelay):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	fmt.Printf("\n=== ハイブリッド暗号化を%v毎に実行します ===\n", cfg.Interval)
+	if cfg.RekeyEvery > 0 {
+		fmt.Printf("=== 鍵更新シミュレーション: %dメッセージごとに鍵を更新します ===\n", cfg.RekeyEvery)
+	}
+	if fips.Enabled() {
+		fmt.Println("=== FIPSモード: 承認された方式（ML-KEM-768/1024、RSA 3072ビット以上、AES-256-GCM）だけを使います ===")
+	}
+
+	if cfg.ConfigFile != "" {
+		if c, err := readLiveConfig(cfg.ConfigFile); err != nil {
+			log.Printf("設定ファイルの読み込みに失敗: %v", err)
+		} else if err := c.validate(); err != nil {
+			log.Printf("設定ファイルの読み込みに失敗: %v", err)
+		} else {
+			applyLive(c, cfg)
+		}
+		go watchSIGHUP(ctx, cfg.ConfigFile)
+	}
+
+	if resultsURL = cfg.ResultsURL; resultsURL != "" {
+		go runResultUpload(ctx, cfg.ResultsInterval)
+	}
+
+	counter := 0
+	schedule := newLoopScheduler(tickInterval(), cfg.FixedRate)
+	defer schedule.Stop()
+
+	// 暗号化するメッセージ
+	messages := corpusMessagesOf(cfg.Corpora)
+
+	for {
+		scheduled := false
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-schedule.C():
+			if isPaused() {
+				schedule.finish(time.Now(), time.Now(), false)
+				continue
+			}
+			scheduled = true
+		case <-live.runOnce:
+			// 一時停止中でも実行する（実行予定には数えない）
+		case c := <-live.updates:
+			// 設定の変更は暗号化の合間に適用する
+			if applyLive(c, cfg) {
+				schedule.Reset(tickInterval())
+			}
+			continue
+		}
+		started := time.Now()
+		if scheduled {
+			schedule.start(started)
+		}
+
+		// バーストモードでは1回のティックでburstSize回続けて暗号化する
+		startBurst()
+		for range burstSize {
+			counter++
+			message := liveMessage(messages[counter%len(messages)])
+
+			run := runHybridEncryption
+			if cfg.RekeyEvery > 0 {
+				run = runRekeySimulation
+			}
+			if len(operationMix) > 0 {
+				run = runOperationMix
+			}
+			if fips.Enabled() {
+				run = skipNonCompliant
+			}
+			runErr := run(counter, message)
+			recordCorpusMessage(message, runErr)
+			countDutyCycleOperation()
+			err := errors.Join(runErr, runBatch(), runKEMExchanges(), runInteropChecks())
+			if err != nil {
+				for _, e := range splitErrors(err) {
+					if errors.Is(e, errBreakerOpen) {
+						log.Printf("暗号化 #%d: %v", counter, e)
+						continue
+					}
+					recordError(e)
+					log.Printf("暗号化 #%d に失敗 [%s]: %v", counter, errorCategory(e), e)
+				}
+			}
+		}
+		finishBurst()
+		if scheduled {
+			schedule.finish(started, time.Now(), true)
+		}
+		if adaptSampling() {
+			schedule.Reset(tickInterval())
+		}
+	}
+}
+
+// ハイブリッド暗号化を1回実行する
+// RSAとML-KEMの経路はそれぞれのサーキットブレーカーを通して独立に実行し、
+// 片方のサーバーが落ちていてももう片方の計測は継続する
+// 失敗した場合は段階と分類が付与されたエラーを（複数あればまとめて）返す
+func runHybridEncryption(counter int, message Message) error {
+	fmt.Printf("\n========== 暗号化 #%d ==========\n", counter)
+	startTime := time.Now()
+	encryptionCounter.Inc()
+
+	// Step 1: データ鍵を生成（既定は256ビット = 32バイト、-aes-key-sizesを指定した場合は順に切り替える）
+	aesKey, err := newDataKey(counter)
+	if err != nil {
+		return atStage("aes_keygen", withCategory(categoryCrypto, fmt.Errorf("AES鍵の生成に失敗: %w", err)))
+	}
+	keygenDuration := time.Since(startTime)
+	// 使い終わったAES鍵はメモリから消去する
+	defer zeroize("aes_key", aesKey)
+	fmt.Printf("[%s] ✓ %dビットのデータ鍵を生成\n", time.Since(startTime), len(aesKey)*8)
+
+	// Step 2: メッセージを暗号化し、認証する（既定はAES-CBC + HMACのEncrypt-then-MAC、-data-cipherで切り替える）
+	msg, err := sealMessage([]byte(message.Text), aesKey)
+	if err != nil {
+		return atStage("aes_encrypt", withCategory(categoryCrypto, fmt.Errorf("メッセージの暗号化に失敗: %w", err)))
+	}
+	msg.AESKeygen = keygenDuration
+	observeCorpusEncrypt(message, msg.AESEncrypt)
+	observeAESEncrypt(msg)
+	fmt.Printf("[%s] ✓ メッセージを%sで暗号化 (%dバイト)\n", time.Since(startTime), msg.algorithm(), len(msg.Ciphertext))
+
+	// Step 3: RSAで鍵合意（公開鍵の取得からサーバーでの復号の確認まで）
+	// 実行しない経路の結果はnilのままにする
+	var rsaResult, mlkemResult *SessionResult
+	var rsaErr, mlkemErr error
+	if algorithmEnabled(AlgorithmRSA) {
+		rsaErr = rsaBreaker.do(func() error {
+			var err error
+			rsaResult, err = rsaSession.Run(aesKey, msg)
+			return err
+		})
+	}
+	if rsaResult != nil {
+		recordRSAResult(startTime, rsaResult)
+		observeSession(AlgorithmRSA, rsaResult)
+		observeSessionKeySize(AlgorithmRSA, msg, rsaResult)
+	}
+
+	// Step 4: ML-KEMで鍵合意（公開鍵の取得からサーバーでの復号の確認まで）
+	if algorithmEnabled(AlgorithmMLKEM) {
+		mlkemErr = mlkemBreaker.do(func() error {
+			var err error
+			mlkemResult, err = mlkemSession.Run(aesKey, msg)
+			return err
+		})
+	}
+	if mlkemResult != nil {
+		recordMLKEMResult(startTime, mlkemResult)
+		observeSession(AlgorithmMLKEM, mlkemResult)
+		observeSessionKeySize(AlgorithmMLKEM, msg, mlkemResult)
+	}
+
+	// Step 5: RSAとML-KEMの二重保護（設定されている場合のみ）
+	var dualErr error
+	if dualSession != nil && algorithmEnabled(AlgorithmDual) {
+		var dualResult *SessionResult
+		dualErr = dualBreaker.do(func() error {
+			var err error
+			dualResult, err = dualSession.Run(aesKey, msg)
+			return err
+		})
+		if dualErr == nil {
+			recordDualOverhead(dualResult, map[string]*SessionResult{AlgorithmRSA: rsaResult, AlgorithmMLKEM: mlkemResult})
+			observeSession(AlgorithmDual, dualResult)
+			observeSessionKeySize(AlgorithmDual, msg, dualResult)
+		}
+	}
+
+	// Step 6: ECDH（P-256）で鍵合意（設定されている場合のみ）
+	// PQCと従来の楕円曲線暗号を比較する基準として使う
+	var ecdhErr error
+	if ecdhSession != nil && algorithmEnabled(AlgorithmECDH) {
+		var ecdhResult *SessionResult
+		ecdhErr = ecdhBreaker.do(func() error {
+			var err error
+			ecdhResult, err = ecdhSession.Run(aesKey, msg)
+			return err
+		})
+		if ecdhErr == nil {
+			recordECDHResult(startTime, ecdhResult)
+			observeSession(AlgorithmECDH, ecdhResult)
+			observeSessionKeySize(AlgorithmECDH, msg, ecdhResult)
+			if mlkemResult != nil {
+				recordMLKEMVsECDH(mlkemResult, ecdhResult)
+			}
+		}
+	}
+
+	// ネットワークを介さない計測、Unixドメインソケット、CMS形式とデータグラムでの計測（設定されている場合のみ）
+	if rsaResult != nil {
+		measureInMemory(rsaLoopbackSession, aesKey, msg, rsaResult.Timings.Exchange())
+		measureUnix(rsaUnixSession, aesKey, msg, rsaResult.Timings.Exchange())
+		measureCMS(rsaResult, AlgorithmRSA, aesKey, msg)
+	}
+	if mlkemResult != nil {
+		measureInMemory(mlkemLoopbackSession, aesKey, msg, mlkemResult.Timings.Exchange())
+		measureUnix(mlkemUnixSession, aesKey, msg, mlkemResult.Timings.Exchange())
+		measureCMS(mlkemResult, AlgorithmMLKEM, aesKey, msg)
+	}
+	measureDatagram(rsaDatagramSession, aesKey, msg)
+	measureDatagram(mlkemDatagramSession, aesKey, msg)
+
+	// 比較値は両方の経路が成功した場合のみ記録
+	if rsaResult != nil && mlkemResult != nil {
+		if rsaResult.Timings.Wrap.Seconds() > 0 {
+			durationRatio := mlkemResult.Timings.Wrap.Seconds() / rsaResult.Timings.Wrap.Seconds()
+			encryptionDurationRatio.Set(durationRatio)
+			observeRatio(comparisonMLKEMVsRSA, "duration", durationRatio)
+		}
+		if len(rsaResult.EncapsulatedKey()) > 0 {
+			keySizeRatio := float64(len(mlkemResult.EncapsulatedKey())) / float64(len(rsaResult.EncapsulatedKey()))
+			encryptedKeySizeRatio.Set(keySizeRatio)
+			observeRatio(comparisonMLKEMVsRSA, "encrypted_key_size", keySizeRatio)
+		}
+		if len(rsaResult.PublicKeyBytes) > 0 {
+			pubKeySizeRatio := float64(len(mlkemResult.PublicKeyBytes)) / float64(len(rsaResult.PublicKeyBytes))
+			publicKeySizeRatio.Set(pubKeySizeRatio)
+			observeRatio(comparisonMLKEMVsRSA, "public_key_size", pubKeySizeRatio)
+		}
+	}
+
+	// 結果のサマリー
+	totalTime := time.Since(startTime)
+	fmt.Printf("[%s] ✅ ハイブリッド暗号化完了\n", totalTime)
+	fmt.Printf("メッセージ（%s、%dバイト）: %.30q\n", message.Corpus, len(message.Text), message.Text)
+	if rsaResult != nil {
+		fmt.Printf("📊 RSA公開鍵: %d バイト\n", len(rsaResult.PublicKeyBytes))
+	}
+	if mlkemResult != nil {
+		fmt.Printf("📊 ML-KEM公開鍵: %d バイト\n", len(mlkemResult.PublicKeyBytes))
+	}
+	if rsaResult != nil {
+		fmt.Printf("📊 RSA暗号化AES鍵: %d バイト\n", len(rsaResult.EncapsulatedKey()))
+	}
+	if mlkemResult != nil {
+		fmt.Printf("📊 ML-KEM暗号化AES鍵: %d バイト\n", len(mlkemResult.EncapsulatedKey()))
+	}
+	fmt.Printf("📊 暗号文: %d バイト, IV: %d バイト, MAC: %d バイト\n", len(msg.Ciphertext), len(msg.IV), len(msg.MAC))
+
+	return errors.Join(rsaErr, mlkemErr, dualErr, ecdhErr)
+}
+
+// RSAのセッション結果をメトリクスに記録する
+func recordRSAResult(startTime time.Time, res *SessionResult) {
+	if !res.Timings.KeyCached {
+		keyFetchDuration.WithLabelValues("rsa").Set(res.Timings.Fetch.Seconds())
+	}
+	rsaPublicKeySize.Set(float64(len(res.PublicKeyBytes)))
+	rsaEncryptedKeySize.Set(float64(len(res.EncapsulatedKey())))
+	rsaEncryptionDuration.Set(res.Timings.Wrap.Seconds())
+	keyExchangeDuration.WithLabelValues("rsa", transportNetwork).Set(res.Timings.Exchange().Seconds())
+
+	// 累積平均を計算
+	rsaOperationCount++
+	rsaTotalDuration += res.Timings.Wrap.Seconds()
+	rsaEncryptionDurationAvg.Set(rsaTotalDuration / float64(rsaOperationCount))
+
+	fmt.Printf("[%s] ✓ RSAで鍵合意 (公開鍵 %dバイト, 暗号化AES鍵 %dバイト)\n", time.Since(startTime), len(res.PublicKeyBytes), len(res.WrappedKey))
+	printTimings(res.Timings)
+}
+
+// ML-KEMのセッション結果をメトリクスに記録する
+func recordMLKEMResult(startTime time.Time, res *SessionResult) {
+	if !res.Timings.KeyCached {
+		keyFetchDuration.WithLabelValues("mlkem").Set(res.Timings.Fetch.Seconds())
+	}
+	mlkemPublicKeySize.Set(float64(len(res.PublicKeyBytes)))
+	mlkemEncryptedKeySize.Set(float64(len(res.EncapsulatedKey())))
+	mlkemEncapsulationDuration.Set(res.Timings.Wrap.Seconds())
+	keyExchangeDuration.WithLabelValues("mlkem", transportNetwork).Set(res.Timings.Exchange().Seconds())
+
+	// 累積平均を計算
+	mlkemOperationCount++
+	mlkemTotalDuration += res.Timings.Wrap.Seconds()
+	mlkemEncapsulationDurationAvg.Set(mlkemTotalDuration / float64(mlkemOperationCount))
+
+	fmt.Printf("[%s] ✓ ML-KEMで鍵合意 (公開鍵 %dバイト, カプセル化テキスト %dバイト)\n", time.Since(startTime), len(res.PublicKeyBytes), len(res.KEMCiphertext))
+	printTimings(res.Timings)
+}
+
+// セッションの各フェーズの所要時間を表示する
+func printTimings(t SessionTimings) {
+	fmt.Printf("    取得 %v / 暗号化 %v / 送信 %v / サーバー処理 %v / 確認 %v (合計 %v)\n",
+		t.Fetch, t.Wrap, t.Send, t.ServerDerive, t.Confirm, t.Total)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// 公開鍵の取得の結果（レスポンス以外）
+type keyFetch struct {
+	version int  // 交渉した暗号化データの形式の版
+	cached  bool // サーバーに問い合わせずにキャッシュした公開鍵を使った（取得の時間にネットワークを含まない）
+}
+
+// 公開鍵を取得する（公開鍵のデコードは呼び出し側で行う）
+// 鍵の一覧を使う設定の場合はGET /keys でまとめて取得した公開鍵を順に返し、
+// キャッシュの有効期間内であればサーバーに問い合わせずにキャッシュした公開鍵を返す
+func fetchPublicKey(client *http.Client, target, url string) (*PublicKeyResponse, keyFetch, error) {
+	if keySetUsable(target) {
+		if key, fetched, ok := keyFromSet(client, target, url); ok {
+			return key, fetched, nil
+		}
+	}
+	if keyCacheUsable() {
+		if key, version, ok := cachedPublicKey(client, target, url); ok {
+			return key, keyFetch{version: version, cached: true}, nil
+		}
+	}
+	key, version, err := downloadPublicKey(client, target, url)
+	return key, keyFetch{version: version}, err
+}
+
+// サーバーから公開鍵を取得する
+// nonceを使う設定の場合はPOSTでnonceを送り、レスポンスがそのnonceに結び付いていることを確認する
+// 条件付きの取得を使う設定の場合は前回のETagを送り、304であれば前回のレスポンスを返す
+func downloadPublicKey(client *http.Client, target, url string) (*PublicKeyResponse, int, error) {
+	start := time.Now()
+	var nonce, body []byte
+	var header http.Header
+	method := http.MethodGet
+	if keyNonceEnabled {
+		var err error
+		if nonce, body, err = newKeyNonce(); err != nil {
+			return nil, 0, withCategory(categoryCrypto, fmt.Errorf("nonceの生成エラー: %w", err))
+		}
+		method = http.MethodPost
+	}
+	conditional := conditionalKeyFetchEnabled && nonce == nil
+	if conditional {
+		header = conditionalKeyHeader(url)
+	}
+	resp, timing, err := tracedRequest(client, target, method, url, body, withAcceptVersion(header))
+	if err != nil {
+		return nil, 0, withCategory(categoryNetwork, fmt.Errorf("HTTP %sエラー: %w", method, err))
+	}
+	defer resp.Body.Close()
+	version := negotiatedEnvelopeVersion(target, resp)
+
+	if resp.StatusCode == http.StatusNotModified && header != nil {
+		if cached, ok := cachedKeyResponseFor(url); ok {
+			publicKeyCacheTotal.WithLabelValues(target, "not_modified").Inc()
+			publicKeyFetchDuration.WithLabelValues(target, "not_modified").Observe(time.Since(start).Seconds())
+			storeCachedPublicKey(url, resp, cached, version)
+			return cached, version, nil
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, withCategory(categoryServer, fmt.Errorf("HTTPステータスエラー: %d", resp.StatusCode))
+	}
+
+	var pubKeyResp PublicKeyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&pubKeyResp); err != nil {
+		return nil, 0, withCategory(categoryDecode, fmt.Errorf("JSONデコードエラー: %w", err))
+	}
+	// キャッシュから返されたレスポンスのserver_timingは最初にオリジンが返したときのもの
+	if age, cached := responseAge(resp); cached {
+		publicKeyCacheAge.WithLabelValues(target).Set(age.Seconds())
+	} else {
+		publicKeyCacheAge.WithLabelValues(target).Set(0)
+		recordServerTiming(target, timing, pubKeyResp.ServerTiming)
+	}
+	if nonce != nil {
+		if err := verifyKeyBinding(target, nonce, &pubKeyResp); err != nil {
+			return nil, 0, err
+		}
+	}
+	if conditional {
+		storeKeyResponse(url, resp.Header.Get("ETag"), &pubKeyResp)
+		publicKeyCacheTotal.WithLabelValues(target, "downloaded").Inc()
+		publicKeyFetchDuration.WithLabelValues(target, "downloaded").Observe(time.Since(start).Seconds())
+	}
+	storeCachedPublicKey(url, resp, &pubKeyResp, version)
+	return &pubKeyResp, version, nil
+}
+
+// Base64エンコードされたRSA公開鍵をパース
+func parseRSAPublicKey(encoded string) (*rsa.PublicKey, []byte, error) {
+	// Base64デコード
+	pubKeyBytes, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, withCategory(categoryDecode, fmt.Errorf("Base64デコードエラー: %w", err))
+	}
+
+	// 公開鍵をパース
+	pubKeyInterface, err := x509.ParsePKIXPublicKey(pubKeyBytes)
+	if err != nil {
+		return nil, nil, withCategory(categoryDecode, fmt.Errorf("公開鍵のパースエラー: %w", err))
+	}
+
+	publicKey, ok := pubKeyInterface.(*rsa.PublicKey)
+	if !ok {
+		return nil, nil, withCategory(categoryDecode, fmt.Errorf("RSA公開鍵への変換エラー"))
+	}
+
+	return publicKey, pubKeyBytes, nil
+}
+
+// Base64エンコードされたML-KEM公開鍵をデシリアライズ
+func parseMLKEMPublicKey(encoded string) (*kyber768.PublicKey, []byte, error) {
+	// Base64デコード
+	pubKeyBytes, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, withCategory(categoryDecode, fmt.Errorf("Base64デコードエラー: %w", err))
+	}
+
+	// ML-KEM公開鍵をデシリアライズ
+	scheme := kyber768.Scheme()
+	publicKey, err := scheme.UnmarshalBinaryPublicKey(pubKeyBytes)
+	if err != nil {
+		return nil, nil, withCategory(categoryDecode, fmt.Errorf("公開鍵のデシリアライズエラー: %w", err))
+	}
+
+	mlkemPublicKey, ok := publicKey.(*kyber768.PublicKey)
+	if !ok {
+		return nil, nil, withCategory(categoryDecode, fmt.Errorf("ML-KEM公開鍵への変換エラー"))
+	}
+
+	return mlkemPublicKey, pubKeyBytes, nil
+}
+
+// RSAで鍵を暗号化（OAEP）
+func encryptRSA(publicKey *rsa.PublicKey, data []byte) ([]byte, error) {
+	hash := sha256.New()
+	ciphertext, err := rsa.EncryptOAEP(hash, entropy.Reader(entropy.OperationRSAEncrypt), publicKey, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ciphertext, nil
+}
+
+// ML-KEMでカプセル化（暗号化）
+func encryptMLKEM(publicKey *kyber768.PublicKey, data []byte) ([]byte, []byte, error) {
+	scheme := kyber768.Scheme()
+	// カプセル化の乱数は計測のために明示的に読み出して渡す（scheme.Encapsulateと同じ処理）
+	seed := make([]byte, scheme.EncapsulationSeedSize())
+	if _, err := io.ReadFull(entropy.Reader(entropy.OperationMLKEMEncapsulate), seed); err != nil {
+		return nil, nil, err
+	}
+	// カプセル化: 共有秘密鍵とカプセル化テキストを生成
+	ciphertext, sharedSecret, err := scheme.EncapsulateDeterministically(publicKey, seed)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 実際のアプリケーションでは、sharedSecretを使ってdataを暗号化する
+	// ここでは比較のためカプセル化テキストのサイズを測定
+	return ciphertext, sharedSecret, nil
+}
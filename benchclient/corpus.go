@@ -0,0 +1,206 @@
+package benchclient
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	corpusMessages = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_corpus_messages_total",
+			Help: "Total number of encrypted messages, by corpus and result",
+		},
+		[]string{"corpus", "result"},
+	)
+	corpusMessageSize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_corpus_message_size_bytes",
+			Help: "Size of the latest plaintext message from each corpus in bytes",
+		},
+		[]string{"corpus"},
+	)
+	corpusEncryptDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "client_corpus_aes_encrypt_duration_seconds",
+			Help:    "Duration of AES encryption of a message, by corpus",
+			Buckets: prometheus.ExponentialBuckets(0.000001, 4, 14),
+		},
+		[]string{"corpus"},
+	)
+)
+
+// コーパスのメッセージの最大サイズ（バイト）
+const maxCorpusMessageSize = 64 << 20
+
+// 既定のメッセージ
+const defaultMessage = "量子コンピュータに対抗するポスト量子暗号"
+
+// 暗号化するメッセージ（Textは任意のバイト列で、UTF-8とは限らない）
+type Message struct {
+	Corpus string // 取り出したコーパスの名前（メトリクスのcorpusラベル）
+	Text   string
+}
+
+// 名前の付いたメッセージの集まり
+type Corpus struct {
+	Name     string
+	Messages []string
+}
+
+// 既定のコーパス（日本語の文1つ）
+func DefaultCorpus() Corpus {
+	return Corpus{Name: "default", Messages: []string{defaultMessage}}
+}
+
+// UTF-8と暗号化の境界になりやすいメッセージ
+var unicodeEdgeCases = []string{
+	"",
+	"a",
+	// ちょうど1ブロック（パディングだけのブロックが付く）
+	"0123456789abcdef",
+	// NUL
+	"\x00\x00\x00",
+	// バイト順マーク
+	"\ufeffBOM付き",
+	// 結合文字（合成済みの文字とはバイト列が異なる）
+	"e\u0301 ｶ\uff9e か\u3099",
+	// ZWJシーケンスと国旗
+	"\U0001F468\u200d\U0001F469\u200d\U0001F467\U0001F1EF\U0001F1F5",
+	// 双方向テキストの制御文字
+	"\u202eRTL上書き\u202c",
+	// サロゲートペアが必要な文字
+	"\U00020BB7野家",
+	// 不正なUTF-8（サロゲートのコードポイント、冗長なエンコーディング、範囲外のバイト）
+	"\xed\xa0\x80 \xc0\xaf \xff\xfe",
+	// 16KiBの境界で途中で切れたマルチバイト文字
+	strings.Repeat("あ", 5461) + "\xe3",
+}
+
+// -corpus の値を解釈する（[name=]kind[:args]）
+//
+//	default               既定の日本語の文
+//	file:PATH             ファイルの各行（空行を除く）
+//	random:SIZE           ランダムなバイト列（起動時に1回だけ生成する）
+//	repeat:PATTERN:COUNT  PATTERNをCOUNT回繰り返した文字列
+//	empty                 空のメッセージ
+//	unicode               結合文字・絵文字・不正なUTF-8などの境界値
+//
+// nameを省略した場合はkindをコーパスの名前にする
+func ParseCorpus(s string) (Corpus, error) {
+	name, spec, ok := strings.Cut(s, "=")
+	if !ok {
+		name, spec = "", s
+	}
+	kind, args, _ := strings.Cut(spec, ":")
+	if name == "" {
+		name = kind
+	}
+	c := Corpus{Name: name}
+	switch kind {
+	case "default":
+		c.Messages = DefaultCorpus().Messages
+	case "file":
+		lines, err := readCorpusFile(args)
+		if err != nil {
+			return c, err
+		}
+		c.Messages = lines
+	case "random":
+		size, err := parseCorpusSize(args)
+		if err != nil {
+			return c, err
+		}
+		b := make([]byte, size)
+		if _, err := rand.Read(b); err != nil {
+			return c, fmt.Errorf("ランダムなメッセージの生成エラー: %w", err)
+		}
+		c.Messages = []string{string(b)}
+	case "repeat":
+		// パターンに ':' を含められるように、回数は最後の ':' の後ろとする
+		i := strings.LastIndex(args, ":")
+		if i < 1 {
+			return c, fmt.Errorf("repeatはrepeat:PATTERN:COUNTで指定してください: %q", s)
+		}
+		count, err := strconv.Atoi(args[i+1:])
+		if err != nil || count < 0 || count > maxCorpusMessageSize/i {
+			return c, fmt.Errorf("繰り返し回数が不正です（最大%dバイト）: %q", maxCorpusMessageSize, args[i+1:])
+		}
+		c.Messages = []string{strings.Repeat(args[:i], count)}
+	case "empty":
+		c.Messages = []string{""}
+	case "unicode":
+		c.Messages = unicodeEdgeCases
+	default:
+		return c, fmt.Errorf("不明なコーパス: %q (default / file / random / repeat / empty / unicode)", kind)
+	}
+	if len(c.Messages) == 0 {
+		return c, fmt.Errorf("コーパス %s にメッセージがありません", name)
+	}
+	return c, nil
+}
+
+func parseCorpusSize(s string) (int, error) {
+	size, err := strconv.Atoi(s)
+	if err != nil || size < 0 || size > maxCorpusMessageSize {
+		return 0, fmt.Errorf("メッセージのサイズは0〜%dバイトで指定してください: %q", maxCorpusMessageSize, s)
+	}
+	return size, nil
+}
+
+// ファイルの各行をメッセージとして読み込む
+func readCorpusFile(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("コーパスの読み込みエラー: %w", err)
+	}
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(nil, maxCorpusMessageSize)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("コーパスの読み込みエラー: %w", err)
+	}
+	return lines, nil
+}
+
+// すべてのコーパスのメッセージを順番に並べる（指定がない場合は既定のコーパス）
+func corpusMessagesOf(corpora []Corpus) []Message {
+	if len(corpora) == 0 {
+		corpora = []Corpus{DefaultCorpus()}
+	}
+	var messages []Message
+	for _, c := range corpora {
+		for _, text := range c.Messages {
+			messages = append(messages, Message{Corpus: c.Name, Text: text})
+		}
+	}
+	return messages
+}
+
+// メッセージの暗号化の結果を記録する
+func recordCorpusMessage(message Message, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	corpusMessages.WithLabelValues(message.Corpus, result).Inc()
+	corpusMessageSize.WithLabelValues(message.Corpus).Set(float64(len(message.Text)))
+}
+
+// AES暗号化の所要時間をコーパスごとに記録する
+func observeCorpusEncrypt(message Message, d time.Duration) {
+	corpusEncryptDuration.WithLabelValues(message.Corpus).Observe(d.Seconds())
+}
@@ -0,0 +1,92 @@
+package benchclient
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/cpu"
+)
+
+var (
+	dataCipherInfo = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_data_cipher_info",
+			Help: "Set to 1 for the data encryption family in use (aes-cbc-hmac, aes-gcm, aes-gcm-siv, chacha20-poly1305)",
+		},
+		[]string{"cipher"},
+	)
+	dataEncryptDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "client_data_encrypt_duration_seconds",
+			Help:    "Duration of encrypting and authenticating the message in seconds, by data encryption algorithm and key size in bits",
+			Buckets: []float64{0.000005, 0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.005},
+		},
+		[]string{"cipher", "key_bits"},
+	)
+	dataEncryptionOverhead = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_data_encryption_overhead_bytes",
+			Help: "Bytes added to the last message by the data encryption (IV or nonce, padding and MAC or tag), by data encryption algorithm",
+		},
+		[]string{"cipher"},
+	)
+	cpuAESAcceleration = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_cpu_aes_acceleration",
+			Help: "1 if the CPU has AES instructions (AES-NI, ARMv8 AES), 0 otherwise; without them ChaCha20-Poly1305 is usually faster than AES",
+		},
+	)
+)
+
+// メッセージの暗号化に使う方式の種類
+var dataCipherFamily = cryptoutil.FamilyCBCHMAC
+
+func init() {
+	if cpu.X86.HasAES || cpu.ARM64.HasAES || cpu.S390X.HasAES {
+		cpuAESAcceleration.Set(1)
+	}
+}
+
+// データ暗号化方式の種類を設定する（空の場合はaes-cbc-hmac）
+// 種類ごとに使える鍵のサイズが異なるため、aesKeySizesを設定した後に呼ぶ
+func setDataCipher(family string) error {
+	if family == "" {
+		family = cryptoutil.FamilyCBCHMAC
+	}
+	if !cryptoutil.KnownDataCipherFamily(family) {
+		return fmt.Errorf("データ暗号化方式は%sのいずれかを指定してください: %q", strings.Join(cryptoutil.DataCipherFamilies(), "・"), family)
+	}
+	for _, bits := range aesKeySizes {
+		if _, ok := cryptoutil.DataCipherFor(family, bits/8); !ok {
+			return fmt.Errorf("%sでは%dビットの鍵は使えません", family, bits)
+		}
+	}
+	dataCipherFamily = family
+	dataCipherInfo.Reset()
+	dataCipherInfo.WithLabelValues(family).Set(1)
+	return nil
+}
+
+// データ鍵のサイズ（バイト）に対応する、使用中の種類のデータ暗号化方式
+func currentDataCipher(keySize int) cryptoutil.DataCipher {
+	c, _ := cryptoutil.DataCipherFor(dataCipherFamily, keySize)
+	return c
+}
+
+// メッセージを暗号化し、時間と増えたバイト数を記録する
+func sealMessage(plaintext, key []byte) (*SealedMessage, error) {
+	dataCipher := currentDataCipher(len(key))
+	start := time.Now()
+	iv, ciphertext, tag, err := dataCipher.Seal(key, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	msg := &SealedMessage{Plaintext: plaintext, Ciphertext: ciphertext, IV: iv, MAC: tag, Algorithm: dataCipher.Name, AESEncrypt: time.Since(start)}
+	dataEncryptDuration.WithLabelValues(dataCipher.Name, strconv.Itoa(dataCipher.KeySize*8)).Observe(msg.AESEncrypt.Seconds())
+	dataEncryptionOverhead.WithLabelValues(dataCipher.Name).Set(float64(len(iv) + len(ciphertext) + len(tag) - len(plaintext)))
+	return msg, nil
+}
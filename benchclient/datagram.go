@@ -0,0 +1,39 @@
+package benchclient
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/datagram"
+)
+
+// UDPのデータグラムで計測するトランスポート
+const transportDatagram = "datagram"
+
+// データグラムで計測するセッション（未設定の場合は計測しない）
+var (
+	rsaDatagramSession   *Session
+	mlkemDatagramSession *Session
+)
+
+// サーバーのUDPアドレスにデータグラムで鍵合意するセッションを作成する
+// 公開鍵の取得から復号の確認まで、HTTPの場合と同じリクエストをデータグラムに分割して送る
+func newDatagramSession(algorithm, addr string, cfg datagram.Config) *Session {
+	client := &http.Client{Transport: datagram.NewTransport(algorithm, cfg), Timeout: 30 * time.Second}
+	return &Session{Algorithm: algorithm, Transport: transportDatagram, Client: client, KeyURL: "http://" + addr + "/public-key"}
+}
+
+// データグラムでセッションを実行し、鍵交換の所要時間を記録する
+// 計測の比較用のため、失敗してもサーキットブレーカーやエラーの集計には含めない
+func measureDatagram(session *Session, aesKey []byte, msg *SealedMessage) {
+	if session == nil || !algorithmEnabled(session.Algorithm) {
+		return
+	}
+	res, err := session.Run(aesKey, msg)
+	if err != nil {
+		log.Printf("データグラムの計測に失敗 [%s]: %v", session.Algorithm, err)
+		return
+	}
+	keyExchangeDuration.WithLabelValues(session.Algorithm, transportDatagram).Set(res.Timings.Exchange().Seconds())
+}
@@ -0,0 +1,88 @@
+package benchclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	pathpkg "path"
+
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var decryptVerifications = factory.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "client_decrypt_verifications_total",
+		Help: "Total number of server-side decryption checks, by result",
+	},
+	[]string{"target", "result"},
+)
+
+// 暗号化データの送信構造体
+type EncryptedData = wire.EncryptedData
+
+// サーバーの復号結果
+type decryptResponse = wire.DecryptResponse
+
+// 公開鍵のURLから同じサーバーの復号エンドポイントのURLを作る
+// 公開鍵のパスの最後の要素だけを置き換え、リバースプロキシの下のパス（例: /rsa/public-key → /rsa/decrypt）を保つ
+func endpointURL(keyURL, path string) (string, error) {
+	u, err := url.Parse(keyURL)
+	if err != nil {
+		return "", err
+	}
+	dir := pathpkg.Dir(u.Path)
+	if dir == "." || dir == "/" {
+		dir = ""
+	}
+	u.Path = dir + path
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// JSONエンコード済みの暗号化データ（dataをエンコードしたbody）をサーバーに送って復号させる
+func sendEncryptedData(client *http.Client, target, decryptURL string, data *EncryptedData, body []byte) (*decryptResponse, error) {
+	resp, err := client.Post(decryptURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, withCategory(categoryNetwork, fmt.Errorf("HTTP POSTエラー: %w", err))
+	}
+	if countExchange(target, resp, len(body)) {
+		recordEnvelopeBytes(target, data, len(body))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// RSAサーバーとML-KEMサーバーはエラーのコードをJSONで返す
+		var errResp wire.ErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil && errResp.Code != "" {
+			return nil, withCategory(categoryServer, fmt.Errorf("HTTPステータスエラー: %d (%s: %w)", resp.StatusCode, errResp.Code, &errResp))
+		}
+		return nil, withCategory(categoryServer, fmt.Errorf("HTTPステータスエラー: %d", resp.StatusCode))
+	}
+
+	var decResp decryptResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decResp); err != nil {
+		return nil, withCategory(categoryDecode, fmt.Errorf("JSONデコードエラー: %w", err))
+	}
+	return &decResp, nil
+}
+
+// サーバーが復号した平文のハッシュが元の平文と一致するか確認する
+func verifyPlaintextDigest(target string, decResp *decryptResponse, plaintext []byte) error {
+	got, err := base64.StdEncoding.DecodeString(decResp.PlaintextSHA256)
+	if err != nil {
+		return withCategory(categoryDecode, fmt.Errorf("Base64デコードエラー: %w", err))
+	}
+	want := sha256.Sum256(plaintext)
+	if subtle.ConstantTimeCompare(got, want[:]) != 1 {
+		decryptVerifications.WithLabelValues(target, "mismatch").Inc()
+		return withCategory(categoryCrypto, fmt.Errorf("復号結果のハッシュが一致しません"))
+	}
+	decryptVerifications.WithLabelValues(target, "ok").Inc()
+	return nil
+}
@@ -0,0 +1,93 @@
+package benchclient
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	operationsPerScrape = factory.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "client_operations_per_scrape",
+			Help:    "Number of encryption rounds between two scrapes of /metrics",
+			Buckets: []float64{0, 1, 2, 5, 10, 15, 30, 60, 120, 300},
+		},
+	)
+	unscrapedOperations = factory.NewCounter(
+		prometheus.CounterOpts{
+			Name: "client_unscraped_operations_total",
+			Help: "Total number of encryption rounds whose gauge values were overwritten before being scraped (histograms and counters still include them)",
+		},
+	)
+	observedScrapeInterval = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_observed_scrape_interval_seconds",
+			Help: "Time between the two latest scrapes of /metrics in seconds",
+		},
+	)
+)
+
+// スクレイプの間に実行した暗号化の回数
+// ゲージ（client_rsa_encryption_duration_seconds など）は最後の値しか残らないため、
+// 2回以上実行した場合はそれ以外の計測がスクレイプされずに失われる
+var dutyCycle struct {
+	sync.Mutex
+	operations int
+	lastScrape time.Time
+	warned     bool
+}
+
+// スクレイプ間隔と1回のスクレイプあたりの実行回数から暗号化の間隔を決める
+// scrapeIntervalが0の場合はintervalをそのまま使う
+func dutyCycleInterval(interval, scrapeInterval time.Duration, opsPerScrape int) time.Duration {
+	if scrapeInterval <= 0 {
+		return interval
+	}
+	opsPerScrape = max(opsPerScrape, 1)
+	interval = scrapeInterval / time.Duration(opsPerScrape)
+	log.Printf("スクレイプ間隔 %v に合わせて、%v ごと（1回のスクレイプあたり%d回）に暗号化します", scrapeInterval, interval, opsPerScrape)
+	return interval
+}
+
+var dutyCycleTracking sync.Once
+
+// /metrics の取得ごとに、前回の取得からの実行回数を記録する（何度呼び出しても登録は1回）
+func startDutyCycleTracking() {
+	dutyCycleTracking.Do(func() { metrics.OnScrape(recordDutyCycle) })
+}
+
+func recordDutyCycle() {
+	dutyCycle.Lock()
+	defer dutyCycle.Unlock()
+	now := time.Now()
+	n := dutyCycle.operations
+	dutyCycle.operations = 0
+	first := dutyCycle.lastScrape.IsZero()
+	elapsed := now.Sub(dutyCycle.lastScrape)
+	dutyCycle.lastScrape = now
+	if first {
+		// 起動から最初のスクレイプまでは間隔が分からないため記録しない
+		return
+	}
+	observedScrapeInterval.Set(elapsed.Seconds())
+	operationsPerScrape.Observe(float64(n))
+	if n > 1 {
+		unscrapedOperations.Add(float64(n - 1))
+		if !dutyCycle.warned {
+			dutyCycle.warned = true
+			log.Printf("スクレイプの間に%d回暗号化したため、ゲージの値のうち%d回分は取得されずに上書きされました"+
+				"（ヒストグラムのclient_phase_duration_secondsを使うか、-scrape-interval でスクレイプ間隔に合わせてください）", n, n-1)
+		}
+	}
+}
+
+// 暗号化を1回実行したことを記録する
+func countDutyCycleOperation() {
+	dutyCycle.Lock()
+	defer dutyCycle.Unlock()
+	dutyCycle.operations++
+}
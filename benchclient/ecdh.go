@@ -0,0 +1,155 @@
+package benchclient
+
+import (
+	"crypto/ecdh"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/entropy"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ecdhPublicKeySize = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_ecdh_public_key_size_bytes",
+			Help: "Size of the server's static ECDH P-256 public key in bytes",
+		},
+	)
+	ecdhEncryptedKeySize = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_ecdh_encrypted_key_size_bytes",
+			Help: "Size of the ephemeral ECDH P-256 public key sent to the server in bytes",
+		},
+	)
+	ecdhDeriveDuration = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_ecdh_derive_duration_seconds",
+			Help: "Duration of ephemeral key generation, ECDH shared secret derivation and AES key wrap in seconds",
+		},
+	)
+	ecdhDeriveDurationAvg = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_ecdh_derive_duration_avg_seconds",
+			Help: "Average duration of ECDH key derivation operations in seconds",
+		},
+	)
+	mlkemVsECDHRatio = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_mlkem_vs_ecdh_ratio",
+			Help: "Ratio of ML-KEM to ECDH P-256 (ML-KEM / ECDH), by quantity (duration, encrypted_key_size, public_key_size)",
+		},
+		[]string{"quantity"},
+	)
+)
+
+// ECDHの平均計算用の累積値
+var (
+	ecdhTotalDuration  float64
+	ecdhOperationCount int
+)
+
+// ECDHサーバーのサーキットブレーカーとセッション（未設定の場合は実行しない）
+var (
+	ecdhBreaker *circuitBreaker
+	ecdhSession *Session
+)
+
+// ECDHサーバーの静的公開鍵を取得し、一時鍵とのECDHで得た共有秘密鍵でAES鍵をラップする
+func (s *Session) exchangeECDH(aesKey []byte) (*SessionResult, error) {
+	fetchStart := time.Now()
+	pubKeyResp, fetched, err := fetchPublicKey(s.Client, AlgorithmECDH, s.KeyURL)
+	if err != nil {
+		return nil, atStage("ecdh_fetch", fmt.Errorf("ECDH公開鍵の取得に失敗: %w", err))
+	}
+	parseStart := time.Now()
+	publicKey, pubKeyBytes, err := parseECDHPublicKey(pubKeyResp.PublicKey)
+	if err != nil {
+		return nil, atStage("ecdh_fetch", fmt.Errorf("ECDH公開鍵の取得に失敗: %w", err))
+	}
+	res := &SessionResult{KeyID: pubKeyResp.KeyID, PublicKeyBytes: pubKeyBytes, EnvelopeVersion: fetched.version}
+	res.Timings.KeyCached = fetched.cached
+	res.Timings.KeyParse = time.Since(parseStart)
+	res.Timings.Fetch = time.Since(fetchStart)
+
+	wrapStart := time.Now()
+	ephemeral, err := ecdh.P256().GenerateKey(entropy.Reader(entropy.OperationECDHKeyGen))
+	if err != nil {
+		return nil, atStage("ecdh_derive", withCategory(categoryCrypto, fmt.Errorf("一時鍵の生成に失敗: %w", err)))
+	}
+	sharedSecret, err := ephemeral.ECDH(publicKey)
+	if err != nil {
+		return nil, atStage("ecdh_derive", withCategory(categoryCrypto, fmt.Errorf("共有秘密鍵の導出に失敗: %w", err)))
+	}
+	res.EphemeralPublicKey = ephemeral.PublicKey().Bytes()
+	// 使い終わった共有秘密鍵は消去する
+	err = wrapSharedSecret(AlgorithmECDH, res, sharedSecret, aesKey)
+	zeroize("shared_secret", sharedSecret)
+	if err != nil {
+		return nil, atStage("ecdh_wrap", withCategory(categoryCrypto, fmt.Errorf("AES鍵のラップに失敗: %w", err)))
+	}
+	res.Timings.Wrap = time.Since(wrapStart)
+	res.Timings.ECDHDerive = res.Timings.Wrap
+	return res, nil
+}
+
+// Base64エンコードされたECDH公開鍵（PKIX DER）をパース
+func parseECDHPublicKey(encoded string) (*ecdh.PublicKey, []byte, error) {
+	pubKeyBytes, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, withCategory(categoryDecode, fmt.Errorf("Base64デコードエラー: %w", err))
+	}
+	pub, err := x509.ParsePKIXPublicKey(pubKeyBytes)
+	if err != nil {
+		return nil, nil, withCategory(categoryDecode, fmt.Errorf("公開鍵のパースエラー: %w", err))
+	}
+	// crypto/x509は楕円曲線の鍵を*ecdsa.PublicKeyとして返す
+	type ecdhConverter interface {
+		ECDH() (*ecdh.PublicKey, error)
+	}
+	converter, ok := pub.(ecdhConverter)
+	if !ok {
+		return nil, nil, withCategory(categoryDecode, fmt.Errorf("ECDH公開鍵への変換エラー"))
+	}
+	publicKey, err := converter.ECDH()
+	if err != nil || publicKey.Curve() != ecdh.P256() {
+		return nil, nil, withCategory(categoryDecode, fmt.Errorf("P-256の公開鍵ではありません"))
+	}
+	return publicKey, pubKeyBytes, nil
+}
+
+// ECDHのセッション結果をメトリクスに記録する
+func recordECDHResult(startTime time.Time, res *SessionResult) {
+	keyFetchDuration.WithLabelValues(AlgorithmECDH).Set(res.Timings.Fetch.Seconds())
+	ecdhPublicKeySize.Set(float64(len(res.PublicKeyBytes)))
+	ecdhEncryptedKeySize.Set(float64(len(res.EncapsulatedKey())))
+	ecdhDeriveDuration.Set(res.Timings.Wrap.Seconds())
+	keyExchangeDuration.WithLabelValues(AlgorithmECDH, transportNetwork).Set(res.Timings.Exchange().Seconds())
+
+	// 累積平均を計算
+	ecdhOperationCount++
+	ecdhTotalDuration += res.Timings.Wrap.Seconds()
+	ecdhDeriveDurationAvg.Set(ecdhTotalDuration / float64(ecdhOperationCount))
+
+	fmt.Printf("[%s] ✓ ECDHで鍵合意 (公開鍵 %dバイト, 一時公開鍵 %dバイト)\n", time.Since(startTime), len(res.PublicKeyBytes), len(res.EphemeralPublicKey))
+	printTimings(res.Timings)
+}
+
+// ML-KEMとECDHの比較値を記録する（両方の経路が成功した場合のみ）
+func recordMLKEMVsECDH(mlkem, ecdhResult *SessionResult) {
+	set := func(quantity string, v float64) {
+		mlkemVsECDHRatio.WithLabelValues(quantity).Set(v)
+		observeRatio(comparisonMLKEMVsECDH, quantity, v)
+	}
+	if ecdhResult.Timings.Wrap > 0 {
+		set("duration", mlkem.Timings.Wrap.Seconds()/ecdhResult.Timings.Wrap.Seconds())
+	}
+	if n := len(ecdhResult.EncapsulatedKey()); n > 0 {
+		set("encrypted_key_size", float64(len(mlkem.EncapsulatedKey()))/float64(n))
+	}
+	if n := len(ecdhResult.PublicKeyBytes); n > 0 {
+		set("public_key_size", float64(len(mlkem.PublicKeyBytes))/float64(n))
+	}
+}
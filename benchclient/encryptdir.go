@@ -0,0 +1,287 @@
+package benchclient
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	dirFileDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "client_dir_file_encrypt_duration_seconds",
+			Help:    "Histogram of the time to read, encrypt, wrap the key of and write one file in seconds",
+			Buckets: []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 1},
+		},
+		[]string{"algorithm"},
+	)
+	dirThroughput = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_dir_throughput_bytes_per_second",
+			Help: "Plaintext bytes encrypted per second over the whole directory, including key wraps and file I/O",
+		},
+		[]string{"algorithm"},
+	)
+	dirOverhead = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_dir_overhead_bytes",
+			Help: "Bytes added to the directory by envelope encryption, by component (key_material, content, manifest, total)",
+		},
+		[]string{"algorithm", "component"},
+	)
+	dirOverheadRatio = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_dir_overhead_ratio",
+			Help: "Total overhead divided by the plaintext size of the directory",
+		},
+		[]string{"algorithm"},
+	)
+	dirFilesTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_dir_files_total",
+			Help: "Total number of files processed by the directory encryption, by result",
+		},
+		[]string{"algorithm", "result"},
+	)
+)
+
+// マニフェストのファイル名
+const ManifestFile = "manifest.json"
+
+// 暗号化したファイルの拡張子
+const encryptedFileSuffix = ".enc"
+
+// ディレクトリの暗号化の設定
+type DirConfig struct {
+	Dir         string // 暗号化するディレクトリ
+	OutDir      string // 暗号化したファイルとマニフェストを書き出すディレクトリ
+	Algorithm   string // AES鍵を保護する方式（rsa / mlkem）
+	KeyURL      string // 公開鍵を取得するURL
+	AESKeySizes []int  // ファイルごとに順に使うAES鍵のサイズ（ビット、空の場合は設定済みのサイズ）
+}
+
+// 暗号化したディレクトリのマニフェスト
+// 各ファイルのエントリーは/decrypt・/decapsulateのリクエストと同じフィールドを持ち、サーバーの秘密鍵で復号できる
+type DirManifest struct {
+	Version          int         `json:"version"`
+	Algorithm        string      `json:"algorithm"`         // AES鍵を保護した方式
+	ContentAlgorithm string      `json:"content_algorithm"` // ファイルの暗号化方式（ファイルごとに異なる場合は空、各エントリーのalgorithmを使う）
+	KeyID            string      `json:"key_id"`
+	PublicKeyURL     string      `json:"public_key_url"`
+	CreatedAt        time.Time   `json:"created_at"`
+	Files            []FileEntry `json:"files"`
+	PlaintextBytes   int64       `json:"plaintext_bytes"`
+	CiphertextBytes  int64       `json:"ciphertext_bytes"` // 暗号化したファイルの合計（マニフェストを除く）
+}
+
+// 1つのファイルのエントリー（ファイルごとに異なるAES鍵を使う）
+type FileEntry struct {
+	Path            string `json:"path"` // 元のディレクトリからの相対パス
+	Size            int64  `json:"size"`
+	SHA256          string `json:"sha256"` // 平文のハッシュ（16進数）
+	EncryptedPath   string `json:"encrypted_path"`
+	Algorithm       string `json:"algorithm"`                // ファイルの暗号化方式（AES鍵のサイズを含む）
+	EncryptedAESKey string `json:"encrypted_aes_key"`        // Base64
+	KEMCiphertext   string `json:"kem_ciphertext,omitempty"` // Base64（ML-KEMのみ）
+	IV              string `json:"iv"`
+	MAC             string `json:"mac"`
+}
+
+// ファイルごとのAES鍵を保護する
+type keyWrapper func(aesKey []byte) (wrapped, kemCiphertext []byte, err error)
+
+// ディレクトリのすべてのファイルをファイルごとのAES鍵で暗号化し、AES鍵を指定した方式で保護してマニフェストを書き出す
+// 公開鍵は最初に一度だけ取得し、ファイルごとに新たに暗号化（ML-KEMはカプセル化）する
+func EncryptDir(cfg DirConfig) (*DirManifest, error) {
+	if cfg.Dir == "" || cfg.OutDir == "" {
+		return nil, fmt.Errorf("暗号化するディレクトリと出力先を指定してください")
+	}
+	if httpClient == nil {
+		configureHTTPClient(false, nil, nil)
+	}
+	if len(cfg.AESKeySizes) > 0 {
+		if err := setAESKeySizes(cfg.AESKeySizes); err != nil {
+			return nil, err
+		}
+	}
+	keyID, wrap, err := newKeyWrapper(cfg.Algorithm, cfg.KeyURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(cfg.OutDir, 0o755); err != nil {
+		return nil, fmt.Errorf("出力先の作成エラー: %w", err)
+	}
+
+	manifest := &DirManifest{
+		Version:      1,
+		Algorithm:    cfg.Algorithm,
+		KeyID:        keyID,
+		PublicKeyURL: cfg.KeyURL,
+		CreatedAt:    time.Now().UTC(),
+		Files:        []FileEntry{},
+	}
+	// 出力先が暗号化するディレクトリの中にある場合は、暗号化したファイルを再び暗号化しない
+	outDir, err := filepath.Abs(cfg.OutDir)
+	if err != nil {
+		return nil, err
+	}
+	var keyMaterial int64
+	start := time.Now()
+	err = filepath.WalkDir(cfg.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if abs, err := filepath.Abs(path); err == nil && abs == outDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(cfg.Dir, path)
+		if err != nil {
+			return err
+		}
+		fileStart := time.Now()
+		entry, n, wrapped, err := encryptFile(path, rel, cfg.OutDir, wrap, len(manifest.Files))
+		if err != nil {
+			dirFilesTotal.WithLabelValues(cfg.Algorithm, "failure").Inc()
+			return fmt.Errorf("%sの暗号化に失敗: %w", rel, err)
+		}
+		dirFilesTotal.WithLabelValues(cfg.Algorithm, "success").Inc()
+		dirFileDuration.WithLabelValues(cfg.Algorithm).Observe(time.Since(fileStart).Seconds())
+		if len(manifest.Files) == 0 {
+			manifest.ContentAlgorithm = entry.Algorithm
+		} else if manifest.ContentAlgorithm != entry.Algorithm {
+			manifest.ContentAlgorithm = ""
+		}
+		manifest.Files = append(manifest.Files, *entry)
+		manifest.PlaintextBytes += entry.Size
+		manifest.CiphertextBytes += n
+		keyMaterial += int64(wrapped)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("マニフェストのJSONエンコードエラー: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(cfg.OutDir, ManifestFile), data, 0o644); err != nil {
+		return nil, fmt.Errorf("マニフェストの書き込みエラー: %w", err)
+	}
+	elapsed := time.Since(start)
+
+	// 暗号化したファイルの増加分（パディング）がcontent、保護したAES鍵・IV・MACはマニフェストに含まれる（key_materialは保護したAES鍵の生のサイズ）
+	content := manifest.CiphertextBytes - manifest.PlaintextBytes
+	total := content + int64(len(data))
+	dirThroughput.WithLabelValues(cfg.Algorithm).Set(float64(manifest.PlaintextBytes) / elapsed.Seconds())
+	dirOverhead.WithLabelValues(cfg.Algorithm, "key_material").Set(float64(keyMaterial))
+	dirOverhead.WithLabelValues(cfg.Algorithm, "content").Set(float64(content))
+	dirOverhead.WithLabelValues(cfg.Algorithm, "manifest").Set(float64(len(data)))
+	dirOverhead.WithLabelValues(cfg.Algorithm, "total").Set(float64(total))
+	if manifest.PlaintextBytes > 0 {
+		dirOverheadRatio.WithLabelValues(cfg.Algorithm).Set(float64(total) / float64(manifest.PlaintextBytes))
+	}
+	return manifest, nil
+}
+
+// 公開鍵を取得し、ファイルごとのAES鍵を保護する関数を返す
+func newKeyWrapper(algorithm, keyURL string) (string, keyWrapper, error) {
+	resp, _, err := fetchPublicKey(httpClient, algorithm, keyURL)
+	if err != nil {
+		return "", nil, fmt.Errorf("公開鍵の取得に失敗: %w", err)
+	}
+	switch algorithm {
+	case AlgorithmRSA:
+		var publicKey *rsa.PublicKey
+		if publicKey, _, err = parseRSAPublicKey(resp.PublicKey); err != nil {
+			return "", nil, err
+		}
+		return resp.KeyID, func(aesKey []byte) ([]byte, []byte, error) {
+			wrapped, err := encryptRSA(publicKey, aesKey)
+			return wrapped, nil, err
+		}, nil
+	case AlgorithmMLKEM:
+		var publicKey *kyber768.PublicKey
+		if publicKey, _, err = parseMLKEMPublicKey(resp.PublicKey); err != nil {
+			return "", nil, err
+		}
+		return resp.KeyID, func(aesKey []byte) ([]byte, []byte, error) {
+			ciphertext, sharedSecret, err := encryptMLKEM(publicKey, aesKey)
+			if err != nil {
+				return nil, nil, err
+			}
+			wrapped, err := cryptoutil.WrapKey(sharedSecret, aesKey)
+			zeroize("shared_secret", sharedSecret)
+			return wrapped, ciphertext, err
+		}, nil
+	default:
+		return "", nil, fmt.Errorf("ディレクトリの暗号化に対応していない方式です: %q（rsa / mlkem）", algorithm)
+	}
+}
+
+// counter番目のファイルを新しいAES鍵で暗号化して書き出し、マニフェストのエントリー、暗号化したファイルのサイズ、
+// 保護したAES鍵（とカプセル化テキスト）のサイズを返す
+func encryptFile(path, rel, outDir string, wrap keyWrapper, counter int) (*FileEntry, int64, int, error) {
+	plaintext, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	aesKey, err := newDataKey(counter)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("AES鍵の生成エラー: %w", err)
+	}
+	defer zeroize("aes_key", aesKey)
+
+	msg, err := sealMessage(plaintext, aesKey)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("AES暗号化エラー: %w", err)
+	}
+	observeAESEncrypt(msg)
+	ciphertext := msg.Ciphertext
+	wrapped, kemCiphertext, err := wrap(aesKey)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("AES鍵の保護に失敗: %w", err)
+	}
+
+	encryptedPath := filepath.ToSlash(rel) + encryptedFileSuffix
+	out := filepath.Join(outDir, filepath.FromSlash(encryptedPath))
+	if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		return nil, 0, 0, err
+	}
+	if err := os.WriteFile(out, ciphertext, 0o644); err != nil {
+		return nil, 0, 0, err
+	}
+
+	digest := sha256.Sum256(plaintext)
+	entry := &FileEntry{
+		Path:            filepath.ToSlash(rel),
+		Size:            int64(len(plaintext)),
+		SHA256:          hex.EncodeToString(digest[:]),
+		EncryptedPath:   encryptedPath,
+		Algorithm:       msg.algorithm(),
+		EncryptedAESKey: base64.StdEncoding.EncodeToString(wrapped),
+		IV:              base64.StdEncoding.EncodeToString(msg.IV),
+		MAC:             base64.StdEncoding.EncodeToString(msg.MAC),
+	}
+	if kemCiphertext != nil {
+		entry.KEMCiphertext = base64.StdEncoding.EncodeToString(kemCiphertext)
+	}
+	return entry, int64(len(ciphertext)), len(wrapped) + len(kemCiphertext), nil
+}
@@ -0,0 +1,85 @@
+package benchclient
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// エラーの分類
+const (
+	categoryNetwork = "network" // 接続・送受信の失敗
+	categoryDecode  = "decode"  // JSON / Base64 / 鍵フォーマットの解析失敗
+	categoryCrypto  = "crypto"  // 鍵生成・暗号化・カプセル化の失敗
+	categoryServer  = "server"  // サーバーがエラーステータスを返した
+)
+
+var errorsTotal = factory.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "client_errors_total",
+		Help: "Total number of errors in the hybrid encryption pipeline, by stage and category",
+	},
+	[]string{"stage", "category"},
+)
+
+// 分類付きのエラー
+type categorizedError struct {
+	category string
+	err      error
+}
+
+func (e *categorizedError) Error() string { return e.err.Error() }
+func (e *categorizedError) Unwrap() error { return e.err }
+
+// エラーに分類を付与する
+func withCategory(category string, err error) error {
+	return &categorizedError{category: category, err: err}
+}
+
+// パイプラインのどの段階で失敗したかを保持するエラー
+type stageError struct {
+	stage string
+	err   error
+}
+
+func (e *stageError) Error() string { return fmt.Sprintf("%s: %v", e.stage, e.err) }
+func (e *stageError) Unwrap() error { return e.err }
+
+// エラーに段階を付与する
+func atStage(stage string, err error) error {
+	return &stageError{stage: stage, err: err}
+}
+
+// エラーの分類を取得する（分類されていない場合はcrypto扱い）
+func errorCategory(err error) string {
+	var ce *categorizedError
+	if errors.As(err, &ce) {
+		return ce.category
+	}
+	return categoryCrypto
+}
+
+// エラーを段階と分類ごとにカウントする
+func recordError(err error) {
+	stage := "unknown"
+	var se *stageError
+	if errors.As(err, &se) {
+		stage = se.stage
+	}
+	errorsTotal.WithLabelValues(stage, errorCategory(err)).Inc()
+}
+
+// errors.Joinでまとめられたエラーを個々のエラーに分解する
+func splitErrors(err error) []error {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+	// errors.Joinが入れ子になっている場合も平坦にする
+	var errs []error
+	for _, e := range joined.Unwrap() {
+		errs = append(errs, splitErrors(e)...)
+	}
+	return errs
+}
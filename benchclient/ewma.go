@@ -0,0 +1,62 @@
+package benchclient
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 比較の組み合わせ（比率のラベル）
+const (
+	comparisonMLKEMVsRSA  = "mlkem_vs_rsa"
+	comparisonMLKEMVsECDH = "mlkem_vs_ecdh"
+)
+
+var (
+	ratioEWMA = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_ratio_ewma",
+			Help: "Exponentially weighted moving average of the ML-KEM ratios, by comparison (mlkem_vs_rsa, mlkem_vs_ecdh) and quantity (duration, encrypted_key_size, public_key_size)",
+		},
+		[]string{"comparison", "quantity"},
+	)
+	ratioEWMAAlpha = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_ratio_ewma_alpha",
+			Help: "Smoothing factor of client_ratio_ewma (weight of the newest sample)",
+		},
+	)
+)
+
+// 比率の指数移動平均（瞬間値はばらつきが大きく、PromQLで平滑化すると短い悪化が見えなくなるため、
+// 計測のたびにクライアント側で更新する）
+var ratioAverages = struct {
+	sync.Mutex
+	alpha  float64
+	values map[[2]string]float64
+}{alpha: defaultRatioEWMAAlpha, values: make(map[[2]string]float64)}
+
+// 既定の平滑化係数（直近の約20回の計測を反映する）
+const defaultRatioEWMAAlpha = 0.1
+
+func setRatioEWMAAlpha(alpha float64) {
+	ratioAverages.Lock()
+	defer ratioAverages.Unlock()
+	ratioAverages.alpha = alpha
+	ratioEWMAAlpha.Set(alpha)
+}
+
+// 比率の瞬間値で指数移動平均を更新する（最初の値はそのまま使う）
+func observeRatio(comparison, quantity string, v float64) {
+	ratioAverages.Lock()
+	defer ratioAverages.Unlock()
+	key := [2]string{comparison, quantity}
+	avg, ok := ratioAverages.values[key]
+	if ok {
+		avg += ratioAverages.alpha * (v - avg)
+	} else {
+		avg = v
+	}
+	ratioAverages.values[key] = avg
+	ratioEWMA.WithLabelValues(comparison, quantity).Set(avg)
+}
@@ -0,0 +1,27 @@
+package benchclient
+
+import (
+	"log"
+
+	"github.com/keyi1000/PQC_grafana/features"
+)
+
+// 設定された機能がフィーチャーゲートで無効の場合はログに出力してfalseを返す
+func featureEnabled(f features.Feature) bool {
+	if features.Enabled(f) {
+		return true
+	}
+	log.Printf("[%s] %v", ServiceName, features.Disabled(f))
+	return false
+}
+
+// フィーチャーゲートで無効にした鍵交換の経路（実行中の設定で有効にしても実行しない）
+func algorithmGated(algorithm string) bool {
+	switch algorithm {
+	case AlgorithmDual:
+		return !features.Enabled(features.Dual)
+	case AlgorithmECDH:
+		return !features.Enabled(features.ECDH)
+	}
+	return false
+}
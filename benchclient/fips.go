@@ -0,0 +1,39 @@
+package benchclient
+
+import (
+	"fmt"
+
+	"github.com/keyi1000/PQC_grafana/fips"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var fipsNonCompliant = factory.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "client_fips_noncompliant_operations_attempted",
+		Help: "Number of operations skipped in FIPS mode because they use a non-approved algorithm, by algorithm",
+	},
+	[]string{"algorithm"},
+)
+
+// ハイブリッド暗号化の経路で使う、FIPSで承認されていない方式
+// RSAサーバーは2048ビット、ML-KEMサーバーはFIPS 203以前のKyber768、データは既定ではAES-CBC + HMACで暗号化する
+func legacyAlgorithms() []string {
+	algorithms := []string{AlgorithmRSA, AlgorithmMLKEM}
+	if dualSession != nil {
+		algorithms = append(algorithms, AlgorithmDual)
+	}
+	if c := currentDataCipher(32); !fips.ApprovedCipher(c.Name) {
+		algorithms = append(algorithms, c.Name)
+	}
+	return algorithms
+}
+
+// FIPSモードではハイブリッド暗号化を実行せず、試行された方式を記録する
+// 登録されたKEMでの鍵交換と相互運用性の確認は、承認されたKEMだけで続ける
+func skipNonCompliant(counter int, message Message) error {
+	fmt.Printf("\n========== 暗号化 #%d（FIPSモード: 承認されていない方式の経路をスキップ） ==========\n", counter)
+	for _, algorithm := range legacyAlgorithms() {
+		fipsNonCompliant.WithLabelValues(algorithm).Inc()
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package benchclient
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	keyBindingVerifyDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "client_key_binding_verify_duration_seconds",
+			Help:    "Histogram of the time to verify that a public key response is bound to the client's nonce in seconds",
+			Buckets: []float64{0.000001, 0.0000025, 0.000005, 0.00001, 0.000025, 0.00005, 0.0001, 0.00025},
+		},
+		[]string{"algorithm"},
+	)
+	keyBindingVerifications = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_key_binding_verifications_total",
+			Help: "Total number of public key freshness verifications, by result (ok, nonce_mismatch, binding_mismatch, missing)",
+		},
+		[]string{"algorithm", "result"},
+	)
+)
+
+// 公開鍵をPOSTでnonceを付けて取得し、レスポンスとの結び付きを確認するか
+var keyNonceEnabled bool
+
+// 公開鍵の取得に付けるnonceを作る
+func newKeyNonce() ([]byte, []byte, error) {
+	nonce := make([]byte, wire.MinNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	body, err := json.Marshal(wire.PublicKeyRequest{Nonce: base64.StdEncoding.EncodeToString(nonce)})
+	return nonce, body, err
+}
+
+// 暗号化データごとの再送の検出に使うnonce（Base64）
+func newRequestNonce() (string, error) {
+	nonce := make([]byte, wire.MinNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(nonce), nil
+}
+
+// 公開鍵のレスポンスが送ったnonceに結び付いているか確認する
+// 署名の仕組みがないため、古いレスポンスの再送と転送中の破損だけを検出できる
+func verifyKeyBinding(target string, nonce []byte, resp *PublicKeyResponse) error {
+	start := time.Now()
+	result, err := checkKeyBinding(nonce, resp)
+	keyBindingVerifyDuration.WithLabelValues(target).Observe(time.Since(start).Seconds())
+	keyBindingVerifications.WithLabelValues(target, result).Inc()
+	return err
+}
+
+func checkKeyBinding(nonce []byte, resp *PublicKeyResponse) (string, error) {
+	if resp.Nonce == "" || resp.Binding == "" {
+		return "missing", withCategory(categoryServer, fmt.Errorf("サーバーがnonceを結び付けていません"))
+	}
+	got, errNonce := base64.StdEncoding.DecodeString(resp.Nonce)
+	binding, errBinding := base64.StdEncoding.DecodeString(resp.Binding)
+	publicKey, errKey := base64.StdEncoding.DecodeString(resp.PublicKey)
+	if errNonce != nil || errBinding != nil || errKey != nil {
+		return "missing", withCategory(categoryDecode, fmt.Errorf("nonceまたは結び付けの値のBase64デコードエラー"))
+	}
+	if subtle.ConstantTimeCompare(got, nonce) != 1 {
+		return "nonce_mismatch", withCategory(categoryCrypto, fmt.Errorf("送ったnonceと異なるレスポンスです（古いレスポンスの再送の可能性）"))
+	}
+	if subtle.ConstantTimeCompare(binding, wire.KeyBinding(nonce, resp.KeyID, publicKey)) != 1 {
+		return "binding_mismatch", withCategory(categoryCrypto, fmt.Errorf("公開鍵がnonceに結び付いていません（公開鍵の破損または差し替えの可能性）"))
+	}
+	return "ok", nil
+}
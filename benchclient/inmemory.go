@@ -0,0 +1,78 @@
+package benchclient
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 計測に使ったトランスポート
+const (
+	transportNetwork  = "network"  // 実際のネットワーク経由
+	transportInMemory = "inmemory" // ハンドラーを直接呼び出す（ネットワークなし）
+)
+
+var (
+	keyExchangeDuration = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_key_exchange_duration_seconds",
+			Help: "Duration of public key fetch plus AES key wrap in seconds, by algorithm and transport",
+		},
+		[]string{"algorithm", "transport"},
+	)
+	networkContribution = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_network_contribution_seconds",
+			Help: "Network share of the key exchange duration (network minus in-memory) in seconds",
+		},
+		[]string{"algorithm"},
+	)
+)
+
+// ネットワークを介さない計測に使うセッション（未設定の場合は計測しない）
+var (
+	rsaLoopbackSession   *Session
+	mlkemLoopbackSession *Session
+)
+
+// リクエストをハンドラーに直接渡すRoundTripper
+type inMemoryTransport struct {
+	handler http.Handler
+}
+
+func (t *inMemoryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, req)
+	return rec.Result(), nil
+}
+
+// ハンドラーを直接呼び出すHTTPクライアントを作成
+func newInMemoryClient(handler http.Handler) *http.Client {
+	return &http.Client{Transport: withServerToken(&inMemoryTransport{handler: handler})}
+}
+
+// ハンドラーを直接呼び出すセッションを作成
+// URLはリクエストの組み立てにのみ使い、実際には接続しない
+func newInMemorySession(algorithm string, handler http.Handler, keyURL string) *Session {
+	return &Session{Algorithm: algorithm, Transport: transportInMemory, Client: newInMemoryClient(handler), KeyURL: keyURL}
+}
+
+// ネットワークを介さずにセッションを実行し、鍵交換（公開鍵の取得とAES鍵のラップ）の所要時間を記録する
+// ネットワーク経由の値との差をネットワークの寄与として記録する
+func measureInMemory(session *Session, aesKey []byte, msg *SealedMessage, network time.Duration) {
+	if session == nil {
+		return
+	}
+
+	res, err := session.Run(aesKey, msg)
+	if err != nil {
+		log.Printf("インメモリ計測に失敗 [%s]: %v", session.Algorithm, err)
+		return
+	}
+	inMemory := res.Timings.Exchange()
+	keyExchangeDuration.WithLabelValues(session.Algorithm, transportInMemory).Set(inMemory.Seconds())
+	networkContribution.WithLabelValues(session.Algorithm).Set((network - inMemory).Seconds())
+}
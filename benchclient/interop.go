@@ -0,0 +1,262 @@
+package benchclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/keyi1000/PQC_grafana/kembench"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	interopChecks = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_interop_checks_total",
+			Help: "Total number of interoperability checks against external KEM endpoints, by target, format and result",
+		},
+		[]string{"target", "format", "result"},
+	)
+	interopDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "client_interop_duration_seconds",
+			Help:    "Histogram of a successful interoperability check in seconds (fetch, encapsulate, send and confirm)",
+			Buckets: []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+		},
+		[]string{"target"},
+	)
+)
+
+// 相互運用性の確認結果
+const (
+	interopSuccess  = "success"
+	interopMismatch = "mismatch" // 共有秘密鍵が一致しない（ワイヤーフォーマットや実装の非互換）
+	interopError    = "error"    // 通信・形式のエラー
+)
+
+// 相互運用性を確認する外部のKEMエンドポイント
+type InteropTarget struct {
+	Name           string // メトリクスのtargetラベル
+	Format         string // ワイヤーフォーマット（json / raw / pem）
+	PublicKeyURL   string // 公開鍵を取得するURL
+	DecapsulateURL string // カプセル化テキストを送るURL
+	KEM            string // kembenchに登録されたKEMの名前（デフォルトはML-KEM-768）
+}
+
+// 指定がない場合に使うKEM（FIPS 203）
+const defaultInteropKEM = "ML-KEM-768"
+
+// "name,format,public-key-url,decapsulate-url[,kem]" 形式の文字列をパースする
+func ParseInteropTarget(s string) (InteropTarget, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 && len(parts) != 5 {
+		return InteropTarget{}, fmt.Errorf("相互運用性の確認先の形式が不正です: %q (name,format,public-key-url,decapsulate-url[,kem])", s)
+	}
+	t := InteropTarget{Name: parts[0], Format: parts[1], PublicKeyURL: parts[2], DecapsulateURL: parts[3], KEM: defaultInteropKEM}
+	if len(parts) == 5 {
+		t.KEM = parts[4]
+	}
+	if _, ok := interopFormats[t.Format]; !ok {
+		return InteropTarget{}, fmt.Errorf("不明なワイヤーフォーマット: %q (json / raw / pem)", t.Format)
+	}
+	if _, ok := kembench.Lookup(t.KEM, ""); !ok {
+		return InteropTarget{}, fmt.Errorf("不明なKEM、またはFIPSモードで使えないKEM: %q", t.KEM)
+	}
+	return t, nil
+}
+
+// ワイヤーフォーマットの変換
+//
+//	json: GET {"public_key": base64, "key_id": ...} / POST {"key_id", "ciphertext": base64} → {"shared_secret_sha256": hex}
+//	      （このリポジトリの/kems/エンドポイントと同じ）
+//	raw:  GET 公開鍵のバイト列（鍵IDはKey-Idヘッダー） / POST カプセル化テキストのバイト列 → 共有秘密鍵のSHA-256（hex）
+//	pem:  GET SubjectPublicKeyInfo（ML-KEMのOID）のPEM / POST・レスポンスはjsonと同じ
+type interopFormat struct {
+	parsePublicKey func(resp *http.Response, body []byte, kemName string) (publicKey []byte, keyID string, err error)
+	encode         func(keyID string, ciphertext []byte) (body []byte, contentType string, header http.Header, err error)
+	parseDigest    func(body []byte) ([]byte, error)
+}
+
+var interopFormats = map[string]interopFormat{
+	"json": {parsePublicKey: parseJSONPublicKey, encode: encodeJSONCiphertext, parseDigest: parseJSONDigest},
+	"raw":  {parsePublicKey: parseRawPublicKey, encode: encodeRawCiphertext, parseDigest: parseHexDigest},
+	"pem":  {parsePublicKey: parsePEMPublicKey, encode: encodeJSONCiphertext, parseDigest: parseJSONDigest},
+}
+
+func parseJSONPublicKey(_ *http.Response, body []byte, _ string) ([]byte, string, error) {
+	var r struct {
+		PublicKey string `json:"public_key"`
+		KeyID     string `json:"key_id"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, "", err
+	}
+	pub, err := base64.StdEncoding.DecodeString(r.PublicKey)
+	return pub, r.KeyID, err
+}
+
+func parseRawPublicKey(resp *http.Response, body []byte, _ string) ([]byte, string, error) {
+	return body, resp.Header.Get("Key-Id"), nil
+}
+
+// ML-KEMのOID（draft-ietf-lamps-kyber-certificates）
+var mlkemOIDs = map[string]asn1.ObjectIdentifier{
+	"ML-KEM-512":  {2, 16, 840, 1, 101, 3, 4, 4, 1},
+	"ML-KEM-768":  {2, 16, 840, 1, 101, 3, 4, 4, 2},
+	"ML-KEM-1024": {2, 16, 840, 1, 101, 3, 4, 4, 3},
+}
+
+func parsePEMPublicKey(resp *http.Response, body []byte, kemName string) ([]byte, string, error) {
+	block, _ := pem.Decode(body)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, "", errors.New("PUBLIC KEYのPEMブロックがありません")
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(block.Bytes, &spki); err != nil {
+		return nil, "", err
+	}
+	if oid, ok := mlkemOIDs[kemName]; !ok || !spki.Algorithm.Algorithm.Equal(oid) {
+		return nil, "", fmt.Errorf("公開鍵のアルゴリズムが%sではありません: %v", kemName, spki.Algorithm.Algorithm)
+	}
+	return spki.PublicKey.RightAlign(), resp.Header.Get("Key-Id"), nil
+}
+
+func encodeJSONCiphertext(keyID string, ct []byte) ([]byte, string, http.Header, error) {
+	body, err := json.Marshal(kembench.DecapsulateRequest{KeyID: keyID, Ciphertext: base64.StdEncoding.EncodeToString(ct)})
+	return body, "application/json", nil, err
+}
+
+func encodeRawCiphertext(keyID string, ct []byte) ([]byte, string, http.Header, error) {
+	header := http.Header{}
+	if keyID != "" {
+		header.Set("Key-Id", keyID)
+	}
+	return ct, "application/octet-stream", header, nil
+}
+
+func parseJSONDigest(body []byte) ([]byte, error) {
+	var r kembench.DecapsulateResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(r.SharedSecretSHA256)
+}
+
+func parseHexDigest(body []byte) ([]byte, error) {
+	return hex.DecodeString(strings.TrimSpace(string(body)))
+}
+
+// 相互運用性を確認する外部エンドポイント（空の場合は実行しない）
+var interopTargets []InteropTarget
+
+// 共有秘密鍵が一致しない
+var errInteropMismatch = errors.New("共有秘密鍵が一致しません")
+
+// すべての確認先でカプセル化を行い、相手の共有秘密鍵と一致するかを確認する
+func runInteropChecks() error {
+	var errs []error
+	for _, t := range interopTargets {
+		start := time.Now()
+		err := checkInterop(t)
+		switch {
+		case err == nil:
+			interopChecks.WithLabelValues(t.Name, t.Format, interopSuccess).Inc()
+			interopDuration.WithLabelValues(t.Name).Observe(time.Since(start).Seconds())
+			fmt.Printf("  相互運用性 %s (%s, %s): ✓ %v\n", t.Name, t.Format, t.KEM, time.Since(start))
+		case errors.Is(err, errInteropMismatch):
+			interopChecks.WithLabelValues(t.Name, t.Format, interopMismatch).Inc()
+			errs = append(errs, atStage("interop", withCategory(categoryCrypto, fmt.Errorf("%s: %w", t.Name, err))))
+		default:
+			interopChecks.WithLabelValues(t.Name, t.Format, interopError).Inc()
+			errs = append(errs, atStage("interop", fmt.Errorf("%s: %w", t.Name, err)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func checkInterop(t InteropTarget) error {
+	format := interopFormats[t.Format]
+	k, ok := kembench.Lookup(t.KEM, "")
+	if !ok {
+		return withCategory(categoryCrypto, fmt.Errorf("FIPSモードで使えないKEM: %s", t.KEM))
+	}
+
+	resp, err := httpClient.Get(t.PublicKeyURL)
+	if err != nil {
+		return withCategory(categoryNetwork, err)
+	}
+	body, err := readInteropResponse(resp)
+	if err != nil {
+		return err
+	}
+	pub, keyID, err := format.parsePublicKey(resp, body, t.KEM)
+	if err != nil {
+		return withCategory(categoryDecode, fmt.Errorf("公開鍵の解析エラー: %w", err))
+	}
+
+	ct, ss, err := k.Encapsulate(pub)
+	if err != nil {
+		return withCategory(categoryCrypto, fmt.Errorf("カプセル化エラー: %w", err))
+	}
+	defer cryptoutil.Zeroize(ss)
+
+	reqBody, contentType, header, err := format.encode(keyID, ct)
+	if err != nil {
+		return withCategory(categoryDecode, err)
+	}
+	req, err := http.NewRequest(http.MethodPost, t.DecapsulateURL, bytes.NewReader(reqBody))
+	if err != nil {
+		return withCategory(categoryNetwork, err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err = httpClient.Do(req)
+	if err != nil {
+		return withCategory(categoryNetwork, err)
+	}
+	body, err = readInteropResponse(resp)
+	if err != nil {
+		return err
+	}
+	digest, err := format.parseDigest(body)
+	if err != nil {
+		return withCategory(categoryDecode, fmt.Errorf("レスポンスの解析エラー: %w", err))
+	}
+
+	expected := sha256.Sum256(ss)
+	if subtle.ConstantTimeCompare(digest, expected[:]) != 1 {
+		return errInteropMismatch
+	}
+	return nil
+}
+
+// ステータスを確認してレスポンスを読み込む
+func readInteropResponse(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, withCategory(categoryNetwork, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, withCategory(categoryServer, fmt.Errorf("HTTPステータスエラー: %d", resp.StatusCode))
+	}
+	return body, nil
+}
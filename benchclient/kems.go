@@ -0,0 +1,37 @@
+package benchclient
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/keyi1000/PQC_grafana/kembench"
+)
+
+// 登録されたKEMで鍵交換を行うサーバーのURL（空の場合は実行しない）
+var kemsURL string
+
+// kembenchに登録されたすべてのKEMについて、サーバーの/kems/エンドポイントと鍵交換を行う
+func runKEMExchanges() error {
+	if kemsURL == "" {
+		return nil
+	}
+	var errs []error
+	for _, k := range kembench.All() {
+		res, err := kembench.Exchange(httpClient, kemsURL, k)
+		if err != nil {
+			errs = append(errs, atStage("kem_exchange", withCategory(kemErrorCategory(err), fmt.Errorf("%s: %w", k.Name(), err))))
+			continue
+		}
+		fmt.Printf("  KEM %-16s 鍵交換 %v（取得 %v / カプセル化 %v / 送信 %v）\n", k.Name(), res.Total, res.Fetch, res.Encapsulate, res.Send)
+	}
+	return errors.Join(errs...)
+}
+
+// 鍵交換の失敗を分類する
+func kemErrorCategory(err error) string {
+	var exErr *kembench.ExchangeError
+	if errors.As(err, &exErr) && (exErr.Stage == "fetch" || exErr.Stage == "send") {
+		return categoryNetwork
+	}
+	return categoryCrypto
+}
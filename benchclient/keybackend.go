@@ -0,0 +1,40 @@
+package benchclient
+
+import (
+	"github.com/keyi1000/PQC_grafana/kms"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	sessionByKeyBackend = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "client_session_duration_by_key_backend_seconds",
+			Help:    "Duration of a key agreement session in seconds, by algorithm and the backend holding the server's private key (local, vault, aws-kms)",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+		},
+		[]string{"algorithm", "backend"},
+	)
+	serverDeriveByKeyBackend = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "client_server_derive_duration_by_key_backend_seconds",
+			Help:    "Server-reported time to recover the AES key and decrypt in seconds (including the network round trip to an external KMS), by algorithm and key backend",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 2, 14),
+		},
+		[]string{"algorithm", "backend"},
+	)
+)
+
+// サーバーの秘密鍵を保持するバックエンド（公開鍵のレスポンスにない場合はプロセス内の鍵）
+func (r *SessionResult) keyBackend() string {
+	if r.KeyBackend == "" {
+		return kms.BackendLocal
+	}
+	return r.KeyBackend
+}
+
+// 秘密鍵のバックエンドごとのセッションとサーバーでの処理の所要時間を記録する
+func observeKeyBackend(algorithm string, res *SessionResult) {
+	backend := res.keyBackend()
+	sessionByKeyBackend.WithLabelValues(algorithm, backend).Observe(res.Timings.Total.Seconds())
+	serverDeriveByKeyBackend.WithLabelValues(algorithm, backend).Observe(res.Timings.ServerDerive.Seconds())
+}
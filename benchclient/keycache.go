@@ -0,0 +1,98 @@
+package benchclient
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	publicKeyCacheTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_public_key_cache_total",
+			Help: "Total number of conditional public key fetches, by result (not_modified when the server answered 304, downloaded otherwise)",
+		},
+		[]string{"algorithm", "result"},
+	)
+	publicKeyFetchDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "client_public_key_fetch_duration_seconds",
+			Help:    "Histogram of the time to fetch a public key in seconds, by result (not_modified, downloaded) to compare conditional requests with full downloads",
+			Buckets: []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1},
+		},
+		[]string{"algorithm", "result"},
+	)
+	publicKeyCacheAge = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_public_key_cache_age_seconds",
+			Help: "Age header of the last public key response served from an HTTP cache in seconds (0 when the response came from the origin)",
+		},
+		[]string{"algorithm"},
+	)
+)
+
+// レスポンスのAgeヘッダー（キャッシュを経由していない場合はfalse）
+func responseAge(resp *http.Response) (time.Duration, bool) {
+	age, err := strconv.Atoi(resp.Header.Get("Age"))
+	if err != nil || age < 0 {
+		return 0, false
+	}
+	return time.Duration(age) * time.Second, true
+}
+
+// 公開鍵をIf-None-Matchを付けて取得し、変わっていなければ前回のレスポンスを使うか
+// nonceを付けて取得する場合はレスポンスが毎回異なるため使わない
+var conditionalKeyFetchEnabled bool
+
+// URLごとの前回の公開鍵のレスポンスとETag
+var keyResponseCache struct {
+	sync.Mutex
+	entries map[string]cachedKeyResponse
+}
+
+type cachedKeyResponse struct {
+	etag     string
+	response PublicKeyResponse
+}
+
+// 公開鍵の取得に付けるIf-None-Matchのヘッダー（前回のレスポンスがなければnil）
+func conditionalKeyHeader(url string) http.Header {
+	keyResponseCache.Lock()
+	defer keyResponseCache.Unlock()
+	entry, ok := keyResponseCache.entries[url]
+	if !ok {
+		return nil
+	}
+	return http.Header{"If-None-Match": []string{entry.etag}}
+}
+
+// 304の場合に前回のレスポンスのコピーを返す（server_timingは含めない）
+func cachedKeyResponseFor(url string) (*PublicKeyResponse, bool) {
+	keyResponseCache.Lock()
+	defer keyResponseCache.Unlock()
+	entry, ok := keyResponseCache.entries[url]
+	if !ok {
+		return nil, false
+	}
+	response := entry.response
+	return &response, true
+}
+
+// ETagの付いたレスポンスを記録する（ETagがなければ前回の記録を消す）
+func storeKeyResponse(url, etag string, response *PublicKeyResponse) {
+	keyResponseCache.Lock()
+	defer keyResponseCache.Unlock()
+	if etag == "" {
+		delete(keyResponseCache.entries, url)
+		return
+	}
+	if keyResponseCache.entries == nil {
+		keyResponseCache.entries = make(map[string]cachedKeyResponse)
+	}
+	entry := cachedKeyResponse{etag: etag, response: *response}
+	entry.response.ServerTiming = nil
+	keyResponseCache.entries[url] = entry
+}
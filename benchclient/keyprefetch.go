@@ -0,0 +1,176 @@
+package benchclient
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	publicKeyCacheLookups = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_public_key_cache_lookups_total",
+			Help: "Total number of public key lookups in the client-side TTL cache, by result (hit, miss, expired)",
+		},
+		[]string{"algorithm", "result"},
+	)
+	publicKeyCacheStaleness = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "client_public_key_cache_staleness_seconds",
+			Help:    "Time since a cached public key (or key set) was fetched from the server when it was used for a session, in seconds",
+			Buckets: []float64{0.5, 1, 2, 5, 10, 30, 60, 120, 300, 600, 1800, 3600},
+		},
+		[]string{"algorithm"},
+	)
+	publicKeyCacheInvalidations = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_public_key_cache_invalidations_total",
+			Help: "Total number of cached public keys dropped before their TTL because the server no longer knew the key ID (unknown_key)",
+		},
+		[]string{"algorithm"},
+	)
+	publicKeyPrefetches = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_public_key_prefetches_total",
+			Help: "Total number of background public key fetches started before the cached key expired, by result (success, failure)",
+		},
+		[]string{"algorithm", "result"},
+	)
+)
+
+// 公開鍵をキャッシュする既定の時間
+const DefaultKeyCacheTTL = time.Minute
+
+// 有効期間のこの割合を過ぎたキャッシュの公開鍵を使ったときに、次の公開鍵をバックグラウンドで取得する
+const keyPrefetchFraction = 0.8
+
+// staticモードの公開鍵をキャッシュする時間（0の場合はセッションごとに取得する）
+var keyCacheTTL time.Duration
+
+// URLごとのキャッシュした公開鍵
+var keyTTLCache struct {
+	sync.Mutex
+	entries map[string]*ttlKeyEntry
+}
+
+type ttlKeyEntry struct {
+	response    PublicKeyResponse
+	version     int
+	fetchedAt   time.Time // サーバーが公開鍵を返した時刻（共有キャッシュを経由した場合はAgeを差し引く）
+	expires     time.Time
+	prefetching bool
+}
+
+// キャッシュした公開鍵を使えるか（nonceを結び付ける場合は毎回取得する）
+func keyCacheUsable() bool {
+	return keyCacheTTL > 0 && !keyNonceEnabled
+}
+
+// 有効期間内のキャッシュした公開鍵を返す
+// 有効期間の残りが少なければ、次のセッションのために公開鍵をバックグラウンドで取得しておく
+func cachedPublicKey(client *http.Client, target, url string) (*PublicKeyResponse, int, bool) {
+	keyTTLCache.Lock()
+	defer keyTTLCache.Unlock()
+	entry, ok := keyTTLCache.entries[url]
+	if !ok {
+		publicKeyCacheLookups.WithLabelValues(target, "miss").Inc()
+		return nil, 0, false
+	}
+	now := time.Now()
+	if !now.Before(entry.expires) {
+		delete(keyTTLCache.entries, url)
+		publicKeyCacheLookups.WithLabelValues(target, "expired").Inc()
+		return nil, 0, false
+	}
+	publicKeyCacheLookups.WithLabelValues(target, "hit").Inc()
+	publicKeyCacheStaleness.WithLabelValues(target).Observe(now.Sub(entry.fetchedAt).Seconds())
+	if !entry.prefetching && now.Sub(entry.fetchedAt) >= time.Duration(float64(entry.expires.Sub(entry.fetchedAt))*keyPrefetchFraction) {
+		entry.prefetching = true
+		go prefetchPublicKey(client, target, url, entry)
+	}
+	response := entry.response
+	return &response, entry.version, true
+}
+
+// 期限が切れる前に公開鍵を取得してキャッシュを置き換える（失敗した場合は期限まで今の公開鍵を使う）
+func prefetchPublicKey(client *http.Client, target, url string, entry *ttlKeyEntry) {
+	if _, _, err := downloadPublicKey(client, target, url); err != nil {
+		publicKeyPrefetches.WithLabelValues(target, "failure").Inc()
+		log.Printf("[%s] 公開鍵の先行取得エラー: %v", target, err)
+		keyTTLCache.Lock()
+		entry.prefetching = false
+		keyTTLCache.Unlock()
+		return
+	}
+	publicKeyPrefetches.WithLabelValues(target, "success").Inc()
+}
+
+// 取得した公開鍵をキャッシュする
+// ephemeralモードの鍵（1回しか使えない）とno-storeのレスポンスはキャッシュせず、max-ageがあれば有効期間をそれ以下にする
+func storeCachedPublicKey(url string, resp *http.Response, response *PublicKeyResponse, version int) {
+	if !keyCacheUsable() || response.KeyMode != "static" {
+		return
+	}
+	cacheControl := resp.Header.Get("Cache-Control")
+	if hasCacheDirective(cacheControl, "no-store") {
+		return
+	}
+	ttl := keyCacheTTL
+	if age := maxAge(cacheControl); age > 0 && age < ttl {
+		ttl = age
+	}
+	fetchedAt := time.Now()
+	if age, cached := responseAge(resp); cached {
+		fetchedAt = fetchedAt.Add(-age)
+	}
+	entry := &ttlKeyEntry{response: *response, version: version, fetchedAt: fetchedAt, expires: fetchedAt.Add(ttl)}
+	entry.response.ServerTiming = nil
+	keyTTLCache.Lock()
+	defer keyTTLCache.Unlock()
+	if keyTTLCache.entries == nil {
+		keyTTLCache.entries = make(map[string]*ttlKeyEntry)
+	}
+	keyTTLCache.entries[url] = entry
+}
+
+// サーバーが鍵IDを知らなかった（unknown_key）場合に、その鍵IDのキャッシュを捨てて次のセッションで取得し直す
+// 鍵の一覧は期限を切らして再検証させる
+func invalidateCachedKey(target, url, keyID string, err error) {
+	var errResp *wire.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Code != wire.ErrorCodeUnknownKey {
+		return
+	}
+	keyTTLCache.Lock()
+	if entry, ok := keyTTLCache.entries[url]; ok && entry.response.KeyID == keyID {
+		delete(keyTTLCache.entries, url)
+		publicKeyCacheInvalidations.WithLabelValues(target).Inc()
+	}
+	keyTTLCache.Unlock()
+	if setURL, ok := keySetURL(url); ok {
+		keySets.Lock()
+		if entry, ok := keySets.entries[setURL]; ok {
+			if _, found := entry.lookup(keyID); found {
+				entry.expires = time.Time{}
+				publicKeyCacheInvalidations.WithLabelValues(target).Inc()
+			}
+		}
+		keySets.Unlock()
+	}
+}
+
+// Cache-Controlにディレクティブがあるか
+func hasCacheDirective(cacheControl, name string) bool {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		d, _, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if strings.EqualFold(d, name) {
+			return true
+		}
+	}
+	return false
+}
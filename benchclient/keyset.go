@@ -0,0 +1,176 @@
+package benchclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	keySetLookups = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_key_set_lookups_total",
+			Help: "Total number of public keys taken from the prefetched key set (GET /keys), by result (cached while fresh, not_modified when revalidated with 304, downloaded, fallback to GET /public-key when the set is empty or unavailable)",
+		},
+		[]string{"algorithm", "result"},
+	)
+	keySetKeys = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_key_set_keys",
+			Help: "Number of public keys in the last key set fetched from GET /keys",
+		},
+		[]string{"algorithm"},
+	)
+)
+
+// 公開鍵を1つずつ取得する代わりにGET /keys の一覧をまとめて取得・キャッシュし、セッションごとに順に使うか
+var keySetEnabled bool
+
+// 一覧が空だった（ephemeralモードの）サーバーに一覧を問い合わせ直すまでの時間
+// その間は毎回の余分な往復を避けて/public-key から取得する
+const emptyKeySetRetry = 30 * time.Second
+
+// 鍵の一覧のURLごとのキャッシュ
+var keySets struct {
+	sync.Mutex
+	entries map[string]*cachedKeySet
+}
+
+type cachedKeySet struct {
+	etag    string
+	version int                 // 一覧のレスポンスで交渉した暗号化データの形式の版
+	keys    []PublicKeyResponse // /public-key と同じ形に変換した公開鍵
+	fetched time.Time           // 一覧をサーバーから取得した（再検証した）時刻
+	expires time.Time           // Cache-Controlのmax-ageによる有効期限（過ぎたらETagで再検証する）
+	next    int
+}
+
+// 鍵IDで一覧の公開鍵を探す
+func (e *cachedKeySet) lookup(keyID string) (PublicKeyResponse, bool) {
+	for _, key := range e.keys {
+		if key.KeyID == keyID {
+			return key, true
+		}
+	}
+	return PublicKeyResponse{}, false
+}
+
+// 公開鍵のURLから鍵の一覧のURLを求める（/public-key で終わらないURLは対象外）
+func keySetURL(keyURL string) (string, bool) {
+	base, ok := strings.CutSuffix(keyURL, "/public-key")
+	return base + "/keys", ok
+}
+
+// 鍵の一覧を使えるか
+// nonceを結び付ける場合と、署名を検証するML-KEMの公開鍵は/public-key から取得する（JWKには署名がないため）
+func keySetUsable(target string) bool {
+	switch {
+	case !keySetEnabled || keyNonceEnabled:
+		return false
+	case target == AlgorithmRSA:
+		return true
+	case target == AlgorithmMLKEM:
+		return !keySignatureEnabled
+	}
+	return false
+}
+
+// 鍵の一覧から次の公開鍵を選ぶ（一覧が空か取得できない場合はfalseで、呼び出し側は/public-key から取得する）
+func keyFromSet(client *http.Client, target, keyURL string) (*PublicKeyResponse, keyFetch, bool) {
+	url, ok := keySetURL(keyURL)
+	if !ok {
+		return nil, keyFetch{}, false
+	}
+	keySets.Lock()
+	defer keySets.Unlock()
+	entry, result := keySets.entries[url], "cached"
+	if entry == nil || !time.Now().Before(entry.expires) {
+		var err error
+		if entry, result, err = fetchKeySet(client, target, url, entry); err != nil {
+			keySetLookups.WithLabelValues(target, "fallback").Inc()
+			log.Printf("[%s] 鍵の一覧を取得できないため公開鍵を個別に取得します: %v", target, err)
+			return nil, keyFetch{}, false
+		}
+	}
+	if len(entry.keys) == 0 {
+		// ephemeralモードのサーバーは一覧を返さない
+		keySetLookups.WithLabelValues(target, "fallback").Inc()
+		return nil, keyFetch{}, false
+	}
+	key := entry.keys[entry.next%len(entry.keys)]
+	entry.next++
+	keySetLookups.WithLabelValues(target, result).Inc()
+	if result == "cached" {
+		publicKeyCacheStaleness.WithLabelValues(target).Observe(time.Since(entry.fetched).Seconds())
+	}
+	return &key, keyFetch{version: entry.version, cached: result == "cached"}, true
+}
+
+// 鍵の一覧を取得する（前回の一覧があればIf-None-Matchを付け、304であれば有効期限だけを延ばす）
+// keySets のロックを保持した状態で呼ぶこと
+func fetchKeySet(client *http.Client, target, url string, prev *cachedKeySet) (*cachedKeySet, string, error) {
+	var header http.Header
+	if prev != nil && prev.etag != "" {
+		header = http.Header{"If-None-Match": []string{prev.etag}}
+	}
+	resp, _, err := tracedRequest(client, target, http.MethodGet, url, nil, withAcceptVersion(header))
+	if err != nil {
+		return nil, "", fmt.Errorf("HTTP GETエラー: %w", err)
+	}
+	defer resp.Body.Close()
+	expires := time.Now().Add(maxAge(resp.Header.Get("Cache-Control")))
+	if resp.StatusCode == http.StatusNotModified && header != nil {
+		prev.fetched, prev.expires = time.Now(), expires
+		return prev, "not_modified", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("HTTPステータスエラー: %d", resp.StatusCode)
+	}
+
+	var set wire.JWKSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, "", fmt.Errorf("JSONデコードエラー: %w", err)
+	}
+	entry := &cachedKeySet{etag: resp.Header.Get("ETag"), version: negotiatedEnvelopeVersion(target, resp), fetched: time.Now(), expires: expires}
+	for _, jwk := range set.Keys {
+		key, err := jwk.PublicKeyResponse()
+		if err != nil {
+			return nil, "", err
+		}
+		entry.keys = append(entry.keys, key)
+	}
+	if len(entry.keys) == 0 {
+		entry.expires = time.Now().Add(emptyKeySetRetry)
+	}
+	keySetKeys.WithLabelValues(target).Set(float64(len(entry.keys)))
+	if keySets.entries == nil {
+		keySets.entries = make(map[string]*cachedKeySet)
+	}
+	keySets.entries[url] = entry
+	return entry, "downloaded", nil
+}
+
+// Cache-Controlのmax-age（no-cache・no-storeや指定がない場合は0で、毎回再検証する）
+func maxAge(cacheControl string) time.Duration {
+	var age time.Duration
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			return 0
+		case "max-age":
+			if n, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && n > 0 {
+				age = time.Duration(n) * time.Second
+			}
+		}
+	}
+	return age
+}
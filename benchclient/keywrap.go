@@ -0,0 +1,117 @@
+package benchclient
+
+import (
+	"crypto/rsa"
+	"io"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/keyi1000/PQC_grafana/entropy"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RSAでAES鍵を直接暗号化する場合のラップ方式のラベル
+const keyWrapRSAOAEP = "rsa-oaep"
+
+var (
+	keyWrapInfo = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_key_wrap_info",
+			Help: "Set to 1 for the AES key transport in use (default: RSA-OAEP directly and AES-256-GCM under the KEM-derived KEK; aes-kw: AES Key Wrap under the KEK)",
+		},
+		[]string{"method"},
+	)
+	keyWrapDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "client_key_wrap_duration_seconds",
+			Help:    "Duration of protecting the AES key once the public key or shared secret is available in seconds (RSA-OAEP, KEK generation plus AES Key Wrap, or KEK derivation plus wrap), by algorithm and wrapping construction",
+			Buckets: []float64{0.000001, 0.0000025, 0.000005, 0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001},
+		},
+		[]string{"algorithm", "method"},
+	)
+	keyWrapSize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_key_wrap_size_bytes",
+			Help: "Size of the protected AES key of the last session in bytes (including the RSA-OAEP encrypted KEK for aes-kw), by algorithm and wrapping construction",
+		},
+		[]string{"algorithm", "method"},
+	)
+)
+
+// AES鍵のラップ方式（aes-gcm・aes-kw、空の場合はRSAは直接暗号化、KEMとECDHはaes-gcm）
+var keyWrapMethod string
+
+// ラップ方式を設定する
+func setKeyWrap(method string) error {
+	if method != "" {
+		if _, err := cryptoutil.NormalizeKeyWrap(method); err != nil {
+			return err
+		}
+	}
+	keyWrapMethod = method
+	keyWrapInfo.Reset()
+	keyWrapInfo.WithLabelValues(keyWrapLabel(AlgorithmRSA)).Set(1)
+	keyWrapInfo.WithLabelValues(keyWrapLabel(AlgorithmMLKEM)).Set(1)
+	return nil
+}
+
+// メトリクスのラベルに使う方式ごとのラップ方式
+func keyWrapLabel(algorithm string) string {
+	if keyWrapMethod == cryptoutil.KeyWrapKW {
+		return cryptoutil.KeyWrapKW
+	}
+	if algorithm == AlgorithmRSA {
+		return keyWrapRSAOAEP
+	}
+	return cryptoutil.KeyWrapGCM
+}
+
+// RSA公開鍵でAES鍵を保護する
+// aes-kwでは使い捨てのKEKをRSA-OAEPで暗号化し、AES鍵はKEKでAESキーラップする（KMSのRSA_AES_KEY_WRAPと同じ構成）
+func wrapRSA(res *SessionResult, publicKey *rsa.PublicKey, aesKey []byte) error {
+	start := time.Now()
+	if keyWrapMethod != cryptoutil.KeyWrapKW {
+		wrapped, err := encryptRSA(publicKey, aesKey)
+		if err != nil {
+			return err
+		}
+		res.WrappedKey = wrapped
+		observeKeyWrap(AlgorithmRSA, res, time.Since(start))
+		return nil
+	}
+
+	kek := make([]byte, 32)
+	if _, err := io.ReadFull(entropy.Reader(entropy.OperationKEK), kek); err != nil {
+		return err
+	}
+	defer zeroize("kek", kek)
+	encryptedKEK, err := encryptRSA(publicKey, kek)
+	if err != nil {
+		return err
+	}
+	wrapped, err := cryptoutil.WrapAESKW(kek, aesKey)
+	if err != nil {
+		return err
+	}
+	res.KeyWrap, res.EncryptedKEK, res.WrappedKey = cryptoutil.KeyWrapKW, encryptedKEK, wrapped
+	observeKeyWrap(AlgorithmRSA, res, time.Since(start))
+	return nil
+}
+
+// KEMまたはECDHの共有秘密鍵から導出したKEKでAES鍵をラップする
+func wrapSharedSecret(algorithm string, res *SessionResult, sharedSecret, aesKey []byte) error {
+	start := time.Now()
+	wrapped, err := cryptoutil.WrapKeyWith(keyWrapMethod, sharedSecret, aesKey)
+	if err != nil {
+		return err
+	}
+	res.KeyWrap, res.WrappedKey = keyWrapMethod, wrapped
+	observeKeyWrap(algorithm, res, time.Since(start))
+	return nil
+}
+
+func observeKeyWrap(algorithm string, res *SessionResult, d time.Duration) {
+	method := keyWrapLabel(algorithm)
+	keyWrapDuration.WithLabelValues(algorithm, method).Observe(d.Seconds())
+	keyWrapSize.WithLabelValues(algorithm, method).Set(float64(len(res.EncryptedKEK) + len(res.WrappedKey)))
+}
@@ -0,0 +1,329 @@
+package benchclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/annotation"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var configReloads = factory.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "client_config_reloads_total",
+		Help: "Total number of runtime configuration reloads, by source (sighup or api) and result",
+	},
+	[]string{"source", "result"},
+)
+
+// 設定の変更元
+const (
+	reloadSourceSIGHUP = "sighup"
+	reloadSourceAPI    = "api"
+)
+
+// メッセージの最大サイズ（バイト）
+const maxPayloadSize = 1 << 20
+
+// 実行中に変更できる設定
+// SIGHUPで設定ファイルを読み直すか、POST /config で変更する（指定しなかった項目はそのまま）
+type LiveConfig struct {
+	Interval    string   `json:"interval,omitempty"`     // 暗号化を実行する間隔（例: "500ms"）
+	PayloadSize *int     `json:"payload_size,omitempty"` // 暗号化するメッセージのバイト数（0の場合は既定のメッセージ）
+	Algorithms  []string `json:"algorithms,omitempty"`   // 実行する経路（rsa / mlkem / dual / ecdh）
+	RSAURL      string   `json:"rsa_url,omitempty"`
+	MLKEMURL    string   `json:"mlkem_url,omitempty"`
+	DualURL     string   `json:"dual_url,omitempty"`
+	ECDHURL     string   `json:"ecdh_url,omitempty"`
+	KEMsURL     string   `json:"kems_url,omitempty"`
+}
+
+// 現在の設定（GET /config のレスポンス）
+type liveSnapshot struct {
+	Interval    string   `json:"interval"`
+	PayloadSize int      `json:"payload_size"`
+	Algorithms  []string `json:"algorithms"`
+	RSAURL      string   `json:"rsa_url"`
+	MLKEMURL    string   `json:"mlkem_url"`
+	DualURL     string   `json:"dual_url"`
+	ECDHURL     string   `json:"ecdh_url"`
+	KEMsURL     string   `json:"kems_url"`
+}
+
+// 実行中の設定
+// 変更はベンチマークのループが暗号化の合間に適用するため、セッションを同時に操作することはない
+var live struct {
+	sync.RWMutex
+	interval    time.Duration
+	payloadSize int
+	algorithms  map[string]bool
+	dualURL     string
+	ecdhURL     string
+	paused      bool
+
+	updates chan LiveConfig
+	runOnce chan struct{} // 管理画面からの1回だけの実行
+}
+
+// 認証トークンのSHA-256（空の場合はPOST /config を受け付けない）
+var adminTokenHash []byte
+
+func initLive(cfg Config) {
+	live.Lock()
+	defer live.Unlock()
+	live.interval = cfg.Interval
+	live.algorithms = map[string]bool{AlgorithmRSA: true, AlgorithmMLKEM: true, AlgorithmDual: true, AlgorithmECDH: true}
+	live.dualURL = cfg.DualURL
+	live.ecdhURL = cfg.ECDHURL
+	live.updates = make(chan LiveConfig, 8)
+	live.runOnce = make(chan struct{}, 1)
+	recordLiveStateLocked()
+	if cfg.AdminToken != "" {
+		h := sha256.Sum256([]byte(cfg.AdminToken))
+		adminTokenHash = h[:]
+	}
+}
+
+// 設定を検証する
+func (c LiveConfig) validate() error {
+	if c.Interval != "" {
+		d, err := time.ParseDuration(c.Interval)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("間隔の形式が不正です: %q", c.Interval)
+		}
+	}
+	if c.PayloadSize != nil && (*c.PayloadSize < 0 || *c.PayloadSize > maxPayloadSize) {
+		return fmt.Errorf("メッセージのサイズは0〜%dバイトで指定してください: %d", maxPayloadSize, *c.PayloadSize)
+	}
+	for _, a := range c.Algorithms {
+		if a != AlgorithmRSA && a != AlgorithmMLKEM && a != AlgorithmDual && a != AlgorithmECDH {
+			return fmt.Errorf("不明な経路: %q (rsa / mlkem / dual / ecdh)", a)
+		}
+	}
+	for _, u := range []string{c.RSAURL, c.MLKEMURL, c.DualURL, c.ECDHURL, c.KEMsURL} {
+		if u == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return fmt.Errorf("URLの形式が不正です: %q", u)
+		}
+	}
+	return nil
+}
+
+// 設定の変更を検証してループに渡す
+func submitLive(c LiveConfig, source string) error {
+	if err := c.validate(); err != nil {
+		configReloads.WithLabelValues(source, "invalid").Inc()
+		return err
+	}
+	select {
+	case live.updates <- c:
+		configReloads.WithLabelValues(source, "success").Inc()
+		return nil
+	default:
+		configReloads.WithLabelValues(source, "busy").Inc()
+		return errors.New("設定の変更が混み合っています")
+	}
+}
+
+// 設定の変更を適用する（ループのゴルーチンから呼ぶ）
+// 間隔が変わった場合はtrueを返す
+func applyLive(c LiveConfig, cfg Config) bool {
+	live.Lock()
+	defer live.Unlock()
+	intervalChanged := false
+	if c.Interval != "" {
+		d, _ := time.ParseDuration(c.Interval)
+		intervalChanged = d != live.interval
+		live.interval = d
+	}
+	if c.PayloadSize != nil {
+		live.payloadSize = *c.PayloadSize
+	}
+	previous := sortedAlgorithms()
+	if len(c.Algorithms) > 0 {
+		live.algorithms = make(map[string]bool)
+		for _, a := range c.Algorithms {
+			live.algorithms[a] = true
+		}
+	}
+	if c.RSAURL != "" {
+		rsaURL = c.RSAURL
+		rsaSession.KeyURL = c.RSAURL
+	}
+	if c.MLKEMURL != "" {
+		mlkemURL = c.MLKEMURL
+		mlkemSession.KeyURL = c.MLKEMURL
+	}
+	if c.DualURL != "" {
+		live.dualURL = c.DualURL
+		if dualSession == nil {
+			dualBreaker = newCircuitBreaker(AlgorithmDual, cfg.BreakerThreshold, cfg.BreakerCooldown)
+			dualSession = &Session{Algorithm: AlgorithmDual, Transport: transportNetwork, Client: httpClient}
+		}
+		dualSession.KeyURL = c.DualURL
+	}
+	if c.ECDHURL != "" {
+		live.ecdhURL = c.ECDHURL
+		if ecdhSession == nil {
+			ecdhBreaker = newCircuitBreaker(AlgorithmECDH, cfg.BreakerThreshold, cfg.BreakerCooldown)
+			ecdhSession = &Session{Algorithm: AlgorithmECDH, Transport: transportNetwork, Client: httpClient}
+		}
+		ecdhSession.KeyURL = c.ECDHURL
+	}
+	if c.KEMsURL != "" {
+		kemsURL = c.KEMsURL
+	}
+	recordLiveStateLocked()
+	summary := fmt.Sprintf("間隔 %v, メッセージ %dバイト, 経路 %v", live.interval, live.payloadSize, sortedAlgorithms())
+	log.Printf("設定を変更しました: %s", summary)
+	if algorithms := sortedAlgorithms(); !slices.Equal(previous, algorithms) {
+		annotation.Post(ServiceName, annotation.EventAlgorithmSwitch, fmt.Sprintf("経路を %v から %v に切り替えました", previous, algorithms))
+	} else {
+		annotation.Post(ServiceName, annotation.EventConfigReload, "設定を変更しました: "+summary)
+	}
+	return intervalChanged
+}
+
+// 経路が有効かを返す
+func algorithmEnabled(algorithm string) bool {
+	live.RLock()
+	defer live.RUnlock()
+	return live.algorithms[algorithm] && !algorithmGated(algorithm)
+}
+
+func sortedAlgorithms() []string {
+	var algorithms []string
+	for _, a := range []string{AlgorithmRSA, AlgorithmMLKEM, AlgorithmDual, AlgorithmECDH} {
+		if live.algorithms[a] && !algorithmGated(a) {
+			algorithms = append(algorithms, a)
+		}
+	}
+	return algorithms
+}
+
+// 現在の間隔
+func liveInterval() time.Duration {
+	live.RLock()
+	defer live.RUnlock()
+	return live.interval
+}
+
+// 暗号化するメッセージ（サイズが指定されている場合はコーパスの代わりにそのバイト数のメッセージ）
+func liveMessage(message Message) Message {
+	live.RLock()
+	defer live.RUnlock()
+	if live.payloadSize == 0 {
+		return message
+	}
+	return Message{Corpus: "payload_size", Text: strings.Repeat("x", live.payloadSize)}
+}
+
+// 設定ファイル（LiveConfigのJSON）を読み込む
+func readLiveConfig(path string) (LiveConfig, error) {
+	var c LiveConfig
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("設定ファイルの形式が不正です: %w", err)
+	}
+	return c, nil
+}
+
+// SIGHUPを受け取るたびに設定ファイルを読み直す
+func watchSIGHUP(ctx context.Context, path string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+		}
+		c, err := readLiveConfig(path)
+		if err == nil {
+			err = submitLive(c, reloadSourceSIGHUP)
+		} else {
+			configReloads.WithLabelValues(reloadSourceSIGHUP, "invalid").Inc()
+		}
+		if err != nil {
+			log.Printf("設定ファイルの再読み込みに失敗: %v", err)
+		}
+	}
+}
+
+// 実行中の設定を参照・変更するHTTPハンドラー
+//
+//	GET  /config 現在の設定
+//	POST /config LiveConfigのJSONで設定を変更する（Authorization: Bearer <admin-token> が必要）
+func ConfigHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			live.RLock()
+			snapshot := liveSnapshot{
+				Interval:    live.interval.String(),
+				PayloadSize: live.payloadSize,
+				Algorithms:  sortedAlgorithms(),
+				RSAURL:      rsaURL,
+				MLKEMURL:    mlkemURL,
+				DualURL:     live.dualURL,
+				ECDHURL:     live.ecdhURL,
+				KEMsURL:     kemsURL,
+			}
+			live.RUnlock()
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(snapshot)
+		case http.MethodPost:
+			if !authorizedAdmin(r) {
+				configReloads.WithLabelValues(reloadSourceAPI, "unauthorized").Inc()
+				http.Error(w, "認証が必要です", http.StatusUnauthorized)
+				return
+			}
+			var c LiveConfig
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&c); err != nil {
+				configReloads.WithLabelValues(reloadSourceAPI, "invalid").Inc()
+				http.Error(w, "リクエストの形式が不正です", http.StatusBadRequest)
+				return
+			}
+			if err := submitLive(c, reloadSourceAPI); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// Bearerトークンを定数時間で確認する（トークンが未設定の場合は常に拒否する）
+func authorizedAdmin(r *http.Request) bool {
+	if adminTokenHash == nil {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	h := sha256.Sum256([]byte(token))
+	return subtle.ConstantTimeCompare(h[:], adminTokenHash) == 1
+}
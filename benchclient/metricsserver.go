@@ -0,0 +1,27 @@
+package benchclient
+
+import (
+	"net/http"
+
+	"github.com/keyi1000/PQC_grafana/internal/httpmw"
+	"github.com/keyi1000/PQC_grafana/metrics"
+)
+
+// クライアントのメトリクスサーバーのリクエスト数・所要時間・パニック（client_metrics_server_http_*）
+var metricsServerMiddleware = httpmw.New(ServiceName, factory, "client_metrics_server_")
+
+// クライアントのメトリクスサーバーのハンドラー（/metrics、/version、/metrics/selfcheck、/config、/admin）
+func MetricsServerMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	for path, h := range map[string]http.Handler{
+		"/metrics":           metrics.Handler(),
+		"/version":           metrics.VersionHandler(),
+		"/metrics/selfcheck": metrics.SelfCheckHandler(),
+		"/config":            ConfigHandler(),
+		"/admin":             AdminHandler(),
+		"/admin/":            AdminHandler(),
+	} {
+		mux.Handle(path, metricsServerMiddleware.Handler(path, h))
+	}
+	return mux
+}
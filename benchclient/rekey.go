@@ -0,0 +1,156 @@
+package benchclient
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	rekeyInterval = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_rekey_interval_messages",
+			Help: "Number of messages sent under one AES key before rekeying (0 when rekey simulation is disabled)",
+		},
+	)
+	rekeysTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_rekeys_total",
+			Help: "Total number of key agreements performed by the rekey simulation",
+		},
+		[]string{"algorithm"},
+	)
+	rekeyMessagesTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_rekey_messages_total",
+			Help: "Total number of messages sent by the rekey simulation",
+		},
+		[]string{"algorithm"},
+	)
+	amortizedMessageCost = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_amortized_message_cost_seconds",
+			Help: "Average per-message cost over the long-lived session in seconds, by component (key_agreement or symmetric)",
+		},
+		[]string{"algorithm", "component"},
+	)
+)
+
+// 長期間のセッションで一定のメッセージ数ごとに鍵を更新するチャネル
+// 鍵合意（公開鍵の取得からサーバーでの確認まで）のコストを、その鍵で送るメッセージ数で割って評価する
+// 鍵の更新の間のメッセージはAESでの暗号化のみを行い、サーバーには送らない（セッション状態を持たないため）
+type rekeyingChannel struct {
+	session *Session
+	breaker *circuitBreaker
+	every   int
+
+	key          []byte
+	rekeys       int // 鍵を更新した回数（AES鍵のサイズを順に切り替える）
+	sinceRekey   int
+	messages     int
+	agreementDur time.Duration
+	symmetricDur time.Duration
+}
+
+// 鍵の更新を模擬するチャネル
+var (
+	rsaChannel   *rekeyingChannel
+	mlkemChannel *rekeyingChannel
+)
+
+func newRekeyingChannel(session *Session, breaker *circuitBreaker, every int) *rekeyingChannel {
+	return &rekeyingChannel{session: session, breaker: breaker, every: every}
+}
+
+// メッセージを1つ送る（必要であれば先に鍵を更新する）
+func (c *rekeyingChannel) send(message Message) error {
+	if c.key == nil || c.sinceRekey >= c.every {
+		return c.breaker.do(func() error { return c.rekey(message) })
+	}
+
+	msg, err := sealMessage([]byte(message.Text), c.key)
+	if err != nil {
+		return atStage(c.session.Algorithm+"_rekey_encrypt", withCategory(categoryCrypto, fmt.Errorf("AES暗号化に失敗: %w", err)))
+	}
+	symmetric := msg.AESEncrypt
+	observeCorpusEncrypt(message, symmetric)
+	observeAESEncrypt(msg)
+	c.symmetricDur += symmetric
+	c.record()
+	return nil
+}
+
+// 新しいAES鍵（サイズは-aes-key-sizesに従う）で鍵合意を行い、最初のメッセージをサーバーで復号できることを確認する
+func (c *rekeyingChannel) rekey(message Message) error {
+	keygenStart := time.Now()
+	key, err := newDataKey(c.rekeys)
+	if err != nil {
+		return atStage("aes_keygen", withCategory(categoryCrypto, fmt.Errorf("AES鍵の生成に失敗: %w", err)))
+	}
+	keygen := time.Since(keygenStart)
+
+	msg, err := sealMessage([]byte(message.Text), key)
+	if err != nil {
+		zeroize("aes_key", key)
+		return atStage("aes_encrypt", withCategory(categoryCrypto, fmt.Errorf("AES暗号化に失敗: %w", err)))
+	}
+	msg.AESKeygen = keygen
+	symmetric := msg.AESEncrypt
+	observeCorpusEncrypt(message, symmetric)
+	observeAESEncrypt(msg)
+
+	res, err := c.session.Run(key, msg)
+	if err != nil {
+		zeroize("aes_key", key)
+		return err
+	}
+	observeSessionKeySize(c.session.Algorithm, msg, res)
+
+	// 古い鍵は不要になるので消去する
+	if c.key != nil {
+		zeroize("aes_key", c.key)
+	}
+	c.key = key
+	c.rekeys++
+	c.sinceRekey = 0
+	c.symmetricDur += symmetric
+	c.agreementDur += res.Timings.Total
+	rekeysTotal.WithLabelValues(c.session.Algorithm).Inc()
+	c.record()
+	return nil
+}
+
+// 償却コストを記録する
+func (c *rekeyingChannel) record() {
+	c.sinceRekey++
+	c.messages++
+	rekeyMessagesTotal.WithLabelValues(c.session.Algorithm).Inc()
+	amortizedMessageCost.WithLabelValues(c.session.Algorithm, "key_agreement").Set(c.agreementDur.Seconds() / float64(c.messages))
+	amortizedMessageCost.WithLabelValues(c.session.Algorithm, "symmetric").Set(c.symmetricDur.Seconds() / float64(c.messages))
+}
+
+// 鍵の更新を模擬しながらメッセージを1つずつ送る
+func runRekeySimulation(counter int, message Message) error {
+	var rsaErr, mlkemErr error
+	if algorithmEnabled(AlgorithmRSA) {
+		rsaErr = rsaChannel.send(message)
+	}
+	if algorithmEnabled(AlgorithmMLKEM) {
+		mlkemErr = mlkemChannel.send(message)
+	}
+	if counter%rsaChannel.every == 0 {
+		fmt.Printf("鍵更新シミュレーション #%d: メッセージあたりの鍵合意コスト RSA %v / ML-KEM %v\n",
+			counter, rsaChannel.amortized(), mlkemChannel.amortized())
+	}
+	return errors.Join(rsaErr, mlkemErr)
+}
+
+// メッセージあたりの鍵合意コスト
+func (c *rekeyingChannel) amortized() time.Duration {
+	if c.messages == 0 {
+		return 0
+	}
+	return c.agreementDur / time.Duration(c.messages)
+}
@@ -0,0 +1,128 @@
+package benchclient
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	loopTickJitter = factory.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "client_loop_tick_jitter_seconds",
+			Help:    "Histogram of the delay between the scheduled start of a loop iteration and its actual start in seconds",
+			Buckets: []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5},
+		},
+	)
+	loopIterationDuration = factory.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "client_loop_iteration_duration_seconds",
+			Help:    "Histogram of the duration of one loop iteration (all operations of a tick) in seconds",
+			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		},
+	)
+	loopDeadlineMisses = factory.NewCounter(
+		prometheus.CounterOpts{
+			Name: "client_loop_deadline_misses_total",
+			Help: "Total number of loop iterations that did not finish before the next scheduled tick",
+		},
+	)
+	loopOverrun = factory.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "client_loop_overrun_seconds",
+			Help:    "Histogram of how far loop iterations that missed their deadline ran past the next scheduled tick in seconds",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		},
+	)
+	loopMissedTicks = factory.NewCounter(
+		prometheus.CounterOpts{
+			Name: "client_loop_missed_ticks_total",
+			Help: "Total number of scheduled ticks that were never run (coalesced by the default scheduler, or dropped beyond the backlog limit by the fixed-rate scheduler)",
+		},
+	)
+	loopBacklog = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_loop_backlog",
+			Help: "Number of scheduled ticks that are due but not yet run (fixed-rate scheduler only)",
+		},
+	)
+)
+
+// 固定レートのスケジューラーで溜める実行予定の上限（これを超えた分は実行せずに捨てる）
+const maxLoopBacklog = 60
+
+// 計測のループの実行予定
+// 既定ではtime.Tickerと同じく、1回の実行が間隔を超えた場合は溜まったティックを1回にまとめる。
+// 固定レートでは予定時刻を間隔ごとに進め、遅れた分を待たずに続けて実行して平均の実行頻度を保つ
+type loopScheduler struct {
+	fixedRate bool
+	interval  time.Duration
+	next      time.Time // 次の実行予定時刻
+	timer     *time.Timer
+}
+
+func newLoopScheduler(interval time.Duration, fixedRate bool) *loopScheduler {
+	return &loopScheduler{
+		fixedRate: fixedRate,
+		interval:  interval,
+		next:      time.Now().Add(interval),
+		timer:     time.NewTimer(interval),
+	}
+}
+
+// 実行予定時刻に値を送るチャネル
+func (s *loopScheduler) C() <-chan time.Time { return s.timer.C }
+
+func (s *loopScheduler) Stop() { s.timer.Stop() }
+
+// 間隔を変えて、今から数え直す
+func (s *loopScheduler) Reset(interval time.Duration) {
+	s.interval = interval
+	s.next = time.Now().Add(interval)
+	s.timer.Reset(interval)
+	loopBacklog.Set(0)
+}
+
+// 予定時刻からの遅れを記録する（実行の開始時に呼ぶ）
+func (s *loopScheduler) start(now time.Time) {
+	loopTickJitter.Observe(max(now.Sub(s.next), 0).Seconds())
+}
+
+// 実行の終了を記録し、次の実行予定を決める
+// 一時停止中のティックのように実行しなかった場合はranをfalseにする
+func (s *loopScheduler) finish(started, now time.Time, ran bool) {
+	deadline := s.next.Add(s.interval)
+	if ran {
+		loopIterationDuration.Observe(now.Sub(started).Seconds())
+		if now.After(deadline) {
+			loopDeadlineMisses.Inc()
+			loopOverrun.Observe(now.Sub(deadline).Seconds())
+		}
+	}
+
+	// 予定時刻を過ぎたティックの数（次の予定時刻を含む）
+	var due int
+	if !now.Before(deadline) {
+		due = int(now.Sub(deadline)/s.interval) + 1
+	}
+	switch {
+	case due == 0:
+		s.next = deadline
+	case s.fixedRate:
+		// 遅れた分は続けて実行し、上限を超えた分だけ捨てる
+		if due > maxLoopBacklog {
+			loopMissedTicks.Add(float64(due - maxLoopBacklog))
+			deadline = deadline.Add(time.Duration(due-maxLoopBacklog) * s.interval)
+			due = maxLoopBacklog
+		}
+		s.next = deadline
+	default:
+		// time.Tickerと同じく、最後のティックだけを残して続けて実行する
+		loopMissedTicks.Add(float64(due - 1))
+		s.next = deadline.Add(time.Duration(due-1) * s.interval)
+	}
+	if s.fixedRate {
+		loopBacklog.Set(float64(due))
+	}
+	s.timer.Reset(max(s.next.Sub(now), 0))
+}
@@ -0,0 +1,26 @@
+package benchclient
+
+import "net/http"
+
+// サーバーのロールによる認可（-auth-token）に送るBearerトークン（空の場合は送らない）
+var serverToken string
+
+// すべてのリクエストにAuthorizationを付けるRoundTripper
+type bearerTransport struct {
+	base  http.RoundTripper
+	token string
+}
+
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(req)
+}
+
+// トークンが設定されていればbaseのリクエストにトークンを付ける
+func withServerToken(base http.RoundTripper) http.RoundTripper {
+	if serverToken == "" {
+		return base
+	}
+	return &bearerTransport{base: base, token: serverToken}
+}
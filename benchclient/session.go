@@ -0,0 +1,316 @@
+package benchclient
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 鍵交換の方式
+const (
+	AlgorithmRSA   = "rsa"
+	AlgorithmMLKEM = "mlkem"
+	AlgorithmDual  = "dual" // RSAとML-KEMの二重保護
+	AlgorithmECDH  = "ecdh" // P-256のECDH（ephemeral-static）
+)
+
+var (
+	sessionDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "client_session_duration_seconds",
+			Help:    "Duration of a complete key agreement session (fetch, wrap, send, server derive, confirm) in seconds",
+			Buckets: []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+		},
+		[]string{"algorithm", "transport"},
+	)
+	sessionPhaseDuration = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_session_phase_duration_seconds",
+			Help: "Duration of each phase of the latest key agreement session in seconds",
+		},
+		[]string{"algorithm", "transport", "phase"},
+	)
+	sessionsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_sessions_total",
+			Help: "Total number of key agreement sessions, by result",
+		},
+		[]string{"algorithm", "transport", "result"},
+	)
+)
+
+// AES鍵で暗号化済みのメッセージ
+type SealedMessage struct {
+	Plaintext  []byte
+	Ciphertext []byte
+	IV         []byte
+	MAC        []byte
+	Algorithm  string // 暗号化データのalgorithm（データ暗号化方式、空の場合はAES-256-CBC + HMAC-SHA256）
+
+	AESKeygen  time.Duration // AES鍵の生成にかかった時間
+	AESEncrypt time.Duration // AES暗号化にかかった時間
+}
+
+// セッションの各フェーズの所要時間
+type SessionTimings struct {
+	Fetch        time.Duration // 公開鍵の取得
+	Wrap         time.Duration // AES鍵の暗号化・カプセル化
+	Send         time.Duration // 暗号化データの送信と応答の受信（サーバーの処理時間を除く）
+	ServerDerive time.Duration // サーバーでの鍵の導出と復号
+	Confirm      time.Duration // 復号結果の確認
+	Total        time.Duration
+
+	// 処理ごとの内訳
+	KeyParse       time.Duration // 公開鍵のデコード（Fetchに含まれる）
+	KeyVerify      time.Duration // 公開鍵の署名の検証（署名鍵の取得を含む、Fetchに含まれる）
+	RSAWrap        time.Duration // RSA-OAEPによる暗号化（Wrapに含まれる）
+	KEMEncapsulate time.Duration // ML-KEMのカプセル化と共有秘密鍵によるラップ（Wrapに含まれる）
+	ECDHDerive     time.Duration // ECDHの一時鍵の生成、共有秘密鍵の導出とラップ（Wrapに含まれる）
+	Marshal        time.Duration // 暗号化データのJSONエンコード（Sendに含まれる）
+	Post           time.Duration // 暗号化データのPOST（サーバーの処理時間を含む往復）
+
+	KeyCached bool // 公開鍵をキャッシュから使った（Fetchにネットワークの時間を含まない）
+}
+
+// 鍵交換の所要時間（公開鍵の取得と鍵のラップのみ）
+func (t SessionTimings) Exchange() time.Duration {
+	return t.Fetch + t.Wrap
+}
+
+// セッションの結果
+type SessionResult struct {
+	KeyID              string
+	PublicKeyBytes     []byte // 取得した公開鍵
+	WrappedKey         []byte // 暗号化されたAES鍵（ML-KEMの場合は共有秘密鍵でラップしたAES鍵）
+	KEMCiphertext      []byte // ML-KEMのカプセル化テキスト（RSAの場合はnil）
+	EphemeralPublicKey []byte // ECDHの一時公開鍵（ECDH以外の場合はnil）
+	KeyWrap            string // AES鍵のラップ方式（空の場合は既定）
+	EncryptedKEK       []byte // RSA-OAEPで暗号化したKEK（RSAでaes-kwを使う場合のみ）
+	EnvelopeVersion    int    // サーバーと交渉した暗号化データの形式の版（0の場合はversionを送らない）
+	KeyBackend         string // サーバーの秘密鍵を保持するバックエンド（RSAサーバーのみ、空の場合はlocal）
+	Timings            SessionTimings
+}
+
+// 1回の鍵合意（公開鍵の取得 → 鍵のカプセル化 → 送信 → サーバーでの導出 → 確認）を
+// 1つの計測単位として実行する
+type Session struct {
+	Algorithm string // rsa / mlkem / dual / ecdh
+	Transport string // メトリクスのラベル（network / inmemory）
+	Client    *http.Client
+	KeyURL    string // 公開鍵を取得するURL
+}
+
+// セッションを実行し、各フェーズの所要時間を記録する
+func (s *Session) Run(aesKey []byte, msg *SealedMessage) (*SessionResult, error) {
+	res, err := s.run(aesKey, msg)
+	recordSessionResult(s, res, err)
+	if err != nil {
+		sessionsTotal.WithLabelValues(s.Algorithm, s.Transport, "failure").Inc()
+		return nil, err
+	}
+	sessionsTotal.WithLabelValues(s.Algorithm, s.Transport, "success").Inc()
+	metrics.MarkFirstOperation()
+	sessionDuration.WithLabelValues(s.Algorithm, s.Transport).Observe(res.Timings.Total.Seconds())
+	observeKeyBackend(s.Algorithm, res)
+	for phase, d := range map[string]time.Duration{
+		"fetch":         res.Timings.Fetch,
+		"wrap":          res.Timings.Wrap,
+		"send":          res.Timings.Send,
+		"server_derive": res.Timings.ServerDerive,
+		"confirm":       res.Timings.Confirm,
+	} {
+		sessionPhaseDuration.WithLabelValues(s.Algorithm, s.Transport, phase).Set(d.Seconds())
+	}
+	recordPhases(s.Algorithm, s.Transport, msg, res.Timings)
+	if calibrationEnabled {
+		s.calibrate(res, msg)
+	}
+	return res, nil
+}
+
+func (s *Session) run(aesKey []byte, msg *SealedMessage) (*SessionResult, error) {
+	start := time.Now()
+	res, err := s.exchange(aesKey)
+	if err != nil {
+		return nil, err
+	}
+
+	path := "/decrypt"
+	if s.Algorithm == AlgorithmMLKEM {
+		path = "/decapsulate"
+	}
+	decryptURL, err := endpointURL(s.KeyURL, path)
+	if err != nil {
+		return nil, atStage(s.Algorithm+"_decrypt", withCategory(categoryNetwork, fmt.Errorf("復号URLの作成エラー: %w", err)))
+	}
+
+	sendStart := time.Now()
+	data, err := res.encryptedData(msg)
+	if err != nil {
+		return nil, atStage(s.Algorithm+"_decrypt", withCategory(categoryCrypto, err))
+	}
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, atStage(s.Algorithm+"_decrypt", withCategory(categoryDecode, fmt.Errorf("JSONエンコードエラー: %w", err)))
+	}
+	res.Timings.Marshal = time.Since(sendStart)
+	postStart := time.Now()
+	decResp, err := sendEncryptedData(s.Client, s.Algorithm, decryptURL, &data, body)
+	if err != nil {
+		invalidateCachedKey(s.Algorithm, s.KeyURL, res.KeyID, err)
+		return nil, atStage(s.Algorithm+"_decrypt", fmt.Errorf("サーバーでの復号に失敗: %w", err))
+	}
+	res.Timings.Post = time.Since(postStart)
+	roundTrip := time.Since(sendStart)
+	if decResp.ServerTiming != nil {
+		res.Timings.ServerDerive = time.Duration(decResp.ServerTiming.ProcessingNanos)
+	}
+	res.Timings.Send = max(roundTrip-res.Timings.ServerDerive, 0)
+
+	confirmStart := time.Now()
+	if err := verifyPlaintextDigest(s.Algorithm, decResp, msg.Plaintext); err != nil {
+		return nil, atStage(s.Algorithm+"_confirm", err)
+	}
+	res.Timings.Confirm = time.Since(confirmStart)
+	res.Timings.Total = time.Since(start)
+	return res, nil
+}
+
+// 公開鍵を取得してAES鍵を保護する（サーバーには送らない）
+func (s *Session) exchange(aesKey []byte) (*SessionResult, error) {
+	switch s.Algorithm {
+	case AlgorithmRSA:
+		return s.exchangeRSA(aesKey)
+	case AlgorithmMLKEM:
+		return s.exchangeMLKEM(aesKey)
+	case AlgorithmDual:
+		return s.exchangeDual(aesKey)
+	case AlgorithmECDH:
+		return s.exchangeECDH(aesKey)
+	}
+	return nil, fmt.Errorf("不明な鍵交換方式: %q", s.Algorithm)
+}
+
+// RSA公開鍵を取得し、AES鍵をRSAで暗号化する
+func (s *Session) exchangeRSA(aesKey []byte) (*SessionResult, error) {
+	fetchStart := time.Now()
+	pubKeyResp, fetched, err := fetchPublicKey(s.Client, AlgorithmRSA, s.KeyURL)
+	if err != nil {
+		return nil, atStage("rsa_fetch", fmt.Errorf("RSA公開鍵の取得に失敗: %w", err))
+	}
+	parseStart := time.Now()
+	publicKey, pubKeyBytes, err := parseRSAPublicKey(pubKeyResp.PublicKey)
+	if err != nil {
+		return nil, atStage("rsa_fetch", fmt.Errorf("RSA公開鍵の取得に失敗: %w", err))
+	}
+	res := &SessionResult{KeyID: pubKeyResp.KeyID, PublicKeyBytes: pubKeyBytes, EnvelopeVersion: fetched.version, KeyBackend: pubKeyResp.KeyBackend}
+	res.Timings.KeyCached = fetched.cached
+	res.Timings.KeyParse = time.Since(parseStart)
+	res.Timings.Fetch = time.Since(fetchStart)
+
+	wrapStart := time.Now()
+	if err := wrapRSA(res, publicKey, aesKey); err != nil {
+		return nil, atStage("rsa_encrypt", withCategory(categoryCrypto, fmt.Errorf("RSA暗号化に失敗: %w", err)))
+	}
+	res.Timings.Wrap = time.Since(wrapStart)
+	res.Timings.RSAWrap = res.Timings.Wrap
+	return res, nil
+}
+
+// ML-KEM公開鍵を取得してカプセル化し、共有秘密鍵でAES鍵をラップする
+func (s *Session) exchangeMLKEM(aesKey []byte) (*SessionResult, error) {
+	fetchStart := time.Now()
+	pubKeyResp, fetched, err := fetchPublicKey(s.Client, AlgorithmMLKEM, s.KeyURL)
+	if err != nil {
+		return nil, atStage("mlkem_fetch", fmt.Errorf("ML-KEM公開鍵の取得に失敗: %w", err))
+	}
+	parseStart := time.Now()
+	publicKey, pubKeyBytes, err := parseMLKEMPublicKey(pubKeyResp.PublicKey)
+	if err != nil {
+		return nil, atStage("mlkem_fetch", fmt.Errorf("ML-KEM公開鍵の取得に失敗: %w", err))
+	}
+	res := &SessionResult{KeyID: pubKeyResp.KeyID, PublicKeyBytes: pubKeyBytes, EnvelopeVersion: fetched.version}
+	res.Timings.KeyCached = fetched.cached
+	res.Timings.KeyParse = time.Since(parseStart)
+	// 署名を検証できない公開鍵にはカプセル化しない
+	if keySignatureEnabled {
+		verifyStart := time.Now()
+		if err := verifyKeySignature(s.Client, AlgorithmMLKEM, s.KeyURL, pubKeyResp, pubKeyBytes); err != nil {
+			return nil, atStage("mlkem_verify", fmt.Errorf("ML-KEM公開鍵の署名の検証に失敗: %w", err))
+		}
+		res.Timings.KeyVerify = time.Since(verifyStart)
+	}
+	res.Timings.Fetch = time.Since(fetchStart)
+
+	wrapStart := time.Now()
+	var sharedSecret []byte
+	res.KEMCiphertext, sharedSecret, err = encryptMLKEM(publicKey, aesKey)
+	if err != nil {
+		return nil, atStage("mlkem_encapsulate", withCategory(categoryCrypto, fmt.Errorf("ML-KEM暗号化に失敗: %w", err)))
+	}
+	// 使い終わった共有秘密鍵は消去する
+	err = wrapSharedSecret(AlgorithmMLKEM, res, sharedSecret, aesKey)
+	zeroize("shared_secret", sharedSecret)
+	if err != nil {
+		return nil, atStage("mlkem_wrap", withCategory(categoryCrypto, fmt.Errorf("AES鍵のラップに失敗: %w", err)))
+	}
+	res.Timings.Wrap = time.Since(wrapStart)
+	res.Timings.KEMEncapsulate = res.Timings.Wrap
+	return res, nil
+}
+
+// 鍵の受け渡しに使う暗号文（RSAは暗号化したAES鍵またはKEK、ML-KEMはカプセル化テキスト、ECDHは一時公開鍵）
+func (r *SessionResult) EncapsulatedKey() []byte {
+	if r.EphemeralPublicKey != nil {
+		return r.EphemeralPublicKey
+	}
+	if r.KEMCiphertext != nil {
+		return r.KEMCiphertext
+	}
+	if r.EncryptedKEK != nil {
+		return r.EncryptedKEK
+	}
+	return r.WrappedKey
+}
+
+// 鍵の受け渡しに送るデータの合計サイズ
+func (r *SessionResult) KeyMaterialSize() int {
+	return len(r.KEMCiphertext) + len(r.EphemeralPublicKey) + len(r.EncryptedKEK) + len(r.WrappedKey)
+}
+
+// サーバーに送る暗号化データを組み立てる
+func (r *SessionResult) encryptedData(msg *SealedMessage) (EncryptedData, error) {
+	data := EncryptedData{
+		Version:          r.EnvelopeVersion,
+		KeyID:            r.KeyID,
+		Algorithm:        msg.algorithm(),
+		EncryptedAESKey:  base64.StdEncoding.EncodeToString(r.WrappedKey),
+		EncryptedMessage: base64.StdEncoding.EncodeToString(msg.Ciphertext),
+		IV:               base64.StdEncoding.EncodeToString(msg.IV),
+		MAC:              base64.StdEncoding.EncodeToString(msg.MAC),
+		KeyWrap:          r.KeyWrap,
+	}
+	if r.EncryptedKEK != nil {
+		data.EncryptedKEK = base64.StdEncoding.EncodeToString(r.EncryptedKEK)
+	}
+	if r.KEMCiphertext != nil {
+		data.KEMCiphertext = base64.StdEncoding.EncodeToString(r.KEMCiphertext)
+	}
+	if r.EphemeralPublicKey != nil {
+		data.EphemeralPublicKey = base64.StdEncoding.EncodeToString(r.EphemeralPublicKey)
+	}
+	// 再送の検出に使うnonceと作成時刻は版を交渉したサーバーにだけ送る（古いサーバーは未知のフィールドとして拒否するため）
+	if r.EnvelopeVersion > 0 {
+		nonce, err := newRequestNonce()
+		if err != nil {
+			return EncryptedData{}, fmt.Errorf("request_nonceの生成エラー: %w", err)
+		}
+		data.RequestNonce, data.Timestamp = nonce, time.Now().UnixMilli()
+	}
+	return data, nil
+}
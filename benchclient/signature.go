@@ -0,0 +1,154 @@
+package benchclient
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/circl/sign/mldsa/mldsa65"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	keySignatureVerifyDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "client_key_signature_verify_duration_seconds",
+			Help:    "Histogram of the time to verify the server's ML-DSA-65 signature on a public key response in seconds",
+			Buckets: []float64{0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025},
+		},
+		[]string{"algorithm"},
+	)
+	keySignatureVerifications = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_key_signature_verifications_total",
+			Help: "Total number of public key signature verifications, by result (ok, invalid, missing, no_signing_key)",
+		},
+		[]string{"algorithm", "result"},
+	)
+	authenticatedKeySize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_authenticated_key_size_bytes",
+			Help: "Size of a signed public key as received by the client, by component (public_key, signature, total)",
+		},
+		[]string{"algorithm", "component"},
+	)
+)
+
+// 公開鍵のレスポンスの署名をカプセル化の前に検証するか
+var keySignatureEnabled bool
+
+// 署名鍵を取得した接続先（インメモリ計測のハンドラーはネットワーク上のサーバーと別の鍵を持つ）
+type signingKeySource struct {
+	client *http.Client
+	keyURL string
+}
+
+// 署名の検証に使うサーバーの署名鍵
+// 固定の鍵が指定されていない場合は、最初に/signing-keyから取得した鍵を信頼し、以降は同じ鍵で検証する
+var signingKeys = struct {
+	sync.Mutex
+	pinned   *mldsa65.PublicKey
+	bySource map[signingKeySource]*mldsa65.PublicKey
+}{bySource: map[signingKeySource]*mldsa65.PublicKey{}}
+
+// 固定の署名鍵（Base64）を設定する
+func pinSigningKey(encoded string) error {
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("署名鍵のBase64デコードエラー: %w", err)
+	}
+	var pub mldsa65.PublicKey
+	if err := pub.UnmarshalBinary(b); err != nil {
+		return fmt.Errorf("署名鍵のパースエラー: %w", err)
+	}
+	signingKeys.Lock()
+	signingKeys.pinned = &pub
+	signingKeys.Unlock()
+	return nil
+}
+
+// 公開鍵のURLに対応する署名鍵を返す（未取得の場合は同じサーバーの/signing-keyから取得する）
+func signingKeyFor(client *http.Client, keyURL string) (*mldsa65.PublicKey, error) {
+	signingKeys.Lock()
+	defer signingKeys.Unlock()
+	if signingKeys.pinned != nil {
+		return signingKeys.pinned, nil
+	}
+	source := signingKeySource{client, keyURL}
+	if pub, ok := signingKeys.bySource[source]; ok {
+		return pub, nil
+	}
+	resp, err := client.Get(strings.TrimSuffix(keyURL, "/public-key") + "/signing-key")
+	if err != nil {
+		return nil, withCategory(categoryNetwork, fmt.Errorf("署名鍵の取得エラー: %w", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, withCategory(categoryServer, fmt.Errorf("署名鍵の取得でHTTPステータスエラー: %d", resp.StatusCode))
+	}
+	var keyResp wire.SigningKeyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&keyResp); err != nil {
+		return nil, withCategory(categoryDecode, fmt.Errorf("署名鍵のJSONデコードエラー: %w", err))
+	}
+	if keyResp.Algorithm != wire.SignatureAlgorithmMLDSA65 {
+		return nil, withCategory(categoryServer, fmt.Errorf("対応していない署名方式です: %q", keyResp.Algorithm))
+	}
+	b, err := base64.StdEncoding.DecodeString(keyResp.PublicKey)
+	if err != nil {
+		return nil, withCategory(categoryDecode, fmt.Errorf("署名鍵のBase64デコードエラー: %w", err))
+	}
+	var pub mldsa65.PublicKey
+	if err := pub.UnmarshalBinary(b); err != nil {
+		return nil, withCategory(categoryDecode, fmt.Errorf("署名鍵のパースエラー: %w", err))
+	}
+	signingKeys.bySource[source] = &pub
+	return &pub, nil
+}
+
+// 公開鍵のレスポンスの署名を検証する
+// publicKeyはデコードした公開鍵で、nonceを送った場合はnonceも署名の対象に含まれる
+func verifyKeySignature(client *http.Client, target, keyURL string, resp *PublicKeyResponse, publicKey []byte) error {
+	signingKey, err := signingKeyFor(client, keyURL)
+	if err != nil {
+		keySignatureVerifications.WithLabelValues(target, "no_signing_key").Inc()
+		return err
+	}
+	start := time.Now()
+	result, sigSize, err := checkKeySignature(signingKey, resp, publicKey)
+	keySignatureVerifyDuration.WithLabelValues(target).Observe(time.Since(start).Seconds())
+	keySignatureVerifications.WithLabelValues(target, result).Inc()
+	if err != nil {
+		return err
+	}
+	authenticatedKeySize.WithLabelValues(target, "public_key").Set(float64(len(publicKey)))
+	authenticatedKeySize.WithLabelValues(target, "signature").Set(float64(sigSize))
+	authenticatedKeySize.WithLabelValues(target, "total").Set(float64(len(publicKey) + sigSize))
+	return nil
+}
+
+func checkKeySignature(signingKey *mldsa65.PublicKey, resp *PublicKeyResponse, publicKey []byte) (string, int, error) {
+	if resp.Signature == "" {
+		return "missing", 0, withCategory(categoryServer, fmt.Errorf("公開鍵に署名がありません"))
+	}
+	if resp.SignatureAlgorithm != wire.SignatureAlgorithmMLDSA65 {
+		return "invalid", 0, withCategory(categoryServer, fmt.Errorf("対応していない署名方式です: %q", resp.SignatureAlgorithm))
+	}
+	sig, errSig := base64.StdEncoding.DecodeString(resp.Signature)
+	var nonce []byte
+	var errNonce error
+	if resp.Nonce != "" {
+		nonce, errNonce = base64.StdEncoding.DecodeString(resp.Nonce)
+	}
+	if errSig != nil || errNonce != nil {
+		return "invalid", 0, withCategory(categoryDecode, fmt.Errorf("署名またはnonceのBase64デコードエラー"))
+	}
+	if !mldsa65.Verify(signingKey, wire.KeyBinding(nonce, resp.KeyID, publicKey), []byte(wire.SignatureContext), sig) {
+		return "invalid", len(sig), withCategory(categoryCrypto, fmt.Errorf("公開鍵の署名が一致しません（公開鍵の破損または差し替えの可能性）"))
+	}
+	return "ok", len(sig), nil
+}
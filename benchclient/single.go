@@ -0,0 +1,26 @@
+package benchclient
+
+import (
+	"fmt"
+	"sync"
+)
+
+var singleClientOnce sync.Once
+
+// 1回のセッション（公開鍵の取得から復号の確認まで）を実行する
+// サーバーレス関数のように1回の呼び出しで1回だけ計測する場合に使う（計測のループとは同時に使わない）
+func RunSingle(algorithm, keyURL string, size int) (*SessionResult, error) {
+	switch algorithm {
+	case AlgorithmRSA, AlgorithmMLKEM, AlgorithmDual, AlgorithmECDH:
+	default:
+		return nil, fmt.Errorf("不明な鍵交換方式: %q (rsa / mlkem / dual / ecdh)", algorithm)
+	}
+	singleClientOnce.Do(func() {
+		if httpClient == nil {
+			configureHTTPClient(false, nil, nil)
+		}
+	})
+	session := &Session{Algorithm: algorithm, Transport: transportNetwork, Client: httpClient, KeyURL: keyURL}
+	res, _, err := runVerifySession(session, size, 0)
+	return res, err
+}
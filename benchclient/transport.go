@@ -0,0 +1,228 @@
+package benchclient
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/netem"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// 接続確立フェーズごとの所要時間（DNS / TCP接続 / TLSハンドシェイク）
+	connectionSetupDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "client_connection_setup_duration_seconds",
+			Help:    "Duration of connection setup phases (dns, connect, tls) in seconds",
+			Buckets: []float64{0.0001, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25},
+		},
+		[]string{"target", "phase"},
+	)
+	connectionsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_connections_total",
+			Help: "Total number of connections used for key fetches, by whether they were reused",
+		},
+		[]string{"target", "reused"},
+	)
+	serverProcessingDuration = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_server_processing_duration_seconds",
+			Help: "Server-side processing time reported by the server (monotonic clock) in seconds",
+		},
+		[]string{"target"},
+	)
+	networkTransitDuration = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_network_transit_duration_seconds",
+			Help: "Round-trip network transit time excluding server processing in seconds",
+		},
+		[]string{"target"},
+	)
+	oneWayLatencyEstimate = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_one_way_latency_estimate_seconds",
+			Help: "Estimated one-way network latency (half of round-trip transit) in seconds",
+		},
+		[]string{"target"},
+	)
+	clockOffsetEstimate = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_clock_offset_estimate_seconds",
+			Help: "Estimated clock offset of the server relative to the client (NTP-style) in seconds",
+		},
+		[]string{"target"},
+	)
+	connectionFamilies = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_connections_by_address_family_total",
+			Help: "Total number of new connections used for key fetches, by address family (ipv4, ipv6, unix)",
+		},
+		[]string{"target", "family"},
+	)
+	keyFetchDuration = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_key_fetch_duration_seconds",
+			Help: "Duration of public key fetch (network and server time) in seconds",
+		},
+		[]string{"target"},
+	)
+)
+
+// 公開鍵取得に使うHTTPクライアント
+var httpClient = http.DefaultClient
+
+// 接続の再利用方法を設定する
+// newConnPerRequestがtrueの場合はKeep-Aliveを無効化し、リクエストごとに新しい接続を張る
+// emがnilでない場合は、接続に人工的な遅延とパケットロスを加える
+// unixSocketsのホストへの接続はUnixドメインソケットに向ける
+func configureHTTPClient(newConnPerRequest bool, em *netem.Emulator, unixSockets map[string]string) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableKeepAlives = newConnPerRequest
+	transport.DialContext = em.Dial(unixSocketDial(unixSockets, transport.DialContext))
+	httpClient = &http.Client{
+		Transport: withServerToken(transport),
+		Timeout:   10 * time.Second,
+	}
+}
+
+// サーバーが返すタイムスタンプ
+type ServerTiming = wire.ServerTiming
+
+// クライアント側で計測したリクエストの送信完了時刻と最初のレスポンス受信時刻
+type requestTiming struct {
+	wroteRequest time.Time
+	firstByte    time.Time
+}
+
+// サーバーのタイムスタンプと組み合わせて、サーバー処理時間とネットワーク転送時間を分離して記録する
+// 往復時間は単調時計で計測するため、時計のずれは時計オフセットの推定値にのみ影響する
+func recordServerTiming(target string, timing *requestTiming, st *ServerTiming) {
+	if st == nil || timing.wroteRequest.IsZero() || timing.firstByte.IsZero() {
+		return
+	}
+
+	roundTrip := timing.firstByte.Sub(timing.wroteRequest)
+	processing := time.Duration(st.ProcessingNanos)
+	transit := roundTrip - processing
+	if transit < 0 {
+		transit = 0
+	}
+
+	serverProcessingDuration.WithLabelValues(target).Set(processing.Seconds())
+	networkTransitDuration.WithLabelValues(target).Set(transit.Seconds())
+	oneWayLatencyEstimate.WithLabelValues(target).Set((transit / 2).Seconds())
+
+	// NTP方式: offset = ((t2 - t1) + (t3 - t4)) / 2
+	t1 := timing.wroteRequest.UnixNano()
+	t4 := timing.firstByte.UnixNano()
+	offset := float64((st.ReceivedAtUnixNano-t1)+(st.RespondedAtUnixNano-t4)) / 2
+	clockOffsetEstimate.WithLabelValues(target).Set(offset / float64(time.Second))
+}
+
+// 接続確立フェーズの開始時刻を記録する
+// Happy Eyeballsでは複数アドレスへのダイヤルが並行して走り、トレースのコールバックが
+// 別々のgoroutineから呼ばれるため、開始時刻はフェーズとアドレスごとにロックを取って保持する
+type phaseTimer struct {
+	mu     sync.Mutex
+	starts map[string]time.Time
+}
+
+func (t *phaseTimer) start(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.starts == nil {
+		t.starts = make(map[string]time.Time)
+	}
+	t.starts[key] = time.Now()
+}
+
+// 開始時刻からの経過時間を返して記録を消す（開始が記録されていなければok=false）
+func (t *phaseTimer) done(key string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	started, ok := t.starts[key]
+	if !ok {
+		return 0, false
+	}
+	delete(t.starts, key)
+	return time.Since(started), true
+}
+
+// httptraceで接続確立の各フェーズを計測しながらGETリクエストを送信
+func tracedGet(client *http.Client, target, url string) (*http.Response, *requestTiming, error) {
+	return tracedRequest(client, target, http.MethodGet, url, nil, nil)
+}
+
+// httptraceで接続確立の各フェーズを計測しながらリクエストを送信（bodyがある場合はJSONとして送る）
+// headerはリクエストに加えるヘッダー（nilでもよい）
+func tracedRequest(client *http.Client, target, method, url string, body []byte, header http.Header) (*http.Response, *requestTiming, error) {
+	var phases phaseTimer
+	timing := &requestTiming{}
+
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { phases.start("dns") },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			if elapsed, ok := phases.done("dns"); ok {
+				connectionSetupDuration.WithLabelValues(target, "dns").Observe(elapsed.Seconds())
+			}
+		},
+		ConnectStart: func(network, addr string) { phases.start("connect " + network + " " + addr) },
+		ConnectDone: func(network, addr string, err error) {
+			elapsed, ok := phases.done("connect " + network + " " + addr)
+			if ok && err == nil {
+				connectionSetupDuration.WithLabelValues(target, "connect").Observe(elapsed.Seconds())
+			}
+		},
+		TLSHandshakeStart: func() { phases.start("tls") },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			elapsed, ok := phases.done("tls")
+			if ok && err == nil {
+				connectionSetupDuration.WithLabelValues(target, "tls").Observe(elapsed.Seconds())
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			reused := "false"
+			if info.Reused {
+				reused = "true"
+			} else {
+				connectionFamilies.WithLabelValues(target, metrics.AddressFamily(info.Conn.RemoteAddr())).Inc()
+			}
+			connectionsTotal.WithLabelValues(target, reused).Inc()
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { timing.wroteRequest = time.Now() },
+		GotFirstResponseByte: func() { timing.firstByte = time.Now() },
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, timing, err
+	}
+	if countExchange(target, resp, len(body)) {
+		recordWireBytes(target, "sent", bodyComponent(req.URL.Path, "sent"), len(body))
+	}
+	return resp, timing, nil
+}
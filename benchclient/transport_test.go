@@ -0,0 +1,31 @@
+package benchclient
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestPhaseTimerConcurrentDials(t *testing.T) {
+	var phases phaseTimer
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		key := fmt.Sprintf("connect tcp 192.0.2.%d:443", i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			phases.start(key)
+			if _, ok := phases.done(key); !ok {
+				t.Errorf("%s: 開始時刻が記録されていません", key)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPhaseTimerDoneWithoutStart(t *testing.T) {
+	var phases phaseTimer
+	if _, ok := phases.done("tls"); ok {
+		t.Fatal("開始していないフェーズでok=trueが返りました")
+	}
+}
@@ -0,0 +1,84 @@
+package benchclient
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/netem"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 同じホストのサーバーにUnixドメインソケットで接続して計測するトランスポート（TCPのスタックを含まない）
+const transportUnix = "unix"
+
+var tcpContribution = factory.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "client_tcp_contribution_seconds",
+		Help: "TCP stack share of the key exchange duration (network minus unix socket) in seconds",
+	},
+	[]string{"algorithm"},
+)
+
+// Unixドメインソケットで計測するセッション（未設定の場合は計測しない）
+var (
+	rsaUnixSession   *Session
+	mlkemUnixSession *Session
+)
+
+// "host=/path/to.sock" 形式の指定を読む（URLのホストがhostのリクエストをUnixドメインソケットに送る）
+func ParseUnixSocket(s string) (host, path string, err error) {
+	host, path, ok := strings.Cut(s, "=")
+	if !ok || host == "" || path == "" {
+		return "", "", fmt.Errorf("Unixドメインソケットの指定が不正です: %q（host=/path/to.sock）", s)
+	}
+	return host, path, nil
+}
+
+// URLのホストがsocketsにある接続をUnixドメインソケットに向ける（curlの--unix-socketと同じ）
+func unixSocketDial(sockets map[string]string, dial netem.DialFunc) netem.DialFunc {
+	if len(sockets) == 0 {
+		return dial
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			if path, ok := sockets[host]; ok {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			}
+		}
+		return dial(ctx, network, address)
+	}
+}
+
+// pathのUnixドメインソケットで鍵合意するセッションを作成する
+// keyURLはリクエストのパスとHostヘッダーにのみ使い、接続は常にソケットに張る
+func newUnixSession(algorithm, path, keyURL string) *Session {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", path)
+	}
+	client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+	return &Session{Algorithm: algorithm, Transport: transportUnix, Client: client, KeyURL: keyURL}
+}
+
+// Unixドメインソケットでセッションを実行し、鍵交換の所要時間を記録する
+// TCPでの値との差をTCPのスタックの寄与として記録する（失敗してもサーキットブレーカーには含めない）
+func measureUnix(session *Session, aesKey []byte, msg *SealedMessage, network time.Duration) {
+	if session == nil || !algorithmEnabled(session.Algorithm) {
+		return
+	}
+	res, err := session.Run(aesKey, msg)
+	if err != nil {
+		log.Printf("Unixドメインソケットの計測に失敗 [%s]: %v", session.Algorithm, err)
+		return
+	}
+	unix := res.Timings.Exchange()
+	keyExchangeDuration.WithLabelValues(session.Algorithm, transportUnix).Set(unix.Seconds())
+	tcpContribution.WithLabelValues(session.Algorithm).Set((network - unix).Seconds())
+}
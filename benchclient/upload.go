@@ -0,0 +1,242 @@
+package benchclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 集約サーバーへのリクエストのメトリクスのtargetラベル
+const resultsTarget = "collector"
+
+// 送信を待つ計測結果の上限（集約サーバーに届かない間は古いものから捨てる）
+const maxPendingResults = 10000
+
+var (
+	resultUploadsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_result_uploads_total",
+			Help: "Total number of result batch uploads to the collector, by result",
+		},
+		[]string{"result"},
+	)
+	resultUploadSize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_result_upload_size_bytes",
+			Help: "Size of the last uploaded result batch in bytes, by form (plaintext JSON or ML-KEM hybrid envelope)",
+		},
+		[]string{"form"},
+	)
+	resultUploadOverhead = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_result_upload_overhead_bytes",
+			Help: "Bytes added by the ML-KEM hybrid envelope to the last result batch (envelope minus plaintext)",
+		},
+	)
+	resultUploadProtectDuration = factory.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "client_result_upload_protect_duration_seconds",
+			Help:    "Duration of protecting a result batch (ML-KEM encapsulation, key wrap, encryption and encoding) in seconds",
+			Buckets: []float64{0.0001, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1},
+		},
+	)
+	resultUploadDuration = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_result_upload_duration_seconds",
+			Help: "Duration of the last successful result batch upload including the public key fetch in seconds",
+		},
+	)
+	resultsPending = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "client_result_upload_pending_records",
+			Help: "Number of session results waiting to be uploaded to the collector",
+		},
+	)
+	resultsDropped = factory.NewCounter(
+		prometheus.CounterOpts{
+			Name: "client_result_upload_dropped_records_total",
+			Help: "Total number of session results dropped because the pending buffer was full",
+		},
+	)
+)
+
+// 集約サーバーに送る計測結果（resultsURLが空の場合は記録しない）
+var (
+	resultsURL     string
+	pendingMu      sync.Mutex
+	pendingResults []wire.ResultRecord
+	uploadBatches  atomic.Int64 // 送信した回数（AES鍵のサイズを順に切り替える）
+)
+
+// セッションの結果を送信待ちに加える
+func recordSessionResult(s *Session, res *SessionResult, err error) {
+	if resultsURL == "" {
+		return
+	}
+	rec := wire.ResultRecord{Time: time.Now().UTC(), Algorithm: s.Algorithm, Transport: s.Transport, Result: "success"}
+	if err != nil {
+		rec.Result = "failure"
+	} else {
+		rec.DurationSeconds = res.Timings.Total.Seconds()
+		rec.Phases = map[string]float64{
+			"fetch":         res.Timings.Fetch.Seconds(),
+			"wrap":          res.Timings.Wrap.Seconds(),
+			"send":          res.Timings.Send.Seconds(),
+			"server_derive": res.Timings.ServerDerive.Seconds(),
+			"confirm":       res.Timings.Confirm.Seconds(),
+		}
+	}
+	queueResults(rec)
+}
+
+// 送信待ちに加える（上限を超えた分は古いものから捨てる）
+func queueResults(records ...wire.ResultRecord) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	pendingResults = append(pendingResults, records...)
+	if over := len(pendingResults) - maxPendingResults; over > 0 {
+		pendingResults = pendingResults[over:]
+		resultsDropped.Add(float64(over))
+	}
+	resultsPending.Set(float64(len(pendingResults)))
+}
+
+func takePendingResults() []wire.ResultRecord {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	records := pendingResults
+	pendingResults = nil
+	resultsPending.Set(0)
+	return records
+}
+
+// ctxがキャンセルされるまでintervalごとに計測結果を送り、最後に残りを送る
+func runResultUpload(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			uploadResults()
+		case <-ctx.Done():
+			uploadResults()
+			return
+		}
+	}
+}
+
+// 送信待ちの計測結果を送る（失敗した場合は送信待ちに戻して次の回に送る）
+func uploadResults() {
+	records := takePendingResults()
+	if len(records) == 0 {
+		return
+	}
+	start := time.Now()
+	accepted, err := uploadResultBatch(records)
+	if err != nil {
+		queueResults(records...)
+		resultUploadsTotal.WithLabelValues("failure").Inc()
+		log.Printf("計測結果の送信に失敗 (%d件): %v", len(records), err)
+		return
+	}
+	resultUploadsTotal.WithLabelValues("success").Inc()
+	resultUploadDuration.Set(time.Since(start).Seconds())
+	fmt.Printf("📤 計測結果を集約サーバーに送信しました (%d件)\n", accepted)
+}
+
+// 集約サーバーの公開鍵を取得し、計測結果をML-KEMのハイブリッド暗号化で保護して送る
+func uploadResultBatch(records []wire.ResultRecord) (int, error) {
+	host, _ := os.Hostname()
+	info := metrics.ReadBuildInfo()
+	plaintext, err := json.Marshal(wire.ResultBatch{
+		Client:  host,
+		Release: info.Version + "+" + info.Commit,
+		SentAt:  time.Now().UTC(),
+		Records: records,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	resp, _, err := tracedRequest(httpClient, resultsTarget, http.MethodGet, resultsURL, nil, withAcceptVersion(nil))
+	if err != nil {
+		return 0, fmt.Errorf("公開鍵の取得エラー: %w", err)
+	}
+	var key PublicKeyResponse
+	if err := decodeResponse(resp, &key); err != nil {
+		return 0, fmt.Errorf("公開鍵の取得エラー: %w", err)
+	}
+	publicKey, _, err := parseMLKEMPublicKey(key.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	protectStart := time.Now()
+	aesKey, err := newDataKey(int(uploadBatches.Add(1) - 1))
+	if err != nil {
+		return 0, err
+	}
+	defer zeroize("aes_key", aesKey)
+	// 収集サーバーはAES-CBC + HMACのみを受け付けるため、-data-cipherによらずAES鍵のサイズだけを切り替える
+	dataCipher, _ := cryptoutil.DataCipherFor(cryptoutil.FamilyCBCHMAC, len(aesKey))
+	msg := &SealedMessage{Plaintext: plaintext, Algorithm: dataCipher.Name}
+	if msg.IV, msg.Ciphertext, msg.MAC, err = dataCipher.Seal(aesKey, plaintext); err != nil {
+		return 0, err
+	}
+	res := &SessionResult{KeyID: key.KeyID, EnvelopeVersion: wire.ParseEnvelopeVersion(resp.Header)}
+	var sharedSecret []byte
+	if res.KEMCiphertext, sharedSecret, err = encryptMLKEM(publicKey, aesKey); err != nil {
+		return 0, err
+	}
+	res.WrappedKey, err = cryptoutil.WrapKey(sharedSecret, aesKey)
+	zeroize("shared_secret", sharedSecret)
+	if err != nil {
+		return 0, err
+	}
+	data, err := res.encryptedData(msg)
+	if err != nil {
+		return 0, err
+	}
+	body, err := json.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+	resultUploadProtectDuration.Observe(time.Since(protectStart).Seconds())
+	resultUploadSize.WithLabelValues("plaintext").Set(float64(len(plaintext)))
+	resultUploadSize.WithLabelValues("envelope").Set(float64(len(body)))
+	resultUploadOverhead.Set(float64(len(body) - len(plaintext)))
+
+	uploadURL, err := endpointURL(resultsURL, "/results")
+	if err != nil {
+		return 0, err
+	}
+	resp, _, err = tracedRequest(httpClient, resultsTarget, http.MethodPost, uploadURL, body, nil)
+	if err != nil {
+		return 0, fmt.Errorf("送信エラー: %w", err)
+	}
+	var uploaded wire.ResultUploadResponse
+	if err := decodeResponse(resp, &uploaded); err != nil {
+		return 0, fmt.Errorf("送信エラー: %w", err)
+	}
+	return uploaded.Accepted, nil
+}
+
+// レスポンスが200であればJSONをデコードする
+func decodeResponse(resp *http.Response, v any) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTPステータスエラー: %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,200 @@
+package benchclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 閾値を確認する値
+// 所要時間はイテレーションの分布のパーセンタイル、サイズはイテレーションの最大値と比較する
+var verifyDurations = map[string]func(t SessionTimings) time.Duration{
+	"fetch":       func(t SessionTimings) time.Duration { return t.Fetch },
+	"encapsulate": func(t SessionTimings) time.Duration { return t.Wrap }, // AES鍵の暗号化・カプセル化とラップ
+	"send":        func(t SessionTimings) time.Duration { return t.Send },
+	"server":      func(t SessionTimings) time.Duration { return t.ServerDerive },
+	"confirm":     func(t SessionTimings) time.Duration { return t.Confirm },
+	"session":     func(t SessionTimings) time.Duration { return t.Total },
+}
+
+var verifySizes = map[string]func(res *SessionResult, envelope int) int{
+	"envelope":     func(_ *SessionResult, envelope int) int { return envelope }, // サーバーに送る暗号化データのJSON
+	"key_material": func(res *SessionResult, _ int) int { return res.KeyMaterialSize() },
+	"public_key":   func(res *SessionResult, _ int) int { return len(res.PublicKeyBytes) },
+}
+
+// 性能の閾値（例: mlkem.encapsulate.p99<1ms、mlkem.envelope<2000）
+type Threshold struct {
+	Spec       string
+	Algorithm  string  // rsa / mlkem / dual / ecdh
+	Metric     string  // verifyDurations または verifySizes のキー
+	Percentile float64 // 所要時間のパーセンタイル（0〜100、サイズの場合は0）
+	Limit      float64 // 所要時間は秒、サイズはバイト（この値未満であれば合格）
+}
+
+// "algorithm.metric[.pNN]<limit" 形式の文字列をパースする
+func ParseThreshold(s string) (Threshold, error) {
+	name, limit, ok := strings.Cut(s, "<")
+	if !ok {
+		return Threshold{}, fmt.Errorf("閾値の形式が不正です: %q (algorithm.metric[.pNN]<limit)", s)
+	}
+	parts := strings.Split(strings.TrimSpace(name), ".")
+	if len(parts) != 2 && len(parts) != 3 {
+		return Threshold{}, fmt.Errorf("閾値の形式が不正です: %q (algorithm.metric[.pNN]<limit)", s)
+	}
+	t := Threshold{Spec: s, Algorithm: parts[0], Metric: parts[1]}
+	switch t.Algorithm {
+	case AlgorithmRSA, AlgorithmMLKEM, AlgorithmDual, AlgorithmECDH:
+	default:
+		return Threshold{}, fmt.Errorf("不明な鍵交換方式: %q (rsa / mlkem / dual / ecdh)", t.Algorithm)
+	}
+	limit = strings.TrimSpace(limit)
+	if _, ok := verifyDurations[t.Metric]; ok {
+		if len(parts) != 3 || !strings.HasPrefix(parts[2], "p") {
+			return Threshold{}, fmt.Errorf("所要時間の閾値にはパーセンタイルを指定してください: %q (例: %s.%s.p99<1ms)", s, t.Algorithm, t.Metric)
+		}
+		p, err := strconv.ParseFloat(parts[2][1:], 64)
+		if err != nil || p <= 0 || p > 100 {
+			return Threshold{}, fmt.Errorf("パーセンタイルは0より大きく100以下で指定してください: %q", parts[2])
+		}
+		d, err := time.ParseDuration(limit)
+		if err != nil || d <= 0 {
+			return Threshold{}, fmt.Errorf("所要時間の閾値が不正です: %q", limit)
+		}
+		t.Percentile, t.Limit = p, d.Seconds()
+		return t, nil
+	}
+	if _, ok := verifySizes[t.Metric]; ok {
+		if len(parts) != 2 {
+			return Threshold{}, fmt.Errorf("サイズの閾値にはパーセンタイルを指定できません: %q", s)
+		}
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return Threshold{}, fmt.Errorf("サイズの閾値はバイト数で指定してください: %q", limit)
+		}
+		t.Limit = float64(n)
+		return t, nil
+	}
+	return Threshold{}, fmt.Errorf("不明な値: %q (fetch / encapsulate / send / server / confirm / session / envelope / key_material / public_key)", t.Metric)
+}
+
+// 所要時間の閾値かどうか
+func (t Threshold) IsDuration() bool { return t.Percentile > 0 }
+
+// 閾値の確認の設定
+type VerifyConfig struct {
+	URLs        map[string]string // 鍵交換方式ごとの公開鍵のURL
+	Iterations  int
+	MessageSize int   // 暗号化するメッセージのサイズ（バイト）
+	AESKeySizes []int // セッションごとに順に使うAES鍵のサイズ（ビット、空の場合は設定済みのサイズ）
+	Thresholds  []Threshold
+}
+
+// 閾値ごとの結果
+type ThresholdResult struct {
+	Threshold Threshold
+	Observed  float64 // 所要時間は秒、サイズはバイト
+	Passed    bool
+}
+
+// 閾値で指定された鍵交換方式ごとにIterations回のセッションを実行し、すべての閾値を確認する
+// 1回でもセッションが失敗した場合はエラーを返す
+func Verify(cfg VerifyConfig) ([]ThresholdResult, error) {
+	if cfg.Iterations < 1 {
+		return nil, fmt.Errorf("イテレーション数は1以上で指定してください: %d", cfg.Iterations)
+	}
+	if len(cfg.Thresholds) == 0 {
+		return nil, fmt.Errorf("閾値を指定してください")
+	}
+	if len(cfg.AESKeySizes) > 0 {
+		if err := setAESKeySizes(cfg.AESKeySizes); err != nil {
+			return nil, err
+		}
+	}
+	if httpClient == nil {
+		configureHTTPClient(false, nil, nil)
+	}
+
+	type sample struct {
+		res      *SessionResult
+		envelope int
+	}
+	samples := make(map[string][]sample)
+	for _, t := range cfg.Thresholds {
+		if _, done := samples[t.Algorithm]; done {
+			continue
+		}
+		url := cfg.URLs[t.Algorithm]
+		if url == "" {
+			return nil, fmt.Errorf("%sの公開鍵のURLが指定されていません", t.Algorithm)
+		}
+		session := &Session{Algorithm: t.Algorithm, Transport: transportNetwork, Client: httpClient, KeyURL: url}
+		for i := 0; i < cfg.Iterations; i++ {
+			res, msg, err := runVerifySession(session, cfg.MessageSize, i)
+			if err != nil {
+				return nil, fmt.Errorf("%sのセッション（%d回目）に失敗: %w", t.Algorithm, i+1, err)
+			}
+			data, err := res.encryptedData(msg)
+			if err != nil {
+				return nil, err
+			}
+			body, err := json.Marshal(data)
+			if err != nil {
+				return nil, err
+			}
+			samples[t.Algorithm] = append(samples[t.Algorithm], sample{res: res, envelope: len(body)})
+		}
+	}
+
+	results := make([]ThresholdResult, 0, len(cfg.Thresholds))
+	for _, t := range cfg.Thresholds {
+		var observed float64
+		if t.IsDuration() {
+			values := make([]float64, 0, len(samples[t.Algorithm]))
+			for _, s := range samples[t.Algorithm] {
+				values = append(values, verifyDurations[t.Metric](s.res.Timings).Seconds())
+			}
+			observed = percentile(values, t.Percentile)
+		} else {
+			for _, s := range samples[t.Algorithm] {
+				observed = max(observed, float64(verifySizes[t.Metric](s.res, s.envelope)))
+			}
+		}
+		results = append(results, ThresholdResult{Threshold: t, Observed: observed, Passed: observed < t.Limit})
+	}
+	return results, nil
+}
+
+// counter回目のセッションのAES鍵でメッセージを暗号化し、1回のセッションを実行する
+func runVerifySession(session *Session, size, counter int) (*SessionResult, *SealedMessage, error) {
+	aesKey, err := newDataKey(counter)
+	if err != nil {
+		return nil, nil, fmt.Errorf("AES鍵の生成に失敗: %w", err)
+	}
+	defer zeroize("aes_key", aesKey)
+	msg, err := sealMessage([]byte(strings.Repeat("x", size)), aesKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("AES暗号化に失敗: %w", err)
+	}
+	observeAESEncrypt(msg)
+	res, err := session.Run(aesKey, msg)
+	if err == nil {
+		observeSessionKeySize(session.Algorithm, msg, res)
+	}
+	return res, msg, err
+}
+
+// 最近傍順位法によるパーセンタイル（pは0より大きく100以下）
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[min(max(rank, 1), len(sorted))-1]
+}
@@ -0,0 +1,42 @@
+package benchclient
+
+import (
+	"net/http"
+
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var envelopeFormatVersion = factory.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "client_envelope_format_version",
+		Help: "Envelope format version written in the latest encrypted data, as negotiated with the server (0 when the version field is omitted for servers that do not negotiate or in legacy envelope mode)",
+	},
+	[]string{"algorithm"},
+)
+
+// 版を交渉せず、versionのない暗号化データを送る（版を知らない古いクライアントを模擬する）
+var legacyEnvelopeEnabled bool
+
+// 公開鍵の取得にAccept-Versionを付ける（headerがnilの場合は作る）
+func withAcceptVersion(header http.Header) http.Header {
+	if legacyEnvelopeEnabled {
+		return header
+	}
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set(wire.AcceptVersionHeader, wire.FormatAcceptVersion(wire.SupportedEnvelopeVersions()))
+	return header
+}
+
+// 公開鍵のレスポンスのEnvelope-Versionから暗号化データに書く版を決める
+// 版を交渉しない古いサーバーにはversionを送らない（0）。未知のフィールドとして拒否されるため
+func negotiatedEnvelopeVersion(target string, resp *http.Response) int {
+	var v int
+	if !legacyEnvelopeEnabled {
+		v = wire.ParseEnvelopeVersion(resp.Header)
+	}
+	envelopeFormatVersion.WithLabelValues(target).Set(float64(v))
+	return v
+}
@@ -0,0 +1,223 @@
+package benchclient
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/entropy"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 操作の混合で指定できる操作の種類
+const (
+	OperationEncrypt   = "encrypt"   // 暗号化のみ（公開鍵の取得、AES鍵の保護と暗号化データの作成まで、サーバーには送らない）
+	OperationRoundtrip = "roundtrip" // 暗号化からサーバーでの復号の確認まで（既定のループの1回と同じ）
+	OperationSign      = "sign"      // ML-KEMサーバーにnonceに結び付けた公開鍵へ署名させ、ML-DSA-65の署名を検証する
+)
+
+var operationTypes = []string{OperationEncrypt, OperationRoundtrip, OperationSign}
+
+var (
+	workloadOperations = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_workload_operations_total",
+			Help: "Total number of operations issued by the operation mix workload, by operation (encrypt, roundtrip, sign) and result (success, failure)",
+		},
+		[]string{"operation", "result"},
+	)
+	workloadOperationDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "client_workload_operation_duration_seconds",
+			Help:    "Histogram of the duration of each operation issued by the operation mix workload in seconds, by operation (encrypt, roundtrip, sign)",
+			Buckets: []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+		},
+		[]string{"operation"},
+	)
+	workloadMixCount = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_workload_mix_operations",
+			Help: "Configured number of operations per interval in the operation mix, by operation (0 when the mix is disabled)",
+		},
+		[]string{"operation"},
+	)
+)
+
+// 1回の間隔で実行する操作の種類ごとの回数（空の場合は既定のループで毎回roundtripを1回実行する）
+type OperationMix map[string]int
+
+// 操作の混合をパースする（例: encrypt=6,roundtrip=3,sign=1）
+func ParseOperationMix(s string) (OperationMix, error) {
+	mix := OperationMix{}
+	for _, f := range strings.Split(s, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(f), "=")
+		if !ok {
+			return nil, fmt.Errorf("操作の混合はoperation=countの形式で指定してください: %q", f)
+		}
+		if !validOperation(name) {
+			return nil, fmt.Errorf("操作は%sのいずれかを指定してください: %q", strings.Join(operationTypes, "・"), name)
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("操作の回数は0以上の整数を指定してください: %q", f)
+		}
+		mix[name] += n
+	}
+	if mix.total() == 0 {
+		return nil, fmt.Errorf("操作の混合に1回以上の操作を指定してください: %q", s)
+	}
+	return mix, nil
+}
+
+func validOperation(name string) bool {
+	for _, op := range operationTypes {
+		if name == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (m OperationMix) total() int {
+	n := 0
+	for _, count := range m {
+		n += count
+	}
+	return n
+}
+
+// 1回の間隔の操作の並び（種類ごとの回数を並べて毎回シャッフルし、実際のアプリケーションのように操作を混ぜる）
+func (m OperationMix) sequence() []string {
+	var ops []string
+	for _, op := range operationTypes {
+		for range m[op] {
+			ops = append(ops, op)
+		}
+	}
+	rand.Shuffle(len(ops), func(i, j int) { ops[i], ops[j] = ops[j], ops[i] })
+	return ops
+}
+
+// 実行する操作の混合（nilの場合は既定のループ）
+var operationMix OperationMix
+
+func setOperationMix(mix OperationMix) {
+	operationMix = mix
+	for _, op := range operationTypes {
+		workloadMixCount.WithLabelValues(op).Set(float64(mix[op]))
+	}
+}
+
+// 操作の混合を1回の間隔の分だけ実行する
+// 種類ごとの結果と所要時間を記録し、失敗した操作のエラーはまとめて返す
+func runOperationMix(counter int, message Message) error {
+	var errs []error
+	for _, op := range operationMix.sequence() {
+		start := time.Now()
+		var err error
+		switch op {
+		case OperationEncrypt:
+			err = runEncryptOnly(counter, message)
+		case OperationRoundtrip:
+			err = runHybridEncryption(counter, message)
+		case OperationSign:
+			err = runSignatureOperation()
+		}
+		result := "success"
+		if err != nil && !errors.Is(err, errBreakerOpen) {
+			result = "failure"
+		}
+		workloadOperations.WithLabelValues(op, result).Inc()
+		if err == nil {
+			workloadOperationDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// 暗号化だけを行う（保存用にデータを暗号化するアプリケーションの模擬）
+// RSAとML-KEMの公開鍵でAES鍵を保護し、暗号化データのJSONまで作ってサーバーには送らない
+func runEncryptOnly(counter int, message Message) error {
+	aesKey := make([]byte, aesKeyBitsFor(counter)/8)
+	if _, err := io.ReadFull(entropy.Reader(entropy.OperationAESKey), aesKey); err != nil {
+		return atStage("aes_keygen", withCategory(categoryCrypto, fmt.Errorf("AES鍵の生成に失敗: %w", err)))
+	}
+	defer zeroize("aes_key", aesKey)
+	msg, err := sealMessage([]byte(message.Text), aesKey)
+	if err != nil {
+		return atStage("aes_encrypt", withCategory(categoryCrypto, fmt.Errorf("メッセージの暗号化に失敗: %w", err)))
+	}
+
+	var errs []error
+	for _, p := range []struct {
+		session *Session
+		breaker *circuitBreaker
+	}{
+		{rsaSession, rsaBreaker},
+		{mlkemSession, mlkemBreaker},
+	} {
+		if !algorithmEnabled(p.session.Algorithm) {
+			continue
+		}
+		errs = append(errs, p.breaker.do(func() error {
+			res, err := p.session.exchange(aesKey)
+			if err != nil {
+				return err
+			}
+			data, err := res.encryptedData(msg)
+			if err != nil {
+				return atStage(p.session.Algorithm+"_encrypt", withCategory(categoryCrypto, err))
+			}
+			if _, err := json.Marshal(data); err != nil {
+				return atStage(p.session.Algorithm+"_encrypt", withCategory(categoryDecode, fmt.Errorf("JSONエンコードエラー: %w", err)))
+			}
+			return nil
+		}))
+	}
+	return errors.Join(errs...)
+}
+
+// ML-KEMサーバーにnonceを送って公開鍵に署名させ、結び付きとML-DSA-65の署名を検証する
+// キャッシュした公開鍵は使わず、毎回サーバーでの署名とクライアントでの検証を1回ずつ行う
+func runSignatureOperation() error {
+	if !algorithmEnabled(AlgorithmMLKEM) {
+		return nil
+	}
+	return mlkemBreaker.do(func() error {
+		nonce, body, err := newKeyNonce()
+		if err != nil {
+			return atStage("mlkem_sign", withCategory(categoryCrypto, fmt.Errorf("nonceの生成エラー: %w", err)))
+		}
+		resp, _, err := tracedRequest(httpClient, AlgorithmMLKEM, http.MethodPost, mlkemURL, body, withAcceptVersion(nil))
+		if err != nil {
+			return atStage("mlkem_sign", withCategory(categoryNetwork, fmt.Errorf("HTTP POSTエラー: %w", err)))
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return atStage("mlkem_sign", withCategory(categoryServer, fmt.Errorf("HTTPステータスエラー: %d", resp.StatusCode)))
+		}
+		var keyResp PublicKeyResponse
+		if err := json.NewDecoder(resp.Body).Decode(&keyResp); err != nil {
+			return atStage("mlkem_sign", withCategory(categoryDecode, fmt.Errorf("JSONデコードエラー: %w", err)))
+		}
+		if err := verifyKeyBinding(AlgorithmMLKEM, nonce, &keyResp); err != nil {
+			return atStage("mlkem_sign", err)
+		}
+		publicKey, err := base64.StdEncoding.DecodeString(keyResp.PublicKey)
+		if err != nil {
+			return atStage("mlkem_sign", withCategory(categoryDecode, fmt.Errorf("Base64デコードエラー: %w", err)))
+		}
+		if err := verifyKeySignature(httpClient, AlgorithmMLKEM, mlkemURL, &keyResp, publicKey); err != nil {
+			return atStage("mlkem_sign", err)
+		}
+		return nil
+	})
+}
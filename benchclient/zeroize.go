@@ -0,0 +1,23 @@
+package benchclient
+
+import (
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var zeroizationEvents = factory.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "client_zeroization_events_total",
+		Help: "Total number of times sensitive material was zeroized, by material",
+	},
+	[]string{"material"},
+)
+
+// 秘密情報をゼロで上書きし、回数を記録する
+func zeroize(material string, b []byte) {
+	if b == nil {
+		return
+	}
+	cryptoutil.Zeroize(b)
+	zeroizationEvents.WithLabelValues(material).Inc()
+}
@@ -0,0 +1,26 @@
+package benchclient
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestZeroizeRecordsEvent(t *testing.T) {
+	counter := zeroizationEvents.WithLabelValues("test_material")
+	before := testutil.ToFloat64(counter)
+	b := []byte("shared secret")
+	zeroize("test_material", b)
+	if !bytes.Equal(b, make([]byte, len(b))) {
+		t.Fatalf("ゼロで上書きされていません: %x", b)
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Fatalf("client_zeroization_events_totalの増加 = %v, want 1", got)
+	}
+	// nilは消去する対象がないため記録しない
+	zeroize("test_material", nil)
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Fatalf("nilで記録されました: 増加 = %v", got)
+	}
+}
@@ -0,0 +1,68 @@
+// Package calibration は暗号処理を行わないHTTPとJSONだけの往復を提供する
+//
+// クライアントは鍵合意のセッションと同じ形のリクエスト（公開鍵の取得と暗号化データの送信）をこのエンドポイントに送り、
+// その往復時間を基準値とする。Grafanaで「セッション全体の時間 − 基準値」を暗号処理の時間として表示できる
+package calibration
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/wire"
+)
+
+// POST /calibrate で受け付ける本文の最大サイズ
+const maxBody = 64 << 20
+
+// GET /calibrate と POST /calibrate のハンドラー
+func Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		receivedAt := time.Now()
+		var resp wire.CalibrateResponse
+		switch r.Method {
+		case http.MethodGet:
+			size, err := parseSize(r.URL.Query().Get("size"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			resp.Padding = strings.Repeat("A", size)
+		case http.MethodPost:
+			// 暗号化データの送信と同じくJSONとしてデコードする（内容は使わない）
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+			if err != nil {
+				http.Error(w, "本文の読み込みに失敗しました", http.StatusBadRequest)
+				return
+			}
+			var data wire.EncryptedData
+			if err := json.Unmarshal(body, &data); err != nil {
+				http.Error(w, "リクエストの形式が不正です", http.StatusBadRequest)
+				return
+			}
+			resp.ReceivedSize = len(body)
+		default:
+			http.Error(w, "GETとPOSTメソッドのみサポートしています", http.StatusMethodNotAllowed)
+			return
+		}
+		resp.ServerTiming = wire.NewServerTiming(receivedAt)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// 詰め物のサイズを解釈する（空の場合は0）
+func parseSize(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > wire.MaxCalibratePadding {
+		return 0, fmt.Errorf("sizeは0〜%dで指定してください: %q", wire.MaxCalibratePadding, s)
+	}
+	return n, nil
+}
@@ -0,0 +1,151 @@
+// Package certchain はRSA、ECDSA、ML-DSA、ML-DSAと従来方式の複合署名で2段・3段の証明書チェーンを発行し、
+// チェーンのサイズと検証にかかる時間を比較するベンチマークを提供する
+//
+// TLSのハンドシェイクでサーバーが送る証明書チェーンは、ポスト量子署名への移行で最も大きくなるデータである
+package certchain
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "cert-chain-bench"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は cert_chain_）
+var factory = metrics.NewFactory(ServiceName, "cert_chain_")
+
+var (
+	chainSize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "cert_chain_size_bytes",
+			Help: "Total size of all DER certificates in the chain including the root in bytes, by signature scheme and levels",
+		},
+		[]string{"scheme", "levels"},
+	)
+	transmittedSize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "cert_chain_transmitted_size_bytes",
+			Help: "Size of the certificates a TLS server sends (the chain without the root) in bytes, by signature scheme and levels",
+		},
+		[]string{"scheme", "levels"},
+	)
+	certificateSize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "cert_chain_certificate_size_bytes",
+			Help: "Size of one DER certificate in bytes, by signature scheme and position (root, intermediate, leaf)",
+		},
+		[]string{"scheme", "position"},
+	)
+	buildDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "cert_chain_build_duration_seconds",
+			Help:    "Histogram of the time to issue (sign) every certificate in the chain in seconds",
+			Buckets: []float64{0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05},
+		},
+		[]string{"scheme", "levels"},
+	)
+	verifyDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "cert_chain_verify_duration_seconds",
+			Help:    "Histogram of the time to fully verify the chain (parse, names, validity, constraints, signatures, server name) in seconds",
+			Buckets: []float64{0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025},
+		},
+		[]string{"scheme", "levels"},
+	)
+	sizeRatio = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "cert_chain_transmitted_size_ratio",
+			Help: "Ratio of the transmitted chain size to the ECDSA P-256 chain with the same levels (scheme / ECDSA-P256)",
+		},
+		[]string{"scheme", "levels"},
+	)
+	chainsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cert_chain_chains_total",
+			Help: "Total number of chains issued and verified, by result",
+		},
+		[]string{"scheme", "levels", "result"},
+	)
+)
+
+// サイズの比の基準にする署名方式（現在のWeb PKIで最も多いサーバー証明書）
+const baselineScheme = "ECDSA-P256"
+
+// ベンチマークの設定
+type Config struct {
+	Interval time.Duration // チェーンを発行して検証する間隔
+}
+
+// デフォルト設定
+func DefaultConfig() Config {
+	return Config{Interval: time.Second}
+}
+
+// 一定間隔ですべての署名方式と段数のチェーンを発行して検証する
+func Run(cfg Config) error {
+	var builders []*Builder
+	for _, scheme := range Schemes() {
+		b, err := NewBuilder(scheme)
+		if err != nil {
+			return err
+		}
+		builders = append(builders, b)
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, levels := range Levels {
+			label := strconv.Itoa(levels)
+			sizes := make(map[string]int)
+			for _, b := range builders {
+				chain, err := benchmark(b, levels)
+				if err != nil {
+					chainsTotal.WithLabelValues(b.Scheme(), label, "failure").Inc()
+					log.Printf("%d段の証明書チェーンの発行・検証に失敗 [%s]: %v", levels, b.Scheme(), err)
+					continue
+				}
+				chainsTotal.WithLabelValues(b.Scheme(), label, "success").Inc()
+				sizes[b.Scheme()] = chain.TransmittedSize()
+			}
+			if base := sizes[baselineScheme]; base > 0 {
+				for scheme, size := range sizes {
+					sizeRatio.WithLabelValues(scheme, label).Set(float64(size) / float64(base))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// 1つの署名方式と段数でチェーンを発行して検証する
+func benchmark(b *Builder, levels int) (*Chain, error) {
+	label := strconv.Itoa(levels)
+	start := time.Now()
+	chain, err := b.Build(levels)
+	if err != nil {
+		return nil, err
+	}
+	buildDuration.WithLabelValues(b.Scheme(), label).Observe(time.Since(start).Seconds())
+
+	start = time.Now()
+	if err := Verify(b.scheme, chain, start); err != nil {
+		return nil, fmt.Errorf("検証エラー: %w", err)
+	}
+	verifyDuration.WithLabelValues(b.Scheme(), label).Observe(time.Since(start).Seconds())
+
+	chainSize.WithLabelValues(b.Scheme(), label).Set(float64(chain.Size()))
+	transmittedSize.WithLabelValues(b.Scheme(), label).Set(float64(chain.TransmittedSize()))
+	if levels == 3 {
+		for i, position := range []string{"leaf", "intermediate", "root"} {
+			certificateSize.WithLabelValues(b.Scheme(), position).Set(float64(len(chain.Certificates[i])))
+		}
+	}
+	return chain, nil
+}
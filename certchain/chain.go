@@ -0,0 +1,317 @@
+package certchain
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+)
+
+var (
+	oidExtSubjectKeyID     = asn1.ObjectIdentifier{2, 5, 29, 14}
+	oidExtKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtSubjectAltName   = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+	oidExtAuthorityKeyID   = asn1.ObjectIdentifier{2, 5, 29, 35}
+	oidExtExtKeyUsage      = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidServerAuth          = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}
+)
+
+// 証明書チェーンの段数（ルート → サーバー、ルート → 中間CA → サーバー）
+var Levels = []int{2, 3}
+
+// サーバー証明書のSubjectAltName（検証ではこの名前を確認する）
+const ServerName = "ml-kem-server"
+
+// RFC 5280 の証明書（crypto/x509 と同じ構造をencoding/asn1で組み立てる）
+type certificate struct {
+	TBSCertificate     asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+type tbsCertificate struct {
+	Version            int `asn1:"optional,explicit,default:0,tag:0"`
+	SerialNumber       *big.Int
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Issuer             asn1.RawValue
+	Validity           validity
+	Subject            asn1.RawValue
+	PublicKey          subjectPublicKeyInfo
+	Extensions         []pkix.Extension `asn1:"optional,explicit,tag:3"`
+}
+
+type validity struct {
+	NotBefore, NotAfter time.Time
+}
+
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+type basicConstraints struct {
+	IsCA       bool `asn1:"optional"`
+	MaxPathLen int  `asn1:"optional,default:-1"`
+}
+
+type authorityKeyID struct {
+	ID []byte `asn1:"optional,tag:0"`
+}
+
+// DERにエンコードする前の拡張
+type extension struct {
+	id       asn1.ObjectIdentifier
+	critical bool
+	value    any
+}
+
+// 証明書チェーン（DER、サーバー証明書が先頭でルート証明書が末尾）
+type Chain struct {
+	Scheme       string
+	Certificates [][]byte
+}
+
+// すべての証明書の合計サイズ
+func (c *Chain) Size() int {
+	n := 0
+	for _, der := range c.Certificates {
+		n += len(der)
+	}
+	return n
+}
+
+// TLSのハンドシェイクで送るサイズ（ルート証明書は検証者が持っているため送らない）
+func (c *Chain) TransmittedSize() int {
+	return c.Size() - len(c.Certificates[len(c.Certificates)-1])
+}
+
+// 証明書を発行する主体（CAまたはサーバー）
+type entity struct {
+	name pkix.Name
+	key  privateKey
+	// SubjectKeyIdentifier（公開鍵のSHA-256の先頭160ビット、RFC 7093の方法1）
+	keyID []byte
+}
+
+// 1つの署名方式でルートCA・中間CA・サーバーの鍵を持ち、証明書チェーンを発行する
+// 鍵は長期間使うものとして作成時に一度だけ生成し、チェーンを作るたびに証明書に署名し直す
+type Builder struct {
+	scheme                     Scheme
+	root, intermediate, server entity
+}
+
+// 署名方式の鍵を生成してBuilderを作成する
+func NewBuilder(scheme Scheme) (*Builder, error) {
+	b := &Builder{scheme: scheme}
+	for _, e := range []struct {
+		entity *entity
+		name   string
+	}{
+		{&b.root, scheme.Name() + " Root CA"},
+		{&b.intermediate, scheme.Name() + " Intermediate CA"},
+		{&b.server, ServerName},
+	} {
+		key, err := scheme.generateKey()
+		if err != nil {
+			return nil, err
+		}
+		keyID := sha256.Sum256(key.publicKey())
+		*e.entity = entity{
+			name:  pkix.Name{Organization: []string{"PQC Grafana"}, CommonName: e.name},
+			key:   key,
+			keyID: keyID[:20],
+		}
+	}
+	return b, nil
+}
+
+// 署名方式の名前
+func (b *Builder) Scheme() string { return b.scheme.Name() }
+
+// サーバー証明書の鍵で署名する（TLSのCertificateVerifyなど、チェーン以外でサーバーが送る署名の模擬）
+func (b *Builder) ServerSign(msg []byte) ([]byte, error) {
+	return b.server.key.sign(msg)
+}
+
+// 指定した段数の証明書チェーンを発行する
+func (b *Builder) Build(levels int) (*Chain, error) {
+	var path []*entity
+	switch levels {
+	case 2:
+		path = []*entity{&b.server, &b.root}
+	case 3:
+		path = []*entity{&b.server, &b.intermediate, &b.root}
+	default:
+		return nil, fmt.Errorf("チェーンの段数は2または3で指定してください: %d", levels)
+	}
+	chain := &Chain{Scheme: b.scheme.Name()}
+	for i, subject := range path {
+		issuer := subject
+		if i+1 < len(path) {
+			issuer = path[i+1]
+		}
+		der, err := b.issue(subject, issuer, i)
+		if err != nil {
+			return nil, fmt.Errorf("%sの証明書の発行エラー: %w", subject.name.CommonName, err)
+		}
+		chain.Certificates = append(chain.Certificates, der)
+	}
+	return chain, nil
+}
+
+// subjectの証明書をissuerの鍵で発行する
+// depthはサーバー証明書からの位置（0がサーバー証明書）で、CAの場合は下に続くCAの数をpathLenConstraintにする
+func (b *Builder) issue(subject, issuer *entity, depth int) ([]byte, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	isCA := depth > 0
+	lifetime := 90 * 24 * time.Hour
+	if isCA {
+		lifetime = 10 * 365 * 24 * time.Hour
+	}
+	extensions, err := b.extensions(subject, issuer, isCA, depth-1)
+	if err != nil {
+		return nil, err
+	}
+	subjectName, err := asn1.Marshal(subject.name.ToRDNSequence())
+	if err != nil {
+		return nil, err
+	}
+	issuerName, err := asn1.Marshal(issuer.name.ToRDNSequence())
+	if err != nil {
+		return nil, err
+	}
+	publicKey := subject.key.publicKey()
+	now := time.Now().Truncate(time.Second)
+	tbs, err := asn1.Marshal(tbsCertificate{
+		Version:            2,
+		SerialNumber:       serial,
+		SignatureAlgorithm: b.scheme.signatureAlgorithm(),
+		Issuer:             asn1.RawValue{FullBytes: issuerName},
+		Validity:           validity{NotBefore: now.Add(-time.Hour).UTC(), NotAfter: now.Add(lifetime).UTC()},
+		Subject:            asn1.RawValue{FullBytes: subjectName},
+		PublicKey:          subjectPublicKeyInfo{Algorithm: b.scheme.publicKeyAlgorithm(), PublicKey: asn1.BitString{Bytes: publicKey, BitLength: 8 * len(publicKey)}},
+		Extensions:         extensions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sig, err := issuer.key.sign(tbs)
+	if err != nil {
+		return nil, fmt.Errorf("署名エラー: %w", err)
+	}
+	return asn1.Marshal(certificate{
+		TBSCertificate:     asn1.RawValue{FullBytes: tbs},
+		SignatureAlgorithm: b.scheme.signatureAlgorithm(),
+		SignatureValue:     asn1.BitString{Bytes: sig, BitLength: 8 * len(sig)},
+	})
+}
+
+// Web PKIの証明書と同じ拡張（基本制約、鍵用途、鍵識別子、サーバー証明書はSubjectAltNameと拡張鍵用途）
+func (b *Builder) extensions(subject, issuer *entity, isCA bool, maxPathLen int) ([]pkix.Extension, error) {
+	constraints := basicConstraints{IsCA: isCA, MaxPathLen: -1}
+	// 鍵用途のビット列（digitalSignature、CAはkeyCertSignとcRLSignも含める）
+	usage := asn1.BitString{Bytes: []byte{0x80}, BitLength: 1}
+	if isCA {
+		constraints.MaxPathLen = maxPathLen
+		usage = asn1.BitString{Bytes: []byte{0x86}, BitLength: 7}
+	}
+	values := []extension{
+		{oidExtBasicConstraints, true, constraints},
+		{oidExtKeyUsage, true, usage},
+		{oidExtSubjectKeyID, false, subject.keyID},
+	}
+	if subject != issuer {
+		values = append(values, extension{oidExtAuthorityKeyID, false, authorityKeyID{ID: issuer.keyID}})
+	}
+	if !isCA {
+		san := []asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte(ServerName)}}
+		values = append(values,
+			extension{oidExtSubjectAltName, false, san},
+			extension{oidExtExtKeyUsage, false, []asn1.ObjectIdentifier{oidServerAuth}},
+		)
+	}
+	extensions := make([]pkix.Extension, len(values))
+	for i, v := range values {
+		der, err := asn1.Marshal(v.value)
+		if err != nil {
+			return nil, err
+		}
+		extensions[i] = pkix.Extension{Id: v.id, Critical: v.critical, Value: der}
+	}
+	return extensions, nil
+}
+
+// 証明書チェーンを検証する（ルート証明書は信頼済みとして署名を検証しない）
+// すべての証明書のパース、発行者と名前の対応、有効期間、CAの制約、署名、サーバー名を確認する
+func Verify(scheme Scheme, chain *Chain, now time.Time) error {
+	if len(chain.Certificates) < 2 {
+		return fmt.Errorf("チェーンにはサーバー証明書とルート証明書が必要です")
+	}
+	certs := make([]*x509.Certificate, len(chain.Certificates))
+	for i, der := range chain.Certificates {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return fmt.Errorf("%d番目の証明書のパースエラー: %w", i, err)
+		}
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return fmt.Errorf("%d番目の証明書（%s）が有効期間外です", i, cert.Subject.CommonName)
+		}
+		certs[i] = cert
+	}
+	for i, cert := range certs[:len(certs)-1] {
+		parent := certs[i+1]
+		if !bytes.Equal(cert.RawIssuer, parent.RawSubject) {
+			return fmt.Errorf("%sの発行者が%sではありません", cert.Subject.CommonName, parent.Subject.CommonName)
+		}
+		if !parent.BasicConstraintsValid || !parent.IsCA || parent.KeyUsage&x509.KeyUsageCertSign == 0 {
+			return fmt.Errorf("%sは証明書を発行できるCAではありません", parent.Subject.CommonName)
+		}
+		// 親の下に続く中間CAの数（サーバー証明書を除く）
+		if (parent.MaxPathLen > 0 || parent.MaxPathLenZero) && i > parent.MaxPathLen {
+			return fmt.Errorf("%sのpathLenConstraintを超えています", parent.Subject.CommonName)
+		}
+		if err := verifySignature(scheme, cert, parent); err != nil {
+			return fmt.Errorf("%sの署名の検証エラー: %w", cert.Subject.CommonName, err)
+		}
+	}
+	leaf := certs[0]
+	if err := leaf.VerifyHostname(ServerName); err != nil {
+		return err
+	}
+	if !slices.Contains(leaf.ExtKeyUsage, x509.ExtKeyUsageServerAuth) {
+		return fmt.Errorf("サーバー証明書の拡張鍵用途にserverAuthがありません")
+	}
+	return nil
+}
+
+// certの署名をparentの公開鍵で検証する
+func verifySignature(scheme Scheme, cert, parent *x509.Certificate) error {
+	var outer certificate
+	if _, err := asn1.Unmarshal(cert.Raw, &outer); err != nil {
+		return err
+	}
+	if !outer.SignatureAlgorithm.Algorithm.Equal(scheme.signatureAlgorithm().Algorithm) {
+		return fmt.Errorf("署名方式が%sではありません: %v", scheme.Name(), outer.SignatureAlgorithm.Algorithm)
+	}
+	var spki subjectPublicKeyInfo
+	if _, err := asn1.Unmarshal(parent.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return err
+	}
+	if !spki.Algorithm.Algorithm.Equal(scheme.publicKeyAlgorithm().Algorithm) {
+		return fmt.Errorf("発行者の公開鍵が%sではありません: %v", scheme.Name(), spki.Algorithm.Algorithm)
+	}
+	if !scheme.verify(spki.PublicKey.RightAlign(), cert.RawTBSCertificate, outer.SignatureValue.RightAlign()) {
+		return fmt.Errorf("署名が一致しません")
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package certchain
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"slices"
+
+	"github.com/cloudflare/circl/sign"
+	"github.com/cloudflare/circl/sign/mldsa/mldsa44"
+	"github.com/cloudflare/circl/sign/mldsa/mldsa65"
+	"github.com/cloudflare/circl/sign/mldsa/mldsa87"
+)
+
+var (
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidECPublicKey     = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidP256            = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	// draft-ietf-lamps-pq-composite-sigs のOID（ドラフトのため変わる可能性がある）
+	oidMLDSA44RSA2048   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 6, 38}
+	oidMLDSA44ECDSAP256 = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 6, 40}
+	oidMLDSA65ECDSAP256 = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 6, 45}
+)
+
+// 証明書の署名方式
+type Scheme interface {
+	Name() string
+	// SubjectPublicKeyInfoのアルゴリズム
+	publicKeyAlgorithm() pkix.AlgorithmIdentifier
+	// 証明書のsignatureAlgorithm
+	signatureAlgorithm() pkix.AlgorithmIdentifier
+	generateKey() (privateKey, error)
+	// publicKeyはSubjectPublicKeyInfoのビット列
+	verify(publicKey, msg, sig []byte) bool
+}
+
+// 証明書に署名する秘密鍵
+type privateKey interface {
+	// SubjectPublicKeyInfoに入れる公開鍵のビット列
+	publicKey() []byte
+	sign(msg []byte) ([]byte, error)
+}
+
+// 比較するすべての署名方式（従来方式、ML-DSA、両方で署名する複合方式）
+func Schemes() []Scheme {
+	return []Scheme{
+		rsaScheme{bits: 2048},
+		ecdsaScheme{},
+		mldsaScheme{mldsa44.Scheme()},
+		mldsaScheme{mldsa65.Scheme()},
+		mldsaScheme{mldsa87.Scheme()},
+		compositeScheme{name: "MLDSA44-RSA2048", oid: oidMLDSA44RSA2048, pq: mldsaScheme{mldsa44.Scheme()}, classical: rsaScheme{bits: 2048}},
+		compositeScheme{name: "MLDSA44-ECDSA-P256", oid: oidMLDSA44ECDSAP256, pq: mldsaScheme{mldsa44.Scheme()}, classical: ecdsaScheme{}},
+		compositeScheme{name: "MLDSA65-ECDSA-P256", oid: oidMLDSA65ECDSAP256, pq: mldsaScheme{mldsa65.Scheme()}, classical: ecdsaScheme{}},
+	}
+}
+
+// RSA + PKCS #1 v1.5 + SHA-256（公開鍵はPKCS #1のRSAPublicKey）
+type rsaScheme struct{ bits int }
+
+func (s rsaScheme) Name() string { return fmt.Sprintf("RSA-%d", s.bits) }
+
+func (rsaScheme) publicKeyAlgorithm() pkix.AlgorithmIdentifier {
+	return pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}
+}
+
+func (rsaScheme) signatureAlgorithm() pkix.AlgorithmIdentifier {
+	return pkix.AlgorithmIdentifier{Algorithm: oidSHA256WithRSA, Parameters: asn1.NullRawValue}
+}
+
+func (s rsaScheme) generateKey() (privateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, s.bits)
+	if err != nil {
+		return nil, fmt.Errorf("RSA鍵生成エラー: %w", err)
+	}
+	return rsaKey{key}, nil
+}
+
+func (rsaScheme) verify(publicKey, msg, sig []byte) bool {
+	pub, err := x509.ParsePKCS1PublicKey(publicKey)
+	if err != nil {
+		return false
+	}
+	digest := sha256.Sum256(msg)
+	return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+}
+
+type rsaKey struct{ *rsa.PrivateKey }
+
+func (k rsaKey) publicKey() []byte { return x509.MarshalPKCS1PublicKey(&k.PublicKey) }
+
+func (k rsaKey) sign(msg []byte) ([]byte, error) {
+	digest := sha256.Sum256(msg)
+	return rsa.SignPKCS1v15(rand.Reader, k.PrivateKey, crypto.SHA256, digest[:])
+}
+
+// ECDSA P-256 + SHA-256（公開鍵は非圧縮形式の点、署名はASN.1）
+type ecdsaScheme struct{}
+
+func (ecdsaScheme) Name() string { return "ECDSA-P256" }
+
+func (ecdsaScheme) publicKeyAlgorithm() pkix.AlgorithmIdentifier {
+	params, _ := asn1.Marshal(oidP256)
+	return pkix.AlgorithmIdentifier{Algorithm: oidECPublicKey, Parameters: asn1.RawValue{FullBytes: params}}
+}
+
+func (ecdsaScheme) signatureAlgorithm() pkix.AlgorithmIdentifier {
+	return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}
+}
+
+func (ecdsaScheme) generateKey() (privateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("ECDSA鍵生成エラー: %w", err)
+	}
+	return ecdsaKey{key}, nil
+}
+
+func (s ecdsaScheme) verify(publicKey, msg, sig []byte) bool {
+	// 点の検証はcrypto/x509に任せるため、SubjectPublicKeyInfoに戻してパースする
+	spki, err := asn1.Marshal(subjectPublicKeyInfo{Algorithm: s.publicKeyAlgorithm(), PublicKey: asn1.BitString{Bytes: publicKey, BitLength: 8 * len(publicKey)}})
+	if err != nil {
+		return false
+	}
+	parsed, err := x509.ParsePKIXPublicKey(spki)
+	if err != nil {
+		return false
+	}
+	pub, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return false
+	}
+	digest := sha256.Sum256(msg)
+	return ecdsa.VerifyASN1(pub, digest[:], sig)
+}
+
+type ecdsaKey struct{ *ecdsa.PrivateKey }
+
+func (k ecdsaKey) publicKey() []byte {
+	pub, err := k.PublicKey.ECDH()
+	if err != nil {
+		return nil
+	}
+	return pub.Bytes()
+}
+
+func (k ecdsaKey) sign(msg []byte) ([]byte, error) {
+	digest := sha256.Sum256(msg)
+	return ecdsa.SignASN1(rand.Reader, k.PrivateKey, digest[:])
+}
+
+// ML-DSA（FIPS 204、公開鍵と署名は固定長、アルゴリズムのパラメーターはない）
+type mldsaScheme struct{ sch sign.Scheme }
+
+func (s mldsaScheme) Name() string { return s.sch.Name() }
+
+func (s mldsaScheme) publicKeyAlgorithm() pkix.AlgorithmIdentifier {
+	// circlのML-DSAはFIPS 204のOID（2.16.840.1.101.3.4.3.17〜19）を返す
+	return pkix.AlgorithmIdentifier{Algorithm: s.sch.(interface{ Oid() asn1.ObjectIdentifier }).Oid()}
+}
+
+func (s mldsaScheme) signatureAlgorithm() pkix.AlgorithmIdentifier { return s.publicKeyAlgorithm() }
+
+func (s mldsaScheme) generateKey() (privateKey, error) {
+	pub, priv, err := s.sch.GenerateKey()
+	if err != nil {
+		return nil, fmt.Errorf("%s鍵生成エラー: %w", s.sch.Name(), err)
+	}
+	pubBytes, err := pub.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("%s公開鍵のエンコードエラー: %w", s.sch.Name(), err)
+	}
+	return mldsaKey{sch: s.sch, priv: priv, pub: pubBytes}, nil
+}
+
+func (s mldsaScheme) verify(publicKey, msg, sig []byte) bool {
+	pub, err := s.sch.UnmarshalBinaryPublicKey(publicKey)
+	if err != nil {
+		return false
+	}
+	return s.sch.Verify(pub, msg, sig, nil)
+}
+
+type mldsaKey struct {
+	sch  sign.Scheme
+	priv sign.PrivateKey
+	pub  []byte
+}
+
+func (k mldsaKey) publicKey() []byte { return k.pub }
+
+func (k mldsaKey) sign(msg []byte) ([]byte, error) {
+	return k.sch.Sign(k.priv, msg, nil), nil
+}
+
+// ML-DSAと従来方式の両方で署名する複合方式
+// draft-ietf-lamps-pq-composite-sigs を簡略化し、公開鍵と署名はML-DSAの値（固定長）に従来方式の値を連結する
+// 両方の署名を検証できた場合のみ有効とする
+type compositeScheme struct {
+	name      string
+	oid       asn1.ObjectIdentifier
+	pq        mldsaScheme
+	classical Scheme
+}
+
+func (s compositeScheme) Name() string { return s.name }
+
+func (s compositeScheme) publicKeyAlgorithm() pkix.AlgorithmIdentifier {
+	return pkix.AlgorithmIdentifier{Algorithm: s.oid}
+}
+
+func (s compositeScheme) signatureAlgorithm() pkix.AlgorithmIdentifier { return s.publicKeyAlgorithm() }
+
+func (s compositeScheme) generateKey() (privateKey, error) {
+	pq, err := s.pq.generateKey()
+	if err != nil {
+		return nil, err
+	}
+	classical, err := s.classical.generateKey()
+	if err != nil {
+		return nil, err
+	}
+	return compositeKey{pq: pq, classical: classical}, nil
+}
+
+func (s compositeScheme) verify(publicKey, msg, sig []byte) bool {
+	pkSize, sigSize := s.pq.sch.PublicKeySize(), s.pq.sch.SignatureSize()
+	if len(publicKey) <= pkSize || len(sig) <= sigSize {
+		return false
+	}
+	// 片方が失敗しても両方を検証する（検証時間を一定にする）
+	pqOK := s.pq.verify(publicKey[:pkSize], msg, sig[:sigSize])
+	classicalOK := s.classical.verify(publicKey[pkSize:], msg, sig[sigSize:])
+	return pqOK && classicalOK
+}
+
+type compositeKey struct {
+	pq, classical privateKey
+}
+
+func (k compositeKey) publicKey() []byte {
+	return slices.Concat(k.pq.publicKey(), k.classical.publicKey())
+}
+
+func (k compositeKey) sign(msg []byte) ([]byte, error) {
+	pqSig, err := k.pq.sign(msg)
+	if err != nil {
+		return nil, err
+	}
+	classicalSig, err := k.classical.sign(msg)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Concat(pqSig, classicalSig), nil
+}
@@ -0,0 +1,147 @@
+// Package chaos はサーバーに人工的な遅延・エラー・データの破損を注入する（カオステスト用）
+//
+// クライアントの再試行やサーキットブレーカー、Grafanaのアラートが実際に動作するかを
+// 意図的に確認するためのもので、計測には使わない
+package chaos
+
+import (
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "chaos"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は chaos_）
+var factory = metrics.NewFactory(ServiceName, "chaos_")
+
+// 注入する障害の種類
+const (
+	KindLatency           = "latency"
+	KindError             = "error"
+	KindCorruptKey        = "corrupt_key"
+	KindCorruptCiphertext = "corrupt_ciphertext"
+)
+
+var injections = factory.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "chaos_injections_total",
+		Help: "Total number of injected failures, by server and kind (latency, error, corrupt_key or corrupt_ciphertext)",
+	},
+	[]string{"server", "kind"},
+)
+
+// 障害を注入する設定（確率は0〜1、すべて0の場合は注入しない）
+type Config struct {
+	Latency               time.Duration // 注入する遅延
+	LatencyRate           float64       // リクエストに遅延を注入する確率
+	ErrorRate             float64       // 503 Service Unavailable を返す確率
+	CorruptKeyRate        float64       // 返す公開鍵の1バイトを反転する確率
+	CorruptCiphertextRate float64       // 受け取った暗号文の1バイトを反転する確率
+}
+
+// 設定を検証する
+func (c Config) Validate() error {
+	if c.Latency < 0 {
+		return fmt.Errorf("注入する遅延が負の値です: %v", c.Latency)
+	}
+	for _, r := range []struct {
+		name string
+		rate float64
+	}{
+		{"遅延を注入する確率", c.LatencyRate},
+		{"エラーを注入する確率", c.ErrorRate},
+		{"公開鍵を破損させる確率", c.CorruptKeyRate},
+		{"暗号文を破損させる確率", c.CorruptCiphertextRate},
+	} {
+		if r.rate < 0 || r.rate > 1 {
+			return fmt.Errorf("%sは0〜1で指定してください: %v", r.name, r.rate)
+		}
+	}
+	return nil
+}
+
+// いずれかの障害を注入するか
+func (c Config) Enabled() bool {
+	return (c.Latency > 0 && c.LatencyRate > 0) || c.ErrorRate > 0 || c.CorruptKeyRate > 0 || c.CorruptCiphertextRate > 0
+}
+
+// -chaos-* フラグを登録する（prefixはサーバーを区別する場合に使う、例: "rsa-"）
+func (c *Config) RegisterFlags(fs *flag.FlagSet, prefix string) {
+	fs.DurationVar(&c.Latency, "chaos-"+prefix+"latency", c.Latency, "【カオステスト】注入する遅延")
+	fs.Float64Var(&c.LatencyRate, "chaos-"+prefix+"latency-rate", c.LatencyRate, "【カオステスト】リクエストに遅延を注入する確率（0〜1）")
+	fs.Float64Var(&c.ErrorRate, "chaos-"+prefix+"error-rate", c.ErrorRate, "【カオステスト】503を返す確率（0〜1）")
+	fs.Float64Var(&c.CorruptKeyRate, "chaos-"+prefix+"corrupt-key-rate", c.CorruptKeyRate, "【カオステスト】公開鍵の1バイトを反転して返す確率（0〜1）")
+	fs.Float64Var(&c.CorruptCiphertextRate, "chaos-"+prefix+"corrupt-ciphertext-rate", c.CorruptCiphertextRate, "【カオステスト】受け取った暗号文の1バイトを反転する確率（0〜1）")
+}
+
+// サーバーに障害を注入する（nilの場合は何もしない）
+type Injector struct {
+	server string
+	cfg    Config
+}
+
+// 障害を注入しない設定の場合はnilを返す
+func New(server string, cfg Config) *Injector {
+	if !cfg.Enabled() {
+		return nil
+	}
+	return &Injector{server: server, cfg: cfg}
+}
+
+// 確率に従って遅延と503をリクエストに注入する
+func (i *Injector) Wrap(next http.HandlerFunc) http.HandlerFunc {
+	if i == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if i.cfg.Latency > 0 && i.hit(i.cfg.LatencyRate, KindLatency) {
+			time.Sleep(i.cfg.Latency)
+		}
+		if i.hit(i.cfg.ErrorRate, KindError) {
+			http.Error(w, "注入されたエラーです（カオステスト）", http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// 確率に従って公開鍵を破損させる（元のスライスは変更しない）
+func (i *Injector) CorruptKey(key []byte) []byte {
+	if i == nil {
+		return key
+	}
+	return i.corrupt(key, i.cfg.CorruptKeyRate, KindCorruptKey)
+}
+
+// 確率に従って受け取った暗号文を破損させる（元のスライスは変更しない）
+func (i *Injector) CorruptCiphertext(ciphertext []byte) []byte {
+	if i == nil {
+		return ciphertext
+	}
+	return i.corrupt(ciphertext, i.cfg.CorruptCiphertextRate, KindCorruptCiphertext)
+}
+
+func (i *Injector) corrupt(b []byte, rate float64, kind string) []byte {
+	if len(b) == 0 || !i.hit(rate, kind) {
+		return b
+	}
+	corrupted := append([]byte(nil), b...)
+	corrupted[rand.IntN(len(corrupted))] ^= 0xff
+	return corrupted
+}
+
+// 確率rateで注入するかを決め、注入する場合は記録する
+func (i *Injector) hit(rate float64, kind string) bool {
+	if rate <= 0 || rand.Float64() >= rate {
+		return false
+	}
+	injections.WithLabelValues(i.server, kind).Inc()
+	return true
+}
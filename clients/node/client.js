@@ -0,0 +1,168 @@
+// RSAサーバーとハイブリッド暗号化を行うNode.jsの参照クライアント
+// ワイヤーフォーマットは clients/README.md を参照（Goのクライアントと同じ手順）
+// 外部ライブラリは使わず、メトリクスもPrometheusのテキスト形式で直接出力する
+'use strict';
+
+const crypto = require('node:crypto');
+const http = require('node:http');
+
+const SERVICE = 'aes-client-node';
+const TRANSPORT = 'network';
+const DATA_ALGORITHM = 'AES-256-CBC-HMAC-SHA256';
+const BUCKETS = [0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1];
+
+const rsaURL = process.env.RSA_URL || 'http://localhost:8080/public-key';
+const intervalMs = Number(process.env.INTERVAL_MS || 1000);
+const metricsPort = Number(process.env.METRICS_PORT || 8094);
+const message = Buffer.from('量子コンピュータに対抗するポスト量子暗号');
+
+// ---- メトリクス（Goのクライアントと同じ名前・ラベル。serviceラベルで言語を区別する）
+
+const sessions = new Map(); // "algorithm,transport,result" → 件数
+const phases = new Map(); // "algorithm,transport,phase" → 秒
+const verifications = new Map(); // "target,result" → 件数
+const durations = new Map(); // "algorithm,transport" → {buckets, sum, count}
+
+function inc(map, key) {
+  map.set(key, (map.get(key) || 0) + 1);
+}
+
+function observe(algorithm, seconds) {
+  const key = `${algorithm},${TRANSPORT}`;
+  let h = durations.get(key);
+  if (!h) {
+    h = { buckets: BUCKETS.map(() => 0), sum: 0, count: 0 };
+    durations.set(key, h);
+  }
+  BUCKETS.forEach((b, i) => {
+    if (seconds <= b) h.buckets[i]++;
+  });
+  h.sum += seconds;
+  h.count++;
+}
+
+function labels(names, key, extra = '') {
+  const values = key.split(',');
+  const pairs = names.map((n, i) => `${n}="${values[i]}"`);
+  pairs.push(`service="${SERVICE}"`);
+  if (extra) pairs.push(extra);
+  return `{${pairs.join(',')}}`;
+}
+
+function exposition() {
+  const lines = [];
+  lines.push('# HELP client_sessions_total Total number of key agreement sessions, by result');
+  lines.push('# TYPE client_sessions_total counter');
+  for (const [k, v] of sessions) lines.push(`client_sessions_total${labels(['algorithm', 'transport', 'result'], k)} ${v}`);
+  lines.push('# HELP client_session_duration_seconds Duration of a complete key agreement session (fetch, wrap, send, server derive, confirm) in seconds');
+  lines.push('# TYPE client_session_duration_seconds histogram');
+  for (const [k, h] of durations) {
+    BUCKETS.forEach((b, i) => lines.push(`client_session_duration_seconds_bucket${labels(['algorithm', 'transport'], k, `le="${b}"`)} ${h.buckets[i]}`));
+    lines.push(`client_session_duration_seconds_bucket${labels(['algorithm', 'transport'], k, 'le="+Inf"')} ${h.count}`);
+    lines.push(`client_session_duration_seconds_sum${labels(['algorithm', 'transport'], k)} ${h.sum}`);
+    lines.push(`client_session_duration_seconds_count${labels(['algorithm', 'transport'], k)} ${h.count}`);
+  }
+  lines.push('# HELP client_session_phase_duration_seconds Duration of each phase of the latest key agreement session in seconds');
+  lines.push('# TYPE client_session_phase_duration_seconds gauge');
+  for (const [k, v] of phases) lines.push(`client_session_phase_duration_seconds${labels(['algorithm', 'transport', 'phase'], k)} ${v}`);
+  lines.push('# HELP client_decrypt_verifications_total Total number of server-side decryption checks, by result');
+  lines.push('# TYPE client_decrypt_verifications_total counter');
+  for (const [k, v] of verifications) lines.push(`client_decrypt_verifications_total${labels(['target', 'result'], k)} ${v}`);
+  return lines.join('\n') + '\n';
+}
+
+// ---- ハイブリッド暗号化
+
+// データ鍵から暗号化用の鍵とMAC用の鍵を導出する
+function deriveKeys(key) {
+  const derive = (label) => crypto.createHmac('sha256', key).update(label).digest();
+  return [derive('pqc-grafana cbc encryption key'), derive('pqc-grafana cbc mac key')];
+}
+
+// AES-256-CBCで暗号化し、IVと暗号文にHMAC-SHA256を付与する（Encrypt-then-MAC、PKCS#7パディング）
+function encryptCBCHMAC(key, plaintext) {
+  const [encKey, macKey] = deriveKeys(key);
+  const iv = crypto.randomBytes(16);
+  const cipher = crypto.createCipheriv('aes-256-cbc', encKey, iv);
+  const ciphertext = Buffer.concat([cipher.update(plaintext), cipher.final()]);
+  const mac = crypto.createHmac('sha256', macKey).update(iv).update(ciphertext).digest();
+  return { iv, ciphertext, mac };
+}
+
+function serverNanos(timing) {
+  return timing ? timing.processing_ns : 0;
+}
+
+async function runRSA() {
+  const start = process.hrtime.bigint();
+  const since = (t) => Number(process.hrtime.bigint() - t) / 1e9;
+
+  // Step 1: 公開鍵を取得（PKIX DERのBase64）
+  let t = process.hrtime.bigint();
+  const keyResp = await fetch(rsaURL);
+  if (!keyResp.ok) throw new Error(`公開鍵の取得に失敗: HTTP ${keyResp.status}`);
+  const pub = await keyResp.json();
+  const publicKey = crypto.createPublicKey({ key: Buffer.from(pub.public_key, 'base64'), format: 'der', type: 'spki' });
+  const fetchSeconds = since(t);
+
+  // Step 2: AES鍵を生成し、RSA-OAEP（SHA-256）で暗号化する
+  t = process.hrtime.bigint();
+  const aesKey = crypto.randomBytes(32);
+  const wrappedKey = crypto.publicEncrypt({ key: publicKey, padding: crypto.constants.RSA_PKCS1_OAEP_PADDING, oaepHash: 'sha256' }, aesKey);
+  const wrapSeconds = since(t);
+
+  // Step 3: メッセージを暗号化して送信し、サーバーが返す平文のSHA-256を確認する
+  const sealed = encryptCBCHMAC(aesKey, message);
+  t = process.hrtime.bigint();
+  const decResp = await fetch(new URL('/decrypt', rsaURL), {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({
+      key_id: pub.key_id,
+      algorithm: DATA_ALGORITHM,
+      encrypted_aes_key: wrappedKey.toString('base64'),
+      encrypted_message: sealed.ciphertext.toString('base64'),
+      iv: sealed.iv.toString('base64'),
+      mac: sealed.mac.toString('base64'),
+    }),
+  });
+  if (!decResp.ok) throw new Error(`復号に失敗: HTTP ${decResp.status} ${await decResp.text()}`);
+  const dec = await decResp.json();
+  const roundTrip = since(t);
+  const serverDerive = serverNanos(dec.server_timing) / 1e9;
+
+  const digest = crypto.createHash('sha256').update(message).digest('base64');
+  if (dec.plaintext_sha256 !== digest) {
+    inc(verifications, 'rsa,mismatch');
+    throw new Error('復号結果のハッシュが一致しません');
+  }
+  inc(verifications, 'rsa,ok');
+
+  const phaseSeconds = { fetch: fetchSeconds, wrap: wrapSeconds, send: Math.max(roundTrip - serverDerive, 0), server_derive: serverDerive };
+  for (const [phase, seconds] of Object.entries(phaseSeconds)) phases.set(`rsa,${TRANSPORT},${phase}`, seconds);
+  observe('rsa', since(start));
+}
+
+async function tick(counter) {
+  try {
+    await runRSA();
+    inc(sessions, `rsa,${TRANSPORT},success`);
+  } catch (err) {
+    inc(sessions, `rsa,${TRANSPORT},failure`);
+    console.error(`暗号化 #${counter} に失敗: ${err.message}`);
+  }
+}
+
+http
+  .createServer((req, res) => {
+    if (req.url !== '/metrics') {
+      res.writeHead(404).end();
+      return;
+    }
+    res.writeHead(200, { 'Content-Type': 'text/plain; version=0.0.4' });
+    res.end(exposition());
+  })
+  .listen(metricsPort, () => console.log(`メトリクスサーバーを起動: http://localhost:${metricsPort}/metrics`));
+
+let counter = 0;
+setInterval(() => tick(++counter), intervalMs);
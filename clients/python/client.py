@@ -0,0 +1,145 @@
+"""RSAサーバーとハイブリッド暗号化を行うPythonの参照クライアント
+
+ワイヤーフォーマットは clients/README.md を参照（Goのクライアントと同じ手順）
+"""
+
+import base64
+import hashlib
+import hmac
+import json
+import os
+import sys
+import time
+import urllib.parse
+import urllib.request
+
+from cryptography.hazmat.primitives import hashes, padding
+from cryptography.hazmat.primitives.asymmetric import padding as asym_padding
+from cryptography.hazmat.primitives.ciphers import Cipher, algorithms, modes
+from cryptography.hazmat.primitives.serialization import load_der_public_key
+from prometheus_client import Counter, Gauge, Histogram, start_http_server
+
+SERVICE = "aes-client-python"
+TRANSPORT = "network"
+DATA_ALGORITHM = "AES-256-CBC-HMAC-SHA256"
+
+RSA_URL = os.environ.get("RSA_URL", "http://localhost:8080/public-key")
+INTERVAL = float(os.environ.get("INTERVAL_MS", "1000")) / 1000
+METRICS_PORT = int(os.environ.get("METRICS_PORT", "8093"))
+MESSAGE = "量子コンピュータに対抗するポスト量子暗号".encode()
+
+# Goのクライアントと同じ名前・ラベル。serviceラベルで言語を区別する
+sessions_total = Counter(
+    "client_sessions_total",
+    "Total number of key agreement sessions, by result",
+    ["algorithm", "transport", "result", "service"],
+)
+session_duration = Histogram(
+    "client_session_duration_seconds",
+    "Duration of a complete key agreement session (fetch, wrap, send, server derive, confirm) in seconds",
+    ["algorithm", "transport", "service"],
+    buckets=[0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1],
+)
+session_phase_duration = Gauge(
+    "client_session_phase_duration_seconds",
+    "Duration of each phase of the latest key agreement session in seconds",
+    ["algorithm", "transport", "phase", "service"],
+)
+decrypt_verifications = Counter(
+    "client_decrypt_verifications_total",
+    "Total number of server-side decryption checks, by result",
+    ["target", "result", "service"],
+)
+
+
+def derive_keys(key):
+    """データ鍵から暗号化用の鍵とMAC用の鍵を導出する"""
+    def derive(label):
+        return hmac.new(key, label, hashlib.sha256).digest()
+    return derive(b"pqc-grafana cbc encryption key"), derive(b"pqc-grafana cbc mac key")
+
+
+def encrypt_cbc_hmac(key, plaintext):
+    """AES-256-CBCで暗号化し、IVと暗号文にHMAC-SHA256を付与する（Encrypt-then-MAC、PKCS#7パディング）"""
+    enc_key, mac_key = derive_keys(key)
+    iv = os.urandom(16)
+    padder = padding.PKCS7(128).padder()
+    padded = padder.update(plaintext) + padder.finalize()
+    encryptor = Cipher(algorithms.AES(enc_key), modes.CBC(iv)).encryptor()
+    ciphertext = encryptor.update(padded) + encryptor.finalize()
+    mac = hmac.new(mac_key, iv + ciphertext, hashlib.sha256).digest()
+    return iv, ciphertext, mac
+
+
+def b64(data):
+    return base64.b64encode(data).decode()
+
+
+def run_rsa():
+    start = time.perf_counter()
+
+    # Step 1: 公開鍵を取得（PKIX DERのBase64）
+    t = time.perf_counter()
+    with urllib.request.urlopen(RSA_URL, timeout=10) as resp:
+        pub = json.load(resp)
+    public_key = load_der_public_key(base64.b64decode(pub["public_key"]))
+    fetch = time.perf_counter() - t
+
+    # Step 2: AES鍵を生成し、RSA-OAEP（SHA-256）で暗号化する
+    t = time.perf_counter()
+    aes_key = os.urandom(32)
+    wrapped_key = public_key.encrypt(
+        aes_key,
+        asym_padding.OAEP(mgf=asym_padding.MGF1(hashes.SHA256()), algorithm=hashes.SHA256(), label=None),
+    )
+    wrap = time.perf_counter() - t
+
+    # Step 3: メッセージを暗号化して送信し、サーバーが返す平文のSHA-256を確認する
+    iv, ciphertext, mac = encrypt_cbc_hmac(aes_key, MESSAGE)
+    body = json.dumps({
+        "key_id": pub["key_id"],
+        "algorithm": DATA_ALGORITHM,
+        "encrypted_aes_key": b64(wrapped_key),
+        "encrypted_message": b64(ciphertext),
+        "iv": b64(iv),
+        "mac": b64(mac),
+    }).encode()
+    req = urllib.request.Request(
+        urllib.parse.urljoin(RSA_URL, "/decrypt"),
+        data=body,
+        headers={"Content-Type": "application/json"},
+    )
+    t = time.perf_counter()
+    with urllib.request.urlopen(req, timeout=10) as resp:
+        dec = json.load(resp)
+    round_trip = time.perf_counter() - t
+    server_derive = (dec.get("server_timing") or {}).get("processing_ns", 0) / 1e9
+
+    if dec["plaintext_sha256"] != b64(hashlib.sha256(MESSAGE).digest()):
+        decrypt_verifications.labels("rsa", "mismatch", SERVICE).inc()
+        raise ValueError("復号結果のハッシュが一致しません")
+    decrypt_verifications.labels("rsa", "ok", SERVICE).inc()
+
+    phases = {"fetch": fetch, "wrap": wrap, "send": max(round_trip - server_derive, 0), "server_derive": server_derive}
+    for phase, seconds in phases.items():
+        session_phase_duration.labels("rsa", TRANSPORT, phase, SERVICE).set(seconds)
+    session_duration.labels("rsa", TRANSPORT, SERVICE).observe(time.perf_counter() - start)
+
+
+def main():
+    start_http_server(METRICS_PORT)
+    print(f"メトリクスサーバーを起動: http://localhost:{METRICS_PORT}/metrics")
+    counter = 0
+    while True:
+        counter += 1
+        try:
+            run_rsa()
+            sessions_total.labels("rsa", TRANSPORT, "success", SERVICE).inc()
+        except Exception as e:  # 1回の失敗で計測を止めない
+            sessions_total.labels("rsa", TRANSPORT, "failure", SERVICE).inc()
+            print(f"暗号化 #{counter} に失敗: {e}", file=sys.stderr)
+        time.sleep(INTERVAL)
+
+
+if __name__ == "__main__":
+    main()
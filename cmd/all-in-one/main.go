@@ -0,0 +1,451 @@
+// all-in-one はRSAサーバー、ML-KEMサーバー、クライアントを1つのプロセスで起動する
+// docker-composeが使えない環境（ノートPCや授業など）向けのデモ用バイナリ
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/keyi1000/PQC_grafana/annotation"
+	"github.com/keyi1000/PQC_grafana/auditlog"
+	"github.com/keyi1000/PQC_grafana/benchclient"
+	"github.com/keyi1000/PQC_grafana/certchain"
+	"github.com/keyi1000/PQC_grafana/chaos"
+	"github.com/keyi1000/PQC_grafana/codesign"
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/keyi1000/PQC_grafana/datagram"
+	"github.com/keyi1000/PQC_grafana/dnssecbench"
+	"github.com/keyi1000/PQC_grafana/dualserver"
+	"github.com/keyi1000/PQC_grafana/ecdhserver"
+	"github.com/keyi1000/PQC_grafana/features"
+	"github.com/keyi1000/PQC_grafana/fips"
+	"github.com/keyi1000/PQC_grafana/internal/httpmw"
+	"github.com/keyi1000/PQC_grafana/kembench"
+	"github.com/keyi1000/PQC_grafana/keyarchive"
+	"github.com/keyi1000/PQC_grafana/keystore"
+	"github.com/keyi1000/PQC_grafana/kms"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/mlkemserver"
+	"github.com/keyi1000/PQC_grafana/multirecipient"
+	"github.com/keyi1000/PQC_grafana/pgpbench"
+	"github.com/keyi1000/PQC_grafana/recorder"
+	"github.com/keyi1000/PQC_grafana/replay"
+	"github.com/keyi1000/PQC_grafana/resultcollector"
+	"github.com/keyi1000/PQC_grafana/rsaserver"
+	"github.com/keyi1000/PQC_grafana/selfbench"
+	"github.com/keyi1000/PQC_grafana/soak"
+	"github.com/keyi1000/PQC_grafana/sshkex"
+	"github.com/keyi1000/PQC_grafana/tlssim"
+	"github.com/keyi1000/PQC_grafana/tokenbench"
+	"github.com/keyi1000/PQC_grafana/vpnsim"
+)
+
+func main() {
+	rsaAddr := flag.String("rsa-addr", ":8080", "RSAサーバーの待ち受けアドレス（例: :8080 はIPv4とIPv6の両方、[::1]:8080、tcp6::8080、unix:/tmp/rsa.sock）")
+	mlkemAddr := flag.String("mlkem-addr", ":8081", "ML-KEMサーバーの待ち受けアドレス")
+	dualAddr := flag.String("dual-addr", "", "二重保護サーバーの待ち受けアドレス（空の場合は起動しない）")
+	ecdhAddr := flag.String("ecdh-addr", "", "ECDH（P-256）サーバーの待ち受けアドレス（空の場合は起動しない）")
+	unixSocketDir := flag.String("unix-socket-dir", "", "指定するとRSAサーバーとML-KEMサーバーをこのディレクトリのUnixドメインソケットでも待ち受け、TCPを介さない鍵合意も計測する")
+	collectorAddr := flag.String("collector-addr", "", "計測結果の集約サーバーの待ち受けアドレス（指定するとクライアントが計測結果をML-KEMのハイブリッド暗号化で保護して送る、空の場合は起動しない）")
+	metricsAddr := flag.String("metrics-addr", ":8082", "クライアントのメトリクスの待ち受けアドレス")
+	cfg := benchclient.DefaultConfig()
+	flag.Func("aes-key-sizes", "暗号化ごとに順に使うAES鍵のサイズ（ビット、128・192・256をカンマ区切り、例: 128,256、既定は256のみ）", func(s string) (err error) {
+		cfg.AESKeySizes, err = benchclient.ParseAESKeySizes(s)
+		return err
+	})
+	flag.StringVar(&cfg.DataCipher, "data-cipher", cryptoutil.FamilyCBCHMAC, "メッセージの暗号化方式（aes-cbc-hmac / aes-gcm / aes-gcm-siv / chacha20-poly1305、AES-NIのない環境の比較にはchacha20-poly1305、ノンスの再利用への耐性の比較にはaes-gcm-siv）")
+	flag.StringVar(&cfg.NonceMode, "nonce-mode", cryptoutil.NonceRandom, "AEADのノンスの生成方式（random: 乱数、counter: 鍵ごとの固定部とカウンター、AES-CBCのIVは常に乱数）")
+	flag.StringVar(&cfg.KeyWrap, "key-wrap", "", "AES鍵のラップ方式（空: RSAはRSA-OAEPで直接、ML-KEMとECDHはAES-256-GCM、aes-kw: KEKを確立してからAESキーラップ（RFC 3394））")
+	flag.Float64Var(&cfg.RatioEWMAAlpha, "ratio-ewma-alpha", cfg.RatioEWMAAlpha, "ML-KEMとRSA・ECDHの比率の指数移動平均（client_ratio_ewma）の平滑化係数（0より大きく1以下、大きいほど直近の計測を重視する）")
+	flag.DurationVar(&cfg.ResultsInterval, "results-interval", cfg.ResultsInterval, "-collector-addr に計測結果をまとめて送る間隔")
+	flag.DurationVar(&cfg.Interval, "interval", cfg.Interval, "ハイブリッド暗号化を実行する間隔")
+	flag.IntVar(&cfg.RekeyEvery, "rekey-every", cfg.RekeyEvery, "長期間のセッションでNメッセージごとに鍵を更新する模擬を行う（0の場合は毎回鍵合意する）")
+	kems := flag.Bool("kems", false, "登録されたすべてのKEMでML-KEMサーバーの/kemsと鍵交換を行い、プロセス内のベンチマークも実行する")
+	flag.BoolVar(&cfg.CMSOutput, "cms", false, "暗号化データをCMSのEnvelopedData（RSAはKeyTransRecipientInfo、ML-KEMはKEMRecipientInfo）としても作成し、サイズを記録する")
+	flag.BoolVar(&cfg.Calibrate, "calibrate", false, "セッションごとに暗号処理を行わない同じ形のHTTPとJSONの往復（/calibrate）も計測し、基準値として記録する")
+	cfg.Netem.RegisterFlags(flag.CommandLine, "")
+	datagrams := flag.Bool("datagram", false, "両サーバーをUDPのデータグラムでも待ち受け、データグラムでの鍵合意も計測する")
+	cfg.Datagram.RegisterFlags(flag.CommandLine)
+	flag.BoolVar(&cfg.KeyNonce, "key-nonce", false, "公開鍵をPOSTでnonceを付けて取得し、レスポンスがnonceに結び付いていることを確認する（鍵の鮮度の確認）")
+	flag.BoolVar(&cfg.ConditionalFetch, "conditional-key-fetch", false, "公開鍵をIf-None-Matchを付けて取得し、変わっていなければ（304）前回の公開鍵を使う（staticモードのサーバーのみ）")
+	flag.BoolVar(&cfg.KeySet, "key-set", false, "RSA・ML-KEMの公開鍵をGET /keys の一覧（JWK Set）でまとめて取得してCache-Controlに従ってキャッシュし、セッションごとに順に使う（staticモードのサーバーのみ、ephemeralモードでは個別に取得する）")
+	flag.DurationVar(&cfg.KeyCacheTTL, "key-cache-ttl", cfg.KeyCacheTTL, "staticモードの公開鍵をキャッシュして使い回す時間（サーバーのCache-Controlのmax-ageが短ければそれに従い、ephemeralモードとno-storeの公開鍵はキャッシュしない、0の場合はキャッシュしない）")
+	flag.BoolVar(&cfg.FetchKeyPerSession, "fetch-key-every-session", false, "公開鍵のキャッシュと鍵の一覧を使わず、セッションごとに公開鍵を取得する（以前の動作、取得のネットワークの時間を毎回計測する）")
+	flag.BoolVar(&cfg.LegacyEnvelope, "legacy-envelope", false, "暗号化データの形式の版をAccept-Versionで交渉せず、versionのない暗号化データを送る（版を知らない古いクライアントの模擬）")
+	flag.BoolVar(&cfg.KeySignature, "verify-key-signature", false, "ML-KEM公開鍵のレスポンスのML-DSA署名をカプセル化の前に検証する（署名鍵は最初に/signing-keyから取得する）")
+	signingKeyFile := flag.String("mlkem-signing-key-file", "", "ML-KEMサーバーが公開鍵に署名するML-DSA-65の鍵のシードを保存するファイル（空の場合は起動ごとに生成する）")
+	loopback := flag.Bool("loopback", false, "ネットワークを介さずにハンドラーを直接呼び出す計測も行う")
+	keyMode := flag.String("key-mode", rsaserver.KeyModeEphemeral, "両サーバーの鍵の運用モード: ephemeral / static")
+	keyLifetime := flag.Duration("key-lifetime", 0, "staticモードで鍵ペアを更新するまでの時間（0の場合は更新しない）")
+	activeKeys := flag.Int("active-keys", 1, "staticモードで両サーバーが同時に使う鍵ペアの数（鍵IDで区別し、新しいセッションに順に渡す）")
+	keyMaxAge := flag.Duration("key-max-age", 0, "staticモードの公開鍵のレスポンスをキャッシュしてよい時間（Cache-Controlのmax-age、0の場合はno-cacheで毎回ETagによる再検証を求める）")
+	vulnerable := flag.Bool("vulnerable-mode", false, "【教育用】両サーバーでパディングを先に検査する脆弱な復号を使う")
+	oracle := flag.Bool("insecure-oracle", false, "【教育用】両サーバーを復号エラーの種類を返すパディングオラクルとして動作させる")
+	replayWindow := flag.Duration("replay-window", 0, "各サーバーの復号エンドポイントで再送を検出し、request_nonceとtimestampのない要求・現在時刻との差がこの時間を超える要求・既に受け付けた要求を拒否する（0の場合は検出しない）")
+	replayCacheSize := flag.Int("replay-cache-size", replay.DefaultCacheSize, "-replay-window で各サーバーが記録する要求の数の上限（上限に達した場合は期限切れまで新しい要求を503で拒否する）")
+	archivePath := flag.String("key-archive", "", "両サーバーが生成した鍵ペア（秘密鍵を含む）を追記して保存するファイル（key-archive-replayで過去の暗号化データを再生するため、研究用、空の場合は保存しない）")
+	auditPath := flag.String("audit-log", "", "各サーバーの秘密鍵による操作（復号・カプセル化の解除・鍵合意・署名、リクエストIDとクライアント）をハッシュで連鎖させて追記する監査ログのファイル（audit-log-verifyで検証する、空の場合は記録しない）")
+	archiveCiphertexts := flag.Bool("key-archive-ciphertexts", false, "-key-archive に復号できた暗号化データと平文のSHA-256も保存する")
+	var rsaChaos, mlkemChaos chaos.Config
+	rsaChaos.RegisterFlags(flag.CommandLine, "rsa-")
+	kmsConfig := kms.DefaultConfig()
+	kmsConfig.RegisterFlags(flag.CommandLine)
+	storeConfig := keystore.DefaultConfig()
+	storeConfig.RegisterFlags(flag.CommandLine)
+	mlkemChaos.RegisterFlags(flag.CommandLine, "mlkem-")
+	tokens := flag.Bool("tokens", false, "JWTの署名方式の比較ベンチマークも実行する")
+	pgp := flag.Bool("pgp", false, "OpenPGPとハイブリッド暗号化のメッセージサイズの比較ベンチマークも実行する")
+	ssh := flag.Bool("ssh", false, "SSHの鍵交換方式の比較ベンチマークも実行する")
+	certChains := flag.Bool("cert-chains", false, "RSA・ECDSA・ML-DSA・複合署名の証明書チェーンのサイズと検証時間の比較ベンチマークも実行する")
+	tlsSim := flag.Bool("tls-sim", false, "鍵交換方式と署名方式の組み合わせごとにTLS 1.3のハンドシェイクのバイト数とフライト数も見積もる")
+	dnssec := flag.Bool("dnssec", false, "DNSSECと同じ形式でRSA・ECDSA・ML-DSA・SLH-DSAによりRRsetを署名し、応答のサイズと増幅率も計測する")
+	vpnSim := flag.Bool("vpn-sim", false, "WireGuardと同じ形のVPNのハンドシェイクをX25519とML-KEMのハイブリッドで行い、応答側の処理能力も比較する")
+	codeSign := flag.Bool("code-sign", false, "ファームウェアのような大きな成果物（1〜500MB）の署名と検証のスループットもRSA・ECDSA・ML-DSA・SLH-DSAで比較する")
+	scalingStudy := flag.Duration("scaling-study", 0, "起動時にGOMAXPROCSを1, 2, 4, ...とCPU数まで増やしながら、RSA-OAEPの復号とML-KEMの脱カプセル化の負荷計測を順に指定した時間ずつ行い、並列化の効率を記録する（0の場合は行わない）")
+	scalingMaxProcs := flag.Int("scaling-max-procs", 0, "-scaling-study で増やすGOMAXPROCSの最大値（0の場合はCPU数）")
+	multiRecipient := flag.Bool("multi-recipient", false, "複数の受信者向けにAES鍵を保護するRSAとML-KEMの比較ベンチマークも実行する")
+	record := flag.Bool("record", false, "両サーバーへの暗号化データを盗聴し、後で解読されうるデータ量を記録する")
+	flag.BoolVar(&cfg.FIPS, "fips", false, "FIPS承認済みの方式（ML-KEM-768/1024、RSA 3072ビット以上、AES-256-GCM）だけを使い、承認されていない操作の試行を記録する")
+	flag.IntVar(&cfg.BatchSize, "batch", 0, "毎回ML-KEMサーバーの/encapsulate-batchでN回カプセル化させ、HTTPを除いた1回あたりの時間を記録する（最大10000、0の場合は実行しない）")
+	flag.Func("operation-mix", "1回の間隔で実行する操作の種類ごとの回数（例: encrypt=6,roundtrip=3,sign=1、encryptは暗号化のみ、roundtripはサーバーでの復号の確認まで、signはML-KEM公開鍵への署名と検証、指定しない場合は毎回roundtripを1回）", func(s string) error {
+		var err error
+		cfg.OperationMix, err = benchclient.ParseOperationMix(s)
+		return err
+	})
+	flag.Func("corpus", "暗号化するメッセージのコーパス（[name=]kind[:args]、kindはdefault / file:PATH / random:SIZE / repeat:PATTERN:COUNT / empty / unicode、複数指定可）", func(s string) error {
+		c, err := benchclient.ParseCorpus(s)
+		if err != nil {
+			return err
+		}
+		cfg.Corpora = append(cfg.Corpora, c)
+		return nil
+	})
+	flag.DurationVar(&cfg.ScrapeInterval, "scrape-interval", 0, "Prometheusのスクレイプ間隔（指定すると-intervalの代わりにこの間隔を-ops-per-scrapeで割った間隔で暗号化する）")
+	flag.IntVar(&cfg.OpsPerScrape, "ops-per-scrape", 1, "-scrape-interval の1回のスクレイプあたりに暗号化する回数（1の場合はゲージの値が上書きされない）")
+	flag.IntVar(&cfg.Burst, "burst", 1, "1回のティックでN回続けて暗号化し、バーストの中での所要時間のパーセンタイルを記録する（ティックの間隔はN倍にして平均の実行頻度は変えない）")
+	flag.BoolVar(&cfg.FixedRate, "fixed-rate", false, "1回の実行が間隔を超えた場合に溜まったティックをまとめず、遅れた分を続けて実行して実行頻度を保つ（未実行の数をclient_loop_backlogに記録する）")
+	flag.Float64Var(&cfg.AdaptiveCV, "adaptive-cv", 0, "直近のセッションの所要時間の変動係数がこの値（例: 0.3）を超えている間は実行頻度を上げる（0の場合は無効）")
+	flag.IntVar(&cfg.AdaptiveMaxFactor, "adaptive-max-factor", cfg.AdaptiveMaxFactor, "-adaptive-cv で実行頻度を上げる最大の倍率")
+	runID := flag.String("run-id", "", "すべてのメトリクスにrun_idラベルとして付与する実行ID（同じPrometheusで複数の計測を区別する）")
+	experiment := flag.String("experiment", "", "すべてのメトリクスにexperimentラベルとして付与する実験名")
+	flag.Func("metric-namespace", "すべてのメトリクス名の前に付ける名前空間（例: lab1 → lab1_client_...）", metrics.SetNamespace)
+	flag.Func("metric-prefix", "サービスのメトリクス名の接頭辞を上書きする（service=prefix、例: aes-client=fork_client_、複数指定可）", metrics.ParsePrefix)
+	flag.Func("metrics-auth", "/metricsにBasic認証を要求する（user:password、環境変数METRICS_AUTHでも指定できる）", metrics.SetBasicAuth)
+	httpmw.RegisterAuthFlags(flag.CommandLine)
+	noRuntimeMetrics := flag.Bool("no-runtime-metrics", false, "Goランタイムとプロセスのメトリクス（go_*、process_*）を公開しない")
+	nativeHistograms := flag.Bool("native-histograms", false, "所要時間のヒストグラムをネイティブヒストグラム（スパースなバケット）としても公開する（Prometheusでnative histogramsを有効にしてprotobuf形式で取得する）")
+	grafanaURL := flag.String("grafana-url", "", "鍵の更新や設定の変更をアノテーションとして送るGrafanaのURL（環境変数GRAFANA_URLでも指定できる、空の場合は送らない）")
+	grafanaToken := flag.String("grafana-token", "", "GrafanaのAPIトークン（環境変数GRAFANA_API_TOKENでも指定できる）")
+	soakMode := flag.Bool("soak", false, "長時間の連続運転でヒープ・ゴルーチン・ファイルディスクリプタの増加を監視し、リークの疑いを記録する")
+	soakConfig := soak.DefaultConfig()
+	flag.DurationVar(&soakConfig.SampleInterval, "soak-interval", soakConfig.SampleInterval, "-soak で使用量を記録する間隔")
+	flag.DurationVar(&soakConfig.Window, "soak-window", soakConfig.Window, "-soak でリークを判定する期間")
+	flag.StringVar(&cfg.ConfigFile, "config", "", "起動時とSIGHUPで読み込む設定ファイル（interval、payload_size、algorithms、各URLのJSON）")
+	flag.StringVar(&cfg.AdminToken, "admin-token", "", "POST /config に必要なBearerトークン（環境変数ADMIN_TOKENでも指定できる、空の場合は変更を受け付けない）")
+	flag.StringVar(&cfg.ServerToken, "server-token", "", "サーバーの -auth-token に対して送るoperatorのロールのBearerトークン（環境変数SERVER_TOKENでも指定できる）")
+	features.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if cfg.AdminToken == "" {
+		cfg.AdminToken = os.Getenv("ADMIN_TOKEN")
+	}
+	if cfg.ServerToken == "" {
+		cfg.ServerToken = os.Getenv("SERVER_TOKEN")
+	}
+	metrics.SetRunLabels(*runID, *experiment)
+	if *noRuntimeMetrics {
+		metrics.DisableRuntimeCollectors()
+	}
+	if *nativeHistograms {
+		metrics.EnableNativeHistograms()
+	}
+	if err := annotation.Configure(*grafanaURL, *grafanaToken); err != nil {
+		log.Fatal("設定エラー:", err)
+	}
+	annotation.PostVersion()
+	if *soakMode {
+		soak.Start(soakConfig)
+	}
+	if cfg.FIPS {
+		// サーバーの/kemsとベンチマークが起動する前に登録先を制限する
+		fips.Enable()
+	}
+
+	dualConfig := dualserver.Config{ReplayWindow: *replayWindow, ReplayCacheSize: *replayCacheSize}
+	ecdhConfig := ecdhserver.Config{ReplayWindow: *replayWindow, ReplayCacheSize: *replayCacheSize}
+	rsaConfig := rsaserver.Config{KeyMode: *keyMode, KeyLifetime: *keyLifetime, KeyMaxAge: *keyMaxAge, ActiveKeys: *activeKeys, VulnerableMode: *vulnerable, InsecureOracle: *oracle, Chaos: rsaChaos, ReplayWindow: *replayWindow, ReplayCacheSize: *replayCacheSize}
+	mlkemConfig := mlkemserver.Config{KeyMode: *keyMode, KeyLifetime: *keyLifetime, KeyMaxAge: *keyMaxAge, ActiveKeys: *activeKeys, VulnerableMode: *vulnerable, InsecureOracle: *oracle, Chaos: mlkemChaos, ReplayWindow: *replayWindow, ReplayCacheSize: *replayCacheSize}
+	kmsBackend, err := kms.New(kmsConfig)
+	if err != nil {
+		log.Fatal("設定エラー:", err)
+	}
+	rsaConfig.KMS = kmsBackend
+	if kmsBackend != nil {
+		// KMSの鍵は1つのため、複数の鍵ペアはML-KEMサーバーだけで使う
+		rsaConfig.ActiveKeys = 1
+	}
+	// 両サーバーで1つの保存先を使う（サービス名ごとのパスに保存する、KMSを使うRSAの鍵は保存しない）
+	store, err := keystore.New(storeConfig)
+	if err != nil {
+		log.Fatal("設定エラー:", err)
+	}
+	if store != nil {
+		defer store.Close()
+	}
+	mlkemConfig.KeyStore = store
+	if kmsBackend == nil {
+		rsaConfig.KeyStore = store
+	}
+	if err := rsaConfig.Validate(); err != nil {
+		log.Fatal("設定エラー:", err)
+	}
+	if err := mlkemConfig.Validate(); err != nil {
+		log.Fatal("設定エラー:", err)
+	}
+	if *signingKeyFile != "" {
+		key, err := mlkemserver.LoadSigningKey(*signingKeyFile)
+		if err != nil {
+			log.Fatal("設定エラー:", err)
+		}
+		mlkemConfig.SigningKey = key
+	}
+	if *archivePath != "" {
+		// 両サーバーで1つのファイルに保存する（記録のserviceで区別する）
+		archive, err := keyarchive.Open(*archivePath, *archiveCiphertexts)
+		if err != nil {
+			log.Fatal("設定エラー:", err)
+		}
+		defer archive.Close()
+		rsaConfig.Archive, mlkemConfig.Archive = archive, archive
+	}
+	if *auditPath != "" {
+		// すべてのサーバーで1つの連鎖に記録する（記録のserviceで区別する）
+		audit, err := auditlog.Open(*auditPath)
+		if err != nil {
+			log.Fatal("設定エラー:", err)
+		}
+		defer audit.Close()
+		rsaConfig.AuditLog, mlkemConfig.AuditLog = audit, audit
+		dualConfig.AuditLog, ecdhConfig.AuditLog = audit, audit
+	}
+
+	// 先にリッスンしておき、クライアントが起動待ちをしなくて済むようにする
+	rsaListener := listen(*rsaAddr)
+	mlkemListener := listen(*mlkemAddr)
+	metricsListener := listen(*metricsAddr)
+
+	rsaHandler := rsaserver.NewHandler(rsaConfig)
+	mlkemHandler := mlkemserver.NewHandler(mlkemConfig)
+	var rsaServed, mlkemServed http.Handler = rsaHandler, mlkemHandler
+	if *record {
+		// ネットワーク上の盗聴者としてサーバーの手前で暗号化データを記録する
+		rec := recorder.New(nil)
+		rsaServed = rec.Tap(rsaHandler)
+		mlkemServed = rec.Tap(mlkemHandler)
+	}
+	go serve("RSAサーバー", rsaListener, rsaServed)
+	go serve("ML-KEMサーバー", mlkemListener, mlkemServed)
+
+	// 3つのサービスのメトリクスは同じレジストリに登録され、serviceラベルで区別できる
+	go serve("メトリクスサーバー", metricsListener, benchclient.MetricsServerMux())
+	metrics.MarkReady()
+
+	cfg.RSAURL = fmt.Sprintf("http://%s/public-key", loopbackAddr(rsaListener))
+	cfg.MLKEMURL = fmt.Sprintf("http://%s/public-key", loopbackAddr(mlkemListener))
+	cfg.StartupDelay = 0
+	// フィーチャーゲートで無効にしたサーバーは起動しない
+	if *dualAddr != "" && !features.Enabled(features.Dual) {
+		log.Printf("二重保護サーバーを起動しません: %v", features.Disabled(features.Dual))
+	} else if *dualAddr != "" {
+		dualHandler, err := dualserver.NewHandler(dualConfig)
+		if err != nil {
+			log.Fatal("二重保護サーバーの起動エラー:", err)
+		}
+		dualListener := listen(*dualAddr)
+		go serve("二重保護サーバー", dualListener, dualHandler)
+		cfg.DualURL = fmt.Sprintf("http://%s/public-key", loopbackAddr(dualListener))
+	}
+	if *ecdhAddr != "" && !features.Enabled(features.ECDH) {
+		log.Printf("ECDHサーバーを起動しません: %v", features.Disabled(features.ECDH))
+	} else if *ecdhAddr != "" {
+		ecdhHandler, err := ecdhserver.NewHandler(ecdhConfig)
+		if err != nil {
+			log.Fatal("ECDHサーバーの起動エラー:", err)
+		}
+		ecdhListener := listen(*ecdhAddr)
+		go serve("ECDHサーバー", ecdhListener, ecdhHandler)
+		cfg.ECDHURL = fmt.Sprintf("http://%s/public-key", loopbackAddr(ecdhListener))
+	}
+	if *kems {
+		cfg.KEMsURL = fmt.Sprintf("http://%s/kems", loopbackAddr(mlkemListener))
+		go func() {
+			if err := kembench.Run(kembench.Config{Interval: cfg.Interval, FIPS: cfg.FIPS}); err != nil {
+				log.Printf("KEMベンチマークエラー: %v", err)
+			}
+		}()
+	}
+	if *datagrams && !features.Enabled(features.Datagram) {
+		log.Printf("データグラムサーバーを起動しません: %v", features.Disabled(features.Datagram))
+	} else if *datagrams {
+		cfg.RSADatagramAddr = serveDatagram(rsaserver.ServiceName, rsaHandler)
+		cfg.MLKEMDatagramAddr = serveDatagram(mlkemserver.ServiceName, mlkemHandler)
+	}
+	if *collectorAddr != "" {
+		collector, err := resultcollector.New(nil)
+		if err != nil {
+			log.Fatal("集約サーバーの起動エラー:", err)
+		}
+		collectorListener := listen(*collectorAddr)
+		go serve("集約サーバー", collectorListener, collector.Handler())
+		cfg.ResultsURL = fmt.Sprintf("http://%s/public-key", loopbackAddr(collectorListener))
+	}
+	if *unixSocketDir != "" {
+		rsaSocket := filepath.Join(*unixSocketDir, "rsa.sock")
+		mlkemSocket := filepath.Join(*unixSocketDir, "ml-kem.sock")
+		go serve("RSAサーバー（Unixドメインソケット）", listen("unix:"+rsaSocket), rsaHandler)
+		go serve("ML-KEMサーバー（Unixドメインソケット）", listen("unix:"+mlkemSocket), mlkemHandler)
+		cfg.RSAUnixSocket, cfg.MLKEMUnixSocket = rsaSocket, mlkemSocket
+	}
+	if *loopback {
+		cfg.RSALoopback = rsaHandler
+		cfg.MLKEMLoopback = mlkemHandler
+	}
+
+	if *tokens {
+		go func() {
+			if err := tokenbench.Run(tokenbench.Config{Interval: cfg.Interval}); err != nil {
+				log.Printf("トークンベンチマークエラー: %v", err)
+			}
+		}()
+	}
+	if *pgp {
+		go func() {
+			pgpConfig := pgpbench.DefaultConfig()
+			pgpConfig.Interval = cfg.Interval
+			if err := pgpbench.Run(pgpConfig); err != nil {
+				log.Printf("OpenPGPベンチマークエラー: %v", err)
+			}
+		}()
+	}
+	if *ssh {
+		go func() {
+			if err := sshkex.Run(sshkex.Config{Interval: cfg.Interval}); err != nil {
+				log.Printf("SSH鍵交換ベンチマークエラー: %v", err)
+			}
+		}()
+	}
+	if *certChains {
+		go func() {
+			if err := certchain.Run(certchain.Config{Interval: cfg.Interval}); err != nil {
+				log.Printf("証明書チェーンベンチマークエラー: %v", err)
+			}
+		}()
+	}
+	if *tlsSim {
+		go func() {
+			if err := tlssim.Run(tlssim.DefaultConfig()); err != nil {
+				log.Printf("TLSハンドシェイクのシミュレーションエラー: %v", err)
+			}
+		}()
+	}
+	if *dnssec {
+		go func() {
+			if err := dnssecbench.Run(dnssecbench.DefaultConfig()); err != nil {
+				log.Printf("DNSSECベンチマークエラー: %v", err)
+			}
+		}()
+	}
+	if *vpnSim {
+		go func() {
+			// 他の計測への影響を抑えるため、負荷は1つのゴルーチンでかける（1コアあたりの処理能力を計測する）
+			vpnCfg := vpnsim.DefaultConfig()
+			vpnCfg.Workers = 1
+			if err := vpnsim.Run(vpnCfg); err != nil {
+				log.Printf("VPNハンドシェイクのシミュレーションエラー: %v", err)
+			}
+		}()
+	}
+	if *codeSign {
+		go func() {
+			if err := codesign.Run(codesign.DefaultConfig()); err != nil {
+				log.Printf("コード署名ベンチマークエラー: %v", err)
+			}
+		}()
+	}
+	if *scalingStudy > 0 {
+		// 計測中はプロセス全体のGOMAXPROCSが変わるため、他の計測と同時に行う場合は結果に注意する
+		selfbench.StartScaling(*scalingStudy, *scalingMaxProcs, rsaserver.ScalingBenchmark, mlkemserver.ScalingBenchmark)
+	}
+	if *multiRecipient {
+		go func() {
+			multiConfig := multirecipient.DefaultConfig()
+			multiConfig.Interval = cfg.Interval
+			if err := multirecipient.Run(multiConfig); err != nil {
+				log.Printf("複数受信者ベンチマークエラー: %v", err)
+			}
+		}()
+	}
+
+	fmt.Println("\n=== オールインワンモードで起動しました ===")
+	fmt.Printf("  RSAサーバー:     http://%s\n", loopbackAddr(rsaListener))
+	fmt.Printf("  ML-KEMサーバー:  http://%s\n", loopbackAddr(mlkemListener))
+	fmt.Printf("  メトリクス:      http://%s/metrics\n", loopbackAddr(metricsListener))
+
+	cfg.UnixSockets = unixSockets
+	benchclient.Run(cfg)
+}
+
+// アドレスでリッスンを開始する（形式はmetrics.ParseListenAddr）
+func listen(addr string) net.Listener {
+	ln, err := metrics.Listen(addr)
+	if err != nil {
+		log.Fatalf("リッスンに失敗しました (%s): %v", addr, err)
+	}
+	return ln
+}
+
+// HTTPサーバーを起動する
+func serve(name string, ln net.Listener, handler http.Handler) {
+	if err := metrics.Serve(ln, handler); err != nil {
+		log.Fatalf("%sエラー: %v", name, err)
+	}
+}
+
+// ループバックの空いているポートでデータグラムのリクエストを受け付け、アドレスを返す
+func serveDatagram(name string, handler http.Handler) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("データグラムのリッスンに失敗しました (%s): %v", name, err)
+	}
+	go func() {
+		if err := datagram.Serve(conn, name, handler); err != nil {
+			log.Fatalf("データグラムサーバーエラー (%s): %v", name, err)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// クライアントがUnixドメインソケットで接続するホスト
+var unixSockets = make(map[string]string)
+
+// クライアントから接続するためのループバックアドレスを返す
+// 未指定のアドレス（:8080、[::]:8080）はlocalhost、Unixドメインソケットはファイル名をホスト名にしてunixSocketsに登録する
+func loopbackAddr(ln net.Listener) string {
+	switch a := ln.Addr().(type) {
+	case *net.TCPAddr:
+		if a.IP.IsUnspecified() {
+			return fmt.Sprintf("localhost:%d", a.Port)
+		}
+		return net.JoinHostPort(a.IP.String(), strconv.Itoa(a.Port))
+	case *net.UnixAddr:
+		host := filepath.Base(a.Name)
+		unixSockets[host] = a.Name
+		return host
+	}
+	return ln.Addr().String()
+}
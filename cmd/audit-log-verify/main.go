@@ -0,0 +1,26 @@
+// audit-log-verify はサーバーの -audit-log で記録した監査ログのハッシュの連鎖を検証し、
+// 改ざん・削除・並べ替えがあれば終了コード1で終了する
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/keyi1000/PQC_grafana/auditlog"
+)
+
+func main() {
+	path := flag.String("audit-log", "audit.jsonl", "サーバーの -audit-log で記録したファイル")
+	expect := flag.String("last-hash", "", "控えておいた最後の記録のhash（指定した場合は一致しなければ失敗にし、末尾の記録の削除も検出する）")
+	flag.Parse()
+
+	report, err := auditlog.VerifyFile(*path)
+	if err != nil {
+		log.Fatalf("監査ログの検証に失敗しました (%d件まで正常): %v", report.Entries, err)
+	}
+	if *expect != "" && *expect != report.LastHash {
+		log.Fatalf("最後の記録のhashが控えた値と一致しません（末尾の記録の削除）: %s", report.LastHash)
+	}
+	fmt.Printf("監査ログの連鎖は正常です: %d件 (最後のhash: %s)\n", report.Entries, report.LastHash)
+}
@@ -0,0 +1,33 @@
+// cert-chain-bench はRSA、ECDSA、ML-DSA、複合署名で2段・3段の証明書チェーンを発行し、サイズと検証時間を計測する
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/keyi1000/PQC_grafana/certchain"
+	"github.com/keyi1000/PQC_grafana/metrics"
+)
+
+func main() {
+	cfg := certchain.DefaultConfig()
+	flag.DurationVar(&cfg.Interval, "interval", cfg.Interval, "証明書チェーンを発行して検証する間隔")
+	metricsAddr := flag.String("metrics-addr", ":8096", "メトリクスの待ち受けアドレス")
+	flag.Parse()
+
+	// Prometheusメトリクスサーバーを起動
+	go func() {
+		http.Handle("/metrics", metrics.Handler())
+		http.Handle("/version", metrics.VersionHandler())
+		http.Handle("/metrics/selfcheck", metrics.SelfCheckHandler())
+		log.Printf("メトリクスサーバーを起動: %s/metrics", metrics.DisplayURL(*metricsAddr))
+		if err := metrics.ListenAndServe(*metricsAddr, nil); err != nil {
+			log.Printf("メトリクスサーバーエラー: %v", err)
+		}
+	}()
+
+	if err := certchain.Run(cfg); err != nil {
+		log.Fatal("ベンチマークエラー:", err)
+	}
+}
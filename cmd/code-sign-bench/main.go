@@ -0,0 +1,41 @@
+// code-sign-bench はファームウェアのような大きな成果物の署名と検証をRSA、ECDSA、ML-DSA、SLH-DSAで行い、スループットを比較する
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/keyi1000/PQC_grafana/codesign"
+	"github.com/keyi1000/PQC_grafana/metrics"
+)
+
+func main() {
+	cfg := codesign.DefaultConfig()
+	flag.DurationVar(&cfg.Interval, "interval", cfg.Interval, "計測する間隔")
+	flag.Func("sizes", "署名する成果物のサイズ（MB、カンマ区切り、既定は1,10,100,500）", func(s string) error {
+		sizes, err := codesign.ParseSizes(s)
+		if err != nil {
+			return err
+		}
+		cfg.SizesMB = sizes
+		return nil
+	})
+	metricsAddr := flag.String("metrics-addr", ":8100", "メトリクスの待ち受けアドレス")
+	flag.Parse()
+
+	// Prometheusメトリクスサーバーを起動
+	go func() {
+		http.Handle("/metrics", metrics.Handler())
+		http.Handle("/version", metrics.VersionHandler())
+		http.Handle("/metrics/selfcheck", metrics.SelfCheckHandler())
+		log.Printf("メトリクスサーバーを起動: %s/metrics", metrics.DisplayURL(*metricsAddr))
+		if err := metrics.ListenAndServe(*metricsAddr, nil); err != nil {
+			log.Printf("メトリクスサーバーエラー: %v", err)
+		}
+	}()
+
+	if err := codesign.Run(cfg); err != nil {
+		log.Fatal("ベンチマークエラー:", err)
+	}
+}
@@ -0,0 +1,48 @@
+// coldstart-function はクライアントの1回の鍵交換をサーバーレス関数として実行するHTTPサーバーで、
+// Cloud Run・Cloud Functions・Lambda Web Adapterと同じく環境変数PORTのポートで待ち受ける
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/keyi1000/PQC_grafana/benchclient"
+	"github.com/keyi1000/PQC_grafana/coldstart"
+	"github.com/keyi1000/PQC_grafana/metrics"
+)
+
+func main() {
+	cfg := coldstart.DefaultConfig()
+	rsaURL := flag.String("rsa-url", cfg.KeyURLs[benchclient.AlgorithmRSA], "RSA公開鍵を取得するURL")
+	mlkemURL := flag.String("mlkem-url", cfg.KeyURLs[benchclient.AlgorithmMLKEM], "ML-KEM公開鍵を取得するURL")
+	flag.StringVar(&cfg.Algorithm, "algorithm", cfg.Algorithm, "クエリのalgorithmがない場合の鍵交換方式（rsa / mlkem）")
+	flag.IntVar(&cfg.MessageSize, "message-size", cfg.MessageSize, "暗号化するメッセージのサイズ（バイト）")
+	flag.StringVar(&cfg.PushURL, "push-url", os.Getenv("PUSHGATEWAY_URL"), "呼び出しごとにメトリクスを送るPushgatewayのURL（環境変数PUSHGATEWAY_URLでも指定できる、空の場合は送らない）")
+	flag.StringVar(&cfg.Job, "push-job", cfg.Job, "Pushgatewayのjobラベル")
+	flag.StringVar(&cfg.Instance, "push-instance", "", "Pushgatewayのinstanceラベル（空の場合はホスト名）")
+	flag.DurationVar(&cfg.PushTimeout, "push-timeout", cfg.PushTimeout, "Pushgatewayへの1回の送信の上限")
+	addr := flag.String("addr", "", "待ち受けアドレス（空の場合は環境変数PORT、PORTもない場合は:8103）")
+	flag.Parse()
+	cfg.KeyURLs[benchclient.AlgorithmRSA], cfg.KeyURLs[benchclient.AlgorithmMLKEM] = *rsaURL, *mlkemURL
+	if *addr == "" {
+		*addr = ":8103"
+		if port := os.Getenv("PORT"); port != "" {
+			*addr = ":" + port
+		}
+	}
+
+	function, err := coldstart.New(cfg)
+	if err != nil {
+		log.Fatal("設定エラー:", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", function)
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/version", metrics.VersionHandler())
+	log.Printf("関数を起動: %s/", metrics.DisplayURL(*addr))
+	if err := metrics.ListenAndServe(*addr, mux); err != nil {
+		log.Fatal("サーバー起動エラー:", err)
+	}
+}
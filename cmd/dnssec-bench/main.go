@@ -0,0 +1,34 @@
+// dnssec-bench はDNSSECと同じ形式でRSA、ECDSA、ML-DSA、SLH-DSAによりRRsetを署名し、応答のサイズと増幅率を計測する
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/keyi1000/PQC_grafana/dnssecbench"
+	"github.com/keyi1000/PQC_grafana/metrics"
+)
+
+func main() {
+	cfg := dnssecbench.DefaultConfig()
+	flag.DurationVar(&cfg.Interval, "interval", cfg.Interval, "すべての方式でゾーンを署名し直す間隔")
+	flag.IntVar(&cfg.UDPSize, "udp-size", cfg.UDPSize, "EDNS0で通知するUDPのペイロードサイズ（バイト、これを超える応答はTCPで再送される）")
+	metricsAddr := flag.String("metrics-addr", ":8098", "メトリクスの待ち受けアドレス")
+	flag.Parse()
+
+	// Prometheusメトリクスサーバーを起動
+	go func() {
+		http.Handle("/metrics", metrics.Handler())
+		http.Handle("/version", metrics.VersionHandler())
+		http.Handle("/metrics/selfcheck", metrics.SelfCheckHandler())
+		log.Printf("メトリクスサーバーを起動: %s/metrics", metrics.DisplayURL(*metricsAddr))
+		if err := metrics.ListenAndServe(*metricsAddr, nil); err != nil {
+			log.Printf("メトリクスサーバーエラー: %v", err)
+		}
+	}()
+
+	if err := dnssecbench.Run(cfg); err != nil {
+		log.Fatal("ベンチマークエラー:", err)
+	}
+}
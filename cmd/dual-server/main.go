@@ -0,0 +1,52 @@
+// dual-server はAES鍵をRSAとML-KEMで二重に保護した暗号化データを復号するサーバー
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/keyi1000/PQC_grafana/auditlog"
+	"github.com/keyi1000/PQC_grafana/dualserver"
+	"github.com/keyi1000/PQC_grafana/features"
+	"github.com/keyi1000/PQC_grafana/internal/httpmw"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/replay"
+)
+
+func main() {
+	addr := flag.String("addr", ":8085", "待ち受けアドレス")
+	var cfg dualserver.Config
+	flag.DurationVar(&cfg.ReplayWindow, "replay-window", 0, "復号エンドポイントで再送を検出し、request_nonceとtimestampのない要求・現在時刻との差がこの時間を超える要求・既に受け付けた要求を拒否する（0の場合は検出しない）")
+	flag.IntVar(&cfg.ReplayCacheSize, "replay-cache-size", replay.DefaultCacheSize, "-replay-window で記録する要求の数の上限（上限に達した場合は期限切れまで新しい要求を503で拒否する）")
+	auditPath := flag.String("audit-log", "", "秘密鍵によるRSA-OAEPの復号とML-KEMのカプセル化の解除（リクエストIDとクライアント）をハッシュで連鎖させて追記する監査ログのファイル（audit-log-verifyで検証する、空の場合は記録しない）")
+	features.RegisterFlags(flag.CommandLine)
+	httpmw.RegisterAuthFlags(flag.CommandLine)
+	flag.Parse()
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatal("設定エラー:", err)
+	}
+	if *auditPath != "" {
+		audit, err := auditlog.Open(*auditPath)
+		if err != nil {
+			log.Fatal("設定エラー:", err)
+		}
+		defer audit.Close()
+		cfg.AuditLog = audit
+	}
+	handler, err := dualserver.NewHandler(cfg)
+	if err != nil {
+		log.Fatal("起動エラー:", err)
+	}
+
+	fmt.Printf("\nサーバーを起動しました: %s\n", metrics.DisplayURL(*addr))
+	fmt.Println("エンドポイント:")
+	fmt.Println("  GET /public-key - RSA公開鍵とML-KEM公開鍵を取得")
+	fmt.Println("  POST /decrypt - 二重に保護された暗号化データを復号")
+	fmt.Println("  GET /metrics - Prometheusメトリクス")
+
+	if err := metrics.ListenAndServe(*addr, handler); err != nil {
+		log.Fatal("サーバー起動エラー:", err)
+	}
+}
@@ -0,0 +1,38 @@
+// kem-bench はkembenchに登録されたすべてのKEMの鍵生成・カプセル化・デカプセル化の所要時間とサイズを計測する
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/keyi1000/PQC_grafana/features"
+	"github.com/keyi1000/PQC_grafana/kembench"
+	"github.com/keyi1000/PQC_grafana/metrics"
+)
+
+func main() {
+	cfg := kembench.DefaultConfig()
+	flag.DurationVar(&cfg.Interval, "interval", cfg.Interval, "鍵交換を行う間隔")
+	flag.BoolVar(&cfg.FIPS, "fips", false, "FIPS承認済みのパラメーターセット（ML-KEM-768/1024、RSA 3072ビット以上）だけを計測する")
+	flag.BoolVar(&cfg.Deterministic, "deterministic", false, "【安全ではない】鍵生成とカプセル化をシードから導出したDRBGで行い、実行ごとに同じ処理内容にする（ベンチマークの再現専用）")
+	flag.Int64Var(&cfg.Seed, "seed", cfg.Seed, "-deterministic で使うDRBGのシード")
+	metricsAddr := flag.String("metrics-addr", ":8089", "メトリクスの待ち受けアドレス")
+	features.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	// Prometheusメトリクスサーバーを起動
+	go func() {
+		http.Handle("/metrics", metrics.Handler())
+		http.Handle("/version", metrics.VersionHandler())
+		http.Handle("/metrics/selfcheck", metrics.SelfCheckHandler())
+		log.Printf("メトリクスサーバーを起動: %s/metrics", metrics.DisplayURL(*metricsAddr))
+		if err := metrics.ListenAndServe(*metricsAddr, nil); err != nil {
+			log.Printf("メトリクスサーバーエラー: %v", err)
+		}
+	}()
+
+	if err := kembench.Run(cfg); err != nil {
+		log.Fatal("ベンチマークエラー:", err)
+	}
+}
@@ -0,0 +1,37 @@
+// key-archive-replay は -key-archive で保存した過去の暗号化データを現在のサーバーのコードで復号し直し、
+// 暗号化データの形式の後方互換性を確認する（リリースごとにCIで1回実行するか、-intervalで常駐させる）
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/keyi1000/PQC_grafana/keyreplay"
+	"github.com/keyi1000/PQC_grafana/metrics"
+)
+
+func main() {
+	var cfg keyreplay.Config
+	flag.StringVar(&cfg.Path, "archive", "key-archive.jsonl", "サーバーの -key-archive で保存した記録のファイル")
+	flag.DurationVar(&cfg.Interval, "interval", 0, "記録を読み直して再生する間隔（0の場合は1回だけ再生し、一致しない暗号化データがあれば終了コード1で終了する）")
+	metricsAddr := flag.String("metrics-addr", ":8104", "メトリクスの待ち受けアドレス（-interval を指定した場合のみ）")
+	flag.Parse()
+
+	if cfg.Interval > 0 {
+		// Prometheusメトリクスサーバーを起動
+		go func() {
+			http.Handle("/metrics", metrics.Handler())
+			http.Handle("/version", metrics.VersionHandler())
+			http.Handle("/metrics/selfcheck", metrics.SelfCheckHandler())
+			log.Printf("メトリクスサーバーを起動: %s/metrics", metrics.DisplayURL(*metricsAddr))
+			if err := metrics.ListenAndServe(*metricsAddr, nil); err != nil {
+				log.Printf("メトリクスサーバーエラー: %v", err)
+			}
+		}()
+	}
+
+	if err := keyreplay.Run(cfg); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,45 @@
+// key-cdn はRSAサーバーとML-KEMサーバーの前に置くキャッシュ付きのリバースプロキシで、
+// 公開鍵をCDNのエッジから配信した場合のオリジンへのリクエスト数と帯域を計測する
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/keyi1000/PQC_grafana/keycdn"
+	"github.com/keyi1000/PQC_grafana/metrics"
+)
+
+func main() {
+	cfg := keycdn.DefaultConfig()
+	var routes []keycdn.Route
+	flag.Func("route", "待ち受けアドレスと転送先のオリジン（addr=origin、例: :8190=http://localhost:8080、複数指定可、既定はdocker-composeのRSAサーバーとML-KEMサーバー）", func(s string) error {
+		route, err := keycdn.ParseRoute(s)
+		if err != nil {
+			return err
+		}
+		routes = append(routes, route)
+		return nil
+	})
+	metricsAddr := flag.String("metrics-addr", ":8102", "メトリクスの待ち受けアドレス")
+	flag.Parse()
+	if len(routes) > 0 {
+		cfg.Routes = routes
+	}
+
+	// Prometheusメトリクスサーバーを起動
+	go func() {
+		http.Handle("/metrics", metrics.Handler())
+		http.Handle("/version", metrics.VersionHandler())
+		http.Handle("/metrics/selfcheck", metrics.SelfCheckHandler())
+		log.Printf("メトリクスサーバーを起動: %s/metrics", metrics.DisplayURL(*metricsAddr))
+		if err := metrics.ListenAndServe(*metricsAddr, nil); err != nil {
+			log.Printf("メトリクスサーバーエラー: %v", err)
+		}
+	}()
+
+	if err := keycdn.Run(cfg); err != nil {
+		log.Fatal("サーバー起動エラー:", err)
+	}
+}
@@ -0,0 +1,42 @@
+// multi-recipient-bench は1つのAES鍵をN人の受信者向けにRSAとML-KEMで保護し、受信者数に対する時間とサイズを計測する
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/multirecipient"
+)
+
+func main() {
+	cfg := multirecipient.DefaultConfig()
+	flag.DurationVar(&cfg.Interval, "interval", cfg.Interval, "計測する間隔")
+	flag.Func("recipients", "計測する受信者数（カンマ区切り、既定は1,2,5,10,20,50,100）", func(s string) error {
+		counts, err := multirecipient.ParseRecipients(s)
+		if err != nil {
+			return err
+		}
+		cfg.Recipients = counts
+		return nil
+	})
+	flag.StringVar(&cfg.Message, "message", cfg.Message, "暗号化するメッセージ")
+	metricsAddr := flag.String("metrics-addr", ":8090", "メトリクスの待ち受けアドレス")
+	flag.Parse()
+
+	// Prometheusメトリクスサーバーを起動
+	go func() {
+		http.Handle("/metrics", metrics.Handler())
+		http.Handle("/version", metrics.VersionHandler())
+		http.Handle("/metrics/selfcheck", metrics.SelfCheckHandler())
+		log.Printf("メトリクスサーバーを起動: %s/metrics", metrics.DisplayURL(*metricsAddr))
+		if err := metrics.ListenAndServe(*metricsAddr, nil); err != nil {
+			log.Printf("メトリクスサーバーエラー: %v", err)
+		}
+	}()
+
+	if err := multirecipient.Run(cfg); err != nil {
+		log.Fatal("ベンチマークエラー:", err)
+	}
+}
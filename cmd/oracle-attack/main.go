@@ -0,0 +1,37 @@
+// oracle-attack は -insecure-oracle モードのサーバーに対するパディングオラクル攻撃を実演する教育用のツール
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/oracleattack"
+)
+
+func main() {
+	cfg := oracleattack.DefaultConfig()
+	flag.StringVar(&cfg.Target, "target", cfg.Target, "攻撃対象のサーバー: rsa / mlkem")
+	flag.StringVar(&cfg.URL, "url", cfg.URL, "攻撃対象の公開鍵を取得するURL")
+	flag.StringVar(&cfg.Message, "message", cfg.Message, "正規のクライアントが暗号化するメッセージ")
+	flag.DurationVar(&cfg.Interval, "interval", cfg.Interval, "攻撃を繰り返す間隔（0の場合は1回だけ実行して終了する）")
+	metricsAddr := flag.String("metrics-addr", ":8083", "メトリクスの待ち受けアドレス")
+	flag.Parse()
+	if err := cfg.Validate(); err != nil {
+		log.Fatal("設定エラー:", err)
+	}
+
+	// Prometheusメトリクスサーバーを起動
+	go func() {
+		http.Handle("/metrics", metrics.Handler())
+		http.Handle("/version", metrics.VersionHandler())
+		http.Handle("/metrics/selfcheck", metrics.SelfCheckHandler())
+		log.Printf("メトリクスサーバーを起動: %s/metrics", metrics.DisplayURL(*metricsAddr))
+		if err := metrics.ListenAndServe(*metricsAddr, nil); err != nil {
+			log.Printf("メトリクスサーバーエラー: %v", err)
+		}
+	}()
+
+	oracleattack.Run(cfg)
+}
@@ -0,0 +1,34 @@
+// pgp-bench はOpenPGP（RSA、ML-KEM-768+X25519）とハイブリッド暗号化で暗号化したメッセージのサイズと所要時間を計測する
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/pgpbench"
+)
+
+func main() {
+	cfg := pgpbench.DefaultConfig()
+	flag.DurationVar(&cfg.Interval, "interval", cfg.Interval, "メッセージを暗号化する間隔")
+	flag.StringVar(&cfg.Message, "message", cfg.Message, "暗号化するメッセージ")
+	metricsAddr := flag.String("metrics-addr", ":8087", "メトリクスの待ち受けアドレス")
+	flag.Parse()
+
+	// Prometheusメトリクスサーバーを起動
+	go func() {
+		http.Handle("/metrics", metrics.Handler())
+		http.Handle("/version", metrics.VersionHandler())
+		http.Handle("/metrics/selfcheck", metrics.SelfCheckHandler())
+		log.Printf("メトリクスサーバーを起動: %s/metrics", metrics.DisplayURL(*metricsAddr))
+		if err := metrics.ListenAndServe(*metricsAddr, nil); err != nil {
+			log.Printf("メトリクスサーバーエラー: %v", err)
+		}
+	}()
+
+	if err := pgpbench.Run(cfg); err != nil {
+		log.Fatal("ベンチマークエラー:", err)
+	}
+}
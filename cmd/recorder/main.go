@@ -0,0 +1,59 @@
+// recorder はクライアントとサーバーの間に入り、暗号化データを盗聴して保存するプロキシ
+// 「今収集して後で解読する」攻撃でどれだけのデータが危険にさらされるかをメトリクスで示す
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/recorder"
+)
+
+func main() {
+	rsaTarget := flag.String("rsa-target", "http://rsa-server:8080", "転送先のRSAサーバー")
+	mlkemTarget := flag.String("mlkem-target", "http://ml-kem-server:8081", "転送先のML-KEMサーバー")
+	rsaAddr := flag.String("rsa-addr", ":9080", "RSAサーバー向けプロキシの待ち受けアドレス")
+	mlkemAddr := flag.String("mlkem-addr", ":9081", "ML-KEMサーバー向けプロキシの待ち受けアドレス")
+	metricsAddr := flag.String("metrics-addr", ":8084", "メトリクスの待ち受けアドレス")
+	outPath := flag.String("out", "", "盗聴したデータを保存するファイル（JSON Lines、空の場合は保存しない）")
+	flag.Parse()
+
+	var out io.Writer
+	if *outPath != "" {
+		f, err := os.OpenFile(*outPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			log.Fatal("保存先ファイルを開けません:", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	rec := recorder.New(out)
+
+	go proxy("RSA", *rsaAddr, *rsaTarget, rec)
+	go proxy("ML-KEM", *mlkemAddr, *mlkemTarget, rec)
+
+	http.Handle("/metrics", metrics.Handler())
+	http.Handle("/version", metrics.VersionHandler())
+	http.Handle("/metrics/selfcheck", metrics.SelfCheckHandler())
+	log.Printf("メトリクスサーバーを起動: %s/metrics", metrics.DisplayURL(*metricsAddr))
+	if err := metrics.ListenAndServe(*metricsAddr, nil); err != nil {
+		log.Fatal("メトリクスサーバーエラー:", err)
+	}
+}
+
+// 転送先のサーバーへのプロキシを起動する
+func proxy(name, addr, target string, rec *recorder.Recorder) {
+	u, err := url.Parse(target)
+	if err != nil {
+		log.Fatalf("%sの転送先URLが不正です: %v", name, err)
+	}
+	log.Printf("%sプロキシを起動: %s -> %s", name, addr, target)
+	if err := metrics.ListenAndServe(addr, rec.Proxy(u)); err != nil {
+		log.Fatalf("%sプロキシエラー: %v", name, err)
+	}
+}
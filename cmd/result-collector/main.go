@@ -0,0 +1,44 @@
+// result-collector はクライアントがML-KEMのハイブリッド暗号化で保護して送る計測結果を受け取り、
+// 復号してJSON Linesのファイルに保存する集約サーバー
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/resultcollector"
+)
+
+func main() {
+	addr := flag.String("addr", ":8105", "待ち受けアドレス")
+	outPath := flag.String("out", "results.jsonl", "受け取った計測結果を追記するファイル（空の場合は保存せず、メトリクスだけを記録する）")
+	flag.Parse()
+
+	var out io.Writer
+	if *outPath != "" {
+		f, err := os.OpenFile(*outPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			log.Fatal("設定エラー:", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	collector, err := resultcollector.New(out)
+	if err != nil {
+		log.Fatal("起動エラー:", err)
+	}
+
+	fmt.Printf("\nサーバーを起動しました: %s\n", metrics.DisplayURL(*addr))
+	fmt.Println("エンドポイント:")
+	fmt.Println("  GET /public-key - 計測結果の暗号化に使うML-KEM公開鍵を取得")
+	fmt.Println("  POST /results - 暗号化した計測結果を送信")
+	fmt.Println("  GET /metrics - Prometheusメトリクス")
+
+	if err := metrics.ListenAndServe(*addr, collector.Handler()); err != nil {
+		log.Fatal("サーバー起動エラー:", err)
+	}
+}
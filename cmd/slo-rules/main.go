@@ -0,0 +1,38 @@
+// slo-rules はクライアントの成功率とSLOのバーンレートを計算するPrometheusのレコーディングルールを生成する
+//
+//	go run ./cmd/slo-rules -objective 0.995 -o slo-rules.yml
+//
+// 計測するバイナリに -metric-namespace や -metric-prefix を指定している場合は、同じ値を指定する
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/slo"
+)
+
+func main() {
+	cfg := slo.DefaultConfig()
+	flag.Float64Var(&cfg.Objective, "objective", cfg.Objective, "成功率の目標（0より大きく1より小さい値）")
+	flag.StringVar(&cfg.Interval, "interval", "", "ルールを評価する間隔（例: 30s、空の場合はPrometheusの設定に従う）")
+	output := flag.String("o", "", "出力するファイル（空の場合は標準出力）")
+	flag.Func("metric-namespace", "すべてのメトリクス名の前に付ける名前空間（例: lab1 → lab1_client_...）", metrics.SetNamespace)
+	flag.Func("metric-prefix", "サービスのメトリクス名の接頭辞を上書きする（service=prefix、例: aes-client=fork_client_、複数指定可）", metrics.ParsePrefix)
+	flag.Parse()
+
+	w := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatal("出力ファイルの作成エラー:", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := slo.Write(w, cfg); err != nil {
+		log.Fatal("ルールの生成エラー:", err)
+	}
+}
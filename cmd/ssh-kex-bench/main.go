@@ -0,0 +1,33 @@
+// ssh-kex-bench はSSHの鍵交換方式（curve25519-sha256、mlkem768x25519-sha256）とML-KEM-768の所要時間とサイズを計測する
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/sshkex"
+)
+
+func main() {
+	cfg := sshkex.DefaultConfig()
+	flag.DurationVar(&cfg.Interval, "interval", cfg.Interval, "鍵交換を行う間隔")
+	metricsAddr := flag.String("metrics-addr", ":8088", "メトリクスの待ち受けアドレス")
+	flag.Parse()
+
+	// Prometheusメトリクスサーバーを起動
+	go func() {
+		http.Handle("/metrics", metrics.Handler())
+		http.Handle("/version", metrics.VersionHandler())
+		http.Handle("/metrics/selfcheck", metrics.SelfCheckHandler())
+		log.Printf("メトリクスサーバーを起動: %s/metrics", metrics.DisplayURL(*metricsAddr))
+		if err := metrics.ListenAndServe(*metricsAddr, nil); err != nil {
+			log.Printf("メトリクスサーバーエラー: %v", err)
+		}
+	}()
+
+	if err := sshkex.Run(cfg); err != nil {
+		log.Fatal("ベンチマークエラー:", err)
+	}
+}
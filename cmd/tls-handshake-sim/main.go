@@ -0,0 +1,46 @@
+// tls-handshake-sim は鍵交換方式と署名方式の組み合わせごとに、TLS 1.3のハンドシェイクで送るバイト数とフライト数を見積もる
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/tlssim"
+)
+
+func main() {
+	cfg := tlssim.DefaultConfig()
+	flag.DurationVar(&cfg.Interval, "interval", cfg.Interval, "鍵共有と署名を計算し直す間隔")
+	flag.Func("kex", "比較する鍵交換方式（kembenchに登録された名前のカンマ区切り、既定はECDH-P256,X25519MLKEM768,ML-KEM-768,ML-KEM-1024）", func(s string) error {
+		names, err := tlssim.ParseKeyExchanges(s)
+		if err != nil {
+			return err
+		}
+		cfg.KeyExchanges = names
+		return nil
+	})
+	flag.IntVar(&cfg.TCPSegments, "tcp-initial-window", cfg.TCPSegments, "TCPの初期ウィンドウのセグメント数")
+	flag.IntVar(&cfg.MSS, "mss", cfg.MSS, "TCPの最大セグメントサイズ（バイト、パケット数の見積もりにも使う）")
+	flag.BoolVar(&cfg.Transfer, "transfer", false, "ハンドシェイクのバイト数をループバックのTCP接続で実際に転送して計測する")
+	flag.IntVar(&cfg.TransferMSS, "transfer-mss", 0, "転送の計測で設定するMSS（バイト、0の場合はOSの既定値、Linuxのみ）")
+	cfg.Netem.RegisterFlags(flag.CommandLine, "")
+	metricsAddr := flag.String("metrics-addr", ":8097", "メトリクスの待ち受けアドレス")
+	flag.Parse()
+
+	// Prometheusメトリクスサーバーを起動
+	go func() {
+		http.Handle("/metrics", metrics.Handler())
+		http.Handle("/version", metrics.VersionHandler())
+		http.Handle("/metrics/selfcheck", metrics.SelfCheckHandler())
+		log.Printf("メトリクスサーバーを起動: %s/metrics", metrics.DisplayURL(*metricsAddr))
+		if err := metrics.ListenAndServe(*metricsAddr, nil); err != nil {
+			log.Printf("メトリクスサーバーエラー: %v", err)
+		}
+	}()
+
+	if err := tlssim.Run(cfg); err != nil {
+		log.Fatal("シミュレーションエラー:", err)
+	}
+}
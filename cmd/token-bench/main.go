@@ -0,0 +1,33 @@
+// token-bench はEd25519、ECDSA P-256、ML-DSA-65で署名したJWTのサイズと署名・検証時間を計測する
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/tokenbench"
+)
+
+func main() {
+	cfg := tokenbench.DefaultConfig()
+	flag.DurationVar(&cfg.Interval, "interval", cfg.Interval, "トークンを発行する間隔")
+	metricsAddr := flag.String("metrics-addr", ":8086", "メトリクスの待ち受けアドレス")
+	flag.Parse()
+
+	// Prometheusメトリクスサーバーを起動
+	go func() {
+		http.Handle("/metrics", metrics.Handler())
+		http.Handle("/version", metrics.VersionHandler())
+		http.Handle("/metrics/selfcheck", metrics.SelfCheckHandler())
+		log.Printf("メトリクスサーバーを起動: %s/metrics", metrics.DisplayURL(*metricsAddr))
+		if err := metrics.ListenAndServe(*metricsAddr, nil); err != nil {
+			log.Printf("メトリクスサーバーエラー: %v", err)
+		}
+	}()
+
+	if err := tokenbench.Run(cfg); err != nil {
+		log.Fatal("ベンチマークエラー:", err)
+	}
+}
@@ -0,0 +1,57 @@
+// toolchain-bench は自身を別のGoのツールチェーンでビルドして子プロセスとして実行し、
+// RSAとML-KEMの自己ベンチマークの結果をGoとcirclのバージョンごとに比較する
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/toolchainbench"
+)
+
+func main() {
+	cfg := toolchainbench.DefaultConfig()
+	var toolchains []string
+	flag.Func("toolchain", "比較するGoのツールチェーン（GOTOOLCHAINの値、例: go1.24.0、localは実行中のgoコマンド、複数指定可、既定はlocal）", func(s string) error {
+		toolchains = append(toolchains, s)
+		return nil
+	})
+	flag.StringVar(&cfg.Package, "package", cfg.Package, "子プロセスとしてビルドするパッケージ")
+	flag.StringVar(&cfg.Dir, "dir", cfg.Dir, "ビルドするモジュールのディレクトリ")
+	flag.DurationVar(&cfg.Duration, "duration", cfg.Duration, "暗号処理ごとの計測時間")
+	flag.DurationVar(&cfg.Interval, "interval", cfg.Interval, "計測を繰り返す間隔（0の場合は1回だけ実行して終了する）")
+	child := flag.Bool("child", false, "子プロセスとして計測し、結果をJSONで標準出力に書き出す（toolchain-bench自身が使う）")
+	metricsAddr := flag.String("metrics-addr", ":8101", "メトリクスの待ち受けアドレス")
+	flag.Parse()
+	if len(toolchains) > 0 {
+		cfg.Toolchains = toolchains
+	}
+
+	if *child {
+		report, err := toolchainbench.RunChild(cfg.Duration)
+		if err != nil {
+			log.Fatal("ベンチマークエラー:", err)
+		}
+		json.NewEncoder(os.Stdout).Encode(report)
+		return
+	}
+
+	// Prometheusメトリクスサーバーを起動
+	go func() {
+		http.Handle("/metrics", metrics.Handler())
+		http.Handle("/version", metrics.VersionHandler())
+		http.Handle("/metrics/selfcheck", metrics.SelfCheckHandler())
+		log.Printf("メトリクスサーバーを起動: %s/metrics", metrics.DisplayURL(*metricsAddr))
+		if err := metrics.ListenAndServe(*metricsAddr, nil); err != nil {
+			log.Printf("メトリクスサーバーエラー: %v", err)
+		}
+	}()
+
+	if err := toolchainbench.Run(cfg); err != nil {
+		log.Fatal("ベンチマークエラー:", err)
+	}
+}
@@ -0,0 +1,35 @@
+// vpn-handshake-sim はWireGuardと同じ形のVPNのハンドシェイクをX25519とML-KEMのハイブリッドで行い、応答側の処理能力を比較する
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/vpnsim"
+)
+
+func main() {
+	cfg := vpnsim.DefaultConfig()
+	flag.DurationVar(&cfg.Interval, "interval", cfg.Interval, "ハンドシェイクと処理能力の計測を行う間隔")
+	flag.DurationVar(&cfg.LoadDuration, "load-duration", cfg.LoadDuration, "方式ごとに応答側へ負荷をかける時間（0で処理能力を計測しない）")
+	flag.IntVar(&cfg.Workers, "workers", cfg.Workers, "負荷をかけるゴルーチンの数（0でGOMAXPROCS）")
+	metricsAddr := flag.String("metrics-addr", ":8099", "メトリクスの待ち受けアドレス")
+	flag.Parse()
+
+	// Prometheusメトリクスサーバーを起動
+	go func() {
+		http.Handle("/metrics", metrics.Handler())
+		http.Handle("/version", metrics.VersionHandler())
+		http.Handle("/metrics/selfcheck", metrics.SelfCheckHandler())
+		log.Printf("メトリクスサーバーを起動: %s/metrics", metrics.DisplayURL(*metricsAddr))
+		if err := metrics.ListenAndServe(*metricsAddr, nil); err != nil {
+			log.Printf("メトリクスサーバーエラー: %v", err)
+		}
+	}()
+
+	if err := vpnsim.Run(cfg); err != nil {
+		log.Fatal("ベンチマークエラー:", err)
+	}
+}
@@ -0,0 +1,268 @@
+// Package cms はハイブリッド暗号化したデータをCMS（RFC 5652）のEnvelopedDataとして出力する
+//
+// RSAの受信者はKeyTransRecipientInfo、ML-KEMの受信者はKEMRecipientInfo（RFC 9629）で表す
+// 独自のJSON形式と標準形式でサイズを比較するために使う
+// 複数の受信者のRecipientInfoを1つのEnvelopedDataにまとめることもできる（グループへの送信やメールの同報）
+package cms
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+)
+
+// オブジェクト識別子
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidAES128CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidAES256Wrap    = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 45}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAESOAEP     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+	oidMGF1          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+	oidOriKEM        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 13, 3}
+	oidHKDFSHA256    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 3, 28}
+	oidMLKEM768      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 4, 2}
+)
+
+// CMSのバージョン
+const (
+	versionKTRIWithSKI       = 2 // subjectKeyIdentifierを使うKeyTransRecipientInfo
+	versionEnvelopedKTRI     = 2
+	versionEnvelopedORI      = 3 // OtherRecipientInfoを含むEnvelopedData
+	versionKEMRecipientInfo  = 0
+	kekLength                = 32
+	otherRecipientInfoTagNum = 4
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue // [0] EXPLICIT
+}
+
+type envelopedData struct {
+	Version              int
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type keyTransRecipientInfo struct {
+	Version                int
+	SubjectKeyIdentifier   []byte `asn1:"tag:0"`
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type rsaesOAEPParams struct {
+	HashFunc    pkix.AlgorithmIdentifier `asn1:"explicit,tag:0"`
+	MaskGenFunc pkix.AlgorithmIdentifier `asn1:"explicit,tag:1"`
+}
+
+type otherRecipientInfo struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type kemRecipientInfo struct {
+	Version              int
+	SubjectKeyIdentifier []byte `asn1:"tag:0"`
+	KEM                  pkix.AlgorithmIdentifier
+	KEMCiphertext        []byte
+	KDF                  pkix.AlgorithmIdentifier
+	KEKLength            int
+	Wrap                 pkix.AlgorithmIdentifier
+	EncryptedKey         []byte
+}
+
+// KEKの導出に使う情報（RFC 9629 CMSORIforKEMOtherInfo）
+type kemOtherInfo struct {
+	Wrap      pkix.AlgorithmIdentifier
+	KEKLength int
+}
+
+// EnvelopedDataの受信者1人分の情報（RecipientInfo）
+type RecipientInfo struct {
+	raw   asn1.RawValue
+	other bool // OtherRecipientInfo（KEMRecipientInfo）か
+}
+
+// RSAの受信者のKeyTransRecipientInfoを作成する
+// encryptedKeyはcekをRSAES-OAEP（SHA-256、MGF1-SHA-256）で暗号化したもの
+func RSARecipientInfo(keyID, encryptedKey []byte) (RecipientInfo, error) {
+	params, err := asn1.Marshal(rsaesOAEPParams{
+		HashFunc:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+		MaskGenFunc: pkix.AlgorithmIdentifier{Algorithm: oidMGF1, Parameters: mustRaw(pkix.AlgorithmIdentifier{Algorithm: oidSHA256})},
+	})
+	if err != nil {
+		return RecipientInfo{}, err
+	}
+	ri, err := asn1.Marshal(keyTransRecipientInfo{
+		Version:                versionKTRIWithSKI,
+		SubjectKeyIdentifier:   keyID,
+		KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidRSAESOAEP, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedKey:           encryptedKey,
+	})
+	if err != nil {
+		return RecipientInfo{}, err
+	}
+	return RecipientInfo{raw: asn1.RawValue{FullBytes: ri}}, nil
+}
+
+// RSA公開鍵でcekを暗号化し、KeyTransRecipientInfoを作成する
+func WrapForRSA(pub *rsa.PublicKey, keyID, cek []byte) (RecipientInfo, error) {
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, cek, nil)
+	if err != nil {
+		return RecipientInfo{}, err
+	}
+	return RSARecipientInfo(keyID, encryptedKey)
+}
+
+// ML-KEM公開鍵にカプセル化してKEMRecipientInfoを作成する
+// 共有秘密鍵からHKDF-SHA256でKEKを導出し、cekをAESキーラップで保護する
+func WrapForMLKEM(pub *kyber768.PublicKey, keyID, cek []byte) (RecipientInfo, error) {
+	kemct, sharedSecret, err := kyber768.Scheme().Encapsulate(pub)
+	if err != nil {
+		return RecipientInfo{}, err
+	}
+	defer cryptoutil.Zeroize(sharedSecret)
+
+	wrapAlg := pkix.AlgorithmIdentifier{Algorithm: oidAES256Wrap}
+	info, err := asn1.Marshal(kemOtherInfo{Wrap: wrapAlg, KEKLength: kekLength})
+	if err != nil {
+		return RecipientInfo{}, err
+	}
+	kek := cryptoutil.HKDFSHA256(sharedSecret, nil, info, kekLength)
+	defer cryptoutil.Zeroize(kek)
+	encryptedKey, err := cryptoutil.WrapAESKW(kek, cek)
+	if err != nil {
+		return RecipientInfo{}, err
+	}
+
+	kemri, err := asn1.Marshal(kemRecipientInfo{
+		Version:              versionKEMRecipientInfo,
+		SubjectKeyIdentifier: keyID,
+		KEM:                  pkix.AlgorithmIdentifier{Algorithm: oidMLKEM768},
+		KEMCiphertext:        kemct,
+		KDF:                  pkix.AlgorithmIdentifier{Algorithm: oidHKDFSHA256},
+		KEKLength:            kekLength,
+		Wrap:                 wrapAlg,
+		EncryptedKey:         encryptedKey,
+	})
+	if err != nil {
+		return RecipientInfo{}, err
+	}
+	ori, err := asn1.Marshal(otherRecipientInfo{Type: oidOriKEM, Value: asn1.RawValue{FullBytes: kemri}})
+	if err != nil {
+		return RecipientInfo{}, err
+	}
+	// RecipientInfo ::= CHOICE { ..., ori [4] OtherRecipientInfo } は暗黙タグなのでSEQUENCEのタグを付け替える
+	var seq asn1.RawValue
+	if _, err := asn1.Unmarshal(ori, &seq); err != nil {
+		return RecipientInfo{}, err
+	}
+	raw := asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: otherRecipientInfoTagNum, IsCompound: true, Bytes: seq.Bytes}
+	return RecipientInfo{raw: raw, other: true}, nil
+}
+
+// RSAの受信者向けにEnvelopedDataを作成する
+// encryptedKeyはcekをRSAES-OAEP（SHA-256、MGF1-SHA-256）で暗号化したもの
+func EnvelopeForRSA(keyID, encryptedKey, cek, plaintext []byte) ([]byte, error) {
+	ri, err := RSARecipientInfo(keyID, encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	return Envelope([]RecipientInfo{ri}, cek, plaintext)
+}
+
+// RSA公開鍵でcekを暗号化し、EnvelopedDataを作成する
+func EncryptForRSA(pub *rsa.PublicKey, keyID, cek, plaintext []byte) ([]byte, error) {
+	ri, err := WrapForRSA(pub, keyID, cek)
+	if err != nil {
+		return nil, err
+	}
+	return Envelope([]RecipientInfo{ri}, cek, plaintext)
+}
+
+// ML-KEMの受信者向けにKEMRecipientInfoを使ったEnvelopedDataを作成する
+func EncryptForMLKEM(pub *kyber768.PublicKey, keyID, cek, plaintext []byte) ([]byte, error) {
+	ri, err := WrapForMLKEM(pub, keyID, cek)
+	if err != nil {
+		return nil, err
+	}
+	return Envelope([]RecipientInfo{ri}, cek, plaintext)
+}
+
+// 本文をAES-CBC（鍵の長さはcekと同じ）で暗号化し、複数の受信者のRecipientInfoとともにContentInfoで包む
+func Envelope(recipients []RecipientInfo, cek, plaintext []byte) ([]byte, error) {
+	version := versionEnvelopedKTRI
+	raws := make([]asn1.RawValue, len(recipients))
+	for i, r := range recipients {
+		raws[i] = r.raw
+		if r.other {
+			version = versionEnvelopedORI
+		}
+	}
+	contentAlg, ok := map[int]asn1.ObjectIdentifier{16: oidAES128CBC, 24: oidAES192CBC, 32: oidAES256CBC}[len(cek)]
+	if !ok {
+		return nil, aes.KeySizeError(len(cek))
+	}
+	iv, ciphertext, err := encryptContent(cek, plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("本文の暗号化エラー: %w", err)
+	}
+	ed, err := asn1.Marshal(envelopedData{
+		Version:        version,
+		RecipientInfos: raws,
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:                oidData,
+			ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: contentAlg, Parameters: mustRaw(iv)},
+			EncryptedContent:           ciphertext,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// RawValueにはタグ指定が効かないため、明示タグ[0]を直接組み立てる
+	content := asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: ed}
+	return asn1.Marshal(contentInfo{ContentType: oidEnvelopedData, Content: content})
+}
+
+// CMSのAES-CBC（RFC 3565）で本文を暗号化する
+func encryptContent(cek, plaintext []byte) (iv, ciphertext []byte, err error) {
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, nil, err
+	}
+	if iv, err = cryptoutil.Nonces.NextRandom(cek, aes.BlockSize); err != nil {
+		return nil, nil, err
+	}
+	padded := cryptoutil.PKCS7Pad(plaintext, aes.BlockSize)
+	ciphertext = make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+	return iv, ciphertext, nil
+}
+
+// 値をDERエンコードしてRawValueにする（エンコードできない値は渡さないこと）
+func mustRaw(v interface{}) asn1.RawValue {
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return asn1.RawValue{FullBytes: b}
+}
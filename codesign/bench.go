@@ -0,0 +1,185 @@
+// Package codesign はファームウェアの更新イメージのような大きな成果物（1〜500MB程度）を、ハッシュにストリーミングしてから
+// マニフェストに署名・検証する処理をRSA、ECDSA、ML-DSA、SLH-DSA（SPHINCS+）で行い、所要時間とスループットを比較するベンチマークを提供する
+package codesign
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "code-sign-bench"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は code_sign_bench_）
+var factory = metrics.NewFactory(ServiceName, "code_sign_bench_")
+
+var (
+	signDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "code_sign_bench_sign_duration_seconds",
+			Help:    "Histogram of the time to hash the artifact and sign its manifest in seconds, by scheme and artifact size",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"scheme", "size_mb"},
+	)
+	verifyDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "code_sign_bench_verify_duration_seconds",
+			Help:    "Histogram of the time a device needs to hash the artifact and verify the manifest signature in seconds, by scheme and artifact size",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"scheme", "size_mb"},
+	)
+	throughput = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "code_sign_bench_throughput_bytes_per_second",
+			Help: "Artifact bytes processed per second including hashing and the signature operation, by scheme, operation (sign or verify) and artifact size",
+		},
+		[]string{"scheme", "operation", "size_mb"},
+	)
+	operationDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "code_sign_bench_signature_operation_duration_seconds",
+			Help:    "Histogram of the signature operation on the manifest alone (excluding hashing) in seconds, by scheme and operation",
+			Buckets: []float64{0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5},
+		},
+		[]string{"scheme", "operation"},
+	)
+	signatureSize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "code_sign_bench_signature_size_bytes",
+			Help: "Size of the manifest signature shipped with the artifact in bytes, by scheme",
+		},
+		[]string{"scheme"},
+	)
+	publicKeySize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "code_sign_bench_public_key_size_bytes",
+			Help: "Size of the verification public key provisioned in the device in bytes, by scheme",
+		},
+		[]string{"scheme"},
+	)
+	signaturesTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "code_sign_bench_signatures_total",
+			Help: "Total number of artifacts signed and verified, by result",
+		},
+		[]string{"scheme", "result"},
+	)
+)
+
+// 成果物のサイズの上限（MB）
+const MaxSizeMB = 4096
+
+// ハッシュに書き込むブロックのサイズ（成果物全体をメモリに置かず、乱数のブロックを繰り返し流す）
+const blockSize = 1 << 20
+
+// ベンチマークの設定
+type Config struct {
+	Interval time.Duration // 計測する間隔
+	SizesMB  []int         // 署名する成果物のサイズ（MB）
+}
+
+// デフォルト設定（500MBの成果物は方式ごとに数秒かかるため、間隔を長めにする）
+func DefaultConfig() Config {
+	return Config{Interval: 5 * time.Minute, SizesMB: []int{1, 10, 100, 500}}
+}
+
+// 成果物のサイズのリストを解釈する（例: "1,10,100"）
+func ParseSizes(s string) ([]int, error) {
+	var sizes []int
+	for _, field := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 1 || n > MaxSizeMB {
+			return nil, fmt.Errorf("成果物のサイズは1〜%dMBで指定してください: %q", MaxSizeMB, field)
+		}
+		sizes = append(sizes, n)
+	}
+	slices.Sort(sizes)
+	return slices.Compact(sizes), nil
+}
+
+// 一定間隔ですべての方式とサイズで成果物に署名して検証する
+func Run(cfg Config) error {
+	if len(cfg.SizesMB) == 0 {
+		return fmt.Errorf("成果物のサイズを指定してください")
+	}
+	schemes, err := newSchemes()
+	if err != nil {
+		return err
+	}
+	block := make([]byte, blockSize)
+	if _, err := rand.Read(block); err != nil {
+		return fmt.Errorf("成果物のデータの生成エラー: %w", err)
+	}
+	for _, s := range schemes {
+		publicKeySize.WithLabelValues(s.Name()).Set(float64(s.publicKeySize()))
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		for _, size := range cfg.SizesMB {
+			for _, s := range schemes {
+				if err := benchmark(s, block, size); err != nil {
+					signaturesTotal.WithLabelValues(s.Name(), "failure").Inc()
+					log.Printf("成果物の署名・検証に失敗 [%s, %dMB]: %v", s.Name(), size, err)
+					continue
+				}
+				signaturesTotal.WithLabelValues(s.Name(), "success").Inc()
+			}
+		}
+	}
+}
+
+// sizeMBの成果物に署名し、デバイスと同じように成果物全体をハッシュし直して検証する
+func benchmark(s Scheme, block []byte, sizeMB int) error {
+	name, label := s.Name(), strconv.Itoa(sizeMB)
+	size := int64(sizeMB) * blockSize
+
+	start := time.Now()
+	manifest := newManifest(s.hash(), block, size)
+	opStart := time.Now()
+	sig, err := s.sign(manifest)
+	if err != nil {
+		return err
+	}
+	operationDuration.WithLabelValues(name, "sign").Observe(time.Since(opStart).Seconds())
+	elapsed := time.Since(start)
+	signDuration.WithLabelValues(name, label).Observe(elapsed.Seconds())
+	throughput.WithLabelValues(name, "sign", label).Set(float64(size) / elapsed.Seconds())
+	signatureSize.WithLabelValues(name).Set(float64(len(sig)))
+
+	start = time.Now()
+	manifest = newManifest(s.hash(), block, size)
+	opStart = time.Now()
+	if !s.verify(manifest, sig) {
+		return fmt.Errorf("署名の検証に失敗しました")
+	}
+	operationDuration.WithLabelValues(name, "verify").Observe(time.Since(opStart).Seconds())
+	elapsed = time.Since(start)
+	verifyDuration.WithLabelValues(name, label).Observe(elapsed.Seconds())
+	throughput.WithLabelValues(name, "verify", label).Set(float64(size) / elapsed.Seconds())
+	return nil
+}
+
+// 成果物をハッシュにストリーミングし、マニフェスト（ハッシュ関数、サイズ、ダイジェスト）を作成する
+func newManifest(h crypto.Hash, block []byte, size int64) []byte {
+	digest := h.New()
+	for written := int64(0); written < size; written += int64(len(block)) {
+		digest.Write(block[:min(int64(len(block)), size-written)])
+	}
+	manifest := []byte(h.String())
+	manifest = binary.BigEndian.AppendUint64(manifest, uint64(size))
+	return digest.Sum(manifest)
+}
@@ -0,0 +1,156 @@
+package codesign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512" // 成果物のダイジェストのSHA-384、SHA-512
+	"crypto/x509"
+	"fmt"
+
+	"github.com/cloudflare/circl/sign"
+	"github.com/cloudflare/circl/sign/mldsa/mldsa65"
+	"github.com/cloudflare/circl/sign/mldsa/mldsa87"
+	"github.com/cloudflare/circl/sign/slhdsa"
+)
+
+// ファームウェアの署名方式
+// 成果物はhash()のハッシュ関数でストリーミングしてダイジェストにし、ダイジェストを含むマニフェストに署名する
+type Scheme interface {
+	Name() string
+	// 成果物のダイジェストに使うハッシュ関数（方式の安全性の強度に合わせる）
+	hash() crypto.Hash
+	sign(manifest []byte) ([]byte, error)
+	verify(manifest, sig []byte) bool
+	// デバイスに書き込む検証用の公開鍵のサイズ
+	publicKeySize() int
+}
+
+// 署名のコンテキスト（ML-DSA、SLH-DSAで他の用途の署名と区別する）
+const signatureContext = "PQC_grafana firmware"
+
+// 比較するすべての方式の鍵を生成する
+// セキュアブートで現在使われるRSA・ECDSAと、CNSA 2.0でファームウェアの署名に推奨されるハッシュベースの方式（SLH-DSA）、ML-DSA
+func newSchemes() ([]Scheme, error) {
+	rsaScheme, err := newRSAScheme(3072)
+	if err != nil {
+		return nil, err
+	}
+	ecdsaScheme, err := newECDSAScheme()
+	if err != nil {
+		return nil, err
+	}
+	schemes := []Scheme{rsaScheme, ecdsaScheme}
+	for _, c := range []struct {
+		scheme sign.Scheme
+		hash   crypto.Hash
+	}{
+		{mldsa65.Scheme(), crypto.SHA384},
+		{mldsa87.Scheme(), crypto.SHA512},
+		{slhdsa.SHA2_128s.Scheme(), crypto.SHA256},
+		{slhdsa.SHA2_128f.Scheme(), crypto.SHA256},
+		{slhdsa.SHA2_256s.Scheme(), crypto.SHA512},
+	} {
+		s, err := newCirclScheme(c.scheme, c.hash)
+		if err != nil {
+			return nil, err
+		}
+		schemes = append(schemes, s)
+	}
+	return schemes, nil
+}
+
+// RSA + PKCS #1 v1.5 + SHA-256
+type rsaScheme struct {
+	priv *rsa.PrivateKey
+}
+
+func newRSAScheme(bits int) (*rsaScheme, error) {
+	priv, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, fmt.Errorf("RSA鍵生成エラー: %w", err)
+	}
+	return &rsaScheme{priv: priv}, nil
+}
+
+func (s *rsaScheme) Name() string      { return fmt.Sprintf("RSA-%d", s.priv.N.BitLen()) }
+func (s *rsaScheme) hash() crypto.Hash { return crypto.SHA256 }
+
+// マニフェストのハッシュに署名する
+func (s *rsaScheme) sign(manifest []byte) ([]byte, error) {
+	digest := sha256.Sum256(manifest)
+	return rsa.SignPKCS1v15(rand.Reader, s.priv, crypto.SHA256, digest[:])
+}
+
+func (s *rsaScheme) verify(manifest, sig []byte) bool {
+	digest := sha256.Sum256(manifest)
+	return rsa.VerifyPKCS1v15(&s.priv.PublicKey, crypto.SHA256, digest[:], sig) == nil
+}
+
+func (s *rsaScheme) publicKeySize() int { return len(x509.MarshalPKCS1PublicKey(&s.priv.PublicKey)) }
+
+// ECDSA P-256 + SHA-256（署名はASN.1）
+type ecdsaScheme struct {
+	priv *ecdsa.PrivateKey
+}
+
+func newECDSAScheme() (*ecdsaScheme, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("ECDSA鍵生成エラー: %w", err)
+	}
+	return &ecdsaScheme{priv: priv}, nil
+}
+
+func (s *ecdsaScheme) Name() string      { return "ECDSA-P256" }
+func (s *ecdsaScheme) hash() crypto.Hash { return crypto.SHA256 }
+
+func (s *ecdsaScheme) sign(manifest []byte) ([]byte, error) {
+	digest := sha256.Sum256(manifest)
+	return ecdsa.SignASN1(rand.Reader, s.priv, digest[:])
+}
+
+func (s *ecdsaScheme) verify(manifest, sig []byte) bool {
+	digest := sha256.Sum256(manifest)
+	return ecdsa.VerifyASN1(&s.priv.PublicKey, digest[:], sig)
+}
+
+// 非圧縮形式の点
+func (s *ecdsaScheme) publicKeySize() int { return 65 }
+
+// circlの署名方式（ML-DSA、SLH-DSA）
+// マニフェストはダイジェストを含む小さなメッセージのため、事前ハッシュ版（HashML-DSA、HashSLH-DSA）ではなく通常の署名を使う
+type circlScheme struct {
+	scheme sign.Scheme
+	digest crypto.Hash
+	pub    sign.PublicKey
+	priv   sign.PrivateKey
+}
+
+func newCirclScheme(s sign.Scheme, digest crypto.Hash) (*circlScheme, error) {
+	pub, priv, err := s.GenerateKey()
+	if err != nil {
+		return nil, fmt.Errorf("%sの鍵生成エラー: %w", s.Name(), err)
+	}
+	return &circlScheme{scheme: s, digest: digest, pub: pub, priv: priv}, nil
+}
+
+func (s *circlScheme) Name() string      { return s.scheme.Name() }
+func (s *circlScheme) hash() crypto.Hash { return s.digest }
+
+func (s *circlScheme) sign(manifest []byte) ([]byte, error) {
+	sig := s.scheme.Sign(s.priv, manifest, &sign.SignatureOpts{Context: signatureContext})
+	if len(sig) == 0 {
+		return nil, fmt.Errorf("%sの署名に失敗しました", s.scheme.Name())
+	}
+	return sig, nil
+}
+
+func (s *circlScheme) verify(manifest, sig []byte) bool {
+	return s.scheme.Verify(s.pub, manifest, sig, &sign.SignatureOpts{Context: signatureContext})
+}
+
+func (s *circlScheme) publicKeySize() int { return s.scheme.PublicKeySize() }
@@ -0,0 +1,193 @@
+// Package coldstart はクライアントの1回の鍵交換をサーバーレス関数のHTTPハンドラーとして実行し、
+// コールドスタートと暗号処理の時間を計測する
+//
+// ハンドラーはCloud Functions（Go）、Cloud Run、Lambda Web Adapterを使ったLambdaでそのまま動かせる。
+// 関数のインスタンスは呼び出しの間だけ動いてスクレイプできないため、呼び出しのたびにメトリクスを
+// Pushgatewayに送り、PQCのライブラリの初期化がコールドスタートに与える影響をGrafanaで比較できるようにする
+package coldstart
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/benchclient"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// サービス名（メトリクスのserviceラベル）
+const ServiceName = "coldstart"
+
+var factory = metrics.NewFactory(ServiceName, "coldstart_")
+
+var (
+	invocationsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "coldstart_invocations_total",
+			Help: "Total number of function invocations, by algorithm, start (cold, warm) and result",
+		},
+		[]string{"algorithm", "start", "result"},
+	)
+	initDuration = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "coldstart_init_duration_seconds",
+			Help: "Time from process start until the function handler was created in seconds (runtime and package initialization including the PQC libraries)",
+		},
+		[]string{"algorithm"},
+	)
+	operationDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "coldstart_operation_duration_seconds",
+			Help:    "Histogram of the key exchange (public key fetch through decryption check) in seconds, by algorithm and start (cold, warm)",
+			Buckets: []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+		},
+		[]string{"algorithm", "start"},
+	)
+	cryptoDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "coldstart_crypto_duration_seconds",
+			Help:    "Histogram of the client-side encapsulation or encryption and key wrap in seconds, by algorithm and start (cold, warm)",
+			Buckets: []float64{0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025},
+		},
+		[]string{"algorithm", "start"},
+	)
+	coldStartDuration = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "coldstart_cold_start_duration_seconds",
+			Help: "Initialization plus the first invocation of the instance in seconds, excluding the idle time before the first request",
+		},
+		[]string{"algorithm"},
+	)
+	pushFailures = factory.NewCounter(
+		prometheus.CounterOpts{
+			Name: "coldstart_push_failures_total",
+			Help: "Total number of failed pushes to the Pushgateway",
+		},
+	)
+)
+
+// 関数の設定
+type Config struct {
+	KeyURLs     map[string]string // 鍵交換方式ごとの公開鍵のURL
+	Algorithm   string            // クエリのalgorithmがない場合の鍵交換方式
+	MessageSize int               // 暗号化するメッセージのサイズ（バイト）
+	PushURL     string            // PushgatewayのURL（空の場合は送らない）
+	Job         string            // Pushgatewayのjobラベル
+	Instance    string            // Pushgatewayのinstanceラベル（空の場合はホスト名）
+	PushTimeout time.Duration     // 1回の送信の上限（関数の応答を遅らせすぎないようにする）
+}
+
+// docker-compose環境向けのデフォルト設定
+func DefaultConfig() Config {
+	return Config{
+		KeyURLs: map[string]string{
+			benchclient.AlgorithmRSA:   "http://rsa-server:8080/public-key",
+			benchclient.AlgorithmMLKEM: "http://ml-kem-server:8081/public-key",
+		},
+		Algorithm:   benchclient.AlgorithmMLKEM,
+		MessageSize: 1024,
+		Job:         "pqc_coldstart",
+		PushTimeout: 2 * time.Second,
+	}
+}
+
+// サーバーレス関数のハンドラー
+// 計測の状態はプロセスで共有するため、1つのプロセスで作るのは1つだけにする
+type Function struct {
+	cfg     Config
+	init    time.Duration // プロセスの開始からハンドラーを作るまで
+	invoked atomic.Bool
+	pushMu  sync.Mutex
+	pusher  *push.Pusher
+}
+
+// 設定を検証してハンドラーを作る
+func New(cfg Config) (*Function, error) {
+	if _, ok := cfg.KeyURLs[cfg.Algorithm]; !ok {
+		return nil, fmt.Errorf("%sの公開鍵のURLが指定されていません", cfg.Algorithm)
+	}
+	if cfg.MessageSize < 1 {
+		return nil, fmt.Errorf("メッセージのサイズは1以上で指定してください: %d", cfg.MessageSize)
+	}
+	f := &Function{cfg: cfg, init: metrics.SinceProcessStart()}
+	if cfg.PushURL != "" {
+		instance := cfg.Instance
+		if instance == "" {
+			instance, _ = os.Hostname()
+		}
+		f.pusher = push.New(cfg.PushURL, cfg.Job).Gatherer(metrics.Gatherer()).Grouping("instance", instance)
+	}
+	return f, nil
+}
+
+// 1回の呼び出しで1回の鍵交換を実行し、結果をJSONで返す（?algorithm=rsa で方式を選ぶ）
+func (f *Function) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	algorithm := f.cfg.Algorithm
+	if a := r.URL.Query().Get("algorithm"); a != "" {
+		algorithm = a
+	}
+	keyURL, ok := f.cfg.KeyURLs[algorithm]
+	if !ok {
+		http.Error(w, fmt.Sprintf("%sの公開鍵のURLが指定されていません", algorithm), http.StatusBadRequest)
+		return
+	}
+	cold := f.invoked.CompareAndSwap(false, true)
+	resp := wire.ColdStartResponse{Algorithm: algorithm, Cold: cold}
+	startLabel := "warm"
+	if cold {
+		startLabel = "cold"
+		resp.InitSeconds = f.init.Seconds()
+		initDuration.WithLabelValues(algorithm).Set(resp.InitSeconds)
+	}
+
+	status := http.StatusOK
+	result := "success"
+	res, err := benchclient.RunSingle(resp.Algorithm, keyURL, f.cfg.MessageSize)
+	if err != nil {
+		status, result = http.StatusBadGateway, "failure"
+		resp.Error = err.Error()
+		log.Printf("[%s] 鍵交換エラー (%s): %v", ServiceName, resp.Algorithm, err)
+	} else {
+		resp.OperationSeconds = res.Timings.Total.Seconds()
+		resp.CryptoSeconds = res.Timings.Wrap.Seconds()
+		operationDuration.WithLabelValues(resp.Algorithm, startLabel).Observe(resp.OperationSeconds)
+		cryptoDuration.WithLabelValues(resp.Algorithm, startLabel).Observe(resp.CryptoSeconds)
+	}
+	invocationsTotal.WithLabelValues(resp.Algorithm, startLabel, result).Inc()
+	if cold {
+		// 最初のリクエストを待っていた時間は含めない
+		coldStartDuration.WithLabelValues(resp.Algorithm).Set((f.init + time.Since(start)).Seconds())
+	}
+	// インスタンスが応答の後に凍結されても値が残るように、応答の前に送る
+	f.push(r.Context())
+	resp.TotalSeconds = time.Since(start).Seconds()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// メトリクスをPushgatewayに送る（同時に呼び出された場合は順に送る）
+func (f *Function) push(ctx context.Context) {
+	if f.pusher == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, f.cfg.PushTimeout)
+	defer cancel()
+	f.pushMu.Lock()
+	defer f.pushMu.Unlock()
+	if err := f.pusher.PushContext(ctx); err != nil {
+		pushFailures.Inc()
+		log.Printf("[%s] Pushgatewayへの送信エラー: %v", ServiceName, err)
+	}
+}
@@ -0,0 +1,103 @@
+package cryptoutil
+
+import (
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+// ラップするデータ鍵の長さが不正
+var ErrKeyWrapLength = errors.New("ラップする鍵の長さが不正です")
+
+// AESキーラップ（RFC 3394）の初期値
+var aesKWDefaultIV = [8]byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// AESキーラップ（RFC 3394）でデータ鍵をラップする
+// CMSのKEMRecipientInfoなど、標準形式で鍵を受け渡す場合に使う
+func WrapAESKW(kek, key []byte) ([]byte, error) {
+	if len(key) < 16 || len(key)%8 != 0 {
+		return nil, ErrKeyWrapLength
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(key) / 8
+	out := make([]byte, 8+len(key))
+	copy(out[:8], aesKWDefaultIV[:])
+	copy(out[8:], key)
+
+	var buf [16]byte
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(buf[:8], out[:8])
+			copy(buf[8:], out[8*i:8*i+8])
+			block.Encrypt(buf[:], buf[:])
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(out[:8], binary.BigEndian.Uint64(buf[:8])^t)
+			copy(out[8*i:8*i+8], buf[8:])
+		}
+	}
+	return out, nil
+}
+
+// HKDF-SHA256（RFC 5869）で鍵を導出する
+func HKDFSHA256(secret, salt, info []byte, length int) []byte {
+	if salt == nil {
+		salt = make([]byte, sha256.Size)
+	}
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+	defer Zeroize(prk)
+
+	var out, t []byte
+	for counter := byte(1); len(out) < length; counter++ {
+		expand := hmac.New(sha256.New, prk)
+		expand.Write(t)
+		expand.Write(info)
+		expand.Write([]byte{counter})
+		t = expand.Sum(nil)
+		out = append(out, t...)
+	}
+	return out[:length]
+}
+
+// AESキーラップ（RFC 3394）でラップされたデータ鍵を取り出す
+// 初期値が一致しない場合（KEKが違う、改ざんされた）はErrAuthenticationを返す
+func UnwrapAESKW(kek, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 24 || len(wrapped)%8 != 0 {
+		return nil, ErrKeyWrapLength
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(wrapped)/8 - 1
+	var a [8]byte
+	copy(a[:], wrapped[:8])
+	key := make([]byte, len(wrapped)-8)
+	copy(key, wrapped[8:])
+
+	var buf [16]byte
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(buf[:8], binary.BigEndian.Uint64(a[:])^t)
+			copy(buf[8:], key[8*(i-1):8*i])
+			block.Decrypt(buf[:], buf[:])
+			copy(a[:], buf[:8])
+			copy(key[8*(i-1):8*i], buf[8:])
+		}
+	}
+	if subtle.ConstantTimeCompare(a[:], aesKWDefaultIV[:]) != 1 {
+		Zeroize(key)
+		return nil, ErrAuthentication
+	}
+	return key, nil
+}
@@ -0,0 +1,85 @@
+package cryptoutil
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// RFC 3394 §4 の試験ベクタ
+var aesKWVectors = []struct {
+	name, kek, key, wrapped string
+}{
+	{"4.1 128-bit KEK, 128-bit key", "000102030405060708090a0b0c0d0e0f", "00112233445566778899aabbccddeeff", "1fa68b0a8112b447aef34bd8fb5a7b829d3e862371d2cfe5"},
+	{"4.6 256-bit KEK, 256-bit key", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "00112233445566778899aabbccddeeff000102030405060708090a0b0c0d0e0f", "28c9f404c4b810f4cbccb35cfb87f8263f5786e2d80ed326cbc7f0e71a99f43bfb988b9b7a02dd21"},
+}
+
+func TestAESKWVectors(t *testing.T) {
+	for _, v := range aesKWVectors {
+		t.Run(v.name, func(t *testing.T) {
+			kek, key, want := mustHex(t, v.kek), mustHex(t, v.key), mustHex(t, v.wrapped)
+			got, err := WrapAESKW(kek, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("WrapAESKW = %x, want %x", got, want)
+			}
+			unwrapped, err := UnwrapAESKW(kek, want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(unwrapped, key) {
+				t.Fatalf("UnwrapAESKW = %x, want %x", unwrapped, key)
+			}
+		})
+	}
+}
+
+func TestUnwrapAESKWWrongKEK(t *testing.T) {
+	v := aesKWVectors[0]
+	kek := mustHex(t, v.kek)
+	kek[0] ^= 0x01
+	if _, err := UnwrapAESKW(kek, mustHex(t, v.wrapped)); !errors.Is(err, ErrAuthentication) {
+		t.Fatalf("err = %v, want ErrAuthentication", err)
+	}
+}
+
+func TestAESKWLength(t *testing.T) {
+	kek := mustHex(t, aesKWVectors[0].kek)
+	for _, n := range []int{0, 8, 20} {
+		if _, err := WrapAESKW(kek, make([]byte, n)); !errors.Is(err, ErrKeyWrapLength) {
+			t.Errorf("WrapAESKW(%dバイト): err = %v, want ErrKeyWrapLength", n, err)
+		}
+	}
+	for _, n := range []int{16, 28} {
+		if _, err := UnwrapAESKW(kek, make([]byte, n)); !errors.Is(err, ErrKeyWrapLength) {
+			t.Errorf("UnwrapAESKW(%dバイト): err = %v, want ErrKeyWrapLength", n, err)
+		}
+	}
+}
+
+// RFC 5869 Appendix A の試験ベクタ
+func TestHKDFSHA256Vectors(t *testing.T) {
+	tests := []struct {
+		name                 string
+		ikm, salt, info, okm string
+	}{
+		{"A.1 basic", "0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b", "000102030405060708090a0b0c", "f0f1f2f3f4f5f6f7f8f9", "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865"},
+		{"A.3 zero-length salt and info", "0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b", "", "", "8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := mustHex(t, tt.okm)
+			got := HKDFSHA256(mustHex(t, tt.ikm), mustHex(t, tt.salt), mustHex(t, tt.info), len(want))
+			if !bytes.Equal(got, want) {
+				t.Fatalf("HKDFSHA256 = %x, want %x", got, want)
+			}
+		})
+	}
+	// saltを省略した場合はハッシュ長のゼロ列を使う（RFC 5869 §2.2）
+	ikm := mustHex(t, tests[1].ikm)
+	if got, want := HKDFSHA256(ikm, nil, nil, 42), mustHex(t, tests[1].okm); !bytes.Equal(got, want) {
+		t.Fatalf("saltなし: HKDFSHA256 = %x, want %x", got, want)
+	}
+}
@@ -0,0 +1,164 @@
+package cryptoutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+)
+
+// データ暗号化方式の識別子（Encrypt-then-MACのAES-256-CBC + HMAC-SHA256）
+const AlgorithmCBCHMAC = "AES-256-CBC-HMAC-SHA256"
+
+// MACの長さ（バイト）
+const MACSize = sha256.Size
+
+var (
+	// MACの検証に失敗した
+	ErrAuthentication = errors.New("メッセージ認証に失敗しました")
+	// パディングが不正
+	ErrPadding = errors.New("パディングが不正です")
+	// 暗号文やIVの長さが不正
+	ErrCiphertextLength = errors.New("暗号文の長さが不正です")
+)
+
+// PKCS#7パディングを追加する
+func PKCS7Pad(data []byte, blockSize int) []byte {
+	padding := blockSize - len(data)%blockSize
+	padded := make([]byte, len(data), len(data)+padding)
+	copy(padded, data)
+	for i := 0; i < padding; i++ {
+		padded = append(padded, byte(padding))
+	}
+	return padded
+}
+
+// PKCS#7パディングを定数時間で検証して除去する
+// パディングの内容によって処理時間が変わらないよう、常にブロック長分のバイトを検査する
+func PKCS7Unpad(data []byte, blockSize int) ([]byte, error) {
+	// 長さは暗号文から分かる公開情報なので分岐してよい
+	if len(data) == 0 || len(data)%blockSize != 0 {
+		return nil, ErrPadding
+	}
+
+	padLen := int(data[len(data)-1])
+	good := subtle.ConstantTimeLessOrEq(1, padLen) & subtle.ConstantTimeLessOrEq(padLen, blockSize)
+	for i := 0; i < blockSize; i++ {
+		// 末尾からpadLenバイト以内のバイトはすべてpadLenと等しくなければならない
+		inPadding := subtle.ConstantTimeLessOrEq(i+1, padLen)
+		matches := subtle.ConstantTimeByteEq(data[len(data)-1-i], byte(padLen))
+		good &= subtle.ConstantTimeSelect(inPadding, matches, 1)
+	}
+	if good != 1 {
+		return nil, ErrPadding
+	}
+	return data[:len(data)-padLen], nil
+}
+
+// データ鍵から暗号化用の鍵とMAC用の鍵を導出する
+// 暗号化用の鍵はデータ鍵と同じ長さ（AES-128・192・256）、MAC用の鍵は常に32バイト
+func deriveCBCHMACKeys(key []byte) (encKey, macKey []byte, err error) {
+	if _, ok := DataCipherFor(FamilyCBCHMAC, len(key)); !ok {
+		return nil, nil, aes.KeySizeError(len(key))
+	}
+	derive := func(label string) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(label))
+		return mac.Sum(nil)
+	}
+	return derive("pqc-grafana cbc encryption key")[:len(key)], derive("pqc-grafana cbc mac key"), nil
+}
+
+// IVと暗号文に対するMACを計算する
+func cbcMAC(macKey, iv, ciphertext []byte) []byte {
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(iv)
+	mac.Write(ciphertext)
+	return mac.Sum(nil)
+}
+
+// AES-CBC（鍵の長さはデータ鍵と同じ）で暗号化し、IVと暗号文にHMAC-SHA256を付与する（Encrypt-then-MAC）
+func EncryptCBCHMAC(key, plaintext []byte) (iv, ciphertext, tag []byte, err error) {
+	encKey, macKey, err := deriveCBCHMACKeys(key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer Zeroize(encKey)
+	defer Zeroize(macKey)
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if iv, err = Nonces.NextRandom(key, aes.BlockSize); err != nil {
+		return nil, nil, nil, err
+	}
+
+	padded := PKCS7Pad(plaintext, aes.BlockSize)
+	ciphertext = make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+
+	return iv, ciphertext, cbcMAC(macKey, iv, ciphertext), nil
+}
+
+// MACを検証してからAES-CBCで復号する
+// MACの検証に失敗した場合は復号もパディングの検査も行わないため、パディングオラクルにならない
+func DecryptCBCHMAC(key, iv, ciphertext, tag []byte) ([]byte, error) {
+	encKey, macKey, err := deriveCBCHMACKeys(key)
+	if err != nil {
+		return nil, err
+	}
+	defer Zeroize(encKey)
+	defer Zeroize(macKey)
+
+	if !hmac.Equal(cbcMAC(macKey, iv, ciphertext), tag) {
+		return nil, ErrAuthentication
+	}
+	plaintext, err := decryptCBC(encKey, iv, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	// MACが正しい暗号文でパディングが不正になるのは送信側の不具合のみ
+	return PKCS7Unpad(plaintext, aes.BlockSize)
+}
+
+// 【教育用・脆弱】先に復号してパディングを検査し、その後でMACを検証する
+// パディングエラーと認証エラーが区別できるため、パディングオラクル攻撃のデモにのみ使うこと
+func DecryptCBCHMACVulnerable(key, iv, ciphertext, tag []byte) ([]byte, error) {
+	encKey, macKey, err := deriveCBCHMACKeys(key)
+	if err != nil {
+		return nil, err
+	}
+	defer Zeroize(encKey)
+	defer Zeroize(macKey)
+
+	padded, err := decryptCBC(encKey, iv, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := PKCS7Unpad(padded, aes.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(cbcMAC(macKey, iv, ciphertext), tag) {
+		return nil, ErrAuthentication
+	}
+	return plaintext, nil
+}
+
+// AES-CBCで復号する（パディングは除去しない）
+func decryptCBC(encKey, iv, ciphertext []byte) ([]byte, error) {
+	if len(iv) != aes.BlockSize || len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, ErrCiphertextLength
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+	return plaintext, nil
+}
@@ -0,0 +1,140 @@
+package cryptoutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// データ暗号化方式の種類
+const (
+	FamilyCBCHMAC          = "aes-cbc-hmac"      // AES-CBC + HMAC-SHA256（Encrypt-then-MAC）
+	FamilyAESGCM           = "aes-gcm"           // AES-GCM
+	FamilyAESGCMSIV        = "aes-gcm-siv"       // AES-GCM-SIV（RFC 8452、ノンスの再利用に耐性がある）
+	FamilyChaCha20Poly1305 = "chacha20-poly1305" // ChaCha20-Poly1305（AES-NIのない環境向け）
+)
+
+// データ暗号化方式（EncryptedData.Algorithmの値ごと）
+// AEADの方式では、暗号化データのivにノンス、macに認証タグを入れる
+type DataCipher struct {
+	Name    string // EncryptedData.Algorithm
+	Family  string
+	KeySize int // データ鍵のサイズ（バイト）
+	IVSize  int // IVまたはノンスのサイズ（バイト）
+	TagSize int // MACまたは認証タグのサイズ（バイト）
+	Padded  bool
+}
+
+// サポートしているデータ暗号化方式（種類ごとに鍵の短い順）
+var dataCiphers = []DataCipher{
+	{Name: "AES-128-CBC-HMAC-SHA256", Family: FamilyCBCHMAC, KeySize: 16, IVSize: aes.BlockSize, TagSize: MACSize, Padded: true},
+	{Name: "AES-192-CBC-HMAC-SHA256", Family: FamilyCBCHMAC, KeySize: 24, IVSize: aes.BlockSize, TagSize: MACSize, Padded: true},
+	{Name: AlgorithmCBCHMAC, Family: FamilyCBCHMAC, KeySize: 32, IVSize: aes.BlockSize, TagSize: MACSize, Padded: true},
+	{Name: "AES-128-GCM", Family: FamilyAESGCM, KeySize: 16, IVSize: 12, TagSize: 16},
+	{Name: "AES-192-GCM", Family: FamilyAESGCM, KeySize: 24, IVSize: 12, TagSize: 16},
+	{Name: "AES-256-GCM", Family: FamilyAESGCM, KeySize: 32, IVSize: 12, TagSize: 16},
+	{Name: "AES-128-GCM-SIV", Family: FamilyAESGCMSIV, KeySize: 16, IVSize: gcmSIVNonceSize, TagSize: gcmSIVTagSize},
+	{Name: "AES-256-GCM-SIV", Family: FamilyAESGCMSIV, KeySize: 32, IVSize: gcmSIVNonceSize, TagSize: gcmSIVTagSize},
+	{Name: "ChaCha20-Poly1305", Family: FamilyChaCha20Poly1305, KeySize: chacha20poly1305.KeySize, IVSize: chacha20poly1305.NonceSize, TagSize: chacha20poly1305.Overhead},
+}
+
+// 識別子に対応するデータ暗号化方式
+func LookupDataCipher(name string) (DataCipher, bool) {
+	for _, c := range dataCiphers {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return DataCipher{}, false
+}
+
+// 種類とデータ鍵のサイズ（バイト）に対応するデータ暗号化方式
+func DataCipherFor(family string, keySize int) (DataCipher, bool) {
+	for _, c := range dataCiphers {
+		if c.Family == family && c.KeySize == keySize {
+			return c, true
+		}
+	}
+	return DataCipher{}, false
+}
+
+// 種類が存在するか
+func KnownDataCipherFamily(family string) bool {
+	for _, c := range dataCiphers {
+		if c.Family == family {
+			return true
+		}
+	}
+	return false
+}
+
+// データ暗号化方式の種類
+func DataCipherFamilies() []string {
+	return []string{FamilyCBCHMAC, FamilyAESGCM, FamilyAESGCMSIV, FamilyChaCha20Poly1305}
+}
+
+// サポートしているデータ暗号化方式の識別子
+func DataCipherNames() []string {
+	names := make([]string, len(dataCiphers))
+	for i, c := range dataCiphers {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// 平文をデータ暗号化方式で暗号化する
+func (c DataCipher) Seal(key, plaintext []byte) (iv, ciphertext, tag []byte, err error) {
+	if c.Family == FamilyCBCHMAC {
+		return EncryptCBCHMAC(key, plaintext)
+	}
+	aead, err := c.aead(key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if iv, err = Nonces.Next(key, c.IVSize); err != nil {
+		return nil, nil, nil, err
+	}
+	sealed := aead.Seal(nil, iv, plaintext, nil)
+	n := len(sealed) - c.TagSize
+	return iv, sealed[:n], sealed[n:], nil
+}
+
+// 暗号文を認証してから復号する
+func (c DataCipher) Open(key, iv, ciphertext, tag []byte) ([]byte, error) {
+	if c.Family == FamilyCBCHMAC {
+		return DecryptCBCHMAC(key, iv, ciphertext, tag)
+	}
+	if len(iv) != c.IVSize || len(tag) != c.TagSize {
+		return nil, ErrCiphertextLength
+	}
+	aead, err := c.aead(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed := make([]byte, 0, len(ciphertext)+len(tag))
+	sealed = append(append(sealed, ciphertext...), tag...)
+	plaintext, err := aead.Open(nil, iv, sealed, nil)
+	if err != nil {
+		return nil, ErrAuthentication
+	}
+	return plaintext, nil
+}
+
+func (c DataCipher) aead(key []byte) (cipher.AEAD, error) {
+	if len(key) != c.KeySize {
+		return nil, fmt.Errorf("%sの鍵の長さが不正です: %dバイト", c.Name, len(key))
+	}
+	switch c.Family {
+	case FamilyChaCha20Poly1305:
+		return chacha20poly1305.New(key)
+	case FamilyAESGCMSIV:
+		return NewGCMSIV(key)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
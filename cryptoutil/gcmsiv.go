@@ -0,0 +1,215 @@
+package cryptoutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+// AES-GCM-SIVの鍵の長さが不正（AES-128またはAES-256のみ）
+var ErrGCMSIVKeyLength = errors.New("AES-GCM-SIVの鍵は16バイトまたは32バイトです")
+
+const (
+	gcmSIVNonceSize = 12
+	gcmSIVTagSize   = 16
+)
+
+// AES-GCM-SIV（RFC 8452）
+// ノンスを再利用しても同じ平文が同じ暗号文になることが分かるだけで、AES-GCMのように認証鍵や平文が漏れない
+// 研究用の実装で、POLYVALはテーブルを使わない定数時間のビットごとの乗算のため標準ライブラリのAES-GCMより遅い
+type gcmSIV struct {
+	block   cipher.Block // 鍵生成鍵
+	keySize int
+}
+
+// AES-GCM-SIVのAEADを作る
+func NewGCMSIV(key []byte) (cipher.AEAD, error) {
+	if len(key) != 16 && len(key) != 32 {
+		return nil, ErrGCMSIVKeyLength
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &gcmSIV{block: block, keySize: len(key)}, nil
+}
+
+func (g *gcmSIV) NonceSize() int { return gcmSIVNonceSize }
+func (g *gcmSIV) Overhead() int  { return gcmSIVTagSize }
+
+// ノンスごとの認証鍵と暗号化鍵を導出する（RFC 8452 4節）
+func (g *gcmSIV) deriveKeys(nonce []byte) (authKey [16]byte, encBlock cipher.Block, err error) {
+	var in, out [16]byte
+	copy(in[4:], nonce)
+	encKey := make([]byte, 0, 32)
+	defer Zeroize(encKey[:cap(encKey)])
+	chunks := 4
+	if g.keySize == 32 {
+		chunks = 6
+	}
+	for i := 0; i < chunks; i++ {
+		binary.LittleEndian.PutUint32(in[:4], uint32(i))
+		g.block.Encrypt(out[:], in[:])
+		if i < 2 {
+			copy(authKey[8*i:], out[:8])
+		} else {
+			encKey = append(encKey, out[:8]...)
+		}
+	}
+	encBlock, err = aes.NewCipher(encKey)
+	return authKey, encBlock, err
+}
+
+// 認証タグを計算する
+func (g *gcmSIV) tag(authKey [16]byte, encBlock cipher.Block, nonce, plaintext, additionalData []byte) [16]byte {
+	p := newPolyval(authKey)
+	p.update(additionalData)
+	p.update(plaintext)
+	var lengths [16]byte
+	binary.LittleEndian.PutUint64(lengths[:8], uint64(len(additionalData))*8)
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(plaintext))*8)
+	p.update(lengths[:])
+
+	s := p.sum()
+	for i := range nonce {
+		s[i] ^= nonce[i]
+	}
+	s[15] &= 0x7f
+	encBlock.Encrypt(s[:], s[:])
+	return s
+}
+
+// 32ビットのリトルエンディアンのカウンターでCTRモードの暗号化・復号を行う
+func gcmSIVCTR(encBlock cipher.Block, tag [16]byte, dst, src []byte) {
+	counter := tag
+	counter[15] |= 0x80
+	var keystream [16]byte
+	for len(src) > 0 {
+		encBlock.Encrypt(keystream[:], counter[:])
+		n := subtle.XORBytes(dst, src, keystream[:])
+		dst, src = dst[n:], src[n:]
+		binary.LittleEndian.PutUint32(counter[:4], binary.LittleEndian.Uint32(counter[:4])+1)
+	}
+}
+
+func (g *gcmSIV) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != gcmSIVNonceSize {
+		panic("cryptoutil: AES-GCM-SIVのノンスの長さが不正です")
+	}
+	authKey, encBlock, err := g.deriveKeys(nonce)
+	if err != nil {
+		panic(err)
+	}
+	tag := g.tag(authKey, encBlock, nonce, plaintext, additionalData)
+	ret, out := sliceForAppend(dst, len(plaintext)+gcmSIVTagSize)
+	gcmSIVCTR(encBlock, tag, out, plaintext)
+	copy(out[len(plaintext):], tag[:])
+	return ret
+}
+
+func (g *gcmSIV) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != gcmSIVNonceSize || len(ciphertext) < gcmSIVTagSize {
+		return nil, ErrAuthentication
+	}
+	authKey, encBlock, err := g.deriveKeys(nonce)
+	if err != nil {
+		return nil, err
+	}
+	var tag [16]byte
+	n := len(ciphertext) - gcmSIVTagSize
+	copy(tag[:], ciphertext[n:])
+	ret, out := sliceForAppend(dst, n)
+	gcmSIVCTR(encBlock, tag, out, ciphertext[:n])
+	expected := g.tag(authKey, encBlock, nonce, out, additionalData)
+	if subtle.ConstantTimeCompare(expected[:], tag[:]) != 1 {
+		Zeroize(out)
+		return nil, ErrAuthentication
+	}
+	return ret, nil
+}
+
+// inの後ろにnバイトを確保する
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	return head, head[len(in):]
+}
+
+// POLYVAL（RFC 8452 3節）
+// 128ビットの値は下位・上位の64ビットで表し、ビットiがx^iの係数（リトルエンディアン）
+type polyval struct {
+	h     [2]uint64 // H・x^-128（dot(a, H) = a・H・x^-128 を通常の乗算にする）
+	s     [2]uint64
+	block [16]byte
+	n     int
+}
+
+// x^128 = x^127 + x^126 + x^121 + 1 の上位の係数
+const polyvalReductionHi = 1<<63 | 1<<62 | 1<<57
+
+func newPolyval(key [16]byte) *polyval {
+	h := [2]uint64{binary.LittleEndian.Uint64(key[:8]), binary.LittleEndian.Uint64(key[8:])}
+	// x^-1を128回掛ける
+	for range 128 {
+		mask := -(h[0] & 1)
+		h[0] ^= mask & 1
+		h[1] ^= mask & polyvalReductionHi
+		h[0] = h[0]>>1 | h[1]<<63
+		h[1] = h[1]>>1 | mask<<63
+	}
+	return &polyval{h: h}
+}
+
+// GF(2^128)での乗算（定数時間）
+func polyvalMul(a, b [2]uint64) [2]uint64 {
+	var r [2]uint64
+	for i := 127; i >= 0; i-- {
+		// r = r・x
+		carry := -(r[1] >> 63)
+		r[1] = r[1]<<1 | r[0]>>63
+		r[0] <<= 1
+		r[1] ^= carry & polyvalReductionHi
+		r[0] ^= carry & 1
+		// bのビットiが立っていればaを足す
+		bit := -(b[i/64] >> (i % 64) & 1)
+		r[0] ^= bit & a[0]
+		r[1] ^= bit & a[1]
+	}
+	return r
+}
+
+// データを16バイトごとに取り込む（最後の半端なブロックは0を詰めて取り込む）
+func (p *polyval) update(data []byte) {
+	for len(data) > 0 {
+		n := copy(p.block[p.n:], data)
+		p.n += n
+		data = data[n:]
+		if p.n == 16 {
+			p.absorb()
+		}
+	}
+	if p.n > 0 {
+		clear(p.block[p.n:])
+		p.absorb()
+	}
+}
+
+func (p *polyval) absorb() {
+	p.s[0] ^= binary.LittleEndian.Uint64(p.block[:8])
+	p.s[1] ^= binary.LittleEndian.Uint64(p.block[8:])
+	p.s = polyvalMul(p.s, p.h)
+	p.n = 0
+}
+
+func (p *polyval) sum() [16]byte {
+	var out [16]byte
+	binary.LittleEndian.PutUint64(out[:8], p.s[0])
+	binary.LittleEndian.PutUint64(out[8:], p.s[1])
+	return out
+}
@@ -0,0 +1,86 @@
+package cryptoutil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// RFC 8452 Appendix C の試験ベクタ（resultは暗号文とタグを連結したもの）
+var gcmSIVVectors = []struct {
+	name                            string
+	key, nonce, plaintext, aad, out string
+}{
+	{"AES-128 empty", "01000000000000000000000000000000", "030000000000000000000000", "", "", "dc20e2d83f25705bb49e439eca56de25"},
+	{"AES-128 8 bytes", "01000000000000000000000000000000", "030000000000000000000000", "0100000000000000", "", "b5d839330ac7b786578782fff6013b815b287c22493a364c"},
+	{"AES-128 12 bytes", "01000000000000000000000000000000", "030000000000000000000000", "010000000000000000000000", "", "7323ea61d05932260047d942a4978db357391a0bc4fdec8b0d106639"},
+	{"AES-128 16 bytes", "01000000000000000000000000000000", "030000000000000000000000", "01000000000000000000000000000000", "", "743f7c8077ab25f8624e2e948579cf77303aaf90f6fe21199c6068577437a0c4"},
+	{"AES-128 AAD 8 bytes", "01000000000000000000000000000000", "030000000000000000000000", "0200000000000000", "01", "1e6daba35669f4273b0a1a2560969cdf790d99759abd1508"},
+	{"AES-128 AAD 12 bytes", "01000000000000000000000000000000", "030000000000000000000000", "020000000000000000000000", "01", "296c7889fd99f41917f4462008299c5102745aaa3a0c469fad9e075a"},
+	{"AES-256 empty", "0100000000000000000000000000000000000000000000000000000000000000", "030000000000000000000000", "", "", "07f5f4169bbf55a8400cd47ea6fd400f"},
+	{"AES-256 8 bytes", "0100000000000000000000000000000000000000000000000000000000000000", "030000000000000000000000", "0100000000000000", "", "c2ef328e5c71c83b843122130f7364b761e0b97427e3df28"},
+	{"AES-256 12 bytes", "0100000000000000000000000000000000000000000000000000000000000000", "030000000000000000000000", "010000000000000000000000", "", "9aab2aeb3faa0a34aea8e2b18ca50da9ae6559e48fd10f6e5c9ca17e"},
+	{"AES-256 16 bytes", "0100000000000000000000000000000000000000000000000000000000000000", "030000000000000000000000", "01000000000000000000000000000000", "", "85a01b63025ba19b7fd3ddfc033b3e76c9eac6fa700942702e90862383c6c366"},
+	{"AES-256 AAD 8 bytes", "0100000000000000000000000000000000000000000000000000000000000000", "030000000000000000000000", "0200000000000000", "01", "1de22967237a813291213f267e3b452f02d01ae33e4ec854"},
+}
+
+func TestGCMSIVVectors(t *testing.T) {
+	for _, v := range gcmSIVVectors {
+		t.Run(v.name, func(t *testing.T) {
+			aead, err := NewGCMSIV(mustHex(t, v.key))
+			if err != nil {
+				t.Fatal(err)
+			}
+			nonce, plaintext, aad, want := mustHex(t, v.nonce), mustHex(t, v.plaintext), mustHex(t, v.aad), mustHex(t, v.out)
+			got := aead.Seal(nil, nonce, plaintext, aad)
+			if !bytes.Equal(got, want) {
+				t.Fatalf("Seal = %x, want %x", got, want)
+			}
+			opened, err := aead.Open(nil, nonce, want, aad)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			if !bytes.Equal(opened, plaintext) {
+				t.Fatalf("Open = %x, want %x", opened, plaintext)
+			}
+		})
+	}
+}
+
+func TestGCMSIVOpenRejectsTampering(t *testing.T) {
+	v := gcmSIVVectors[4]
+	aead, err := NewGCMSIV(mustHex(t, v.key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, aad, sealed := mustHex(t, v.nonce), mustHex(t, v.aad), mustHex(t, v.out)
+	for _, i := range []int{0, len(sealed) - 1} {
+		tampered := bytes.Clone(sealed)
+		tampered[i] ^= 0x01
+		if _, err := aead.Open(nil, nonce, tampered, aad); !errors.Is(err, ErrAuthentication) {
+			t.Errorf("%dバイト目を改ざん: err = %v, want ErrAuthentication", i, err)
+		}
+	}
+	if _, err := aead.Open(nil, nonce, sealed, []byte{0x02}); !errors.Is(err, ErrAuthentication) {
+		t.Errorf("AADを改ざん: err = %v, want ErrAuthentication", err)
+	}
+	if _, err := aead.Open(nil, nonce, sealed[:gcmSIVTagSize-1], aad); !errors.Is(err, ErrAuthentication) {
+		t.Errorf("タグより短い暗号文: err = %v, want ErrAuthentication", err)
+	}
+}
+
+func TestNewGCMSIVKeyLength(t *testing.T) {
+	if _, err := NewGCMSIV(make([]byte, 24)); !errors.Is(err, ErrGCMSIVKeyLength) {
+		t.Fatalf("err = %v, want ErrGCMSIVKeyLength", err)
+	}
+}
@@ -0,0 +1,111 @@
+package cryptoutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+)
+
+// データ鍵のラップ方式
+const (
+	KeyWrapGCM = "aes-gcm" // AES-256-GCM（固定のノンス、既定）
+	KeyWrapKW  = "aes-kw"  // AESキーラップ（RFC 3394、KMSやCMSで使われる方式）
+)
+
+// ラップ方式の一覧
+func KeyWrapMethods() []string { return []string{KeyWrapGCM, KeyWrapKW} }
+
+// ラップ方式を確認する（空の場合は既定のaes-gcm）
+func NormalizeKeyWrap(method string) (string, error) {
+	switch method {
+	case "":
+		return KeyWrapGCM, nil
+	case KeyWrapGCM, KeyWrapKW:
+		return method, nil
+	}
+	return "", fmt.Errorf("鍵のラップ方式は%sまたは%sを指定してください: %q", KeyWrapGCM, KeyWrapKW, method)
+}
+
+// KEMの共有秘密鍵から鍵暗号化鍵（KEK）を導出する
+func deriveKEK(sharedSecret []byte) []byte {
+	return deriveKEKLabel(sharedSecret, "pqc-grafana kem key wrap")
+}
+
+// ラップ方式ごとに別のKEKになるよう、ラベルを変えて導出する
+func deriveKEKLabel(sharedSecret []byte, label string) []byte {
+	mac := hmac.New(sha256.New, sharedSecret)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
+
+// KEKはカプセル化ごとに一度しか使わないため、固定のノンスで安全に暗号化できる
+func kekAEAD(sharedSecret []byte) (cipher.AEAD, error) {
+	kek := deriveKEK(sharedSecret)
+	defer Zeroize(kek)
+
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// AES-256のデータ鍵をラップした長さ（鍵とGCMのタグ）
+const WrappedKeySize = 32 + 16
+
+// keySizeバイトのデータ鍵をラップした長さ
+func WrappedKeySizeFor(keySize int) int { return keySize + 16 }
+
+// KEMの共有秘密鍵でデータ鍵をラップする（AES-256-GCM）
+func WrapKey(sharedSecret, key []byte) ([]byte, error) {
+	aead, err := kekAEAD(sharedSecret)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	return aead.Seal(nil, nonce, key, nil), nil
+}
+
+// KEMの共有秘密鍵でラップされたデータ鍵を取り出す
+func UnwrapKey(sharedSecret, wrapped []byte) ([]byte, error) {
+	aead, err := kekAEAD(sharedSecret)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	key, err := aead.Open(nil, nonce, wrapped, nil)
+	if err != nil {
+		return nil, ErrAuthentication
+	}
+	return key, nil
+}
+
+// ラップ方式methodでkeySizeバイトのデータ鍵をラップした長さ（AES-KWは8バイトの初期値が付く）
+func WrappedKeySizeWith(method string, keySize int) int {
+	if method == KeyWrapKW {
+		return keySize + 8
+	}
+	return WrappedKeySizeFor(keySize)
+}
+
+// KEMの共有秘密鍵からKEKを導出し、ラップ方式methodでデータ鍵をラップする
+func WrapKeyWith(method string, sharedSecret, key []byte) ([]byte, error) {
+	if method != KeyWrapKW {
+		return WrapKey(sharedSecret, key)
+	}
+	kek := deriveKEKLabel(sharedSecret, "pqc-grafana kem aes-kw")
+	defer Zeroize(kek)
+	return WrapAESKW(kek, key)
+}
+
+// ラップ方式methodでラップされたデータ鍵を取り出す
+func UnwrapKeyWith(method string, sharedSecret, wrapped []byte) ([]byte, error) {
+	if method != KeyWrapKW {
+		return UnwrapKey(sharedSecret, wrapped)
+	}
+	kek := deriveKEKLabel(sharedSecret, "pqc-grafana kem aes-kw")
+	defer Zeroize(kek)
+	return UnwrapAESKW(kek, wrapped)
+}
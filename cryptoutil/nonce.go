@@ -0,0 +1,196 @@
+package cryptoutil
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/keyi1000/PQC_grafana/entropy"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "nonce"
+
+// すべてのメトリクスにserviceラベルを付与して登録する（接頭辞は nonce_）
+var factory = metrics.NewFactory(ServiceName, "nonce_")
+
+// ノンスの生成方式
+const (
+	NonceRandom  = "random"  // 乱数（鍵ごとに約2^32回までが目安）
+	NonceCounter = "counter" // 鍵とノンスの長さごとの乱数の固定部と64ビットのカウンター（追跡している間は重複しない）
+)
+
+// 同じ鍵で発行済みのノンスを再び発行しようとした
+var ErrNonceReuse = errors.New("同じ鍵でノンスが再利用されました")
+
+var (
+	noncesIssued = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "nonce_issued_total",
+			Help: "Total number of nonces and IVs issued for data encryption, by generation mode",
+		},
+		[]string{"mode"},
+	)
+	nonceReuseDetected = factory.NewCounter(
+		prometheus.CounterOpts{
+			Name: "nonce_reuse_detected_total",
+			Help: "Total number of nonces that were already issued for the same key (must always be zero; the encryption is aborted)",
+		},
+	)
+	nonceTrackedKeys = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "nonce_tracked_keys",
+			Help: "Number of data key and nonce size pairs whose issued nonces are currently tracked for reuse detection",
+		},
+	)
+)
+
+// 追跡する鍵とノンスの上限（古い鍵から追跡をやめる）
+// 追跡をやめた鍵をまた使うと、カウンター方式も新しい乱数の固定部と0からのカウンターで数え直す。
+// そのため、その後も重複しないことは固定部（12バイトのノンスでは4バイト）の乱数が一致しないことにしか頼れない
+const (
+	maxNonceKeys    = 4096
+	maxNoncesPerKey = 1 << 16
+)
+
+// 鍵ごとに発行したノンスを記録し、再利用を検出する
+// 鍵は保持せず、プロセスごとの秘密値によるHMACで識別する（固定部の長さがそろうように、ノンスの長さごとに分けて記録する）
+type NonceManager struct {
+	mu     sync.Mutex
+	mode   string
+	secret [32]byte
+	keys   map[[sha256.Size]byte]*keyNonces
+	order  [][sha256.Size]byte // 追跡を始めた順（上限を超えたら先頭から捨てる）
+}
+
+type keyNonces struct {
+	prefix  []byte // カウンター方式の固定部
+	counter uint64
+	issued  map[string]struct{}
+}
+
+// 生成方式がmodeのNonceManagerを作る
+func NewNonceManager(mode string) (*NonceManager, error) {
+	m := &NonceManager{keys: make(map[[sha256.Size]byte]*keyNonces)}
+	if err := m.SetMode(mode); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, m.secret[:]); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// データ暗号化で使う共通のNonceManager
+var Nonces = func() *NonceManager {
+	m, err := NewNonceManager(NonceRandom)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}()
+
+// 共通のNonceManagerの生成方式を変える（flag.Funcにそのまま渡せる）
+func SetNonceMode(mode string) error { return Nonces.SetMode(mode) }
+
+// 生成方式を変える（発行済みのノンスの記録は残す）
+func (m *NonceManager) SetMode(mode string) error {
+	if mode != NonceRandom && mode != NonceCounter {
+		return fmt.Errorf("ノンスの生成方式は%sまたは%sを指定してください: %q", NonceRandom, NonceCounter, mode)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mode = mode
+	return nil
+}
+
+// 生成方式
+func (m *NonceManager) Mode() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mode
+}
+
+// keyで使うsizeバイトのノンスを設定された方式で発行する
+func (m *NonceManager) Next(key []byte, size int) ([]byte, error) {
+	return m.next(key, size, m.Mode())
+}
+
+// keyで使うsizeバイトの予測できないIVを発行する（AES-CBCのIVは予測できる値にしてはいけないため常に乱数）
+func (m *NonceManager) NextRandom(key []byte, size int) ([]byte, error) {
+	return m.next(key, size, NonceRandom)
+}
+
+func (m *NonceManager) next(key []byte, size int, mode string) ([]byte, error) {
+	// カウンター方式は64ビットのカウンターと4バイト以上の固定部が入る長さが必要
+	if size < 12 {
+		mode = NonceRandom
+	}
+	id := m.keyID(key, size)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := m.track(id)
+	nonce := make([]byte, size)
+	switch mode {
+	case NonceCounter:
+		if k.prefix == nil {
+			k.prefix = make([]byte, size-8)
+			if _, err := io.ReadFull(entropy.Reader(entropy.OperationIV), k.prefix); err != nil {
+				return nil, err
+			}
+		}
+		copy(nonce, k.prefix)
+		binary.BigEndian.PutUint64(nonce[size-8:], k.counter)
+		k.counter++
+	default:
+		if _, err := io.ReadFull(entropy.Reader(entropy.OperationIV), nonce); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := k.issued[string(nonce)]; ok {
+		nonceReuseDetected.Inc()
+		return nil, ErrNonceReuse
+	}
+	if len(k.issued) < maxNoncesPerKey {
+		k.issued[string(nonce)] = struct{}{}
+	}
+	noncesIssued.WithLabelValues(mode).Inc()
+	return nonce, nil
+}
+
+// 鍵とノンスの長さの識別子
+// 長さごとに固定部とカウンターを分け、先に発行した長さで固定部の長さが決まってしまわないようにする
+func (m *NonceManager) keyID(key []byte, size int) [sha256.Size]byte {
+	mac := hmac.New(sha256.New, m.secret[:])
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(size))
+	mac.Write(n[:])
+	mac.Write(key)
+	var id [sha256.Size]byte
+	mac.Sum(id[:0])
+	return id
+}
+
+// 鍵の記録を返す（なければ追跡を始める）
+func (m *NonceManager) track(id [sha256.Size]byte) *keyNonces {
+	if k, ok := m.keys[id]; ok {
+		return k
+	}
+	if len(m.order) >= maxNonceKeys {
+		delete(m.keys, m.order[0])
+		m.order = m.order[1:]
+	}
+	k := &keyNonces{issued: make(map[string]struct{})}
+	m.keys[id] = k
+	m.order = append(m.order, id)
+	nonceTrackedKeys.Set(float64(len(m.keys)))
+	return k
+}
@@ -0,0 +1,162 @@
+package cryptoutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newTestNonceManager(t *testing.T, mode string) *NonceManager {
+	t.Helper()
+	m, err := NewNonceManager(mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestNonceCounterUnique(t *testing.T) {
+	m := newTestNonceManager(t, NonceCounter)
+	key := bytes.Repeat([]byte{1}, 32)
+	const n = 10000
+	seen := make(map[string]bool, n)
+	var prefix []byte
+	for i := range n {
+		nonce, err := m.Next(key, 12)
+		if err != nil {
+			t.Fatalf("%d回目: %v", i, err)
+		}
+		if seen[string(nonce)] {
+			t.Fatalf("%d回目のノンスが重複しました: %x", i, nonce)
+		}
+		seen[string(nonce)] = true
+		if prefix == nil {
+			prefix = nonce[:4]
+		}
+		if !bytes.Equal(nonce[:4], prefix) {
+			t.Fatalf("固定部が変わりました: %x, want %x", nonce[:4], prefix)
+		}
+		if got := binary.BigEndian.Uint64(nonce[4:]); got != uint64(i) {
+			t.Fatalf("カウンター = %d, want %d", got, i)
+		}
+	}
+}
+
+func TestNonceCounterIndependentPerKey(t *testing.T) {
+	m := newTestNonceManager(t, NonceCounter)
+	a, err := m.Next([]byte("key a"), 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := m.Next([]byte("key b"), 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 鍵ごとにカウンターは0から始まり、固定部は鍵ごとの乱数
+	if binary.BigEndian.Uint64(a[4:]) != 0 || binary.BigEndian.Uint64(b[4:]) != 0 {
+		t.Fatalf("鍵ごとのカウンターが0から始まりません: %x, %x", a, b)
+	}
+}
+
+func TestNonceReuseDetected(t *testing.T) {
+	m := newTestNonceManager(t, NonceCounter)
+	key := []byte("reused key")
+	if _, err := m.Next(key, 12); err != nil {
+		t.Fatal(err)
+	}
+	// カウンターを巻き戻し、発行済みのノンスをもう一度発行させる
+	m.keys[m.keyID(key, 12)].counter = 0
+	before := testutil.ToFloat64(nonceReuseDetected)
+	if _, err := m.Next(key, 12); !errors.Is(err, ErrNonceReuse) {
+		t.Fatalf("err = %v, want ErrNonceReuse", err)
+	}
+	if got := testutil.ToFloat64(nonceReuseDetected) - before; got != 1 {
+		t.Fatalf("nonce_reuse_detected_totalの増加 = %v, want 1", got)
+	}
+}
+
+// 同じ鍵で長さの異なるノンスを発行しても、それぞれの長さの固定部とカウンターを使う
+func TestNonceCounterPerSize(t *testing.T) {
+	m := newTestNonceManager(t, NonceCounter)
+	key := []byte("key")
+	short, err := m.Next(key, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long, err := m.Next(key, 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(long) != 24 || binary.BigEndian.Uint64(long[16:]) != 0 {
+		t.Fatalf("24バイトのノンスが固定部16バイトとカウンター0になりません: %x", long)
+	}
+	next, err := m.Next(key, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(next[:4], short[:4]) || binary.BigEndian.Uint64(next[4:]) != 1 {
+		t.Fatalf("12バイトのノンスの固定部とカウンターが続きません: %x, %x", short, next)
+	}
+}
+
+func TestNonceRandomLength(t *testing.T) {
+	m := newTestNonceManager(t, NonceRandom)
+	key := []byte("key")
+	for _, size := range []int{8, 12, 16, 24} {
+		nonce, err := m.Next(key, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nonce) != size {
+			t.Fatalf("len = %d, want %d", len(nonce), size)
+		}
+		iv, err := m.NextRandom(key, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(iv) != size {
+			t.Fatalf("NextRandom len = %d, want %d", len(iv), size)
+		}
+	}
+}
+
+func TestNonceCounterFallsBackToRandomForShortNonces(t *testing.T) {
+	m := newTestNonceManager(t, NonceCounter)
+	nonce, err := m.Next([]byte("key"), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nonce) != 8 {
+		t.Fatalf("len = %d, want 8", len(nonce))
+	}
+}
+
+func TestNonceKeyIDStable(t *testing.T) {
+	m := newTestNonceManager(t, NonceRandom)
+	key := []byte("stable key")
+	if m.keyID(key, 12) != m.keyID(bytes.Clone(key), 12) {
+		t.Fatal("同じ鍵の識別子が一致しません")
+	}
+	if m.keyID(key, 12) == m.keyID([]byte("other key"), 12) {
+		t.Fatal("異なる鍵の識別子が一致しました")
+	}
+	if m.keyID(key, 12) == m.keyID(key, 24) {
+		t.Fatal("異なる長さの識別子が一致しました")
+	}
+	// 識別子はプロセスごとの秘密値によるHMACで、別のNonceManagerとは一致しない
+	if other := newTestNonceManager(t, NonceRandom); other.keyID(key, 12) == m.keyID(key, 12) {
+		t.Fatal("異なるNonceManagerで鍵の識別子が一致しました")
+	}
+	if _, err := m.Next(key, 12); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Next(key, 12); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.keys) != 1 {
+		t.Fatalf("追跡している鍵 = %d, want 1", len(m.keys))
+	}
+}
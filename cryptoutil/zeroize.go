@@ -0,0 +1,58 @@
+// Package cryptoutil はサーバーとクライアントで共有する暗号処理の補助関数を提供する
+package cryptoutil
+
+import (
+	"crypto/rsa"
+	"math/big"
+	"runtime"
+
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+)
+
+// バイト列をゼロで上書きする
+// AES鍵や共有秘密鍵など、使い終わった秘密情報をメモリに残さないために使う
+func Zeroize(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+	// 上書きが最適化で消されないようにする
+	runtime.KeepAlive(b)
+}
+
+// 多倍長整数の内部表現をゼロで上書きする
+func zeroizeInt(n *big.Int) {
+	if n == nil {
+		return
+	}
+	words := n.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	n.SetInt64(0)
+}
+
+// RSA秘密鍵の秘密パラメータをゼロで上書きする
+// 上書き後の鍵は使用できない
+func ZeroizeRSAPrivateKey(key *rsa.PrivateKey) {
+	if key == nil {
+		return
+	}
+	zeroizeInt(key.D)
+	for _, p := range key.Primes {
+		zeroizeInt(p)
+	}
+	zeroizeInt(key.Precomputed.Dp)
+	zeroizeInt(key.Precomputed.Dq)
+	zeroizeInt(key.Precomputed.Qinv)
+	key.Precomputed = rsa.PrecomputedValues{}
+}
+
+// ML-KEM（Kyber-768）秘密鍵をゼロ値で上書きする
+// circlの秘密鍵は内部表現を公開していないため、構造体が直接保持する値のみを消去できる（ベストエフォート）
+func ZeroizeKyber768PrivateKey(key *kyber768.PrivateKey) {
+	if key == nil {
+		return
+	}
+	*key = kyber768.PrivateKey{}
+	runtime.KeepAlive(key)
+}
@@ -0,0 +1,73 @@
+package cryptoutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"math/big"
+	"testing"
+
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+)
+
+func TestZeroize(t *testing.T) {
+	b := []byte("secret key material")
+	Zeroize(b)
+	if !bytes.Equal(b, make([]byte, len(b))) {
+		t.Fatalf("ゼロで上書きされていません: %x", b)
+	}
+	Zeroize(nil)
+}
+
+// 多倍長整数の値と内部表現がすべてゼロであることを確かめる
+func assertZeroInt(t *testing.T, name string, n *big.Int, words []big.Word) {
+	t.Helper()
+	if n != nil && n.Sign() != 0 {
+		t.Errorf("%sがゼロではありません", name)
+	}
+	for i, w := range words {
+		if w != 0 {
+			t.Errorf("%sの内部表現[%d]がゼロではありません", name, i)
+		}
+	}
+}
+
+func TestZeroizeRSAPrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 上書き前の内部表現を保持し、値だけでなく元のメモリが消去されたことを確かめる
+	d, dp, dq, qinv := key.D, key.Precomputed.Dp, key.Precomputed.Dq, key.Precomputed.Qinv
+	words := map[string][]big.Word{"D": d.Bits(), "Dp": dp.Bits(), "Dq": dq.Bits(), "Qinv": qinv.Bits()}
+	primes := make([][]big.Word, len(key.Primes))
+	for i, p := range key.Primes {
+		primes[i] = p.Bits()
+	}
+
+	ZeroizeRSAPrivateKey(key)
+
+	assertZeroInt(t, "D", key.D, words["D"])
+	for i, p := range key.Primes {
+		assertZeroInt(t, "Primes", p, primes[i])
+	}
+	assertZeroInt(t, "Dp", dp, words["Dp"])
+	assertZeroInt(t, "Dq", dq, words["Dq"])
+	assertZeroInt(t, "Qinv", qinv, words["Qinv"])
+	if key.Precomputed.Dp != nil || key.Precomputed.Dq != nil || key.Precomputed.Qinv != nil || key.Precomputed.CRTValues != nil {
+		t.Error("Precomputedが消去されていません")
+	}
+	ZeroizeRSAPrivateKey(nil)
+}
+
+func TestZeroizeKyber768PrivateKey(t *testing.T) {
+	_, key, err := kyber768.GenerateKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ZeroizeKyber768PrivateKey(key)
+	if !key.Equal(&kyber768.PrivateKey{}) {
+		t.Fatal("秘密鍵がゼロ値ではありません")
+	}
+	ZeroizeKyber768PrivateKey(nil)
+}
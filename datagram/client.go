@@ -0,0 +1,168 @@
+package datagram
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// HTTPのリクエストをデータグラムで送るRoundTripper
+// リクエストのURLのホストにUDPで送信し、メソッド・パス・本文だけを運ぶ（ヘッダーは送らない）
+type Transport struct {
+	target string
+	cfg    Config
+}
+
+// メトリクスのtargetラベルを付けてTransportを作成する
+func NewTransport(target string, cfg Config) *Transport {
+	return &Transport{target: target, cfg: cfg}
+}
+
+// リクエストを分割して送り、レスポンスのフラグメントがそろうまで待つ
+// タイムアウトした場合、何も受信していなければリクエストを、一部を受信していれば欠けたフラグメントを再送させる
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	id := rand.Uint32()
+	frames, err := fragment(kindRequest, id, encodeRequest(req.Method, req.URL.RequestURI(), body), t.cfg.MaxDatagram)
+	if err != nil {
+		return nil, err
+	}
+	messageFragments.WithLabelValues(t.target, kindRequest).Set(float64(len(frames)))
+
+	conn, err := net.Dial("udp", req.URL.Host)
+	if err != nil {
+		roundTripsTotal.WithLabelValues(t.target, "error").Inc()
+		return nil, err
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	t.send(conn, kindRequest, frames...)
+	var resp reassembly
+	buf := make([]byte, maxUDPPayload)
+	timeout := t.cfg.Timeout
+	for retries := 0; !resp.complete(); {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		n, err := conn.Read(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			if retries == t.cfg.MaxRetries {
+				roundTripsTotal.WithLabelValues(t.target, "timeout").Inc()
+				return nil, fmt.Errorf("データグラムの応答がありません（%d回再送）", retries)
+			}
+			retries++
+			timeout *= 2
+			if resp.total == 0 {
+				retransmissionsTotal.WithLabelValues(t.target, kindRequest).Inc()
+				t.send(conn, kindRequest, frames...)
+			} else {
+				retransmissionsTotal.WithLabelValues(t.target, kindNack).Inc()
+				t.send(conn, kindNack, frame{kind: kindNack, id: id, payload: resp.missing()}.marshal())
+			}
+			continue
+		}
+		if err != nil {
+			roundTripsTotal.WithLabelValues(t.target, "error").Inc()
+			return nil, err
+		}
+		if t.drop(directionReceived) {
+			continue
+		}
+		f, err := parseFrame(buf[:n])
+		if err != nil || f.id != id {
+			continue
+		}
+		switch f.kind {
+		case kindRetry:
+			// サーバーが送信元のアドレスの確認を求めた場合は、Cookieをそのまま返してレスポンスを送らせる
+			fragmentsTotal.WithLabelValues(t.target, directionReceived, kindRetry).Inc()
+			t.send(conn, kindRetry, frame{kind: kindRetry, id: id, total: 1, payload: f.payload}.marshal())
+		case kindResponse:
+			fragmentsTotal.WithLabelValues(t.target, directionReceived, kindResponse).Inc()
+			resp.add(f)
+		}
+	}
+	roundTripDuration.WithLabelValues(t.target).Observe(time.Since(start).Seconds())
+	messageFragments.WithLabelValues(t.target, kindResponse).Set(float64(resp.total))
+
+	status, respBody, err := decodeResponse(resp.message())
+	if err != nil {
+		roundTripsTotal.WithLabelValues(t.target, "error").Inc()
+		return nil, err
+	}
+	roundTripsTotal.WithLabelValues(t.target, "success").Inc()
+	return &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       req,
+	}, nil
+}
+
+// 損失の模擬で破棄されなかったデータグラムを送信する
+func (t *Transport) send(conn net.Conn, kind string, frames ...[]byte) {
+	for _, f := range frames {
+		fragmentsTotal.WithLabelValues(t.target, directionSent, kind).Inc()
+		if t.drop(directionSent) {
+			continue
+		}
+		conn.Write(f)
+	}
+}
+
+// 損失の模擬でデータグラムを破棄するか
+func (t *Transport) drop(direction string) bool {
+	if t.cfg.LossRate <= 0 || rand.Float64() >= t.cfg.LossRate {
+		return false
+	}
+	droppedTotal.WithLabelValues(t.target, direction).Inc()
+	return true
+}
+
+// リクエストのメッセージ（"メソッド パス\n本文"）
+func encodeRequest(method, path string, body []byte) []byte {
+	return append([]byte(method+" "+path+"\n"), body...)
+}
+
+func decodeRequest(b []byte) (method, path string, body []byte, err error) {
+	line, body, ok := bytes.Cut(b, []byte("\n"))
+	if !ok {
+		return "", "", nil, errMalformed
+	}
+	m, p, ok := bytes.Cut(line, []byte(" "))
+	if !ok {
+		return "", "", nil, errMalformed
+	}
+	return string(m), string(p), body, nil
+}
+
+// レスポンスのメッセージ（ステータスコード2バイトと本文）
+func encodeResponse(status int, body []byte) []byte {
+	return append([]byte{byte(status >> 8), byte(status)}, body...)
+}
+
+func decodeResponse(b []byte) (int, []byte, error) {
+	if len(b) < 2 {
+		return 0, nil, errMalformed
+	}
+	return int(b[0])<<8 | int(b[1]), b[2:], nil
+}
@@ -0,0 +1,267 @@
+// Package datagram はHTTPのリクエストとレスポンスを、連番を付けたUDPのデータグラムに分割して運ぶ
+//
+// DNSやVPNのようなコネクションレスの環境でPQCの大きな鍵や暗号文を送る場合を調べるためのもので、
+// 失われたフラグメントはクライアントのタイムアウトで再送を要求する（DTLSのハンドシェイクの再送と同じ考え方）。
+// サーバー側は既存のhttp.Handlerをそのまま呼び出すため、サーバーの実装を変えずに比較できる
+package datagram
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "datagram"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は datagram_）
+var factory = metrics.NewFactory(ServiceName, "datagram_")
+
+// 通信の方向
+const (
+	directionSent     = "sent"
+	directionReceived = "received"
+)
+
+var (
+	fragmentsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "datagram_fragments_total",
+			Help: "Total number of datagrams handled by the client, by target, direction (sent, received) and kind (request, response, nack, retry)",
+		},
+		[]string{"target", "direction", "kind"},
+	)
+	droppedTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "datagram_dropped_total",
+			Help: "Total number of datagrams dropped by the emulated loss on the client, by target and direction",
+		},
+		[]string{"target", "direction"},
+	)
+	retransmissionsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "datagram_retransmissions_total",
+			Help: "Total number of client timeouts that triggered a retransmission, by target and kind (request when nothing was received, nack otherwise)",
+		},
+		[]string{"target", "kind"},
+	)
+	messageFragments = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "datagram_message_fragments",
+			Help: "Number of datagrams the latest message was split into, by target and kind (request, response)",
+		},
+		[]string{"target", "kind"},
+	)
+	roundTripDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "datagram_round_trip_duration_seconds",
+			Help:    "Histogram of the time from sending the first request datagram to reassembling the whole response in seconds, including retransmissions",
+			Buckets: []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+		},
+		[]string{"target"},
+	)
+	roundTripsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "datagram_round_trips_total",
+			Help: "Total number of request/response exchanges over datagrams, by target and result (success, timeout, error)",
+		},
+		[]string{"target", "result"},
+	)
+)
+
+// データグラムの設定
+type Config struct {
+	MaxDatagram int           // 1つのデータグラムの最大サイズ（ヘッダーを含む、レスポンスもこのサイズで分割させる）
+	Timeout     time.Duration // 最初の再送までの時間（再送ごとに2倍にする）
+	MaxRetries  int           // あきらめるまでの再送の回数
+	LossRate    float64       // 送受信するデータグラムを破棄する確率（損失の模擬、0の場合は破棄しない）
+}
+
+// デフォルト設定（QUICと同じ、IPv6の最小MTUに収まる1200バイトのデータグラム）
+func DefaultConfig() Config {
+	return Config{
+		MaxDatagram: 1200,
+		Timeout:     200 * time.Millisecond,
+		MaxRetries:  5,
+	}
+}
+
+// UDPで送れるデータグラムの最大サイズ
+const maxUDPPayload = 65507
+
+// 設定を検証する
+func (c Config) Validate() error {
+	if c.MaxDatagram <= headerSize || c.MaxDatagram > maxUDPPayload {
+		return fmt.Errorf("データグラムの最大サイズは%d〜%dバイトで指定してください: %d", headerSize+1, maxUDPPayload, c.MaxDatagram)
+	}
+	if c.Timeout <= 0 {
+		return fmt.Errorf("再送までの時間は正の値で指定してください: %v", c.Timeout)
+	}
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("再送の回数に負の値は指定できません: %d", c.MaxRetries)
+	}
+	if c.LossRate < 0 || c.LossRate >= 1 {
+		return fmt.Errorf("データグラムを破棄する確率は0以上1未満で指定してください: %v", c.LossRate)
+	}
+	return nil
+}
+
+// -datagram-* フラグを登録する
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.IntVar(&c.MaxDatagram, "datagram-max-size", c.MaxDatagram, "データグラムの最大サイズ（バイト、ヘッダーを含む）")
+	fs.DurationVar(&c.Timeout, "datagram-timeout", c.Timeout, "データグラムの最初の再送までの時間（再送ごとに2倍）")
+	fs.IntVar(&c.MaxRetries, "datagram-retries", c.MaxRetries, "データグラムの再送の回数")
+	fs.Float64Var(&c.LossRate, "datagram-loss-rate", c.LossRate, "【損失の模擬】送受信するデータグラムを破棄する確率（0〜1未満）")
+}
+
+// フレームの種類
+const (
+	kindRequest  = "request"
+	kindResponse = "response"
+	kindNack     = "nack"
+	kindRetry    = "retry" // 送信元のアドレスの確認（サーバーが送ったCookieをクライアントがそのまま返す）
+)
+
+var frameKinds = map[byte]string{1: kindRequest, 2: kindResponse, 3: kindNack, 4: kindRetry}
+
+func frameType(kind string) byte {
+	for t, k := range frameKinds {
+		if k == kind {
+			return t
+		}
+	}
+	panic("不明なフレームの種類: " + kind)
+}
+
+// フレームのヘッダー
+// 種類（1バイト）、メッセージID（4バイト）、連番（2バイト）、フラグメント数（2バイト）、
+// レスポンスのデータグラムの最大サイズ（2バイト、リクエストのみ）
+const headerSize = 1 + 4 + 2 + 2 + 2
+
+// 1つのメッセージを分割できるフラグメントの最大数
+const maxFragments = 1<<16 - 1
+
+// 1フラグメントあたりchunkバイトの場合に受け付けるフラグメント数の上限
+// 運ぶメッセージはwire.MaxEncryptedDataSizeを超えないため、それを超える分割数は不正とみなす
+func fragmentLimit(chunk int) int {
+	if chunk <= 0 {
+		return 1
+	}
+	return min((wire.MaxEncryptedDataSize+chunk-1)/chunk, maxFragments)
+}
+
+var errMalformed = errors.New("データグラムの形式が不正です")
+
+// 1つのデータグラム
+type frame struct {
+	kind    string
+	id      uint32
+	seq     int
+	total   int
+	maxSize int // レスポンスを分割するサイズ（リクエストのみ）
+	payload []byte
+}
+
+func (f frame) marshal() []byte {
+	b := make([]byte, headerSize, headerSize+len(f.payload))
+	b[0] = frameType(f.kind)
+	binary.BigEndian.PutUint32(b[1:], f.id)
+	binary.BigEndian.PutUint16(b[5:], uint16(f.seq))
+	binary.BigEndian.PutUint16(b[7:], uint16(f.total))
+	binary.BigEndian.PutUint16(b[9:], uint16(min(f.maxSize, maxUDPPayload)))
+	return append(b, f.payload...)
+}
+
+func parseFrame(b []byte) (frame, error) {
+	if len(b) < headerSize {
+		return frame{}, errMalformed
+	}
+	kind, ok := frameKinds[b[0]]
+	if !ok {
+		return frame{}, errMalformed
+	}
+	f := frame{
+		kind:    kind,
+		id:      binary.BigEndian.Uint32(b[1:]),
+		seq:     int(binary.BigEndian.Uint16(b[5:])),
+		total:   int(binary.BigEndian.Uint16(b[7:])),
+		maxSize: min(int(binary.BigEndian.Uint16(b[9:])), maxUDPPayload), // UDPで送れないサイズは上限に切り詰める
+		payload: b[headerSize:],
+	}
+	// 最後以外のフラグメントは分割サイズいっぱいのため、ペイロードの長さから分割数の上限がわかる
+	// （最後のフラグメントは分割サイズ以下のため、同じ上限で判定しても正しいフレームを拒否しない）
+	if kind != kindNack && (f.total == 0 || f.seq >= f.total || f.total > fragmentLimit(len(f.payload))) {
+		return frame{}, errMalformed
+	}
+	return f, nil
+}
+
+// メッセージをmaxSizeバイト以下のデータグラムに分割する
+func fragment(kind string, id uint32, message []byte, maxSize int) ([][]byte, error) {
+	chunk := maxSize - headerSize
+	total := max((len(message)+chunk-1)/chunk, 1)
+	if total > maxFragments {
+		return nil, fmt.Errorf("メッセージが大きすぎます（%dバイト、%dフラグメント）", len(message), total)
+	}
+	frames := make([][]byte, total)
+	for seq := range frames {
+		end := min((seq+1)*chunk, len(message))
+		f := frame{kind: kind, id: id, seq: seq, total: total, payload: message[seq*chunk : end]}
+		if kind == kindRequest {
+			f.maxSize = maxSize
+		}
+		frames[seq] = f.marshal()
+	}
+	return frames, nil
+}
+
+// 受信したフラグメントからメッセージを組み立てる
+// フラグメント数はパケットの値をそのまま使うため、受信したフラグメントの分だけメモリを確保する
+type reassembly struct {
+	total    int // 0の場合はまだ何も受信していない
+	parts    map[int][]byte
+	received int
+}
+
+// フラグメントを追加し、すべてそろった場合はtrueを返す
+func (r *reassembly) add(f frame) bool {
+	if r.total == 0 {
+		r.total = f.total
+		r.parts = make(map[int][]byte)
+	}
+	if _, dup := r.parts[f.seq]; f.total != r.total || dup {
+		return r.complete()
+	}
+	r.parts[f.seq] = append([]byte{}, f.payload...)
+	r.received++
+	return r.complete()
+}
+
+func (r *reassembly) complete() bool {
+	return r.total > 0 && r.received == r.total
+}
+
+// まだ受信していないフラグメントの連番（NACKの内容、2バイトずつ）
+func (r *reassembly) missing() []byte {
+	var b []byte
+	for seq := range r.total {
+		if _, ok := r.parts[seq]; !ok {
+			b = binary.BigEndian.AppendUint16(b, uint16(seq))
+		}
+	}
+	return b
+}
+
+func (r *reassembly) message() []byte {
+	var b []byte
+	for seq := range r.total {
+		b = append(b, r.parts[seq]...)
+	}
+	return b
+}
@@ -0,0 +1,218 @@
+package datagram
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseFrameRejectsExcessiveTotal(t *testing.T) {
+	chunk := 2000
+	limit := fragmentLimit(chunk)
+	if limit >= maxFragments {
+		t.Fatalf("fragmentLimit(%d) = %d, want < %d", chunk, limit, maxFragments)
+	}
+	payload := bytes.Repeat([]byte{'x'}, chunk)
+	ok := frame{kind: kindRequest, id: 1, seq: 0, total: limit, payload: payload}.marshal()
+	if _, err := parseFrame(ok); err != nil {
+		t.Fatalf("上限ちょうどのフラグメント数が拒否されました: %v", err)
+	}
+	tooMany := frame{kind: kindRequest, id: 1, seq: 0, total: limit + 1, payload: payload}.marshal()
+	if _, err := parseFrame(tooMany); err == nil {
+		t.Fatal("上限を超えるフラグメント数が受け付けられました")
+	}
+	empty := frame{kind: kindRequest, id: 1, seq: 0, total: maxFragments}.marshal()
+	if _, err := parseFrame(empty); err == nil {
+		t.Fatal("ペイロードのない分割されたフレームが受け付けられました")
+	}
+}
+
+func TestReassemblyAllocatesOnlyReceivedParts(t *testing.T) {
+	var r reassembly
+	r.add(frame{kind: kindRequest, seq: 3, total: maxFragments, payload: []byte("a")})
+	if len(r.parts) != 1 || r.complete() {
+		t.Fatalf("parts = %d, complete = %v", len(r.parts), r.complete())
+	}
+}
+
+func TestReassemblyMessage(t *testing.T) {
+	frames, err := fragment(kindResponse, 7, []byte("hello, datagram"), headerSize+4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r reassembly
+	for i := len(frames) - 1; i >= 0; i-- {
+		f, err := parseFrame(frames[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.add(f)
+	}
+	if !r.complete() || string(r.message()) != "hello, datagram" {
+		t.Fatalf("complete = %v, message = %q", r.complete(), r.message())
+	}
+}
+
+func TestServerLimitsExchangesPerSource(t *testing.T) {
+	s := &server{name: "test", exchanges: make(map[messageKey]*exchange), sources: make(map[string]int)}
+	dropped := serverDroppedTotal.WithLabelValues("test", "source_limit")
+	before := testutil.ToFloat64(dropped)
+	for id := range uint32(maxExchangesPerSource + 10) {
+		// ポートを変えても同じホストとして数える
+		addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1000 + int(id)}
+		s.receiveRequest(addr, frame{kind: kindRequest, id: id, seq: 0, total: 2, payload: []byte("x")})
+	}
+	if len(s.exchanges) != maxExchangesPerSource {
+		t.Fatalf("保持したやり取り = %d, want %d", len(s.exchanges), maxExchangesPerSource)
+	}
+	if got := testutil.ToFloat64(dropped) - before; got != 10 {
+		t.Fatalf("datagram_server_dropped_totalの増加 = %v, want 10", got)
+	}
+
+	other := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 1000}
+	s.receiveRequest(other, frame{kind: kindRequest, id: 1, seq: 0, total: 2, payload: []byte("x")})
+	if len(s.exchanges) != maxExchangesPerSource+1 {
+		t.Fatal("別の送信元のやり取りが破棄されました")
+	}
+	for key := range s.exchanges {
+		s.forget(key)
+	}
+	if len(s.sources) != 0 {
+		t.Fatalf("送信元ごとの数が残っています: %v", s.sources)
+	}
+}
+
+// テスト用のサーバーと、そのサーバーからのデータグラムを受け取る送信元
+func newTestServer(t *testing.T, name string) (*server, net.PacketConn) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		peer.Close()
+	})
+	s := &server{name: name, conn: conn, exchanges: make(map[messageKey]*exchange), sources: make(map[string]int)}
+	return s, peer
+}
+
+func readFrame(t *testing.T, conn net.PacketConn) frame {
+	t.Helper()
+	buf := make([]byte, maxUDPPayload)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := parseFrame(append([]byte{}, buf[:n]...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestServerRequiresCookieBeforeAmplifying(t *testing.T) {
+	s, peer := newTestServer(t, "test-cookie")
+	addr := peer.LocalAddr()
+	key := messageKey{addr: addr.String(), id: 9}
+	s.exchanges[key] = &exchange{handled: true, received: 40}
+
+	s.respond(addr, key, encodeResponse(200, bytes.Repeat([]byte{'k'}, 4000)), 1200)
+	retry := readFrame(t, peer)
+	if retry.kind != kindRetry || len(retry.payload) != cookieSize {
+		t.Fatalf("アドレスの確認の前に%sフレームが送られました", retry.kind)
+	}
+
+	invalid := serverDroppedTotal.WithLabelValues("test-cookie", "invalid_cookie")
+	before := testutil.ToFloat64(invalid)
+	s.receiveCookie(addr, frame{kind: kindRetry, id: 9, total: 1, payload: make([]byte, cookieSize)})
+	if got := testutil.ToFloat64(invalid) - before; got != 1 {
+		t.Fatalf("誤ったCookieが受け付けられました（invalid_cookieの増加 = %v）", got)
+	}
+
+	s.receiveCookie(addr, frame{kind: kindRetry, id: 9, total: 1, payload: retry.payload})
+	var r reassembly
+	for !r.complete() {
+		f := readFrame(t, peer)
+		if f.kind != kindResponse {
+			t.Fatalf("レスポンスの代わりに%sフレームを受信しました", f.kind)
+		}
+		r.add(f)
+	}
+	if status, body, _ := decodeResponse(r.message()); status != 200 || len(body) != 4000 {
+		t.Fatalf("status = %d, body = %dバイト", status, len(body))
+	}
+}
+
+func TestServerLimitsResends(t *testing.T) {
+	s, peer := newTestServer(t, "test-resend")
+	addr := peer.LocalAddr()
+	key := messageKey{addr: addr.String(), id: 3}
+	frames, err := fragment(kindResponse, 3, encodeResponse(200, []byte("ok")), 1200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.exchanges[key] = &exchange{handled: true, response: frames, validated: true}
+
+	limited := serverDroppedTotal.WithLabelValues("test-resend", "resend_limit")
+	before := testutil.ToFloat64(limited)
+	for range maxResends + 3 {
+		s.receiveNack(addr, frame{kind: kindNack, id: 3})
+	}
+	for range maxResends {
+		readFrame(t, peer)
+	}
+	if got := testutil.ToFloat64(limited) - before; got != 3 {
+		t.Fatalf("resend_limitの増加 = %v, want 3", got)
+	}
+}
+
+func TestRoundTripWithAddressValidation(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	body := bytes.Repeat([]byte{'p'}, 5000)
+	go Serve(conn, "test-roundtrip", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+
+	validations := serverRetriesTotal.WithLabelValues("test-roundtrip")
+	before := testutil.ToFloat64(validations)
+	client := &http.Client{Transport: NewTransport("test", DefaultConfig())}
+	resp, err := client.Get("http://" + conn.LocalAddr().String() + "/public-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, _ := io.ReadAll(resp.Body)
+	if !bytes.Equal(got, body) {
+		t.Fatalf("レスポンスの本文が一致しません（%dバイト）", len(got))
+	}
+	if testutil.ToFloat64(validations)-before != 1 {
+		t.Fatal("増幅の上限を超えるレスポンスでアドレスの確認が行われませんでした")
+	}
+}
+
+func TestParseFrameClampsMaxSize(t *testing.T) {
+	b := frame{kind: kindRequest, id: 1, total: 1, payload: []byte("GET /\n")}.marshal()
+	b[9], b[10] = 0xff, 0xff
+	f, err := parseFrame(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.maxSize != maxUDPPayload {
+		t.Fatalf("maxSize = %d, want %d", f.maxSize, maxUDPPayload)
+	}
+}
@@ -0,0 +1,377 @@
+package datagram
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/features"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	serverRequestsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "datagram_server_requests_total",
+			Help: "Total number of requests reassembled by the datagram server, by server and result (handled, malformed)",
+		},
+		[]string{"server", "result"},
+	)
+	serverResentTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "datagram_server_resent_fragments_total",
+			Help: "Total number of response datagrams sent again after a duplicate request or a NACK, by server",
+		},
+		[]string{"server"},
+	)
+	serverDroppedTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "datagram_server_dropped_total",
+			Help: "Total number of datagrams dropped by the datagram server, by server and reason (source_limit, exchange_limit, resend_limit, invalid_cookie)",
+		},
+		[]string{"server", "reason"},
+	)
+	serverRetriesTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "datagram_server_address_validations_total",
+			Help: "Total number of retry cookies sent to validate a source address before a response larger than the amplification limit, by server",
+		},
+		[]string{"server"},
+	)
+)
+
+// 送信済みのレスポンスを再送のために保持する時間
+const responseRetention = 30 * time.Second
+
+// 同時に保持するやり取りの上限（送信元のアドレスごと、全体）
+// 上限に達した場合は新しいやり取りのデータグラムを破棄する
+const (
+	maxExchangesPerSource = 64
+	maxExchanges          = 4096
+)
+
+// 送信元のアドレスを確認するまでに送るバイト数の上限（受信したバイト数に対する倍率、QUICと同じ3倍）
+// 送信元を偽装したリクエストで大きなレスポンスを第三者に送らせる増幅攻撃を防ぐ
+const amplificationLimit = 3
+
+// 1つのやり取りでレスポンスを再送する回数の上限
+const maxResends = 2
+
+// アドレスの確認に使うCookieの長さ（バイト）
+const cookieSize = 16
+
+// 組み立て中のリクエストと送信済みのレスポンスを区別するキー
+type messageKey struct {
+	addr string
+	id   uint32
+}
+
+// 送信元のアドレス（ポートは送信側で自由に変えられるため、上限はホストごとに数える）
+func (k messageKey) source() string {
+	if host, _, err := net.SplitHostPort(k.addr); err == nil {
+		return host
+	}
+	return k.addr
+}
+
+// 組み立て中のリクエストと再送用のレスポンス
+type exchange struct {
+	request  reassembly
+	response [][]byte // 処理中はnil
+	handled  bool
+	updated  time.Time
+
+	received  int      // 送信元から受信したバイト数
+	sent      int      // 送信元に送ったバイト数
+	validated bool     // Cookieで送信元のアドレスを確認したか
+	cookie    []byte   // 送信元に確認を求めたCookie
+	pending   [][]byte // アドレスの確認を待っているフレーム
+	resends   int      // レスポンスを再送した回数
+}
+
+// データグラムで受け取ったリクエストをhandlerに渡すサーバー
+type server struct {
+	name    string
+	conn    net.PacketConn
+	handler http.Handler
+
+	mu        sync.Mutex
+	exchanges map[messageKey]*exchange
+	sources   map[string]int // 送信元ごとのやり取りの数
+	swept     time.Time
+}
+
+// UDPでリッスンし、データグラムのリクエストをhandlerで処理する（nameはメトリクスのserverラベル）
+func ListenAndServe(addr, name string, handler http.Handler) error {
+	if !features.Enabled(features.Datagram) {
+		return features.Disabled(features.Datagram)
+	}
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return Serve(conn, name, handler)
+}
+
+// connで受け取ったデータグラムのリクエストをhandlerで処理する
+func Serve(conn net.PacketConn, name string, handler http.Handler) error {
+	s := &server{
+		name:      name,
+		conn:      conn,
+		handler:   handler,
+		exchanges: make(map[messageKey]*exchange),
+		sources:   make(map[string]int),
+	}
+	buf := make([]byte, maxUDPPayload)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		f, err := parseFrame(buf[:n])
+		if err != nil {
+			continue
+		}
+		switch f.kind {
+		case kindRequest:
+			s.receiveRequest(addr, f)
+		case kindNack:
+			s.receiveNack(addr, f)
+		case kindRetry:
+			s.receiveCookie(addr, f)
+		}
+	}
+}
+
+// リクエストのフラグメントを組み立て、そろったらハンドラーで処理する
+// 処理済みのリクエストが再送された場合は、最初のフラグメントを受け取ったときにレスポンスを再送する
+func (s *server) receiveRequest(addr net.Addr, f frame) {
+	key := messageKey{addr: addr.String(), id: f.id}
+	s.mu.Lock()
+	s.sweep()
+	ex, ok := s.exchanges[key]
+	if !ok {
+		if reason := s.limitReached(key); reason != "" {
+			s.mu.Unlock()
+			serverDroppedTotal.WithLabelValues(s.name, reason).Inc()
+			return
+		}
+		ex = &exchange{}
+		s.exchanges[key] = ex
+		s.sources[key.source()]++
+	}
+	ex.updated = time.Now()
+	ex.received += headerSize + len(f.payload)
+	if ex.handled {
+		var frames [][]byte
+		resent := false
+		if ex.response != nil && f.seq == 0 {
+			frames, resent = s.resendable(key, ex, nil)
+		}
+		s.mu.Unlock()
+		s.send(addr, frames, resent)
+		return
+	}
+	if !ex.request.add(f) {
+		s.mu.Unlock()
+		return
+	}
+	ex.handled = true
+	message := ex.request.message()
+	s.mu.Unlock()
+
+	go s.handle(addr, key, message, f.maxSize)
+}
+
+// リクエストをハンドラーで処理し、レスポンスを分割して送信する
+func (s *server) handle(addr net.Addr, key messageKey, message []byte, maxSize int) {
+	method, path, body, err := decodeRequest(message)
+	var req *http.Request
+	if err == nil {
+		req, err = http.NewRequest(method, "http://"+s.name+path, bytes.NewReader(body))
+	}
+	if err != nil {
+		serverRequestsTotal.WithLabelValues(s.name, "malformed").Inc()
+		s.respond(addr, key, encodeResponse(http.StatusBadRequest, nil), maxSize)
+		return
+	}
+	req.RemoteAddr = addr.String()
+	if len(body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	serverRequestsTotal.WithLabelValues(s.name, "handled").Inc()
+	s.respond(addr, key, encodeResponse(rec.Code, rec.Body.Bytes()), maxSize)
+}
+
+// レスポンスを分割して保持し、送信する
+func (s *server) respond(addr net.Addr, key messageKey, message []byte, maxSize int) {
+	if maxSize <= headerSize {
+		maxSize = DefaultConfig().MaxDatagram
+	}
+	frames, err := fragment(kindResponse, key.id, message, maxSize)
+	if err != nil {
+		log.Printf("データグラムのレスポンスを送信できません [%s]: %v", s.name, err)
+		frames, _ = fragment(kindResponse, key.id, encodeResponse(http.StatusInternalServerError, nil), maxSize)
+	}
+	s.mu.Lock()
+	ex, ok := s.exchanges[key]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	ex.response = frames
+	ex.updated = time.Now()
+	frames, _ = s.admit(key, ex, frames)
+	s.mu.Unlock()
+	s.send(addr, frames, false)
+}
+
+// NACKで指定されたフラグメント（空の場合はすべて）を再送する
+func (s *server) receiveNack(addr net.Addr, f frame) {
+	key := messageKey{addr: addr.String(), id: f.id}
+	s.mu.Lock()
+	ex, ok := s.exchanges[key]
+	var frames [][]byte
+	resent := false
+	if ok {
+		ex.updated = time.Now()
+		ex.received += headerSize + len(f.payload)
+		frames, resent = s.resendable(key, ex, f.payload)
+	}
+	s.mu.Unlock()
+	s.send(addr, frames, resent)
+}
+
+// クライアントが返したCookieを確かめ、アドレスの確認を待っていたフレームを送信する
+func (s *server) receiveCookie(addr net.Addr, f frame) {
+	key := messageKey{addr: addr.String(), id: f.id}
+	s.mu.Lock()
+	ex, ok := s.exchanges[key]
+	if !ok || ex.cookie == nil || subtle.ConstantTimeCompare(ex.cookie, f.payload) != 1 {
+		s.mu.Unlock()
+		serverDroppedTotal.WithLabelValues(s.name, "invalid_cookie").Inc()
+		return
+	}
+	ex.updated = time.Now()
+	ex.received += headerSize + len(f.payload)
+	ex.validated = true
+	frames := ex.pending
+	ex.pending = nil
+	ex.sent += totalSize(frames)
+	s.mu.Unlock()
+	s.send(addr, frames, false)
+}
+
+// 再送するフレームを決める（seqsは2バイトずつの連番、空の場合はすべて、呼び出し側でロックする）
+// 再送するフレームの場合はtrueを返す（アドレスの確認を求める場合はfalse）
+func (s *server) resendable(key messageKey, ex *exchange, seqs []byte) ([][]byte, bool) {
+	if ex.response == nil {
+		return nil, false
+	}
+	if ex.resends >= maxResends {
+		serverDroppedTotal.WithLabelValues(s.name, "resend_limit").Inc()
+		return nil, false
+	}
+	ex.resends++
+	frames := ex.response
+	if len(seqs) > 0 {
+		frames = nil
+		for b := seqs; len(b) >= 2; b = b[2:] {
+			if seq := int(binary.BigEndian.Uint16(b)); seq < len(ex.response) {
+				frames = append(frames, ex.response[seq])
+			}
+		}
+	}
+	return s.admit(key, ex, frames)
+}
+
+// 送信元に送るフレームを決める（呼び出し側でロックする）
+// アドレスを確認していない送信元には受信したバイト数のamplificationLimit倍までしか送らず、
+// 超える場合はフレームを保留し、代わりにCookieを送って確認を求める（DTLSのHelloVerifyRequestやQUICのRetryと同じ考え方）
+// framesをそのまま送る場合はtrueを返す
+func (s *server) admit(key messageKey, ex *exchange, frames [][]byte) ([][]byte, bool) {
+	size := totalSize(frames)
+	if ex.validated || ex.sent+size <= amplificationLimit*ex.received {
+		ex.sent += size
+		return frames, true
+	}
+	if ex.cookie == nil {
+		cookie := make([]byte, cookieSize)
+		if _, err := rand.Read(cookie); err != nil {
+			log.Printf("Cookieの生成エラー [%s]: %v", s.name, err)
+			return nil, false
+		}
+		ex.cookie = cookie
+	}
+	ex.pending = frames
+	retry := frame{kind: kindRetry, id: key.id, total: 1, payload: ex.cookie}.marshal()
+	ex.sent += len(retry)
+	serverRetriesTotal.WithLabelValues(s.name).Inc()
+	return [][]byte{retry}, false
+}
+
+func totalSize(frames [][]byte) int {
+	n := 0
+	for _, f := range frames {
+		n += len(f)
+	}
+	return n
+}
+
+func (s *server) send(addr net.Addr, frames [][]byte, resent bool) {
+	for _, f := range frames {
+		if _, err := s.conn.WriteTo(f, addr); err != nil {
+			log.Printf("データグラムの送信エラー [%s]: %v", s.name, err)
+			return
+		}
+	}
+	if resent {
+		serverResentTotal.WithLabelValues(s.name).Add(float64(len(frames)))
+	}
+}
+
+// 古いリクエストとレスポンスを削除する（呼び出し側でロックする）
+func (s *server) sweep() {
+	now := time.Now()
+	if now.Sub(s.swept) < responseRetention {
+		return
+	}
+	s.swept = now
+	for key, ex := range s.exchanges {
+		if now.Sub(ex.updated) > responseRetention {
+			s.forget(key)
+		}
+	}
+}
+
+// 新しいやり取りを保持できない場合はその理由を返す（呼び出し側でロックする）
+func (s *server) limitReached(key messageKey) string {
+	switch {
+	case len(s.exchanges) >= maxExchanges:
+		return "exchange_limit"
+	case s.sources[key.source()] >= maxExchangesPerSource:
+		return "source_limit"
+	}
+	return ""
+}
+
+// やり取りを削除する（呼び出し側でロックする）
+func (s *server) forget(key messageKey) {
+	if _, ok := s.exchanges[key]; !ok {
+		return
+	}
+	delete(s.exchanges, key)
+	source := key.source()
+	if s.sources[source]--; s.sources[source] <= 0 {
+		delete(s.sources, source)
+	}
+}
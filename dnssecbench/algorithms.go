@@ -0,0 +1,173 @@
+package dnssecbench
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	"github.com/cloudflare/circl/sign"
+	"github.com/cloudflare/circl/sign/mldsa/mldsa44"
+	"github.com/cloudflare/circl/sign/mldsa/mldsa65"
+	"github.com/cloudflare/circl/sign/slhdsa"
+)
+
+// DNSSECのアルゴリズム番号（RFC 8624）
+// PQCの署名方式には番号が割り当てられていないため、PRIVATEDNS（253）を使う
+// （本来はアルゴリズムを識別するドメイン名が鍵と署名の先頭に付くが、サイズには含めない）
+const (
+	algorithmRSASHA256       = 8
+	algorithmECDSAP256SHA256 = 13
+	algorithmPrivateDNS      = 253
+)
+
+// ゾーンの署名に使う方式
+type Algorithm interface {
+	Name() string
+	number() uint8
+	// DNSKEYレコードの公開鍵のフィールド
+	publicKey() []byte
+	sign(msg []byte) ([]byte, error)
+	verify(msg, sig []byte) bool
+}
+
+// 比較するすべての方式の鍵を生成する（現在主流のRSA・ECDSA、格子ベースのML-DSA、ハッシュベースのSLH-DSA）
+func newAlgorithms() ([]Algorithm, error) {
+	rsaAlg, err := newRSAAlgorithm(2048)
+	if err != nil {
+		return nil, err
+	}
+	ecdsaAlg, err := newECDSAAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+	algs := []Algorithm{rsaAlg, ecdsaAlg}
+	for _, s := range []sign.Scheme{
+		mldsa44.Scheme(),
+		mldsa65.Scheme(),
+		slhdsa.SHA2_128s.Scheme(),
+		slhdsa.SHA2_128f.Scheme(),
+	} {
+		alg, err := newSchemeAlgorithm(s)
+		if err != nil {
+			return nil, err
+		}
+		algs = append(algs, alg)
+	}
+	return algs, nil
+}
+
+// RSASHA256（RFC 5702、公開鍵はRFC 3110の形式）
+type rsaAlgorithm struct {
+	priv *rsa.PrivateKey
+}
+
+func newRSAAlgorithm(bits int) (*rsaAlgorithm, error) {
+	priv, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, fmt.Errorf("RSA鍵生成エラー: %w", err)
+	}
+	return &rsaAlgorithm{priv: priv}, nil
+}
+
+func (a *rsaAlgorithm) Name() string  { return fmt.Sprintf("RSASHA256-%d", a.priv.N.BitLen()) }
+func (a *rsaAlgorithm) number() uint8 { return algorithmRSASHA256 }
+
+// 指数の長さ（1バイト）、指数、法
+func (a *rsaAlgorithm) publicKey() []byte {
+	e := big.NewInt(int64(a.priv.E)).Bytes()
+	return append(append([]byte{byte(len(e))}, e...), a.priv.N.Bytes()...)
+}
+
+func (a *rsaAlgorithm) sign(msg []byte) ([]byte, error) {
+	digest := sha256.Sum256(msg)
+	return rsa.SignPKCS1v15(rand.Reader, a.priv, crypto.SHA256, digest[:])
+}
+
+func (a *rsaAlgorithm) verify(msg, sig []byte) bool {
+	digest := sha256.Sum256(msg)
+	return rsa.VerifyPKCS1v15(&a.priv.PublicKey, crypto.SHA256, digest[:], sig) == nil
+}
+
+// ECDSAP256SHA256（RFC 6605、公開鍵と署名はどちらも32バイトの整数2つを並べたもの）
+type ecdsaAlgorithm struct {
+	priv *ecdsa.PrivateKey
+}
+
+func newECDSAAlgorithm() (*ecdsaAlgorithm, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("ECDSA鍵生成エラー: %w", err)
+	}
+	return &ecdsaAlgorithm{priv: priv}, nil
+}
+
+func (a *ecdsaAlgorithm) Name() string  { return "ECDSAP256SHA256" }
+func (a *ecdsaAlgorithm) number() uint8 { return algorithmECDSAP256SHA256 }
+
+func (a *ecdsaAlgorithm) publicKey() []byte {
+	key := make([]byte, 64)
+	a.priv.X.FillBytes(key[:32])
+	a.priv.Y.FillBytes(key[32:])
+	return key
+}
+
+func (a *ecdsaAlgorithm) sign(msg []byte) ([]byte, error) {
+	digest := sha256.Sum256(msg)
+	r, s, err := ecdsa.Sign(rand.Reader, a.priv, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return sig, nil
+}
+
+func (a *ecdsaAlgorithm) verify(msg, sig []byte) bool {
+	if len(sig) != 64 {
+		return false
+	}
+	digest := sha256.Sum256(msg)
+	return ecdsa.Verify(&a.priv.PublicKey, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]))
+}
+
+// circlの署名方式（ML-DSA、SLH-DSA）
+type schemeAlgorithm struct {
+	scheme      sign.Scheme
+	pub         sign.PublicKey
+	priv        sign.PrivateKey
+	publicBytes []byte
+}
+
+func newSchemeAlgorithm(s sign.Scheme) (*schemeAlgorithm, error) {
+	pub, priv, err := s.GenerateKey()
+	if err != nil {
+		return nil, fmt.Errorf("%sの鍵生成エラー: %w", s.Name(), err)
+	}
+	publicBytes, err := pub.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("%sの公開鍵のエンコードエラー: %w", s.Name(), err)
+	}
+	return &schemeAlgorithm{scheme: s, pub: pub, priv: priv, publicBytes: publicBytes}, nil
+}
+
+func (a *schemeAlgorithm) Name() string      { return a.scheme.Name() }
+func (a *schemeAlgorithm) number() uint8     { return algorithmPrivateDNS }
+func (a *schemeAlgorithm) publicKey() []byte { return a.publicBytes }
+
+func (a *schemeAlgorithm) sign(msg []byte) ([]byte, error) {
+	sig := a.scheme.Sign(a.priv, msg, nil)
+	if len(sig) == 0 {
+		return nil, fmt.Errorf("%sの署名に失敗しました", a.scheme.Name())
+	}
+	return sig, nil
+}
+
+func (a *schemeAlgorithm) verify(msg, sig []byte) bool {
+	return a.scheme.Verify(a.pub, msg, sig, nil)
+}
@@ -0,0 +1,185 @@
+// Package dnssecbench は合成ゾーンのRRsetをDNSSECと同じ形式でRSA、ECDSA、ML-DSA、SLH-DSA（SPHINCS+）で署名し、
+// 応答のサイズと問い合わせに対する増幅率、署名と検証の所要時間を比較するベンチマークを提供する
+//
+// DNSの応答はUDPの1つのデータグラムに収まる必要があるため、大きな署名はTCPへのフォールバックや増幅攻撃の悪用につながる
+package dnssecbench
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "dnssec-bench"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は dnssec_bench_）
+var factory = metrics.NewFactory(ServiceName, "dnssec_bench_")
+
+var (
+	responseSize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dnssec_bench_response_size_bytes",
+			Help: "Size of the signed DNS response (answer RRset and RRSIG with EDNS0) in bytes, by algorithm and query type",
+		},
+		[]string{"algorithm", "qtype"},
+	)
+	unsignedResponseSize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dnssec_bench_unsigned_response_size_bytes",
+			Help: "Size of the same DNS response without DNSSEC records in bytes, by query type (DNSKEY uses the key of each algorithm)",
+		},
+		[]string{"algorithm", "qtype"},
+	)
+	amplification = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dnssec_bench_amplification_ratio",
+			Help: "Ratio of the signed response size to the query size (response / query), the factor an attacker gains in a reflection attack",
+		},
+		[]string{"algorithm", "qtype"},
+	)
+	exceedsUDP = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dnssec_bench_exceeds_udp_size",
+			Help: "1 if the signed response exceeds the EDNS0 UDP payload size and would be truncated (TC) and retried over TCP, 0 otherwise",
+		},
+		[]string{"algorithm", "qtype"},
+	)
+	signatureSize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dnssec_bench_signature_size_bytes",
+			Help: "Size of one RRSIG signature in bytes, by algorithm",
+		},
+		[]string{"algorithm"},
+	)
+	dnskeySize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "dnssec_bench_dnskey_size_bytes",
+			Help: "Size of the DNSKEY RDATA in bytes, by algorithm",
+		},
+		[]string{"algorithm"},
+	)
+	signDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "dnssec_bench_sign_duration_seconds",
+			Help:    "Histogram of the time to sign one RRset in seconds",
+			Buckets: []float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 2.5},
+		},
+		[]string{"algorithm"},
+	)
+	verifyDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "dnssec_bench_verify_duration_seconds",
+			Help:    "Histogram of the time a validating resolver needs to verify one RRSIG in seconds",
+			Buckets: []float64{0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01},
+		},
+		[]string{"algorithm"},
+	)
+	signaturesTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dnssec_bench_signatures_total",
+			Help: "Total number of RRsets signed and verified, by result",
+		},
+		[]string{"algorithm", "result"},
+	)
+)
+
+// 問い合わせる種類（DNSKEYは鍵を取得する検証者への応答で、最も大きくなる）
+var queryTypes = []string{"A", "AAAA", "MX", "TXT", "DNSKEY"}
+
+// ベンチマークの設定
+type Config struct {
+	Interval time.Duration // すべての方式でゾーンを署名し直す間隔
+	UDPSize  int           // EDNS0で通知するUDPのペイロードサイズ（これを超える応答はTCPで再送される）
+}
+
+// デフォルト設定（UDPのサイズはDNS Flag Day 2020の推奨値）
+func DefaultConfig() Config {
+	return Config{Interval: 10 * time.Second, UDPSize: 1232}
+}
+
+// 一定間隔ですべての方式でRRsetを署名して検証し、応答のサイズを記録する
+func Run(cfg Config) error {
+	if cfg.UDPSize < 512 || cfg.UDPSize > 65535 {
+		return fmt.Errorf("UDPのペイロードサイズは512〜65535バイトで指定してください: %d", cfg.UDPSize)
+	}
+	algs, err := newAlgorithms()
+	if err != nil {
+		return err
+	}
+	for _, alg := range algs {
+		dnskeySize.WithLabelValues(alg.Name()).Set(float64(len(dnskeyRDATA(flagsZSK, alg))))
+	}
+
+	// SLH-DSAの署名には時間がかかるため、起動直後に一度記録してから間隔ごとに署名し直す
+	benchmarkAll(algs, uint16(cfg.UDPSize))
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		benchmarkAll(algs, uint16(cfg.UDPSize))
+	}
+	return nil
+}
+
+// すべての方式と問い合わせの種類で署名・検証し、応答のサイズを記録する
+func benchmarkAll(algs []Algorithm, udpSize uint16) {
+	rrsets := zoneRRsets()
+	for _, alg := range algs {
+		for _, qtype := range queryTypes {
+			s, ok := rrsets[qtype]
+			if qtype == "DNSKEY" {
+				s, ok = dnskeyRRset(alg), true
+			}
+			if !ok {
+				continue
+			}
+			if err := benchmark(alg, qtype, s, udpSize); err != nil {
+				signaturesTotal.WithLabelValues(alg.Name(), "failure").Inc()
+				log.Printf("RRsetの署名・検証に失敗 [%s, %s]: %v", alg.Name(), qtype, err)
+				continue
+			}
+			signaturesTotal.WithLabelValues(alg.Name(), "success").Inc()
+		}
+	}
+}
+
+// 1つのRRsetを署名して検証し、署名あり・なしの応答と問い合わせのサイズを記録する
+// DNSKEYはKSK、それ以外はZSKの鍵タグで署名する
+func benchmark(alg Algorithm, qtype string, s rrset, udpSize uint16) error {
+	flags := uint16(flagsZSK)
+	if s.rrtype == typeDNSKEY {
+		flags = flagsKSK
+	}
+	header := rrsigHeader(s, alg, keyTag(dnskeyRDATA(flags, alg)), time.Now())
+	data := signedData(header, s)
+
+	start := time.Now()
+	sig, err := alg.sign(data)
+	if err != nil {
+		return err
+	}
+	signDuration.WithLabelValues(alg.Name()).Observe(time.Since(start).Seconds())
+
+	start = time.Now()
+	if !alg.verify(data, sig) {
+		return fmt.Errorf("署名の検証に失敗しました")
+	}
+	verifyDuration.WithLabelValues(alg.Name()).Observe(time.Since(start).Seconds())
+	signatureSize.WithLabelValues(alg.Name()).Set(float64(len(sig)))
+
+	query := buildQuery(s.name, s.rrtype, udpSize)
+	signed := buildResponse(s, [][]byte{append(header, sig...)}, udpSize)
+	unsigned := buildResponse(s, nil, udpSize)
+	responseSize.WithLabelValues(alg.Name(), qtype).Set(float64(len(signed)))
+	unsignedResponseSize.WithLabelValues(alg.Name(), qtype).Set(float64(len(unsigned)))
+	amplification.WithLabelValues(alg.Name(), qtype).Set(float64(len(signed)) / float64(len(query)))
+	exceeds := 0.0
+	if len(signed) > int(udpSize) {
+		exceeds = 1
+	}
+	exceedsUDP.WithLabelValues(alg.Name(), qtype).Set(exceeds)
+	return nil
+}
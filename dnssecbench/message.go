@@ -0,0 +1,197 @@
+package dnssecbench
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"strings"
+	"time"
+)
+
+// リソースレコードの種類とクラス（RFC 1035、RFC 3596、RFC 4034、RFC 6891）
+const (
+	typeA      = 1
+	typeMX     = 15
+	typeTXT    = 16
+	typeAAAA   = 28
+	typeOPT    = 41
+	typeRRSIG  = 46
+	typeDNSKEY = 48
+	classIN    = 1
+)
+
+// DNSメッセージのヘッダーのサイズ
+const headerSize = 12
+
+// 署名する合成ゾーン
+const zone = "example.jp."
+
+// DNSKEYのフラグ（ZSKとKSK）
+const (
+	flagsZSK = 256
+	flagsKSK = 257
+)
+
+// 署名の有効期間（RRSIGの署名日時と有効期限）
+const signatureValidity = 30 * 24 * time.Hour
+
+// 同じ所有者名・種類・クラスのレコードの集合（署名の単位）
+type rrset struct {
+	name   string
+	rrtype uint16
+	ttl    uint32
+	rdatas [][]byte
+}
+
+// 問い合わせの種類ごとの合成RRset（一般的なゾーンの典型的な大きさ）
+// DNSKEYは問い合わせのたびに署名方式ごとに組み立てる
+func zoneRRsets() map[string]rrset {
+	return map[string]rrset{
+		"A":    {name: "www." + zone, rrtype: typeA, ttl: 300, rdatas: [][]byte{{192, 0, 2, 1}}},
+		"AAAA": {name: "www." + zone, rrtype: typeAAAA, ttl: 300, rdatas: [][]byte{{0x20, 0x01, 0x0d, 0xb8, 15: 1}}},
+		"MX": {name: zone, rrtype: typeMX, ttl: 3600, rdatas: [][]byte{
+			mxRDATA(10, "mx1."+zone),
+			mxRDATA(20, "mx2."+zone),
+		}},
+		"TXT": {name: zone, rrtype: typeTXT, ttl: 3600, rdatas: [][]byte{
+			txtRDATA("v=spf1 ip4:192.0.2.0/24 ip6:2001:db8::/32 include:_spf.example.net -all"),
+			txtRDATA("google-site-verification=0123456789abcdefghijklmnopqrstuvwxyzABCDEFG"),
+		}},
+	}
+}
+
+// DNSKEYのRRset（KSKとZSK）
+// KSKとZSKは同じ方式で同じサイズのため、計測では同じ鍵を両方のフラグで載せる
+func dnskeyRRset(alg Algorithm) rrset {
+	return rrset{name: zone, rrtype: typeDNSKEY, ttl: 3600, rdatas: [][]byte{
+		dnskeyRDATA(flagsKSK, alg),
+		dnskeyRDATA(flagsZSK, alg),
+	}}
+}
+
+func mxRDATA(preference uint16, exchange string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, preference), encodeName(exchange)...)
+}
+
+func txtRDATA(text string) []byte {
+	return append([]byte{byte(len(text))}, text...)
+}
+
+// フラグ、プロトコル（3）、アルゴリズム、公開鍵
+func dnskeyRDATA(flags uint16, alg Algorithm) []byte {
+	b := binary.BigEndian.AppendUint16(nil, flags)
+	b = append(b, 3, alg.number())
+	return append(b, alg.publicKey()...)
+}
+
+// ドメイン名をワイヤー形式にする（正規形の小文字、圧縮しない）
+func encodeName(name string) []byte {
+	var b []byte
+	for _, label := range strings.Split(strings.TrimSuffix(strings.ToLower(name), "."), ".") {
+		if label == "" {
+			continue
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+// 所有者名のラベル数（RRSIGのLabelsフィールド）
+func labelCount(name string) uint8 {
+	return uint8(strings.Count(strings.TrimSuffix(name, "."), ".") + 1)
+}
+
+// DNSKEYのRDATAから鍵タグを計算する（RFC 4034 付録B）
+func keyTag(rdata []byte) uint16 {
+	var ac uint32
+	for i, b := range rdata {
+		if i&1 == 0 {
+			ac += uint32(b) << 8
+		} else {
+			ac += uint32(b)
+		}
+	}
+	ac += ac >> 16 & 0xffff
+	return uint16(ac)
+}
+
+// 署名を除いたRRSIGのRDATA
+func rrsigHeader(s rrset, alg Algorithm, tag uint16, inception time.Time) []byte {
+	b := binary.BigEndian.AppendUint16(nil, s.rrtype)
+	b = append(b, alg.number(), labelCount(s.name))
+	b = binary.BigEndian.AppendUint32(b, s.ttl)
+	b = binary.BigEndian.AppendUint32(b, uint32(inception.Add(signatureValidity).Unix()))
+	b = binary.BigEndian.AppendUint32(b, uint32(inception.Unix()))
+	b = binary.BigEndian.AppendUint16(b, tag)
+	return append(b, encodeName(zone)...)
+}
+
+// 署名する内容（RRSIGのRDATAの先頭と、RDATAの正規の順に並べたRRset、RFC 4034 3.1.8.1）
+func signedData(header []byte, s rrset) []byte {
+	rdatas := slices.Clone(s.rdatas)
+	slices.SortFunc(rdatas, bytes.Compare)
+	data := slices.Clone(header)
+	owner := encodeName(s.name)
+	for _, rdata := range rdatas {
+		data = appendRR(data, owner, s.rrtype, s.ttl, rdata)
+	}
+	return data
+}
+
+// 1つのリソースレコードを追加する
+func appendRR(b, owner []byte, rrtype uint16, ttl uint32, rdata []byte) []byte {
+	b = append(b, owner...)
+	b = binary.BigEndian.AppendUint16(b, rrtype)
+	b = binary.BigEndian.AppendUint16(b, classIN)
+	b = binary.BigEndian.AppendUint32(b, ttl)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(rdata)))
+	return append(b, rdata...)
+}
+
+// 問い合わせのメッセージ
+func buildQuery(name string, qtype uint16, udpSize uint16) []byte {
+	b := make([]byte, headerSize)
+	binary.BigEndian.PutUint16(b[4:], 1)  // QDCOUNT
+	binary.BigEndian.PutUint16(b[10:], 1) // ARCOUNT（OPT）
+	b = appendQuestion(b, name, qtype)
+	return appendEDNS(b, udpSize, true)
+}
+
+// 応答のメッセージ（rrsigsが空の場合は署名なしの応答）
+// 回答の所有者名は質問の名前への圧縮ポインターにする（署名者名は圧縮しない）
+func buildResponse(s rrset, rrsigs [][]byte, udpSize uint16) []byte {
+	b := make([]byte, headerSize)
+	binary.BigEndian.PutUint16(b[2:], 0x8400) // QR、AA
+	binary.BigEndian.PutUint16(b[4:], 1)
+	binary.BigEndian.PutUint16(b[6:], uint16(len(s.rdatas)+len(rrsigs)))
+	binary.BigEndian.PutUint16(b[10:], 1)
+	b = appendQuestion(b, s.name, s.rrtype)
+	pointer := []byte{0xc0, headerSize}
+	for _, rdata := range s.rdatas {
+		b = appendRR(b, pointer, s.rrtype, s.ttl, rdata)
+	}
+	for _, rrsig := range rrsigs {
+		b = appendRR(b, pointer, typeRRSIG, s.ttl, rrsig)
+	}
+	return appendEDNS(b, udpSize, len(rrsigs) > 0)
+}
+
+func appendQuestion(b []byte, name string, qtype uint16) []byte {
+	b = append(b, encodeName(name)...)
+	b = binary.BigEndian.AppendUint16(b, qtype)
+	return binary.BigEndian.AppendUint16(b, classIN)
+}
+
+// EDNS0のOPTレコード（CLASSにUDPのペイロードサイズ、TTLの位置にDOビットを入れる、RFC 6891）
+func appendEDNS(b []byte, udpSize uint16, dnssecOK bool) []byte {
+	b = append(b, 0)
+	b = binary.BigEndian.AppendUint16(b, typeOPT)
+	b = binary.BigEndian.AppendUint16(b, udpSize)
+	var flags uint32
+	if dnssecOK {
+		flags = 1 << 15
+	}
+	b = binary.BigEndian.AppendUint32(b, flags)
+	return binary.BigEndian.AppendUint16(b, 0)
+}
@@ -0,0 +1,364 @@
+// Package dualserver はAES鍵をRSAとML-KEMの両方で二重に保護する（belt-and-suspenders）サーバーの
+// HTTPハンドラーとメトリクスを提供する
+//
+// AES鍵はML-KEMの共有秘密鍵でラップした上でRSA-OAEPで暗号化され、サーバーは両方を解かなければ復号できない
+// どちらか一方の方式が破られてもAES鍵は守られるため、その分の遅延とサイズの増加を計測する
+package dualserver
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+	"github.com/keyi1000/PQC_grafana/apidoc"
+	"github.com/keyi1000/PQC_grafana/auditlog"
+	"github.com/keyi1000/PQC_grafana/calibration"
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/keyi1000/PQC_grafana/features"
+	"github.com/keyi1000/PQC_grafana/internal/httpmw"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/replay"
+	"github.com/keyi1000/PQC_grafana/selfbench"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "dual-server"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は dual_server_）
+var factory = metrics.NewFactory(ServiceName, "dual_server_")
+
+// リクエスト数・所要時間・パニックのメトリクス（dual_server_http_*）、リクエストIDを付けるミドルウェア
+var httpMiddleware = httpmw.New(ServiceName, factory, "dual_server_")
+
+// RSA鍵のビット数
+const rsaKeySize = 2048
+
+var (
+	unwrapDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "dual_server_unwrap_duration_seconds",
+			Help:    "Histogram of each unwrap layer duration in seconds, by layer (rsa, mlkem, message)",
+			Buckets: []float64{0.00005, 0.0001, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05},
+		},
+		[]string{"layer"},
+	)
+	decryptFailures = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dual_server_decrypt_failures_total",
+			Help: "Total number of failed decryptions, by reason",
+		},
+		[]string{"reason"},
+	)
+	envelopeRequests = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dual_server_envelope_requests_total",
+			Help: "Total number of decryption requests, by envelope format version (unspecified for clients that predate versioning)",
+		},
+		[]string{"format_version"},
+	)
+)
+
+// 公開鍵のレスポンス構造体
+type PublicKeyResponse = wire.DualPublicKeyResponse
+
+// 暗号化データの受信構造体
+type EncryptedData = wire.EncryptedData
+
+// 復号結果のレスポンス構造体
+type DecryptResponse = wire.DecryptResponse
+
+// サーバー側のタイムスタンプ
+type ServerTiming = wire.ServerTiming
+
+// ハンドラーが共有する状態
+// 鍵ペアは起動時に1組ずつ生成し、使い回す
+type server struct {
+	keyID      string
+	rsaKey     *rsa.PrivateKey
+	mlkemPriv  *kyber768.PrivateKey
+	publicJSON PublicKeyResponse
+	replay     *replay.Guard
+	audit      *auditlog.Log
+}
+
+// サーバーの設定
+type Config struct {
+	// 復号エンドポイントで再送を検出する時間（timestampの許容範囲、0の場合は検出しない）
+	ReplayWindow time.Duration
+	// 再送の検出で記録する要求の数の上限（0の場合はreplay.DefaultCacheSize）
+	ReplayCacheSize int
+	// 秘密鍵によるRSA-OAEPの復号とML-KEMのカプセル化の解除の監査ログ（nilの場合は記録しない）
+	AuditLog *auditlog.Log
+}
+
+// 設定を検証する
+func (c Config) Validate() error {
+	if c.ReplayWindow < 0 || c.ReplayCacheSize < 0 {
+		return fmt.Errorf("再送の検出の時間と記録の上限は0以上を指定してください")
+	}
+	return nil
+}
+
+// HTTPハンドラーを作成
+func NewHandler(cfg Config) (http.Handler, error) {
+	s, err := newServer()
+	if err != nil {
+		return nil, err
+	}
+	s.replay = replay.New(ServiceName, cfg.ReplayWindow, cfg.ReplayCacheSize)
+	s.audit = cfg.AuditLog
+	if s.replay != nil {
+		log.Printf("復号エンドポイントで再送を検出します (timestampの許容範囲: 前後%s)", cfg.ReplayWindow)
+	}
+
+	// エンドポイントの説明（/openapi.json）はルーティングと同時に登録する
+	api := &apidoc.API{Title: "二重保護サーバー", Description: "AES鍵をML-KEMの共有秘密鍵でラップした上でRSA-OAEPで暗号化し、両方を解いて復号します。"}
+	mux := http.NewServeMux()
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/public-key", Summary: "RSAとML-KEMの公開鍵を取得", Response: PublicKeyResponse{}},
+		httpMiddleware.WrapRole("public-key", httpmw.RoleReader, s.getPublicKeyHandler))
+	api.Handle(mux, apidoc.Endpoint{Method: "POST", Path: "/decrypt", Summary: "二重に保護された暗号化データを復号（平文のSHA-256を返す）", Request: EncryptedData{}, Response: DecryptResponse{}},
+		httpMiddleware.WrapRole("decrypt", httpmw.RoleOperator, s.decryptHandler))
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/algorithms", Summary: "対応する鍵の保護方式とデータ暗号化方式", Response: wire.AlgorithmsResponse{}},
+		httpMiddleware.WrapRole("algorithms", httpmw.RoleReader, algorithmsHandler))
+	if features.Enabled(features.BenchmarkEndpoints) {
+		api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/benchmark/self", Summary: "RSA-OAEPの復号とML-KEMの脱カプセル化をOSスレッドに固定して繰り返し、1秒あたりの回数を返す（?duration=5s&gomaxprocs=1）", Response: wire.SelfBenchmarkResponse{}},
+			httpMiddleware.WrapRole("benchmark-self", httpmw.RoleOperator, selfbench.Handler("RSA-OAEP-2048+Kyber768-decrypt", s.prepareSelfBenchmark)))
+		api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/benchmark/load", Summary: "RSA-OAEPの復号とML-KEMの脱カプセル化を内部のキューから複数のワーカーで最大の速度で処理し、1秒あたりの回数とCPU使用率を返す（?duration=5s&workers=4&queue=8）", Response: wire.LoadBenchmarkResponse{}},
+			httpMiddleware.WrapRole("benchmark-load", httpmw.RoleOperator, selfbench.LoadHandler("RSA-OAEP-2048+Kyber768-decrypt", s.prepareSelfBenchmark)))
+		api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/benchmark/scaling", Summary: "GOMAXPROCSを1, 2, 4, ...と増やしながらRSA-OAEPの復号とML-KEMの脱カプセル化の負荷計測を繰り返し、並列化の効率を返す（?duration=2s&max=8）", Response: wire.ScalingBenchmarkResponse{}},
+			httpMiddleware.WrapRole("benchmark-scaling", httpmw.RoleOperator, selfbench.ScalingHandler("RSA-OAEP-2048+Kyber768-decrypt", s.prepareSelfBenchmark)))
+	}
+	if features.Enabled(features.Calibration) {
+		api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/calibrate", Summary: "暗号処理を行わないHTTPとJSONの往復の基準（?size=Nで公開鍵の代わりにNバイトの詰め物を返す）", Response: wire.CalibrateResponse{}},
+			httpMiddleware.WrapRole("calibrate", httpmw.RoleOperator, calibration.Handler()))
+		api.Document(apidoc.Endpoint{Method: "POST", Path: "/calibrate", Summary: "暗号化データと同じJSONを受け取り、暗号処理を行わずに受信したサイズを返す", Request: EncryptedData{}, Response: wire.CalibrateResponse{}})
+	}
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/openapi.json", Summary: "OpenAPIによるAPIの説明", ContentType: "application/json"},
+		api.SpecHandler())
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/metrics", Summary: "Prometheusメトリクス"},
+		metrics.Handler())
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/version", Summary: "ビルド情報（バージョン、コミット、Go・circlのバージョン）", Response: metrics.BuildInfo{}},
+		metrics.VersionHandler())
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/metrics/selfcheck", Summary: "登録したすべてのメトリクスが登録した型で公開され、値が更新されているかの確認", Response: metrics.SelfCheckReport{}},
+		metrics.SelfCheckHandler())
+	return mux, nil
+}
+
+// 対応する方式を返すハンドラー
+func algorithmsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, wire.AlgorithmsResponse{
+		KeyEstablishment: []string{fmt.Sprintf("ML-KEM-768+AES-256-GCM-KeyWrap+RSA-OAEP-%d-SHA256", rsaKeySize)},
+		DataEncryption:   cryptoutil.DataCipherNames(),
+		EnvelopeVersions: wire.SupportedEnvelopeVersions(),
+	})
+}
+
+// 鍵ペアを生成してサーバーを作成
+func newServer() (*server, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("鍵IDの生成エラー: %w", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("RSA鍵生成エラー: %w", err)
+	}
+	mlkemPub, mlkemPriv, err := kyber768.GenerateKeyPair(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("ML-KEM鍵生成エラー: %w", err)
+	}
+
+	rsaPubBytes, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("RSA公開鍵のエンコードエラー: %w", err)
+	}
+	mlkemPubBytes, err := mlkemPub.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("ML-KEM公開鍵のエンコードエラー: %w", err)
+	}
+
+	s := &server{
+		keyID:     hex.EncodeToString(id),
+		rsaKey:    rsaKey,
+		mlkemPriv: mlkemPriv,
+	}
+	s.publicJSON = PublicKeyResponse{
+		RSAPublicKey:   base64.StdEncoding.EncodeToString(rsaPubBytes),
+		MLKEMPublicKey: base64.StdEncoding.EncodeToString(mlkemPubBytes),
+		KeyID:          s.keyID,
+		KeySize:        len(rsaPubBytes) + len(mlkemPubBytes),
+	}
+	log.Printf("RSA-%dとML-KEM-768の鍵ペアを生成しました (鍵ID: %s)\n", rsaKeySize, s.keyID)
+	return s, nil
+}
+
+// JSONレスポンスを書き込む
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("JSONエンコードエラー:", err)
+	}
+}
+
+// 2つの公開鍵を返すハンドラー
+func (s *server) getPublicKeyHandler(w http.ResponseWriter, r *http.Request) {
+	receivedAt := time.Now()
+	if r.Method != http.MethodGet {
+		http.Error(w, "GETメソッドのみサポートしています", http.StatusMethodNotAllowed)
+		return
+	}
+	if !wire.WriteEnvelopeVersion(w, r) {
+		return
+	}
+	response := s.publicJSON
+	response.ServerTiming = wire.NewServerTiming(receivedAt)
+	writeJSON(w, http.StatusOK, response)
+}
+
+// 二重に保護されたAES鍵を取り出し、暗号化データを復号するハンドラー
+func (s *server) decryptHandler(w http.ResponseWriter, r *http.Request) {
+	receivedAt := time.Now()
+	if r.Method != http.MethodPost {
+		http.Error(w, "POSTメソッドのみサポートしています", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req EncryptedData
+	if err := httpMiddleware.DecodeJSON(w, r, wire.MaxEncryptedDataSize, &req); err != nil {
+		decryptFailures.WithLabelValues("malformed").Inc()
+		http.Error(w, "リクエストの形式が不正です: "+err.Error(), httpmw.StatusCode(err))
+		return
+	}
+	envelopeRequests.WithLabelValues(req.VersionLabel()).Inc()
+	if err := req.CheckVersion(); err != nil {
+		reject(w, wire.ErrorCodeUnsupportedVersion, err.Error())
+		return
+	}
+	dataCipher, ok := cryptoutil.LookupDataCipher(req.Algorithm)
+	if !ok {
+		reject(w, "unsupported_algorithm", "サポートしていない暗号化方式です")
+		return
+	}
+	// 二重保護の鍵の受け渡しはAES-256-GCMのラップのみ
+	if req.KeyWrap != "" && req.KeyWrap != cryptoutil.KeyWrapGCM {
+		reject(w, "unsupported_algorithm", "サポートしていない鍵のラップ方式です")
+		return
+	}
+	if req.KeyID != s.keyID {
+		reject(w, "unknown_key", "鍵IDが見つかりません")
+		return
+	}
+	if err := s.replay.Check(&req); err != nil {
+		rejectReplay(w, err)
+		return
+	}
+	kemCiphertext, errKEM := base64.StdEncoding.DecodeString(req.KEMCiphertext)
+	encryptedKey, errKey := base64.StdEncoding.DecodeString(req.EncryptedAESKey)
+	ciphertext, errMsg := base64.StdEncoding.DecodeString(req.EncryptedMessage)
+	iv, errIV := base64.StdEncoding.DecodeString(req.IV)
+	tag, errMAC := base64.StdEncoding.DecodeString(req.MAC)
+	if err := errors.Join(errKEM, errKey, errMsg, errIV, errMAC); err != nil {
+		reject(w, "malformed", "Base64デコードに失敗しました")
+		return
+	}
+
+	plaintext, err := s.decrypt(dataCipher, kemCiphertext, encryptedKey, iv, ciphertext, tag)
+	s.audit.Record(r, auditlog.Event{Service: ServiceName, Operation: auditlog.OperationDecrypt, KeyID: s.keyID, Algorithm: fmt.Sprintf("RSA-OAEP-%d+ML-KEM-768", rsaKeySize), Err: err})
+	if err != nil {
+		reject(w, "decrypt", "復号に失敗しました")
+		return
+	}
+
+	if err := s.replay.Record(&req); err != nil {
+		rejectReplay(w, err)
+		return
+	}
+
+	metrics.MarkFirstOperation()
+
+	digest := sha256.Sum256(plaintext)
+	response := DecryptResponse{
+		PlaintextSHA256: base64.StdEncoding.EncodeToString(digest[:]),
+		PlaintextSize:   len(plaintext),
+	}
+	response.ServerTiming = wire.NewServerTiming(receivedAt)
+	writeJSON(w, http.StatusOK, response)
+}
+
+// RSA → ML-KEM の順に外側から鍵を取り出し、メッセージを復号する
+func (s *server) decrypt(dataCipher cryptoutil.DataCipher, kemCiphertext, encryptedKey, iv, ciphertext, tag []byte) ([]byte, error) {
+	start := time.Now()
+	innerKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, s.rsaKey, encryptedKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	unwrapDuration.WithLabelValues("rsa").Observe(time.Since(start).Seconds())
+
+	start = time.Now()
+	if len(kemCiphertext) != kyber768.CiphertextSize {
+		return nil, cryptoutil.ErrCiphertextLength
+	}
+	sharedSecret := make([]byte, kyber768.SharedKeySize)
+	s.mlkemPriv.DecapsulateTo(sharedSecret, kemCiphertext)
+	defer cryptoutil.Zeroize(sharedSecret)
+	aesKey, err := cryptoutil.UnwrapKey(sharedSecret, innerKey)
+	if err != nil {
+		return nil, err
+	}
+	defer cryptoutil.Zeroize(aesKey)
+	unwrapDuration.WithLabelValues("mlkem").Observe(time.Since(start).Seconds())
+
+	start = time.Now()
+	plaintext, err := dataCipher.Open(aesKey, iv, ciphertext, tag)
+	if err != nil {
+		return nil, err
+	}
+	unwrapDuration.WithLabelValues("message").Observe(time.Since(start).Seconds())
+	return plaintext, nil
+}
+
+// AES鍵を1つ二重に保護しておき、RSAの復号とML-KEMの脱カプセル化を繰り返す（鍵はサーバーと同じものを使う）
+func (s *server) prepareSelfBenchmark() (func() error, error) {
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &s.rsaKey.PublicKey, make([]byte, 32), nil)
+	if err != nil {
+		return nil, err
+	}
+	kemCiphertext, _, err := kyber768.Scheme().Encapsulate(s.mlkemPriv.Public())
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret := make([]byte, kyber768.SharedKeySize)
+	return func() error {
+		if _, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, s.rsaKey, encryptedKey, nil); err != nil {
+			return err
+		}
+		s.mlkemPriv.DecapsulateTo(sharedSecret, kemCiphertext)
+		return nil
+	}, nil
+}
+
+// 復号要求を拒否する
+func reject(w http.ResponseWriter, reason, message string) {
+	decryptFailures.WithLabelValues(reason).Inc()
+	http.Error(w, message, http.StatusBadRequest)
+}
+
+// 再送の検出で拒否する（既に受け付けた要求は409、時刻の範囲外とnonce・時刻がない要求は400）
+func rejectReplay(w http.ResponseWriter, err error) {
+	status, resp := replay.Response(err)
+	decryptFailures.WithLabelValues(resp.Code).Inc()
+	http.Error(w, resp.Message, status)
+}
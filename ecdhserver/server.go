@@ -0,0 +1,367 @@
+// Package ecdhserver はP-256の楕円曲線Diffie-Hellman（ephemeral-static）でAES鍵を受け取るサーバーの
+// HTTPハンドラーとメトリクスを提供する
+//
+// RSA（鍵輸送）とML-KEMの比較に、現在の一般的な鍵合意方式を基準として加えるためのもので、
+// クライアントは一時鍵とサーバーの静的鍵のECDHで得た共有秘密鍵でAES鍵をラップする（ML-KEMと同じラップ方式）
+package ecdhserver
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/apidoc"
+	"github.com/keyi1000/PQC_grafana/auditlog"
+	"github.com/keyi1000/PQC_grafana/calibration"
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/keyi1000/PQC_grafana/features"
+	"github.com/keyi1000/PQC_grafana/internal/httpmw"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/replay"
+	"github.com/keyi1000/PQC_grafana/selfbench"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "ecdh-server"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は ecdh_server_）
+var factory = metrics.NewFactory(ServiceName, "ecdh_server_")
+
+// リクエスト数・所要時間・パニックのメトリクス（ecdh_server_http_*）、リクエストIDを付けるミドルウェア
+var httpMiddleware = httpmw.New(ServiceName, factory, "ecdh_server_")
+
+// 鍵の方式
+const Algorithm = "ECDH-P256"
+
+// 曲線のビット数
+const curveBits = 256
+
+var (
+	keyGenerationDuration = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ecdh_server_key_generation_duration_seconds",
+			Help: "Duration of the static ECDH key pair generation in seconds",
+		},
+	)
+	publicKeySize = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "ecdh_server_public_key_size_bytes",
+			Help: "Size of the static ECDH public key (PKIX DER) in bytes",
+		},
+	)
+	deriveDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "ecdh_server_derive_duration_seconds",
+			Help:    "Histogram of each decryption step duration in seconds, by step (ecdh, unwrap, message)",
+			Buckets: []float64{0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005},
+		},
+		[]string{"step"},
+	)
+	decryptFailures = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ecdh_server_decrypt_failures_total",
+			Help: "Total number of failed decryptions, by reason",
+		},
+		[]string{"reason"},
+	)
+	envelopeRequests = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ecdh_server_envelope_requests_total",
+			Help: "Total number of decryption requests, by envelope format version (unspecified for clients that predate versioning)",
+		},
+		[]string{"format_version"},
+	)
+)
+
+// 公開鍵のレスポンス構造体
+type PublicKeyResponse = wire.PublicKeyResponse
+
+// 暗号化データの受信構造体
+type EncryptedData = wire.EncryptedData
+
+// 復号結果のレスポンス構造体
+type DecryptResponse = wire.DecryptResponse
+
+// ハンドラーが共有する状態
+// 鍵ペアは起動時に1組生成し、使い回す（ephemeral-static）
+type server struct {
+	keyID      string
+	privateKey *ecdh.PrivateKey
+	publicDER  []byte
+	publicJSON PublicKeyResponse
+	replay     *replay.Guard
+	audit      *auditlog.Log
+}
+
+// サーバーの設定
+type Config struct {
+	// 復号エンドポイントで再送を検出する時間（timestampの許容範囲、0の場合は検出しない）
+	ReplayWindow time.Duration
+	// 再送の検出で記録する要求の数の上限（0の場合はreplay.DefaultCacheSize）
+	ReplayCacheSize int
+	// 静的鍵によるECDHの監査ログ（nilの場合は記録しない）
+	AuditLog *auditlog.Log
+}
+
+// 設定を検証する
+func (c Config) Validate() error {
+	if c.ReplayWindow < 0 || c.ReplayCacheSize < 0 {
+		return fmt.Errorf("再送の検出の時間と記録の上限は0以上を指定してください")
+	}
+	return nil
+}
+
+// HTTPハンドラーを作成
+func NewHandler(cfg Config) (http.Handler, error) {
+	s, err := newServer()
+	if err != nil {
+		return nil, err
+	}
+	s.replay = replay.New(ServiceName, cfg.ReplayWindow, cfg.ReplayCacheSize)
+	s.audit = cfg.AuditLog
+	if s.replay != nil {
+		log.Printf("復号エンドポイントで再送を検出します (timestampの許容範囲: 前後%s)", cfg.ReplayWindow)
+	}
+
+	// エンドポイントの説明（/openapi.json）はルーティングと同時に登録する
+	api := &apidoc.API{Title: "ECDHサーバー", Description: "P-256の一時鍵と静的鍵のECDHで得た共有秘密鍵でラップされたAES鍵を取り出し、復号します。"}
+	mux := http.NewServeMux()
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/public-key", Summary: "P-256の静的公開鍵を取得", Response: PublicKeyResponse{}},
+		httpMiddleware.WrapRole("public-key", httpmw.RoleReader, s.getPublicKeyHandler))
+	api.Document(apidoc.Endpoint{Method: "POST", Path: "/public-key", Summary: "nonceを結び付けたP-256の静的公開鍵を取得", Request: wire.PublicKeyRequest{}, Response: PublicKeyResponse{}})
+	api.Handle(mux, apidoc.Endpoint{Method: "POST", Path: "/decrypt", Summary: "一時公開鍵とのECDHでAES鍵を取り出して復号（平文のSHA-256を返す）", Request: EncryptedData{}, Response: DecryptResponse{}},
+		httpMiddleware.WrapRole("decrypt", httpmw.RoleOperator, s.decryptHandler))
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/algorithms", Summary: "対応する鍵の保護方式とデータ暗号化方式", Response: wire.AlgorithmsResponse{}},
+		httpMiddleware.WrapRole("algorithms", httpmw.RoleReader, algorithmsHandler))
+	if features.Enabled(features.BenchmarkEndpoints) {
+		api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/benchmark/self", Summary: "ECDHによる共有秘密鍵の導出をOSスレッドに固定して繰り返し、1秒あたりの回数を返す（?duration=5s&gomaxprocs=1）", Response: wire.SelfBenchmarkResponse{}},
+			httpMiddleware.WrapRole("benchmark-self", httpmw.RoleOperator, selfbench.Handler(Algorithm+"-derive", s.prepareSelfBenchmark)))
+		api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/benchmark/load", Summary: "ECDHによる共有秘密鍵の導出を内部のキューから複数のワーカーで最大の速度で処理し、1秒あたりの回数とCPU使用率を返す（?duration=5s&workers=4&queue=8）", Response: wire.LoadBenchmarkResponse{}},
+			httpMiddleware.WrapRole("benchmark-load", httpmw.RoleOperator, selfbench.LoadHandler(Algorithm+"-derive", s.prepareSelfBenchmark)))
+		api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/benchmark/scaling", Summary: "GOMAXPROCSを1, 2, 4, ...と増やしながらECDHによる共有秘密鍵の導出の負荷計測を繰り返し、並列化の効率を返す（?duration=2s&max=8）", Response: wire.ScalingBenchmarkResponse{}},
+			httpMiddleware.WrapRole("benchmark-scaling", httpmw.RoleOperator, selfbench.ScalingHandler(Algorithm+"-derive", s.prepareSelfBenchmark)))
+	}
+	if features.Enabled(features.Calibration) {
+		api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/calibrate", Summary: "暗号処理を行わないHTTPとJSONの往復の基準（?size=Nで公開鍵の代わりにNバイトの詰め物を返す）", Response: wire.CalibrateResponse{}},
+			httpMiddleware.WrapRole("calibrate", httpmw.RoleOperator, calibration.Handler()))
+		api.Document(apidoc.Endpoint{Method: "POST", Path: "/calibrate", Summary: "暗号化データと同じJSONを受け取り、暗号処理を行わずに受信したサイズを返す", Request: EncryptedData{}, Response: wire.CalibrateResponse{}})
+	}
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/openapi.json", Summary: "OpenAPIによるAPIの説明", ContentType: "application/json"},
+		api.SpecHandler())
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/metrics", Summary: "Prometheusメトリクス"},
+		metrics.Handler())
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/version", Summary: "ビルド情報（バージョン、コミット、Go・circlのバージョン）", Response: metrics.BuildInfo{}},
+		metrics.VersionHandler())
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/metrics/selfcheck", Summary: "登録したすべてのメトリクスが登録した型で公開され、値が更新されているかの確認", Response: metrics.SelfCheckReport{}},
+		metrics.SelfCheckHandler())
+	return mux, nil
+}
+
+// 対応する方式を返すハンドラー
+func algorithmsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, wire.AlgorithmsResponse{
+		KeyEstablishment: []string{Algorithm + "+AES-256-GCM-KeyWrap", Algorithm + "+AES-KW"},
+		DataEncryption:   cryptoutil.DataCipherNames(),
+		EnvelopeVersions: wire.SupportedEnvelopeVersions(),
+	})
+}
+
+// 鍵ペアを生成してサーバーを作成
+func newServer() (*server, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("鍵IDの生成エラー: %w", err)
+	}
+	start := time.Now()
+	privateKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("ECDH鍵生成エラー: %w", err)
+	}
+	keyGenerationDuration.Set(time.Since(start).Seconds())
+	pubBytes, err := x509.MarshalPKIXPublicKey(privateKey.PublicKey())
+	if err != nil {
+		return nil, fmt.Errorf("ECDH公開鍵のエンコードエラー: %w", err)
+	}
+	publicKeySize.Set(float64(len(pubBytes)))
+
+	s := &server{keyID: hex.EncodeToString(id), privateKey: privateKey, publicDER: pubBytes}
+	s.publicJSON = PublicKeyResponse{
+		PublicKey: base64.StdEncoding.EncodeToString(pubBytes),
+		KeyID:     s.keyID,
+		Algorithm: Algorithm,
+		KeySize:   curveBits,
+		KeyMode:   "static",
+	}
+	log.Printf("P-256の鍵ペアを生成しました (鍵ID: %s)\n", s.keyID)
+	return s, nil
+}
+
+// JSONレスポンスを書き込む
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("JSONエンコードエラー:", err)
+	}
+}
+
+// 静的公開鍵を返すハンドラー
+func (s *server) getPublicKeyHandler(w http.ResponseWriter, r *http.Request) {
+	receivedAt := time.Now()
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "GETとPOSTメソッドのみサポートしています", http.StatusMethodNotAllowed)
+		return
+	}
+	// POSTの場合はクライアントのnonceを公開鍵と結び付けて返す
+	nonce, err := wire.ReadNonce(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !wire.WriteEnvelopeVersion(w, r) {
+		return
+	}
+	response := s.publicJSON
+	response.Bind(nonce, s.publicDER)
+	response.ServerTiming = wire.NewServerTiming(receivedAt)
+	writeJSON(w, http.StatusOK, response)
+}
+
+// 一時公開鍵とのECDHでAES鍵を取り出し、暗号化データを復号するハンドラー
+func (s *server) decryptHandler(w http.ResponseWriter, r *http.Request) {
+	receivedAt := time.Now()
+	if r.Method != http.MethodPost {
+		http.Error(w, "POSTメソッドのみサポートしています", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req EncryptedData
+	if err := httpMiddleware.DecodeJSON(w, r, wire.MaxEncryptedDataSize, &req); err != nil {
+		decryptFailures.WithLabelValues("malformed").Inc()
+		http.Error(w, "リクエストの形式が不正です: "+err.Error(), httpmw.StatusCode(err))
+		return
+	}
+	envelopeRequests.WithLabelValues(req.VersionLabel()).Inc()
+	if err := req.CheckVersion(); err != nil {
+		reject(w, wire.ErrorCodeUnsupportedVersion, err.Error())
+		return
+	}
+	dataCipher, ok := cryptoutil.LookupDataCipher(req.Algorithm)
+	if !ok {
+		reject(w, "unsupported_algorithm", "サポートしていない暗号化方式です")
+		return
+	}
+	keyWrap, err := cryptoutil.NormalizeKeyWrap(req.KeyWrap)
+	if err != nil {
+		reject(w, "unsupported_algorithm", "サポートしていない鍵のラップ方式です")
+		return
+	}
+	if req.KeyID != s.keyID {
+		reject(w, "unknown_key", "鍵IDが見つかりません")
+		return
+	}
+	if err := s.replay.Check(&req); err != nil {
+		rejectReplay(w, err)
+		return
+	}
+	ephemeral, errEph := base64.StdEncoding.DecodeString(req.EphemeralPublicKey)
+	encryptedKey, errKey := base64.StdEncoding.DecodeString(req.EncryptedAESKey)
+	ciphertext, errMsg := base64.StdEncoding.DecodeString(req.EncryptedMessage)
+	iv, errIV := base64.StdEncoding.DecodeString(req.IV)
+	tag, errMAC := base64.StdEncoding.DecodeString(req.MAC)
+	if err := errors.Join(errEph, errKey, errMsg, errIV, errMAC); err != nil {
+		reject(w, "malformed", "Base64デコードに失敗しました")
+		return
+	}
+
+	plaintext, reason, err := s.decrypt(dataCipher, keyWrap, ephemeral, encryptedKey, iv, ciphertext, tag)
+	s.audit.Record(r, auditlog.Event{Service: ServiceName, Operation: auditlog.OperationKeyAgreement, KeyID: s.keyID, Algorithm: Algorithm, Err: err})
+	if err != nil {
+		reject(w, reason, "復号に失敗しました")
+		return
+	}
+
+	if err := s.replay.Record(&req); err != nil {
+		rejectReplay(w, err)
+		return
+	}
+
+	metrics.MarkFirstOperation()
+
+	digest := sha256.Sum256(plaintext)
+	response := DecryptResponse{
+		PlaintextSHA256: base64.StdEncoding.EncodeToString(digest[:]),
+		PlaintextSize:   len(plaintext),
+	}
+	response.ServerTiming = wire.NewServerTiming(receivedAt)
+	writeJSON(w, http.StatusOK, response)
+}
+
+// ECDHで共有秘密鍵を導出してAES鍵を取り出し、メッセージを復号する
+// 失敗した場合は拒否の理由も返す
+func (s *server) decrypt(dataCipher cryptoutil.DataCipher, keyWrap string, ephemeral, encryptedKey, iv, ciphertext, tag []byte) ([]byte, string, error) {
+	start := time.Now()
+	peer, err := ecdh.P256().NewPublicKey(ephemeral)
+	if err != nil {
+		return nil, "invalid_public_key", err
+	}
+	sharedSecret, err := s.privateKey.ECDH(peer)
+	if err != nil {
+		return nil, "invalid_public_key", err
+	}
+	defer cryptoutil.Zeroize(sharedSecret)
+	deriveDuration.WithLabelValues("ecdh").Observe(time.Since(start).Seconds())
+
+	start = time.Now()
+	aesKey, err := cryptoutil.UnwrapKeyWith(keyWrap, sharedSecret, encryptedKey)
+	if err != nil {
+		return nil, "decrypt", err
+	}
+	defer cryptoutil.Zeroize(aesKey)
+	deriveDuration.WithLabelValues("unwrap").Observe(time.Since(start).Seconds())
+
+	start = time.Now()
+	plaintext, err := dataCipher.Open(aesKey, iv, ciphertext, tag)
+	if err != nil {
+		return nil, "decrypt", err
+	}
+	deriveDuration.WithLabelValues("message").Observe(time.Since(start).Seconds())
+	return plaintext, "", nil
+}
+
+// 一時鍵を1つ作っておき、静的鍵とのECDHを繰り返す（静的鍵はサーバーと同じものを使う）
+func (s *server) prepareSelfBenchmark() (func() error, error) {
+	ephemeral, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	peer := ephemeral.PublicKey()
+	return func() error {
+		_, err := s.privateKey.ECDH(peer)
+		return err
+	}, nil
+}
+
+// 復号要求を拒否する
+func reject(w http.ResponseWriter, reason, message string) {
+	decryptFailures.WithLabelValues(reason).Inc()
+	http.Error(w, message, http.StatusBadRequest)
+}
+
+// 再送の検出で拒否する（既に受け付けた要求は409、時刻の範囲外とnonce・時刻がない要求は400）
+func rejectReplay(w http.ResponseWriter, err error) {
+	status, resp := replay.Response(err)
+	decryptFailures.WithLabelValues(resp.Code).Inc()
+	http.Error(w, resp.Message, status)
+}
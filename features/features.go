@@ -0,0 +1,218 @@
+// Package features は方式の実装、通信経路、エンドポイントを実行時に有効・無効にするフィーチャーゲートを提供する
+//
+// ゲートはプロセス全体で共有され、既定ではすべて有効（これまでと同じ動作）。環境変数PQC_FEATURES、
+// PQC_FEATURES_FILEのJSONファイル、または -features で切り替え、同じバイナリで最小構成からすべてを有効にした構成まで動かせる
+package features
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// サービス名（メトリクスのserviceラベル）
+const ServiceName = "features"
+
+var factory = metrics.NewFactory(ServiceName, "feature_")
+
+var featureEnabled = factory.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "feature_enabled",
+		Help: "Whether each feature gate is enabled (1) or disabled (0), by feature, kind (algorithm, transport, endpoint) and stage (stable, experimental)",
+	},
+	[]string{"feature", "kind", "stage"},
+)
+
+// フィーチャーゲートの名前
+type Feature string
+
+// ゲートで切り替えられる機能
+const (
+	HybridKEMs         Feature = "hybrid-kems"         // KEMベンチマークと/kemsのハイブリッドKEM（X25519MLKEM768、X-Wing）
+	LibOQS             Feature = "liboqs"              // liboqsの実装（-tags oqs でビルドした場合のみ）
+	Dual               Feature = "dual"                // クライアントのRSAとML-KEMの二重保護
+	ECDH               Feature = "ecdh"                // クライアントのECDH（P-256）との比較
+	Datagram           Feature = "datagram"            // UDPのデータグラムでのリクエスト
+	Loopback           Feature = "loopback"            // ネットワークを介さずにハンドラーを直接呼び出す計測
+	KEMEndpoints       Feature = "kem-endpoints"       // ML-KEMサーバーの/kems（登録されたすべてのKEMの鍵交換）
+	BatchEndpoint      Feature = "batch"               // ML-KEMサーバーの/encapsulate-batch
+	BenchmarkEndpoints Feature = "benchmark-endpoints" // 各サーバーの/benchmark/self、/benchmark/load、/benchmark/scaling
+	Calibration        Feature = "calibration"         // 各サーバーの/calibrate
+)
+
+// 機能の種類と成熟度
+const (
+	KindAlgorithm = "algorithm"
+	KindTransport = "transport"
+	KindEndpoint  = "endpoint"
+
+	StageStable       = "stable"
+	StageExperimental = "experimental"
+)
+
+type gate struct {
+	feature Feature
+	kind    string
+	stage   string
+	enabled atomic.Bool
+}
+
+// 登録順に一覧を表示する
+var gates = []*gate{
+	{feature: HybridKEMs, kind: KindAlgorithm, stage: StageExperimental},
+	{feature: LibOQS, kind: KindAlgorithm, stage: StageExperimental},
+	{feature: Dual, kind: KindAlgorithm, stage: StageStable},
+	{feature: ECDH, kind: KindAlgorithm, stage: StageStable},
+	{feature: Datagram, kind: KindTransport, stage: StageExperimental},
+	{feature: Loopback, kind: KindTransport, stage: StageStable},
+	{feature: KEMEndpoints, kind: KindEndpoint, stage: StageExperimental},
+	{feature: BatchEndpoint, kind: KindEndpoint, stage: StageStable},
+	{feature: BenchmarkEndpoints, kind: KindEndpoint, stage: StageStable},
+	{feature: Calibration, kind: KindEndpoint, stage: StageStable},
+}
+
+// まとめて切り替える指定
+const (
+	PresetAll     = "all"     // すべて有効にする
+	PresetStable  = "stable"  // experimentalの機能を無効にする
+	PresetMinimal = "minimal" // すべて無効にする（RSAとML-KEMの鍵交換だけの最小構成）
+)
+
+func init() {
+	for _, g := range gates {
+		g.enabled.Store(true)
+	}
+	if path := os.Getenv("PQC_FEATURES_FILE"); path != "" {
+		if err := LoadFile(path); err != nil {
+			log.Fatalf("PQC_FEATURES_FILEの設定エラー: %v", err)
+		}
+	}
+	if spec := os.Getenv("PQC_FEATURES"); spec != "" {
+		if err := Set(spec); err != nil {
+			log.Fatalf("PQC_FEATURESの設定エラー: %v", err)
+		}
+	}
+	updateMetrics()
+}
+
+// 機能が有効かを返す
+func Enabled(f Feature) bool {
+	g := lookup(f)
+	return g != nil && g.enabled.Load()
+}
+
+// 機能が無効の場合のエラー
+func Disabled(f Feature) error {
+	return fmt.Errorf("%sはフィーチャーゲートで無効になっています（PQC_FEATURES または -features で有効にできます）", f)
+}
+
+// カンマ区切りの指定を先頭から順に適用する
+// 名前（有効）、-名前（無効）、名前=true/false、プリセット（all、stable、minimal）を指定できる
+func Set(spec string) error {
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		switch item {
+		case PresetAll, PresetStable, PresetMinimal:
+			for _, g := range gates {
+				g.enabled.Store(item == PresetAll || (item == PresetStable && g.stage == StageStable))
+			}
+			continue
+		}
+		name, on := item, true
+		if rest, ok := strings.CutPrefix(item, "-"); ok {
+			name, on = rest, false
+		} else if n, v, ok := strings.Cut(item, "="); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("%sの値が不正です: %q", n, v)
+			}
+			name, on = n, b
+		}
+		g := lookup(Feature(name))
+		if g == nil {
+			return fmt.Errorf("不明な機能: %q（指定できる機能: %s）", name, strings.Join(names(), ", "))
+		}
+		g.enabled.Store(on)
+	}
+	updateMetrics()
+	return nil
+}
+
+// JSONファイル（{"datagram": false, "hybrid-kems": true}）の設定を適用する
+func LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var values map[string]bool
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("%sの形式が不正です: %w", path, err)
+	}
+	var errs []error
+	for name, on := range values {
+		g := lookup(Feature(name))
+		if g == nil {
+			errs = append(errs, fmt.Errorf("不明な機能: %q", name))
+			continue
+		}
+		g.enabled.Store(on)
+	}
+	updateMetrics()
+	return errors.Join(errs...)
+}
+
+// -features と -features-file を登録する（環境変数の設定の後に適用する）
+func RegisterFlags(fs *flag.FlagSet) {
+	fs.Func("features-file", "有効にする機能を指定するJSONファイル（{\"datagram\": false}、環境変数PQC_FEATURES_FILEでも指定できる）", LoadFile)
+	fs.Func("features", "有効・無効にする機能（カンマ区切り、名前 / -名前 / all / stable / minimal、環境変数PQC_FEATURESでも指定できる）: "+strings.Join(names(), ", "), Set)
+}
+
+// 無効になっている機能の一覧
+func DisabledFeatures() []Feature {
+	var disabled []Feature
+	for _, g := range gates {
+		if !g.enabled.Load() {
+			disabled = append(disabled, g.feature)
+		}
+	}
+	return disabled
+}
+
+func lookup(f Feature) *gate {
+	for _, g := range gates {
+		if g.feature == f {
+			return g
+		}
+	}
+	return nil
+}
+
+func names() []string {
+	s := make([]string, len(gates))
+	for i, g := range gates {
+		s[i] = string(g.feature)
+	}
+	return s
+}
+
+func updateMetrics() {
+	for _, g := range gates {
+		v := 0.0
+		if g.enabled.Load() {
+			v = 1
+		}
+		featureEnabled.WithLabelValues(string(g.feature), g.kind, g.stage).Set(v)
+	}
+}
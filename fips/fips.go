@@ -0,0 +1,37 @@
+// Package fips はFIPS承認済みのパラメーターセット（FIPS 203のML-KEM-768/1024、3072ビット以上のRSA、AES-256-GCM）
+// だけに制限するモードを提供する
+//
+// モードはプロセス全体で共有され、各パッケージは承認されていない操作を拒否したうえで
+// 試行された回数をそれぞれのメトリクスに記録する
+package fips
+
+import "sync/atomic"
+
+var enabled atomic.Bool
+
+// FIPSモードを有効にする
+func Enable() { enabled.Store(true) }
+
+// FIPSモードが有効かを返す
+func Enabled() bool { return enabled.Load() }
+
+// 承認されたKEMのパラメーターセット
+var approvedKEMs = map[string]bool{
+	"ML-KEM-768":  true,
+	"ML-KEM-1024": true,
+}
+
+// 承認されたデータ暗号化方式
+const CipherAES256GCM = "AES-256-GCM"
+
+// RSAの最小鍵長
+const MinRSABits = 3072
+
+// KEMのパラメーターセットが承認されているかを返す
+func ApprovedKEM(name string) bool { return approvedKEMs[name] }
+
+// RSAの鍵長が承認されているかを返す
+func ApprovedRSA(bits int) bool { return bits >= MinRSABits }
+
+// データ暗号化方式が承認されているかを返す
+func ApprovedCipher(name string) bool { return name == CipherAES256GCM }
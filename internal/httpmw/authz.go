@@ -0,0 +1,163 @@
+package httpmw
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// エンドポイントに必要なロール（上位のロールは下位のロールのエンドポイントも使える）
+type Role int
+
+const (
+	RoleNone     Role = iota // トークンなし（匿名のロールをnoneにした場合はどのエンドポイントも使えない）
+	RoleReader               // 公開鍵と方式の一覧の取得
+	RoleOperator             // 復号・カプセル化の解除とベンチマーク
+	RoleAdmin                // 鍵の更新など設定の変更
+)
+
+var roleNames = []string{"none", "reader", "operator", "admin"}
+
+func (r Role) String() string {
+	if r < 0 || int(r) >= len(roleNames) {
+		return "unknown"
+	}
+	return roleNames[r]
+}
+
+// ロール名をパースする
+func ParseRole(s string) (Role, error) {
+	for i, name := range roleNames {
+		if s == name {
+			return Role(i), nil
+		}
+	}
+	return RoleNone, fmt.Errorf("ロールは%sのいずれかを指定してください: %q", strings.Join(roleNames, "・"), s)
+}
+
+// Bearerトークンとロールの対応（トークンが1つもなければ認可を行わない）
+var authz struct {
+	sync.RWMutex
+	tokens    map[[sha256.Size]byte]Role // トークンのSHA-256
+	anonymous Role                       // トークンのないリクエストのロール
+}
+
+func init() {
+	authz.anonymous = RoleReader
+	if tokens := os.Getenv("AUTH_TOKENS"); tokens != "" {
+		for _, t := range strings.Split(tokens, ",") {
+			if err := AddToken(strings.TrimSpace(t)); err != nil {
+				panic("httpmw: 環境変数AUTH_TOKENSの形式が不正です")
+			}
+		}
+	}
+}
+
+// "role:token" 形式でトークンを追加する（flag.Funcにそのまま渡せる、繰り返し指定できる）
+func AddToken(s string) error {
+	name, token, ok := strings.Cut(s, ":")
+	if !ok || token == "" {
+		return fmt.Errorf("トークンの形式が不正です (role:token)")
+	}
+	role, err := ParseRole(name)
+	if err != nil {
+		return err
+	}
+	if role == RoleNone {
+		return fmt.Errorf("トークンにnoneのロールは割り当てられません")
+	}
+	authz.Lock()
+	defer authz.Unlock()
+	if authz.tokens == nil {
+		authz.tokens = make(map[[sha256.Size]byte]Role)
+	}
+	authz.tokens[sha256.Sum256([]byte(token))] = role
+	return nil
+}
+
+// トークンのないリクエストのロールを設定する（既定はreaderで、公開鍵は誰でも取得できる）
+func SetAnonymousRole(s string) error {
+	role, err := ParseRole(s)
+	if err != nil {
+		return err
+	}
+	authz.Lock()
+	defer authz.Unlock()
+	authz.anonymous = role
+	return nil
+}
+
+// ロールによる認可のフラグ（-auth-token、-auth-anonymous-role）を登録する
+func RegisterAuthFlags(fs *flag.FlagSet) {
+	fs.Func("auth-token", "サーバーのエンドポイントに必要なBearerトークンとロール（role:token、roleはreader・operator・admin、繰り返し指定できる、環境変数AUTH_TOKENSにカンマ区切りでも指定できる、指定しない場合は認可を行わない）", AddToken)
+	fs.Func("auth-anonymous-role", "-auth-token を指定した場合にトークンのないリクエストに与えるロール（none・reader・operator、既定はreaderで公開鍵は誰でも取得できる）", SetAnonymousRole)
+}
+
+// 認可を行うか（トークンが設定されているか）
+func AuthorizationEnabled() bool {
+	authz.RLock()
+	defer authz.RUnlock()
+	return len(authz.tokens) > 0
+}
+
+// リクエストのロールを決める（不明なトークンはokがfalse）
+// トークンは長さが漏れないようにSHA-256どうしを定数時間で比較する
+func requestRole(r *http.Request) (role Role, ok bool) {
+	authz.RLock()
+	defer authz.RUnlock()
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return authz.anonymous, true
+	}
+	token, found := strings.CutPrefix(header, "Bearer ")
+	if !found {
+		return RoleNone, false
+	}
+	h := sha256.Sum256([]byte(token))
+	role, ok = RoleNone, false
+	for stored, tokenRole := range authz.tokens {
+		if subtle.ConstantTimeCompare(h[:], stored[:]) == 1 {
+			role, ok = tokenRole, true
+		}
+	}
+	return role, ok
+}
+
+// Wrapに加えて、requiredより下位のロールのリクエストを拒否する
+// トークンがない・不明な場合は401、ロールが足りない場合は403を返す
+// トークンが1つもなければ認可を行わないが、adminのエンドポイントは常に拒否する
+func (m *Middleware) WrapRole(endpoint string, required Role, next http.HandlerFunc) http.HandlerFunc {
+	return m.Wrap(endpoint, func(w http.ResponseWriter, r *http.Request) {
+		if !AuthorizationEnabled() {
+			if required >= RoleAdmin {
+				m.roleRequestsTotal.WithLabelValues(endpoint, RoleNone.String(), "unauthenticated").Inc()
+				http.Error(w, "管理用のエンドポイントを使うにはトークンを設定してください", http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+			return
+		}
+		role, ok := requestRole(r)
+		label := role.String()
+		if !ok {
+			label = "invalid"
+		}
+		switch {
+		case !ok || (role < required && r.Header.Get("Authorization") == ""):
+			m.roleRequestsTotal.WithLabelValues(endpoint, label, "unauthenticated").Inc()
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+m.service+`"`)
+			http.Error(w, "認証が必要です", http.StatusUnauthorized)
+		case role < required:
+			m.roleRequestsTotal.WithLabelValues(endpoint, label, "forbidden").Inc()
+			http.Error(w, fmt.Sprintf("%sのロールが必要です", required), http.StatusForbidden)
+		default:
+			m.roleRequestsTotal.WithLabelValues(endpoint, label, "allowed").Inc()
+			next(w, r)
+		}
+	})
+}
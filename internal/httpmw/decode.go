@@ -0,0 +1,73 @@
+package httpmw
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// リクエストの本文を拒否した理由
+const (
+	RejectTooLarge     = "too_large"     // 本文がサイズの上限を超えている
+	RejectMalformed    = "malformed"     // JSONとして不正、または型が合わない
+	RejectUnknownField = "unknown_field" // 構造体にないフィールドを含む
+	RejectTrailingData = "trailing_data" // JSONの値の後に余分なデータがある
+)
+
+// DecodeJSONが本文を拒否した場合のエラー
+type RejectError struct {
+	Reason string
+	Err    error
+}
+
+func (e *RejectError) Error() string { return e.Err.Error() }
+func (e *RejectError) Unwrap() error { return e.Err }
+
+// 拒否の理由に応じたステータスコード（サイズ超過は413、それ以外は400）
+func StatusCode(err error) int {
+	var rejected *RejectError
+	if errors.As(err, &rejected) && rejected.Reason == RejectTooLarge {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// リクエストの本文をlimitバイトまで読み、JSONの値を1つだけvに厳密にデコードする
+// 未知のフィールドや値の後の余分なデータは拒否し、拒否した理由をメトリクスに記録する
+// 復号エンドポイントは攻撃者が自由に組み立てられるデータを受け取るため、パースの前に大きさと形を絞り込む
+func (m *Middleware) DecodeJSON(w http.ResponseWriter, r *http.Request, limit int64, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		switch {
+		case isTooLarge(err):
+			return m.reject(r, RejectTooLarge, fmt.Errorf("リクエストが大きすぎます（上限%dバイト）", limit))
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			// encoding/jsonは未知のフィールドに専用のエラー型を用意していない
+			return m.reject(r, RejectUnknownField, fmt.Errorf("不明なフィールドです: %s", strings.TrimPrefix(err.Error(), "json: unknown field ")))
+		default:
+			return m.reject(r, RejectMalformed, fmt.Errorf("JSONの形式が不正です: %w", err))
+		}
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		if isTooLarge(err) {
+			return m.reject(r, RejectTooLarge, fmt.Errorf("リクエストが大きすぎます（上限%dバイト）", limit))
+		}
+		return m.reject(r, RejectTrailingData, errors.New("JSONの値の後に余分なデータがあります"))
+	}
+	return nil
+}
+
+func (m *Middleware) reject(r *http.Request, reason string, err error) error {
+	endpoint, _ := r.Context().Value(endpointKey{}).(string)
+	m.rejectedTotal.WithLabelValues(endpoint, reason).Inc()
+	return &RejectError{Reason: reason, Err: err}
+}
+
+func isTooLarge(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
@@ -0,0 +1,116 @@
+package httpmw
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/wire"
+)
+
+var testMiddleware = New("httpmw-test", metrics.NewFactory("httpmw-test", "httpmw_test_"), "httpmw_test_")
+
+// ファズテストの本文の上限（大きすぎる本文の拒否を短い入力で確かめるため小さくする）
+const fuzzLimit = 512
+
+func decode(body []byte, limit int64) (wire.EncryptedData, error) {
+	var v wire.EncryptedData
+	r := httptest.NewRequest(http.MethodPost, "/decrypt", bytes.NewReader(body))
+	err := testMiddleware.DecodeJSON(httptest.NewRecorder(), r, limit, &v)
+	return v, err
+}
+
+func rejectReason(err error) string {
+	var rejected *RejectError
+	if errors.As(err, &rejected) {
+		return rejected.Reason
+	}
+	return ""
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		limit  int64
+		reason string // 空の場合は受け付ける
+	}{
+		{"valid", `{"key_id":"k","algorithm":"AES-256-CBC-HMAC-SHA256","iv":"AA=="}`, fuzzLimit, ""},
+		{"unknown field", `{"key_id":"k","plaintext":"x"}`, fuzzLimit, RejectUnknownField},
+		{"too large", `{"key_id":"` + strings.Repeat("a", fuzzLimit) + `"}`, fuzzLimit, RejectTooLarge},
+		{"trailing data", `{"key_id":"k"} {}`, fuzzLimit, RejectTrailingData},
+		{"trailing data beyond limit", `{"key_id":"k"}` + strings.Repeat(" ", 8) + "x", 16, RejectTooLarge},
+		{"malformed", `{"key_id":`, fuzzLimit, RejectMalformed},
+		{"wrong type", `{"version":"1"}`, fuzzLimit, RejectMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decode([]byte(tt.body), tt.limit)
+			if got := rejectReason(err); got != tt.reason {
+				t.Fatalf("reason = %q, want %q (err: %v)", got, tt.reason, err)
+			}
+			if tt.reason == RejectTooLarge && StatusCode(err) != http.StatusRequestEntityTooLarge {
+				t.Fatalf("StatusCode = %d, want 413", StatusCode(err))
+			}
+		})
+	}
+}
+
+// EncryptedDataのJSONのフィールド名
+func knownFields() []string {
+	var names []string
+	typ := reflect.TypeOf(wire.EncryptedData{})
+	for i := range typ.NumField() {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		names = append(names, name)
+	}
+	return names
+}
+
+func isKnownField(name string, known []string) bool {
+	for _, k := range known {
+		// encoding/jsonはフィールド名を大文字と小文字を区別せずに照合する
+		if strings.EqualFold(name, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// 任意の本文でパニックせず、上限を超える本文と未知のフィールドを含む本文を受け付けないことを確かめる
+func FuzzDecodeJSON(f *testing.F) {
+	f.Add([]byte(`{"version":1,"key_id":"k","algorithm":"AES-256-GCM","kem_ciphertext":"AA==","encrypted_aes_key":"AA==","encrypted_message":"AA==","iv":"AA==","mac":"AA=="}`))
+	f.Add([]byte(`{"key_id":"k","unknown":1}`))
+	f.Add([]byte(`{"key_id":"k"}{"key_id":"k"}`))
+	f.Add([]byte(`{"KEY_ID":"k","Version":2}`))
+	f.Add([]byte(`[1,2,3]`))
+	f.Add([]byte(`{"iv":"` + strings.Repeat("A", fuzzLimit) + `"}`))
+	f.Add([]byte("\x00\xff"))
+	known := knownFields()
+	f.Fuzz(func(t *testing.T, body []byte) {
+		_, err := decode(body, fuzzLimit)
+		if err != nil {
+			if rejectReason(err) == "" {
+				t.Fatalf("拒否の理由のないエラー: %v", err)
+			}
+			return
+		}
+		if len(body) > fuzzLimit {
+			t.Fatalf("上限（%dバイト）を超える%dバイトの本文を受け付けました", fuzzLimit, len(body))
+		}
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(body, &fields) == nil {
+			for name := range fields {
+				if !isKnownField(name, known) {
+					t.Fatalf("未知のフィールド %q を受け付けました: %q", name, body)
+				}
+			}
+		}
+	})
+}
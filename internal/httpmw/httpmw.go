@@ -0,0 +1,225 @@
+// Package httpmw は各サーバーとクライアントのメトリクスサーバーに共通するHTTPのミドルウェア
+// （リクエスト数と所要時間のメトリクス、パニックからの復帰、リクエストID、エラーのログ、ロールによる認可）を提供する
+package httpmw
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// リクエストIDのヘッダー（リクエストに含まれていればそのまま使い、なければ生成してレスポンスに付ける）
+const RequestIDHeader = "X-Request-Id"
+
+// リクエストIDの最大長（これより長いIDは受け取らずに生成し直す）
+const maxRequestIDLength = 128
+
+type (
+	requestIDKey struct{}
+	endpointKey  struct{}
+)
+
+// サービスごとのミドルウェア
+type Middleware struct {
+	service         string
+	requestsTotal   *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	panicsTotal     *prometheus.CounterVec
+	rejectedTotal   *prometheus.CounterVec
+
+	roleRequestsTotal *prometheus.CounterVec
+	wireBytesTotal    *prometheus.CounterVec
+}
+
+// サービスのFactoryにHTTPのメトリクスを登録する
+// メトリクス名はprefixで始める（例: rsa_server_ → rsa_server_http_requests_total）
+func New(service string, factory metrics.Factory, prefix string) *Middleware {
+	return &Middleware{
+		service: service,
+		requestsTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: prefix + "http_requests_total",
+				Help: "Total number of HTTP requests, by endpoint, method and status code",
+			},
+			[]string{"endpoint", "method", "code"},
+		),
+		requestDuration: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    prefix + "http_request_duration_seconds",
+				Help:    "HTTP request duration in seconds",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"endpoint"},
+		),
+		panicsTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: prefix + "http_panics_total",
+				Help: "Total number of panics recovered in HTTP handlers, by endpoint",
+			},
+			[]string{"endpoint"},
+		),
+		rejectedTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: prefix + "http_rejected_requests_total",
+				Help: "Total number of request bodies rejected before parsing completed, by endpoint and reason (too_large, malformed, unknown_field, trailing_data)",
+			},
+			[]string{"endpoint", "reason"},
+		),
+		roleRequestsTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: prefix + "http_requests_by_role_total",
+				Help: "Total number of authorization decisions for role-protected endpoints (recorded only while tokens are configured, except for always-refused admin requests), by endpoint, caller role (none, reader, operator, admin, invalid) and result (allowed, unauthenticated, forbidden)",
+			},
+			[]string{"endpoint", "role", "result"},
+		),
+		wireBytesTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: prefix + "http_wire_bytes_total",
+				Help: "Total number of HTTP bytes received and sent, by endpoint, direction (received, sent) and part (headers as HTTP/1.1 request/status line plus header fields, excluding fields added by net/http such as Date; body as read by the handler or written to the response)",
+			},
+			[]string{"endpoint", "direction", "part"},
+		),
+	}
+}
+
+// ハンドラーにリクエストID、パニックからの復帰、メトリクスの記録を付ける
+// パニックした場合は500を返し（レスポンスを書き始めていなければ）、スタックトレースをログに出力する
+func (m *Middleware) Wrap(endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		r = r.WithContext(context.WithValue(ctx, endpointKey{}, endpoint))
+		rec := &statusRecorder{ResponseWriter: w}
+		body := &countingBody{ReadCloser: r.Body}
+		if r.Body == nil {
+			body.ReadCloser = http.NoBody
+		}
+		r.Body = body
+
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				m.panicsTotal.WithLabelValues(endpoint).Inc()
+				log.Printf("[%s] %s %s のハンドラーがパニック (request_id=%s): %v\n%s", m.service, r.Method, r.URL.Path, id, p, debug.Stack())
+				if !rec.wroteHeader {
+					http.Error(rec, "内部エラー", http.StatusInternalServerError)
+				}
+				rec.status = http.StatusInternalServerError
+			}
+			if rec.status >= http.StatusInternalServerError {
+				log.Printf("[%s] %s %s → %d (request_id=%s, %v)", m.service, r.Method, r.URL.Path, rec.status, id, time.Since(start))
+			}
+			m.requestsTotal.WithLabelValues(endpoint, r.Method, strconv.Itoa(rec.statusCode())).Inc()
+			m.recordWireBytes(endpoint, r, body.n, rec)
+			m.requestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+		}()
+		next(rec, r)
+	}
+}
+
+// http.Handlerに対するWrap
+func (m *Middleware) Handler(endpoint string, next http.Handler) http.Handler {
+	return m.Wrap(endpoint, next.ServeHTTP)
+}
+
+// リクエストのコンテキストからリクエストIDを取り出す（ミドルウェアを通っていない場合は空文字列）
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ステータスコードと書き込んだ大きさを記録するResponseWriter
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	headerSize  int   // ステータス行とヘッダー（書き始めた時点のもの）
+	written     int64 // 本文
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = status, true
+		r.headerSize = statusLineSize(status) + HeaderSize(r.Header())
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.written += int64(n)
+	return n, err
+}
+
+// http.ResponseControllerからFlushなどを使えるようにする
+func (r *statusRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+func (r *statusRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// ハンドラーが読み取ったリクエストの本文の大きさを数える
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// 受信と送信のバイト数を記録する（ヘッダーはHTTP/1.1で送る形に直した大きさで、TLS・TCPのオーバーヘッドは含まない）
+func (m *Middleware) recordWireBytes(endpoint string, r *http.Request, bodySize int64, rec *statusRecorder) {
+	requestHeaderSize := len(r.Method) + len(r.RequestURI) + len(r.Proto) + len("  \r\n") +
+		len("Host: \r\n") + len(r.Host) + HeaderSize(r.Header) + len("\r\n")
+	m.wireBytesTotal.WithLabelValues(endpoint, "received", "headers").Add(float64(requestHeaderSize))
+	m.wireBytesTotal.WithLabelValues(endpoint, "received", "body").Add(float64(bodySize))
+	m.wireBytesTotal.WithLabelValues(endpoint, "sent", "headers").Add(float64(rec.headerSize))
+	m.wireBytesTotal.WithLabelValues(endpoint, "sent", "body").Add(float64(rec.written))
+}
+
+// HTTP/1.1のステータス行と、ヘッダーの終わりの空行の大きさ
+func statusLineSize(status int) int {
+	return len("HTTP/1.1 000 \r\n") + len(http.StatusText(status)) + len("\r\n")
+}
+
+// ヘッダーのフィールドをHTTP/1.1で送る形（Name: value\r\n）にした大きさ
+func HeaderSize(h http.Header) int {
+	n := 0
+	for name, values := range h {
+		for _, v := range values {
+			n += len(name) + len(": \r\n") + len(v)
+		}
+	}
+	return n
+}
@@ -0,0 +1,51 @@
+// Package keyrotation はRSAサーバーとML-KEMサーバーに共通する、管理者の要求で鍵ペアを更新するハンドラー（POST /rotate-key）を提供する
+package keyrotation
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 鍵ペアを更新できない（ephemeralモードの鍵は毎回変わり、KMSの鍵は外部で管理する）
+var ErrNotRotatable = errors.New("鍵ペアを更新できるのはプロセス内で生成するstaticモードの鍵のみです")
+
+// 有効期限を待たずに鍵ペアを更新できる鍵の管理
+type KeyManager interface {
+	// 最も古い鍵ペアを更新し、新しい鍵IDと更新前の鍵IDを返す（更新できない場合はErrNotRotatable）
+	ForceRotate() (wire.RotateKeyResponse, error)
+}
+
+// 有効期限を待たずにstaticモードの鍵ペアを更新するハンドラー（adminのロールで保護して登録する）
+// 失敗はサーバーのerrorsTotal（stage, categoryのラベル）に数える
+func Handler(keys KeyManager, errorsTotal *prometheus.CounterVec) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			errorsTotal.WithLabelValues("rotate_key", "request").Inc()
+			http.Error(w, "POSTメソッドのみサポートしています", http.StatusMethodNotAllowed)
+			return
+		}
+		response, err := keys.ForceRotate()
+		if errors.Is(err, ErrNotRotatable) {
+			errorsTotal.WithLabelValues("rotate_key", "request").Inc()
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			errorsTotal.WithLabelValues("keygen", "crypto").Inc()
+			http.Error(w, "鍵生成に失敗しました", http.StatusInternalServerError)
+			log.Println("鍵生成エラー:", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			log.Println("JSONエンコードエラー:", err)
+		}
+		log.Printf("管理者の要求で鍵ペアを更新しました (鍵ID: %s, クライアント: %s)\n", response.KeyID, r.RemoteAddr)
+	}
+}
@@ -0,0 +1,53 @@
+package keyrotation
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type fakeKeys struct {
+	resp wire.RotateKeyResponse
+	err  error
+}
+
+func (k fakeKeys) ForceRotate() (wire.RotateKeyResponse, error) { return k.resp, k.err }
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		keys   fakeKeys
+		status int
+	}{
+		{"rotated", http.MethodPost, fakeKeys{resp: wire.RotateKeyResponse{KeyID: "new", PreviousKeyID: "old"}}, http.StatusOK},
+		{"not rotatable", http.MethodPost, fakeKeys{err: ErrNotRotatable}, http.StatusConflict},
+		{"keygen failure", http.MethodPost, fakeKeys{err: errors.New("x")}, http.StatusInternalServerError},
+		{"wrong method", http.MethodGet, fakeKeys{}, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errorsTotal := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_errors_total"}, []string{"stage", "category"})
+			w := httptest.NewRecorder()
+			Handler(tt.keys, errorsTotal)(w, httptest.NewRequest(tt.method, "/rotate-key", nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var got wire.RotateKeyResponse
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.keys.resp {
+				t.Fatalf("response = %+v, want %+v", got, tt.keys.resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+// Package kembench は鍵カプセル化方式（KEM）の共通インターフェースと登録先を提供する
+//
+// 登録されたKEMはプロセス内のベンチマーク、サーバーの/kems/エンドポイント、クライアントの鍵交換で
+// 順に計測されるため、新しい方式の追加はRegisterの呼び出しだけで済む
+package kembench
+
+import (
+	"log"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/fips"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "kem-bench"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は kem_bench_）
+var factory = metrics.NewFactory(ServiceName, "kem_bench_")
+
+// 計測する操作と、計測した場所
+const (
+	operationKeyGen      = "keygen"
+	operationEncapsulate = "encapsulate"
+	operationDecapsulate = "decapsulate"
+
+	sideLocal  = "local"  // プロセス内のベンチマーク
+	sideServer = "server" // /kems/ エンドポイント
+	sideClient = "client" // HTTP越しの鍵交換
+)
+
+var (
+	operationDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kem_bench_operation_duration_seconds",
+			Help:    "Histogram of KEM operation duration in seconds, by KEM, implementation, operation and where it was measured (local, server or client)",
+			Buckets: []float64{0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.01, 0.05, 0.25},
+		},
+		[]string{"kem", "implementation", "operation", "side"},
+	)
+	sizeBytes = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kem_bench_size_bytes",
+			Help: "Size of KEM keys, ciphertext and shared secret in bytes, by KEM, implementation and kind",
+		},
+		[]string{"kem", "implementation", "kind"},
+	)
+	exchangeDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kem_bench_exchange_duration_seconds",
+			Help:    "Histogram of a full key exchange over HTTP in seconds (fetch, encapsulate, send and confirm)",
+			Buckets: []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5},
+		},
+		[]string{"kem", "implementation"},
+	)
+	exchangesTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kem_bench_exchanges_total",
+			Help: "Total number of key exchanges, by KEM, implementation, where it was measured and result",
+		},
+		[]string{"kem", "implementation", "side", "result"},
+	)
+)
+
+// 操作の所要時間を記録する
+func observe(k KEM, operation, side string, start time.Time) {
+	d := time.Since(start)
+	operationDuration.WithLabelValues(k.Name(), k.Implementation(), operation, side).Observe(d.Seconds())
+	observeSecurity(k, operation, side, d)
+}
+
+// 鍵交換の結果を記録する
+func countExchange(k KEM, side, result string) {
+	exchangesTotal.WithLabelValues(k.Name(), k.Implementation(), side, result).Inc()
+}
+
+// KEMのサイズを記録する
+func recordSizes(k KEM) {
+	s := k.Sizes()
+	sizeBytes.WithLabelValues(k.Name(), k.Implementation(), "public_key").Set(float64(s.PublicKey))
+	sizeBytes.WithLabelValues(k.Name(), k.Implementation(), "private_key").Set(float64(s.PrivateKey))
+	sizeBytes.WithLabelValues(k.Name(), k.Implementation(), "ciphertext").Set(float64(s.Ciphertext))
+	sizeBytes.WithLabelValues(k.Name(), k.Implementation(), "shared_secret").Set(float64(s.SharedSecret))
+	recordSecurity(k)
+}
+
+// ベンチマークの設定
+type Config struct {
+	Interval time.Duration // 鍵交換を行う間隔
+	FIPS     bool          // FIPS承認済みのパラメーターセットだけを計測する
+
+	// 【安全ではない】鍵生成とカプセル化をSeedから導出したDRBGで行い、実行ごとに同じ処理内容にする
+	// 乱数に依存する分岐の影響を除いてマシン間の遅延を比較するためのもので、シードに対応しないKEMは計測しない
+	Deterministic bool
+	Seed          int64
+}
+
+// デフォルト設定
+func DefaultConfig() Config {
+	return Config{Interval: time.Second}
+}
+
+// 一定間隔で登録されたすべてのKEMの鍵生成・カプセル化・デカプセル化をプロセス内で繰り返す
+func Run(cfg Config) error {
+	if cfg.FIPS {
+		fips.Enable()
+	}
+	for _, k := range All() {
+		recordSizes(k)
+	}
+	var rng *drbg
+	if cfg.Deterministic {
+		log.Printf("⚠️  決定的モードで起動しています（シード %d）: 鍵とカプセル化は予測可能なため、ベンチマークの再現以外では使用しないでください", cfg.Seed)
+		deterministicMode.Set(1)
+		rng = newDRBG(cfg.Seed)
+		for _, k := range All() {
+			if _, ok := k.(DeterministicKEM); !ok {
+				log.Printf("決定的モードに対応していないため計測しません [%s (%s)]", k.Name(), k.Implementation())
+			}
+		}
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, k := range All() {
+			if rng != nil {
+				d, ok := k.(DeterministicKEM)
+				if !ok {
+					continue
+				}
+				k = seededKEM{DeterministicKEM: d, rand: rng}
+			}
+			if err := measure(k); err != nil {
+				countExchange(k, sideLocal, "failure")
+				log.Printf("KEMの計測に失敗 [%s]: %v", k.Name(), err)
+				continue
+			}
+			countExchange(k, sideLocal, "success")
+		}
+	}
+	return nil
+}
+
+// 1つのKEMで鍵交換を1回行う
+func measure(k KEM) error {
+	start := time.Now()
+	pub, priv, err := k.KeyGen()
+	if err != nil {
+		return err
+	}
+	observe(k, operationKeyGen, sideLocal, start)
+
+	start = time.Now()
+	ct, ss, err := k.Encapsulate(pub)
+	if err != nil {
+		return err
+	}
+	observe(k, operationEncapsulate, sideLocal, start)
+
+	start = time.Now()
+	decapsulated, err := k.Decapsulate(priv, ct)
+	if err != nil {
+		return err
+	}
+	observe(k, operationDecapsulate, sideLocal, start)
+
+	if !equalSecrets(ss, decapsulated) {
+		return ErrSharedSecretMismatch
+	}
+	return nil
+}
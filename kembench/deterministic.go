@@ -0,0 +1,98 @@
+package kembench
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var deterministicMode = factory.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "kem_bench_deterministic_mode",
+		Help: "1 if keys and encapsulations are derived from a seeded DRBG (insecure, for reproducible benchmarks only)",
+	},
+)
+
+// シードから鍵生成とカプセル化を行えるKEM
+// 決定的モードのベンチマークでは、これを実装したKEMだけを計測する
+type DeterministicKEM interface {
+	KEM
+	DeriveKeyPair(seed []byte) (publicKey, privateKey []byte, err error)
+	EncapsulateDeterministically(publicKey, seed []byte) (ciphertext, sharedSecret []byte, err error)
+	// DeriveKeyPairとEncapsulateDeterministicallyに渡すシードのサイズ
+	SeedSizes() (keyGen, encapsulation int)
+}
+
+// 【安全ではない】シードから決まった乱数列を生成するDRBG（SHA-256で導出した鍵によるAES-256-CTR）
+// 同じシードからは常に同じ鍵とカプセル化テキストが得られるため、ベンチマークの再現以外に使ってはならない
+type drbg struct {
+	stream cipher.Stream
+}
+
+func newDRBG(seed int64) *drbg {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(seed))
+	key := sha256.Sum256(b[:])
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		panic(err) // 鍵長は常に32バイト
+	}
+	return &drbg{stream: cipher.NewCTR(block, make([]byte, aes.BlockSize))}
+}
+
+func (d *drbg) Read(p []byte) (int, error) {
+	clear(p)
+	d.stream.XORKeyStream(p, p)
+	return len(p), nil
+}
+
+// DRBGから取り出したシードで鍵生成とカプセル化を行うKEM
+type seededKEM struct {
+	DeterministicKEM
+	rand io.Reader
+}
+
+func (k seededKEM) seed(n int) []byte {
+	b := make([]byte, n)
+	io.ReadFull(k.rand, b)
+	return b
+}
+
+func (k seededKEM) KeyGen() ([]byte, []byte, error) {
+	size, _ := k.SeedSizes()
+	return k.DeriveKeyPair(k.seed(size))
+}
+
+func (k seededKEM) Encapsulate(publicKey []byte) ([]byte, []byte, error) {
+	_, size := k.SeedSizes()
+	return k.EncapsulateDeterministically(publicKey, k.seed(size))
+}
+
+func (k circlKEM) DeriveKeyPair(seed []byte) ([]byte, []byte, error) {
+	pub, priv := k.scheme.DeriveKeyPair(seed)
+	pubBytes, err := pub.MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+	privBytes, err := priv.MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+	return pubBytes, privBytes, nil
+}
+
+func (k circlKEM) EncapsulateDeterministically(publicKey, seed []byte) ([]byte, []byte, error) {
+	pub, err := k.scheme.UnmarshalBinaryPublicKey(publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return k.scheme.EncapsulateDeterministically(pub, seed)
+}
+
+func (k circlKEM) SeedSizes() (int, int) {
+	return k.scheme.SeedSize(), k.scheme.EncapsulationSeedSize()
+}
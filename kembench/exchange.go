@@ -0,0 +1,107 @@
+package kembench
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+)
+
+// HTTP越しの鍵交換の失敗（ネットワーク・サーバーのエラーと、鍵交換自体の失敗を区別する）
+type ExchangeError struct {
+	Stage string // fetch / encapsulate / send / confirm
+	Err   error
+}
+
+func (e *ExchangeError) Error() string { return fmt.Sprintf("%s: %v", e.Stage, e.Err) }
+func (e *ExchangeError) Unwrap() error { return e.Err }
+
+// 1回の鍵交換の結果
+type ExchangeResult struct {
+	Fetch       time.Duration // 公開鍵の取得（サーバーでの鍵生成を含む）
+	Encapsulate time.Duration
+	Send        time.Duration // カプセル化テキストの送信からサーバーの応答まで（デカプセル化を含む）
+	Total       time.Duration
+}
+
+// サーバーの/kems/エンドポイント（baseURLは http://host:port/kems）に対して鍵交換を1回行い、
+// 両者の共有秘密鍵が一致することを確認する
+func Exchange(client *http.Client, baseURL string, k KEM) (*ExchangeResult, error) {
+	res, err := exchange(client, baseURL, k)
+	if err != nil {
+		countExchange(k, sideClient, "failure")
+		return nil, err
+	}
+	countExchange(k, sideClient, "success")
+	exchangeDuration.WithLabelValues(k.Name(), k.Implementation()).Observe(res.Total.Seconds())
+	return res, nil
+}
+
+func exchange(client *http.Client, baseURL string, k KEM) (*ExchangeResult, error) {
+	var res ExchangeResult
+	kemURL := baseURL + "/" + url.PathEscape(k.Name())
+	query := "?implementation=" + url.QueryEscape(k.Implementation())
+	start := time.Now()
+
+	resp, err := client.Get(kemURL + "/public-key" + query)
+	if err != nil {
+		return nil, &ExchangeError{Stage: "fetch", Err: err}
+	}
+	var pubResp PublicKeyResponse
+	if err := decodeResponse(resp, &pubResp); err != nil {
+		return nil, &ExchangeError{Stage: "fetch", Err: err}
+	}
+	pub, err := base64.StdEncoding.DecodeString(pubResp.PublicKey)
+	if err != nil {
+		return nil, &ExchangeError{Stage: "fetch", Err: err}
+	}
+	res.Fetch = time.Since(start)
+
+	encapStart := time.Now()
+	ct, ss, err := k.Encapsulate(pub)
+	if err != nil {
+		return nil, &ExchangeError{Stage: "encapsulate", Err: err}
+	}
+	defer cryptoutil.Zeroize(ss)
+	res.Encapsulate = time.Since(encapStart)
+	observe(k, operationEncapsulate, sideClient, encapStart)
+
+	sendStart := time.Now()
+	body, err := json.Marshal(DecapsulateRequest{KeyID: pubResp.KeyID, Ciphertext: base64.StdEncoding.EncodeToString(ct)})
+	if err != nil {
+		return nil, &ExchangeError{Stage: "send", Err: err}
+	}
+	resp, err = client.Post(kemURL+"/decapsulate"+query, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, &ExchangeError{Stage: "send", Err: err}
+	}
+	var decapResp DecapsulateResponse
+	if err := decodeResponse(resp, &decapResp); err != nil {
+		return nil, &ExchangeError{Stage: "send", Err: err}
+	}
+	res.Send = time.Since(sendStart)
+
+	digest := sha256.Sum256(ss)
+	expected, err := hex.DecodeString(decapResp.SharedSecretSHA256)
+	if err != nil || !equalSecrets(digest[:], expected) {
+		return nil, &ExchangeError{Stage: "confirm", Err: ErrSharedSecretMismatch}
+	}
+	res.Total = time.Since(start)
+	return &res, nil
+}
+
+// ステータスを確認してJSONをデコードする
+func decodeResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTPステータスエラー: %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,17 @@
+package kembench
+
+import "github.com/keyi1000/PQC_grafana/features"
+
+// hybrid-kemsのフィーチャーゲートで切り替えるKEM
+var hybridKEMs = map[string]bool{
+	"X25519MLKEM768": true,
+	"X-Wing":         true,
+}
+
+// フィーチャーゲートで無効にした方式と実装は登録されていないものとして扱う
+func featureEnabled(k KEM) bool {
+	if k.Implementation() == ImplementationLibOQS && !features.Enabled(features.LibOQS) {
+		return false
+	}
+	return !hybridKEMs[k.Name()] || features.Enabled(features.HybridKEMs)
+}
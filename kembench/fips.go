@@ -0,0 +1,25 @@
+package kembench
+
+import (
+	"github.com/keyi1000/PQC_grafana/fips"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var fipsNonCompliant = factory.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "kem_bench_fips_noncompliant_operations_attempted",
+		Help: "Number of operations refused in FIPS mode because the KEM is not an approved parameter set, by KEM and implementation",
+	},
+	[]string{"kem", "implementation"},
+)
+
+// FIPSモードで使えるKEMかを返す（FIPSモードでない場合はすべて使える）
+func allowed(k KEM) bool {
+	if !fips.Enabled() {
+		return true
+	}
+	if r, ok := k.(rsaOAEP); ok {
+		return fips.ApprovedRSA(r.bits)
+	}
+	return fips.ApprovedKEM(k.Name())
+}
@@ -0,0 +1,202 @@
+package kembench
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/apidoc"
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+)
+
+// 鍵交換の両者で共有秘密鍵が一致しない
+var ErrSharedSecretMismatch = errors.New("共有秘密鍵が一致しません")
+
+// NewHandlerのエンドポイントの説明（/openapi.json に含める）
+var Endpoints = []apidoc.Endpoint{
+	{Method: "GET", Path: "/kems", Summary: "鍵交換に対応するKEMの一覧", Response: []KEMInfo{}},
+	{Method: "GET", Path: "/kems/{name}/public-key", Summary: "KEMの公開鍵を発行（?implementation= で実装を指定できる）", Response: PublicKeyResponse{}},
+	{Method: "POST", Path: "/kems/{name}/decapsulate", Summary: "カプセル化テキストをデカプセル化（共有秘密鍵のSHA-256を返す）", Request: DecapsulateRequest{}, Response: DecapsulateResponse{}},
+}
+
+// 使われていない秘密鍵を保持する上限（超えた場合は公開鍵の発行を断る）
+const maxPendingKeys = 1024
+
+// /kems が返すKEMの一覧
+type KEMInfo struct {
+	Name           string `json:"name"`
+	Implementation string `json:"implementation"`
+	Sizes          Sizes  `json:"sizes"`
+}
+
+// /kems/{name}/public-key のレスポンス
+type PublicKeyResponse struct {
+	KEM            string `json:"kem"`
+	Implementation string `json:"implementation"`
+	KeyID          string `json:"key_id"`
+	PublicKey      string `json:"public_key"`
+	KeyGenNanos    int64  `json:"keygen_ns"` // サーバーでの鍵生成時間
+}
+
+// /kems/{name}/decapsulate のリクエスト
+type DecapsulateRequest struct {
+	KeyID      string `json:"key_id"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// /kems/{name}/decapsulate のレスポンス
+type DecapsulateResponse struct {
+	SharedSecretSHA256 string `json:"shared_secret_sha256"`
+	DecapsulateNanos   int64  `json:"decapsulate_ns"` // サーバーでのデカプセル化時間
+}
+
+// 公開鍵を発行してからデカプセル化されるまでの秘密鍵（1回だけ使える）
+type pendingKeys struct {
+	mu   sync.Mutex
+	keys map[string]pendingKey
+}
+
+type pendingKey struct {
+	kem        KEM
+	privateKey []byte
+}
+
+func (p *pendingKeys) put(kem KEM, privateKey []byte) (string, bool) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", false
+	}
+	id := hex.EncodeToString(b)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.keys) >= maxPendingKeys {
+		return "", false
+	}
+	p.keys[id] = pendingKey{kem: kem, privateKey: privateKey}
+	return id, true
+}
+
+func (p *pendingKeys) take(kem KEM, id string) ([]byte, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key, ok := p.keys[id]
+	if !ok || key.kem != kem {
+		return nil, false
+	}
+	delete(p.keys, id)
+	return key.privateKey, true
+}
+
+// 登録されたすべてのKEMについて鍵交換を受け付けるHTTPハンドラーを作成する
+//
+//	GET  /kems                    KEMの一覧
+//	GET  /kems/{name}/public-key  鍵ペアを生成して公開鍵を返す
+//	POST /kems/{name}/decapsulate カプセル化テキストを受け取り、共有秘密鍵のハッシュを返す
+//
+// 同じ方式に複数の実装がある場合は ?implementation=liboqs のように実装を指定する
+func NewHandler() http.Handler {
+	for _, k := range All() {
+		recordSizes(k)
+	}
+	pending := &pendingKeys{keys: make(map[string]pendingKey)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /kems", listHandler)
+	mux.HandleFunc("GET /kems/{name}/public-key", func(w http.ResponseWriter, r *http.Request) {
+		k, ok := Lookup(r.PathValue("name"), r.URL.Query().Get("implementation"))
+		if !ok {
+			http.Error(w, "不明なKEMです", http.StatusNotFound)
+			return
+		}
+		start := time.Now()
+		pub, priv, err := k.KeyGen()
+		if err != nil {
+			http.Error(w, "鍵生成に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		keyGen := time.Since(start)
+		observe(k, operationKeyGen, sideServer, start)
+
+		id, ok := pending.put(k, priv)
+		if !ok {
+			http.Error(w, "未使用の鍵が多すぎます", http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, PublicKeyResponse{
+			KEM:            k.Name(),
+			Implementation: k.Implementation(),
+			KeyID:          id,
+			PublicKey:      base64.StdEncoding.EncodeToString(pub),
+			KeyGenNanos:    keyGen.Nanoseconds(),
+		})
+	})
+	mux.HandleFunc("POST /kems/{name}/decapsulate", func(w http.ResponseWriter, r *http.Request) {
+		k, ok := Lookup(r.PathValue("name"), r.URL.Query().Get("implementation"))
+		if !ok {
+			http.Error(w, "不明なKEMです", http.StatusNotFound)
+			return
+		}
+		var req DecapsulateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "リクエストの形式が不正です", http.StatusBadRequest)
+			return
+		}
+		ct, err := base64.StdEncoding.DecodeString(req.Ciphertext)
+		if err != nil {
+			http.Error(w, "カプセル化テキストの形式が不正です", http.StatusBadRequest)
+			return
+		}
+		priv, ok := pending.take(k, req.KeyID)
+		if !ok {
+			http.Error(w, "不明な鍵IDです", http.StatusNotFound)
+			return
+		}
+		defer cryptoutil.Zeroize(priv)
+
+		start := time.Now()
+		ss, err := k.Decapsulate(priv, ct)
+		if err != nil {
+			countExchange(k, sideServer, "failure")
+			http.Error(w, "デカプセル化に失敗しました", http.StatusBadRequest)
+			return
+		}
+		defer cryptoutil.Zeroize(ss)
+		decapsulate := time.Since(start)
+		observe(k, operationDecapsulate, sideServer, start)
+		countExchange(k, sideServer, "success")
+
+		digest := sha256.Sum256(ss)
+		writeJSON(w, DecapsulateResponse{
+			SharedSecretSHA256: hex.EncodeToString(digest[:]),
+			DecapsulateNanos:   decapsulate.Nanoseconds(),
+		})
+	})
+	return mux
+}
+
+func listHandler(w http.ResponseWriter, r *http.Request) {
+	var list []KEMInfo
+	for _, k := range All() {
+		list = append(list, KEMInfo{Name: k.Name(), Implementation: k.Implementation(), Sizes: k.Sizes()})
+	}
+	writeJSON(w, list)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, "エンコードに失敗しました", http.StatusInternalServerError)
+	}
+}
+
+// 共有秘密鍵を定数時間で比較する
+func equalSecrets(a, b []byte) bool {
+	return len(a) == len(b) && subtle.ConstantTimeCompare(a, b) == 1
+}
@@ -0,0 +1,203 @@
+package kembench
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"io"
+
+	"github.com/cloudflare/circl/kem"
+)
+
+// 鍵カプセル化方式
+// 鍵はすべてバイト列で受け渡し、HTTPでそのまま送れるようにする
+type KEM interface {
+	Name() string
+	// 実装の名前（同じ方式の実装どうしを比較するため、メトリクスのimplementationラベルに使う）
+	Implementation() string
+	KeyGen() (publicKey, privateKey []byte, err error)
+	Encapsulate(publicKey []byte) (ciphertext, sharedSecret []byte, err error)
+	Decapsulate(privateKey, ciphertext []byte) (sharedSecret []byte, err error)
+	Sizes() Sizes
+}
+
+// 実装の名前
+const (
+	ImplementationCircl  = "circl"
+	ImplementationStdlib = "go-stdlib"
+	ImplementationLibOQS = "liboqs"
+)
+
+// 鍵・暗号文・共有秘密鍵のサイズ（バイト）
+type Sizes struct {
+	PublicKey    int `json:"public_key"`
+	PrivateKey   int `json:"private_key"`
+	Ciphertext   int `json:"ciphertext"`
+	SharedSecret int `json:"shared_secret"`
+}
+
+// circlのkem.SchemeをKEMとして使う
+func FromCircl(s kem.Scheme) KEM {
+	return circlKEM{s}
+}
+
+type circlKEM struct {
+	scheme kem.Scheme
+}
+
+func (k circlKEM) Name() string           { return k.scheme.Name() }
+func (k circlKEM) Implementation() string { return ImplementationCircl }
+
+func (k circlKEM) KeyGen() ([]byte, []byte, error) {
+	pub, priv, err := k.scheme.GenerateKeyPair()
+	if err != nil {
+		return nil, nil, err
+	}
+	pubBytes, err := pub.MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+	privBytes, err := priv.MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+	return pubBytes, privBytes, nil
+}
+
+func (k circlKEM) Encapsulate(publicKey []byte) ([]byte, []byte, error) {
+	pub, err := k.scheme.UnmarshalBinaryPublicKey(publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return k.scheme.Encapsulate(pub)
+}
+
+func (k circlKEM) Decapsulate(privateKey, ciphertext []byte) ([]byte, error) {
+	priv, err := k.scheme.UnmarshalBinaryPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return k.scheme.Decapsulate(priv, ciphertext)
+}
+
+func (k circlKEM) Sizes() Sizes {
+	return Sizes{
+		PublicKey:    k.scheme.PublicKeySize(),
+		PrivateKey:   k.scheme.PrivateKeySize(),
+		Ciphertext:   k.scheme.CiphertextSize(),
+		SharedSecret: k.scheme.SharedKeySize(),
+	}
+}
+
+// RSA-OAEP（SHA-256）をKEMとして使う
+// ランダムな共有秘密鍵を生成して公開鍵で暗号化する（RSAサーバーと同じ鍵輸送方式）
+type rsaOAEP struct {
+	bits int
+}
+
+// 共有秘密鍵のサイズ（AES-256鍵と同じ）
+const rsaSharedSecretSize = 32
+
+func (k rsaOAEP) Name() string           { return fmt.Sprintf("RSA-OAEP-%d", k.bits) }
+func (k rsaOAEP) Implementation() string { return ImplementationStdlib }
+
+func (k rsaOAEP) KeyGen() ([]byte, []byte, error) {
+	priv, err := rsa.GenerateKey(rand.Reader, k.bits)
+	if err != nil {
+		return nil, nil, err
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pub, x509.MarshalPKCS1PrivateKey(priv), nil
+}
+
+func (k rsaOAEP) Encapsulate(publicKey []byte) ([]byte, []byte, error) {
+	parsed, err := x509.ParsePKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	pub, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("RSA公開鍵ではありません")
+	}
+	ss := make([]byte, rsaSharedSecretSize)
+	if _, err := io.ReadFull(rand.Reader, ss); err != nil {
+		return nil, nil, err
+	}
+	ct, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, ss, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ct, ss, nil
+}
+
+func (k rsaOAEP) Decapsulate(privateKey, ciphertext []byte) ([]byte, error) {
+	priv, err := x509.ParsePKCS1PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, ciphertext, nil)
+}
+
+// 秘密鍵のサイズはPKCS#1のDERエンコードによって変わるため0とする
+func (k rsaOAEP) Sizes() Sizes {
+	return Sizes{
+		PublicKey:    k.bits/8 + 38, // PKIXのDERエンコード（指数65537）
+		Ciphertext:   k.bits / 8,
+		SharedSecret: rsaSharedSecretSize,
+	}
+}
+
+// ECDH（P-256）をKEMとして使う（ephemeral-static、ECDHサーバーと同じ鍵合意）
+// 一時鍵の公開鍵を暗号文とし、静的鍵とのECDHで得たx座標を共有秘密鍵とする
+// 量子計算機への耐性はなく、PQCと現在の楕円曲線暗号を比較する基準として使う
+type ecdhP256 struct{}
+
+func (ecdhP256) Name() string           { return "ECDH-P256" }
+func (ecdhP256) Implementation() string { return ImplementationStdlib }
+
+func (ecdhP256) KeyGen() ([]byte, []byte, error) {
+	priv, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv.PublicKey().Bytes(), priv.Bytes(), nil
+}
+
+func (ecdhP256) Encapsulate(publicKey []byte) ([]byte, []byte, error) {
+	pub, err := ecdh.P256().NewPublicKey(publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	ephemeral, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	ss, err := ephemeral.ECDH(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ephemeral.PublicKey().Bytes(), ss, nil
+}
+
+func (ecdhP256) Decapsulate(privateKey, ciphertext []byte) ([]byte, error) {
+	priv, err := ecdh.P256().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	peer, err := ecdh.P256().NewPublicKey(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	return priv.ECDH(peer)
+}
+
+// 公開鍵と暗号文は非圧縮形式の点、秘密鍵はスカラー
+func (ecdhP256) Sizes() Sizes {
+	return Sizes{PublicKey: 65, PrivateKey: 32, Ciphertext: 65, SharedSecret: 32}
+}
@@ -0,0 +1,81 @@
+//go:build oqs
+
+// liboqs（Open Quantum Safe）の実装をcgo経由で登録する
+// ビルドにはliboqs 0.12.0のインストール（pkg-configでliboqs-goから見つかること）と、
+// 同じ版のliboqs-goをgo.modに追加することが必要（liboqs-goのタグはvの付かない0.12.0のため、疑似バージョンで記録される）
+// 既定のビルドはcgoを使わないため、go.modには含めていない
+//
+//	go get github.com/open-quantum-safe/liboqs-go/oqs@0.12.0
+//	go build -tags oqs ./...
+
+package kembench
+
+import (
+	"github.com/open-quantum-safe/liboqs-go/oqs"
+)
+
+// circlと比較するliboqsの方式（liboqsのビルドで無効になっているものは登録しない）
+var oqsAlgorithms = []string{"ML-KEM-512", "ML-KEM-768", "ML-KEM-1024"}
+
+func init() {
+	for _, name := range oqsAlgorithms {
+		if oqs.IsKEMEnabled(name) {
+			Register(oqsKEM{name: name})
+		}
+	}
+}
+
+// liboqs-goのKeyEncapsulationをKEMとして使う
+// KeyEncapsulationはCのリソースを持つため、操作ごとに作成して解放する
+type oqsKEM struct {
+	name string
+}
+
+func (k oqsKEM) Name() string           { return k.name }
+func (k oqsKEM) Implementation() string { return ImplementationLibOQS }
+
+func (k oqsKEM) KeyGen() ([]byte, []byte, error) {
+	var kem oqs.KeyEncapsulation
+	defer kem.Clean()
+	if err := kem.Init(k.name, nil); err != nil {
+		return nil, nil, err
+	}
+	pub, err := kem.GenerateKeyPair()
+	if err != nil {
+		return nil, nil, err
+	}
+	return pub, kem.ExportSecretKey(), nil
+}
+
+func (k oqsKEM) Encapsulate(publicKey []byte) ([]byte, []byte, error) {
+	var kem oqs.KeyEncapsulation
+	defer kem.Clean()
+	if err := kem.Init(k.name, nil); err != nil {
+		return nil, nil, err
+	}
+	return kem.EncapSecret(publicKey)
+}
+
+func (k oqsKEM) Decapsulate(privateKey, ciphertext []byte) ([]byte, error) {
+	var kem oqs.KeyEncapsulation
+	defer kem.Clean()
+	if err := kem.Init(k.name, privateKey); err != nil {
+		return nil, err
+	}
+	return kem.DecapSecret(ciphertext)
+}
+
+func (k oqsKEM) Sizes() Sizes {
+	var kem oqs.KeyEncapsulation
+	defer kem.Clean()
+	if err := kem.Init(k.name, nil); err != nil {
+		return Sizes{}
+	}
+	d := kem.Details()
+	return Sizes{
+		PublicKey:    d.LengthPublicKey,
+		PrivateKey:   d.LengthSecretKey,
+		Ciphertext:   d.LengthCiphertext,
+		SharedSecret: d.LengthSharedSecret,
+	}
+}
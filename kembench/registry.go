@@ -0,0 +1,78 @@
+package kembench
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/cloudflare/circl/kem/hybrid"
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+	"github.com/cloudflare/circl/kem/mlkem/mlkem1024"
+	"github.com/cloudflare/circl/kem/mlkem/mlkem512"
+	"github.com/cloudflare/circl/kem/mlkem/mlkem768"
+	"github.com/cloudflare/circl/kem/xwing"
+)
+
+// 登録されたKEM（登録順に計測する）
+var registry struct {
+	sync.RWMutex
+	kems []KEM
+}
+
+// 計測対象のKEMを登録する
+// 同じ名前と実装のKEMを2回登録した場合はpanicする
+func Register(k KEM) {
+	registry.Lock()
+	defer registry.Unlock()
+	for _, r := range registry.kems {
+		if r.Name() == k.Name() && r.Implementation() == k.Implementation() {
+			panic(fmt.Sprintf("kembench: KEM %q (%s) は登録済みです", k.Name(), k.Implementation()))
+		}
+	}
+	registry.kems = append(registry.kems, k)
+}
+
+// 名前と実装でKEMを探す
+// implementationが空の場合は、その名前で最初に登録されたKEMを返す
+// FIPSモードで承認されていないKEMは見つからないものとして扱い、試行を記録する
+func Lookup(name, implementation string) (KEM, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	for _, k := range registry.kems {
+		if k.Name() == name && (implementation == "" || k.Implementation() == implementation) {
+			if !featureEnabled(k) {
+				continue
+			}
+			if !allowed(k) {
+				fipsNonCompliant.WithLabelValues(k.Name(), k.Implementation()).Inc()
+				return nil, false
+			}
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+// 登録されたすべてのKEM（フィーチャーゲートで無効にしたものを除き、FIPSモードでは承認されたものだけ）
+func All() []KEM {
+	registry.RLock()
+	defer registry.RUnlock()
+	var kems []KEM
+	for _, k := range registry.kems {
+		if featureEnabled(k) && allowed(k) {
+			kems = append(kems, k)
+		}
+	}
+	return kems
+}
+
+func init() {
+	Register(rsaOAEP{bits: 2048})
+	Register(rsaOAEP{bits: 3072})          // FIPSモードで使えるRSAの最小鍵長
+	Register(ecdhP256{})                   // 現在の楕円曲線暗号との比較の基準
+	Register(FromCircl(kyber768.Scheme())) // ML-KEMサーバーが使う方式
+	Register(FromCircl(mlkem512.Scheme()))
+	Register(FromCircl(mlkem768.Scheme()))
+	Register(FromCircl(mlkem1024.Scheme()))
+	Register(FromCircl(hybrid.X25519MLKEM768()))
+	Register(FromCircl(xwing.Scheme()))
+}
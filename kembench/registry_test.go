@@ -0,0 +1,73 @@
+package kembench
+
+import (
+	"bytes"
+	"testing"
+)
+
+// 登録されたすべてのKEMで鍵生成・カプセル化・カプセル化の解除を行い、共有秘密鍵とサイズを確かめる
+func TestAllRoundTrip(t *testing.T) {
+	kems := All()
+	if len(kems) == 0 {
+		t.Fatal("KEMが登録されていません")
+	}
+	for _, k := range kems {
+		t.Run(k.Name()+"/"+k.Implementation(), func(t *testing.T) {
+			pk, sk, err := k.KeyGen()
+			if err != nil {
+				t.Fatalf("KeyGen: %v", err)
+			}
+			ct, ss, err := k.Encapsulate(pk)
+			if err != nil {
+				t.Fatalf("Encapsulate: %v", err)
+			}
+			got, err := k.Decapsulate(sk, ct)
+			if err != nil {
+				t.Fatalf("Decapsulate: %v", err)
+			}
+			if !bytes.Equal(got, ss) {
+				t.Fatalf("共有秘密鍵が一致しません: %x != %x", got, ss)
+			}
+
+			sizes := k.Sizes()
+			for _, c := range []struct {
+				name      string
+				got, want int
+			}{
+				{"public key", len(pk), sizes.PublicKey},
+				{"ciphertext", len(ct), sizes.Ciphertext},
+				{"shared secret", len(ss), sizes.SharedSecret},
+			} {
+				if c.got != c.want {
+					t.Errorf("%sのサイズ = %d, Sizes() = %d", c.name, c.got, c.want)
+				}
+			}
+			// 秘密鍵のサイズはエンコードによって変わる場合は0
+			if sizes.PrivateKey != 0 && len(sk) != sizes.PrivateKey {
+				t.Errorf("private keyのサイズ = %d, Sizes() = %d", len(sk), sizes.PrivateKey)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, k := range All() {
+		got, ok := Lookup(k.Name(), k.Implementation())
+		if !ok || got.Name() != k.Name() || got.Implementation() != k.Implementation() {
+			t.Errorf("Lookup(%q, %q) = %v, %v", k.Name(), k.Implementation(), got, ok)
+		}
+	}
+	if _, ok := Lookup("no-such-kem", ""); ok {
+		t.Error("登録されていないKEMが見つかりました")
+	}
+}
+
+func TestRegisterDuplicatePanics(t *testing.T) {
+	k := All()[0]
+	defer func() {
+		if recover() == nil {
+			t.Error("同じKEMを2回登録してもpanicしません")
+		}
+	}()
+	Register(k)
+}
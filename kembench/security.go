@@ -0,0 +1,90 @@
+package kembench
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 方式が主張するセキュリティ強度
+type Security struct {
+	Level int // NISTのセキュリティカテゴリ（1・3・5、カテゴリ1に満たない場合は0）
+	Bits  int // 同等の強度のビット数（RSAはSP 800-57、カテゴリ1・3・5はAES-128・192・256の鍵探索に相当）
+}
+
+// 方式の名前ごとのセキュリティ強度
+// ハイブリッド方式はポスト量子の構成要素（ML-KEM-768）のカテゴリとする
+// ECDH-P256は古典的な強度であり、量子計算機に対する強度はRSAと同じくないものと考える
+var securityLevels = map[string]Security{
+	"RSA-OAEP-2048":  {Level: 0, Bits: 112},
+	"RSA-OAEP-3072":  {Level: 1, Bits: 128},
+	"ECDH-P256":      {Level: 1, Bits: 128},
+	"Kyber768":       {Level: 3, Bits: 192},
+	"ML-KEM-512":     {Level: 1, Bits: 128},
+	"ML-KEM-768":     {Level: 3, Bits: 192},
+	"ML-KEM-1024":    {Level: 5, Bits: 256},
+	"X25519MLKEM768": {Level: 3, Bits: 192},
+	"X-Wing":         {Level: 3, Bits: 192},
+}
+
+// 方式のセキュリティ強度を返す（表にない方式はfalse）
+func SecurityOf(name string) (Security, bool) {
+	s, ok := securityLevels[name]
+	return s, ok
+}
+
+var (
+	securityLevel = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kem_bench_security_level",
+			Help: "Claimed NIST security category of the KEM (1, 3 or 5, 0 if below category 1)",
+		},
+		[]string{"kem"},
+	)
+	securityBits = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kem_bench_security_bits",
+			Help: "Comparable security strength of the KEM in bits (SP 800-57 for RSA, AES key search for NIST categories)",
+		},
+		[]string{"kem"},
+	)
+	bytesPerSecurityBit = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kem_bench_bytes_per_security_bit",
+			Help: "Size divided by the security strength in bits, by KEM, implementation and kind (public_key, ciphertext or exchange)",
+		},
+		[]string{"kem", "implementation", "kind"},
+	)
+	microsecondsPerSecurityBit = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kem_bench_microseconds_per_security_bit",
+			Help: "Duration of the latest KEM operation in microseconds divided by the security strength in bits, by KEM, implementation, operation and side",
+		},
+		[]string{"kem", "implementation", "operation", "side"},
+	)
+)
+
+// セキュリティ強度とサイズを強度で割った値を記録する
+func recordSecurity(k KEM) {
+	s, ok := SecurityOf(k.Name())
+	if !ok {
+		return
+	}
+	securityLevel.WithLabelValues(k.Name()).Set(float64(s.Level))
+	securityBits.WithLabelValues(k.Name()).Set(float64(s.Bits))
+	sizes := k.Sizes()
+	bits := float64(s.Bits)
+	bytesPerSecurityBit.WithLabelValues(k.Name(), k.Implementation(), "public_key").Set(float64(sizes.PublicKey) / bits)
+	bytesPerSecurityBit.WithLabelValues(k.Name(), k.Implementation(), "ciphertext").Set(float64(sizes.Ciphertext) / bits)
+	// 鍵交換で送受信するデータ（公開鍵と暗号文）
+	bytesPerSecurityBit.WithLabelValues(k.Name(), k.Implementation(), "exchange").Set(float64(sizes.PublicKey+sizes.Ciphertext) / bits)
+}
+
+// 操作の所要時間を強度で割って記録する
+func observeSecurity(k KEM, operation, side string, d time.Duration) {
+	s, ok := SecurityOf(k.Name())
+	if !ok {
+		return
+	}
+	microsecondsPerSecurityBit.WithLabelValues(k.Name(), k.Implementation(), operation, side).Set(d.Seconds() * 1e6 / float64(s.Bits))
+}
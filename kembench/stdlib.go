@@ -0,0 +1,88 @@
+//go:build go1.24
+
+package kembench
+
+import (
+	"crypto/mlkem"
+	"fmt"
+)
+
+// 標準ライブラリのcrypto/mlkem（Go 1.24以降）を登録する
+// 外部の依存なしでML-KEMを使えるため、circlとの性能差を比較する
+func init() {
+	Register(stdlibMLKEM{bits: 768})
+	Register(stdlibMLKEM{bits: 1024})
+}
+
+// crypto/mlkemをKEMとして使う
+// 秘密鍵はFIPS 203の64バイトのシード形式で受け渡す
+type stdlibMLKEM struct {
+	bits int // 768 / 1024
+}
+
+func (k stdlibMLKEM) Name() string           { return fmt.Sprintf("ML-KEM-%d", k.bits) }
+func (k stdlibMLKEM) Implementation() string { return ImplementationStdlib }
+
+func (k stdlibMLKEM) KeyGen() ([]byte, []byte, error) {
+	if k.bits == 1024 {
+		dk, err := mlkem.GenerateKey1024()
+		if err != nil {
+			return nil, nil, err
+		}
+		return dk.EncapsulationKey().Bytes(), dk.Bytes(), nil
+	}
+	dk, err := mlkem.GenerateKey768()
+	if err != nil {
+		return nil, nil, err
+	}
+	return dk.EncapsulationKey().Bytes(), dk.Bytes(), nil
+}
+
+func (k stdlibMLKEM) Encapsulate(publicKey []byte) ([]byte, []byte, error) {
+	if k.bits == 1024 {
+		ek, err := mlkem.NewEncapsulationKey1024(publicKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		ss, ct := ek.Encapsulate()
+		return ct, ss, nil
+	}
+	ek, err := mlkem.NewEncapsulationKey768(publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	ss, ct := ek.Encapsulate()
+	return ct, ss, nil
+}
+
+func (k stdlibMLKEM) Decapsulate(privateKey, ciphertext []byte) ([]byte, error) {
+	if k.bits == 1024 {
+		dk, err := mlkem.NewDecapsulationKey1024(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		return dk.Decapsulate(ciphertext)
+	}
+	dk, err := mlkem.NewDecapsulationKey768(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return dk.Decapsulate(ciphertext)
+}
+
+func (k stdlibMLKEM) Sizes() Sizes {
+	if k.bits == 1024 {
+		return Sizes{
+			PublicKey:    mlkem.EncapsulationKeySize1024,
+			PrivateKey:   mlkem.SeedSize,
+			Ciphertext:   mlkem.CiphertextSize1024,
+			SharedSecret: mlkem.SharedKeySize,
+		}
+	}
+	return Sizes{
+		PublicKey:    mlkem.EncapsulationKeySize768,
+		PrivateKey:   mlkem.SeedSize,
+		Ciphertext:   mlkem.CiphertextSize768,
+		SharedSecret: mlkem.SharedKeySize,
+	}
+}
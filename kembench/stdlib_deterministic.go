@@ -0,0 +1,47 @@
+//go:build go1.26
+
+package kembench
+
+import (
+	"crypto/mlkem"
+	"crypto/mlkem/mlkemtest"
+)
+
+// 決定的なカプセル化はGo 1.26のcrypto/mlkem/mlkemtestで公開されたため、それ以降でだけ決定的モードに対応する
+
+func (k stdlibMLKEM) DeriveKeyPair(seed []byte) ([]byte, []byte, error) {
+	if k.bits == 1024 {
+		dk, err := mlkem.NewDecapsulationKey1024(seed)
+		if err != nil {
+			return nil, nil, err
+		}
+		return dk.EncapsulationKey().Bytes(), dk.Bytes(), nil
+	}
+	dk, err := mlkem.NewDecapsulationKey768(seed)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dk.EncapsulationKey().Bytes(), dk.Bytes(), nil
+}
+
+func (k stdlibMLKEM) EncapsulateDeterministically(publicKey, seed []byte) ([]byte, []byte, error) {
+	if k.bits == 1024 {
+		ek, err := mlkem.NewEncapsulationKey1024(publicKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		ss, ct, err := mlkemtest.Encapsulate1024(ek, seed)
+		return ct, ss, err
+	}
+	ek, err := mlkem.NewEncapsulationKey768(publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	ss, ct, err := mlkemtest.Encapsulate768(ek, seed)
+	return ct, ss, err
+}
+
+// FIPS 203の鍵生成のシード（d || z）は64バイト、カプセル化の乱数（m）は32バイト
+func (k stdlibMLKEM) SeedSizes() (int, int) {
+	return mlkem.SeedSize, 32
+}
@@ -0,0 +1,198 @@
+// Package keyarchive はサーバーが生成した鍵ペアと、受信した暗号化データ（設定した場合）を
+// 時刻とリリースの情報を付けてJSON Linesのファイルに保存する
+//
+// 保存した暗号化データを後のリリースのサーバーのコードで復号し直すことで（keyreplay）、
+// 暗号化データの形式の後方互換性を確認する。秘密鍵をそのまま保存するため、研究用の環境以外では使わない
+package keyarchive
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// サービス名（メトリクスのserviceラベル）
+const ServiceName = "key-archive"
+
+var factory = metrics.NewFactory(ServiceName, "key_archive_")
+
+var (
+	recordsWritten = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "key_archive_records_written_total",
+			Help: "Total number of records written to the key archive, by service and type (key, ciphertext)",
+		},
+		[]string{"origin_service", "type"},
+	)
+	writeErrors = factory.NewCounter(
+		prometheus.CounterOpts{
+			Name: "key_archive_write_errors_total",
+			Help: "Total number of records that could not be written to the key archive",
+		},
+	)
+)
+
+// 記録の種類
+const (
+	TypeKey        = "key"        // 生成した鍵ペア
+	TypeCiphertext = "ciphertext" // 受信した暗号化データと、復号した平文のSHA-256
+)
+
+// 保存する記録（1行に1つ）
+type Record struct {
+	Type          string    `json:"type"`
+	ArchivedAt    time.Time `json:"archived_at"`
+	Service       string    `json:"service"`        // 記録したサーバー（rsa-server / ml-kem-server）
+	FormatVersion int       `json:"format_version"` // 記録した時点の暗号化データの形式の版（wire.EnvelopeFormatVersion）
+	Release       string    `json:"release"`        // 記録したバイナリのバージョンとコミット
+	KeyID         string    `json:"key_id"`
+
+	// 鍵ペア（type=key）
+	Algorithm  string `json:"algorithm,omitempty"`   // 鍵の方式（例: RSA-2048、ML-KEM-768）
+	PrivateKey string `json:"private_key,omitempty"` // Base64（RSAはPKCS#8 DER、ML-KEMはcirclのバイナリ形式）
+	PublicKey  string `json:"public_key,omitempty"`  // Base64（公開鍵のレスポンスと同じ形式）
+
+	// 暗号化データ（type=ciphertext）
+	Envelope        *wire.EncryptedData `json:"envelope,omitempty"`
+	PlaintextSHA256 string              `json:"plaintext_sha256,omitempty"` // Base64（DecryptResponseと同じ）
+}
+
+// 鍵と暗号化データの保存先（nilの場合は何も保存しない）
+type Archive struct {
+	mu          sync.Mutex
+	w           *bufio.Writer
+	closer      io.Closer
+	release     string
+	ciphertexts bool
+}
+
+// wに保存する（ciphertextsがfalseの場合は鍵ペアだけを保存する）
+func New(w io.Writer, ciphertexts bool) *Archive {
+	info := metrics.ReadBuildInfo()
+	a := &Archive{w: bufio.NewWriter(w), release: info.Version + "+" + info.Commit, ciphertexts: ciphertexts}
+	if c, ok := w.(io.Closer); ok {
+		a.closer = c
+	}
+	return a
+}
+
+// ファイルに追記する（ファイルは所有者だけが読めるように作る）
+func Open(path string, ciphertexts bool) (*Archive, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("鍵の保存先ファイルを開けません: %w", err)
+	}
+	log.Printf("⚠️  生成した秘密鍵を %s に保存します: 研究用の環境以外では使用しないでください", path)
+	return New(f, ciphertexts), nil
+}
+
+// 書き込みを終えてファイルを閉じる
+func (a *Archive) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	err := a.w.Flush()
+	if a.closer != nil {
+		if cerr := a.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// 生成した鍵ペアを保存する
+func (a *Archive) StoreKey(service, keyID, algorithm string, privateKey, publicKey []byte) {
+	if a == nil {
+		return
+	}
+	a.write(Record{
+		Type:       TypeKey,
+		Service:    service,
+		KeyID:      keyID,
+		Algorithm:  algorithm,
+		PrivateKey: base64.StdEncoding.EncodeToString(privateKey),
+		PublicKey:  base64.StdEncoding.EncodeToString(publicKey),
+	})
+}
+
+// 暗号化データを保存するか
+func (a *Archive) StoresCiphertexts() bool {
+	return a != nil && a.ciphertexts
+}
+
+// 復号できた暗号化データと平文のSHA-256（Base64）を保存する（設定で有効にした場合のみ）
+func (a *Archive) StoreCiphertext(service string, data *wire.EncryptedData, plaintextSHA256 string) {
+	if !a.StoresCiphertexts() {
+		return
+	}
+	envelope := *data
+	a.write(Record{
+		Type:            TypeCiphertext,
+		Service:         service,
+		KeyID:           data.KeyID,
+		Envelope:        &envelope,
+		PlaintextSHA256: plaintextSHA256,
+	})
+}
+
+func (a *Archive) write(rec Record) {
+	rec.ArchivedAt = time.Now().UTC()
+	rec.FormatVersion = wire.EnvelopeFormatVersion
+	rec.Release = a.release
+	line, err := json.Marshal(rec)
+	if err == nil {
+		a.mu.Lock()
+		_, err = a.w.Write(append(line, '\n'))
+		if err == nil {
+			// プロセスが強制終了しても記録が残るように、1件ごとに書き出す
+			err = a.w.Flush()
+		}
+		a.mu.Unlock()
+	}
+	if err != nil {
+		writeErrors.Inc()
+		log.Printf("[%s] 記録の書き込みエラー: %v", ServiceName, err)
+		return
+	}
+	recordsWritten.WithLabelValues(rec.Service, rec.Type).Inc()
+}
+
+// 保存した記録を読み込む
+func Read(r io.Reader) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), wire.MaxEncryptedDataSize+(1<<20))
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%d行目の形式が不正です: %w", line, err)
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+// ファイルから記録を読み込む
+func ReadFile(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
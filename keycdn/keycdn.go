@@ -0,0 +1,373 @@
+// Package keycdn は公開鍵の配信を模擬するキャッシュ付きのリバースプロキシ（CDNのエッジ）を提供する
+//
+// オリジン（RSA・ML-KEMサーバー）のCache-Controlに従ってGETのレスポンスを保存し、Ageを付けて返す。
+// 期限が切れたレスポンスはETagでオリジンに再検証し、GET以外のリクエスト（復号など）はそのまま転送する。
+// オリジンに届いたリクエストとエッジで返したリクエストの数とバイト数を記録し、
+// staticモードの公開鍵をキャッシュできることでPQCの大きな公開鍵の配信帯域がどう変わるかを比較する
+package keycdn
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/internal/httpmw"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// サービス名（メトリクスのserviceラベル）
+const ServiceName = "key-cdn"
+
+var factory = metrics.NewFactory(ServiceName, "key_cdn_")
+
+var httpMiddleware = httpmw.New(ServiceName, factory, "key_cdn_")
+
+// キャッシュの結果
+const (
+	ResultHit         = "hit"         // 有効期限内のレスポンスをエッジで返した
+	ResultMiss        = "miss"        // オリジンから取得して保存した
+	ResultRevalidated = "revalidated" // 期限切れのレスポンスをETagで再検証した（304）
+	ResultUncacheable = "uncacheable" // オリジンから取得したが保存できなかった（no-store、private、ETagのないno-cacheなど）
+	ResultBypass      = "bypass"      // GET以外のリクエストをそのまま転送した
+	ResultError       = "error"       // オリジンに接続できなかった
+)
+
+var (
+	requestsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "key_cdn_requests_total",
+			Help: "Total number of requests handled by the edge, by origin and cache result (hit, miss, revalidated, uncacheable, bypass, error)",
+		},
+		[]string{"origin", "result"},
+	)
+	originRequestsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "key_cdn_origin_requests_total",
+			Help: "Total number of requests forwarded to the origin, by origin and status code",
+		},
+		[]string{"origin", "code"},
+	)
+	bytesTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "key_cdn_bytes_total",
+			Help: "Total number of GET response body bytes, by origin and source (origin for bytes fetched from the origin, edge for bytes served to clients)",
+		},
+		[]string{"origin", "source"},
+	)
+	requestDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "key_cdn_request_duration_seconds",
+			Help:    "Histogram of the time to answer a request at the edge in seconds, by origin and cache result",
+			Buckets: []float64{0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1},
+		},
+		[]string{"origin", "result"},
+	)
+	cacheEntries = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "key_cdn_cache_entries",
+			Help: "Number of responses stored at the edge, by origin",
+		},
+		[]string{"origin"},
+	)
+)
+
+// 保存するレスポンスの本文の最大サイズ
+const maxCachedBody = 1 << 20
+
+// オリジンごとに保存するレスポンスの最大数（クエリを変えたリクエストでメモリを使い切らないようにする）
+const maxEntries = 1024
+
+// エッジの待ち受けアドレスと転送先のオリジン
+type Route struct {
+	Addr   string
+	Origin string // オリジンのURL（例: http://rsa-server:8080）
+}
+
+// "addr=origin" 形式の文字列をパースする（例: :8190=http://rsa-server:8080）
+func ParseRoute(s string) (Route, error) {
+	addr, origin, ok := strings.Cut(s, "=")
+	if !ok || addr == "" || origin == "" {
+		return Route{}, fmt.Errorf("経路の形式が不正です: %q (addr=origin)", s)
+	}
+	return Route{Addr: addr, Origin: origin}, nil
+}
+
+// エッジの設定
+type Config struct {
+	Routes []Route
+}
+
+// docker-compose環境向けのデフォルト設定（RSAサーバーとML-KEMサーバーの前に置く）
+func DefaultConfig() Config {
+	return Config{Routes: []Route{
+		{Addr: ":8190", Origin: "http://rsa-server:8080"},
+		{Addr: ":8191", Origin: "http://ml-kem-server:8081"},
+	}}
+}
+
+// 保存したレスポンス
+type entry struct {
+	header   http.Header // Content-Type、ETag、Cache-Control
+	body     []byte
+	etag     string
+	storedAt time.Time // オリジンから取得（再検証）した時刻（Ageの起点）
+	expires  time.Time
+}
+
+// 1つのオリジンの前に置くキャッシュ付きのリバースプロキシ
+type Proxy struct {
+	origin  *url.URL
+	label   string // メトリクスのoriginラベル（オリジンのホスト）
+	client  *http.Client
+	forward *httputil.ReverseProxy
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+// オリジンのURLからプロキシを作る
+func New(origin string) (*Proxy, error) {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return nil, fmt.Errorf("オリジンのURLが不正です: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("オリジンのURLが不正です: %q (http://host:port)", origin)
+	}
+	return &Proxy{
+		origin:  u,
+		label:   u.Host,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		forward: httputil.NewSingleHostReverseProxy(u),
+		entries: make(map[string]*entry),
+	}, nil
+}
+
+// HTTPハンドラー（リクエスト数と所要時間のミドルウェアを付ける）
+func (p *Proxy) Handler() http.Handler {
+	return httpMiddleware.Handler(p.label, p)
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	result := p.serve(w, r)
+	requestsTotal.WithLabelValues(p.label, result).Inc()
+	requestDuration.WithLabelValues(p.label, result).Observe(time.Since(start).Seconds())
+}
+
+func (p *Proxy) serve(w http.ResponseWriter, r *http.Request) string {
+	if r.Method != http.MethodGet {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		p.forward.ServeHTTP(rec, r)
+		originRequestsTotal.WithLabelValues(p.label, strconv.Itoa(rec.status)).Inc()
+		return ResultBypass
+	}
+
+	uri := r.URL.RequestURI()
+	// オリジンはAccept-Versionごとに異なるEnvelope-Versionを返す（Vary: Accept-Version）
+	key := uri + "\n" + r.Header.Get(wire.AcceptVersionHeader)
+	now := time.Now()
+	p.mu.Lock()
+	cached := p.entries[key]
+	p.mu.Unlock()
+	if cached != nil && now.Before(cached.expires) {
+		p.write(w, r, cached, ResultHit)
+		return ResultHit
+	}
+
+	resp, err := p.fetch(r, uri, cached)
+	if err != nil {
+		http.Error(w, "オリジンに接続できません", http.StatusBadGateway)
+		log.Printf("[%s] オリジン %s への転送エラー: %v", ServiceName, p.label, err)
+		return ResultError
+	}
+	defer resp.Body.Close()
+	originRequestsTotal.WithLabelValues(p.label, strconv.Itoa(resp.StatusCode)).Inc()
+
+	// 期限切れのレスポンスが変わっていなければ、有効期限だけを更新する
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		refreshed := *cached
+		refreshed.storedAt = time.Now()
+		refreshed.expires = refreshed.storedAt.Add(freshness(resp.Header.Get("Cache-Control")))
+		if cc := resp.Header.Get("Cache-Control"); cc != "" {
+			refreshed.header = refreshed.header.Clone()
+			refreshed.header.Set("Cache-Control", cc)
+		}
+		p.store(key, &refreshed)
+		p.write(w, r, &refreshed, ResultRevalidated)
+		return ResultRevalidated
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCachedBody+1))
+	if err == nil && len(body) > maxCachedBody {
+		err = errors.New("本文が大きすぎます")
+	}
+	if err != nil {
+		http.Error(w, "オリジンのレスポンスを読み込めません", http.StatusBadGateway)
+		log.Printf("[%s] オリジン %s のレスポンスの読み込みエラー: %v", ServiceName, p.label, err)
+		return ResultError
+	}
+	bytesTotal.WithLabelValues(p.label, "origin").Add(float64(len(body)))
+
+	fetched := &entry{
+		header:   http.Header{},
+		body:     body,
+		etag:     resp.Header.Get("ETag"),
+		storedAt: time.Now(),
+	}
+	for _, name := range []string{"Content-Type", "ETag", "Cache-Control", "Vary", wire.EnvelopeVersionHeader} {
+		if v := resp.Header.Get(name); v != "" {
+			fetched.header.Set(name, v)
+		}
+	}
+	fetched.expires = fetched.storedAt.Add(freshness(resp.Header.Get("Cache-Control")))
+
+	if resp.StatusCode != http.StatusOK || !storable(resp.Header.Get("Cache-Control"), fetched) {
+		p.remove(key)
+		w.Header().Set("X-Cache", "MISS")
+		copyHeader(w.Header(), fetched.header)
+		w.WriteHeader(resp.StatusCode)
+		w.Write(body)
+		bytesTotal.WithLabelValues(p.label, "edge").Add(float64(len(body)))
+		return ResultUncacheable
+	}
+	p.store(key, fetched)
+	p.write(w, r, fetched, ResultMiss)
+	return ResultMiss
+}
+
+// オリジンからGETで取得する（期限切れのレスポンスがあればETagで再検証する）
+func (p *Proxy) fetch(r *http.Request, uri string, cached *entry) (*http.Response, error) {
+	target, err := p.origin.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{httpmw.RequestIDHeader, wire.AcceptVersionHeader} {
+		if v := r.Header.Get(name); v != "" {
+			req.Header.Set(name, v)
+		}
+	}
+	if cached != nil && cached.etag != "" {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+	return p.client.Do(req)
+}
+
+// 保存したレスポンスをAgeを付けて返す（クライアントのIf-None-Matchが一致すれば304を返す）
+func (p *Proxy) write(w http.ResponseWriter, r *http.Request, e *entry, result string) {
+	copyHeader(w.Header(), e.header)
+	w.Header().Set("Age", strconv.Itoa(int(time.Since(e.storedAt)/time.Second)))
+	w.Header().Set("X-Cache", strings.ToUpper(result))
+	if wire.MatchETag(r.Header.Get("If-None-Match"), e.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(e.body)
+	bytesTotal.WithLabelValues(p.label, "edge").Add(float64(len(e.body)))
+}
+
+func (p *Proxy) store(key string, e *entry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.entries[key]; !ok && len(p.entries) >= maxEntries {
+		return
+	}
+	p.entries[key] = e
+	cacheEntries.WithLabelValues(p.label).Set(float64(len(p.entries)))
+}
+
+func (p *Proxy) remove(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.entries, key)
+	cacheEntries.WithLabelValues(p.label).Set(float64(len(p.entries)))
+}
+
+// Cache-Controlから共有キャッシュでの有効期間を求める（s-maxageを優先し、no-cacheや指定がない場合は0）
+func freshness(cacheControl string) time.Duration {
+	var maxAge, sMaxAge time.Duration = -1, -1
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store", "private":
+			return 0
+		case "max-age", "s-maxage":
+			n, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err != nil || n < 0 {
+				continue
+			}
+			if strings.EqualFold(name, "s-maxage") {
+				sMaxAge = time.Duration(n) * time.Second
+			} else {
+				maxAge = time.Duration(n) * time.Second
+			}
+		}
+	}
+	if sMaxAge >= 0 {
+		return sMaxAge
+	}
+	return max(maxAge, 0)
+}
+
+// レスポンスを保存できるか
+// no-storeとprivateは保存せず、有効期間が0のレスポンスは再検証に使うETagがある場合だけ保存する
+func storable(cacheControl string, e *entry) bool {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, _, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if strings.EqualFold(name, "no-store") || strings.EqualFold(name, "private") {
+			return false
+		}
+	}
+	return e.expires.After(e.storedAt) || e.etag != ""
+}
+
+func copyHeader(dst, src http.Header) {
+	for name, values := range src {
+		dst[name] = values
+	}
+}
+
+// 転送したリクエストのステータスコードを記録するResponseWriter
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// すべての経路で待ち受ける（いずれかのサーバーが終了した場合はそのエラーを返す）
+func Run(cfg Config) error {
+	if len(cfg.Routes) == 0 {
+		return errors.New("経路を指定してください")
+	}
+	errs := make(chan error, len(cfg.Routes))
+	for _, route := range cfg.Routes {
+		proxy, err := New(route.Origin)
+		if err != nil {
+			return err
+		}
+		log.Printf("[%s] %s → %s を中継します", ServiceName, route.Addr, route.Origin)
+		go func(addr string, handler http.Handler) {
+			errs <- metrics.ListenAndServe(addr, handler)
+		}(route.Addr, proxy.Handler())
+	}
+	return <-errs
+}
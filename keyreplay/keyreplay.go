@@ -0,0 +1,207 @@
+// Package keyreplay は keyarchive に保存した過去の暗号化データを、現在のリリースのサーバーのコードで
+// 復号し直し、記録した平文のSHA-256と一致するかで暗号化データの形式の後方互換性を確認する
+//
+// 保存した鍵ペアを読み込んだRSAサーバーとML-KEMサーバーのハンドラーをプロセス内に作り、
+// 実際のクライアントと同じHTTPのリクエスト（/decrypt、/decapsulate）で再生する
+package keyreplay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/keyarchive"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/mlkemserver"
+	"github.com/keyi1000/PQC_grafana/rsaserver"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// サービス名（メトリクスのserviceラベル）
+const ServiceName = "key-replay"
+
+var factory = metrics.NewFactory(ServiceName, "key_replay_")
+
+var (
+	replayResults = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "key_replay_results_total",
+			Help: "Total number of archived ciphertexts replayed through the current server code, by origin service, envelope format version and result (match, mismatch, rejected, unknown_service)",
+		},
+		[]string{"origin_service", "format_version", "result"},
+	)
+	archivedRecords = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "key_replay_archived_records",
+			Help: "Number of records in the key archive at the last replay, by type (key, ciphertext) and envelope format version",
+		},
+		[]string{"type", "format_version"},
+	)
+	oldestRecordAge = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "key_replay_oldest_record_age_seconds",
+			Help: "Age of the oldest archived ciphertext at the last replay in seconds",
+		},
+	)
+	currentFormatVersion = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "key_replay_current_format_version",
+			Help: "Envelope format version written by the current release",
+		},
+	)
+	lastReplay = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "key_replay_last_run_timestamp_seconds",
+			Help: "Unix time of the last completed replay",
+		},
+	)
+	replayDuration = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "key_replay_duration_seconds",
+			Help: "Duration of the last replay in seconds",
+		},
+	)
+)
+
+func init() {
+	currentFormatVersion.Set(wire.EnvelopeFormatVersion)
+}
+
+// 再生の結果
+const (
+	ResultMatch          = "match"           // 復号でき、平文のSHA-256が記録と一致した
+	ResultMismatch       = "mismatch"        // 復号できたが、平文のSHA-256が記録と異なる
+	ResultRejected       = "rejected"        // 現在のサーバーが暗号化データを受け付けなかった
+	ResultUnknownService = "unknown_service" // 記録したサーバーを再生できない
+)
+
+// 1回の再生の集計
+type Summary struct {
+	Keys        int
+	Ciphertexts int
+	Results     map[string]int // 結果ごとの件数
+}
+
+// 後方互換性が壊れている（一致しない、または受け付けられない暗号化データがある）か
+func (s Summary) Failed() bool {
+	return s.Results[ResultMismatch] > 0 || s.Results[ResultRejected] > 0
+}
+
+// 保存した暗号化データをすべて再生する
+func Replay(records []keyarchive.Record) Summary {
+	start := time.Now()
+	sum := Summary{Results: make(map[string]int)}
+
+	// 保存した鍵ペアで復号するため、サーバー自身は鍵を生成しない設定で十分
+	rsaCfg := rsaserver.DefaultConfig()
+	rsaCfg.ArchivedKeys = records
+	mlkemCfg := mlkemserver.DefaultConfig()
+	mlkemCfg.ArchivedKeys = records
+	targets := map[string]struct {
+		handler http.Handler
+		path    string
+	}{
+		rsaserver.ServiceName:   {rsaserver.NewHandler(rsaCfg), "/decrypt"},
+		mlkemserver.ServiceName: {mlkemserver.NewHandler(mlkemCfg), "/decapsulate"},
+	}
+
+	archivedRecords.Reset()
+	var oldest time.Time
+	for _, rec := range records {
+		version := strconv.Itoa(rec.FormatVersion)
+		archivedRecords.WithLabelValues(rec.Type, version).Inc()
+		if rec.Type == keyarchive.TypeKey {
+			sum.Keys++
+			continue
+		}
+		if rec.Type != keyarchive.TypeCiphertext || rec.Envelope == nil {
+			continue
+		}
+		sum.Ciphertexts++
+		if oldest.IsZero() || rec.ArchivedAt.Before(oldest) {
+			oldest = rec.ArchivedAt
+		}
+
+		result := ResultUnknownService
+		if target, ok := targets[rec.Service]; ok {
+			result = replayOne(target.handler, target.path, rec)
+		}
+		sum.Results[result]++
+		replayResults.WithLabelValues(rec.Service, version, result).Inc()
+	}
+	if !oldest.IsZero() {
+		oldestRecordAge.Set(time.Since(oldest).Seconds())
+	}
+	replayDuration.Set(time.Since(start).Seconds())
+	lastReplay.SetToCurrentTime()
+	return sum
+}
+
+// 1件の暗号化データをサーバーのハンドラーに送り、結果を判定する
+func replayOne(handler http.Handler, path string, rec keyarchive.Record) string {
+	body, err := json.Marshal(rec.Envelope)
+	if err != nil {
+		log.Printf("[%s] 暗号化データのエンコードエラー (鍵ID: %s): %v", ServiceName, rec.KeyID, err)
+		return ResultRejected
+	}
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, req)
+
+	if rw.Code != http.StatusOK {
+		log.Printf("[%s] %sの暗号化データ（形式: v%d, リリース: %s, 鍵ID: %s）を受け付けませんでした: %d %s",
+			ServiceName, rec.Service, rec.FormatVersion, rec.Release, rec.KeyID, rw.Code, bytes.TrimSpace(rw.Body.Bytes()))
+		return ResultRejected
+	}
+	var resp wire.DecryptResponse
+	if err := json.Unmarshal(rw.Body.Bytes(), &resp); err != nil {
+		log.Printf("[%s] 復号結果のデコードエラー (鍵ID: %s): %v", ServiceName, rec.KeyID, err)
+		return ResultRejected
+	}
+	if resp.PlaintextSHA256 != rec.PlaintextSHA256 {
+		log.Printf("[%s] %sの暗号化データ（形式: v%d, リリース: %s, 鍵ID: %s）の平文が記録と一致しません",
+			ServiceName, rec.Service, rec.FormatVersion, rec.Release, rec.KeyID)
+		return ResultMismatch
+	}
+	return ResultMatch
+}
+
+// 再生の設定
+type Config struct {
+	Path     string        // 保存した記録のファイル
+	Interval time.Duration // 再生の間隔（0の場合は1回だけ再生する）
+}
+
+// 記録のファイルを読み込んで再生する
+// Intervalが0の場合は1回だけ再生し、後方互換性が壊れていればエラーを返す
+func Run(cfg Config) error {
+	for {
+		records, err := keyarchive.ReadFile(cfg.Path)
+		if err != nil {
+			if cfg.Interval == 0 {
+				return fmt.Errorf("記録の読み込みエラー: %w", err)
+			}
+			log.Printf("[%s] 記録の読み込みエラー: %v", ServiceName, err)
+		} else {
+			sum := Replay(records)
+			log.Printf("[%s] 再生しました: 鍵ペア %d件, 暗号化データ %d件 (一致: %d, 不一致: %d, 拒否: %d, 不明なサーバー: %d)",
+				ServiceName, sum.Keys, sum.Ciphertexts, sum.Results[ResultMatch], sum.Results[ResultMismatch],
+				sum.Results[ResultRejected], sum.Results[ResultUnknownService])
+			if cfg.Interval == 0 {
+				if sum.Failed() {
+					return fmt.Errorf("暗号化データの形式の後方互換性が壊れています（不一致: %d, 拒否: %d）",
+						sum.Results[ResultMismatch], sum.Results[ResultRejected])
+				}
+				return nil
+			}
+		}
+		time.Sleep(cfg.Interval)
+	}
+}
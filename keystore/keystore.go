@@ -0,0 +1,198 @@
+// Package keystore はサーバーの長期鍵（staticモードの鍵ペア）を外部のシークレットストアに保存し、
+// 再起動や複数のレプリカでも同じ鍵を使えるようにする
+//
+// 現在の実装はHashiCorp VaultのKVシークレットエンジン（v2）で、トークンの有効期限が近づくと自動で更新する。
+// 鍵の読み書きとトークンの更新にかかった時間と失敗を記録する
+package keystore
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// サービス名（メトリクスのserviceラベル）
+const ServiceName = "key-store"
+
+var factory = metrics.NewFactory(ServiceName, "key_store_")
+
+// 保存先の種類
+const BackendVault = "vault"
+
+// 操作の種類（メトリクスのoperationラベル）
+const (
+	OperationLoad  = "load"
+	OperationSave  = "save"
+	OperationRenew = "renew"
+)
+
+// 保存した鍵がない
+var ErrNotFound = errors.New("保存した鍵がありません")
+
+var (
+	requestDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "key_store_request_duration_seconds",
+			Help:    "Duration of a request to the secret store including the network round trip in seconds, by backend and operation (load, save, renew)",
+			Buckets: []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+		},
+		[]string{"backend", "operation"},
+	)
+	requestFailures = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "key_store_request_failures_total",
+			Help: "Total number of failed requests to the secret store, by backend and operation",
+		},
+		[]string{"backend", "operation"},
+	)
+	keysLoaded = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "key_store_keys_loaded_total",
+			Help: "Total number of server keys looked up in the secret store at startup, by origin service and result (found, not_found, expired, invalid)",
+		},
+		[]string{"origin_service", "result"},
+	)
+	tokenTTL = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "key_store_token_ttl_seconds",
+			Help: "Remaining lifetime of the secret store token in seconds after the last lookup or renewal (0 for tokens that do not expire)",
+		},
+		[]string{"backend"},
+	)
+)
+
+// 保存する鍵ペア
+type StoredKey struct {
+	KeyID      string
+	Algorithm  string // 例: RSA-2048、ML-KEM-768
+	PrivateKey []byte // RSAはPKCS#8 DER、ML-KEMはcirclのバイナリ形式
+	PublicKey  []byte
+	CreatedAt  time.Time
+}
+
+// 鍵ペアの保存先
+type Store interface {
+	Name() string
+	Load(ctx context.Context, name string) (*StoredKey, error) // 保存した鍵がない場合はErrNotFound
+	Save(ctx context.Context, name string, key StoredKey) error
+	Close() error // トークンの自動更新を止める
+}
+
+// 保存先の設定（空の項目は環境変数から読む）
+type Config struct {
+	Backend string        // vault（空の場合は保存しない）
+	Address string        // VaultのURL（VAULT_ADDR）
+	Token   string        // Vaultのトークン（VAULT_TOKEN）
+	Mount   string        // KVシークレットエンジン（v2）のマウントパス
+	Path    string        // 鍵を保存するパスの接頭辞（<Path>/<サービス名>に保存する）
+	Timeout time.Duration // 1回の要求のタイムアウト
+}
+
+// デフォルト設定（保存しない）
+func DefaultConfig() Config {
+	return Config{Mount: "secret", Path: "pqc-grafana/keys", Timeout: 5 * time.Second}
+}
+
+// フラグを登録する（トークンは環境変数から読む）
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Backend, "key-store", c.Backend, "staticモードの長期鍵を保存するシークレットストア（vault、空の場合はメモリのみ、トークンはVAULT_TOKEN）")
+	fs.StringVar(&c.Address, "key-store-addr", c.Address, "VaultのURL（空の場合はVAULT_ADDR）")
+	fs.StringVar(&c.Mount, "key-store-mount", c.Mount, "VaultのKVシークレットエンジン（v2）のマウントパス")
+	fs.StringVar(&c.Path, "key-store-path", c.Path, "鍵を保存するパスの接頭辞（<接頭辞>/<サービス名>に保存する）")
+	fs.DurationVar(&c.Timeout, "key-store-timeout", c.Timeout, "シークレットストアへの1回の要求のタイムアウト")
+}
+
+// 設定から保存先を作る（保存しない設定の場合はnil）
+func New(cfg Config) (Store, error) {
+	switch cfg.Backend {
+	case "":
+		return nil, nil
+	case BackendVault:
+		if cfg.Address == "" {
+			cfg.Address = os.Getenv("VAULT_ADDR")
+		}
+		if cfg.Token == "" {
+			cfg.Token = os.Getenv("VAULT_TOKEN")
+		}
+		if cfg.Timeout <= 0 {
+			cfg.Timeout = DefaultConfig().Timeout
+		}
+		v, err := newVault(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("不明な鍵の保存先: %q（vault）", cfg.Backend)
+}
+
+// 起動時に保存した鍵を読み込む時間の上限
+const startupTimeout = 10 * time.Second
+
+// 起動時にserviceの保存した長期鍵を読み込み、useで使用中の鍵ペアにする（storeがnilの場合は何もしない）
+// 鍵がない、有効期限（lifetime、0の場合は期限なし）を過ぎている、useが読み込めない場合は最初のリクエストで新しく生成させる
+func LoadStartup(store Store, service string, lifetime time.Duration, use func(StoredKey) error) {
+	if store == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), startupTimeout)
+	defer cancel()
+	stored, err := store.Load(ctx, service)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		observeLoad(service, "not_found")
+		log.Printf("保存した鍵がないため、新しい鍵ペアを生成して%sに保存します", store.Name())
+		return
+	case err != nil:
+		observeLoad(service, "invalid")
+		log.Println("保存した鍵の読み込みエラー（新しい鍵ペアを生成します）:", err)
+		return
+	}
+	defer cryptoutil.Zeroize(stored.PrivateKey)
+	// 有効期限を過ぎた鍵は秘密鍵を展開せずに捨てる
+	if lifetime > 0 && time.Since(stored.CreatedAt) >= lifetime {
+		observeLoad(service, "expired")
+		log.Printf("保存した鍵 %s は有効期限を過ぎているため、新しい鍵ペアを生成します", stored.KeyID)
+		return
+	}
+	if err := use(*stored); err != nil {
+		observeLoad(service, "invalid")
+		log.Println("保存した鍵を読み込めません（新しい鍵ペアを生成します）:", err)
+		return
+	}
+	observeLoad(service, "found")
+	log.Printf("保存した鍵 %s を%sから読み込みました (作成: %s)", stored.KeyID, store.Name(), stored.CreatedAt.Format(time.RFC3339))
+}
+
+// 生成したserviceの長期鍵を保存する（storeがnilの場合は何もしない、失敗してもメモリの鍵で続ける）
+func SaveGenerated(store Store, service string, key StoredKey) {
+	if store == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), startupTimeout)
+	defer cancel()
+	if err := store.Save(ctx, service, key); err != nil {
+		log.Println("鍵の保存エラー（再起動すると鍵が変わります）:", err)
+	}
+}
+
+// 起動時に保存した鍵を探した結果を記録する
+func observeLoad(service, result string) {
+	keysLoaded.WithLabelValues(service, result).Inc()
+}
+
+// 要求の所要時間と失敗を記録する
+func observe(backend, operation string, start time.Time, err error) {
+	requestDuration.WithLabelValues(backend, operation).Observe(time.Since(start).Seconds())
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		requestFailures.WithLabelValues(backend, operation).Inc()
+	}
+}
@@ -0,0 +1,79 @@
+package keystore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// メモリに保存する保存先
+type memoryStore struct {
+	keys map[string]StoredKey
+}
+
+func (m *memoryStore) Name() string { return "memory" }
+
+func (m *memoryStore) Load(ctx context.Context, name string) (*StoredKey, error) {
+	key, ok := m.keys[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	key.PrivateKey = append([]byte(nil), key.PrivateKey...)
+	return &key, nil
+}
+
+func (m *memoryStore) Save(ctx context.Context, name string, key StoredKey) error {
+	key.PrivateKey = append([]byte(nil), key.PrivateKey...)
+	m.keys[name] = key
+	return nil
+}
+
+func (m *memoryStore) Close() error { return nil }
+
+func TestLoadStartup(t *testing.T) {
+	const service = "keystore-test"
+	store := &memoryStore{keys: map[string]StoredKey{}}
+	tests := []struct {
+		name    string
+		saved   *StoredKey
+		useErr  error
+		result  string
+		wantUse bool
+	}{
+		{"not found", nil, nil, "not_found", false},
+		{"expired", &StoredKey{KeyID: "old", PrivateKey: []byte("secret"), CreatedAt: time.Now().Add(-2 * time.Hour)}, nil, "expired", false},
+		{"invalid", &StoredKey{KeyID: "bad", PrivateKey: []byte("secret"), CreatedAt: time.Now()}, errors.New("parse"), "invalid", true},
+		{"found", &StoredKey{KeyID: "k", PrivateKey: []byte("secret"), CreatedAt: time.Now()}, nil, "found", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.saved != nil {
+				SaveGenerated(store, service, *tt.saved)
+			}
+			counter := keysLoaded.WithLabelValues(service, tt.result)
+			before := testutil.ToFloat64(counter)
+			used := false
+			LoadStartup(store, service, time.Hour, func(key StoredKey) error {
+				used = true
+				if key.KeyID != tt.saved.KeyID || string(key.PrivateKey) != "secret" {
+					t.Errorf("読み込んだ鍵 = %+v", key)
+				}
+				return tt.useErr
+			})
+			if used != tt.wantUse {
+				t.Fatalf("use呼び出し = %v, want %v", used, tt.wantUse)
+			}
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Fatalf("key_store_keys_loaded_total{result=%q}の増加 = %v, want 1", tt.result, got)
+			}
+		})
+	}
+	LoadStartup(nil, service, 0, func(StoredKey) error {
+		t.Fatal("保存先がないのに呼び出されました")
+		return nil
+	})
+	SaveGenerated(nil, service, StoredKey{})
+}
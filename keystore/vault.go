@@ -0,0 +1,228 @@
+package keystore
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// トークンの更新を試みる間隔の下限（有効期限が短いトークンで要求を繰り返さない）
+const minRenewInterval = 10 * time.Second
+
+// VaultのKVシークレットエンジン（v2）
+type vault struct {
+	client  *http.Client
+	address string
+	mount   string
+	path    string
+	token   string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newVault(cfg Config) (*vault, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("-key-store-addr またはVAULT_ADDRでVaultのURLを指定してください")
+	}
+	if cfg.Token == "" {
+		return nil, errors.New("VAULT_TOKENでVaultのトークンを指定してください")
+	}
+	v := &vault{
+		client:  &http.Client{Timeout: cfg.Timeout},
+		address: strings.TrimRight(cfg.Address, "/"),
+		mount:   strings.Trim(cfg.Mount, "/"),
+		path:    strings.Trim(cfg.Path, "/"),
+		token:   cfg.Token,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	ttl, renewable, err := v.lookupToken()
+	if err != nil {
+		return nil, err
+	}
+	if renewable && ttl > 0 {
+		go v.renewLoop(ttl)
+	} else {
+		close(v.done)
+	}
+	return v, nil
+}
+
+func (v *vault) Name() string { return BackendVault }
+
+// 保存した鍵を読む
+func (v *vault) Load(ctx context.Context, name string) (key *StoredKey, err error) {
+	start := time.Now()
+	defer func() { observe(BackendVault, OperationLoad, start, err) }()
+	var resp struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	status, err := v.do(ctx, http.MethodGet, v.dataPath(name), nil, &resp)
+	if status == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeSecret(resp.Data.Data)
+}
+
+// 鍵を保存する（同じ名前の鍵は新しいバージョンとして上書きする）
+func (v *vault) Save(ctx context.Context, name string, key StoredKey) (err error) {
+	start := time.Now()
+	defer func() { observe(BackendVault, OperationSave, start, err) }()
+	body := map[string]any{"data": encodeSecret(key)}
+	_, err = v.do(ctx, http.MethodPost, v.dataPath(name), body, nil)
+	return err
+}
+
+// トークンの自動更新を止める
+func (v *vault) Close() error {
+	select {
+	case <-v.stop:
+	default:
+		close(v.stop)
+	}
+	<-v.done
+	return nil
+}
+
+// KV v2のデータのパス
+func (v *vault) dataPath(name string) string {
+	return "/v1/" + v.mount + "/data/" + v.path + "/" + name
+}
+
+// トークンの残りの有効期限と更新できるかを調べる
+func (v *vault) lookupToken() (ttl time.Duration, renewable bool, err error) {
+	var resp struct {
+		Data struct {
+			TTL       int64 `json:"ttl"`
+			Renewable bool  `json:"renewable"`
+		} `json:"data"`
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), v.client.Timeout)
+	defer cancel()
+	if _, err := v.do(ctx, http.MethodGet, "/v1/auth/token/lookup-self", nil, &resp); err != nil {
+		return 0, false, fmt.Errorf("Vaultのトークンの確認に失敗: %w", err)
+	}
+	ttl = time.Duration(resp.Data.TTL) * time.Second
+	tokenTTL.WithLabelValues(BackendVault).Set(ttl.Seconds())
+	return ttl, resp.Data.Renewable, nil
+}
+
+// 有効期限の半分が過ぎるごとにトークンを更新する
+// 失敗した場合は残りの有効期限の半分の時間をおいて再び試みる
+func (v *vault) renewLoop(ttl time.Duration) {
+	defer close(v.done)
+	for {
+		timer := time.NewTimer(max(ttl/2, minRenewInterval))
+		select {
+		case <-v.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		renewed, err := v.renewToken()
+		if err != nil {
+			log.Println("Vaultのトークンの更新に失敗しました:", err)
+			ttl /= 2
+			continue
+		}
+		ttl = renewed
+	}
+}
+
+// トークンを更新し、新しい有効期限を返す
+func (v *vault) renewToken() (ttl time.Duration, err error) {
+	start := time.Now()
+	defer func() { observe(BackendVault, OperationRenew, start, err) }()
+	var resp struct {
+		Auth struct {
+			LeaseDuration int64 `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), v.client.Timeout)
+	defer cancel()
+	if _, err = v.do(ctx, http.MethodPost, "/v1/auth/token/renew-self", map[string]any{}, &resp); err != nil {
+		return 0, err
+	}
+	ttl = time.Duration(resp.Auth.LeaseDuration) * time.Second
+	tokenTTL.WithLabelValues(BackendVault).Set(ttl.Seconds())
+	return ttl, nil
+}
+
+// VaultのAPIを呼び、200の場合はレスポンスをoutにデコードする（204など本文のないレスポンスも成功とする）
+func (v *vault) do(ctx context.Context, method, path string, body, out any) (int, error) {
+	var payload io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		payload = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, v.address+path, payload)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, fmt.Errorf("HTTPステータスエラー: %d: %s", resp.StatusCode, bytes.TrimSpace(data))
+	}
+	if out == nil || len(data) == 0 {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.Unmarshal(data, out)
+}
+
+// KVに保存する値（値はすべて文字列）
+func encodeSecret(key StoredKey) map[string]string {
+	return map[string]string{
+		"key_id":      key.KeyID,
+		"algorithm":   key.Algorithm,
+		"private_key": base64.StdEncoding.EncodeToString(key.PrivateKey),
+		"public_key":  base64.StdEncoding.EncodeToString(key.PublicKey),
+		"created_at":  key.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}
+}
+
+func decodeSecret(data map[string]string) (*StoredKey, error) {
+	key := &StoredKey{KeyID: data["key_id"], Algorithm: data["algorithm"]}
+	var err error
+	if key.PrivateKey, err = base64.StdEncoding.DecodeString(data["private_key"]); err != nil {
+		return nil, fmt.Errorf("保存した秘密鍵のデコードエラー: %w", err)
+	}
+	if key.PublicKey, err = base64.StdEncoding.DecodeString(data["public_key"]); err != nil {
+		return nil, fmt.Errorf("保存した公開鍵のデコードエラー: %w", err)
+	}
+	if key.CreatedAt, err = time.Parse(time.RFC3339Nano, data["created_at"]); err != nil {
+		return nil, fmt.Errorf("保存した鍵の作成時刻のデコードエラー: %w", err)
+	}
+	if key.KeyID == "" || len(key.PrivateKey) == 0 {
+		return nil, errors.New("保存した鍵の形式が不正です")
+	}
+	return key, nil
+}
@@ -0,0 +1,182 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AWS KMSの非対称鍵（KeySpecがRSA_2048などで、用途がENCRYPT_DECRYPTのもの）
+// SDKを使わず、JSONのAPIを署名バージョン4で署名して直接呼ぶ
+type awsKMS struct {
+	client   *http.Client
+	endpoint string
+	region   string
+	key      string
+	creds    awsCredentials
+
+	mu    sync.Mutex
+	keyID string // GetPublicKeyが返した鍵のARN
+}
+
+// AWSの認証情報
+type awsCredentials struct {
+	accessKeyID, secretAccessKey, sessionToken string
+}
+
+func newAWSKMS(cfg Config, client *http.Client) (*awsKMS, error) {
+	if cfg.Region == "" {
+		return nil, errors.New("-kms-region またはAWS_REGIONでリージョンを指定してください")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("AWS_ACCESS_KEY_IDとAWS_SECRET_ACCESS_KEYで認証情報を指定してください")
+	}
+	endpoint := cfg.Address
+	if endpoint == "" {
+		endpoint = "https://kms." + cfg.Region + ".amazonaws.com/"
+	}
+	return &awsKMS{
+		client:   client,
+		endpoint: endpoint,
+		region:   cfg.Region,
+		key:      cfg.Key,
+		creds:    awsCredentials{cfg.AccessKeyID, cfg.SecretAccessKey, cfg.SessionToken},
+	}, nil
+}
+
+func (a *awsKMS) Name() string { return BackendAWSKMS }
+
+func (a *awsKMS) KeyID() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.keyID == "" {
+		return a.key
+	}
+	return a.keyID
+}
+
+// 公開鍵を取得する（GetPublicKey）
+func (a *awsKMS) PublicKey(ctx context.Context) (key *rsa.PublicKey, err error) {
+	start := time.Now()
+	defer func() { observe(BackendAWSKMS, OperationPublicKey, start, err) }()
+	var resp struct {
+		KeyId     string `json:"KeyId"`
+		KeySpec   string `json:"KeySpec"`
+		PublicKey []byte `json:"PublicKey"` // JSONではBase64
+	}
+	if err = a.do(ctx, "GetPublicKey", map[string]string{"KeyId": a.key}, &resp); err != nil {
+		return nil, err
+	}
+	if key, err = parseRSAPublicKey(resp.PublicKey); err != nil {
+		return nil, fmt.Errorf("%s（KeySpec=%s）", err, resp.KeySpec)
+	}
+	a.mu.Lock()
+	a.keyID = resp.KeyId
+	a.mu.Unlock()
+	return key, nil
+}
+
+// RSAES_OAEP_SHA_256で復号する（Decrypt）
+func (a *awsKMS) Decrypt(ctx context.Context, ciphertext []byte) (plaintext []byte, err error) {
+	start := time.Now()
+	defer func() { observe(BackendAWSKMS, OperationDecrypt, start, err) }()
+	req := map[string]any{
+		"KeyId":               a.KeyID(),
+		"CiphertextBlob":      ciphertext,
+		"EncryptionAlgorithm": "RSAES_OAEP_SHA_256",
+	}
+	var resp struct {
+		Plaintext []byte `json:"Plaintext"`
+	}
+	if err = a.do(ctx, "Decrypt", req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Plaintext, nil
+}
+
+// KMSのAPIを呼ぶ（X-Amz-TargetでAPIを指定する）
+func (a *awsKMS) do(ctx context.Context, action string, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	signV4(req, payload, a.creds, a.region, "kms", time.Now())
+	if err := doJSON(a.client, req, out); err != nil {
+		return fmt.Errorf("AWS KMSの%sに失敗: %w", action, err)
+	}
+	return nil
+}
+
+// 要求に署名バージョン4の署名を付ける（クエリ文字列のない要求のみ）
+func signV4(req *http.Request, payload []byte, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	// 署名するヘッダー（小文字の名前の順）
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.secretAccessKey), date)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", creds.accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
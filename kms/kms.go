@@ -0,0 +1,191 @@
+// Package kms はRSAサーバーの秘密鍵の操作を外部の鍵管理サービス（Vault transit、AWS KMS）に委ねるバックエンドを提供する
+//
+// 公開鍵の取得とRSA-OAEP（SHA-256）の復号をネットワーク越しに行い、ネットワークを含む所要時間をバックエンドごとに記録する。
+// 組織で使われている管理された古典暗号の鍵の操作と、プロセス内で行うPQCの鍵の操作を同じ経路で比較するために使う
+package kms
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// サービス名（メトリクスのserviceラベル）
+const ServiceName = "kms"
+
+var factory = metrics.NewFactory(ServiceName, "kms_")
+
+// バックエンドの種類
+const (
+	BackendLocal  = "local"   // プロセス内の秘密鍵（KMSを使わない）
+	BackendVault  = "vault"   // HashiCorp Vaultのtransitシークレットエンジン
+	BackendAWSKMS = "aws-kms" // AWS KMSの非対称鍵（RSAES_OAEP_SHA_256）
+)
+
+// 操作の種類（メトリクスのoperationラベル）
+const (
+	OperationPublicKey = "public_key"
+	OperationDecrypt   = "decrypt"
+)
+
+var (
+	requestDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kms_request_duration_seconds",
+			Help:    "Duration of a request to the external KMS including the network round trip in seconds, by backend and operation",
+			Buckets: []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1},
+		},
+		[]string{"backend", "operation"},
+	)
+	requestsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kms_requests_total",
+			Help: "Total number of requests to the external KMS, by backend, operation and result (success, error)",
+		},
+		[]string{"backend", "operation", "result"},
+	)
+)
+
+// 外部の鍵管理サービスのRSA鍵
+type Backend interface {
+	Name() string  // バックエンドの種類（vault / aws-kms）
+	KeyID() string // 復号時に指定する鍵ID（PublicKeyを呼んだ後に確定する）
+	PublicKey(ctx context.Context) (*rsa.PublicKey, error)
+	Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) // RSA-OAEP（SHA-256）で復号する
+}
+
+// バックエンドの設定（空の項目は環境変数から読む）
+type Config struct {
+	Backend string        // vault / aws-kms（空またはlocalの場合はKMSを使わない）
+	Address string        // VaultのURL（VAULT_ADDR）、AWS KMSのエンドポイント（空の場合はリージョンから決める）
+	Key     string        // Vault transitの鍵の名前、AWS KMSの鍵ID・ARN・エイリアス
+	Timeout time.Duration // 1回の要求のタイムアウト
+
+	VaultToken string // Vaultのトークン（VAULT_TOKEN）
+	VaultMount string // transitシークレットエンジンのマウントパス（空の場合はtransit）
+
+	Region          string // AWSのリージョン（AWS_REGION）
+	AccessKeyID     string // AWS_ACCESS_KEY_ID
+	SecretAccessKey string // AWS_SECRET_ACCESS_KEY
+	SessionToken    string // AWS_SESSION_TOKEN（一時的な認証情報の場合）
+}
+
+// デフォルト設定（KMSを使わない）
+func DefaultConfig() Config {
+	return Config{Timeout: 5 * time.Second, VaultMount: "transit"}
+}
+
+// フラグを登録する（認証情報は環境変数から読む）
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Backend, "kms", c.Backend, "RSA-OAEPの復号を委ねる外部の鍵管理サービス（vault / aws-kms、空の場合はプロセス内の秘密鍵、認証情報はVAULT_TOKENまたはAWS_ACCESS_KEY_IDなどの環境変数）")
+	fs.StringVar(&c.Address, "kms-addr", c.Address, "VaultのURL（空の場合はVAULT_ADDR）またはAWS KMSのエンドポイント（空の場合はリージョンから決める）")
+	fs.StringVar(&c.Key, "kms-key", c.Key, "Vault transitの鍵の名前（rsa-2048など）またはAWS KMSの鍵ID・ARN・エイリアス（RSA_2048など、用途はENCRYPT_DECRYPT）")
+	fs.StringVar(&c.VaultMount, "kms-vault-mount", c.VaultMount, "Vaultのtransitシークレットエンジンのマウントパス")
+	fs.StringVar(&c.Region, "kms-region", c.Region, "AWS KMSのリージョン（空の場合はAWS_REGION）")
+	fs.DurationVar(&c.Timeout, "kms-timeout", c.Timeout, "外部の鍵管理サービスへの1回の要求のタイムアウト")
+}
+
+// KMSを使うか
+func (c Config) Enabled() bool {
+	return c.Backend != "" && c.Backend != BackendLocal
+}
+
+// 空の項目を環境変数で補う
+func (c *Config) fromEnv() {
+	fill := func(v *string, env string) {
+		if *v == "" {
+			*v = os.Getenv(env)
+		}
+	}
+	switch c.Backend {
+	case BackendVault:
+		fill(&c.Address, "VAULT_ADDR")
+		fill(&c.VaultToken, "VAULT_TOKEN")
+	case BackendAWSKMS:
+		fill(&c.Region, "AWS_REGION")
+		fill(&c.AccessKeyID, "AWS_ACCESS_KEY_ID")
+		fill(&c.SecretAccessKey, "AWS_SECRET_ACCESS_KEY")
+		fill(&c.SessionToken, "AWS_SESSION_TOKEN")
+	}
+}
+
+// 設定からバックエンドを作る（KMSを使わない設定の場合はnil）
+func New(cfg Config) (Backend, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	cfg.fromEnv()
+	if cfg.Key == "" {
+		return nil, errors.New("-kms-key で鍵を指定してください")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultConfig().Timeout
+	}
+	client := &http.Client{Timeout: cfg.Timeout}
+	var backend Backend
+	var err error
+	switch cfg.Backend {
+	case BackendVault:
+		backend, err = newVault(cfg, client)
+	case BackendAWSKMS:
+		backend, err = newAWSKMS(cfg, client)
+	default:
+		err = fmt.Errorf("不明な鍵管理サービス: %q（vault / aws-kms）", cfg.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return backend, nil
+}
+
+// 要求の所要時間と結果を記録する
+func observe(backend, operation string, start time.Time, err error) {
+	requestDuration.WithLabelValues(backend, operation).Observe(time.Since(start).Seconds())
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	requestsTotal.WithLabelValues(backend, operation, result).Inc()
+}
+
+// JSONを送り、200の場合はレスポンスをoutにデコードする
+func doJSON(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTPステータスエラー: %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return json.Unmarshal(body, out)
+}
+
+// PKIX DERのRSA公開鍵をパースする
+func parseRSAPublicKey(der []byte) (*rsa.PublicKey, error) {
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("公開鍵のパースエラー: %w", err)
+	}
+	key, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("RSA公開鍵ではありません")
+	}
+	return key, nil
+}
@@ -0,0 +1,129 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Vaultのtransitシークレットエンジンの鍵（type=rsa-2048などで作成したもの）
+// transitのRSA鍵の復号は既定でOAEP（SHA-256）のため、クライアントが公開鍵で暗号化した値をそのまま渡せる
+type vault struct {
+	client  *http.Client
+	address string
+	mount   string
+	key     string
+	token   string
+
+	mu      sync.Mutex
+	version int // 公開鍵を取得した鍵のバージョン
+}
+
+func newVault(cfg Config, client *http.Client) (*vault, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("-kms-addr またはVAULT_ADDRでVaultのURLを指定してください")
+	}
+	if cfg.VaultToken == "" {
+		return nil, errors.New("VAULT_TOKENでVaultのトークンを指定してください")
+	}
+	mount := strings.Trim(cfg.VaultMount, "/")
+	if mount == "" {
+		mount = "transit"
+	}
+	return &vault{client: client, address: strings.TrimRight(cfg.Address, "/"), mount: mount, key: cfg.Key, token: cfg.VaultToken}, nil
+}
+
+func (v *vault) Name() string { return BackendVault }
+
+func (v *vault) KeyID() string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return fmt.Sprintf("vault:%s:v%d", v.key, v.version)
+}
+
+// 最新のバージョンの公開鍵を取得する
+func (v *vault) PublicKey(ctx context.Context) (key *rsa.PublicKey, err error) {
+	start := time.Now()
+	defer func() { observe(BackendVault, OperationPublicKey, start, err) }()
+	var resp struct {
+		Data struct {
+			Type          string `json:"type"`
+			LatestVersion int    `json:"latest_version"`
+			Keys          map[string]struct {
+				PublicKey string `json:"public_key"`
+			} `json:"keys"`
+		} `json:"data"`
+	}
+	if err = v.do(ctx, http.MethodGet, "keys", nil, &resp); err != nil {
+		return nil, err
+	}
+	latest, ok := resp.Data.Keys[strconv.Itoa(resp.Data.LatestVersion)]
+	if !ok {
+		return nil, fmt.Errorf("鍵のバージョン%dの公開鍵がありません（type=%s）", resp.Data.LatestVersion, resp.Data.Type)
+	}
+	block, _ := pem.Decode([]byte(latest.PublicKey))
+	if block == nil {
+		return nil, fmt.Errorf("公開鍵のPEMデコードエラー（type=%s）", resp.Data.Type)
+	}
+	if key, err = parseRSAPublicKey(block.Bytes); err != nil {
+		return nil, err
+	}
+	v.mu.Lock()
+	v.version = resp.Data.LatestVersion
+	v.mu.Unlock()
+	return key, nil
+}
+
+// 公開鍵を取得したバージョンの鍵で復号する
+func (v *vault) Decrypt(ctx context.Context, ciphertext []byte) (plaintext []byte, err error) {
+	start := time.Now()
+	defer func() { observe(BackendVault, OperationDecrypt, start, err) }()
+	v.mu.Lock()
+	version := v.version
+	v.mu.Unlock()
+	req := map[string]string{"ciphertext": fmt.Sprintf("vault:v%d:%s", version, base64.StdEncoding.EncodeToString(ciphertext))}
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err = v.do(ctx, http.MethodPost, "decrypt", req, &resp); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+}
+
+// transitのAPI（/v1/<mount>/<op>/<key>）を呼ぶ
+func (v *vault) do(ctx context.Context, method, op string, body, out any) error {
+	endpoint := v.address + "/v1/" + v.mount + "/" + op + "/" + url.PathEscape(v.key)
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if err := doJSON(v.client, req, out); err != nil {
+		return fmt.Errorf("Vault transitの%sに失敗: %w", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ヒストグラムのバケットを上書きするフラグ
+const bucketsFlag = "metric-buckets"
+
+// メトリクス名ごとのバケットの上書き
+// 遅い環境（Raspberry Piなど）でコード上のバケットの上限を超え、パーセンタイルが正しく求められない場合に使う
+var bucketOverrides struct {
+	sync.Mutex
+	buckets map[string][]float64 // 境界の一覧
+	scales  map[string]float64   // コード上の境界に掛ける倍率
+}
+
+// ヒストグラムはパッケージの初期化時に作成されるため、フラグの解析を待たずに
+// 環境変数METRICS_BUCKETSとコマンドラインの -metric-buckets をここで読み込む
+// フラグはflag.CommandLineにも登録し、-helpに表示されflag.Parseでエラーにならないようにする
+func init() {
+	if env := os.Getenv("METRICS_BUCKETS"); env != "" {
+		for _, spec := range strings.Split(env, ";") {
+			if err := SetBuckets(spec); err != nil {
+				panic("metrics: 環境変数METRICS_BUCKETSの形式が不正です: " + err.Error())
+			}
+		}
+	}
+	for _, spec := range bucketArgs(os.Args[1:]) {
+		if err := SetBuckets(spec); err != nil {
+			panic("metrics: -" + bucketsFlag + "の形式が不正です: " + err.Error())
+		}
+	}
+	flag.Func(bucketsFlag, "ヒストグラムのバケットを上書きする（name=0.001,0.01,0.1,1 またはコード上の境界を10倍する name=*10、複数指定可、環境変数METRICS_BUCKETSでは;で区切る）", SetBuckets)
+}
+
+// コマンドラインから -metric-buckets の値を取り出す
+// ほかのフラグの値の個数は分からないため、すべての引数を調べる
+func bucketArgs(args []string) []string {
+	var specs []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			break
+		}
+		if !strings.HasPrefix(args[i], "-") {
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if name != bucketsFlag {
+			continue
+		}
+		if !ok && i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+		specs = append(specs, value)
+	}
+	return specs
+}
+
+// "name=b1,b2,..." または "name=*倍率" 形式でヒストグラムのバケットを上書きする
+// nameはコード上のメトリクス名（接頭辞を置き換える前の名前、例: mlkem_server_key_generation_duration_seconds）
+// 作成済みのヒストグラムには反映されない
+func SetBuckets(spec string) error {
+	name, value, ok := strings.Cut(spec, "=")
+	if !ok || name == "" || value == "" {
+		return fmt.Errorf("バケットの形式が不正です: %q (name=b1,b2,... または name=*倍率)", spec)
+	}
+	bucketOverrides.Lock()
+	defer bucketOverrides.Unlock()
+	if bucketOverrides.buckets == nil {
+		bucketOverrides.buckets = make(map[string][]float64)
+		bucketOverrides.scales = make(map[string]float64)
+	}
+
+	if factor, ok := strings.CutPrefix(value, "*"); ok {
+		scale, err := strconv.ParseFloat(factor, 64)
+		if err != nil || scale <= 0 {
+			return fmt.Errorf("バケットの倍率が不正です: %q", factor)
+		}
+		bucketOverrides.scales[name] = scale
+		delete(bucketOverrides.buckets, name)
+		return nil
+	}
+
+	var buckets []float64
+	for _, s := range strings.Split(value, ",") {
+		b, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			return fmt.Errorf("バケットの境界が不正です: %q", s)
+		}
+		buckets = append(buckets, b)
+	}
+	if !sort.Float64sAreSorted(buckets) {
+		return fmt.Errorf("バケットの境界は昇順で指定してください: %q", value)
+	}
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] == buckets[i-1] {
+			return fmt.Errorf("バケットの境界が重複しています: %v", buckets[i])
+		}
+	}
+	bucketOverrides.buckets[name] = buckets
+	delete(bucketOverrides.scales, name)
+	return nil
+}
+
+// 上書きされたバケットをヒストグラムの設定に反映する
+func withBuckets(opts prometheus.HistogramOpts) prometheus.HistogramOpts {
+	bucketOverrides.Lock()
+	defer bucketOverrides.Unlock()
+	if buckets, ok := bucketOverrides.buckets[opts.Name]; ok {
+		opts.Buckets = buckets
+		return opts
+	}
+	if scale, ok := bucketOverrides.scales[opts.Name]; ok {
+		base := opts.Buckets
+		if base == nil {
+			base = prometheus.DefBuckets
+		}
+		opts.Buckets = make([]float64, len(base))
+		for i, b := range base {
+			opts.Buckets[i] = b * scale
+		}
+	}
+	return opts
+}
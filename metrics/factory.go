@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// サービスごとのメトリクス名の接頭辞
+var prefixes struct {
+	sync.RWMutex
+	defaults  map[string]string // service → コード上の接頭辞（例: aes-client → client_）
+	overrides map[string]string // service → 上書きした接頭辞
+	namespace string            // すべての接頭辞の前に付ける名前空間
+}
+
+// メトリクス名として使える接頭辞
+var validPrefix = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// サービスのメトリクスを登録するFactoryを作成する
+// すべてのメトリクスにserviceラベルを付与し、名前はprefixで始める
+// ヒストグラムはEnableNativeHistogramsでネイティブヒストグラムとしても公開できる
+// 接頭辞はSetPrefixとSetNamespaceで/metricsの出力時に置き換えられるため、
+// 複数のインスタンスやフォークが同じPrometheusに系列を書き込んでも衝突しない
+func NewFactory(service, prefix string) Factory {
+	prefixes.Lock()
+	defer prefixes.Unlock()
+	if prefixes.defaults == nil {
+		prefixes.defaults = make(map[string]string)
+		prefixes.overrides = make(map[string]string)
+	}
+	if _, ok := prefixes.defaults[service]; ok {
+		panic(fmt.Sprintf("metrics: サービス %q のFactoryは作成済みです", service))
+	}
+	prefixes.defaults[service] = prefix
+	return Factory{Factory: promauto.With(prometheus.WrapRegistererWith(
+		prometheus.Labels{"service": service},
+		registry,
+	)), service: service}
+}
+
+// サービスのメトリクス名の接頭辞を上書きする
+func SetPrefix(service, prefix string) error {
+	if !validPrefix.MatchString(prefix) {
+		return fmt.Errorf("メトリクス名に使えない接頭辞です: %q", prefix)
+	}
+	prefixes.Lock()
+	defer prefixes.Unlock()
+	if _, ok := prefixes.defaults[service]; !ok {
+		return fmt.Errorf("不明なサービス: %q (%s)", service, strings.Join(servicesLocked(), " / "))
+	}
+	prefixes.overrides[service] = prefix
+	return nil
+}
+
+// "service=prefix" 形式の文字列で接頭辞を上書きする（flag.Funcで使う）
+func ParsePrefix(s string) error {
+	service, prefix, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("接頭辞の形式が不正です: %q (service=prefix)", s)
+	}
+	return SetPrefix(service, prefix)
+}
+
+// すべてのサービスのメトリクス名の前に "namespace_" を付ける
+func SetNamespace(namespace string) error {
+	if namespace != "" && !validPrefix.MatchString(namespace) {
+		return fmt.Errorf("メトリクス名に使えない名前空間です: %q", namespace)
+	}
+	prefixes.Lock()
+	defer prefixes.Unlock()
+	prefixes.namespace = namespace
+	return nil
+}
+
+func servicesLocked() []string {
+	var services []string
+	for s := range prefixes.defaults {
+		services = append(services, s)
+	}
+	sort.Strings(services)
+	return services
+}
+
+// コード上のメトリクス名を/metricsで公開する名前に変換する（SetPrefixとSetNamespaceを反映する）
+// レコーディングルールなど、メトリクス名を参照する設定の生成に使う
+func Name(name string) string {
+	return rename(name)
+}
+
+// メトリクス名の接頭辞を置き換える（Factoryで登録されていないメトリクスはそのまま）
+func rename(name string) string {
+	prefixes.RLock()
+	defer prefixes.RUnlock()
+	service, prefix := "", ""
+	for s, p := range prefixes.defaults {
+		if strings.HasPrefix(name, p) && len(p) > len(prefix) {
+			service, prefix = s, p
+		}
+	}
+	if service == "" {
+		return name
+	}
+	if p, ok := prefixes.overrides[service]; ok {
+		name = p + strings.TrimPrefix(name, prefix)
+	}
+	if prefixes.namespace != "" {
+		name = prefixes.namespace + "_" + name
+	}
+	return name
+}
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 待ち受けたリクエストのアドレスファミリー（IPv6ではPQCの大きな公開鍵や暗号文の分割のされ方が異なる）
+var listenerRequestsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "pqc_listener_requests_total",
+		Help: "Total number of HTTP requests accepted by the process, by listen address and address family (ipv4, ipv6, unix)",
+	},
+	[]string{"listen_address", "family"},
+)
+
+// アドレスファミリー
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+	FamilyUnix = "unix"
+)
+
+// 待ち受けアドレスをネットワークとアドレスに分ける
+// ":8080"（IPv4とIPv6の両方）、"0.0.0.0:8080"、"[::1]:8080"、"tcp4::8080"・"tcp6::8080"（アドレスファミリーを限定）、
+// "unix:/path/to.sock"（Unixドメインソケット）を指定できる
+func ParseListenAddr(addr string) (network, address string) {
+	for _, n := range []string{"tcp4", "tcp6", "unix"} {
+		if rest, ok := strings.CutPrefix(addr, n+":"); ok {
+			return n, rest
+		}
+	}
+	return "tcp", addr
+}
+
+// 待ち受けを始める（形式はParseListenAddr）
+// Unixドメインソケットの場合は、前回の実行で残ったソケットファイルを削除してから作る
+func Listen(addr string) (net.Listener, error) {
+	network, address := ParseListenAddr(addr)
+	if network == "unix" {
+		if info, err := os.Stat(address); err == nil && info.Mode().Type() == fs.ModeSocket {
+			os.Remove(address)
+		}
+	}
+	return net.Listen(network, address)
+}
+
+// ネットワークのアドレスのアドレスファミリー（IPv4射影アドレスはIPv4）
+func AddressFamily(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.UnixAddr:
+		return FamilyUnix
+	case *net.TCPAddr:
+		return ipFamily(a.IP)
+	case *net.UDPAddr:
+		return ipFamily(a.IP)
+	}
+	if addr == nil {
+		return FamilyUnix
+	}
+	return hostFamily(addr.String())
+}
+
+func hostFamily(hostport string) string {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		// Unixドメインソケットの接続元のアドレスは空または"@"
+		return FamilyUnix
+	}
+	return ipFamily(net.ParseIP(host))
+}
+
+func ipFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return FamilyIPv4
+	}
+	return FamilyIPv6
+}
+
+// lnで受け付けたリクエストをアドレスファミリーごとに数えながらhandlerで処理する
+// handlerがnilの場合はhttp.DefaultServeMuxを使う
+func Serve(ln net.Listener, handler http.Handler) error {
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	listenAddr := ln.Addr().String()
+	unix := ln.Addr().Network() == "unix"
+	return http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		family := FamilyUnix
+		if !unix {
+			family = hostFamily(r.RemoteAddr)
+		}
+		listenerRequestsTotal.WithLabelValues(listenAddr, family).Inc()
+		handler.ServeHTTP(w, r)
+	}))
+}
+
+// アドレスを表示するためのURL（ポートだけを指定した場合はlocalhost）
+func DisplayURL(addr string) string {
+	network, address := ParseListenAddr(addr)
+	if network == "unix" {
+		return "unix:" + address
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "http://" + address
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
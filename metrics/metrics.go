@@ -0,0 +1,97 @@
+// Package metrics はすべてのサービスに共通するメトリクスの登録先と公開方法を提供する
+package metrics
+
+import (
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// すべてのメトリクスに付与するラベル（名前順）
+var runLabels atomic.Pointer[[]*dto.LabelPair]
+
+// 同時に動かす複数のベンチマークを1つのPrometheusで区別できるように、
+// すべてのメトリクスにrun_idとexperimentのラベルを付与する（空の値は付与しない）
+//
+// メトリクスはパッケージの初期化時に登録されるため、ラベルは登録時ではなく/metricsの出力時に付与する
+func SetRunLabels(runID, experiment string) {
+	var labels []*dto.LabelPair
+	if experiment != "" {
+		labels = append(labels, &dto.LabelPair{Name: stringPtr("experiment"), Value: stringPtr(experiment)})
+	}
+	if runID != "" {
+		labels = append(labels, &dto.LabelPair{Name: stringPtr("run_id"), Value: stringPtr(runID)})
+	}
+	runLabels.Store(&labels)
+}
+
+func stringPtr(s string) *string { return &s }
+
+// /metrics のハンドラー（Basic認証が設定されている場合は認証を要求する）
+func Handler() http.Handler {
+	return requireAuth(promhttp.InstrumentMetricHandler(
+		registry,
+		promhttp.HandlerFor(Gatherer(), promhttp.HandlerOpts{Registry: registry}),
+	))
+}
+
+// /metrics と同じ内容（名前の置き換えとrunLabelsの付与を行ったもの）を返すGatherer
+// 別のプログラムに組み込む場合は prometheus.Gatherers{自身のレジストリ, metrics.Gatherer()} として公開する
+func Gatherer() prometheus.Gatherer {
+	return gatherer{registry}
+}
+
+// 収集したメトリクスの名前の接頭辞を置き換え、runLabelsを追加するGatherer
+// ネイティブヒストグラムが無効な場合はその部分を取り除く
+type gatherer struct {
+	prometheus.Gatherer
+}
+
+func (g gatherer) Gather() ([]*dto.MetricFamily, error) {
+	runScrapeHooks()
+	families, err := g.Gatherer.Gather()
+	// セルフチェックは名前を置き換える前の値で行い、結果は次の取得時に公開される
+	now := time.Now()
+	observeFamilies(families, now)
+	recordSelfCheck(checkFamilies(families, now, DefaultStaleAfter))
+	var labels []*dto.LabelPair
+	if l := runLabels.Load(); l != nil {
+		labels = *l
+	}
+	native := nativeHistograms.Load()
+	for _, family := range families {
+		family.Name = stringPtr(rename(family.GetName()))
+		if !native {
+			stripNative(family)
+		}
+		if len(labels) == 0 {
+			continue
+		}
+		for _, m := range family.Metric {
+			m.Label = addLabels(m.Label, labels)
+		}
+	}
+	// 名前を置き換えると順序が変わるため並べ直す
+	sort.Slice(families, func(i, j int) bool { return families[i].GetName() < families[j].GetName() })
+	return families, err
+}
+
+// 既に同じ名前のラベルがある場合はメトリクス側の値を残す
+func addLabels(existing, labels []*dto.LabelPair) []*dto.LabelPair {
+	names := make(map[string]bool, len(existing))
+	for _, l := range existing {
+		names[l.GetName()] = true
+	}
+	for _, l := range labels {
+		if !names[l.GetName()] {
+			existing = append(existing, l)
+		}
+	}
+	sort.Slice(existing, func(i, j int) bool { return existing[i].GetName() < existing[j].GetName() })
+	return existing
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// ネイティブヒストグラムの解像度（バケットの境界が約1.1倍ずつ増える）とバケット数の上限
+const (
+	nativeBucketFactor     = 1.1
+	nativeMaxBucketNumber  = 160
+	nativeMinResetDuration = time.Hour
+)
+
+var nativeHistograms atomic.Bool
+
+// /metrics でネイティブヒストグラム（スパースなバケット）を公開する
+// Prometheusがprotobuf形式で取得した場合のみ出力され、テキスト形式では従来のバケットだけが出力される
+//
+// ヒストグラムはパッケージの初期化時に作成されるため、常にネイティブヒストグラムも記録しておき、
+// 有効にしていない場合は/metricsの出力時に取り除く
+func EnableNativeHistograms() {
+	nativeHistograms.Store(true)
+}
+
+// サービスのメトリクスを登録するFactory
+// ヒストグラムには上書きされたバケットとネイティブヒストグラムの設定を付与する
+// 登録したメトリクスの名前と型は/metrics/selfcheckで確認するために記録し、メトリクスはRegisterで他のレジストリにも登録できるように記録する
+type Factory struct {
+	promauto.Factory
+	service string
+}
+
+func (f Factory) NewCounter(opts prometheus.CounterOpts) prometheus.Counter {
+	register(f.service, prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), dto.MetricType_COUNTER)
+	c := f.Factory.NewCounter(opts)
+	track(f.service, c)
+	return c
+}
+
+func (f Factory) NewCounterVec(opts prometheus.CounterOpts, labelNames []string) *prometheus.CounterVec {
+	register(f.service, prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), dto.MetricType_COUNTER)
+	c := f.Factory.NewCounterVec(opts, labelNames)
+	track(f.service, c)
+	return c
+}
+
+func (f Factory) NewGauge(opts prometheus.GaugeOpts) prometheus.Gauge {
+	register(f.service, prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), dto.MetricType_GAUGE)
+	c := f.Factory.NewGauge(opts)
+	track(f.service, c)
+	return c
+}
+
+func (f Factory) NewGaugeVec(opts prometheus.GaugeOpts, labelNames []string) *prometheus.GaugeVec {
+	register(f.service, prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), dto.MetricType_GAUGE)
+	c := f.Factory.NewGaugeVec(opts, labelNames)
+	track(f.service, c)
+	return c
+}
+
+func (f Factory) NewHistogram(opts prometheus.HistogramOpts) prometheus.Histogram {
+	register(f.service, prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), dto.MetricType_HISTOGRAM)
+	c := f.Factory.NewHistogram(withNative(withBuckets(opts)))
+	track(f.service, c)
+	return c
+}
+
+func (f Factory) NewHistogramVec(opts prometheus.HistogramOpts, labelNames []string) *prometheus.HistogramVec {
+	register(f.service, prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name), dto.MetricType_HISTOGRAM)
+	c := f.Factory.NewHistogramVec(withNative(withBuckets(opts)), labelNames)
+	track(f.service, c)
+	return c
+}
+
+func withNative(opts prometheus.HistogramOpts) prometheus.HistogramOpts {
+	if opts.NativeHistogramBucketFactor == 0 {
+		opts.NativeHistogramBucketFactor = nativeBucketFactor
+		opts.NativeHistogramMaxBucketNumber = nativeMaxBucketNumber
+		opts.NativeHistogramMinResetDuration = nativeMinResetDuration
+	}
+	return opts
+}
+
+// ネイティブヒストグラムの部分を取り除き、従来のヒストグラムだけにする
+func stripNative(family *dto.MetricFamily) {
+	if family.GetType() != dto.MetricType_HISTOGRAM {
+		return
+	}
+	for _, m := range family.Metric {
+		h := m.Histogram
+		if h == nil {
+			continue
+		}
+		h.Schema = nil
+		h.ZeroThreshold = nil
+		h.ZeroCount = nil
+		h.ZeroCountFloat = nil
+		h.NegativeSpan = nil
+		h.NegativeDelta = nil
+		h.NegativeCount = nil
+		h.PositiveSpan = nil
+		h.PositiveDelta = nil
+		h.PositiveCount = nil
+		h.Exemplars = nil
+	}
+}
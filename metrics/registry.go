@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// プロセスのすべてのメトリクスを登録するレジストリ
+// グローバルなDefaultRegistererを使わないため、依存ライブラリが登録したメトリクスは公開されない
+var registry = prometheus.NewRegistry()
+
+// Goランタイムとプロセスのメトリクス（go_*、process_*）
+var runtimeCollectors = []prometheus.Collector{
+	collectors.NewGoCollector(),
+	collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+}
+
+func init() {
+	registry.MustRegister(runtimeCollectors...)
+	registry.MustRegister(buildInfoGauge)
+	recordBuildInfo()
+	registry.MustRegister(binarySizeGauge, startupReadyGauge, startupFirstOperationGauge)
+	recordBinarySize()
+	registry.MustRegister(listenerRequestsTotal)
+	if auth := os.Getenv("METRICS_AUTH"); auth != "" {
+		if err := SetBasicAuth(auth); err != nil {
+			panic("metrics: 環境変数METRICS_AUTHの形式が不正です")
+		}
+	}
+}
+
+// Factoryで作成したメトリクス（サービスの順）
+var tracked struct {
+	sync.Mutex
+	services   []string
+	collectors map[string][]prometheus.Collector
+}
+
+func track(service string, c prometheus.Collector) {
+	tracked.Lock()
+	defer tracked.Unlock()
+	if tracked.collectors == nil {
+		tracked.collectors = make(map[string][]prometheus.Collector)
+	}
+	if _, ok := tracked.collectors[service]; !ok {
+		tracked.services = append(tracked.services, service)
+	}
+	tracked.collectors[service] = append(tracked.collectors[service], c)
+}
+
+// Factoryで作成したすべてのメトリクスをserviceラベルを付けてregにも登録する（組み込む側のレジストリで公開するため）
+// Goランタイム・プロセス・ビルド情報のメトリクスは組み込む側と重複するため登録しない
+// 接頭辞の上書き（SetPrefix・SetNamespace）とネイティブヒストグラムの除去は/metricsの出力時の処理のため反映されない
+func Register(reg prometheus.Registerer) error {
+	tracked.Lock()
+	defer tracked.Unlock()
+	for _, service := range tracked.services {
+		wrapped := prometheus.WrapRegistererWith(prometheus.Labels{"service": service}, reg)
+		for _, c := range tracked.collectors[service] {
+			if err := wrapped.Register(c); err != nil {
+				return fmt.Errorf("メトリクスの登録エラー (%s): %w", service, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Goランタイムとプロセスのメトリクスを公開しない（系列数を減らしたい場合）
+func DisableRuntimeCollectors() {
+	for _, c := range runtimeCollectors {
+		registry.Unregister(c)
+	}
+}
+
+// /metrics のBasic認証（ユーザー名とパスワードのSHA-256）
+type basicAuth struct {
+	user, password [sha256.Size]byte
+}
+
+var auth atomic.Pointer[basicAuth]
+
+// "user:password" 形式で/metricsにBasic認証を設定する
+func SetBasicAuth(s string) error {
+	user, password, ok := strings.Cut(s, ":")
+	if !ok || user == "" || password == "" {
+		return errors.New("Basic認証の形式が不正です (user:password)")
+	}
+	auth.Store(&basicAuth{user: sha256.Sum256([]byte(user)), password: sha256.Sum256([]byte(password))})
+	return nil
+}
+
+// Basic認証が設定されている場合は、資格情報を確認してからnextを呼び出す
+// 長さの違いが漏れないように、ハッシュ値どうしを定数時間で比較する
+func requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a := auth.Load()
+		if a == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, password, ok := r.BasicAuth()
+		userHash, passwordHash := sha256.Sum256([]byte(user)), sha256.Sum256([]byte(password))
+		if !ok ||
+			subtle.ConstantTimeCompare(userHash[:], a.user[:])&subtle.ConstantTimeCompare(passwordHash[:], a.password[:]) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+			http.Error(w, "認証が必要です", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,25 @@
+package metrics
+
+import "sync"
+
+var scrapeHooks struct {
+	sync.Mutex
+	hooks []func()
+}
+
+// /metrics が取得されるたびに、収集の直前にfを呼び出す
+// スクレイプの間に上書きされたゲージの値の数を数えるなど、取得の間隔に合わせた処理に使う
+func OnScrape(f func()) {
+	scrapeHooks.Lock()
+	defer scrapeHooks.Unlock()
+	scrapeHooks.hooks = append(scrapeHooks.hooks, f)
+}
+
+func runScrapeHooks() {
+	scrapeHooks.Lock()
+	hooks := scrapeHooks.hooks
+	scrapeHooks.Unlock()
+	for _, f := range hooks {
+		f()
+	}
+}
@@ -0,0 +1,261 @@
+package metrics
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// セルフチェックでのメトリクスファミリーの状態
+const (
+	StatusOK           = "ok"
+	StatusMissing      = "missing"       // 登録したが系列が1つもない（ラベルの値が一度も使われていない）
+	StatusStale        = "stale"         // カウンター・ヒストグラムの値がStaleAfterの間変わっていない
+	StatusTypeMismatch = "type_mismatch" // 登録した型と異なる型で公開されている
+)
+
+// 値が変わらない場合にstaleとするまでの時間の既定値
+const DefaultStaleAfter = 15 * time.Minute
+
+var (
+	selfCheckHealthy = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "pqc_metrics_selfcheck_healthy",
+			Help: "1 if every metric family registered through the factories is exposed with its registered type at the previous scrape, 0 otherwise",
+		},
+	)
+	selfCheckFamilies = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "pqc_metrics_selfcheck_families",
+			Help: "Number of registered metric families at the previous scrape, by status (ok, missing, stale, type_mismatch)",
+		},
+		[]string{"status"},
+	)
+	selfCheckLastUpdate = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "pqc_metrics_selfcheck_last_update_timestamp_seconds",
+			Help: "Unix time at which the values of the metric family were last seen changing, by exposed family name",
+		},
+		[]string{"family"},
+	)
+)
+
+func init() {
+	registry.MustRegister(selfCheckHealthy, selfCheckFamilies, selfCheckLastUpdate)
+}
+
+// Factoryで登録したメトリクスファミリーと、値の変化の記録
+var selfCheck struct {
+	sync.Mutex
+	registered map[string]registeredFamily // コード上の名前 → 登録内容
+	seen       map[string]familyState
+}
+
+type registeredFamily struct {
+	service string
+	typ     dto.MetricType
+}
+
+type familyState struct {
+	fingerprint uint64
+	series      int
+	lastUpdate  time.Time // 値が変わったのを最後に確認した時刻
+}
+
+// Factoryで作成したメトリクスの名前と型を記録する
+func register(service, name string, typ dto.MetricType) {
+	selfCheck.Lock()
+	defer selfCheck.Unlock()
+	if selfCheck.registered == nil {
+		selfCheck.registered = make(map[string]registeredFamily)
+		selfCheck.seen = make(map[string]familyState)
+	}
+	selfCheck.registered[name] = registeredFamily{service: service, typ: typ}
+}
+
+// 収集したメトリクスの値が前回から変わったかを記録する（名前の置き換え前に呼び出す）
+func observeFamilies(families []*dto.MetricFamily, now time.Time) {
+	selfCheck.Lock()
+	defer selfCheck.Unlock()
+	for _, family := range families {
+		name := family.GetName()
+		if _, ok := selfCheck.registered[name]; !ok {
+			continue
+		}
+		fp := fingerprint(family)
+		state, ok := selfCheck.seen[name]
+		if !ok || state.fingerprint != fp {
+			state.lastUpdate = now
+		}
+		state.fingerprint, state.series = fp, len(family.Metric)
+		selfCheck.seen[name] = state
+	}
+}
+
+// 系列のラベルと値（ヒストグラムは観測数と合計）のハッシュ
+func fingerprint(family *dto.MetricFamily) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	writeFloat := func(v float64) {
+		bits := math.Float64bits(v)
+		for i := range buf {
+			buf[i] = byte(bits >> (8 * i))
+		}
+		h.Write(buf[:])
+	}
+	for _, m := range family.Metric {
+		for _, l := range m.Label {
+			h.Write([]byte(l.GetName()))
+			h.Write([]byte(l.GetValue()))
+		}
+		switch {
+		case m.Counter != nil:
+			writeFloat(m.Counter.GetValue())
+		case m.Gauge != nil:
+			writeFloat(m.Gauge.GetValue())
+		case m.Histogram != nil:
+			writeFloat(float64(m.Histogram.GetSampleCount()))
+			writeFloat(m.Histogram.GetSampleSum())
+		case m.Summary != nil:
+			writeFloat(float64(m.Summary.GetSampleCount()))
+			writeFloat(m.Summary.GetSampleSum())
+		case m.Untyped != nil:
+			writeFloat(m.Untyped.GetValue())
+		}
+	}
+	return h.Sum64()
+}
+
+// メトリクスファミリーごとのセルフチェックの結果
+type FamilyCheck struct {
+	Name       string     `json:"name"` // /metricsで公開する名前
+	Service    string     `json:"service"`
+	Type       string     `json:"type"`                   // 登録した型
+	Exposed    string     `json:"exposed_type,omitempty"` // 公開されている型
+	Status     string     `json:"status"`                 // ok / missing / stale / type_mismatch
+	Series     int        `json:"series"`                 // 系列の数
+	LastUpdate *time.Time `json:"last_update,omitempty"`  // 値が変わったのを最後に確認した時刻
+	StaleFor   string     `json:"stale_for,omitempty"`    // 値が変わっていない時間（staleの場合）
+}
+
+// セルフチェックの結果
+type SelfCheckReport struct {
+	Healthy   bool           `json:"healthy"` // type_mismatchのファミリーがない
+	CheckedAt time.Time      `json:"checked_at"`
+	Counts    map[string]int `json:"counts"` // 状態ごとのファミリーの数
+	Families  []FamilyCheck  `json:"families"`
+}
+
+// Factoryで登録したすべてのメトリクスファミリーが公開されているか、登録した型か、値が更新されているかを確認する
+// missingとstaleは機能を有効にしていないサービスや、一度だけ設定する値でも起こるため、健全性には含めず、
+// ダッシュボードのパネルが空の場合に計装の不具合を探す手がかりとして使う
+func SelfCheck(staleAfter time.Duration) (SelfCheckReport, error) {
+	families, err := registry.Gather()
+	if err != nil {
+		return SelfCheckReport{}, err
+	}
+	now := time.Now()
+	observeFamilies(families, now)
+	return checkFamilies(families, now, staleAfter), nil
+}
+
+func checkFamilies(families []*dto.MetricFamily, now time.Time, staleAfter time.Duration) SelfCheckReport {
+	exposed := make(map[string]dto.MetricType, len(families))
+	for _, family := range families {
+		exposed[family.GetName()] = family.GetType()
+	}
+
+	selfCheck.Lock()
+	defer selfCheck.Unlock()
+	report := SelfCheckReport{Healthy: true, CheckedAt: now, Counts: map[string]int{
+		StatusOK: 0, StatusMissing: 0, StatusStale: 0, StatusTypeMismatch: 0,
+	}}
+	for name, r := range selfCheck.registered {
+		c := FamilyCheck{Name: rename(name), Service: r.service, Type: typeName(r.typ), Status: StatusOK}
+		typ, ok := exposed[name]
+		state := selfCheck.seen[name]
+		switch {
+		case !ok:
+			c.Status = StatusMissing
+		case typ != r.typ:
+			c.Status, c.Exposed = StatusTypeMismatch, typeName(typ)
+			report.Healthy = false
+		case (typ == dto.MetricType_COUNTER || typ == dto.MetricType_HISTOGRAM) && now.Sub(state.lastUpdate) > staleAfter:
+			c.Status, c.StaleFor = StatusStale, now.Sub(state.lastUpdate).Round(time.Second).String()
+		}
+		if ok {
+			c.Series = state.series
+			lastUpdate := state.lastUpdate
+			c.LastUpdate = &lastUpdate
+		}
+		report.Counts[c.Status]++
+		report.Families = append(report.Families, c)
+	}
+	sort.Slice(report.Families, func(i, j int) bool { return report.Families[i].Name < report.Families[j].Name })
+	return report
+}
+
+// セルフチェックの結果をメトリクスに記録する
+func recordSelfCheck(report SelfCheckReport) {
+	if report.Healthy {
+		selfCheckHealthy.Set(1)
+	} else {
+		selfCheckHealthy.Set(0)
+	}
+	for status, n := range report.Counts {
+		selfCheckFamilies.WithLabelValues(status).Set(float64(n))
+	}
+	for _, c := range report.Families {
+		if c.LastUpdate != nil {
+			selfCheckLastUpdate.WithLabelValues(c.Name).Set(float64(c.LastUpdate.Unix()))
+		}
+	}
+}
+
+func typeName(t dto.MetricType) string {
+	switch t {
+	case dto.MetricType_COUNTER:
+		return "counter"
+	case dto.MetricType_GAUGE:
+		return "gauge"
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		return "histogram"
+	case dto.MetricType_SUMMARY:
+		return "summary"
+	default:
+		return "untyped"
+	}
+}
+
+// GET /metrics/selfcheck のハンドラー（結果をJSONで返す）
+// クエリのstale（例: 5m、既定15分）でstaleとするまでの時間を指定する
+func SelfCheckHandler() http.Handler {
+	return requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		staleAfter := DefaultStaleAfter
+		if s := r.URL.Query().Get("stale"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				http.Error(w, "staleには正の時間を指定してください（例: 5m）", http.StatusBadRequest)
+				return
+			}
+			staleAfter = d
+		}
+		report, err := SelfCheck(staleAfter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	}))
+}
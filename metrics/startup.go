@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PQCのライブラリによるバイナリのサイズと、起動から使えるようになるまでの時間
+// サーバーレスやエッジでの実行ではコールドスタートとイメージのサイズに直結する
+var (
+	binarySizeGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "pqc_binary_size_bytes",
+			Help: "Size of the running executable in bytes",
+		},
+	)
+	startupReadyGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "pqc_startup_ready_seconds",
+			Help: "Time from process start until the binary started listening (ready) in seconds",
+		},
+	)
+	startupFirstOperationGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "pqc_startup_first_operation_seconds",
+			Help: "Time from process start until the first successful key exchange (decryption on servers, session on clients) in seconds",
+		},
+	)
+)
+
+// パッケージの初期化の時刻（プロセスの開始時刻を取得できない場合に使う）
+var initTime = time.Now()
+
+var (
+	readyOnce          sync.Once
+	firstOperationOnce sync.Once
+)
+
+func recordBinarySize() {
+	path, err := os.Executable()
+	if err != nil {
+		return
+	}
+	if info, err := os.Stat(path); err == nil {
+		binarySizeGauge.Set(float64(info.Size()))
+	}
+}
+
+// プロセスの開始からの時間（コンテナではコンテナの開始からの時間とほぼ等しい）
+func SinceProcessStart() time.Duration {
+	start, ok := processStartTime()
+	if !ok {
+		start = initTime
+	}
+	return time.Since(start)
+}
+
+// 起動が完了した（待ち受けを始めた）ことを記録する（2回目以降の呼び出しは無視する）
+func MarkReady() {
+	readyOnce.Do(func() { startupReadyGauge.Set(SinceProcessStart().Seconds()) })
+}
+
+// 最初の鍵交換が成功したことを記録する（2回目以降の呼び出しは無視する）
+func MarkFirstOperation() {
+	firstOperationOnce.Do(func() { startupFirstOperationGauge.Set(SinceProcessStart().Seconds()) })
+}
+
+// addrで待ち受けを始めた時点で起動完了を記録し、handlerでリクエストを処理する（addrの形式はParseListenAddr）
+func ListenAndServe(addr string, handler http.Handler) error {
+	ln, err := Listen(addr)
+	if err != nil {
+		return err
+	}
+	MarkReady()
+	return Serve(ln, handler)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package metrics
+
+import "time"
+
+// Linux以外ではプロセスの開始時刻を取得しない（パッケージの初期化の時刻で代用する）
+func processStartTime() (time.Time, bool) {
+	return time.Time{}, false
+}
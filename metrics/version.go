@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ビルド時に -ldflags で設定する値（設定しない場合はモジュールとVCSの情報から求める）
+//
+//	go build -ldflags "-X github.com/keyi1000/PQC_grafana/metrics.Version=v1.2.3 -X github.com/keyi1000/PQC_grafana/metrics.BuildDate=2026-01-01T00:00:00Z"
+var (
+	Version   string
+	BuildDate string
+)
+
+// 実行中のバイナリのビルド情報
+type BuildInfo struct {
+	Binary       string `json:"binary"`
+	Version      string `json:"version"`
+	Commit       string `json:"commit"`
+	BuildDate    string `json:"build_date"`
+	GoVersion    string `json:"go_version"`
+	CirclVersion string `json:"circl_version"`
+}
+
+const unknown = "unknown"
+
+// ビルド情報を返す
+func ReadBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Binary:       unknown,
+		Version:      Version,
+		Commit:       unknown,
+		BuildDate:    BuildDate,
+		GoVersion:    unknown,
+		CirclVersion: unknown,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Binary = path.Base(bi.Path)
+		info.GoVersion = bi.GoVersion
+		if info.Version == "" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Commit = s.Value
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value // ldflagsがない場合はコミット日時で代用する
+				}
+			}
+		}
+		for _, dep := range bi.Deps {
+			if dep.Path == "github.com/cloudflare/circl" {
+				info.CirclVersion = dep.Version
+				if dep.Replace != nil {
+					info.CirclVersion = dep.Replace.Version
+				}
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = unknown
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = unknown
+	}
+	return info
+}
+
+var buildInfoGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "pqc_build_info",
+		Help: "Build information of the running binary (always 1), by binary, version, commit, build date, Go version and circl version",
+	},
+	[]string{"binary", "version", "revision", "build_date", "goversion", "circl_version"},
+)
+
+func recordBuildInfo() {
+	info := ReadBuildInfo()
+	buildInfoGauge.WithLabelValues(info.Binary, info.Version, info.Commit, info.BuildDate, info.GoVersion, info.CirclVersion).Set(1)
+}
+
+// GET /version のハンドラー（ビルド情報をJSONで返す）
+func VersionHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ReadBuildInfo())
+	})
+}
@@ -0,0 +1,84 @@
+package mlkemserver
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+	"github.com/keyi1000/PQC_grafana/keyarchive"
+)
+
+// 保存する鍵の方式
+const archiveAlgorithm = "ML-KEM-768"
+
+// 生成した鍵ペアを保存する（保存先がない場合は何もしない）
+func (m *keyManager) archiveKey(key *keyPair) {
+	if m.archive == nil {
+		return
+	}
+	privateKey, publicKey, err := key.marshal()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	m.archive.StoreKey(ServiceName, key.id, archiveAlgorithm, privateKey, publicKey)
+}
+
+// 鍵ペアを保存する形式（circlのバイナリ形式）にエンコードする
+func (k *keyPair) marshal() (privateKey, publicKey []byte, err error) {
+	if privateKey, err = k.privateKey.MarshalBinary(); err != nil {
+		return nil, nil, fmt.Errorf("保存する秘密鍵のエンコードエラー: %w", err)
+	}
+	if publicKey, err = k.publicKey.MarshalBinary(); err != nil {
+		return nil, nil, fmt.Errorf("保存する公開鍵のエンコードエラー: %w", err)
+	}
+	return privateKey, publicKey, nil
+}
+
+// 保存した鍵ペアを復号に使えるようにする（このサーバーの鍵以外の記録は無視する）
+// 読み込めない鍵はログに出力して飛ばし、その鍵の暗号化データは unknown_key で拒否される
+func (m *keyManager) importArchived(records []keyarchive.Record) {
+	for _, rec := range records {
+		if rec.Type != keyarchive.TypeKey || rec.Service != ServiceName {
+			continue
+		}
+		key, err := parseArchivedKey(rec)
+		if err != nil {
+			log.Printf("保存した鍵 %s を読み込めません: %v", rec.KeyID, err)
+			continue
+		}
+		if m.archived == nil {
+			m.archived = make(map[string]*keyPair)
+		}
+		m.archived[key.id] = key
+	}
+}
+
+func parseArchivedKey(rec keyarchive.Record) (*keyPair, error) {
+	packed, err := base64.StdEncoding.DecodeString(rec.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := parseKeyPair(rec.KeyID, rec.Algorithm, packed, rec.ArchivedAt)
+	if err != nil {
+		return nil, err
+	}
+	key.archived = true
+	return key, nil
+}
+
+// 保存した秘密鍵（circlのバイナリ形式）から鍵ペアを作る
+func parseKeyPair(id, algorithm string, packed []byte, createdAt time.Time) (*keyPair, error) {
+	if algorithm != archiveAlgorithm {
+		return nil, fmt.Errorf("不明な鍵の方式: %q", algorithm)
+	}
+	if len(packed) != kyber768.PrivateKeySize {
+		return nil, fmt.Errorf("秘密鍵のサイズが不正です: %dバイト", len(packed))
+	}
+	privateKey := new(kyber768.PrivateKey)
+	privateKey.Unpack(packed)
+	publicKey := privateKey.Public().(*kyber768.PublicKey)
+	return &keyPair{id: id, publicKey: publicKey, privateKey: privateKey, createdAt: createdAt}, nil
+}
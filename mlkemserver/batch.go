@@ -0,0 +1,102 @@
+package mlkemserver
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/keyi1000/PQC_grafana/entropy"
+	"github.com/keyi1000/PQC_grafana/internal/httpmw"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	batchEncapsulations = factory.NewCounter(
+		prometheus.CounterOpts{
+			Name: "mlkem_server_batch_encapsulations_total",
+			Help: "Total number of encapsulations performed by /encapsulate-batch",
+		},
+	)
+	batchPerOpDuration = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "mlkem_server_batch_encapsulation_per_op_seconds",
+			Help: "Average duration of one encapsulation in the latest batch in seconds (excluding HTTP and JSON)",
+		},
+	)
+)
+
+// サーバー自身の鍵に対してN回カプセル化し、合計時間を返すハンドラー
+// 1回ごとのHTTP・JSONの処理を除いたアルゴリズムだけのスループットを計測する
+func batchEncapsulateHandler(w http.ResponseWriter, r *http.Request) {
+	receivedAt := time.Now()
+	if r.Method != http.MethodPost {
+		errorsTotal.WithLabelValues("encapsulate_batch", "request").Inc()
+		http.Error(w, "POSTメソッドのみサポートしています", http.StatusMethodNotAllowed)
+		return
+	}
+	var req wire.EncapsulateBatchRequest
+	if err := httpMiddleware.DecodeJSON(w, r, wire.MaxBatchRequestSize, &req); err != nil {
+		errorsTotal.WithLabelValues("encapsulate_batch", "request").Inc()
+		http.Error(w, "リクエストの形式が不正です: "+err.Error(), httpmw.StatusCode(err))
+		return
+	}
+	if req.Count < 1 || req.Count > wire.MaxBatchCount {
+		errorsTotal.WithLabelValues("encapsulate_batch", "request").Inc()
+		http.Error(w, fmt.Sprintf("回数は1〜%dで指定してください", wire.MaxBatchCount), http.StatusBadRequest)
+		return
+	}
+
+	// バッチ専用の鍵ペア（鍵生成の時間は計測に含めない）
+	pk, sk, err := kyber768.GenerateKeyPair(entropy.Reader(entropy.OperationMLKEMKeyGen))
+	if err != nil {
+		errorsTotal.WithLabelValues("keygen", "crypto").Inc()
+		http.Error(w, "鍵生成に失敗しました", http.StatusInternalServerError)
+		log.Println("鍵生成エラー:", err)
+		return
+	}
+	defer cryptoutil.ZeroizeKyber768PrivateKey(sk)
+
+	// 乱数の取得は計測に含めず、カプセル化の計算だけを計測する
+	ct := make([]byte, kyber768.CiphertextSize)
+	ss := make([]byte, kyber768.SharedKeySize)
+	defer cryptoutil.Zeroize(ss)
+	seed := make([]byte, kyber768.EncapsulationSeedSize)
+	var total, fastest, slowest time.Duration
+	for i := 0; i < req.Count; i++ {
+		if _, err := io.ReadFull(entropy.Reader(entropy.OperationMLKEMEncapsulate), seed); err != nil {
+			errorsTotal.WithLabelValues("encapsulate_batch", "crypto").Inc()
+			http.Error(w, "乱数の取得に失敗しました", http.StatusInternalServerError)
+			return
+		}
+		start := time.Now()
+		pk.EncapsulateTo(ct, ss, seed)
+		elapsed := time.Since(start)
+		total += elapsed
+		if i == 0 || elapsed < fastest {
+			fastest = elapsed
+		}
+		slowest = max(slowest, elapsed)
+	}
+	batchEncapsulations.Add(float64(req.Count))
+	perOp := total / time.Duration(req.Count)
+	batchPerOpDuration.Set(perOp.Seconds())
+
+	response := wire.EncapsulateBatchResponse{
+		Algorithm:  "ML-KEM-768 (Kyber-768)",
+		Count:      req.Count,
+		TotalNanos: total.Nanoseconds(),
+		PerOpNanos: perOp.Nanoseconds(),
+		MinNanos:   fastest.Nanoseconds(),
+		MaxNanos:   slowest.Nanoseconds(),
+	}
+	if total > 0 {
+		response.OpsPerSecond = float64(req.Count) / total.Seconds()
+	}
+	response.ServerTiming = wire.NewServerTiming(receivedAt)
+	writeJSON(w, http.StatusOK, response)
+}
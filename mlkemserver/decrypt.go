@@ -0,0 +1,216 @@
+package mlkemserver
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+	"github.com/keyi1000/PQC_grafana/auditlog"
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/keyi1000/PQC_grafana/internal/httpmw"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	decryptDuration = factory.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "mlkem_server_decrypt_duration_seconds",
+			Help:    "Histogram of ML-KEM decapsulation, AES key unwrap and message decryption duration in seconds",
+			Buckets: []float64{0.0001, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1},
+		},
+	)
+	decryptFailures = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mlkem_server_decrypt_failures_total",
+			Help: "Total number of failed decryptions, by reason (padding/auth are only distinguished in vulnerable mode)",
+		},
+		[]string{"reason"},
+	)
+	oracleResponses = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mlkem_server_oracle_responses_total",
+			Help: "Total number of decryption failures whose reason was revealed to the client in insecure oracle mode",
+		},
+		[]string{"reason"},
+	)
+	envelopeRequests = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mlkem_server_envelope_requests_total",
+			Help: "Total number of decryption requests, by envelope format version (unspecified for clients that predate versioning)",
+		},
+		[]string{"format_version"},
+	)
+	envelopeFieldBytes = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mlkem_server_envelope_field_bytes_total",
+			Help: "Total number of Base64 bytes received in decryption requests, by component (key_material for the wrapped AES key, KEM ciphertext, KEK or ephemeral public key; ciphertext for the message, IV and MAC); the whole body is in http_wire_bytes_total",
+		},
+		[]string{"component"},
+	)
+	dataCipherRequests = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mlkem_server_data_cipher_requests_total",
+			Help: "Total number of decryption requests, by data encryption algorithm (AES-CBC-HMAC, AES-GCM, AES-GCM-SIV or ChaCha20-Poly1305 and key size)",
+		},
+		[]string{"algorithm"},
+	)
+	keyWrapRequests = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mlkem_server_key_wrap_requests_total",
+			Help: "Total number of decryption requests, by data key wrapping construction under the KEM-derived KEK (aes-gcm or aes-kw)",
+		},
+		[]string{"method"},
+	)
+	keyUnwrapDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mlkem_server_key_unwrap_duration_seconds",
+			Help:    "Duration of unwrapping the data key with the KEM-derived KEK in seconds, by wrapping construction (aes-gcm or aes-kw)",
+			Buckets: []float64{0.000001, 0.0000025, 0.000005, 0.00001, 0.000025, 0.00005, 0.0001, 0.00025},
+		},
+		[]string{"method"},
+	)
+)
+
+// 暗号化データの受信構造体
+type EncryptedData = wire.EncryptedData
+
+// 復号結果のレスポンス構造体
+// 平文そのものは返さず、クライアントが検証できるようにハッシュ値を返す
+type DecryptResponse = wire.DecryptResponse
+
+// カプセル化テキストから共有秘密鍵を取り出し、暗号化データを復号するハンドラー
+func (s *server) decapsulateHandler(w http.ResponseWriter, r *http.Request) {
+	receivedAt := time.Now()
+	if r.Method != http.MethodPost {
+		errorsTotal.WithLabelValues("decapsulate", "request").Inc()
+		http.Error(w, "POSTメソッドのみサポートしています", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req EncryptedData
+	if err := httpMiddleware.DecodeJSON(w, r, wire.MaxEncryptedDataSize, &req); err != nil {
+		s.rejectDecrypt(w, "malformed", httpmw.StatusCode(err), wire.ErrorResponse{Code: wire.ErrorCodeMalformed, Message: "リクエストの形式が不正です: " + err.Error()})
+		return
+	}
+	envelopeRequests.WithLabelValues(req.VersionLabel()).Inc()
+	keyMaterial, ciphertextSize := req.FieldSizes()
+	envelopeFieldBytes.WithLabelValues(wire.ComponentKeyMaterial).Add(float64(keyMaterial))
+	envelopeFieldBytes.WithLabelValues(wire.ComponentCiphertext).Add(float64(ciphertextSize))
+	if err := req.CheckVersion(); err != nil {
+		s.rejectInvalid(w, err)
+		return
+	}
+	dataCipher, ok := cryptoutil.LookupDataCipher(req.Algorithm)
+	if !ok {
+		s.rejectDecrypt(w, "unsupported_algorithm", http.StatusBadRequest, wire.ErrorResponse{Code: wire.ErrorCodeUnsupportedAlgorithm, Field: "algorithm", Message: "サポートしていない暗号化方式です"})
+		return
+	}
+	dataCipherRequests.WithLabelValues(dataCipher.Name).Inc()
+	fields, err := decodeDecryptFields(&req, dataCipher)
+	if err != nil {
+		s.rejectInvalid(w, err)
+		return
+	}
+	ciphertext := s.chaos.CorruptCiphertext(fields.ciphertext)
+
+	key, ok := s.keys.lookup(req.KeyID)
+	if !ok {
+		s.rejectDecrypt(w, "unknown_key", http.StatusBadRequest, wire.ErrorResponse{Code: wire.ErrorCodeUnknownKey, Field: "key_id", Message: "鍵IDが見つかりません"})
+		return
+	}
+	defer s.keys.release(key)
+	keyWrapRequests.WithLabelValues(fields.keyWrap).Inc()
+	observeKeyUsage(key, keyUsageDecapsulate)
+
+	if err := s.replay.Check(&req); err != nil {
+		s.rejectReplay(w, err)
+		return
+	}
+
+	start := time.Now()
+	plaintext, err := s.decrypt(key, dataCipher, fields, ciphertext)
+	s.audit.Record(r, auditlog.Event{Service: ServiceName, Operation: auditlog.OperationDecapsulate, KeyID: key.id, Algorithm: archiveAlgorithm, Err: err})
+	if err != nil {
+		reason := s.decryptFailureReason(err)
+		if s.oracle && (reason == "padding" || reason == "auth") {
+			// 【教育用・脆弱】エラーの種類をそのまま返し、パディングオラクルとして振る舞う
+			oracleResponses.WithLabelValues(reason).Inc()
+			s.rejectDecrypt(w, reason, http.StatusBadRequest, wire.ErrorResponse{Code: reason, Message: err.Error()})
+			return
+		}
+		// クライアントにはエラーの種類を区別できない同一のレスポンスを返す
+		s.rejectDecrypt(w, reason, http.StatusBadRequest, wire.ErrorResponse{Code: wire.ErrorCodeDecrypt, Message: "復号に失敗しました"})
+		return
+	}
+	decryptDuration.Observe(time.Since(start).Seconds())
+	if err := s.replay.Record(&req); err != nil {
+		s.rejectReplay(w, err)
+		return
+	}
+
+	metrics.MarkFirstOperation()
+
+	digest := sha256.Sum256(plaintext)
+	response := DecryptResponse{
+		PlaintextSHA256: base64.StdEncoding.EncodeToString(digest[:]),
+		PlaintextSize:   len(plaintext),
+		KeyID:           key.id,
+	}
+	response.ServerTiming = wire.NewServerTiming(receivedAt)
+	s.archive.StoreCiphertext(ServiceName, &req, response.PlaintextSHA256)
+	writeJSON(w, http.StatusOK, response)
+
+	log.Printf("暗号化データを復号しました (%dバイト, クライアント: %s)\n", len(plaintext), r.RemoteAddr)
+}
+
+// ML-KEMで共有秘密鍵を取り出してデータ鍵をアンラップし、メッセージをdataCipherで復号する
+func (s *server) decrypt(key *keyPair, dataCipher cryptoutil.DataCipher, f decryptFields, ciphertext []byte) ([]byte, error) {
+	if len(f.kemCiphertext) != kyber768.CiphertextSize {
+		return nil, cryptoutil.ErrCiphertextLength
+	}
+	sharedSecret := make([]byte, kyber768.SharedKeySize)
+	key.privateKey.DecapsulateTo(sharedSecret, f.kemCiphertext)
+	defer cryptoutil.Zeroize(sharedSecret)
+
+	start := time.Now()
+	aesKey, err := cryptoutil.UnwrapKeyWith(f.keyWrap, sharedSecret, f.encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	defer cryptoutil.Zeroize(aesKey)
+	keyUnwrapDuration.WithLabelValues(f.keyWrap).Observe(time.Since(start).Seconds())
+
+	if s.vulnerable && dataCipher.Family == cryptoutil.FamilyCBCHMAC {
+		return cryptoutil.DecryptCBCHMACVulnerable(aesKey, f.iv, ciphertext, f.tag)
+	}
+	return dataCipher.Open(aesKey, f.iv, ciphertext, f.tag)
+}
+
+// 復号失敗の理由を決める
+// 通常モードではパディングエラーと認証エラーを区別しない（メトリクスからもオラクルを作らない）
+func (s *server) decryptFailureReason(err error) string {
+	if !s.vulnerable {
+		return "decrypt"
+	}
+	switch {
+	case errors.Is(err, cryptoutil.ErrPadding):
+		return "padding"
+	case errors.Is(err, cryptoutil.ErrAuthentication):
+		return "auth"
+	default:
+		return "decrypt"
+	}
+}
+
+// 復号要求を拒否する（reasonはメトリクスのラベル、クライアントにはエラーレスポンスのみを返す）
+func (s *server) rejectDecrypt(w http.ResponseWriter, reason string, status int, resp wire.ErrorResponse) {
+	decryptFailures.WithLabelValues(reason).Inc()
+	errorsTotal.WithLabelValues("decapsulate", "crypto").Inc()
+	writeJSON(w, status, resp)
+}
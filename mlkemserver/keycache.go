@@ -0,0 +1,78 @@
+package mlkemserver
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var publicKeyCache = factory.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "mlkem_server_public_key_cache_total",
+		Help: "Total number of public key responses, by cache result (miss, hit, not_modified, bypass for ephemeral keys, nonces and chaos key corruption)",
+	},
+	[]string{"result"},
+)
+
+// 事前にシリアライズしたレスポンスを使えるか
+// ephemeralモードの鍵、nonceを結び付けるPOST、公開鍵を破損させる障害注入ではリクエストごとに作る
+func (s *server) cacheablePublicKey(nonce []byte) bool {
+	return nonce == nil && s.keys.mode == KeyModeStatic && s.chaos == nil
+}
+
+// 公開鍵のレスポンスのCache-Control
+// max-ageは鍵の更新までの残り時間を超えないようにし、キャッシュが更新後の古い鍵を配り続けないようにする
+func (s *server) cacheControl(key *keyPair) string {
+	return cacheControlFor(s.keyMaxAge(key))
+}
+
+// 鍵の更新までにキャッシュしてよい時間
+func (s *server) keyMaxAge(key *keyPair) time.Duration {
+	if s.keys.lifetime > 0 {
+		return min(s.maxAge, s.keys.lifetime-time.Since(key.createdAt))
+	}
+	return s.maxAge
+}
+
+// max-ageのCache-Control（1秒未満の場合は毎回ETagで再検証させる）
+func cacheControlFor(maxAge time.Duration) string {
+	if maxAge < time.Second {
+		return "public, no-cache"
+	}
+	return "public, max-age=" + strconv.Itoa(int(maxAge/time.Second))
+}
+
+// 鍵ごとに1回だけシリアライズしたレスポンスを返し、If-None-Matchが一致すれば304を返す
+func (s *server) writeCachedPublicKey(w http.ResponseWriter, r *http.Request, key *keyPair, receivedAt time.Time) {
+	built := false
+	key.responseOnce.Do(func() {
+		built = true
+		var response PublicKeyResponse
+		if response, key.responseErr = s.newPublicKeyResponse(r, key, nil); key.responseErr == nil {
+			key.response, key.responseErr = wire.NewCachedPublicKey(response)
+		}
+	})
+	if key.responseErr != nil {
+		publicKeyResponseError(w, key.responseErr)
+		return
+	}
+	w.Header().Set("Cache-Control", s.cacheControl(key))
+	switch {
+	case key.response.NotModified(r):
+		publicKeyCache.WithLabelValues("not_modified").Inc()
+		key.response.WriteNotModified(w)
+		return
+	case built:
+		publicKeyCache.WithLabelValues("miss").Inc()
+	default:
+		publicKeyCache.WithLabelValues("hit").Inc()
+	}
+	if err := key.response.Write(w, receivedAt); err != nil {
+		errorsTotal.WithLabelValues("respond", "network").Inc()
+		log.Println("レスポンスの書き込みエラー:", err)
+	}
+}
@@ -0,0 +1,344 @@
+package mlkemserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+	"github.com/keyi1000/PQC_grafana/annotation"
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/keyi1000/PQC_grafana/entropy"
+	"github.com/keyi1000/PQC_grafana/internal/keyrotation"
+	"github.com/keyi1000/PQC_grafana/keyarchive"
+	"github.com/keyi1000/PQC_grafana/keystore"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 鍵の運用モード
+const (
+	KeyModeEphemeral = "ephemeral" // セッション（リクエスト）ごとに鍵ペアを生成し、使い終わったら破棄する
+	KeyModeStatic    = "static"    // 長期間同じ鍵ペアを使い回す
+)
+
+var (
+	keysGenerated = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mlkem_server_keys_generated_total",
+			Help: "Total number of ML-KEM key pairs generated, by key mode",
+		},
+		[]string{"mode"},
+	)
+	sessionsPerKey = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mlkem_server_sessions_per_key",
+			Help:    "Number of sessions served by a key pair before it was retired",
+			Buckets: []float64{1, 2, 5, 10, 50, 100, 500, 1000, 5000, 10000},
+		},
+		[]string{"mode"},
+	)
+	currentKeySessions = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "mlkem_server_current_key_sessions",
+			Help: "Number of sessions served by the current key pair",
+		},
+	)
+	currentKeyAge = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "mlkem_server_current_key_age_seconds",
+			Help: "Age of the key pair used for the latest session in seconds",
+		},
+	)
+	zeroizationEvents = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mlkem_server_zeroization_events_total",
+			Help: "Total number of times sensitive material was zeroized, by material",
+		},
+		[]string{"material"},
+	)
+	keyModeInfo = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mlkem_server_key_mode",
+			Help: "Key mode of the server (1 for the active mode)",
+		},
+		[]string{"mode"},
+	)
+)
+
+// ephemeralモードで、公開鍵を渡してから復号要求が来るまで秘密鍵を保持する時間と最大数
+const (
+	sessionKeyTTL     = 30 * time.Second
+	maxPendingSession = 1024
+)
+
+// ML-KEM鍵ペア
+type keyPair struct {
+	id         string
+	publicKey  *kyber768.PublicKey
+	privateKey *kyber768.PrivateKey
+	createdAt  time.Time
+	sessions   int
+	users      int  // lookupで取り出して処理中の復号の数（keyManagerのmuで保護する）
+	retiring   bool // retireで消去する順番が来たが、処理中の復号が終わるのを待っている
+	archived   bool // 保存した記録から読み込んだ鍵ペア（消去しない）
+	static     bool // staticモードの鍵ペア（鍵IDごとの使用回数を記録する）
+
+	// staticモードのGET /public-key で使い回すレスポンス
+	responseOnce sync.Once
+	response     *wire.CachedPublicKey
+	responseErr  error
+}
+
+// 鍵ペアの生成と使い回しを管理する
+type keyManager struct {
+	mu       sync.Mutex
+	mode     string
+	lifetime time.Duration
+	active   []*keyPair          // staticモードで新しいセッションに順に渡す鍵ペア（鍵IDで区別する）
+	retired  []*keyPair          // staticモードで更新までに使っていた鍵ペア（処理中のセッション用、activeと同じ数まで残す）
+	size     int                 // staticモードで同時に使う鍵ペアの数
+	next     int                 // 次のセッションに渡すactiveの位置
+	pending  map[string]*keyPair // ephemeralモードで復号要求を待っている鍵ペア
+	archive  *keyarchive.Archive // 生成した鍵ペアの保存先（nilの場合は保存しない）
+	archived map[string]*keyPair // 保存した記録から読み込んだ鍵ペア（過去の暗号化データの再生用）
+	store    keystore.Store      // staticモードの鍵ペアの保存先（nilの場合はメモリのみ）
+}
+
+func newKeyManager(mode string, lifetime time.Duration) *keyManager {
+	keyModeInfo.WithLabelValues(mode).Set(1)
+	return &keyManager{mode: mode, lifetime: lifetime, size: 1, pending: make(map[string]*keyPair)}
+}
+
+// セッションで使う鍵ペアを取得する
+// ephemeralモードでは毎回新しい鍵ペアを生成し、staticモードでは有効期限まで同じ鍵ペアを返す
+func (m *keyManager) acquire() (*keyPair, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.mode == KeyModeEphemeral {
+		// ephemeralモードの鍵は1セッションで破棄する
+		key, err := m.generate()
+		if err != nil {
+			return nil, err
+		}
+		key.sessions = 1
+		sessionsPerKey.WithLabelValues(m.mode).Observe(1)
+		currentKeySessions.Set(1)
+		currentKeyAge.Set(0)
+		m.prunePending()
+		m.pending[key.id] = key
+		return key, nil
+	}
+
+	// 足りない鍵ペアを生成し、有効期限を過ぎた鍵ペアはその鍵だけを更新する
+	for len(m.active) < m.size {
+		if _, err := m.rotate(-1); err != nil {
+			return nil, err
+		}
+	}
+	i := m.next % len(m.active)
+	m.next = i + 1
+	if m.expired(m.active[i]) {
+		if _, err := m.rotate(i); err != nil {
+			return nil, err
+		}
+	}
+
+	key := m.active[i]
+	key.sessions++
+	currentKeySessions.Set(float64(key.sessions))
+	currentKeyAge.Set(time.Since(key.createdAt).Seconds())
+	observeKeyUsage(key, keyUsagePublicKey)
+	return key, nil
+}
+
+// staticモードのactive[i]を新しい鍵ペアに替え、使っていた鍵ペアを処理中のセッションのために残す（iが負の場合は追加する）
+// 替えた鍵ペアを返す（mu を保持した状態で呼ぶこと）
+func (m *keyManager) rotate(i int) (*keyPair, error) {
+	key, err := m.generate()
+	if err != nil {
+		return nil, err
+	}
+	if i < 0 {
+		m.addActive(key)
+		return nil, nil
+	}
+	old := m.active[i]
+	sessionsPerKey.WithLabelValues(m.mode).Observe(float64(old.sessions))
+	annotation.Post(ServiceName, annotation.EventKeyRotation,
+		fmt.Sprintf("ML-KEM鍵 %s を %s に更新しました（前の鍵は%v間、%dセッションで使用）", old.id, key.id, time.Since(old.createdAt).Round(time.Second), old.sessions))
+	key.static = true
+	m.active[i] = key
+	m.retire(old)
+	return old, nil
+}
+
+// 有効期限を待たずにstaticモードの最も古い鍵ペアを更新する（POST /rotate-key）
+// ほかの鍵ペアは使い続けるため、更新の前に公開鍵を取得したクライアントも復号できる
+func (m *keyManager) ForceRotate() (wire.RotateKeyResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.mode != KeyModeStatic {
+		return wire.RotateKeyResponse{}, keyrotation.ErrNotRotatable
+	}
+	if len(m.active) < m.size {
+		if _, err := m.rotate(-1); err != nil {
+			return wire.RotateKeyResponse{}, err
+		}
+		return wire.RotateKeyResponse{KeyID: m.active[len(m.active)-1].id}, nil
+	}
+	i := m.oldestActive()
+	old, err := m.rotate(i)
+	if err != nil {
+		return wire.RotateKeyResponse{}, err
+	}
+	return wire.RotateKeyResponse{KeyID: m.active[i].id, PreviousKeyID: old.id}, nil
+}
+
+// 鍵IDから復号に使う鍵ペアを探す
+// ephemeralモードの鍵は一度しか使えないため、取り出した時点で保持リストから削除する
+func (m *keyManager) lookup(id string) (*keyPair, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if key, ok := m.archived[id]; ok {
+		return key, true
+	}
+	if m.mode == KeyModeEphemeral {
+		key, ok := m.pending[id]
+		if ok {
+			delete(m.pending, id)
+		}
+		return key, ok
+	}
+	for _, keys := range [][]*keyPair{m.active, m.retired} {
+		for _, key := range keys {
+			if key.id == id {
+				key.users++
+				return key, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// セッションが終わった鍵ペアを解放する
+// ephemeralモードの秘密鍵は再利用しないため、ここでメモリから消去する
+// staticモードで消去を待っている鍵ペアは、最後の復号が終わったときに消去する
+func (m *keyManager) release(key *keyPair) {
+	if m.mode == KeyModeEphemeral && !key.archived {
+		key.zeroize()
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if key.users > 0 {
+		key.users--
+	}
+	if key.retiring && key.users == 0 {
+		key.retiring = false
+		key.zeroize()
+		forgetKeyUsage(key)
+	}
+}
+
+// 期限切れの鍵と、上限を超えた古い鍵を消去する（mu を保持した状態で呼ぶこと）
+func (m *keyManager) prunePending() {
+	var oldest *keyPair
+	for id, key := range m.pending {
+		if time.Since(key.createdAt) >= sessionKeyTTL {
+			delete(m.pending, id)
+			key.zeroize()
+			continue
+		}
+		if oldest == nil || key.createdAt.Before(oldest.createdAt) {
+			oldest = key
+		}
+	}
+	if len(m.pending) >= maxPendingSession && oldest != nil {
+		delete(m.pending, oldest.id)
+		oldest.zeroize()
+	}
+}
+
+// 保存した長期鍵を読み込み、使用中の鍵ペアにする（保存先がない場合は何もしない）
+func (m *keyManager) loadStored() {
+	keystore.LoadStartup(m.store, ServiceName, m.lifetime, func(stored keystore.StoredKey) error {
+		key, err := parseKeyPair(stored.KeyID, stored.Algorithm, stored.PrivateKey, stored.CreatedAt)
+		if err != nil {
+			return err
+		}
+		m.addActive(key)
+		return nil
+	})
+}
+
+// 生成した長期鍵を保存する（保存先がない場合は何もしない）
+func (m *keyManager) saveStored(key *keyPair) {
+	if m.store == nil {
+		return
+	}
+	privateKey, publicKey, err := key.marshal()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer cryptoutil.Zeroize(privateKey)
+	keystore.SaveGenerated(m.store, ServiceName, keystore.StoredKey{
+		KeyID:      key.id,
+		Algorithm:  archiveAlgorithm,
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+		CreatedAt:  key.createdAt,
+	})
+}
+
+// 秘密鍵をメモリから消去する
+func (k *keyPair) zeroize() {
+	cryptoutil.ZeroizeKyber768PrivateKey(k.privateKey)
+	zeroizationEvents.WithLabelValues("private_key").Inc()
+}
+
+// 鍵が有効期限を過ぎているか（lifetimeが0の場合は期限なし）
+func (m *keyManager) expired(key *keyPair) bool {
+	return m.lifetime > 0 && time.Since(key.createdAt) >= m.lifetime
+}
+
+// 新しい鍵ペアを生成する
+func (m *keyManager) generate() (*keyPair, error) {
+	id, err := newKeyID()
+	if err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
+	publicKey, privateKey, err := kyber768.GenerateKeyPair(entropy.Reader(entropy.OperationMLKEMKeyGen))
+	if err != nil {
+		return nil, fmt.Errorf("鍵生成エラー: %w", err)
+	}
+	generationDuration := time.Since(startTime)
+	keyGenerationTime.Set(generationDuration.Seconds())
+	keyGenerationDuration.Observe(generationDuration.Seconds())
+	keysGenerated.WithLabelValues(m.mode).Inc()
+	log.Printf("新しいML-KEM鍵ペアを生成しました (モード: %s, 鍵生成時間: %v)\n", m.mode, generationDuration)
+
+	key := &keyPair{id: id, publicKey: publicKey, privateKey: privateKey, createdAt: time.Now()}
+	m.archiveKey(key)
+	if m.mode == KeyModeStatic {
+		m.saveStored(key)
+	}
+	return key, nil
+}
+
+// ランダムな鍵IDを生成する
+func newKeyID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("鍵IDの生成エラー: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,67 @@
+package mlkemserver
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestKeyPairZeroize(t *testing.T) {
+	publicKey, privateKey, err := kyber768.GenerateKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &keyPair{id: "test", publicKey: publicKey, privateKey: privateKey}
+	counter := zeroizationEvents.WithLabelValues("private_key")
+	before := testutil.ToFloat64(counter)
+	key.zeroize()
+	if !privateKey.Equal(&kyber768.PrivateKey{}) {
+		t.Fatal("秘密鍵が消去されていません")
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Fatalf("mlkem_server_zeroization_events_totalの増加 = %v, want 1", got)
+	}
+}
+
+func newTestKeyPair(t *testing.T, id string) *keyPair {
+	t.Helper()
+	publicKey, privateKey, err := kyber768.GenerateKeyPair(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &keyPair{id: id, publicKey: publicKey, privateKey: privateKey, createdAt: time.Now()}
+}
+
+func zeroized(key *keyPair) bool {
+	return key.privateKey.Equal(&kyber768.PrivateKey{})
+}
+
+// 処理中のカプセル化の解除がある鍵ペアはretireで消去せず、最後のreleaseで消去する
+func TestRetireWaitsForInFlightDecapsulation(t *testing.T) {
+	m := newKeyManager(KeyModeStatic, 0)
+	first, second, third := newTestKeyPair(t, "first"), newTestKeyPair(t, "second"), newTestKeyPair(t, "third")
+	m.addActive(first)
+
+	key, ok := m.lookup(first.id)
+	if !ok {
+		t.Fatal("鍵ペアが見つかりません")
+	}
+
+	m.mu.Lock()
+	m.active[0] = second
+	m.retire(first)
+	m.active[0] = third
+	m.retire(second) // retiredの上限（1）を超え、firstの消去の順番が来る
+	m.mu.Unlock()
+
+	if zeroized(first) {
+		t.Fatal("処理中のカプセル化の解除がある鍵ペアが消去されました")
+	}
+	m.release(key)
+	if !zeroized(first) {
+		t.Fatal("最後のカプセル化の解除が終わっても消去されません")
+	}
+}
@@ -0,0 +1,46 @@
+package mlkemserver
+
+import (
+	"time"
+
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+	"github.com/keyi1000/PQC_grafana/entropy"
+	"github.com/keyi1000/PQC_grafana/selfbench"
+	"github.com/keyi1000/PQC_grafana/wire"
+)
+
+// /benchmark/self で計測する暗号処理
+const selfBenchmarkPrimitive = "Kyber768-decapsulate"
+
+// 計測専用の鍵ペアに1回カプセル化しておき、その脱カプセル化を繰り返す
+// （鍵の生成とカプセル化の時間は計測に含めない）
+func prepareSelfBenchmark() (func() error, error) {
+	pk, sk, err := kyber768.GenerateKeyPair(entropy.Reader(entropy.OperationMLKEMKeyGen))
+	if err != nil {
+		return nil, err
+	}
+	ct, _, err := kyber768.Scheme().Encapsulate(pk)
+	if err != nil {
+		return nil, err
+	}
+	ss := make([]byte, kyber768.SharedKeySize)
+	return func() error {
+		sk.DecapsulateTo(ss, ct)
+		return nil
+	}, nil
+}
+
+// ML-KEMの脱カプセル化をOSスレッドに固定して計測する（/benchmark/self と同じ）
+func SelfBenchmark(opts selfbench.Options) (wire.SelfBenchmarkResponse, error) {
+	return selfbench.Run(selfBenchmarkPrimitive, prepareSelfBenchmark, opts)
+}
+
+// ML-KEMの脱カプセル化を内部のキューから複数のワーカーで処理する負荷計測を行う（/benchmark/load と同じ）
+func LoadBenchmark(opts selfbench.LoadOptions) (wire.LoadBenchmarkResponse, error) {
+	return selfbench.Load(selfBenchmarkPrimitive, prepareSelfBenchmark, opts)
+}
+
+// GOMAXPROCSを1, 2, 4, ...と増やしながらML-KEMの脱カプセル化の負荷計測を繰り返す（/benchmark/scaling と同じ）
+func ScalingBenchmark(duration time.Duration, maxProcs int) (wire.ScalingBenchmarkResponse, error) {
+	return selfbench.Scaling(selfBenchmarkPrimitive, prepareSelfBenchmark, duration, maxProcs)
+}
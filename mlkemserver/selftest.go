@@ -0,0 +1,57 @@
+package mlkemserver
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/selftest"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	selftestPassed = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mlkem_server_selftest_passed",
+			Help: "Result of the last known-answer self-test, by test (1 = passed, 0 = failed)",
+		},
+		[]string{"test"},
+	)
+	selftestLastRun = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "mlkem_server_selftest_last_run_timestamp_seconds",
+			Help: "Unix time of the last known-answer self-test run",
+		},
+	)
+)
+
+// /selftest のレスポンス
+type SelfTestResponse struct {
+	Passed  bool              `json:"passed"`
+	Results []selftest.Result `json:"results"`
+}
+
+// 既知解テストを実行し、結果をメトリクスに記録する
+func runSelfTest() SelfTestResponse {
+	results := selftest.Run()
+	for _, r := range results {
+		if r.Passed {
+			selftestPassed.WithLabelValues(r.Name).Set(1)
+		} else {
+			selftestPassed.WithLabelValues(r.Name).Set(0)
+			log.Printf("⚠️  既知解テストに失敗 [%s]: %s", r.Name, r.Error)
+		}
+	}
+	selftestLastRun.Set(float64(time.Now().Unix()))
+	return SelfTestResponse{Passed: selftest.AllPassed(results), Results: results}
+}
+
+// 既知解テストをその場で実行する（失敗した場合は500を返す）
+func selfTestHandler(w http.ResponseWriter, r *http.Request) {
+	resp := runSelfTest()
+	status := http.StatusOK
+	if !resp.Passed {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, resp)
+}
@@ -0,0 +1,381 @@
+// Package mlkemserver はML-KEM公開鍵サーバーのHTTPハンドラーとメトリクスを提供する
+package mlkemserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/apidoc"
+	"github.com/keyi1000/PQC_grafana/auditlog"
+	"github.com/keyi1000/PQC_grafana/calibration"
+	"github.com/keyi1000/PQC_grafana/chaos"
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/keyi1000/PQC_grafana/features"
+	"github.com/keyi1000/PQC_grafana/internal/httpmw"
+	"github.com/keyi1000/PQC_grafana/internal/keyrotation"
+	"github.com/keyi1000/PQC_grafana/kembench"
+	"github.com/keyi1000/PQC_grafana/keyarchive"
+	"github.com/keyi1000/PQC_grafana/keystore"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/replay"
+	"github.com/keyi1000/PQC_grafana/selfbench"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "ml-kem-server"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は mlkem_server_）
+// 複数のサービスを1つのプロセスで動かしても系列を区別できる
+var factory = metrics.NewFactory(ServiceName, "mlkem_server_")
+
+// リクエスト数・所要時間・パニックのメトリクス（mlkem_server_http_*）、リクエストIDを付けるミドルウェア
+var httpMiddleware = httpmw.New(ServiceName, factory, "mlkem_server_")
+
+var (
+	// Prometheusメトリクス
+	publicKeyRequests = factory.NewCounter(
+		prometheus.CounterOpts{
+			Name: "mlkem_server_public_key_requests_total",
+			Help: "Total number of public key requests",
+		},
+	)
+	indexRequests = factory.NewCounter(
+		prometheus.CounterOpts{
+			Name: "mlkem_server_index_requests_total",
+			Help: "Total number of index page requests",
+		},
+	)
+	keyGenerationTime = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "mlkem_server_key_generation_seconds",
+			Help: "Time taken to generate ML-KEM key pair in seconds",
+		},
+	)
+	keyGenerationDuration = factory.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "mlkem_server_key_generation_duration_seconds",
+			Help:    "Histogram of ML-KEM key generation duration in seconds",
+			Buckets: []float64{0.0001, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1},
+		},
+	)
+	errorsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mlkem_server_errors_total",
+			Help: "Total number of errors, by stage and category",
+		},
+		[]string{"stage", "category"},
+	)
+)
+
+// 公開鍵のレスポンス構造体
+type PublicKeyResponse = wire.PublicKeyResponse
+
+// サーバー側のタイムスタンプ
+// ProcessingNanosは単調時計で計測するため、クライアントとの時計のずれの影響を受けない
+type ServerTiming = wire.ServerTiming
+
+// サーバーの設定
+type Config struct {
+	KeyMode     string        // 鍵の運用モード（ephemeral / static）
+	KeyLifetime time.Duration // staticモードで鍵ペアを更新するまでの時間（0の場合は更新しない）
+	KeyMaxAge   time.Duration // staticモードの公開鍵をキャッシュしてよい時間（Cache-Controlのmax-age、0の場合は毎回ETagで再検証させる）
+	ActiveKeys  int           // staticモードで同時に使う鍵ペアの数（新しいセッションに順に渡す、0の場合は1）
+
+	// 【教育用・脆弱】MACより先にパディングを検査し、パディングエラーと認証エラーを区別して記録する
+	VulnerableMode bool
+	// 【教育用・脆弱】パディングエラーと認証エラーを異なるレスポンスで返す（パディングオラクル）
+	// VulnerableModeの動作も含む
+	InsecureOracle bool
+
+	// 【カオステスト】遅延・エラー・データの破損を確率的に注入する
+	Chaos chaos.Config
+
+	// 公開鍵のレスポンスに署名する長期署名鍵（nilの場合は起動時に生成する）
+	SigningKey *SigningKey
+
+	// 生成した鍵ペアと復号できた暗号化データの保存先（nilの場合は保存しない）
+	Archive *keyarchive.Archive
+	// 保存した記録から読み込む鍵ペア（過去の暗号化データを復号し直すため、モードに関係なく使える）
+	ArchivedKeys []keyarchive.Record
+
+	// staticモードの鍵ペアの保存先（nilの場合はメモリのみで、再起動すると鍵が変わる）
+	// 起動時に保存した鍵を読み込み、生成・更新した鍵を保存する
+	KeyStore keystore.Store
+
+	// 秘密鍵によるカプセル化の解除と署名の監査ログ（nilの場合は記録しない）
+	AuditLog *auditlog.Log
+
+	// 復号エンドポイントの再送の検出でtimestampを受け付ける現在時刻との差（0の場合は検出しない）
+	ReplayWindow time.Duration
+	// 再送の検出で記録する要求の数の上限（0の場合はreplay.DefaultCacheSize）
+	ReplayCacheSize int
+}
+
+// デフォルト設定（リクエストごとに鍵ペアを生成する）
+func DefaultConfig() Config {
+	return Config{KeyMode: KeyModeEphemeral}
+}
+
+// 設定を検証する
+func (c Config) Validate() error {
+	if c.KeyMode != KeyModeEphemeral && c.KeyMode != KeyModeStatic {
+		return fmt.Errorf("不明な鍵モード: %q (ephemeral または static を指定してください)", c.KeyMode)
+	}
+	if c.ActiveKeys < 0 || (c.ActiveKeys > 1 && c.KeyMode != KeyModeStatic) {
+		return fmt.Errorf("複数の鍵ペアはstaticモードでのみ使えます")
+	}
+	if c.KeyStore != nil && c.KeyMode != KeyModeStatic {
+		return fmt.Errorf("鍵の保存先はstaticモードでのみ使えます")
+	}
+	if c.ReplayWindow < 0 || c.ReplayCacheSize < 0 {
+		return fmt.Errorf("再送の検出の時間と記録の上限は0以上を指定してください")
+	}
+	return c.Chaos.Validate()
+}
+
+// ハンドラーが共有する状態
+type server struct {
+	keys       *keyManager
+	maxAge     time.Duration
+	vulnerable bool
+	oracle     bool
+	chaos      *chaos.Injector
+	signingKey *SigningKey
+	archive    *keyarchive.Archive
+	audit      *auditlog.Log
+	replay     *replay.Guard
+}
+
+// HTTPハンドラーを作成
+func NewHandler(cfg Config) http.Handler {
+	s := &server{
+		keys:       newKeyManager(cfg.KeyMode, cfg.KeyLifetime),
+		maxAge:     cfg.KeyMaxAge,
+		vulnerable: cfg.VulnerableMode || cfg.InsecureOracle,
+		oracle:     cfg.InsecureOracle,
+		chaos:      chaos.New(ServiceName, cfg.Chaos),
+		signingKey: cfg.SigningKey,
+		archive:    cfg.Archive,
+		audit:      cfg.AuditLog,
+		replay:     replay.New(ServiceName, cfg.ReplayWindow, cfg.ReplayCacheSize),
+	}
+	s.keys.archive = cfg.Archive
+	s.keys.size = max(cfg.ActiveKeys, 1)
+	s.keys.importArchived(cfg.ArchivedKeys)
+	s.keys.store = cfg.KeyStore
+	s.keys.loadStored()
+	if s.signingKey == nil {
+		key, err := GenerateSigningKey()
+		if err != nil {
+			// 署名鍵がなくても公開鍵は配布できるため、署名を付けずに起動する
+			errorsTotal.WithLabelValues("signing_keygen", "crypto").Inc()
+			log.Println("署名鍵の生成エラー（公開鍵に署名しません）:", err)
+		}
+		s.signingKey = key
+	}
+	if s.oracle {
+		log.Println("⚠️  パディングオラクルモードで起動しています: 復号エラーの種類をクライアントに返すため、攻撃のデモ以外では使用しないでください")
+	} else if s.vulnerable {
+		log.Println("⚠️  脆弱モードで起動しています: 復号エラーの種類が区別できるため、デモ以外では使用しないでください")
+	}
+	if s.chaos != nil {
+		log.Printf("⚠️  カオステストのため障害を注入します: %+v", cfg.Chaos)
+	}
+	if s.replay != nil {
+		log.Printf("復号エンドポイントで再送を検出します (timestampの許容範囲: 前後%s)", cfg.ReplayWindow)
+	}
+	// 起動時に既知解テストを実行する（失敗してもサーバーは起動し、メトリクスと/selftestで確認できる）
+	if resp := runSelfTest(); resp.Passed {
+		log.Printf("既知解テスト: %d件すべて成功", len(resp.Results))
+	}
+
+	// エンドポイントの説明（/openapi.json とインデックスページ）はルーティングと同時に登録する
+	api := &apidoc.API{
+		Title:       "ML-KEM (Kyber-768) 公開鍵サーバー",
+		Description: "このサーバーはポスト量子暗号のML-KEM公開鍵を提供します。ML-KEMはNISTが標準化したポスト量子暗号アルゴリズムです。",
+	}
+	mux := http.NewServeMux()
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/public-key", Summary: "ML-KEM公開鍵を取得", Response: PublicKeyResponse{}},
+		httpMiddleware.WrapRole("public-key", httpmw.RoleReader, s.chaos.Wrap(s.getPublicKeyHandler)))
+	api.Document(apidoc.Endpoint{Method: "POST", Path: "/public-key", Summary: "nonceを結び付けたML-KEM公開鍵を取得", Request: wire.PublicKeyRequest{}, Response: PublicKeyResponse{}})
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/keys", Summary: "staticモードで新しいセッションに渡すすべてのML-KEM（実験的なAKPの表現）公開鍵をJWK Setの形で取得（ephemeralモードでは空）", ContentType: wire.ContentTypeJWKSet, Response: wire.JWKSet{}},
+		httpMiddleware.WrapRole("keys", httpmw.RoleReader, s.chaos.Wrap(s.keysHandler)))
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/signing-key", Summary: "公開鍵のレスポンスの署名を検証するML-DSA-65の公開鍵を取得", Response: wire.SigningKeyResponse{}},
+		httpMiddleware.WrapRole("signing-key", httpmw.RoleReader, s.signingKeyHandler))
+	api.Handle(mux, apidoc.Endpoint{Method: "POST", Path: "/decapsulate", Summary: "カプセル化テキストから暗号化データを復号（平文のSHA-256を返す）", Request: EncryptedData{}, Response: DecryptResponse{}},
+		httpMiddleware.WrapRole("decapsulate", httpmw.RoleOperator, s.chaos.Wrap(s.decapsulateHandler)))
+	api.Handle(mux, apidoc.Endpoint{Method: "POST", Path: "/rotate-key", Summary: "staticモードの鍵ペアを有効期限を待たずに更新（adminのロールが必要）", Response: wire.RotateKeyResponse{}},
+		httpMiddleware.WrapRole("rotate-key", httpmw.RoleAdmin, keyrotation.Handler(s.keys, errorsTotal)))
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/algorithms", Summary: "対応する鍵の保護方式とデータ暗号化方式", Response: wire.AlgorithmsResponse{}},
+		httpMiddleware.WrapRole("algorithms", httpmw.RoleReader, algorithmsHandler))
+	if features.Enabled(features.BatchEndpoint) {
+		api.Handle(mux, apidoc.Endpoint{Method: "POST", Path: "/encapsulate-batch", Summary: "サーバーの鍵にN回カプセル化し、HTTPを含まない合計時間を返す", Request: wire.EncapsulateBatchRequest{}, Response: wire.EncapsulateBatchResponse{}},
+			httpMiddleware.WrapRole("encapsulate-batch", httpmw.RoleOperator, batchEncapsulateHandler))
+	}
+	if features.Enabled(features.KEMEndpoints) {
+		// 登録されたすべてのKEMの鍵交換（/kems、/kems/{name}/public-key、/kems/{name}/decapsulate）
+		kems := kembench.NewHandler()
+		mux.Handle("/kems", httpMiddleware.WrapRole("kems", httpmw.RoleOperator, kems.ServeHTTP))
+		mux.Handle("/kems/", httpMiddleware.WrapRole("kems", httpmw.RoleOperator, kems.ServeHTTP))
+		api.Document(kembench.Endpoints...)
+	}
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/selftest", Summary: "ML-KEM・RSA-OAEPの既知解テストを実行", Response: SelfTestResponse{}},
+		httpMiddleware.WrapRole("selftest", httpmw.RoleOperator, selfTestHandler))
+	if features.Enabled(features.BenchmarkEndpoints) {
+		api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/benchmark/self", Summary: "ML-KEMの脱カプセル化をOSスレッドに固定して繰り返し、1秒あたりの回数を返す（?duration=5s&gomaxprocs=1）", Response: wire.SelfBenchmarkResponse{}},
+			httpMiddleware.WrapRole("benchmark-self", httpmw.RoleOperator, selfbench.Handler(selfBenchmarkPrimitive, prepareSelfBenchmark)))
+		api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/benchmark/load", Summary: "ML-KEMの脱カプセル化を内部のキューから複数のワーカーで最大の速度で処理し、1秒あたりの回数とCPU使用率を返す（?duration=5s&workers=4&queue=8）", Response: wire.LoadBenchmarkResponse{}},
+			httpMiddleware.WrapRole("benchmark-load", httpmw.RoleOperator, selfbench.LoadHandler(selfBenchmarkPrimitive, prepareSelfBenchmark)))
+		api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/benchmark/scaling", Summary: "GOMAXPROCSを1, 2, 4, ...と増やしながらML-KEMの脱カプセル化の負荷計測を繰り返し、並列化の効率を返す（?duration=2s&max=8）", Response: wire.ScalingBenchmarkResponse{}},
+			httpMiddleware.WrapRole("benchmark-scaling", httpmw.RoleOperator, selfbench.ScalingHandler(selfBenchmarkPrimitive, prepareSelfBenchmark)))
+	}
+	if features.Enabled(features.Calibration) {
+		api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/calibrate", Summary: "暗号処理を行わないHTTPとJSONの往復の基準（?size=Nで公開鍵の代わりにNバイトの詰め物を返す）", Response: wire.CalibrateResponse{}},
+			httpMiddleware.WrapRole("calibrate", httpmw.RoleOperator, s.chaos.Wrap(calibration.Handler())))
+		api.Document(apidoc.Endpoint{Method: "POST", Path: "/calibrate", Summary: "暗号化データと同じJSONを受け取り、暗号処理を行わずに受信したサイズを返す", Request: EncryptedData{}, Response: wire.CalibrateResponse{}})
+	}
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/openapi.json", Summary: "OpenAPIによるAPIの説明", ContentType: "application/json"},
+		api.SpecHandler())
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/metrics", Summary: "Prometheusメトリクス"},
+		metrics.Handler())
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/version", Summary: "ビルド情報（バージョン、コミット、Go・circlのバージョン）", Response: metrics.BuildInfo{}},
+		metrics.VersionHandler())
+	api.Handle(mux, apidoc.Endpoint{Method: "GET", Path: "/metrics/selfcheck", Summary: "登録したすべてのメトリクスが登録した型で公開され、値が更新されているかの確認", Response: metrics.SelfCheckReport{}},
+		metrics.SelfCheckHandler())
+	mux.HandleFunc("/", httpMiddleware.WrapRole("index", httpmw.RoleReader, indexHandler(api)))
+	return mux
+}
+
+// インデックスページのハンドラー（エンドポイント一覧から生成する）
+func indexHandler(api *apidoc.API) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		indexRequests.Inc()
+		if err := api.WriteIndex(w); err != nil {
+			errorsTotal.WithLabelValues("index", "network").Inc()
+			log.Println("インデックスページの書き込みエラー:", err)
+		}
+	}
+}
+
+// 対応する方式を返すハンドラー
+// AES鍵はML-KEMの共有秘密鍵から導出した鍵暗号化鍵でラップする（AES-256-GCM）
+func algorithmsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, wire.AlgorithmsResponse{
+		KeyEstablishment: []string{"ML-KEM-768+AES-256-GCM-KeyWrap", "ML-KEM-768+AES-KW"},
+		DataEncryption:   cryptoutil.DataCipherNames(),
+		EnvelopeVersions: wire.SupportedEnvelopeVersions(),
+	})
+}
+
+// JSONレスポンスを書き込む
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		errorsTotal.WithLabelValues("respond", "network").Inc()
+		log.Println("JSONエンコードエラー:", err)
+	}
+}
+
+// 公開鍵を返すハンドラー
+func (s *server) getPublicKeyHandler(w http.ResponseWriter, r *http.Request) {
+	receivedAt := time.Now()
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		errorsTotal.WithLabelValues("public_key", "request").Inc()
+		http.Error(w, "GETとPOSTメソッドのみサポートしています", http.StatusMethodNotAllowed)
+		return
+	}
+	// POSTの場合はクライアントのnonceを公開鍵と結び付けて返す
+	nonce, err := wire.ReadNonce(r)
+	if err != nil {
+		errorsTotal.WithLabelValues("public_key", "request").Inc()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !wire.WriteEnvelopeVersion(w, r) {
+		errorsTotal.WithLabelValues("public_key", "version").Inc()
+		return
+	}
+
+	publicKeyRequests.Inc()
+
+	// 鍵モードに応じて鍵ペアを取得（ephemeralモードでは毎回新しく生成）
+	key, err := s.keys.acquire()
+	if err != nil {
+		errorsTotal.WithLabelValues("keygen", "crypto").Inc()
+		http.Error(w, "鍵生成に失敗しました", http.StatusInternalServerError)
+		log.Println("鍵生成エラー:", err)
+		return
+	}
+
+	if s.cacheablePublicKey(nonce) {
+		s.writeCachedPublicKey(w, r, key, receivedAt)
+		return
+	}
+	publicKeyCache.WithLabelValues("bypass").Inc()
+	w.Header().Set("Cache-Control", "no-store")
+
+	response, err := s.newPublicKeyResponse(r, key, nonce)
+	if err != nil {
+		publicKeyResponseError(w, err)
+		return
+	}
+	response.ServerTiming = wire.NewServerTiming(receivedAt)
+	writeJSON(w, http.StatusOK, response)
+
+	log.Printf("ML-KEM公開鍵を送信しました (クライアント: %s)\n", r.RemoteAddr)
+}
+
+// 公開鍵の署名の失敗（公開鍵のエンコードの失敗と区別する）
+var errSignResponse = errors.New("公開鍵の署名に失敗しました")
+
+// 公開鍵のレスポンスを作る（nonceがある場合は公開鍵と結び付け、署名鍵があれば署名する）
+// 署名はrに対する操作として監査ログに記録する
+func (s *server) newPublicKeyResponse(r *http.Request, key *keyPair, nonce []byte) (PublicKeyResponse, error) {
+	// 公開鍵をバイナリ形式にシリアライズ
+	pubKeyBytes, err := key.publicKey.MarshalBinary()
+	if err != nil {
+		return PublicKeyResponse{}, err
+	}
+	response := PublicKeyResponse{
+		PublicKey: base64.StdEncoding.EncodeToString(s.chaos.CorruptKey(pubKeyBytes)),
+		KeyID:     key.id,
+		Algorithm: "ML-KEM-768 (Kyber-768)",
+		KeySize:   len(pubKeyBytes),
+		KeyMode:   s.keys.mode,
+	}
+	// 破損を検出できるように、結び付ける値は注入する破損の前の公開鍵から作る
+	response.Bind(nonce, pubKeyBytes)
+	if s.signingKey != nil {
+		err := s.signingKey.signResponse(&response, nonce, pubKeyBytes)
+		s.audit.Record(r, auditlog.Event{Service: ServiceName, Operation: auditlog.OperationSign, KeyID: s.signingKey.id, Algorithm: wire.SignatureAlgorithmMLDSA65, Err: err})
+		if err != nil {
+			return PublicKeyResponse{}, fmt.Errorf("%w: %v", errSignResponse, err)
+		}
+	}
+	return response, nil
+}
+
+// 公開鍵のレスポンスを作れなかった場合に500を返す
+func publicKeyResponseError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errSignResponse) {
+		errorsTotal.WithLabelValues("sign", "crypto").Inc()
+		http.Error(w, "公開鍵の署名に失敗しました", http.StatusInternalServerError)
+		log.Println("署名エラー:", err)
+		return
+	}
+	errorsTotal.WithLabelValues("marshal", "encode").Inc()
+	http.Error(w, "公開鍵のエンコードに失敗しました", http.StatusInternalServerError)
+	log.Println("公開鍵エンコードエラー:", err)
+}
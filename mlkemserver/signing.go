@@ -0,0 +1,118 @@
+package mlkemserver
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/cloudflare/circl/sign/mldsa/mldsa65"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	signingDuration = factory.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "mlkem_server_signing_duration_seconds",
+			Help:    "Histogram of the time to sign a public key response with the long-term ML-DSA-65 key in seconds",
+			Buckets: []float64{0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01},
+		},
+	)
+	signatureSize = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "mlkem_server_signature_size_bytes",
+			Help: "Size of the ML-DSA-65 signature attached to each public key response in bytes",
+		},
+	)
+)
+
+// 公開鍵のレスポンスに署名する長期署名鍵（ML-DSA-65）
+// ML-KEMの鍵ペアはephemeralモードでは毎回変わるため、クライアントはこの鍵で公開鍵の出所を確認する
+type SigningKey struct {
+	id          string // 公開鍵のSHA-256の先頭8バイト（16進数、監査ログで使う）
+	priv        *mldsa65.PrivateKey
+	publicBytes []byte
+}
+
+// 新しい署名鍵を生成する（プロセスを再起動すると変わる）
+func GenerateSigningKey() (*SigningKey, error) {
+	var seed [mldsa65.SeedSize]byte
+	if _, err := rand.Read(seed[:]); err != nil {
+		return nil, fmt.Errorf("署名鍵のシードの生成エラー: %w", err)
+	}
+	return newSigningKey(&seed), nil
+}
+
+// ファイルに保存したシードから署名鍵を読み込む
+// ファイルがない場合は新しいシードを生成して保存する（再起動しても同じ鍵を使い続けられる）
+func LoadSigningKey(path string) (*SigningKey, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		var seed [mldsa65.SeedSize]byte
+		if _, err := rand.Read(seed[:]); err != nil {
+			return nil, fmt.Errorf("署名鍵のシードの生成エラー: %w", err)
+		}
+		if err := os.WriteFile(path, seed[:], 0o600); err != nil {
+			return nil, fmt.Errorf("署名鍵の保存エラー: %w", err)
+		}
+		log.Printf("新しい署名鍵を生成して保存しました: %s", path)
+		return newSigningKey(&seed), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("署名鍵の読み込みエラー: %w", err)
+	}
+	if len(b) != mldsa65.SeedSize {
+		return nil, fmt.Errorf("署名鍵のファイルは%dバイトのシードである必要があります: %dバイト", mldsa65.SeedSize, len(b))
+	}
+	return newSigningKey((*[mldsa65.SeedSize]byte)(b)), nil
+}
+
+func newSigningKey(seed *[mldsa65.SeedSize]byte) *SigningKey {
+	pub, priv := mldsa65.NewKeyFromSeed(seed)
+	publicBytes := pub.Bytes()
+	sum := sha256.Sum256(publicBytes)
+	return &SigningKey{id: hex.EncodeToString(sum[:8]), priv: priv, publicBytes: publicBytes}
+}
+
+// 署名鍵の公開鍵（Base64）
+func (k *SigningKey) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(k.publicBytes)
+}
+
+// レスポンスのnonce・鍵ID・公開鍵（破損を注入する前の値）を結び付けた値に署名する
+func (k *SigningKey) signResponse(p *PublicKeyResponse, nonce, publicKey []byte) error {
+	start := time.Now()
+	sig := make([]byte, mldsa65.SignatureSize)
+	if err := mldsa65.SignTo(k.priv, wire.KeyBinding(nonce, p.KeyID, publicKey), []byte(wire.SignatureContext), true, sig); err != nil {
+		return err
+	}
+	signingDuration.Observe(time.Since(start).Seconds())
+	signatureSize.Set(float64(len(sig)))
+	p.Signature = base64.StdEncoding.EncodeToString(sig)
+	p.SignatureAlgorithm = wire.SignatureAlgorithmMLDSA65
+	return nil
+}
+
+// 署名鍵の公開鍵を返すハンドラー
+func (s *server) signingKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "GETメソッドのみサポートしています", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.signingKey == nil {
+		http.Error(w, "署名鍵がありません", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, http.StatusOK, wire.SigningKeyResponse{
+		PublicKey: s.signingKey.PublicKey(),
+		Algorithm: wire.SignatureAlgorithmMLDSA65,
+	})
+}
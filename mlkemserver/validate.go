@@ -0,0 +1,86 @@
+package mlkemserver
+
+import (
+	"crypto/aes"
+	"errors"
+	"net/http"
+
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/keyi1000/PQC_grafana/replay"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var validationFailures = factory.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "mlkem_server_validation_failures_total",
+		Help: "Total number of decapsulate requests rejected by input validation before decapsulation, by field and reason (malformed, invalid_length)",
+	},
+	[]string{"field", "reason"},
+)
+
+// Base64をデコードし、長さを検証した復号要求のフィールド
+type decryptFields struct {
+	keyWrap                                          string // データ鍵のラップ方式（aes-gcm、aes-kw）
+	kemCiphertext, encryptedKey, ciphertext, iv, tag []byte
+}
+
+// 復号要求のフィールドをデコードし、ML-KEM-768とデータ暗号化方式の長さと一致するかを検証する
+func decodeDecryptFields(req *EncryptedData, dataCipher cryptoutil.DataCipher) (decryptFields, error) {
+	var f decryptFields
+	var err error
+	if f.keyWrap, err = cryptoutil.NormalizeKeyWrap(req.KeyWrap); err != nil {
+		return f, &wire.ErrorResponse{Code: wire.ErrorCodeUnsupportedAlgorithm, Field: "key_wrap", Message: "サポートしていない鍵のラップ方式です"}
+	}
+	if f.kemCiphertext, err = wire.DecodeField("kem_ciphertext", req.KEMCiphertext); err != nil {
+		return f, err
+	}
+	if f.encryptedKey, err = wire.DecodeField("encrypted_aes_key", req.EncryptedAESKey); err != nil {
+		return f, err
+	}
+	if f.ciphertext, err = wire.DecodeField("encrypted_message", req.EncryptedMessage); err != nil {
+		return f, err
+	}
+	if f.iv, err = wire.DecodeField("iv", req.IV); err != nil {
+		return f, err
+	}
+	if f.tag, err = wire.DecodeField("mac", req.MAC); err != nil {
+		return f, err
+	}
+	return f, errors.Join(
+		wire.CheckLength("kem_ciphertext", f.kemCiphertext, kyber768.CiphertextSize),
+		wire.CheckLength("encrypted_aes_key", f.encryptedKey, cryptoutil.WrappedKeySizeWith(f.keyWrap, dataCipher.KeySize)),
+		wire.CheckLength("iv", f.iv, dataCipher.IVSize),
+		wire.CheckLength("mac", f.tag, dataCipher.TagSize),
+		checkPadded(dataCipher, f.ciphertext),
+	)
+}
+
+// 検証に失敗した復号要求を拒否する（最初に失敗したフィールドをエラーレスポンスで返す）
+func (s *server) rejectInvalid(w http.ResponseWriter, err error) {
+	var invalid *wire.ErrorResponse
+	if !errors.As(err, &invalid) {
+		invalid = &wire.ErrorResponse{Code: wire.ErrorCodeMalformed, Message: err.Error()}
+	}
+	validationFailures.WithLabelValues(invalid.Field, invalid.Code).Inc()
+	s.rejectDecrypt(w, invalid.Code, http.StatusBadRequest, *invalid)
+}
+
+// 再送の検出で拒否する（nonce・時刻がない要求は検証の失敗として数える）
+func (s *server) rejectReplay(w http.ResponseWriter, err error) {
+	switch status, resp := replay.Response(err); resp.Code {
+	case wire.ErrorCodeReplay, wire.ErrorCodeStale, wire.ErrorCodeReplayCacheFull:
+		s.rejectDecrypt(w, resp.Code, status, resp)
+	default:
+		s.rejectInvalid(w, &resp)
+	}
+}
+
+// パディングする方式（AES-CBC）では暗号文がブロック長の正の倍数かを検証する（AEADは任意の長さ）
+func checkPadded(dataCipher cryptoutil.DataCipher, ciphertext []byte) error {
+	if !dataCipher.Padded {
+		return nil
+	}
+	return wire.CheckBlocks("encrypted_message", ciphertext, aes.BlockSize)
+}
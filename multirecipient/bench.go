@@ -0,0 +1,214 @@
+// Package multirecipient は1つのAES鍵をN人の受信者（N個のRSA公開鍵、またはN個のML-KEM公開鍵）向けに保護し、
+// 受信者数に対する鍵の保護にかかる時間とCMS（EnvelopedData）のサイズを比較するベンチマークを提供する
+//
+// グループメッセージやメールの同報のように受信者ごとに暗号化した鍵を付ける用途では、
+// 受信者1人あたりのサイズの差が受信者数の分だけ積み上がる
+package multirecipient
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+	"github.com/keyi1000/PQC_grafana/cms"
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "multi-recipient-bench"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は multi_recipient_）
+var factory = metrics.NewFactory(ServiceName, "multi_recipient_")
+
+// 鍵の保護方式（クライアントのalgorithmラベルと同じ値）
+const (
+	AlgorithmRSA   = "rsa"
+	AlgorithmMLKEM = "mlkem"
+)
+
+var (
+	wrapDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "multi_recipient_wrap_duration_seconds",
+			Help:    "Histogram of the time to wrap one AES key for all recipients in seconds, by algorithm and recipient count",
+			Buckets: []float64{0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25},
+		},
+		[]string{"algorithm", "recipients"},
+	)
+	envelopeSize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "multi_recipient_envelope_size_bytes",
+			Help: "Size of the CMS EnvelopedData carrying the message for all recipients in bytes, by algorithm and recipient count",
+		},
+		[]string{"algorithm", "recipients"},
+	)
+	perRecipientSize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "multi_recipient_per_recipient_bytes",
+			Help: "Envelope size minus the size of an envelope without recipients, divided by the recipient count, by algorithm and recipient count",
+		},
+		[]string{"algorithm", "recipients"},
+	)
+	envelopeSizeRatio = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "multi_recipient_envelope_size_ratio",
+			Help: "Ratio of ML-KEM to RSA envelope size (ML-KEM / RSA), by recipient count",
+		},
+		[]string{"recipients"},
+	)
+	envelopesTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "multi_recipient_envelopes_total",
+			Help: "Total number of multi-recipient envelopes, by algorithm and result",
+		},
+		[]string{"algorithm", "result"},
+	)
+)
+
+// RSAサーバーと同じ鍵長
+const rsaKeySize = 2048
+
+// 受信者数の上限（鍵の生成に時間がかかるため）
+const MaxRecipients = 1000
+
+// ベンチマークの設定
+type Config struct {
+	Interval   time.Duration // 計測する間隔
+	Recipients []int         // 計測する受信者数
+	Message    string        // 暗号化するメッセージ
+}
+
+// デフォルト設定
+func DefaultConfig() Config {
+	return Config{
+		Interval:   time.Second,
+		Recipients: []int{1, 2, 5, 10, 20, 50, 100},
+		Message:    "量子コンピュータに対抗するポスト量子暗号",
+	}
+}
+
+// 受信者数のリストを解釈する（例: "1,10,100"）
+func ParseRecipients(s string) ([]int, error) {
+	var counts []int
+	for _, field := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 1 || n > MaxRecipients {
+			return nil, fmt.Errorf("受信者数は1〜%dで指定してください: %q", MaxRecipients, field)
+		}
+		counts = append(counts, n)
+	}
+	if len(counts) == 0 {
+		return nil, fmt.Errorf("受信者数を指定してください")
+	}
+	slices.Sort(counts)
+	return slices.Compact(counts), nil
+}
+
+// 受信者の鍵
+type recipient struct {
+	keyID    []byte
+	rsaKey   *rsa.PublicKey
+	mlkemKey *kyber768.PublicKey
+}
+
+// 一定間隔ですべての受信者数について、RSAとML-KEMでAES鍵を保護したEnvelopedDataを作成する
+func Run(cfg Config) error {
+	if len(cfg.Recipients) == 0 {
+		return fmt.Errorf("受信者数を指定してください")
+	}
+	recipients, err := newRecipients(slices.Max(cfg.Recipients))
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, n := range cfg.Recipients {
+			sizes := make(map[string]int)
+			for _, algorithm := range []string{AlgorithmRSA, AlgorithmMLKEM} {
+				size, err := benchmark(algorithm, recipients[:n], []byte(cfg.Message))
+				if err != nil {
+					envelopesTotal.WithLabelValues(algorithm, "failure").Inc()
+					log.Printf("%d人の受信者への暗号化に失敗 [%s]: %v", n, algorithm, err)
+					continue
+				}
+				envelopesTotal.WithLabelValues(algorithm, "success").Inc()
+				sizes[algorithm] = size
+			}
+			if sizes[AlgorithmRSA] > 0 && sizes[AlgorithmMLKEM] > 0 {
+				envelopeSizeRatio.WithLabelValues(strconv.Itoa(n)).Set(float64(sizes[AlgorithmMLKEM]) / float64(sizes[AlgorithmRSA]))
+			}
+		}
+	}
+	return nil
+}
+
+// 受信者ごとのRSA鍵とML-KEM鍵を生成する（秘密鍵は使わないので保持しない）
+func newRecipients(n int) ([]recipient, error) {
+	log.Printf("%d人分の受信者の鍵（RSA-%d、ML-KEM-768）を生成しています...", n, rsaKeySize)
+	recipients := make([]recipient, n)
+	for i := range recipients {
+		rsaKey, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+		if err != nil {
+			return nil, fmt.Errorf("RSA鍵生成エラー: %w", err)
+		}
+		mlkemKey, _, err := kyber768.GenerateKeyPair(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("ML-KEM鍵生成エラー: %w", err)
+		}
+		id := sha256.Sum256(fmt.Appendf(nil, "recipient-%d", i))
+		recipients[i] = recipient{keyID: id[:20], rsaKey: &rsaKey.PublicKey, mlkemKey: mlkemKey}
+	}
+	return recipients, nil
+}
+
+// 1つのAES鍵をすべての受信者向けに保護してEnvelopedDataを作成し、サイズを返す
+func benchmark(algorithm string, recipients []recipient, plaintext []byte) (int, error) {
+	cek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, cek); err != nil {
+		return 0, fmt.Errorf("AES鍵の生成エラー: %w", err)
+	}
+	defer cryptoutil.Zeroize(cek)
+
+	start := time.Now()
+	infos := make([]cms.RecipientInfo, len(recipients))
+	for i, r := range recipients {
+		var err error
+		if algorithm == AlgorithmRSA {
+			infos[i], err = cms.WrapForRSA(r.rsaKey, r.keyID, cek)
+		} else {
+			infos[i], err = cms.WrapForMLKEM(r.mlkemKey, r.keyID, cek)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("鍵の保護エラー: %w", err)
+		}
+	}
+	elapsed := time.Since(start)
+
+	envelope, err := cms.Envelope(infos, cek, plaintext)
+	if err != nil {
+		return 0, fmt.Errorf("EnvelopedDataの作成エラー: %w", err)
+	}
+	// 受信者のいないEnvelopedDataとの差から、受信者1人あたりのサイズを求める（本文と共通部分を除く）
+	empty, err := cms.Envelope(nil, cek, plaintext)
+	if err != nil {
+		return 0, fmt.Errorf("EnvelopedDataの作成エラー: %w", err)
+	}
+
+	n := strconv.Itoa(len(recipients))
+	wrapDuration.WithLabelValues(algorithm, n).Observe(elapsed.Seconds())
+	envelopeSize.WithLabelValues(algorithm, n).Set(float64(len(envelope)))
+	perRecipientSize.WithLabelValues(algorithm, n).Set(float64(len(envelope)-len(empty)) / float64(len(recipients)))
+	return len(envelope), nil
+}
@@ -0,0 +1,251 @@
+// Package netem はTCP接続に人工的な遅延とパケットロスを加え、損失のあるネットワークを模擬する
+//
+// 送受信するバイト列をMSSごとのパケットとみなし、パケットごとに確率で損失させて再送待ち（RTO）の遅延を加える。
+// PQCの大きな鍵や暗号文はパケット数が多いため、損失の影響を受けやすいことをダッシュボードで確認するために使う
+package netem
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "netem"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は netem_）
+var factory = metrics.NewFactory(ServiceName, "netem_")
+
+// 通信の方向
+const (
+	DirectionSend    = "send"
+	DirectionReceive = "receive"
+)
+
+// 加えた遅延の種類
+const (
+	KindLatency   = "latency"
+	KindLoss      = "loss"
+	KindBandwidth = "bandwidth"
+)
+
+var (
+	packetsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "netem_packets_total",
+			Help: "Total number of emulated packets, by direction (send, receive)",
+		},
+		[]string{"direction"},
+	)
+	lostPacketsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "netem_lost_packets_total",
+			Help: "Total number of emulated packet losses including lost retransmissions, by direction",
+		},
+		[]string{"direction"},
+	)
+	delaySeconds = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "netem_delay_seconds_total",
+			Help: "Total injected delay in seconds, by direction and kind (latency, loss or bandwidth)",
+		},
+		[]string{"direction", "kind"},
+	)
+	connectionsTotal = factory.NewCounter(
+		prometheus.CounterOpts{
+			Name: "netem_connections_total",
+			Help: "Total number of connections dialed through the network emulator",
+		},
+	)
+)
+
+// 模擬するネットワークの設定（すべて0の場合は模擬しない）
+type Config struct {
+	Latency   time.Duration // 片道の遅延（往復では2倍になる）
+	Jitter    time.Duration // 片道の遅延に加える一様なゆらぎの最大値
+	LossRate  float64       // パケットを損失させる確率
+	MSS       int           // パケットに分割する大きさ（0の場合は1460）
+	RTO       time.Duration // 損失したパケットの再送までの時間（再送も損失すると2倍にする、0の場合は200ms）
+	Bandwidth int           // 帯域（バイト/秒、0の場合は制限しない）
+}
+
+// 既定のMSSとRTO（Linuxの最小RTO）
+const (
+	defaultMSS = 1460
+	defaultRTO = 200 * time.Millisecond
+)
+
+// 設定を検証する
+func (c Config) Validate() error {
+	if c.Latency < 0 || c.Jitter < 0 || c.RTO < 0 {
+		return fmt.Errorf("遅延・ゆらぎ・RTOに負の値は指定できません: %v, %v, %v", c.Latency, c.Jitter, c.RTO)
+	}
+	if c.LossRate < 0 || c.LossRate >= 1 {
+		return fmt.Errorf("パケットを損失させる確率は0以上1未満で指定してください: %v", c.LossRate)
+	}
+	if c.MSS < 0 || c.Bandwidth < 0 {
+		return fmt.Errorf("MSSと帯域に負の値は指定できません: %d, %d", c.MSS, c.Bandwidth)
+	}
+	return nil
+}
+
+// いずれかの模擬を行うか
+func (c Config) Enabled() bool {
+	return c.Latency > 0 || c.Jitter > 0 || c.LossRate > 0 || c.Bandwidth > 0
+}
+
+// -netem-* フラグを登録する（prefixは対象を区別する場合に使う）
+func (c *Config) RegisterFlags(fs *flag.FlagSet, prefix string) {
+	fs.DurationVar(&c.Latency, "netem-"+prefix+"latency", c.Latency, "【ネットワーク模擬】片道の遅延（往復では2倍）")
+	fs.DurationVar(&c.Jitter, "netem-"+prefix+"jitter", c.Jitter, "【ネットワーク模擬】片道の遅延に加えるゆらぎの最大値")
+	fs.Float64Var(&c.LossRate, "netem-"+prefix+"loss-rate", c.LossRate, "【ネットワーク模擬】パケットを損失させる確率（0〜1未満、損失ごとにRTOの再送待ちを加える）")
+	fs.IntVar(&c.MSS, "netem-"+prefix+"mss", c.MSS, "【ネットワーク模擬】パケットに分割する大きさ（バイト、0の場合は1460）")
+	fs.DurationVar(&c.RTO, "netem-"+prefix+"rto", c.RTO, "【ネットワーク模擬】損失したパケットを再送するまでの時間（0の場合は200ms）")
+	fs.IntVar(&c.Bandwidth, "netem-"+prefix+"bandwidth", c.Bandwidth, "【ネットワーク模擬】帯域（バイト/秒、0の場合は制限しない）")
+}
+
+// 接続を確立する関数（net.Dialer.DialContextやhttp.Transport.DialContextと同じ形）
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// 接続に遅延と損失を加える（nilの場合は何もしない）
+type Emulator struct {
+	cfg Config
+}
+
+// 模擬しない設定の場合はnilを返す
+func New(cfg Config) *Emulator {
+	if !cfg.Enabled() {
+		return nil
+	}
+	if cfg.MSS == 0 {
+		cfg.MSS = defaultMSS
+	}
+	if cfg.RTO == 0 {
+		cfg.RTO = defaultRTO
+	}
+	return &Emulator{cfg: cfg}
+}
+
+// dialで確立した接続を模擬する接続で包む
+func (e *Emulator) Dial(dial DialFunc) DialFunc {
+	if e == nil {
+		return dial
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		c, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		connectionsTotal.Inc()
+		return &conn{Conn: c, e: e}, nil
+	}
+}
+
+// 模擬する接続の場合は元の接続を返す
+func Unwrap(c net.Conn) net.Conn {
+	if mc, ok := c.(*conn); ok {
+		return mc.Conn
+	}
+	return c
+}
+
+// 遅延と損失を加える接続
+// 送信と受信が切り替わるたびに新しいフライトとして片道の遅延を加え、パケットごとに損失を判定する
+type conn struct {
+	net.Conn
+	e *Emulator
+
+	mu       sync.Mutex
+	lastSend bool // 直前の操作が送信だったか
+	started  bool
+	sent     int // 送信したバイト数（パケットの境界の判定に使う）
+	received int
+}
+
+// 送信するデータに遅延を加えてから送る
+func (c *conn) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		time.Sleep(c.advance(DirectionSend, len(p)))
+	}
+	return c.Conn.Write(p)
+}
+
+// 受信したデータに遅延を加えてから返す
+func (c *conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		time.Sleep(c.advance(DirectionReceive, n))
+	}
+	return n, err
+}
+
+// nバイトの送受信で加える遅延を決めて記録する
+func (c *conn) advance(direction string, n int) time.Duration {
+	send := direction == DirectionSend
+	c.mu.Lock()
+	newFlight := !c.started || c.lastSend != send
+	c.started, c.lastSend = true, send
+	total := &c.received
+	if send {
+		total = &c.sent
+	}
+	mss := c.e.cfg.MSS
+	// 前回の続きのパケットは数えず、新しく始まるパケットだけを数える
+	packets := (*total+n+mss-1)/mss - (*total+mss-1)/mss
+	*total += n
+	c.mu.Unlock()
+
+	var delay time.Duration
+	if newFlight {
+		delay += c.e.latency(direction)
+	}
+	delay += c.e.loss(direction, packets)
+	delay += c.e.serialization(direction, n)
+	packetsTotal.WithLabelValues(direction).Add(float64(packets))
+	return delay
+}
+
+// フライトの片道の遅延
+func (e *Emulator) latency(direction string) time.Duration {
+	d := e.cfg.Latency
+	if e.cfg.Jitter > 0 {
+		d += rand.N(2*e.cfg.Jitter+1) - e.cfg.Jitter
+	}
+	d = max(d, 0)
+	delaySeconds.WithLabelValues(direction, KindLatency).Add(d.Seconds())
+	return d
+}
+
+// パケットごとに損失を判定し、再送待ちの遅延を合計する
+func (e *Emulator) loss(direction string, packets int) time.Duration {
+	if e.cfg.LossRate <= 0 {
+		return 0
+	}
+	var d time.Duration
+	for range packets {
+		// 再送も損失すると、指数バックオフでRTOを2倍にする
+		for rto := e.cfg.RTO; rand.Float64() < e.cfg.LossRate; rto *= 2 {
+			lostPacketsTotal.WithLabelValues(direction).Inc()
+			d += rto
+		}
+	}
+	delaySeconds.WithLabelValues(direction, KindLoss).Add(d.Seconds())
+	return d
+}
+
+// 帯域の制限でnバイトの送信にかかる時間
+func (e *Emulator) serialization(direction string, n int) time.Duration {
+	if e.cfg.Bandwidth <= 0 {
+		return 0
+	}
+	d := time.Duration(float64(n) / float64(e.cfg.Bandwidth) * float64(time.Second))
+	delaySeconds.WithLabelValues(direction, KindBandwidth).Add(d.Seconds())
+	return d
+}
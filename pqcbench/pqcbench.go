@@ -0,0 +1,71 @@
+// Package pqcbench はRSAとML-KEMのハイブリッド暗号化の計測ループを、
+// 他のGoのプログラムから組み込んで使うためのAPIを提供する
+//
+//	reg := prometheus.NewRegistry()
+//	cfg := pqcbench.DefaultConfig()
+//	cfg.Registerer, cfg.Gatherer = reg, reg
+//	runner, err := pqcbench.NewRunner(cfg)
+//	http.Handle("/metrics", promhttp.HandlerFor(runner.Gatherer(), promhttp.HandlerOpts{}))
+//	err = runner.Run(ctx)
+//
+// 計測の状態とメトリクスはプロセスで共有するため、同時に実行できるRunnerは1つだけ
+package pqcbench
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/keyi1000/PQC_grafana/benchclient"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 計測の設定（aes-clientのフラグと同じ項目と、メトリクスを登録する組み込む側のレジストリ）
+type Config struct {
+	benchclient.Config
+
+	// 計測のメトリクスを登録するレジストリ（nilの場合はパッケージのレジストリのみに登録し、Runner.Gathererで公開する）
+	Registerer prometheus.Registerer
+	// Runner.Gathererが返すレジストリ（nilの場合はパッケージのレジストリ、通常はRegistererと同じレジストリを指定する）
+	Gatherer prometheus.Gatherer
+}
+
+// 既定の設定（docker-compose環境のサーバーのURL）
+func DefaultConfig() Config {
+	return Config{Config: benchclient.DefaultConfig()}
+}
+
+// 計測ループ
+type Runner struct {
+	cfg Config
+}
+
+// 計測ループを作る（cfg.Registererを指定した場合は計測のメトリクスを登録し、登録できない場合はエラーを返す）
+func NewRunner(cfg Config) (*Runner, error) {
+	if cfg.Registerer != nil {
+		if err := metrics.Register(cfg.Registerer); err != nil {
+			return nil, err
+		}
+	}
+	return &Runner{cfg: cfg}, nil
+}
+
+// ctxがキャンセルされるまで計測を繰り返す
+// 設定が不正な場合や他のRunnerが実行中の場合はエラーを、キャンセルされた場合はctx.Err()を返す
+func (r *Runner) Run(ctx context.Context) error {
+	return benchclient.RunContext(ctx, r.cfg.Config)
+}
+
+// 計測のメトリクス（aes-clientの/metricsと同じ名前とラベル）
+// cfg.Gathererを指定した場合はそのレジストリを、指定していない場合はパッケージのレジストリを返す
+func (r *Runner) Gatherer() prometheus.Gatherer {
+	if r.cfg.Gatherer != nil {
+		return r.cfg.Gatherer
+	}
+	return metrics.Gatherer()
+}
+
+// aes-clientのメトリクスサーバーと同じハンドラー（/metrics、/version、/metrics/selfcheck、/config、/admin）
+func (r *Runner) Handler() http.Handler {
+	return benchclient.MetricsServerMux()
+}
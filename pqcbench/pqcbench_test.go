@@ -0,0 +1,57 @@
+package pqcbench
+
+import (
+	"testing"
+
+	"github.com/keyi1000/PQC_grafana/benchclient"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 組み込む側のレジストリに計測のメトリクスが登録され、Gathererで取得できることを確かめる
+func TestNewRunnerRegistersCollectors(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	cfg := DefaultConfig()
+	cfg.Registerer, cfg.Gatherer = reg, reg
+	runner, err := NewRunner(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runner.Gatherer() != prometheus.Gatherer(reg) {
+		t.Fatal("Gathererが設定したレジストリではありません")
+	}
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, f := range families {
+		if f.GetName() == "go_goroutines" {
+			t.Error("Goランタイムのメトリクスを登録しました")
+		}
+		// 値のないベクトルは出力されないため、ラベルのないメトリクスのserviceラベルで確かめる
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "service" && l.GetValue() == benchclient.ServiceName {
+					found = true
+				}
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("%sのメトリクスが登録されていません", benchclient.ServiceName)
+	}
+	// 同じレジストリにもう一度登録するとエラーになる
+	if _, err := NewRunner(cfg); err == nil {
+		t.Fatal("重複した登録でエラーになりません")
+	}
+}
+
+func TestGathererDefault(t *testing.T) {
+	runner, err := NewRunner(DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runner.Gatherer() == nil {
+		t.Fatal("Gathererがnilです")
+	}
+}
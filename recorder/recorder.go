@@ -0,0 +1,159 @@
+// Package recorder は「今収集して後で解読する」（Harvest Now, Decrypt Later）攻撃者を模擬し、
+// サーバーに送られる暗号化データを盗聴・保存してメトリクスとして記録する
+//
+// 公開鍵暗号（RSA）だけで保護されたデータは、将来の量子コンピュータで解読できるため「危険なデータ」として数える
+package recorder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "recorder"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は recorder_）
+var factory = metrics.NewFactory(ServiceName, "recorder_")
+
+// AES鍵の保護方式
+const (
+	ProtectionClassical   = "classical"    // RSAなど古典的な公開鍵暗号のみ（量子コンピュータで解読可能）
+	ProtectionPostQuantum = "post_quantum" // ML-KEMで保護されている
+)
+
+var (
+	capturedMessages = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "recorder_captured_messages_total",
+			Help: "Total number of encrypted messages captured, by key protection",
+		},
+		[]string{"protection"},
+	)
+	capturedBytes = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "recorder_captured_bytes_total",
+			Help: "Total size of captured encrypted requests on the wire in bytes, by key protection",
+		},
+		[]string{"protection"},
+	)
+	dataAtRiskBytes = factory.NewCounter(
+		prometheus.CounterOpts{
+			Name: "recorder_data_at_risk_bytes_total",
+			Help: "Total ciphertext bytes recorded whose key is protected only by classical public key crypto (decryptable later by a quantum computer)",
+		},
+	)
+	dataProtectedBytes = factory.NewCounter(
+		prometheus.CounterOpts{
+			Name: "recorder_data_protected_bytes_total",
+			Help: "Total ciphertext bytes recorded whose key is protected by post-quantum crypto",
+		},
+	)
+	dataAtRiskRatio = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "recorder_data_at_risk_ratio",
+			Help: "Share of recorded ciphertext bytes that are at risk (at risk / all recorded)",
+		},
+	)
+)
+
+// 盗聴した暗号化データのうち、記録に必要な項目
+type capturedEnvelope struct {
+	KEMCiphertext    string `json:"kem_ciphertext"`
+	EncryptedMessage string `json:"encrypted_message"`
+}
+
+// 保存する記録
+type record struct {
+	CapturedAt time.Time       `json:"captured_at"`
+	Path       string          `json:"path"`
+	Protection string          `json:"protection"`
+	Envelope   json.RawMessage `json:"envelope"`
+}
+
+// 盗聴したデータを記録する
+type Recorder struct {
+	mu        sync.Mutex
+	out       io.Writer // 記録の保存先（nilの場合はメトリクスのみ）
+	atRisk    int64
+	protected int64
+}
+
+// 記録を保存するRecorderを作成（outがnilの場合はメトリクスのみ記録する）
+func New(out io.Writer) *Recorder {
+	return &Recorder{out: out}
+}
+
+// ハンドラーの前で暗号化データを盗聴するミドルウェア
+// リクエストはそのまま次のハンドラーに渡すため、通信には影響しない
+func (rec *Recorder) Tap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.Body != nil {
+			body, err := io.ReadAll(r.Body)
+			r.Body.Close()
+			if err != nil {
+				http.Error(w, "リクエストの読み込みに失敗しました", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			rec.capture(r.URL.Path, body)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// 転送先のサーバーとの間に入って盗聴するリバースプロキシを作成
+func (rec *Recorder) Proxy(target *url.URL) http.Handler {
+	return rec.Tap(httputil.NewSingleHostReverseProxy(target))
+}
+
+// 暗号化データを分類して記録する
+func (rec *Recorder) capture(path string, body []byte) {
+	var env capturedEnvelope
+	if err := json.Unmarshal(body, &env); err != nil || env.EncryptedMessage == "" {
+		return
+	}
+	payload, err := base64.StdEncoding.DecodeString(env.EncryptedMessage)
+	if err != nil {
+		return
+	}
+
+	protection := ProtectionClassical
+	if env.KEMCiphertext != "" {
+		protection = ProtectionPostQuantum
+	}
+	capturedMessages.WithLabelValues(protection).Inc()
+	capturedBytes.WithLabelValues(protection).Add(float64(len(body)))
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if protection == ProtectionClassical {
+		rec.atRisk += int64(len(payload))
+		dataAtRiskBytes.Add(float64(len(payload)))
+	} else {
+		rec.protected += int64(len(payload))
+		dataProtectedBytes.Add(float64(len(payload)))
+	}
+	dataAtRiskRatio.Set(float64(rec.atRisk) / float64(rec.atRisk+rec.protected))
+
+	if rec.out == nil {
+		return
+	}
+	line, err := json.Marshal(record{CapturedAt: time.Now(), Path: path, Protection: protection, Envelope: body})
+	if err != nil {
+		return
+	}
+	if _, err := rec.out.Write(append(line, '\n')); err != nil {
+		log.Println("記録の保存エラー:", err)
+	}
+}
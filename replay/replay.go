@@ -0,0 +1,306 @@
+// Package replay は復号エンドポイント（/decrypt、/decapsulate）に同じ暗号化データが再送されたことを検出する
+//
+// クライアントは暗号化データごとに新しいrequest_nonceと作成時刻のtimestampを付ける。
+// サーバーは許容する時間の範囲外の時刻を拒否し、範囲内で既に見たnonceと暗号化データの指紋を拒否する。
+// 形式の版1の暗号化データはnonceと時刻を認証しないため、nonceだけを書き換えた再送も検出できるように、
+// 改ざんすると復号できなくなる鍵の保護部分（カプセル化テキスト・一時公開鍵・保護したAES鍵・KEK）とIV・MACの指紋も記録する
+package replay
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// サービス名（メトリクスのserviceラベル）
+const ServiceName = "replay"
+
+var factory = metrics.NewFactory(ServiceName, "replay_")
+
+// 拒否の理由（メトリクスのreasonラベル）
+const (
+	ReasonMissing           = "missing"            // request_nonceまたはtimestampがない
+	ReasonStale             = "stale"              // timestampが許容する時間の範囲外
+	ReasonDuplicateNonce    = "duplicate_nonce"    // 既に見たrequest_nonce
+	ReasonDuplicateEnvelope = "duplicate_envelope" // nonceは異なるが、既に見た暗号化データ
+	ReasonCacheFull         = "cache_full"         // 記録が一杯で、時刻の範囲内の記録を捨てなければ覚えられない
+)
+
+// 既定の記録する数の上限
+const DefaultCacheSize = 100000
+
+var (
+	rejectedTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "replay_rejected_total",
+			Help: "Total number of decryption requests rejected by replay protection, by origin service and reason (missing, stale, duplicate_nonce, duplicate_envelope, cache_full)",
+		},
+		[]string{"origin_service", "reason"},
+	)
+	acceptedTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "replay_accepted_total",
+			Help: "Total number of decrypted requests recorded in the replay seen-cache, by origin service",
+		},
+		[]string{"origin_service"},
+	)
+	cacheEntries = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "replay_cache_entries",
+			Help: "Number of requests currently remembered by the replay seen-cache, by origin service",
+		},
+		[]string{"origin_service"},
+	)
+	windowSeconds = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "replay_window_seconds",
+			Help: "Accepted clock skew of the request timestamp in seconds, by origin service",
+		},
+		[]string{"origin_service"},
+	)
+)
+
+// 再送として拒否したエラー
+type Error struct {
+	Reason string
+	Field  string // 原因のフィールド（JSONの名前）
+	msg    string
+}
+
+func (e *Error) Error() string { return e.msg }
+
+// 再送の検出で拒否した要求に返すステータスコードとエラーレスポンス
+// 既に受け付けた要求は409、記録が一杯の場合は503、時刻の範囲外は400、nonce・時刻がない要求とnonceの形式の誤りは400を返す
+// レスポンスのCodeは各サーバーの失敗のメトリクスのreasonラベルにも使う
+func Response(err error) (int, wire.ErrorResponse) {
+	var rejected *Error
+	if !errors.As(err, &rejected) {
+		var invalid *wire.ErrorResponse
+		if errors.As(err, &invalid) {
+			return http.StatusBadRequest, *invalid
+		}
+		return http.StatusBadRequest, wire.ErrorResponse{Code: wire.ErrorCodeMalformed, Message: err.Error()}
+	}
+	resp := wire.ErrorResponse{Field: rejected.Field, Message: rejected.Error()}
+	switch rejected.Reason {
+	case ReasonDuplicateNonce, ReasonDuplicateEnvelope:
+		resp.Code = wire.ErrorCodeReplay
+		return http.StatusConflict, resp
+	case ReasonCacheFull:
+		resp.Code = wire.ErrorCodeReplayCacheFull
+		return http.StatusServiceUnavailable, resp
+	case ReasonStale:
+		resp.Code = wire.ErrorCodeStale
+	default:
+		resp.Code = wire.ErrorCodeMalformed
+	}
+	return http.StatusBadRequest, resp
+}
+
+// 記録した1件の要求
+type entry struct {
+	nonce    [sha256.Size]byte
+	envelope [sha256.Size]byte
+	expires  time.Time
+}
+
+// 再送の検出
+// nilの場合は何も検査しない
+type Guard struct {
+	service string
+	window  time.Duration
+	size    int
+	now     func() time.Time
+
+	mu        sync.Mutex
+	nonces    map[[sha256.Size]byte]*list.Element
+	envelopes map[[sha256.Size]byte]*list.Element
+	order     *list.List // 記録した順（期限も同じ順になる）
+}
+
+// serviceの再送の検出を作る（windowが0以下の場合はnilを返し、検査しない）
+// timestampは現在時刻の前後windowまで受け付け、記録はsize件までにする
+// 時刻の範囲内の記録を捨てると捨てた要求の再送を受け付けてしまうため、一杯の場合は記録が期限切れになるまで新しい要求を拒否する
+func New(service string, window time.Duration, size int) *Guard {
+	if window <= 0 {
+		return nil
+	}
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	windowSeconds.WithLabelValues(service).Set(window.Seconds())
+	cacheEntries.WithLabelValues(service).Set(0)
+	return &Guard{
+		service:   service,
+		window:    window,
+		size:      size,
+		now:       time.Now,
+		nonces:    make(map[[sha256.Size]byte]*list.Element),
+		envelopes: make(map[[sha256.Size]byte]*list.Element),
+		order:     list.New(),
+	}
+}
+
+// 復号の前に検査する（時刻の範囲と、既に記録した要求か）
+// 復号にかかるCPUを使わずに明らかな再送を拒否するためで、記録はしない
+func (g *Guard) Check(d *wire.EncryptedData) error {
+	if g == nil {
+		return nil
+	}
+	nonce, err := g.validate(d)
+	if err != nil {
+		return g.reject(err)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.expire()
+	if err := g.lookup(nonce, fingerprint(d)); err != nil {
+		return g.reject(err)
+	}
+	return g.reject(g.checkCapacity())
+}
+
+// 復号に成功した要求を記録する
+// Checkの後に同じ要求が並行して復号された場合は、後から記録しようとした方を再送として拒否する
+// 復号できた要求だけを記録するため、偽の要求で正規のクライアントのnonceを先に埋めることはできない
+func (g *Guard) Record(d *wire.EncryptedData) error {
+	if g == nil {
+		return nil
+	}
+	nonce, err := g.validate(d)
+	if err != nil {
+		return g.reject(err)
+	}
+	envelope := fingerprint(d)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.expire()
+	if err := g.lookup(nonce, envelope); err != nil {
+		return g.reject(err)
+	}
+	if err := g.checkCapacity(); err != nil {
+		return g.reject(err)
+	}
+	// timestampは現在時刻の前後windowにあるため、記録してから2*window経てば同じ要求はstaleとして拒否される
+	e := g.order.PushBack(&entry{nonce: nonce, envelope: envelope, expires: g.now().Add(2 * g.window)})
+	g.nonces[nonce] = e
+	g.envelopes[envelope] = e
+	acceptedTotal.WithLabelValues(g.service).Inc()
+	cacheEntries.WithLabelValues(g.service).Set(float64(g.order.Len()))
+	return nil
+}
+
+// 記録している要求の数
+func (g *Guard) Len() int {
+	if g == nil {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.order.Len()
+}
+
+// request_nonceとtimestampを検査し、nonceの記録のキーを返す
+func (g *Guard) validate(d *wire.EncryptedData) ([sha256.Size]byte, error) {
+	if d.RequestNonce == "" || d.Timestamp == 0 {
+		return [sha256.Size]byte{}, &Error{Reason: ReasonMissing, Field: missingField(d), msg: "再送の検出のためrequest_nonceとtimestampが必要です"}
+	}
+	nonce, err := wire.DecodeField("request_nonce", d.RequestNonce)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	if len(nonce) < wire.MinNonceSize || len(nonce) > wire.MaxNonceSize {
+		return [sha256.Size]byte{}, &wire.ErrorResponse{Code: wire.ErrorCodeInvalidLength, Field: "request_nonce", Message: fmt.Sprintf("request_nonceは%d〜%dバイトで指定してください（%dバイト）", wire.MinNonceSize, wire.MaxNonceSize, len(nonce))}
+	}
+	skew := g.now().Sub(time.UnixMilli(d.Timestamp))
+	if skew > g.window || skew < -g.window {
+		return [sha256.Size]byte{}, &Error{Reason: ReasonStale, Field: "timestamp", msg: fmt.Sprintf("timestampが許容する範囲（前後%s）の外です", g.window)}
+	}
+	return sha256.Sum256(nonce), nil
+}
+
+func missingField(d *wire.EncryptedData) string {
+	if d.RequestNonce == "" {
+		return "request_nonce"
+	}
+	return "timestamp"
+}
+
+// 既に記録した要求かを調べる（呼び出し側でmuを持つ）
+func (g *Guard) lookup(nonce, envelope [sha256.Size]byte) error {
+	if _, ok := g.nonces[nonce]; ok {
+		return &Error{Reason: ReasonDuplicateNonce, Field: "request_nonce", msg: "既に受け付けたrequest_nonceです"}
+	}
+	if _, ok := g.envelopes[envelope]; ok {
+		return &Error{Reason: ReasonDuplicateEnvelope, msg: "既に受け付けた暗号化データです"}
+	}
+	return nil
+}
+
+// 新しい要求を記録できるかを調べる（呼び出し側でmuを持ち、expireの後に呼ぶ）
+// expireの後に残っている記録はすべて時刻の範囲内のため、一杯の場合は捨てずに拒否する
+func (g *Guard) checkCapacity() error {
+	if g.order.Len() < g.size {
+		return nil
+	}
+	return &Error{Reason: ReasonCacheFull, msg: fmt.Sprintf("再送の検出の記録が一杯です（%d件）。しばらくしてから再試行してください", g.size)}
+}
+
+// 期限の過ぎた記録を古い順に捨てる（呼び出し側でmuを持つ）
+func (g *Guard) expire() {
+	now := g.now()
+	for e := g.order.Front(); e != nil && now.After(e.Value.(*entry).expires); e = g.order.Front() {
+		g.remove(e)
+	}
+	cacheEntries.WithLabelValues(g.service).Set(float64(g.order.Len()))
+}
+
+func (g *Guard) remove(e *list.Element) {
+	ent := g.order.Remove(e).(*entry)
+	delete(g.nonces, ent.nonce)
+	delete(g.envelopes, ent.envelope)
+}
+
+// 再送による拒否を記録する
+func (g *Guard) reject(err error) error {
+	if e, ok := err.(*Error); ok {
+		rejectedTotal.WithLabelValues(g.service, e.Reason).Inc()
+	}
+	return err
+}
+
+// 暗号化データの指紋（鍵の保護部分とIV・MACのSHA-256）
+// Base64の表記の揺れ（改行や末尾の未使用ビット）で指紋を変えられないように、デコードしたバイト列から作る
+// 各フィールドの長さを前に付け、境界をずらして同じ指紋を作れないようにする
+func fingerprint(d *wire.EncryptedData) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write([]byte("pqc-grafana replay fingerprint v1"))
+	for _, f := range [][]byte{[]byte(d.KeyID), decoded(d.KEMCiphertext), decoded(d.EphemeralPublicKey), decoded(d.EncryptedAESKey), decoded(d.EncryptedKEK), decoded(d.IV), decoded(d.MAC)} {
+		var n [8]byte
+		binary.BigEndian.PutUint64(n[:], uint64(len(f)))
+		h.Write(n[:])
+		h.Write(f)
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+// Base64のフィールドをデコードする（復号の前に検証済みのため、デコードできない場合は文字列のまま使う）
+func decoded(s string) []byte {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return []byte(s)
+	}
+	return b
+}
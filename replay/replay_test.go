@@ -0,0 +1,145 @@
+package replay
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/wire"
+)
+
+func newTestGuard(t *testing.T) *Guard {
+	t.Helper()
+	g := New("replay-test", time.Minute, 4)
+	if g == nil {
+		t.Fatal("Guardが作られません")
+	}
+	return g
+}
+
+func reason(err error) string {
+	var rejected *Error
+	if errors.As(err, &rejected) {
+		return rejected.Reason
+	}
+	return ""
+}
+
+func TestGuardRejectsDuplicates(t *testing.T) {
+	g := newTestGuard(t)
+	d := &wire.EncryptedData{IV: "AAAA", MAC: "AA==", RequestNonce: base64.StdEncoding.EncodeToString([]byte("0123456789abcdef")), Timestamp: time.Now().UnixMilli()}
+	if err := g.Check(d); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Record(d); err != nil {
+		t.Fatal(err)
+	}
+	if got := reason(g.Check(d)); got != ReasonDuplicateNonce {
+		t.Fatalf("同じ要求の再送: reason = %q, want %q", got, ReasonDuplicateNonce)
+	}
+	// nonceだけを書き換えた再送は暗号化データの指紋で検出する
+	resent := *d
+	resent.RequestNonce = base64.StdEncoding.EncodeToString([]byte("fedcba9876543210"))
+	if got := reason(g.Check(&resent)); got != ReasonDuplicateEnvelope {
+		t.Fatalf("nonceを書き換えた再送: reason = %q, want %q", got, ReasonDuplicateEnvelope)
+	}
+	if got := reason(g.Record(d)); got != ReasonDuplicateNonce {
+		t.Fatalf("Record: reason = %q, want %q", got, ReasonDuplicateNonce)
+	}
+}
+
+func TestGuardRejectsStaleAndMissing(t *testing.T) {
+	g := newTestGuard(t)
+	nonce := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+	stale := &wire.EncryptedData{RequestNonce: nonce, Timestamp: time.Now().Add(-2 * time.Minute).UnixMilli()}
+	if got := reason(g.Check(stale)); got != ReasonStale {
+		t.Fatalf("reason = %q, want %q", got, ReasonStale)
+	}
+	if got := reason(g.Check(&wire.EncryptedData{Timestamp: time.Now().UnixMilli()})); got != ReasonMissing {
+		t.Fatalf("reason = %q, want %q", got, ReasonMissing)
+	}
+}
+
+func testRequest(i int, now time.Time) *wire.EncryptedData {
+	return &wire.EncryptedData{IV: base64.StdEncoding.EncodeToString([]byte{byte(i)}), RequestNonce: base64.StdEncoding.EncodeToString([]byte("0123456789abcde" + string(rune('a'+i)))), Timestamp: now.UnixMilli()}
+}
+
+// 記録が一杯になっても時刻の範囲内の記録は捨てず、捨てた要求の再送を受け付けない
+func TestGuardFailsClosedWhenFull(t *testing.T) {
+	g := newTestGuard(t)
+	now := time.Now()
+	g.now = func() time.Time { return now }
+	captured := testRequest(0, now)
+	if err := g.Record(captured); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < 4; i++ {
+		if err := g.Record(testRequest(i, now)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	flood := testRequest(4, now)
+	if got := reason(g.Check(flood)); got != ReasonCacheFull {
+		t.Fatalf("Check: reason = %q, want %q", got, ReasonCacheFull)
+	}
+	if got := reason(g.Record(flood)); got != ReasonCacheFull {
+		t.Fatalf("Record: reason = %q, want %q", got, ReasonCacheFull)
+	}
+	if g.Len() != 4 {
+		t.Fatalf("Len = %d, want 4", g.Len())
+	}
+	if got := reason(g.Record(captured)); got != ReasonDuplicateNonce {
+		t.Fatalf("一杯のときの再送: reason = %q, want %q", got, ReasonDuplicateNonce)
+	}
+	if status, resp := Response(g.Record(flood)); status != http.StatusServiceUnavailable || resp.Code != wire.ErrorCodeReplayCacheFull {
+		t.Fatalf("Response = %d %q, want 503 %q", status, resp.Code, wire.ErrorCodeReplayCacheFull)
+	}
+
+	// 記録が期限切れになれば新しい要求を受け付け、期限切れの要求の再送はstaleとして拒否する
+	now = now.Add(2*time.Minute + time.Second)
+	if err := g.Record(testRequest(5, now)); err != nil {
+		t.Fatal(err)
+	}
+	if got := reason(g.Check(captured)); got != ReasonStale {
+		t.Fatalf("期限切れの後の再送: reason = %q, want %q", got, ReasonStale)
+	}
+}
+
+func TestNilGuard(t *testing.T) {
+	var g *Guard
+	if New("replay-test", 0, 0) != nil {
+		t.Fatal("windowが0でもGuardが作られました")
+	}
+	if err := g.Check(&wire.EncryptedData{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Record(&wire.EncryptedData{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"duplicate nonce", &Error{Reason: ReasonDuplicateNonce}, http.StatusConflict, wire.ErrorCodeReplay},
+		{"duplicate envelope", &Error{Reason: ReasonDuplicateEnvelope}, http.StatusConflict, wire.ErrorCodeReplay},
+		{"stale", &Error{Reason: ReasonStale}, http.StatusBadRequest, wire.ErrorCodeStale},
+		{"missing", &Error{Reason: ReasonMissing}, http.StatusBadRequest, wire.ErrorCodeMalformed},
+		{"invalid length", &wire.ErrorResponse{Code: wire.ErrorCodeInvalidLength, Field: "request_nonce"}, http.StatusBadRequest, wire.ErrorCodeInvalidLength},
+		{"other", errors.New("x"), http.StatusBadRequest, wire.ErrorCodeMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := Response(tt.err)
+			if status != tt.status || resp.Code != tt.code {
+				t.Fatalf("Response = %d, %q, want %d, %q", status, resp.Code, tt.status, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+// Package resultcollector はクライアントが送る計測結果のまとまりを受け取る集約サーバー
+//
+// 結果はこのプロジェクト自身のハイブリッド暗号化（ML-KEM-768でカプセル化した共有秘密鍵でAES鍵を
+// AES-256-GCMでラップし、本文をAES-256-CBC-HMAC-SHA256で暗号化）で保護して送られ、
+// 計測用のサーバーと同じ形式の暗号化データを実際のデータの経路で使う
+package resultcollector
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cloudflare/circl/kem/kyber/kyber768"
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/keyi1000/PQC_grafana/internal/httpmw"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// サービス名（メトリクスのserviceラベル）
+const ServiceName = "result-collector"
+
+var factory = metrics.NewFactory(ServiceName, "collector_")
+
+var httpMiddleware = httpmw.New(ServiceName, factory, "collector_")
+
+var (
+	batchesTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "collector_batches_total",
+			Help: "Total number of uploaded result batches, by result (accepted or the rejection reason)",
+		},
+		[]string{"result"},
+	)
+	recordsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "collector_records_total",
+			Help: "Total number of session results received, by algorithm, transport and session result",
+		},
+		[]string{"algorithm", "transport", "result"},
+	)
+	batchBytes = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "collector_batch_size_bytes",
+			Help: "Size of the last accepted result batch in bytes, by form (plaintext JSON or encrypted envelope)",
+		},
+		[]string{"form"},
+	)
+	decryptDuration = factory.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "collector_decrypt_duration_seconds",
+			Help:    "Duration of ML-KEM decapsulation, key unwrap and batch decryption in seconds",
+			Buckets: []float64{0.0001, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1},
+		},
+	)
+	lastBatch = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "collector_last_batch_timestamp_seconds",
+			Help: "Unix time of the last accepted result batch, by client",
+		},
+		[]string{"client"},
+	)
+)
+
+// 結果を受け取る集約サーバー
+type Collector struct {
+	privateKey *kyber768.PrivateKey
+	publicKey  string // Base64
+	keyID      string
+
+	mu  sync.Mutex
+	out io.Writer // 受け取った結果の保存先（nilの場合は保存しない）
+}
+
+// ML-KEM-768の鍵ペアを生成し、受け取った結果をoutにJSON Lines（1行に1つのResultBatch）で書き込む
+func New(out io.Writer) (*Collector, error) {
+	pub, priv, err := kyber768.GenerateKeyPair(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	pubBytes := make([]byte, kyber768.PublicKeySize)
+	pub.Pack(pubBytes)
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	return &Collector{
+		privateKey: priv,
+		publicKey:  base64.StdEncoding.EncodeToString(pubBytes),
+		keyID:      hex.EncodeToString(id),
+		out:        out,
+	}, nil
+}
+
+// /public-key、/results、/metricsを提供するハンドラー
+func (c *Collector) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/public-key", httpMiddleware.Wrap("public-key", c.publicKeyHandler))
+	mux.HandleFunc("/results", httpMiddleware.Wrap("results", c.resultsHandler))
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/version", metrics.VersionHandler())
+	mux.Handle("/metrics/selfcheck", metrics.SelfCheckHandler())
+	return mux
+}
+
+func (c *Collector) publicKeyHandler(w http.ResponseWriter, r *http.Request) {
+	receivedAt := time.Now()
+	if r.Method != http.MethodGet {
+		http.Error(w, "GETメソッドのみサポートしています", http.StatusMethodNotAllowed)
+		return
+	}
+	if !wire.WriteEnvelopeVersion(w, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, wire.PublicKeyResponse{
+		PublicKey:    c.publicKey,
+		KeyID:        c.keyID,
+		Algorithm:    "ML-KEM-768",
+		KeySize:      kyber768.PublicKeySize,
+		KeyMode:      "static",
+		ServerTiming: wire.NewServerTiming(receivedAt),
+	})
+}
+
+func (c *Collector) resultsHandler(w http.ResponseWriter, r *http.Request) {
+	receivedAt := time.Now()
+	if r.Method != http.MethodPost {
+		http.Error(w, "POSTメソッドのみサポートしています", http.StatusMethodNotAllowed)
+		return
+	}
+	var req wire.EncryptedData
+	if err := httpMiddleware.DecodeJSON(w, r, wire.MaxEncryptedDataSize, &req); err != nil {
+		reject(w, "malformed", httpmw.StatusCode(err), wire.ErrorResponse{Code: wire.ErrorCodeMalformed, Message: "リクエストの形式が不正です: " + err.Error()})
+		return
+	}
+	if err := req.CheckVersion(); err != nil {
+		reject(w, wire.ErrorCodeUnsupportedVersion, http.StatusBadRequest, *err.(*wire.ErrorResponse))
+		return
+	}
+	// AES-CBC + HMACのみを受け付ける（AES鍵のサイズはクライアントの-aes-key-sizesに従う）
+	dataCipher, ok := cryptoutil.LookupDataCipher(req.Algorithm)
+	if !ok || dataCipher.Family != cryptoutil.FamilyCBCHMAC {
+		reject(w, "unsupported_algorithm", http.StatusBadRequest, wire.ErrorResponse{Code: wire.ErrorCodeUnsupportedAlgorithm, Field: "algorithm", Message: "サポートしていない暗号化方式です"})
+		return
+	}
+	if req.KeyID != c.keyID {
+		reject(w, "unknown_key", http.StatusBadRequest, wire.ErrorResponse{Code: wire.ErrorCodeUnknownKey, Field: "key_id", Message: "鍵IDが見つかりません"})
+		return
+	}
+
+	start := time.Now()
+	plaintext, err := c.decrypt(&req, dataCipher)
+	if err != nil {
+		var invalid *wire.ErrorResponse
+		if errors.As(err, &invalid) {
+			reject(w, invalid.Code, http.StatusBadRequest, *invalid)
+			return
+		}
+		reject(w, "decrypt", http.StatusBadRequest, wire.ErrorResponse{Code: wire.ErrorCodeDecrypt, Message: "復号に失敗しました"})
+		return
+	}
+	decryptDuration.Observe(time.Since(start).Seconds())
+
+	var batch wire.ResultBatch
+	if err := json.Unmarshal(plaintext, &batch); err != nil {
+		reject(w, "malformed_batch", http.StatusBadRequest, wire.ErrorResponse{Code: wire.ErrorCodeMalformed, Message: "計測結果の形式が不正です: " + err.Error()})
+		return
+	}
+	for _, rec := range batch.Records {
+		recordsTotal.WithLabelValues(rec.Algorithm, rec.Transport, rec.Result).Inc()
+	}
+	c.store(plaintext)
+	batchesTotal.WithLabelValues("accepted").Inc()
+	batchBytes.WithLabelValues("plaintext").Set(float64(len(plaintext)))
+	batchBytes.WithLabelValues("envelope").Set(float64(r.ContentLength))
+	lastBatch.WithLabelValues(batch.Client).SetToCurrentTime()
+	metrics.MarkFirstOperation()
+
+	writeJSON(w, http.StatusOK, wire.ResultUploadResponse{Accepted: len(batch.Records), ServerTiming: wire.NewServerTiming(receivedAt)})
+	log.Printf("[%s] 計測結果を受け取りました (%d件, クライアント: %s)", ServiceName, len(batch.Records), batch.Client)
+}
+
+// ML-KEMで共有秘密鍵を取り出してAES鍵をアンラップし、計測結果を復号する
+func (c *Collector) decrypt(req *wire.EncryptedData, dataCipher cryptoutil.DataCipher) ([]byte, error) {
+	var kemCiphertext, encryptedKey, ciphertext, iv, tag []byte
+	var err error
+	for _, f := range []struct {
+		name  string
+		value string
+		dst   *[]byte
+	}{
+		{"kem_ciphertext", req.KEMCiphertext, &kemCiphertext},
+		{"encrypted_aes_key", req.EncryptedAESKey, &encryptedKey},
+		{"encrypted_message", req.EncryptedMessage, &ciphertext},
+		{"iv", req.IV, &iv},
+		{"mac", req.MAC, &tag},
+	} {
+		if *f.dst, err = wire.DecodeField(f.name, f.value); err != nil {
+			return nil, err
+		}
+	}
+	if err := errors.Join(
+		wire.CheckLength("kem_ciphertext", kemCiphertext, kyber768.CiphertextSize),
+		wire.CheckLength("encrypted_aes_key", encryptedKey, cryptoutil.WrappedKeySizeFor(dataCipher.KeySize)),
+		wire.CheckLength("iv", iv, aes.BlockSize),
+		wire.CheckLength("mac", tag, cryptoutil.MACSize),
+		wire.CheckBlocks("encrypted_message", ciphertext, aes.BlockSize),
+	); err != nil {
+		return nil, err
+	}
+
+	sharedSecret := make([]byte, kyber768.SharedKeySize)
+	c.privateKey.DecapsulateTo(sharedSecret, kemCiphertext)
+	defer cryptoutil.Zeroize(sharedSecret)
+	aesKey, err := cryptoutil.UnwrapKey(sharedSecret, encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	defer cryptoutil.Zeroize(aesKey)
+	return dataCipher.Open(aesKey, iv, ciphertext, tag)
+}
+
+// 復号した計測結果を1行で保存する
+func (c *Collector) store(batch []byte) {
+	if c.out == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.out.Write(append(batch, '\n')); err != nil {
+		log.Printf("[%s] 計測結果の保存エラー: %v", ServiceName, err)
+	}
+}
+
+// 受け付けなかったリクエストを数えてエラーレスポンスを返す
+func reject(w http.ResponseWriter, reason string, status int, resp wire.ErrorResponse) {
+	batchesTotal.WithLabelValues(reason).Inc()
+	writeJSON(w, status, resp)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("JSONエンコードエラー:", err)
+	}
+}
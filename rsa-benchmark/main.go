@@ -1,164 +1,150 @@
 package main
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/base64"
-	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
-	"net/http"
-	"time"
 
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/keyi1000/PQC_grafana/annotation"
+	"github.com/keyi1000/PQC_grafana/auditlog"
+	"github.com/keyi1000/PQC_grafana/datagram"
+	"github.com/keyi1000/PQC_grafana/features"
+	"github.com/keyi1000/PQC_grafana/internal/httpmw"
+	"github.com/keyi1000/PQC_grafana/keyarchive"
+	"github.com/keyi1000/PQC_grafana/keystore"
+	"github.com/keyi1000/PQC_grafana/kms"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/replay"
+	"github.com/keyi1000/PQC_grafana/rsaserver"
+	"github.com/keyi1000/PQC_grafana/selfbench"
+	"github.com/keyi1000/PQC_grafana/soak"
 )
 
-var (
-	// Prometheusメトリクス
-	httpRequestsTotal = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "rsa_server_http_requests_total",
-			Help: "Total number of HTTP requests",
-		},
-		[]string{"endpoint", "method"},
-	)
-	httpRequestDuration = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "rsa_server_http_request_duration_seconds",
-			Help:    "HTTP request duration in seconds",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"endpoint"},
-	)
-	publicKeyRequests = promauto.NewCounter(
-		prometheus.CounterOpts{
-			Name: "rsa_server_public_key_requests_total",
-			Help: "Total number of public key requests",
-		},
-	)
-	keyGenerationTime = promauto.NewGauge(
-		prometheus.GaugeOpts{
-			Name: "rsa_server_key_generation_seconds",
-			Help: "Time taken to generate RSA key pair in seconds",
-		},
-	)
-	keyGenerationDuration = promauto.NewHistogram(
-		prometheus.HistogramOpts{
-			Name:    "rsa_server_key_generation_duration_seconds",
-			Help:    "Histogram of RSA key generation duration in seconds",
-			Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0},
-		},
-	)
-)
-
-// 公開鍵のレスポンス構造体
-type PublicKeyResponse struct {
-	PublicKey string `json:"public_key"`
-	KeySize   int    `json:"key_size"`
-}
-
 func main() {
-	// HTTPサーバーのハンドラーを設定
-	http.HandleFunc("/public-key", metricsMiddleware("public-key", getPublicKeyHandler))
-	http.HandleFunc("/", metricsMiddleware("index", indexHandler))
-	http.Handle("/metrics", promhttp.Handler())
-
-	// サーバーを起動
-	port := ":8080"
-	fmt.Printf("\nサーバーを起動しました: http://localhost%s\n", port)
-	fmt.Println("エンドポイント:")
-	fmt.Println("  GET /public-key - RSA公開鍵を取得")
-	fmt.Println("  GET /metrics - Prometheusメトリクス")
-	fmt.Println("\nサーバーを停止するには Ctrl+C を押してください")
-
-	if err := http.ListenAndServe(port, nil); err != nil {
-		log.Fatal("サーバー起動エラー:", err)
+	cfg := rsaserver.DefaultConfig()
+	flag.StringVar(&cfg.KeyMode, "key-mode", cfg.KeyMode, "鍵の運用モード: ephemeral（リクエストごとに生成） / static（使い回す）")
+	flag.DurationVar(&cfg.KeyLifetime, "key-lifetime", cfg.KeyLifetime, "staticモードで鍵ペアを更新するまでの時間（0の場合は更新しない）")
+	flag.IntVar(&cfg.ActiveKeys, "active-keys", 1, "staticモードで同時に使う鍵ペアの数（鍵IDで区別し、新しいセッションに順に渡す）")
+	flag.DurationVar(&cfg.KeyMaxAge, "key-max-age", cfg.KeyMaxAge, "staticモードの公開鍵のレスポンスをキャッシュしてよい時間（Cache-Controlのmax-age、0の場合はno-cacheで毎回ETagによる再検証を求める）")
+	flag.BoolVar(&cfg.VulnerableMode, "vulnerable-mode", cfg.VulnerableMode, "【教育用】パディングを先に検査する脆弱な復号を使う")
+	flag.BoolVar(&cfg.InsecureOracle, "insecure-oracle", cfg.InsecureOracle, "【教育用】復号エラーの種類を返すパディングオラクルとして動作する（攻撃デモ用）")
+	flag.DurationVar(&cfg.ReplayWindow, "replay-window", 0, "復号エンドポイントで再送を検出し、request_nonceとtimestampのない要求・現在時刻との差がこの時間を超える要求・既に受け付けた要求を拒否する（0の場合は検出しない）")
+	flag.IntVar(&cfg.ReplayCacheSize, "replay-cache-size", replay.DefaultCacheSize, "-replay-window で記録する要求の数の上限（上限に達した場合は期限切れまで新しい要求を503で拒否する）")
+	cfg.Chaos.RegisterFlags(flag.CommandLine, "")
+	kmsConfig := kms.DefaultConfig()
+	kmsConfig.RegisterFlags(flag.CommandLine)
+	storeConfig := keystore.DefaultConfig()
+	storeConfig.RegisterFlags(flag.CommandLine)
+	archivePath := flag.String("key-archive", "", "生成した鍵ペア（秘密鍵を含む）を追記して保存するファイル（key-archive-replayで過去の暗号化データを再生するため、研究用、空の場合は保存しない）")
+	auditPath := flag.String("audit-log", "", "秘密鍵によるRSA-OAEPの復号（リクエストIDとクライアント）をハッシュで連鎖させて追記する監査ログのファイル（audit-log-verifyで検証する、空の場合は記録しない）")
+	archiveCiphertexts := flag.Bool("key-archive-ciphertexts", false, "-key-archive に復号できた暗号化データと平文のSHA-256も保存する")
+	addr := flag.String("addr", ":8080", "待ち受けアドレス（例: :8080 はIPv4とIPv6の両方、[::1]:8080、tcp6::8080、unix:/run/pqc/rsa.sock）")
+	unixSocket := flag.String("unix-socket", "", "-addr に加えて待ち受けるUnixドメインソケット（同じホストのクライアントがTCPを介さずに計測する、例: /run/pqc/rsa.sock）")
+	udpAddr := flag.String("udp-addr", "", "UDPのデータグラムでもリクエストを受け付けるアドレス（例: :9081、空の場合は受け付けない）")
+	var loadOpts selfbench.LoadOptions
+	flag.DurationVar(&loadOpts.Duration, "load-test", 0, "起動時に指定した時間、RSA-OAEPの復号を内部のキューから複数のワーカーで最大の速度で処理し、1秒あたりの回数とCPU使用率を記録する（0の場合は行わない）")
+	flag.IntVar(&loadOpts.Workers, "load-workers", 0, "-load-test のワーカー数（0の場合はGOMAXPROCS）")
+	loadInterval := flag.Duration("load-interval", 0, "-load-test を繰り返す間隔（0の場合は起動時に1回だけ行う）")
+	scalingStudy := flag.Duration("scaling-study", 0, "起動時にGOMAXPROCSを1, 2, 4, ...とCPU数まで増やしながらRSA-OAEPの復号の負荷計測を指定した時間ずつ行い、並列化の効率を記録する（0の場合は行わない）")
+	scalingMaxProcs := flag.Int("scaling-max-procs", 0, "-scaling-study で増やすGOMAXPROCSの最大値（0の場合はCPU数）")
+	runID := flag.String("run-id", "", "すべてのメトリクスにrun_idラベルとして付与する実行ID（同じPrometheusで複数の計測を区別する）")
+	experiment := flag.String("experiment", "", "すべてのメトリクスにexperimentラベルとして付与する実験名")
+	flag.Func("metric-namespace", "すべてのメトリクス名の前に付ける名前空間（例: lab1 → lab1_client_...）", metrics.SetNamespace)
+	flag.Func("metric-prefix", "サービスのメトリクス名の接頭辞を上書きする（service=prefix、例: aes-client=fork_client_、複数指定可）", metrics.ParsePrefix)
+	flag.Func("metrics-auth", "/metricsにBasic認証を要求する（user:password、環境変数METRICS_AUTHでも指定できる）", metrics.SetBasicAuth)
+	httpmw.RegisterAuthFlags(flag.CommandLine)
+	noRuntimeMetrics := flag.Bool("no-runtime-metrics", false, "Goランタイムとプロセスのメトリクス（go_*、process_*）を公開しない")
+	nativeHistograms := flag.Bool("native-histograms", false, "所要時間のヒストグラムをネイティブヒストグラム（スパースなバケット）としても公開する（Prometheusでnative histogramsを有効にしてprotobuf形式で取得する）")
+	grafanaURL := flag.String("grafana-url", "", "鍵の更新や設定の変更をアノテーションとして送るGrafanaのURL（環境変数GRAFANA_URLでも指定できる、空の場合は送らない）")
+	grafanaToken := flag.String("grafana-token", "", "GrafanaのAPIトークン（環境変数GRAFANA_API_TOKENでも指定できる）")
+	soakMode := flag.Bool("soak", false, "長時間の連続運転でヒープ・ゴルーチン・ファイルディスクリプタの増加を監視し、リークの疑いを記録する")
+	soakConfig := soak.DefaultConfig()
+	flag.DurationVar(&soakConfig.SampleInterval, "soak-interval", soakConfig.SampleInterval, "-soak で使用量を記録する間隔")
+	flag.DurationVar(&soakConfig.Window, "soak-window", soakConfig.Window, "-soak でリークを判定する期間")
+	features.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	metrics.SetRunLabels(*runID, *experiment)
+	if *noRuntimeMetrics {
+		metrics.DisableRuntimeCollectors()
 	}
-}
-
-// メトリクス収集用ミドルウェア
-func metricsMiddleware(endpoint string, next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		httpRequestsTotal.WithLabelValues(endpoint, r.Method).Inc()
-
-		next(w, r)
-
-		duration := time.Since(start)
-		httpRequestDuration.WithLabelValues(endpoint).Observe(duration.Seconds())
+	if *nativeHistograms {
+		metrics.EnableNativeHistograms()
 	}
-}
-
-// インデックスページのハンドラー
-func indexHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	html := `
-	<!DOCTYPE html>
-	<html>
-	<head>
-		<meta charset="UTF-8">
-		<title>RSA公開鍵サーバー</title>
-	</head>
-	<body>
-	publicKeyRequests.Inc()
-
-		<h1>RSA公開鍵サーバー</h1>
-		<p>このサーバーはRSA公開鍵を提供します。</p>
-		<h2>使用方法:</h2>
-		<ul>
-			<li><a href="/public-key">GET /public-key</a> - RSA公開鍵を取得</li>
-		</ul>
-	</body>
-	</html>
-	`
-	fmt.Fprint(w, html)
-}
-
-// 公開鍵を返すハンドラー
-func getPublicKeyHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "GETメソッドのみサポートしています", http.StatusMethodNotAllowed)
-		return
+	if err := annotation.Configure(*grafanaURL, *grafanaToken); err != nil {
+		log.Fatal("設定エラー:", err)
 	}
-
-	// リクエストごとに新しいRSA鍵ペアを生成
-	startTime := time.Now()
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	annotation.PostVersion()
+	if *soakMode {
+		soak.Start(soakConfig)
+	}
+	backend, err := kms.New(kmsConfig)
 	if err != nil {
-		http.Error(w, "鍵生成に失敗しました", http.StatusInternalServerError)
-		log.Println("鍵生成エラー:", err)
-		return
+		log.Fatal("設定エラー:", err)
 	}
-	publicKey := &privateKey.PublicKey
-	generationDuration := time.Since(startTime)
-	keyGenerationTime.Set(generationDuration.Seconds())
-	keyGenerationDuration.Observe(generationDuration.Seconds())
-	log.Printf("新しいRSA鍵ペアを生成しました (鍵生成時間: %v)\n", generationDuration)
-
-	// 公開鍵をDER形式にエンコード
-	pubKeyBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	cfg.KMS = backend
+	store, err := keystore.New(storeConfig)
 	if err != nil {
-		http.Error(w, "公開鍵のエンコードに失敗しました", http.StatusInternalServerError)
-		log.Println("公開鍵エンコードエラー:", err)
-		return
+		log.Fatal("設定エラー:", err)
 	}
-
-	// Base64エンコード
-	pubKeyBase64 := base64.StdEncoding.EncodeToString(pubKeyBytes)
-
-	// JSONレスポンスを作成
-	response := PublicKeyResponse{
-		PublicKey: pubKeyBase64,
-		KeySize:   2048,
+	if store != nil {
+		defer store.Close()
+	}
+	cfg.KeyStore = store
+	if err := cfg.Validate(); err != nil {
+		log.Fatal("設定エラー:", err)
+	}
+	if *archivePath != "" {
+		archive, err := keyarchive.Open(*archivePath, *archiveCiphertexts)
+		if err != nil {
+			log.Fatal("設定エラー:", err)
+		}
+		defer archive.Close()
+		cfg.Archive = archive
+	}
+	if *auditPath != "" {
+		audit, err := auditlog.Open(*auditPath)
+		if err != nil {
+			log.Fatal("設定エラー:", err)
+		}
+		defer audit.Close()
+		cfg.AuditLog = audit
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Println("JSONエンコードエラー:", err)
+	if loadOpts.Duration > 0 {
+		selfbench.StartLoad(rsaserver.LoadBenchmark, loadOpts, *loadInterval)
+	}
+	if *scalingStudy > 0 {
+		selfbench.StartScaling(*scalingStudy, *scalingMaxProcs, rsaserver.ScalingBenchmark)
 	}
 
-	log.Printf("公開鍵を送信しました (クライアント: %s)\n", r.RemoteAddr)
+	// サーバーを起動
+	fmt.Printf("\nサーバーを起動しました: %s\n", metrics.DisplayURL(*addr))
+	fmt.Println("エンドポイント:")
+	fmt.Println("  GET /public-key - RSA公開鍵を取得")
+	fmt.Println("  POST /decrypt - 暗号化データを復号")
+	fmt.Println("  POST /rotate-key - staticモードの鍵ペアを更新（adminのロール）")
+	fmt.Println("  GET /metrics - Prometheusメトリクス")
+	fmt.Println("  GET /version - ビルド情報")
+	fmt.Println("\nサーバーを停止するには Ctrl+C を押してください")
+
+	handler := rsaserver.NewHandler(cfg)
+	if *unixSocket != "" {
+		fmt.Printf("Unixドメインソケットでも待ち受けます: %s\n", *unixSocket)
+		go func() {
+			if err := metrics.ListenAndServe("unix:"+*unixSocket, handler); err != nil {
+				log.Fatal("Unixドメインソケットの待ち受けエラー:", err)
+			}
+		}()
+	}
+	if *udpAddr != "" {
+		fmt.Printf("データグラムのリクエストを受け付けます: udp %s\n", *udpAddr)
+		go func() {
+			if err := datagram.ListenAndServe(*udpAddr, rsaserver.ServiceName, handler); err != nil {
+				log.Fatal("データグラムサーバーの起動エラー:", err)
+			}
+		}()
+	}
+	if err := metrics.ListenAndServe(*addr, handler); err != nil {
+		log.Fatal("サーバー起動エラー:", err)
+	}
 }
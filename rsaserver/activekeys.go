@@ -0,0 +1,105 @@
+package rsaserver
+
+import (
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 鍵IDごとの使用回数の操作
+const (
+	keyUsagePublicKey = "public_key"
+	keyUsageDecrypt   = "decrypt"
+)
+
+var (
+	keyUsage = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rsa_server_key_usage_total",
+			Help: "Total number of uses of each static-mode key pair, by key ID (kid) and operation (public_key, decrypt); the series are removed when the retired key pair is zeroized",
+		},
+		[]string{"kid", "operation"},
+	)
+	activeKeys = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "rsa_server_active_keys",
+			Help: "Number of static-mode key pairs handed out to new sessions in turn",
+		},
+	)
+	retiredKeys = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "rsa_server_retired_keys",
+			Help: "Number of rotated static-mode key pairs kept only to finish in-flight sessions",
+		},
+	)
+)
+
+// staticモードで新しいセッションに渡す鍵ペアに加える（mu を保持した状態で呼ぶこと）
+func (m *keyManager) addActive(key *keyPair) {
+	key.static = true
+	m.active = append(m.active, key)
+	activeKeys.Set(float64(len(m.active)))
+}
+
+// 更新した鍵ペアを処理中のセッションのために残し、activeと同じ数を超えた古い鍵ペアを消去する（mu を保持した状態で呼ぶこと）
+// lookupで取り出した復号が処理中の鍵ペアは一覧から外すだけにし、releaseで最後の復号が終わったときに消去する
+func (m *keyManager) retire(key *keyPair) {
+	m.retired = append(m.retired, key)
+	if len(m.retired) > m.size {
+		oldest := m.retired[0]
+		m.retired = m.retired[1:]
+		if oldest.users > 0 {
+			oldest.retiring = true
+		} else {
+			oldest.zeroize()
+			forgetKeyUsage(oldest)
+		}
+	}
+	retiredKeys.Set(float64(len(m.retired)))
+}
+
+// staticモードで新しいセッションに渡す鍵ペアの一覧（GET /keys、ephemeralモードでは空）
+// acquireと同じく足りない鍵ペアを生成し、有効期限を過ぎた鍵ペアを更新してから返す
+func (m *keyManager) currentKeys() ([]*keyPair, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.mode != KeyModeStatic {
+		return nil, nil
+	}
+	for len(m.active) < m.size {
+		if _, err := m.rotate(-1); err != nil {
+			return nil, err
+		}
+	}
+	for i, key := range m.active {
+		if m.expired(key) {
+			if _, err := m.rotate(i); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return slices.Clone(m.active), nil
+}
+
+// 最も古いactiveの鍵ペアの位置
+func (m *keyManager) oldestActive() int {
+	oldest := 0
+	for i, key := range m.active {
+		if key.createdAt.Before(m.active[oldest].createdAt) {
+			oldest = i
+		}
+	}
+	return oldest
+}
+
+// staticモードの鍵ペアの使用回数を記録する（ephemeralモードの鍵は鍵IDが毎回変わるため記録しない）
+func observeKeyUsage(key *keyPair, operation string) {
+	if key.static {
+		keyUsage.WithLabelValues(key.id, operation).Inc()
+	}
+}
+
+// 消去した鍵ペアの使用回数の系列を削除する
+func forgetKeyUsage(key *keyPair) {
+	keyUsage.DeletePartialMatch(prometheus.Labels{"kid": key.id})
+}
@@ -0,0 +1,236 @@
+package rsaserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/auditlog"
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/keyi1000/PQC_grafana/internal/httpmw"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	decryptDuration = factory.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "rsa_server_decrypt_duration_seconds",
+			Help:    "Histogram of AES key unwrap (RSA-OAEP) plus message decryption duration in seconds",
+			Buckets: []float64{0.0001, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1},
+		},
+	)
+	decryptFailures = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rsa_server_decrypt_failures_total",
+			Help: "Total number of failed decryptions, by reason (padding/auth are only distinguished in vulnerable mode)",
+		},
+		[]string{"reason"},
+	)
+	oracleResponses = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rsa_server_oracle_responses_total",
+			Help: "Total number of decryption failures whose reason was revealed to the client in insecure oracle mode",
+		},
+		[]string{"reason"},
+	)
+	envelopeRequests = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rsa_server_envelope_requests_total",
+			Help: "Total number of decryption requests, by envelope format version (unspecified for clients that predate versioning)",
+		},
+		[]string{"format_version"},
+	)
+	envelopeFieldBytes = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rsa_server_envelope_field_bytes_total",
+			Help: "Total number of Base64 bytes received in decryption requests, by component (key_material for the wrapped AES key, KEM ciphertext, KEK or ephemeral public key; ciphertext for the message, IV and MAC); the whole body is in http_wire_bytes_total",
+		},
+		[]string{"component"},
+	)
+	dataCipherRequests = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rsa_server_data_cipher_requests_total",
+			Help: "Total number of decryption requests, by data encryption algorithm (AES-CBC-HMAC, AES-GCM, AES-GCM-SIV or ChaCha20-Poly1305 and key size)",
+		},
+		[]string{"algorithm"},
+	)
+	keyWrapRequests = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rsa_server_key_wrap_requests_total",
+			Help: "Total number of decryption requests, by AES key transport (rsa-oaep for the key encrypted directly, aes-kw for an RSA-OAEP encrypted KEK plus AES Key Wrap)",
+		},
+		[]string{"method"},
+	)
+	keyUnwrapDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "rsa_server_key_unwrap_duration_seconds",
+			Help:    "Duration of recovering the AES key (RSA-OAEP decryption plus AES Key Wrap unwrap for aes-kw) in seconds, by AES key transport",
+			Buckets: []float64{0.0001, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1},
+		},
+		[]string{"method"},
+	)
+)
+
+// 暗号化データの受信構造体
+type EncryptedData = wire.EncryptedData
+
+// 復号結果のレスポンス構造体
+// 平文そのものは返さず、クライアントが検証できるようにハッシュ値を返す
+type DecryptResponse = wire.DecryptResponse
+
+// 暗号化データを復号するハンドラー
+func (s *server) decryptHandler(w http.ResponseWriter, r *http.Request) {
+	receivedAt := time.Now()
+	if r.Method != http.MethodPost {
+		errorsTotal.WithLabelValues("decrypt", "request").Inc()
+		http.Error(w, "POSTメソッドのみサポートしています", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req EncryptedData
+	if err := httpMiddleware.DecodeJSON(w, r, wire.MaxEncryptedDataSize, &req); err != nil {
+		s.rejectDecrypt(w, "malformed", httpmw.StatusCode(err), wire.ErrorResponse{Code: wire.ErrorCodeMalformed, Message: "リクエストの形式が不正です: " + err.Error()})
+		return
+	}
+	envelopeRequests.WithLabelValues(req.VersionLabel()).Inc()
+	keyMaterial, ciphertextSize := req.FieldSizes()
+	envelopeFieldBytes.WithLabelValues(wire.ComponentKeyMaterial).Add(float64(keyMaterial))
+	envelopeFieldBytes.WithLabelValues(wire.ComponentCiphertext).Add(float64(ciphertextSize))
+	if err := req.CheckVersion(); err != nil {
+		s.rejectInvalid(w, err)
+		return
+	}
+	dataCipher, ok := cryptoutil.LookupDataCipher(req.Algorithm)
+	if !ok {
+		s.rejectDecrypt(w, "unsupported_algorithm", http.StatusBadRequest, wire.ErrorResponse{Code: wire.ErrorCodeUnsupportedAlgorithm, Field: "algorithm", Message: "サポートしていない暗号化方式です"})
+		return
+	}
+	dataCipherRequests.WithLabelValues(dataCipher.Name).Inc()
+	fields, err := decodeDecryptFields(&req, dataCipher)
+	if err != nil {
+		s.rejectInvalid(w, err)
+		return
+	}
+	ciphertext := s.chaos.CorruptCiphertext(fields.ciphertext)
+
+	key, ok := s.keys.lookup(req.KeyID)
+	if !ok {
+		s.rejectDecrypt(w, "unknown_key", http.StatusBadRequest, wire.ErrorResponse{Code: wire.ErrorCodeUnknownKey, Field: "key_id", Message: "鍵IDが見つかりません"})
+		return
+	}
+	defer s.keys.release(key)
+	if err := checkEncryptedKey(key, fields); err != nil {
+		s.rejectInvalid(w, err)
+		return
+	}
+	keyWrapRequests.WithLabelValues(fields.keyWrapLabel()).Inc()
+	observeKeyUsage(key, keyUsageDecrypt)
+
+	if err := s.replay.Check(&req); err != nil {
+		s.rejectReplay(w, err)
+		return
+	}
+
+	start := time.Now()
+	plaintext, err := s.decrypt(r.Context(), key, dataCipher, fields, ciphertext)
+	s.audit.Record(r, auditlog.Event{Service: ServiceName, Operation: auditlog.OperationDecrypt, KeyID: key.id, Algorithm: fmt.Sprintf("RSA-%d", key.publicKey.Size()*8), Err: err})
+	if err != nil {
+		reason := s.decryptFailureReason(err)
+		if s.oracle && (reason == "padding" || reason == "auth") {
+			// 【教育用・脆弱】エラーの種類をそのまま返し、パディングオラクルとして振る舞う
+			oracleResponses.WithLabelValues(reason).Inc()
+			s.rejectDecrypt(w, reason, http.StatusBadRequest, wire.ErrorResponse{Code: reason, Message: err.Error()})
+			return
+		}
+		// クライアントにはエラーの種類を区別できない同一のレスポンスを返す
+		s.rejectDecrypt(w, reason, http.StatusBadRequest, wire.ErrorResponse{Code: wire.ErrorCodeDecrypt, Message: "復号に失敗しました"})
+		return
+	}
+	decryptDuration.Observe(time.Since(start).Seconds())
+	if err := s.replay.Record(&req); err != nil {
+		s.rejectReplay(w, err)
+		return
+	}
+
+	metrics.MarkFirstOperation()
+
+	digest := sha256.Sum256(plaintext)
+	response := DecryptResponse{
+		PlaintextSHA256: base64.StdEncoding.EncodeToString(digest[:]),
+		PlaintextSize:   len(plaintext),
+		KeyID:           key.id,
+	}
+	response.ServerTiming = wire.NewServerTiming(receivedAt)
+	s.archive.StoreCiphertext(ServiceName, &req, response.PlaintextSHA256)
+	writeJSON(w, http.StatusOK, response)
+
+	log.Printf("暗号化データを復号しました (%dバイト, クライアント: %s)\n", len(plaintext), r.RemoteAddr)
+}
+
+// RSA-OAEP（KMSの鍵の場合はKMS）でデータ鍵を取り出し、メッセージをdataCipherで復号する
+func (s *server) decrypt(ctx context.Context, key *keyPair, dataCipher cryptoutil.DataCipher, f decryptFields, ciphertext []byte) ([]byte, error) {
+	start := time.Now()
+	aesKey, err := unwrapKey(ctx, key, f)
+	if err != nil {
+		return nil, err
+	}
+	defer cryptoutil.Zeroize(aesKey)
+	keyUnwrapDuration.WithLabelValues(f.keyWrapLabel()).Observe(time.Since(start).Seconds())
+
+	if s.vulnerable && dataCipher.Family == cryptoutil.FamilyCBCHMAC {
+		return cryptoutil.DecryptCBCHMACVulnerable(aesKey, f.iv, ciphertext, f.tag)
+	}
+	return dataCipher.Open(aesKey, f.iv, ciphertext, f.tag)
+}
+
+// AES鍵を取り出す
+// aes-kwではRSA-OAEPでKEKを取り出し、AESキーラップを外す（KMSのRSA_AES_KEY_WRAPと同じ構成）
+func unwrapKey(ctx context.Context, key *keyPair, f decryptFields) ([]byte, error) {
+	if f.keyWrap != cryptoutil.KeyWrapKW {
+		return key.decryptOAEP(ctx, f.encryptedKey)
+	}
+	kek, err := key.decryptOAEP(ctx, f.encryptedKEK)
+	if err != nil {
+		return nil, err
+	}
+	defer cryptoutil.Zeroize(kek)
+	return cryptoutil.UnwrapAESKW(kek, f.encryptedKey)
+}
+
+// メトリクスのラベルに使うAES鍵の受け渡し方式
+func (f decryptFields) keyWrapLabel() string {
+	if f.keyWrap == "" {
+		return "rsa-oaep"
+	}
+	return f.keyWrap
+}
+
+// 復号失敗の理由を決める
+// 通常モードではパディングエラーと認証エラーを区別しない（メトリクスからもオラクルを作らない）
+func (s *server) decryptFailureReason(err error) string {
+	if !s.vulnerable {
+		return "decrypt"
+	}
+	switch {
+	case errors.Is(err, cryptoutil.ErrPadding):
+		return "padding"
+	case errors.Is(err, cryptoutil.ErrAuthentication):
+		return "auth"
+	default:
+		return "decrypt"
+	}
+}
+
+// 復号要求を拒否する（reasonはメトリクスのラベル、クライアントにはエラーレスポンスのみを返す）
+func (s *server) rejectDecrypt(w http.ResponseWriter, reason string, status int, resp wire.ErrorResponse) {
+	decryptFailures.WithLabelValues(reason).Inc()
+	errorsTotal.WithLabelValues("decrypt", "crypto").Inc()
+	writeJSON(w, status, resp)
+}
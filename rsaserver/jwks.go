@@ -0,0 +1,88 @@
+package rsaserver
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	keySetResponses = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rsa_server_key_set_responses_total",
+			Help: "Total number of GET /keys responses, by result (full, not_modified)",
+		},
+		[]string{"result"},
+	)
+	keySetSize = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "rsa_server_key_set_keys",
+			Help: "Number of public keys in the latest GET /keys response",
+		},
+	)
+)
+
+// 新しいセッションに渡すすべての公開鍵をJWK Setの形で返すハンドラー（GET /keys）
+// クライアントは鍵の一覧をまとめて取得・キャッシュし、kidで鍵を選べる
+// Cache-Controlのmax-ageは最も早く更新される鍵に合わせ、ETagが一致すれば304を返す
+func (s *server) keysHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		errorsTotal.WithLabelValues("public_key", "request").Inc()
+		http.Error(w, "GETメソッドのみサポートしています", http.StatusMethodNotAllowed)
+		return
+	}
+	if !wire.WriteEnvelopeVersion(w, r) {
+		errorsTotal.WithLabelValues("public_key", "version").Inc()
+		return
+	}
+	keys, err := s.keys.currentKeys()
+	if err != nil {
+		errorsTotal.WithLabelValues("keygen", "crypto").Inc()
+		http.Error(w, "鍵生成に失敗しました", http.StatusInternalServerError)
+		log.Println("鍵生成エラー:", err)
+		return
+	}
+
+	set := wire.JWKSet{Keys: make([]wire.JWK, 0, len(keys))}
+	cacheControl := "no-store"
+	var maxAge time.Duration
+	for i, key := range keys {
+		jwk := wire.NewRSAJWK(key.id, key.publicKey)
+		if s.keys.lifetime > 0 {
+			jwk.Expires = key.createdAt.Add(s.keys.lifetime).Unix()
+		}
+		set.Keys = append(set.Keys, jwk)
+		if age := s.keyMaxAge(key); i == 0 || age < maxAge {
+			maxAge = age
+			cacheControl = cacheControlFor(maxAge)
+		}
+	}
+	keySetSize.Set(float64(len(set.Keys)))
+	body, err := json.Marshal(set)
+	if err != nil {
+		errorsTotal.WithLabelValues("marshal", "encode").Inc()
+		http.Error(w, "公開鍵のエンコードに失敗しました", http.StatusInternalServerError)
+		log.Println("公開鍵エンコードエラー:", err)
+		return
+	}
+
+	etag := wire.NewETag(body)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", etag)
+	if wire.MatchETag(r.Header.Get("If-None-Match"), etag) {
+		keySetResponses.WithLabelValues("not_modified").Inc()
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	keySetResponses.WithLabelValues("full").Inc()
+	w.Header().Set("Content-Type", wire.ContentTypeJWKSet)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(append(body, '\n')); err != nil {
+		errorsTotal.WithLabelValues("respond", "network").Inc()
+		log.Println("レスポンスの書き込みエラー:", err)
+	}
+}
@@ -0,0 +1,80 @@
+package rsaserver
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newTestKeyPair(t *testing.T, id string) *keyPair {
+	t.Helper()
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &keyPair{id: id, publicKey: &privateKey.PublicKey, privateKey: privateKey, createdAt: time.Now()}
+}
+
+func TestKeyPairZeroize(t *testing.T) {
+	key := newTestKeyPair(t, "test")
+	privateKey := key.privateKey
+	counter := zeroizationEvents.WithLabelValues("private_key")
+	before := testutil.ToFloat64(counter)
+	key.zeroize()
+	if privateKey.D.Sign() != 0 {
+		t.Fatal("秘密鍵が消去されていません")
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Fatalf("rsa_server_zeroization_events_totalの増加 = %v, want 1", got)
+	}
+}
+
+// 処理中の復号がある鍵ペアはretireで消去せず、最後のreleaseで消去する
+func TestRetireWaitsForInFlightDecrypt(t *testing.T) {
+	m := newKeyManager(KeyModeStatic, 0)
+	first, second, third := newTestKeyPair(t, "first"), newTestKeyPair(t, "second"), newTestKeyPair(t, "third")
+	m.addActive(first)
+
+	inFlight := make([]*keyPair, 2)
+	for i := range inFlight {
+		key, ok := m.lookup(first.id)
+		if !ok {
+			t.Fatal("鍵ペアが見つかりません")
+		}
+		inFlight[i] = key
+	}
+
+	m.mu.Lock()
+	m.active[0] = second
+	m.retire(first)
+	m.active[0] = third
+	m.retire(second) // retiredの上限（1）を超え、firstの消去の順番が来る
+	m.mu.Unlock()
+
+	if first.privateKey.D.Sign() == 0 {
+		t.Fatal("処理中の復号がある鍵ペアが消去されました")
+	}
+	if _, ok := m.lookup(first.id); ok {
+		t.Fatal("消去を待っている鍵ペアを新しい復号に渡しました")
+	}
+	m.release(inFlight[0])
+	if first.privateKey.D.Sign() == 0 {
+		t.Fatal("処理中の復号が残っているのに消去されました")
+	}
+	m.release(inFlight[1])
+	if first.privateKey.D.Sign() != 0 {
+		t.Fatal("最後の復号が終わっても消去されません")
+	}
+
+	// 処理中の復号がない鍵ペアはすぐに消去する
+	m.mu.Lock()
+	m.active[0] = newTestKeyPair(t, "fourth")
+	m.retire(third)
+	m.mu.Unlock()
+	if second.privateKey.D.Sign() != 0 {
+		t.Fatal("処理中の復号がない鍵ペアが消去されません")
+	}
+}
@@ -0,0 +1,54 @@
+package rsaserver
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/kms"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var keyBackendInfo = factory.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "rsa_server_key_backend",
+		Help: "Backend holding the RSA private key (1 for the active backend: local for in-process keys, vault or aws-kms for an external KMS)",
+	},
+	[]string{"backend"},
+)
+
+// 外部のKMSの公開鍵を取得する時間の上限
+const kmsPublicKeyTimeout = 10 * time.Second
+
+// 秘密鍵を保持するバックエンドの種類
+func (m *keyManager) backend() string {
+	if m.remote == nil {
+		return kms.BackendLocal
+	}
+	return m.remote.Name()
+}
+
+// 外部のKMSの公開鍵を取得し、鍵ペアとして扱う（秘密鍵はKMSの外に出ない）
+func (m *keyManager) loadRemote() (*keyPair, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), kmsPublicKeyTimeout)
+	defer cancel()
+	start := time.Now()
+	publicKey, err := m.remote.PublicKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("KMSの公開鍵の取得エラー: %w", err)
+	}
+	log.Printf("KMSの公開鍵を取得しました (バックエンド: %s, 鍵: %s, %dビット, 取得時間: %v)\n", m.remote.Name(), m.remote.KeyID(), publicKey.Size()*8, time.Since(start))
+	return &keyPair{id: m.remote.KeyID(), publicKey: publicKey, remote: m.remote, createdAt: time.Now()}, nil
+}
+
+// RSA-OAEP（SHA-256）で復号する（KMSの鍵の場合はKMSに依頼する）
+func (k *keyPair) decryptOAEP(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	if k.remote != nil {
+		return k.remote.Decrypt(ctx, ciphertext)
+	}
+	return rsa.DecryptOAEP(sha256.New(), rand.Reader, k.privateKey, ciphertext, nil)
+}
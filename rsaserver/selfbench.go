@@ -0,0 +1,52 @@
+package rsaserver
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/entropy"
+	"github.com/keyi1000/PQC_grafana/selfbench"
+	"github.com/keyi1000/PQC_grafana/wire"
+)
+
+// /benchmark/self で計測する暗号処理
+var selfBenchmarkPrimitive = fmt.Sprintf("RSA-OAEP-%d-decrypt", keySize)
+
+// 計測専用の鍵ペアでAES鍵を1つ暗号化しておき、その復号を繰り返す
+// （鍵の生成と暗号化の時間は計測に含めない）
+func prepareSelfBenchmark() (func() error, error) {
+	privateKey, err := rsa.GenerateKey(entropy.Reader(entropy.OperationRSAKeyGen), keySize)
+	if err != nil {
+		return nil, fmt.Errorf("鍵生成エラー: %w", err)
+	}
+	aesKey := make([]byte, 32)
+	if _, err := rand.Read(aesKey); err != nil {
+		return nil, err
+	}
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &privateKey.PublicKey, aesKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		_, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, encryptedKey, nil)
+		return err
+	}, nil
+}
+
+// RSA-OAEPの復号をOSスレッドに固定して計測する（/benchmark/self と同じ）
+func SelfBenchmark(opts selfbench.Options) (wire.SelfBenchmarkResponse, error) {
+	return selfbench.Run(selfBenchmarkPrimitive, prepareSelfBenchmark, opts)
+}
+
+// RSA-OAEPの復号を内部のキューから複数のワーカーで処理する負荷計測を行う（/benchmark/load と同じ）
+func LoadBenchmark(opts selfbench.LoadOptions) (wire.LoadBenchmarkResponse, error) {
+	return selfbench.Load(selfBenchmarkPrimitive, prepareSelfBenchmark, opts)
+}
+
+// GOMAXPROCSを1, 2, 4, ...と増やしながらRSA-OAEPの復号の負荷計測を繰り返す（/benchmark/scaling と同じ）
+func ScalingBenchmark(duration time.Duration, maxProcs int) (wire.ScalingBenchmarkResponse, error) {
+	return selfbench.Scaling(selfBenchmarkPrimitive, prepareSelfBenchmark, duration, maxProcs)
+}
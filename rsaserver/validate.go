@@ -0,0 +1,97 @@
+package rsaserver
+
+import (
+	"crypto/aes"
+	"errors"
+	"net/http"
+
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+	"github.com/keyi1000/PQC_grafana/replay"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var validationFailures = factory.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "rsa_server_validation_failures_total",
+		Help: "Total number of decrypt requests rejected by input validation before decryption, by field and reason (malformed, invalid_length)",
+	},
+	[]string{"field", "reason"},
+)
+
+// Base64をデコードし、長さを検証した復号要求のフィールド
+type decryptFields struct {
+	keyWrap                                         string // 空の場合はRSA-OAEPでAES鍵を直接暗号化
+	encryptedKey, encryptedKEK, ciphertext, iv, tag []byte
+}
+
+// 復号要求のフィールドをデコードし、データ暗号化方式のIV・タグ・暗号文の長さを検証する
+// RSAで暗号化したAES鍵の長さは鍵長で決まるため、鍵を引いた後にcheckEncryptedKeyで検証する
+func decodeDecryptFields(req *EncryptedData, dataCipher cryptoutil.DataCipher) (decryptFields, error) {
+	f := decryptFields{keyWrap: req.KeyWrap}
+	var err error
+	if f.keyWrap != "" && f.keyWrap != cryptoutil.KeyWrapKW {
+		return f, &wire.ErrorResponse{Code: wire.ErrorCodeUnsupportedAlgorithm, Field: "key_wrap", Message: "サポートしていない鍵のラップ方式です（RSAではaes-kwのみ）"}
+	}
+	if f.encryptedKey, err = wire.DecodeField("encrypted_aes_key", req.EncryptedAESKey); err != nil {
+		return f, err
+	}
+	if f.keyWrap == cryptoutil.KeyWrapKW {
+		if f.encryptedKEK, err = wire.DecodeField("encrypted_kek", req.EncryptedKEK); err != nil {
+			return f, err
+		}
+		if err := wire.CheckLength("encrypted_aes_key", f.encryptedKey, cryptoutil.WrappedKeySizeWith(cryptoutil.KeyWrapKW, dataCipher.KeySize)); err != nil {
+			return f, err
+		}
+	}
+	if f.ciphertext, err = wire.DecodeField("encrypted_message", req.EncryptedMessage); err != nil {
+		return f, err
+	}
+	if f.iv, err = wire.DecodeField("iv", req.IV); err != nil {
+		return f, err
+	}
+	if f.tag, err = wire.DecodeField("mac", req.MAC); err != nil {
+		return f, err
+	}
+	return f, errors.Join(
+		wire.CheckLength("iv", f.iv, dataCipher.IVSize),
+		wire.CheckLength("mac", f.tag, dataCipher.TagSize),
+		checkPadded(dataCipher, f.ciphertext),
+	)
+}
+
+// RSA-OAEPで暗号化したAES鍵（aes-kwではKEK）の長さが鍵の法の長さと一致するかを検証する
+func checkEncryptedKey(key *keyPair, f decryptFields) error {
+	if f.keyWrap == cryptoutil.KeyWrapKW {
+		return wire.CheckLength("encrypted_kek", f.encryptedKEK, key.publicKey.Size())
+	}
+	return wire.CheckLength("encrypted_aes_key", f.encryptedKey, key.publicKey.Size())
+}
+
+// 検証に失敗した復号要求を拒否する（最初に失敗したフィールドをエラーレスポンスで返す）
+func (s *server) rejectInvalid(w http.ResponseWriter, err error) {
+	var invalid *wire.ErrorResponse
+	if !errors.As(err, &invalid) {
+		invalid = &wire.ErrorResponse{Code: wire.ErrorCodeMalformed, Message: err.Error()}
+	}
+	validationFailures.WithLabelValues(invalid.Field, invalid.Code).Inc()
+	s.rejectDecrypt(w, invalid.Code, http.StatusBadRequest, *invalid)
+}
+
+// 再送の検出で拒否する（nonce・時刻がない要求は検証の失敗として数える）
+func (s *server) rejectReplay(w http.ResponseWriter, err error) {
+	switch status, resp := replay.Response(err); resp.Code {
+	case wire.ErrorCodeReplay, wire.ErrorCodeStale, wire.ErrorCodeReplayCacheFull:
+		s.rejectDecrypt(w, resp.Code, status, resp)
+	default:
+		s.rejectInvalid(w, &resp)
+	}
+}
+
+// パディングする方式（AES-CBC）では暗号文がブロック長の正の倍数かを検証する（AEADは任意の長さ）
+func checkPadded(dataCipher cryptoutil.DataCipher, ciphertext []byte) error {
+	if !dataCipher.Padded {
+		return nil
+	}
+	return wire.CheckBlocks("encrypted_message", ciphertext, aes.BlockSize)
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package selfbench
+
+import "time"
+
+// CPU時間を取得できない環境ではCPU使用率を記録しない
+func processCPUTime() (time.Duration, bool) {
+	return 0, false
+}
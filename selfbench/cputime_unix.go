@@ -0,0 +1,17 @@
+//go:build unix
+
+package selfbench
+
+import (
+	"syscall"
+	"time"
+)
+
+// プロセスが使ったCPU時間（ユーザー+システム）
+func processCPUTime() (time.Duration, bool) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0, false
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano()), true
+}
@@ -0,0 +1,248 @@
+package selfbench
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	loadOpsPerSecond = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "self_benchmark_load_ops_per_second",
+			Help: "Operations per second of the latest concurrent load run from the internal queue, by primitive and worker count",
+		},
+		[]string{"primitive", "workers"},
+	)
+	loadOpsPerCPUSecond = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "self_benchmark_load_ops_per_cpu_second",
+			Help: "Operations per second of CPU time consumed by the process in the latest load run (operations one fully used core can sustain)",
+		},
+		[]string{"primitive", "workers"},
+	)
+	loadCPUUtilization = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "self_benchmark_load_cpu_utilization_ratio",
+			Help: "Process CPU time divided by elapsed time times GOMAXPROCS during the latest load run (1 means all cores were busy)",
+		},
+		[]string{"primitive", "workers"},
+	)
+	loadQueueWait = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "self_benchmark_load_queue_wait_seconds",
+			Help: "Mean time an operation waited in the internal queue before a worker picked it up in the latest load run",
+		},
+		[]string{"primitive", "workers"},
+	)
+	loadRunsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "self_benchmark_load_runs_total",
+			Help: "Total number of concurrent load runs, by primitive and result",
+		},
+		[]string{"primitive", "result"},
+	)
+)
+
+// ワーカー数とキューの長さの上限
+const (
+	MaxWorkers   = 1024
+	MaxQueueSize = 1 << 16
+)
+
+// 負荷計測の設定
+type LoadOptions struct {
+	Duration  time.Duration // 計測する時間
+	Workers   int           // キューから取り出して処理するゴルーチンの数（0の場合はGOMAXPROCS）
+	QueueSize int           // キューの長さ（0の場合はワーカー数の2倍）
+}
+
+// 内部のキューに暗号処理を最大の速度で積み、複数のワーカーで指定した時間処理して、1秒あたりの回数とCPU使用率を返す
+// /benchmark/self と異なりOSスレッドには固定せず、実際のサーバーと同じようにスケジューラーに任せる
+// 1コアあたりの処理回数はプロセスのCPU時間から求めるため、同じプロセスの他の処理（HTTPなど）も含まれる
+func Load(primitive string, prepare Prepare, opts LoadOptions) (wire.LoadBenchmarkResponse, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	return load(primitive, prepare, opts)
+}
+
+func load(primitive string, prepare Prepare, opts LoadOptions) (wire.LoadBenchmarkResponse, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.GOMAXPROCS(0)
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 2 * opts.Workers
+	}
+	// 暗号処理の準備（鍵の生成など）はワーカーごとに行い、ワーカーどうしで状態を共有しない
+	ops := make([]func() error, opts.Workers)
+	for i := range ops {
+		op, err := prepare()
+		if err != nil {
+			loadRunsTotal.WithLabelValues(primitive, "failure").Inc()
+			return wire.LoadBenchmarkResponse{}, fmt.Errorf("計測の準備に失敗: %w", err)
+		}
+		ops[i] = op
+	}
+	runtime.GC()
+
+	var (
+		completed atomic.Int64
+		waited    atomic.Int64
+		firstErr  error
+		errOnce   sync.Once
+		stopOnce  sync.Once
+		wg        sync.WaitGroup
+	)
+	queue := make(chan time.Time, opts.QueueSize)
+	stop := make(chan struct{})
+	halt := func() { stopOnce.Do(func() { close(stop) }) }
+
+	cpuBefore, cpuOK := processCPUTime()
+	start := time.Now()
+	timer := time.AfterFunc(opts.Duration, halt)
+	defer timer.Stop()
+	go func() {
+		defer close(queue)
+		for {
+			select {
+			case queue <- time.Now():
+			case <-stop:
+				return
+			}
+		}
+	}()
+	for _, op := range ops {
+		wg.Add(1)
+		go func(op func() error) {
+			defer wg.Done()
+			for enqueued := range queue {
+				waited.Add(int64(time.Since(enqueued)))
+				if err := op(); err != nil {
+					errOnce.Do(func() { firstErr = err })
+					halt()
+					return
+				}
+				completed.Add(1)
+			}
+		}(op)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	cpuAfter, _ := processCPUTime()
+	if firstErr != nil {
+		loadRunsTotal.WithLabelValues(primitive, "failure").Inc()
+		return wire.LoadBenchmarkResponse{}, fmt.Errorf("暗号処理に失敗: %w", firstErr)
+	}
+
+	n := completed.Load()
+	resp := wire.LoadBenchmarkResponse{
+		Primitive:    primitive,
+		Workers:      opts.Workers,
+		QueueSize:    opts.QueueSize,
+		Operations:   n,
+		ElapsedNanos: elapsed.Nanoseconds(),
+		OpsPerSecond: float64(n) / elapsed.Seconds(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		NumCPU:       runtime.NumCPU(),
+	}
+	if n > 0 {
+		resp.MeanQueueWaitNanos = waited.Load() / n
+	}
+	workers := strconv.Itoa(opts.Workers)
+	if cpuOK {
+		cpu := cpuAfter - cpuBefore
+		resp.CPUSeconds = cpu.Seconds()
+		resp.CPUUtilization = cpu.Seconds() / (elapsed.Seconds() * float64(resp.GOMAXPROCS))
+		if cpu > 0 {
+			resp.OpsPerCPUSecond = float64(n) / cpu.Seconds()
+		}
+		loadOpsPerCPUSecond.WithLabelValues(primitive, workers).Set(resp.OpsPerCPUSecond)
+		loadCPUUtilization.WithLabelValues(primitive, workers).Set(resp.CPUUtilization)
+	}
+	loadRunsTotal.WithLabelValues(primitive, "success").Inc()
+	loadOpsPerSecond.WithLabelValues(primitive, workers).Set(resp.OpsPerSecond)
+	loadQueueWait.WithLabelValues(primitive, workers).Set(time.Duration(resp.MeanQueueWaitNanos).Seconds())
+	return resp, nil
+}
+
+// サーバーの起動時に負荷計測をバックグラウンドで行い、intervalが正の場合は繰り返す
+// runは各サーバーのLoadBenchmarkで、結果はログとメトリクスに記録する
+func StartLoad(run func(LoadOptions) (wire.LoadBenchmarkResponse, error), opts LoadOptions, interval time.Duration) {
+	go func() {
+		for {
+			resp, err := run(opts)
+			if err != nil {
+				log.Printf("負荷計測エラー: %v", err)
+			} else {
+				log.Printf("負荷計測 [%s]: ワーカー%d、%.0f回/秒、1コアあたり%.0f回/秒、CPU使用率%.0f%%",
+					resp.Primitive, resp.Workers, resp.OpsPerSecond, resp.OpsPerCPUSecond, resp.CPUUtilization*100)
+			}
+			if interval <= 0 {
+				return
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// GET /benchmark/load のハンドラー
+// クエリのduration（例: 5s、既定1秒、最大30秒）で計測時間を、workersでワーカー数（既定はGOMAXPROCS）を、queueでキューの長さを指定する
+func LoadHandler(primitive string, prepare Prepare) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		receivedAt := time.Now()
+		if r.Method != http.MethodGet {
+			http.Error(w, "GETメソッドのみサポートしています", http.StatusMethodNotAllowed)
+			return
+		}
+		opts, err := parseLoadOptions(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, err := Load(primitive, prepare, opts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.ServerTiming = wire.NewServerTiming(receivedAt)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// クエリから負荷計測の設定を読み取る
+func parseLoadOptions(r *http.Request) (LoadOptions, error) {
+	opts := LoadOptions{Duration: DefaultDuration}
+	q := r.URL.Query()
+	if s := q.Get("duration"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 || d > MaxDuration {
+			return opts, fmt.Errorf("計測時間は%vまでで指定してください: %q", MaxDuration, s)
+		}
+		opts.Duration = d
+	}
+	if s := q.Get("workers"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > MaxWorkers {
+			return opts, fmt.Errorf("ワーカー数は1〜%dで指定してください: %q", MaxWorkers, s)
+		}
+		opts.Workers = n
+	}
+	if s := q.Get("queue"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > MaxQueueSize {
+			return opts, fmt.Errorf("キューの長さは1〜%dで指定してください: %q", MaxQueueSize, s)
+		}
+		opts.QueueSize = n
+	}
+	return opts, nil
+}
@@ -0,0 +1,144 @@
+package selfbench
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	scalingOpsPerSecond = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "self_benchmark_scaling_ops_per_second",
+			Help: "Operations per second of the latest scaling study, by primitive and GOMAXPROCS (workers equal GOMAXPROCS)",
+		},
+		[]string{"primitive", "gomaxprocs"},
+	)
+	scalingSpeedup = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "self_benchmark_scaling_speedup",
+			Help: "Throughput relative to GOMAXPROCS=1 in the latest scaling study, by primitive and GOMAXPROCS",
+		},
+		[]string{"primitive", "gomaxprocs"},
+	)
+	scalingEfficiency = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "self_benchmark_scaling_efficiency_ratio",
+			Help: "Speedup divided by GOMAXPROCS in the latest scaling study (1 means perfectly linear scaling), by primitive and GOMAXPROCS",
+		},
+		[]string{"primitive", "gomaxprocs"},
+	)
+)
+
+// 負荷計測を繰り返すGOMAXPROCSの値（1, 2, 4, ... とmaxProcs）
+func scalingSteps(maxProcs int) []int {
+	var steps []int
+	for p := 1; p < maxProcs; p *= 2 {
+		steps = append(steps, p)
+	}
+	return append(steps, maxProcs)
+}
+
+// GOMAXPROCSとワーカー数を1, 2, 4, ...とmaxProcs（0の場合はCPU数）まで増やしながら負荷計測を繰り返し、
+// GOMAXPROCS=1 に対する倍率と並列化の効率を返す
+// 計測中はプロセス全体のGOMAXPROCSを変更するため、同じプロセスのHTTPの処理なども影響を受ける（計測後に元に戻す）
+func Scaling(primitive string, prepare Prepare, duration time.Duration, maxProcs int) (wire.ScalingBenchmarkResponse, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if maxProcs <= 0 {
+		maxProcs = runtime.NumCPU()
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+
+	resp := wire.ScalingBenchmarkResponse{Primitive: primitive, NumCPU: runtime.NumCPU()}
+	var baseline float64
+	for _, procs := range scalingSteps(maxProcs) {
+		runtime.GOMAXPROCS(procs)
+		r, err := load(primitive, prepare, LoadOptions{Duration: duration, Workers: procs})
+		if err != nil {
+			return wire.ScalingBenchmarkResponse{}, fmt.Errorf("GOMAXPROCS=%dの計測に失敗: %w", procs, err)
+		}
+		if procs == 1 {
+			baseline = r.OpsPerSecond
+		}
+		point := wire.ScalingPoint{GOMAXPROCS: procs, OpsPerSecond: r.OpsPerSecond, CPUUtilization: r.CPUUtilization}
+		if baseline > 0 {
+			point.Speedup = r.OpsPerSecond / baseline
+			point.Efficiency = point.Speedup / float64(procs)
+		}
+		resp.Points = append(resp.Points, point)
+
+		label := strconv.Itoa(procs)
+		scalingOpsPerSecond.WithLabelValues(primitive, label).Set(point.OpsPerSecond)
+		scalingSpeedup.WithLabelValues(primitive, label).Set(point.Speedup)
+		scalingEfficiency.WithLabelValues(primitive, label).Set(point.Efficiency)
+	}
+	return resp, nil
+}
+
+// GET /benchmark/scaling のハンドラー
+// クエリのduration（GOMAXPROCSごとの計測時間、既定1秒、最大30秒）とmax（GOMAXPROCSの最大値、既定はCPU数）を指定する
+func ScalingHandler(primitive string, prepare Prepare) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		receivedAt := time.Now()
+		if r.Method != http.MethodGet {
+			http.Error(w, "GETメソッドのみサポートしています", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		duration := DefaultDuration
+		if s := q.Get("duration"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 || d > MaxDuration {
+				http.Error(w, fmt.Sprintf("計測時間は%vまでで指定してください: %q", MaxDuration, s), http.StatusBadRequest)
+				return
+			}
+			duration = d
+		}
+		maxProcs := 0
+		if s := q.Get("max"); s != "" {
+			var err error
+			if maxProcs, err = strconv.Atoi(s); err != nil || maxProcs < 1 || maxProcs > MaxWorkers {
+				http.Error(w, fmt.Sprintf("GOMAXPROCSの最大値は1〜%dで指定してください: %q", MaxWorkers, s), http.StatusBadRequest)
+				return
+			}
+		}
+		resp, err := Scaling(primitive, prepare, duration, maxProcs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.ServerTiming = wire.NewServerTiming(receivedAt)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// 各サーバーのScalingBenchmark
+type ScalingRun func(duration time.Duration, maxProcs int) (wire.ScalingBenchmarkResponse, error)
+
+// サーバーの起動時にスケーリングの計測をバックグラウンドで行い、結果をログとメトリクスに記録する
+// GOMAXPROCSを変更するため、複数のrunsは同時には実行せず順に行う
+func StartScaling(duration time.Duration, maxProcs int, runs ...ScalingRun) {
+	go func() {
+		for _, run := range runs {
+			resp, err := run(duration, maxProcs)
+			if err != nil {
+				log.Printf("スケーリングの計測エラー: %v", err)
+				continue
+			}
+			for _, p := range resp.Points {
+				log.Printf("スケーリング [%s]: GOMAXPROCS=%d、%.0f回/秒、%.2f倍、効率%.0f%%",
+					resp.Primitive, p.GOMAXPROCS, p.OpsPerSecond, p.Speedup, p.Efficiency*100)
+			}
+		}
+	}()
+}
@@ -0,0 +1,167 @@
+// Package selfbench はサーバーの暗号処理を1つのOSスレッドに固定して一定時間繰り返し、1秒あたりの実行回数を返す
+//
+// 別のホストどうしで性能を比較するときに、スケジューラーによる移動や同じホストの他の負荷の影響を減らすため、
+// 計測は1つずつ順番に行い、計測中のゴルーチンはruntime.LockOSThreadで同じOSスレッドに固定する
+// gomaxprocs=1 を指定すると計測中だけプロセス全体のGOMAXPROCSを1にする（計測後に元に戻す）
+package selfbench
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "self-benchmark"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は self_benchmark_）
+var factory = metrics.NewFactory(ServiceName, "self_benchmark_")
+
+var (
+	opsPerSecond = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "self_benchmark_ops_per_second",
+			Help: "Operations per second of the latest pinned self-benchmark, by primitive and GOMAXPROCS during the run",
+		},
+		[]string{"primitive", "gomaxprocs"},
+	)
+	runsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "self_benchmark_runs_total",
+			Help: "Total number of self-benchmark runs, by primitive and result",
+		},
+		[]string{"primitive", "result"},
+	)
+)
+
+// 計測時間の既定値と上限
+const (
+	DefaultDuration = time.Second
+	MaxDuration     = 30 * time.Second
+)
+
+// 計測は同時に1つだけ実行する（計測どうしでCPUを奪い合わないように）
+var mu sync.Mutex
+
+// 計測する暗号処理の1回分を作る
+// 鍵の生成など計測に含めない準備はここで行う
+type Prepare func() (op func() error, err error)
+
+// 計測の設定
+type Options struct {
+	Duration         time.Duration // 計測する時間
+	SingleGOMAXPROCS bool          // 計測中はGOMAXPROCSを1にする
+}
+
+// 暗号処理をOSスレッドに固定して計測する
+func Run(primitive string, prepare Prepare, opts Options) (wire.SelfBenchmarkResponse, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	op, err := prepare()
+	if err != nil {
+		runsTotal.WithLabelValues(primitive, "failure").Inc()
+		return wire.SelfBenchmarkResponse{}, fmt.Errorf("計測の準備に失敗: %w", err)
+	}
+	if opts.SingleGOMAXPROCS {
+		defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	}
+	// 前の処理のゴミを回収しておき、計測中のGCを減らす
+	runtime.GC()
+
+	type result struct {
+		n       int
+		elapsed time.Duration
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		var r result
+		start := time.Now()
+		for r.elapsed < opts.Duration {
+			if r.err = op(); r.err != nil {
+				break
+			}
+			r.n++
+			r.elapsed = time.Since(start)
+		}
+		done <- r
+	}()
+	r := <-done
+	if r.err != nil {
+		runsTotal.WithLabelValues(primitive, "failure").Inc()
+		return wire.SelfBenchmarkResponse{}, fmt.Errorf("暗号処理に失敗: %w", r.err)
+	}
+
+	resp := wire.SelfBenchmarkResponse{
+		Primitive:    primitive,
+		Operations:   r.n,
+		ElapsedNanos: r.elapsed.Nanoseconds(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		NumCPU:       runtime.NumCPU(),
+		LockedThread: true,
+	}
+	if r.n > 0 {
+		resp.PerOpNanos = r.elapsed.Nanoseconds() / int64(r.n)
+		resp.OpsPerSecond = float64(r.n) / r.elapsed.Seconds()
+	}
+	runsTotal.WithLabelValues(primitive, "success").Inc()
+	opsPerSecond.WithLabelValues(primitive, strconv.Itoa(resp.GOMAXPROCS)).Set(resp.OpsPerSecond)
+	return resp, nil
+}
+
+// GET /benchmark/self のハンドラー
+// クエリのduration（例: 5s、既定1秒、最大30秒）で計測時間を、gomaxprocs=1 でGOMAXPROCSの制限を指定する
+func Handler(primitive string, prepare Prepare) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		receivedAt := time.Now()
+		if r.Method != http.MethodGet {
+			http.Error(w, "GETメソッドのみサポートしています", http.StatusMethodNotAllowed)
+			return
+		}
+		opts, err := parseOptions(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, err := Run(primitive, prepare, opts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.ServerTiming = wire.NewServerTiming(receivedAt)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// クエリから計測の設定を読み取る
+func parseOptions(r *http.Request) (Options, error) {
+	opts := Options{Duration: DefaultDuration}
+	q := r.URL.Query()
+	if s := q.Get("duration"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 || d > MaxDuration {
+			return opts, fmt.Errorf("計測時間は%vまでで指定してください: %q", MaxDuration, s)
+		}
+		opts.Duration = d
+	}
+	switch q.Get("gomaxprocs") {
+	case "":
+	case "1":
+		opts.SingleGOMAXPROCS = true
+	default:
+		return opts, fmt.Errorf("gomaxprocsには1だけを指定できます")
+	}
+	return opts, nil
+}
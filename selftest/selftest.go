@@ -0,0 +1,165 @@
+// Package selftest は暗号実装の既知解テスト（KAT）を提供する
+//
+// NISTのML-KEMテストベクトルとRSA-OAEPの決定的なテストベクトルで、
+// 使用しているライブラリが仕様どおりの出力を返すことを確認する
+package selftest
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/cloudflare/circl/kem/mlkem/mlkem768"
+)
+
+// テストの結果
+type Result struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Error  string `json:"error,omitempty"`
+}
+
+// 既知解テスト
+type check struct {
+	name string
+	run  func() error
+}
+
+// 実行するテスト（ビルド条件によって追加される）
+var checks = []check{
+	{"ML-KEM-768/circl/keygen", circlMLKEM768KeyGen},
+	{"ML-KEM-768/circl/encapsulate", circlMLKEM768Encapsulate},
+	{"ML-KEM-768/circl/decapsulate", circlMLKEM768Decapsulate},
+	{"RSA-OAEP-SHA1/stdlib/encrypt", rsaOAEPEncrypt},
+	{"RSA-OAEP-SHA1/stdlib/decrypt", rsaOAEPDecrypt},
+}
+
+// すべてのテストを実行する
+func Run() []Result {
+	results := make([]Result, 0, len(checks))
+	for _, c := range checks {
+		r := Result{Name: c.name, Passed: true}
+		if err := c.run(); err != nil {
+			r.Passed = false
+			r.Error = err.Error()
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// すべてのテストが成功したかを返す
+func AllPassed(results []Result) bool {
+	for _, r := range results {
+		if !r.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// 期待値と一致しない
+var ErrMismatch = errors.New("期待値と一致しません")
+
+// SHA-256の値を期待値（hex）と比較する
+func expectDigest(what string, data []byte, expected string) error {
+	digest := sha256.Sum256(data)
+	if hex.EncodeToString(digest[:]) != expected {
+		return fmt.Errorf("%s: %w", what, ErrMismatch)
+	}
+	return nil
+}
+
+// 値を期待値（hex）と比較する
+func expectBytes(what string, data []byte, expected string) error {
+	if hex.EncodeToString(data) != expected {
+		return fmt.Errorf("%s: %w", what, ErrMismatch)
+	}
+	return nil
+}
+
+func mustDecode(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic("selftest: テストベクトルの形式が不正です: " + err.Error())
+	}
+	return b
+}
+
+// シード（d || z）からML-KEM-768の鍵ペアを導出する
+func circlMLKEM768Keys() (*mlkem768.PublicKey, *mlkem768.PrivateKey) {
+	seed := append(mustDecode(mlkem768KeyGenD), mustDecode(mlkem768KeyGenZ)...)
+	return mlkem768.NewKeyFromSeed(seed)
+}
+
+func circlMLKEM768KeyGen() error {
+	pk, sk := circlMLKEM768Keys()
+	ek := make([]byte, mlkem768.PublicKeySize)
+	pk.Pack(ek)
+	if err := expectDigest("カプセル化鍵", ek, mlkem768KeyGenEKSHA256); err != nil {
+		return err
+	}
+	dk := make([]byte, mlkem768.PrivateKeySize)
+	sk.Pack(dk)
+	return expectDigest("デカプセル化鍵", dk, mlkem768KeyGenDKSHA256)
+}
+
+func circlMLKEM768Encapsulate() error {
+	var pk mlkem768.PublicKey
+	if err := pk.Unpack(mustDecode(mlkem768EncapEK)); err != nil {
+		return err
+	}
+	ct := make([]byte, mlkem768.CiphertextSize)
+	ss := make([]byte, mlkem768.SharedKeySize)
+	pk.EncapsulateTo(ct, ss, mustDecode(mlkem768EncapM))
+	if err := expectDigest("カプセル化テキスト", ct, mlkem768EncapCSHA256); err != nil {
+		return err
+	}
+	return expectBytes("共有秘密鍵", ss, mlkem768EncapK)
+}
+
+// 既知のシードから導出した鍵ペアで、固定の乱数によるカプセル化とデカプセル化の結果が一致することを確認する
+func circlMLKEM768Decapsulate() error {
+	pk, sk := circlMLKEM768Keys()
+	ct := make([]byte, mlkem768.CiphertextSize)
+	ss := make([]byte, mlkem768.SharedKeySize)
+	pk.EncapsulateTo(ct, ss, mustDecode(mlkem768EncapM))
+	decapsulated := make([]byte, mlkem768.SharedKeySize)
+	sk.DecapsulateTo(decapsulated, ct)
+	if !bytes.Equal(ss, decapsulated) {
+		return fmt.Errorf("共有秘密鍵: %w", ErrMismatch)
+	}
+	return nil
+}
+
+func oaepKey() *rsa.PrivateKey {
+	key := &rsa.PrivateKey{
+		PublicKey: rsa.PublicKey{N: new(big.Int).SetBytes(mustDecode(oaepN)), E: oaepE},
+		D:         new(big.Int).SetBytes(mustDecode(oaepD)),
+	}
+	return key
+}
+
+// 乱数の代わりにテストベクトルのシードを与えて、暗号文が一致することを確認する
+func rsaOAEPEncrypt() error {
+	key := oaepKey()
+	ct, err := rsa.EncryptOAEP(sha1.New(), bytes.NewReader(mustDecode(oaepSeed)), &key.PublicKey, mustDecode(oaepMessage), nil)
+	if err != nil {
+		return err
+	}
+	return expectBytes("暗号文", ct, oaepCiphertext)
+}
+
+func rsaOAEPDecrypt() error {
+	key := oaepKey()
+	pt, err := rsa.DecryptOAEP(sha1.New(), nil, key, mustDecode(oaepCiphertext), nil)
+	if err != nil {
+		return err
+	}
+	return expectBytes("平文", pt, oaepMessage)
+}
@@ -0,0 +1,22 @@
+//go:build go1.24
+
+package selftest
+
+import "crypto/mlkem"
+
+// 標準ライブラリのcrypto/mlkem（Go 1.24以降）も同じベクトルで確認する
+func init() {
+	checks = append(checks,
+		check{"ML-KEM-768/go-stdlib/keygen", stdlibMLKEM768KeyGen},
+	)
+}
+
+// crypto/mlkemは秘密鍵をシード形式でしか公開しないため、カプセル化鍵だけを比較する
+func stdlibMLKEM768KeyGen() error {
+	seed := append(mustDecode(mlkem768KeyGenD), mustDecode(mlkem768KeyGenZ)...)
+	dk, err := mlkem.NewDecapsulationKey768(seed)
+	if err != nil {
+		return err
+	}
+	return expectDigest("カプセル化鍵", dk.EncapsulationKey().Bytes(), mlkem768KeyGenEKSHA256)
+}
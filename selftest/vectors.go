@@ -0,0 +1,56 @@
+package selftest
+
+// ML-KEM-768の既知解テストベクトル（NIST ACVP ML-KEM-keyGen-FIPS203 / ML-KEM-encapDecap-FIPS203 の tcId 26）
+// 長い出力はSHA-256のハッシュ値で比較する
+var (
+	mlkem768KeyGenD        = "e34a701c4c87582f42264ee422d3c684d97611f2523efe0c998af05056d693dc"
+	mlkem768KeyGenZ        = "a85768f3486bd32a01bf9a8f21ea938e648eae4e5448c34c3eb88820b159eedd"
+	mlkem768KeyGenEKSHA256 = "7799c9d8eef172aa78c073514f2f039c240de8c5cb61bca82ba0bc46041ce279"
+	mlkem768KeyGenDKSHA256 = "104b3444c3de2b81143788d27e17648f45c80f617f906156db2258da96dead40"
+
+	mlkem768EncapEK = "89d2cb65f94dcbfc890efc7d0e5a7a38344d1641a3d0b024d50797a5f23c3a18b3101a1269069f43a842bacc098a8821" +
+		"271c673db1beb33034e4d7774d16635c7c2c3c2763453538bc1632e1851591a51642974e5928abb8e55fe55612f9b141" +
+		"aff015545394b2092e590970ec29a7b7e7aa1fb4493bf7cb731906c2a5cb49e6614859064e19b8fa26af51c44b5e7535" +
+		"bfdac072b646d3ea490d277f0d97ced47395fed91e8f2bce0e3ca122c2025f74067ab928a822b35653a74f06757629af" +
+		"b1a1caf237100ea935e793c8f58a71b3d6ae2c8658b10150d4a38f572a0d49d28ae89451d338326fdb3b4350036c1081" +
+		"117740edb86b12081c5c1223dbb5660d5b3cb3787d481849304c68be875466f14ee5495c2bd795ae412d09002d65b871" +
+		"9b90cba3603ac4958ea03cc138c86f7851593125334701b677f82f4952a4c93b5b4c134bb42a857fd15c650864a6aa94" +
+		"eb691c0b691be4684c1f5b7490467fc01b1d1fda4dda35c4ecc231bc73a6fef42c99d34eb82a4d014987b3e386910c62" +
+		"679a118f3c5bd9f467e4162042424357db92ef484a4a1798c1257e870a30cb20aaa0335d83314fe0aa7e63a862648041" +
+		"a72a6321523220b1ace9bb701b21ac1253cb812c15575a9085eabeade73a4ae76e6a7b158a20586d78a5ac620a5c9abc" +
+		"c9c043350a73656b0abe822da5e0ba76045fad75401d7a3b703791b7e99261710f86b72421d240a347638377205a152c" +
+		"794130a4e047742b888303bddc309116764de7424cebea6db65348ac537e01a9cc56ea667d5aa87ac9aaa4317d262c10" +
+		"143050b8d07a728ca633c13e468abcead372c77b8ecf3b986b98c1e55860b2b4216766ad874c35ed7205068739230220" +
+		"b5a2317d102c598356f168acbe80608de4c9a710b8dd07078cd7c671058af1b0b8304a314f7b29be78a933c7b9294424" +
+		"954a1bf8bc745de86198659e0e1225a910726074969c39a97c19240601a46e013dcdcb677a8cbd2c95a40629c256f24a" +
+		"328951df57502ab30772cc7e5b850027c8551781ce4985bdacf6b865c104e8a4bc65c41694d456b7169e45ab3d7acabe" +
+		"afe23ad6a7b94d1979a2f4c1cae7cd77d681d290b5d8e451bfdcccf5310b9d12a88ec29b10255d5e17a192670aa9731c" +
+		"5ca67ec784c502781be8527d6fc003c6701b3632284b40307a527c7620377feb0b73f722c9e3cd4dec64876b93ab5b7c" +
+		"fc4a657f852b659282864384f442b22e8a21109387b8b47585fc680d0ba45c7a8b1d7274bda57845d100d0f42a3b7462" +
+		"8773351fd7ac305b2497639be90b3f4f71a6aa3561eecc6a691bb5cb3914d8634ca1e1af543c049a8c6e868c51f0423b" +
+		"d2d5ae09b79e57c27f3fe3ae2b26a441babfc6718ce8c05b4fe793b910b8fbcbbe7f1013242b40e0514d0bdc5c88bac5" +
+		"94c794ce5122fbf34896819147b928381587963b0b90034aa07a10be176e01c80ad6a4b71b10af4241400a2a4cbbc059" +
+		"61a15ec1474ed51a3cc6d35800679a462809caa3ab4f7094cd6610b4a700cba939e7eac93e38c99755908727619ed76a" +
+		"34e53c4fa25bfc97008206697dd145e5b9188e5b014e941681e15fe3e132b8a3903474148ba28b987111c9bcb3989bbb" +
+		"c671c581b44a492845f288e62196e471fed3c39c1bbddb0837d0d4706b0922c4"
+	mlkem768EncapM       = "2ce74ad291133518fe60c7df5d251b9d82add48462ff505c6e547e949e6b6bf7"
+	mlkem768EncapCSHA256 = "ac57163b80ead205b8323e1402b8ca66bece40d8df9994b12d43bbb4f6e19bf4"
+	mlkem768EncapK       = "2696d28e9c61c2a01ce9b1608dcb9d292785a0cd58efb7fe13b1de95f0db55b3"
+)
+
+// RSA-OAEPの既知解テストベクトル（RSA Laboratories「Test vectors for RSA-OAEP」の Example 1.1、SHA-1、ラベルなし）
+var (
+	oaepN = "a8b3b284af8eb50b387034a860f146c4919f318763cd6c5598c8ae4811a1e0abc4c7e0b082d693a5e7fced675cf46685" +
+		"12772c0cbc64a742c6c630f533c8cc72f62ae833c40bf25842e984bb78bdbf97c0107d55bdb662f5c4e0fab9845cb514" +
+		"8ef7392dd3aaff93ae1e6b667bb3d4247616d4f5ba10d4cfd226de88d39f16fb"
+	oaepE = 65537
+	oaepD = "53339cfdb79fc8466a655c7316aca85c55fd8f6dd898fdaf119517ef4f52e8fd8e258df93fee180fa0e4ab29693cd83b" +
+		"152a553d4ac4d1812b8b9fa5af0e7f55fe7304df41570926f3311f15c4d65a732c483116ee3d3d2d0af3549ad9bf7cbf" +
+		"b78ad884f84d5beb04724dc7369b31def37d0cf539e9cfcdd3de653729ead5d1"
+
+	oaepMessage    = "6628194e12073db03ba94cda9ef9532397d50dba79b987004afefe34"
+	oaepSeed       = "18b776ea21069d69776a33e96bad48e1dda0a5ef"
+	oaepCiphertext = "354fe67b4a126d5d35fe36c777791a3f7ba13def484e2d3908aff722fad468fb21696de95d0be911c2d3174f8afcc201" +
+		"035f7b6d8e69402de5451618c21a535fa9d7bfc5b8dd9fc243f8cf927db31322d6e881eaa91a996170e657a05a266426" +
+		"d98c88003f8477c1227094a0d9fa1e8c4024309ce1ecccb5210035d47ac72e8a"
+)
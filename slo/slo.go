@@ -0,0 +1,93 @@
+// Package slo は暗号処理のパイプラインの成功率とSLOのバーンレートを計算する
+// Prometheusのレコーディングルールを生成する
+// メトリクス名はmetrics.Nameで変換するため、-metric-prefixや-metric-namespaceで置き換えた名前とも一致する
+package slo
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+
+	// クライアントのメトリクスの接頭辞（client_）を登録し、-metric-prefixで置き換えられるようにする
+	_ "github.com/keyi1000/PQC_grafana/benchclient"
+)
+
+// 成功率を計算する指標（SLI）
+type SLI struct {
+	Metric string   // 試行回数のカウンター（コード上の名前）
+	Result string   // 結果を表すラベル
+	Good   string   // 成功とみなすラベルの値
+	By     []string // 集計するラベル
+}
+
+// 暗号処理のパイプラインのSLI
+// serviceで集計するため、参照クライアント（aes-client-python など）の系列も別々に計算される
+var SLIs = []SLI{
+	// 公開鍵の取得からサーバーでの復号の確認までの鍵合意
+	{Metric: "client_sessions_total", Result: "result", Good: "success", By: []string{"service", "algorithm", "transport"}},
+	// サーバーが復号した平文の確認
+	{Metric: "client_decrypt_verifications_total", Result: "result", Good: "ok", By: []string{"service", "target"}},
+	// 外部のKEMエンドポイントとの相互運用性の確認
+	{Metric: "client_interop_checks_total", Result: "result", Good: "success", By: []string{"service", "target"}},
+}
+
+// 成功率とバーンレートを計算する期間
+// マルチウィンドウのバーンレートアラート（1h/5m、6h/30m、1d/2h、3d/6h）に必要な組み合わせ
+var Windows = []string{"5m", "30m", "1h", "2h", "6h", "1d", "3d"}
+
+// レコーディングルールの設定
+type Config struct {
+	Objective float64 // 成功率の目標（例: 0.99）
+	Interval  string  // ルールを評価する間隔（空の場合はPrometheusの設定に従う）
+}
+
+// デフォルトの設定
+func DefaultConfig() Config {
+	return Config{Objective: 0.99}
+}
+
+// レコーディングルールをYAMLで書き出す
+func Write(w io.Writer, cfg Config) error {
+	if cfg.Objective <= 0 || cfg.Objective >= 1 {
+		return fmt.Errorf("目標は0より大きく1より小さい値で指定してください: %v", cfg.Objective)
+	}
+	objective := strconv.FormatFloat(cfg.Objective, 'f', -1, 64)
+	budget := strconv.FormatFloat(1-cfg.Objective, 'g', 6, 64)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# slo-rules で生成（目標 %s）\n", objective)
+	b.WriteString("groups:\n")
+	for _, sli := range SLIs {
+		metric := metrics.Name(sli.Metric)
+		base := strings.TrimSuffix(metric, "_total")
+		level := strings.Join(sli.By, "_")
+		by := strings.Join(sli.By, ", ")
+
+		fmt.Fprintf(&b, "  - name: %s\n", "pqc_slo_"+base)
+		if cfg.Interval != "" {
+			fmt.Fprintf(&b, "    interval: %s\n", cfg.Interval)
+		}
+		b.WriteString("    rules:\n")
+		writeRule(&b, base+":slo_objective", "vector("+objective+")")
+		for _, window := range Windows {
+			ratio := fmt.Sprintf("%s:%s:success_ratio_rate%s", level, base, window)
+			writeRule(&b, ratio, fmt.Sprintf(
+				"sum by (%s) (rate(%s{%s=%q}[%s])) / sum by (%s) (rate(%s[%s]))",
+				by, metric, sli.Result, sli.Good, window, by, metric, window,
+			))
+			writeRule(&b, fmt.Sprintf("%s:%s:burn_rate%s", level, base, window),
+				fmt.Sprintf("(1 - %s) / %s", ratio, budget))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// PromQLはダブルクォートを含むため、YAMLのダブルクォート文字列として書き出す
+func writeRule(b *strings.Builder, record, expr string) {
+	fmt.Fprintf(b, "      - record: %s\n", record)
+	fmt.Fprintf(b, "        expr: %s\n", strconv.Quote(expr))
+}
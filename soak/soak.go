@@ -0,0 +1,184 @@
+// Package soak は長時間の連続運転（ソークテスト）でメモリやゴルーチン、ファイルディスクリプタのリークを検出する
+//
+// 一定間隔で使用量を記録し、直近の期間の増加の傾き（最小二乗法）と当てはまりの良さから
+// 単調に増え続けている資源をリークの疑いとして公開する
+package soak
+
+import (
+	"log"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"time"
+
+	pqcmetrics "github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "soak"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は soak_）
+var factory = pqcmetrics.NewFactory(ServiceName, "soak_")
+
+// 監視する資源
+const (
+	ResourceHeap       = "heap"       // 直前のGC後に生存しているヒープ（バイト）
+	ResourceGoroutines = "goroutines" // ゴルーチン数
+	ResourceFDs        = "open_fds"   // 開いているファイルディスクリプタ数（Linuxのみ）
+)
+
+var (
+	usage = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "soak_resource_usage",
+			Help: "Latest sampled usage of each resource (heap in bytes, goroutines and open file descriptors in count)",
+		},
+		[]string{"resource"},
+	)
+	growth = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "soak_resource_growth_per_hour",
+			Help: "Least-squares growth rate of each resource over the soak window, in units per hour",
+		},
+		[]string{"resource"},
+	)
+	fit = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "soak_resource_growth_r2",
+			Help: "Coefficient of determination of the growth fit over the soak window (close to 1 means steady growth)",
+		},
+		[]string{"resource"},
+	)
+	leakSuspected = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "soak_leak_suspected",
+			Help: "1 if the resource has grown steadily over a full soak window beyond the threshold, 0 otherwise",
+		},
+		[]string{"resource"},
+	)
+	uptime = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "soak_uptime_seconds",
+			Help: "Time since the soak monitor started in seconds",
+		},
+	)
+)
+
+// ソークテストの設定
+type Config struct {
+	SampleInterval time.Duration // 使用量を記録する間隔
+	Window         time.Duration // 傾きを求める期間（この期間分の記録がそろうまではリークと判定しない）
+	MinR2          float64       // リークと判定する当てはまりの下限（単調に増えているか）
+
+	// リークと判定する1時間あたりの増加量
+	HeapThreshold      float64
+	GoroutineThreshold float64
+	FDThreshold        float64
+}
+
+// デフォルト設定（30秒ごとに記録し、直近1時間で判定する）
+func DefaultConfig() Config {
+	return Config{
+		SampleInterval:     30 * time.Second,
+		Window:             time.Hour,
+		MinR2:              0.8,
+		HeapThreshold:      4 << 20,
+		GoroutineThreshold: 10,
+		FDThreshold:        10,
+	}
+}
+
+type sample struct {
+	at     time.Time
+	values map[string]float64
+}
+
+// 使用量の記録とリークの判定をバックグラウンドで開始する
+func Start(cfg Config) {
+	thresholds := map[string]float64{
+		ResourceHeap:       cfg.HeapThreshold,
+		ResourceGoroutines: cfg.GoroutineThreshold,
+		ResourceFDs:        cfg.FDThreshold,
+	}
+	log.Printf("ソークテストを開始します（%v ごとに記録し、直近 %v の増加でリークを判定）", cfg.SampleInterval, cfg.Window)
+	go func() {
+		start := time.Now()
+		var samples []sample
+		ticker := time.NewTicker(cfg.SampleInterval)
+		defer ticker.Stop()
+		for now := start; ; now = <-ticker.C {
+			uptime.Set(now.Sub(start).Seconds())
+			s := sample{at: now, values: read()}
+			samples = append(samples, s)
+			// 判定に使う期間より古い記録を捨てる
+			for len(samples) > 2 && now.Sub(samples[1].at) >= cfg.Window {
+				samples = samples[1:]
+			}
+			full := now.Sub(samples[0].at) >= cfg.Window
+			for resource, value := range s.values {
+				usage.WithLabelValues(resource).Set(value)
+				slope, r2 := regress(samples, resource)
+				growth.WithLabelValues(resource).Set(slope)
+				fit.WithLabelValues(resource).Set(r2)
+				suspected := full && slope > thresholds[resource] && r2 >= cfg.MinR2
+				leakSuspected.WithLabelValues(resource).Set(boolToFloat(suspected))
+			}
+		}
+	}()
+}
+
+// 現在の使用量を読み出す（取得できない資源は含めない）
+func read() map[string]float64 {
+	values := map[string]float64{
+		ResourceGoroutines: float64(runtime.NumGoroutine()),
+	}
+	live := []metrics.Sample{{Name: "/gc/heap/live:bytes"}}
+	metrics.Read(live)
+	if live[0].Value.Kind() == metrics.KindUint64 {
+		values[ResourceHeap] = float64(live[0].Value.Uint64())
+	}
+	if fds, err := os.ReadDir("/proc/self/fd"); err == nil {
+		values[ResourceFDs] = float64(len(fds) - 1) // ReadDir自身が開いたディスクリプタを除く
+	}
+	return values
+}
+
+// 時間（時）に対する使用量の回帰直線の傾きと決定係数を求める
+func regress(samples []sample, resource string) (slope, r2 float64) {
+	var n, sumX, sumY, sumXX, sumXY, sumYY float64
+	for _, s := range samples {
+		y, ok := s.values[resource]
+		if !ok {
+			continue
+		}
+		x := s.at.Sub(samples[0].at).Hours()
+		n++
+		sumX += x
+		sumY += y
+		sumXX += x * x
+		sumXY += x * y
+		sumYY += y * y
+	}
+	if n < 3 {
+		return 0, 0
+	}
+	varX := n*sumXX - sumX*sumX
+	varY := n*sumYY - sumY*sumY
+	if varX == 0 {
+		return 0, 0
+	}
+	cov := n*sumXY - sumX*sumY
+	slope = cov / varX
+	if varY == 0 {
+		return slope, 0
+	}
+	return slope, cov * cov / (varX * varY)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,290 @@
+package sshkex
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/cloudflare/circl/kem/mlkem/mlkem768"
+	"github.com/keyi1000/PQC_grafana/cryptoutil"
+)
+
+// 鍵交換の段階
+const (
+	phaseClientKeygen = "client_keygen" // クライアントの鍵生成（SSH_MSG_KEX_ECDH_INIT / HYBRID_INIT の作成）
+	phaseServerDerive = "server_derive" // サーバーのカプセル化・DHと共有秘密鍵の導出（REPLY の作成）
+	phaseClientDerive = "client_derive" // クライアントのデカプセル化・DHと共有秘密鍵の導出
+)
+
+// クライアントとサーバーの交換ハッシュが一致しない
+var errHashMismatch = errors.New("交換ハッシュが一致しません")
+
+// 1回の鍵交換の結果
+type exchangeResult struct {
+	clientInit  int // クライアントが送る公開値のサイズ
+	serverReply int // サーバーが返す公開値（カプセル化テキスト）のサイズ
+	phases      map[string]time.Duration
+}
+
+// SSHの鍵交換方式
+type method interface {
+	// SSHのkex名（ML-KEM単体の場合は比較用の名前）
+	name() string
+	// 鍵交換を1回行い、両者の交換ハッシュが一致することを確認する
+	exchange() (*exchangeResult, error)
+}
+
+// 計測する鍵交換方式
+// OpenSSHのsntrup761x25519-sha512はGoで利用できる実装がないため含めない
+func methods() []method {
+	return []method{curve25519Method{}, mlkem768x25519Method{}, mlkem768Method{}}
+}
+
+// 段階の所要時間を計測する
+type stopwatch struct {
+	phases map[string]time.Duration
+}
+
+func newStopwatch() *stopwatch {
+	return &stopwatch{phases: make(map[string]time.Duration)}
+}
+
+func (s *stopwatch) time(phase string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	s.phases[phase] = time.Since(start)
+	return err
+}
+
+// curve25519-sha256（RFC 8731）
+type curve25519Method struct{}
+
+func (curve25519Method) name() string { return "curve25519-sha256" }
+
+func (m curve25519Method) exchange() (*exchangeResult, error) {
+	sw := newStopwatch()
+	var clientKey *ecdh.PrivateKey
+	if err := sw.time(phaseClientKeygen, func() (err error) {
+		clientKey, err = ecdh.X25519().GenerateKey(rand.Reader)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	qc := clientKey.PublicKey().Bytes()
+
+	var qs, serverHash []byte
+	if err := sw.time(phaseServerDerive, func() error {
+		serverKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		peer, err := ecdh.X25519().NewPublicKey(qc)
+		if err != nil {
+			return err
+		}
+		k, err := serverKey.ECDH(peer)
+		if err != nil {
+			return err
+		}
+		defer cryptoutil.Zeroize(k)
+		qs = serverKey.PublicKey().Bytes()
+		serverHash = exchangeHash(qc, qs, mpint(k))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var clientHash []byte
+	if err := sw.time(phaseClientDerive, func() error {
+		peer, err := ecdh.X25519().NewPublicKey(qs)
+		if err != nil {
+			return err
+		}
+		k, err := clientKey.ECDH(peer)
+		if err != nil {
+			return err
+		}
+		defer cryptoutil.Zeroize(k)
+		clientHash = exchangeHash(qc, qs, mpint(k))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return finish(qc, qs, clientHash, serverHash, sw)
+}
+
+// mlkem768x25519-sha256（OpenSSH 9.9以降のデフォルト、draft-ietf-sshm-mlkem-hybrid-kex）
+// 共有秘密鍵は K = SHA-256(K_PQ || K_CL) を文字列として交換ハッシュに含める
+type mlkem768x25519Method struct{}
+
+func (mlkem768x25519Method) name() string { return "mlkem768x25519-sha256" }
+
+func (m mlkem768x25519Method) exchange() (*exchangeResult, error) {
+	sw := newStopwatch()
+	var kemPub *mlkem768.PublicKey
+	var kemPriv *mlkem768.PrivateKey
+	var clientKey *ecdh.PrivateKey
+	if err := sw.time(phaseClientKeygen, func() (err error) {
+		if kemPub, kemPriv, err = mlkem768.GenerateKeyPair(rand.Reader); err != nil {
+			return err
+		}
+		clientKey, err = ecdh.X25519().GenerateKey(rand.Reader)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	// C_INIT = ML-KEMの公開鍵 || X25519の公開鍵
+	clientInit := make([]byte, mlkem768.PublicKeySize, mlkem768.PublicKeySize+32)
+	kemPub.Pack(clientInit)
+	clientInit = append(clientInit, clientKey.PublicKey().Bytes()...)
+
+	var serverReply, serverHash []byte
+	if err := sw.time(phaseServerDerive, func() error {
+		if len(clientInit) != mlkem768.PublicKeySize+32 {
+			return fmt.Errorf("C_INITの長さが不正: %d", len(clientInit))
+		}
+		var pk mlkem768.PublicKey
+		if err := pk.Unpack(clientInit[:mlkem768.PublicKeySize]); err != nil {
+			return err
+		}
+		ct := make([]byte, mlkem768.CiphertextSize)
+		kpq := make([]byte, mlkem768.SharedKeySize)
+		pk.EncapsulateTo(ct, kpq, nil)
+		defer cryptoutil.Zeroize(kpq)
+
+		serverKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		peer, err := ecdh.X25519().NewPublicKey(clientInit[mlkem768.PublicKeySize:])
+		if err != nil {
+			return err
+		}
+		kcl, err := serverKey.ECDH(peer)
+		if err != nil {
+			return err
+		}
+		defer cryptoutil.Zeroize(kcl)
+		// S_REPLY = ML-KEMのカプセル化テキスト || X25519の公開鍵
+		serverReply = append(ct, serverKey.PublicKey().Bytes()...)
+		serverHash = exchangeHash(clientInit, serverReply, sshString(hybridSecret(kpq, kcl)))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var clientHash []byte
+	if err := sw.time(phaseClientDerive, func() error {
+		kpq := make([]byte, mlkem768.SharedKeySize)
+		kemPriv.DecapsulateTo(kpq, serverReply[:mlkem768.CiphertextSize])
+		defer cryptoutil.Zeroize(kpq)
+		peer, err := ecdh.X25519().NewPublicKey(serverReply[mlkem768.CiphertextSize:])
+		if err != nil {
+			return err
+		}
+		kcl, err := clientKey.ECDH(peer)
+		if err != nil {
+			return err
+		}
+		defer cryptoutil.Zeroize(kcl)
+		clientHash = exchangeHash(clientInit, serverReply, sshString(hybridSecret(kpq, kcl)))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return finish(clientInit, serverReply, clientHash, serverHash, sw)
+}
+
+// ハイブリッドの共有秘密鍵 SHA-256(K_PQ || K_CL)
+func hybridSecret(kpq, kcl []byte) []byte {
+	h := sha256.New()
+	h.Write(kpq)
+	h.Write(kcl)
+	return h.Sum(nil)
+}
+
+// ML-KEM-768単体（SSHのkexではなく、ハイブリッド化による追加分を見るための比較用）
+type mlkem768Method struct{}
+
+func (mlkem768Method) name() string { return "mlkem768" }
+
+func (m mlkem768Method) exchange() (*exchangeResult, error) {
+	sw := newStopwatch()
+	var kemPub *mlkem768.PublicKey
+	var kemPriv *mlkem768.PrivateKey
+	if err := sw.time(phaseClientKeygen, func() (err error) {
+		kemPub, kemPriv, err = mlkem768.GenerateKeyPair(rand.Reader)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	clientInit := make([]byte, mlkem768.PublicKeySize)
+	kemPub.Pack(clientInit)
+
+	var ct, serverHash []byte
+	if err := sw.time(phaseServerDerive, func() error {
+		var pk mlkem768.PublicKey
+		if err := pk.Unpack(clientInit); err != nil {
+			return err
+		}
+		ct = make([]byte, mlkem768.CiphertextSize)
+		k := make([]byte, mlkem768.SharedKeySize)
+		pk.EncapsulateTo(ct, k, nil)
+		defer cryptoutil.Zeroize(k)
+		serverHash = exchangeHash(clientInit, ct, sshString(k))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var clientHash []byte
+	if err := sw.time(phaseClientDerive, func() error {
+		k := make([]byte, mlkem768.SharedKeySize)
+		kemPriv.DecapsulateTo(k, ct)
+		defer cryptoutil.Zeroize(k)
+		clientHash = exchangeHash(clientInit, ct, sshString(k))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return finish(clientInit, ct, clientHash, serverHash, sw)
+}
+
+// 両者の交換ハッシュを比較して結果をまとめる
+func finish(clientInit, serverReply, clientHash, serverHash []byte, sw *stopwatch) (*exchangeResult, error) {
+	if !bytes.Equal(clientHash, serverHash) {
+		return nil, errHashMismatch
+	}
+	return &exchangeResult{clientInit: len(clientInit), serverReply: len(serverReply), phases: sw.phases}, nil
+}
+
+// 交換ハッシュ H = SHA-256(string(C_INIT) || string(S_REPLY) || K)
+// 実際のSSHではバージョン文字列、KEXINIT、ホスト鍵も含めるが、ここでは鍵交換方式による差分のみを計測する
+func exchangeHash(clientInit, serverReply, encodedSecret []byte) []byte {
+	h := sha256.New()
+	h.Write(sshString(clientInit))
+	h.Write(sshString(serverReply))
+	h.Write(encodedSecret)
+	return h.Sum(nil)
+}
+
+// SSHのstring型（RFC 4251）
+func sshString(b []byte) []byte {
+	out := binary.BigEndian.AppendUint32(nil, uint32(len(b)))
+	return append(out, b...)
+}
+
+// SSHのmpint型（RFC 4251）。curve25519-sha256では共有秘密鍵を符号なし整数として扱う
+func mpint(b []byte) []byte {
+	v := new(big.Int).SetBytes(b).Bytes()
+	if len(v) > 0 && v[0]&0x80 != 0 {
+		v = append([]byte{0}, v...)
+	}
+	return sshString(v)
+}
@@ -0,0 +1,181 @@
+// Package tlssim はTLS 1.3の完全なハンドシェイクを、実際に計算した鍵共有・証明書チェーン・署名のサイズから組み立て、
+// 鍵交換方式と署名方式の組み合わせごとに送信されるバイト数とフライト数を見積もる
+//
+// 暗号処理単体のベンチマーク（kembench、certchain）と、プロトコル全体のダッシュボードをつなぐために使う
+package tlssim
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/certchain"
+	"github.com/keyi1000/PQC_grafana/kembench"
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/netem"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "tls-handshake-sim"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は tls_sim_）
+var factory = metrics.NewFactory(ServiceName, "tls_sim_")
+
+var (
+	handshakeBytes = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tls_sim_handshake_bytes",
+			Help: "Estimated TLS 1.3 record bytes sent during a full handshake, by key exchange, signature scheme, chain levels and direction (client, server)",
+		},
+		[]string{"kex", "signature", "levels", "direction"},
+	)
+	messageSize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tls_sim_message_size_bytes",
+			Help: "Size of each handshake message including its handshake header in bytes",
+		},
+		[]string{"kex", "signature", "levels", "message"},
+	)
+	flights = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tls_sim_flights",
+			Help: "Estimated number of flights in the handshake, by transport (tcp limited by the initial congestion window, quic also by the anti-amplification limit)",
+		},
+		[]string{"kex", "signature", "levels", "transport"},
+	)
+	roundTrips = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tls_sim_round_trips",
+			Help: "Estimated round trips until the client can send application data, excluding the transport's own handshake",
+		},
+		[]string{"kex", "signature", "levels", "transport"},
+	)
+	simulationsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tls_sim_simulations_total",
+			Help: "Total number of simulated handshakes, by result",
+		},
+		[]string{"kex", "signature", "result"},
+	)
+)
+
+// シミュレーションの設定
+type Config struct {
+	Interval     time.Duration // 鍵共有と署名を計算し直す間隔（ECDSAの署名など、サイズが変わるものがある）
+	KeyExchanges []string      // kembenchに登録されたKEMの名前
+	TCPSegments  int           // TCPの初期ウィンドウのセグメント数
+	MSS          int           // TCPの最大セグメントサイズ（パケット数の見積もりにも使う）
+	Transfer     bool          // ハンドシェイクのバイト数をループバックのTCP接続で実際に転送して計測するか
+	TransferMSS  int           // 転送の計測で設定するMSS（0の場合はOSの既定値、Linuxのみ）
+	Netem        netem.Config  // 転送の計測で接続に加える人工的な遅延とパケットロス
+}
+
+// デフォルト設定（現在の楕円曲線、ブラウザーが使うハイブリッド、ML-KEM単体）
+func DefaultConfig() Config {
+	return Config{
+		Interval:     10 * time.Second,
+		KeyExchanges: []string{"ECDH-P256", "X25519MLKEM768", "ML-KEM-768", "ML-KEM-1024"},
+		TCPSegments:  10,
+		MSS:          1460,
+	}
+}
+
+// 鍵交換方式のリストを解釈する（例: "ECDH-P256,ML-KEM-768"）
+func ParseKeyExchanges(s string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := kembench.Lookup(name, ""); !ok {
+			return nil, fmt.Errorf("登録されていない鍵交換方式です: %q", name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// 一定間隔ですべての組み合わせのハンドシェイクを組み立て、サイズとフライト数を記録する
+func Run(cfg Config) error {
+	var kems []kembench.KEM
+	for _, name := range cfg.KeyExchanges {
+		kem, ok := kembench.Lookup(name, "")
+		if !ok {
+			return fmt.Errorf("登録されていない鍵交換方式です: %q", name)
+		}
+		kems = append(kems, kem)
+	}
+	var builders []*certchain.Builder
+	for _, scheme := range certchain.Schemes() {
+		b, err := certchain.NewBuilder(scheme)
+		if err != nil {
+			return err
+		}
+		builders = append(builders, b)
+	}
+	transports := []Transport{TCP(cfg.TCPSegments, cfg.MSS), QUIC()}
+	var lb *loopback
+	if cfg.Transfer {
+		if err := cfg.Netem.Validate(); err != nil {
+			return err
+		}
+		l, err := newLoopback(cfg.TransferMSS, netem.New(cfg.Netem))
+		if err != nil {
+			return err
+		}
+		lb = l
+	}
+
+	// サイズはほとんど変わらないため、起動直後に一度記録してから間隔ごとに計算し直す
+	simulateAll(kems, builders, transports, cfg.MSS, lb)
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		simulateAll(kems, builders, transports, cfg.MSS, lb)
+	}
+	return nil
+}
+
+// すべての組み合わせのハンドシェイクを組み立てて記録する（lbがnilの場合は転送を計測しない）
+func simulateAll(kems []kembench.KEM, builders []*certchain.Builder, transports []Transport, mss int, lb *loopback) {
+	for _, kem := range kems {
+		for _, b := range builders {
+			for _, levels := range certchain.Levels {
+				h, err := Simulate(kem, b, levels)
+				if err != nil {
+					simulationsTotal.WithLabelValues(kem.Name(), b.Scheme(), "failure").Inc()
+					log.Printf("ハンドシェイクの組み立てに失敗 [%s, %s]: %v", kem.Name(), b.Scheme(), err)
+					continue
+				}
+				simulationsTotal.WithLabelValues(kem.Name(), b.Scheme(), "success").Inc()
+				record(h, transports, mss)
+				if lb != nil {
+					recordTransfer(lb, h)
+				}
+			}
+		}
+	}
+}
+
+// ハンドシェイクのサイズとトランスポートごとのフライト数・パケット数を記録する
+func record(h *Handshake, transports []Transport, mss int) {
+	labels := h.labels()
+	for _, m := range h.Messages {
+		messageSize.WithLabelValues(append(labels, m.Name)...).Set(float64(m.Size))
+	}
+	handshakeBytes.WithLabelValues(append(labels, Client)...).Set(float64(h.WireBytes(Client)))
+	handshakeBytes.WithLabelValues(append(labels, Server)...).Set(float64(h.WireBytes(Server)))
+	for _, t := range transports {
+		serverFlights := t.ServerFlights(h)
+		// ClientHello、サーバーのフライト、クライアントのFinished
+		flights.WithLabelValues(append(labels, t.Name)...).Set(float64(serverFlights + 2))
+		roundTrips.WithLabelValues(append(labels, t.Name)...).Set(float64(serverFlights))
+	}
+	recordPackets(h, labels, mss)
+}
+
+// メトリクスの共通のラベル（kex、signature、levels）
+func (h *Handshake) labels() []string {
+	return []string{h.KeyExchange, h.Signature, strconv.Itoa(h.Levels)}
+}
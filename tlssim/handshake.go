@@ -0,0 +1,150 @@
+package tlssim
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/keyi1000/PQC_grafana/certchain"
+	"github.com/keyi1000/PQC_grafana/kembench"
+)
+
+// TLS 1.3（RFC 8446）のレコードとハンドシェイクメッセージの固定サイズ
+const (
+	recordHeaderSize    = 5       // ContentType、legacy_record_version、length
+	maxRecordPlaintext  = 1 << 14 // 1レコードに入る平文の最大サイズ
+	encryptedRecordTail = 1 + 16  // 暗号化レコードの内側のContentTypeとAEADのタグ（AES-128-GCM）
+	handshakeHeaderSize = 4       // HandshakeTypeと3バイトの長さ
+	finishedSize        = 32      // SHA-256のHMAC
+)
+
+// ハンドシェイクメッセージの送信者
+const (
+	Client = "client"
+	Server = "server"
+)
+
+// 1つのハンドシェイクメッセージ
+type Message struct {
+	Name      string
+	Sender    string
+	Size      int  // ハンドシェイクヘッダーを含むサイズ
+	Encrypted bool // ハンドシェイク鍵で暗号化されたレコードで送るか
+}
+
+// 鍵交換方式・署名方式・チェーンの段数の組み合わせで組み立てた完全なハンドシェイク（PSKなし、1-RTT）
+type Handshake struct {
+	KeyExchange string
+	Signature   string
+	Levels      int
+	Messages    []Message
+}
+
+// 鍵共有と署名を実際に計算し、そのサイズでハンドシェイクのメッセージを組み立てる
+// クライアントの鍵共有はKEMの公開鍵、サーバーの鍵共有はカプセル化した暗号文（ECDHは一時公開鍵）
+func Simulate(kem kembench.KEM, builder *certchain.Builder, levels int) (*Handshake, error) {
+	publicKey, _, err := kem.KeyGen()
+	if err != nil {
+		return nil, fmt.Errorf("鍵共有の鍵生成エラー: %w", err)
+	}
+	ciphertext, _, err := kem.Encapsulate(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("鍵共有のカプセル化エラー: %w", err)
+	}
+	chain, err := builder.Build(levels)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := builder.ServerSign(certificateVerifyContent())
+	if err != nil {
+		return nil, fmt.Errorf("CertificateVerifyの署名エラー: %w", err)
+	}
+
+	return &Handshake{
+		KeyExchange: kem.Name(),
+		Signature:   builder.Scheme(),
+		Levels:      levels,
+		Messages: []Message{
+			{Name: "client_hello", Sender: Client, Size: handshakeHeaderSize + clientHelloSize(len(publicKey))},
+			{Name: "server_hello", Sender: Server, Size: handshakeHeaderSize + serverHelloSize(len(ciphertext))},
+			{Name: "encrypted_extensions", Sender: Server, Size: handshakeHeaderSize + 2, Encrypted: true},
+			{Name: "certificate", Sender: Server, Size: handshakeHeaderSize + certificateSize(chain), Encrypted: true},
+			{Name: "certificate_verify", Sender: Server, Size: handshakeHeaderSize + 2 + 2 + len(signature), Encrypted: true},
+			{Name: "server_finished", Sender: Server, Size: handshakeHeaderSize + finishedSize, Encrypted: true},
+			{Name: "client_finished", Sender: Client, Size: handshakeHeaderSize + finishedSize, Encrypted: true},
+		},
+	}, nil
+}
+
+// CertificateVerifyで署名する内容（64個の空白、コンテキスト文字列、0、トランスクリプトのハッシュ）
+func certificateVerifyContent() []byte {
+	content := bytes.Repeat([]byte{0x20}, 64)
+	content = append(content, "TLS 1.3, server CertificateVerify"...)
+	content = append(content, 0)
+	// トランスクリプトのハッシュはサイズだけが結果に影響するため、固定の値で代用する
+	transcript := sha256.Sum256([]byte("ClientHello...Certificate"))
+	return append(content, transcript[:]...)
+}
+
+// ClientHelloの本体のサイズ（SNI、supported_versions、supported_groups、signature_algorithms、key_share、psk_key_exchange_modes）
+func clientHelloSize(keyShare int) int {
+	size := 2 + 32 + 1 + 32 // legacy_version、random、legacy_session_id（ミドルボックス互換のため32バイト）
+	size += 2 + 2*3         // TLS_AES_128_GCM_SHA256、TLS_AES_256_GCM_SHA384、TLS_CHACHA20_POLY1305_SHA256
+	size += 1 + 1           // legacy_compression_methods
+	extensions := []int{
+		2 + 1 + 2 + len(certchain.ServerName), // server_name
+		1 + 2,                                 // supported_versions（TLS 1.3のみ）
+		2 + 2,                                 // supported_groups（鍵共有を送る1つのグループ）
+		2 + 2*8,                               // signature_algorithms（8方式）
+		2 + 2 + 2 + keyShare,                  // key_share
+		1 + 1,                                 // psk_key_exchange_modes
+	}
+	size += 2
+	for _, ext := range extensions {
+		size += 4 + ext // 拡張の種類と長さ
+	}
+	return size
+}
+
+// ServerHelloの本体のサイズ（supported_versions、key_share）
+func serverHelloSize(keyShare int) int {
+	size := 2 + 32 + 1 + 32 + 2 + 1 // legacy_version、random、legacy_session_id_echo、cipher_suite、legacy_compression_method
+	size += 2
+	size += 4 + 2                // supported_versions
+	size += 4 + 2 + 2 + keyShare // key_share
+	return size
+}
+
+// Certificateの本体のサイズ（ルート証明書は送らない）
+func certificateSize(chain *certchain.Chain) int {
+	size := 1 + 3 // certificate_request_context、certificate_list の長さ
+	for _, der := range chain.Certificates[:len(chain.Certificates)-1] {
+		size += 3 + len(der) + 2 // 証明書の長さ、証明書、拡張の長さ
+	}
+	return size
+}
+
+// 送信者がハンドシェイクで送るレコードのバイト数（TCPやQUICのヘッダーは含まない）
+// 暗号化しないメッセージはメッセージごとのレコード、暗号化するメッセージはまとめてレコードに分割する
+func (h *Handshake) WireBytes(sender string) int {
+	total, encrypted := 0, 0
+	for _, m := range h.Messages {
+		if m.Sender != sender {
+			continue
+		}
+		if m.Encrypted {
+			encrypted += m.Size
+			continue
+		}
+		total += m.Size + recordHeaderSize*records(m.Size)
+	}
+	if encrypted > 0 {
+		total += encrypted + (recordHeaderSize+encryptedRecordTail)*records(encrypted)
+	}
+	return total
+}
+
+// 平文のサイズを送るのに必要なレコードの数
+func records(size int) int {
+	return (size + maxRecordPlaintext - 1) / maxRecordPlaintext
+}
@@ -0,0 +1,47 @@
+package tlssim
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	packets = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tls_sim_packets",
+			Help: "Estimated packets needed to carry the handshake bytes of one direction, by transport (tcp uses the configured MSS, quic 1200-byte datagrams)",
+		},
+		[]string{"kex", "signature", "levels", "direction", "transport"},
+	)
+	messagePackets = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tls_sim_message_packets",
+			Help: "TCP segments needed to carry one handshake message on its own at the configured MSS (more than 1 means the message is fragmented)",
+		},
+		[]string{"kex", "signature", "levels", "message"},
+	)
+)
+
+// QUICのパケットのヘッダー・AEADのタグ・CRYPTOフレームのヘッダーの概算（ロングヘッダー、20バイトの接続ID）
+const quicPacketOverhead = 70
+
+// 1つのQUICパケットに入るハンドシェイクのバイト数（最小サイズの1200バイトのデータグラムを使う場合）
+const quicPacketPayload = quicMinInitial - quicPacketOverhead
+
+// payloadバイトのパケットでsizeバイトを送るのに必要なパケット数
+func packetCount(size, payload int) int {
+	return (size + payload - 1) / payload
+}
+
+// ハンドシェイクのメッセージとトランスポートごとのパケット数を記録する
+func recordPackets(h *Handshake, labels []string, mss int) {
+	for _, m := range h.Messages {
+		size := m.Size + recordHeaderSize*records(m.Size)
+		if m.Encrypted {
+			size += encryptedRecordTail * records(m.Size)
+		}
+		messagePackets.WithLabelValues(append(labels, m.Name)...).Set(float64(packetCount(size, mss)))
+	}
+	for _, direction := range []string{Client, Server} {
+		bytes := h.WireBytes(direction)
+		packets.WithLabelValues(append(labels, direction, "tcp")...).Set(float64(packetCount(bytes, mss)))
+		packets.WithLabelValues(append(labels, direction, "quic")...).Set(float64(packetCount(bytes, quicPacketPayload)))
+	}
+}
@@ -0,0 +1,40 @@
+//go:build linux
+
+package tlssim
+
+import (
+	"net"
+	"syscall"
+)
+
+// ソケットのTCP_MAXSEGを設定するnet.Dialer・net.ListenConfigのControl（0の場合はOSの既定値を使う）
+func mssControl(mss int) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		if mss <= 0 {
+			return nil
+		}
+		var sockErr error
+		if err := c.Control(func(fd uintptr) {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_MAXSEG, mss)
+		}); err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
+
+// 接続で実際に使われているMSS
+func effectiveMSS(conn *net.TCPConn) (int, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var mss int
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		mss, sockErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_MAXSEG)
+	}); err != nil {
+		return 0, err
+	}
+	return mss, sockErr
+}
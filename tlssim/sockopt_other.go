@@ -0,0 +1,25 @@
+//go:build !linux
+
+package tlssim
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+var errMSSUnsupported = errors.New("このOSではMSSの設定に対応していません（Linuxのみ）")
+
+// Linux以外ではMSSを指定した場合にエラーにする
+func mssControl(mss int) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		if mss > 0 {
+			return errMSSUnsupported
+		}
+		return nil
+	}
+}
+
+func effectiveMSS(*net.TCPConn) (int, error) {
+	return 0, errMSSUnsupported
+}
@@ -0,0 +1,139 @@
+package tlssim
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/netem"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	transferDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "tls_sim_transfer_duration_seconds",
+			Help:    "Histogram of the time from sending the ClientHello bytes to receiving the whole server flight over a loopback TCP connection in seconds",
+			Buckets: []float64{0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+		},
+		[]string{"kex", "signature", "levels"},
+	)
+	transferMSS = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "tls_sim_transfer_mss_bytes",
+			Help: "MSS actually used by the loopback TCP connection of the transfer measurement",
+		},
+	)
+	transfersTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tls_sim_transfers_total",
+			Help: "Total number of loopback transfers of handshake bytes, by result",
+		},
+		[]string{"result"},
+	)
+)
+
+// ハンドシェイクと同じバイト数をループバックのTCP接続で実際にやり取りする
+// 暗号処理は行わず、サイズ・MSS・輻輳制御による転送時間だけを計測する
+type loopback struct {
+	listener net.Listener
+	dial     netem.DialFunc
+}
+
+// MSSを指定したループバックの待ち受けを開始する（0の場合はOSの既定値）
+// emがnilでない場合は、クライアント側の接続に人工的な遅延とパケットロスを加える
+func newLoopback(mss int, em *netem.Emulator) (*loopback, error) {
+	lc := net.ListenConfig{Control: mssControl(mss)}
+	listener, err := lc.Listen(context.Background(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("ループバックの待ち受けエラー: %w", err)
+	}
+	dialer := &net.Dialer{Control: mssControl(mss), Timeout: 5 * time.Second}
+	l := &loopback{listener: listener, dial: em.Dial(dialer.DialContext)}
+	go l.serve()
+	return l, nil
+}
+
+// 転送する量のヘッダー（ClientHello、サーバーのフライト、クライアントの残りのバイト数）
+const transferHeaderSize = 12
+
+// クライアントが送ったヘッダーに従って、サーバー側のバイト数を返す
+func (l *loopback) serve() {
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			log.Printf("ループバックの待ち受けを終了: %v", err)
+			return
+		}
+		go func() {
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(time.Minute))
+			header := make([]byte, transferHeaderSize)
+			if _, err := io.ReadFull(conn, header); err != nil {
+				return
+			}
+			clientFirst := int64(binary.BigEndian.Uint32(header[0:]))
+			server := int64(binary.BigEndian.Uint32(header[4:]))
+			clientRest := int64(binary.BigEndian.Uint32(header[8:]))
+			if _, err := io.CopyN(io.Discard, conn, clientFirst); err != nil {
+				return
+			}
+			if _, err := conn.Write(make([]byte, server)); err != nil {
+				return
+			}
+			io.CopyN(io.Discard, conn, clientRest)
+		}()
+	}
+}
+
+// ハンドシェイクのバイト数を転送し、ClientHelloの送信からサーバーのフライトを受信し終えるまでの時間を返す
+func (l *loopback) transfer(h *Handshake) (time.Duration, error) {
+	conn, err := l.dial(context.Background(), "tcp", l.listener.Addr().String())
+	if err != nil {
+		return 0, fmt.Errorf("ループバックの接続エラー: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	if tcp, ok := netem.Unwrap(conn).(*net.TCPConn); ok {
+		if mss, err := effectiveMSS(tcp); err == nil {
+			transferMSS.Set(float64(mss))
+		}
+	}
+
+	clientFirst := h.firstClientFlight()
+	server := h.WireBytes(Server)
+	clientRest := h.WireBytes(Client) - clientFirst
+	first := make([]byte, transferHeaderSize+clientFirst)
+	binary.BigEndian.PutUint32(first[0:], uint32(clientFirst))
+	binary.BigEndian.PutUint32(first[4:], uint32(server))
+	binary.BigEndian.PutUint32(first[8:], uint32(clientRest))
+
+	start := time.Now()
+	if _, err := conn.Write(first); err != nil {
+		return 0, fmt.Errorf("ClientHelloの送信エラー: %w", err)
+	}
+	if _, err := io.CopyN(io.Discard, conn, int64(server)); err != nil {
+		return 0, fmt.Errorf("サーバーのフライトの受信エラー: %w", err)
+	}
+	elapsed := time.Since(start)
+	if _, err := conn.Write(make([]byte, clientRest)); err != nil {
+		return 0, fmt.Errorf("Finishedの送信エラー: %w", err)
+	}
+	return elapsed, nil
+}
+
+// 転送時間を記録する
+func recordTransfer(l *loopback, h *Handshake) {
+	elapsed, err := l.transfer(h)
+	if err != nil {
+		transfersTotal.WithLabelValues("failure").Inc()
+		log.Printf("ループバックの転送に失敗 [%s, %s]: %v", h.KeyExchange, h.Signature, err)
+		return
+	}
+	transfersTotal.WithLabelValues("success").Inc()
+	transferDuration.WithLabelValues(h.labels()...).Observe(elapsed.Seconds())
+}
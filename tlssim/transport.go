@@ -0,0 +1,64 @@
+package tlssim
+
+// ハンドシェイクを運ぶトランスポートの送信量の制限
+// サーバーの最初のフライトが制限を超えると、クライアントの応答を待つ分だけ往復が増える
+type Transport struct {
+	Name string
+	// サーバーが最初のフライトで送れるバイト数（clientBytesはクライアントが送ったバイト数）
+	firstFlight func(clientBytes int) int
+	// 2つ目以降のフライトの初期のウィンドウ（フライトごとにスロースタートで2倍にする）
+	window int
+}
+
+// TCP（初期ウィンドウはsegments×MSS、RFC 6928の既定は10セグメント）
+func TCP(segments, mss int) Transport {
+	window := segments * mss
+	return Transport{
+		Name:        "tcp",
+		firstFlight: func(int) int { return window },
+		window:      window * 2,
+	}
+}
+
+// QUICの最初のパケットの最小サイズと初期ウィンドウ（RFC 9000、RFC 9002）
+const (
+	quicMinInitial    = 1200
+	quicInitialWindow = 14720
+)
+
+// QUIC（アドレスの検証前はクライアントから受信したバイト数の3倍までしか送れない）
+func QUIC() Transport {
+	return Transport{
+		Name: "quic",
+		firstFlight: func(clientBytes int) int {
+			return min(3*max(clientBytes, quicMinInitial), quicInitialWindow)
+		},
+		window: quicInitialWindow,
+	}
+}
+
+// サーバーがハンドシェイクのメッセージを送り終えるまでのフライト数
+// 1の場合はサーバーの応答が1回の送信で届き、1-RTTでハンドシェイクが終わる
+func (t Transport) ServerFlights(h *Handshake) int {
+	remaining := h.WireBytes(Server)
+	capacity := t.firstFlight(h.firstClientFlight())
+	window := t.window
+	flights := 0
+	for remaining > 0 {
+		flights++
+		remaining -= capacity
+		capacity = window
+		window *= 2
+	}
+	return flights
+}
+
+// 最初のフライトでクライアントが送るバイト数（ClientHello）
+func (h *Handshake) firstClientFlight() int {
+	for _, m := range h.Messages {
+		if m.Name == "client_hello" {
+			return m.Size + recordHeaderSize*records(m.Size)
+		}
+	}
+	return 0
+}
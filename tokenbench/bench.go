@@ -0,0 +1,153 @@
+// Package tokenbench はAPIトークン（JWT・COSE_Sign1）の発行と検証をEd25519、ECDSA P-256、ML-DSA-65で行い、
+// トークンサイズと署名・検証の所要時間を比較するベンチマークを提供する
+package tokenbench
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "token-bench"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は token_bench_）
+var factory = metrics.NewFactory(ServiceName, "token_bench_")
+
+var (
+	tokenSize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "token_bench_token_size_bytes",
+			Help: "Size of the issued token in bytes, by signature algorithm and format (jwt or cose)",
+		},
+		[]string{"alg", "format"},
+	)
+	signatureSize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "token_bench_signature_size_bytes",
+			Help: "Size of the raw signature in bytes, by signature algorithm",
+		},
+		[]string{"alg"},
+	)
+	publicKeySize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "token_bench_public_key_size_bytes",
+			Help: "Size of the verification public key in bytes, by signature algorithm",
+		},
+		[]string{"alg"},
+	)
+	signDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "token_bench_sign_duration_seconds",
+			Help:    "Histogram of token issuance (signing) duration in seconds",
+			Buckets: []float64{0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005},
+		},
+		[]string{"alg", "format"},
+	)
+	verifyDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "token_bench_verify_duration_seconds",
+			Help:    "Histogram of token verification duration in seconds",
+			Buckets: []float64{0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005},
+		},
+		[]string{"alg", "format"},
+	)
+	tokensTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "token_bench_tokens_total",
+			Help: "Total number of tokens issued and verified, by result",
+		},
+		[]string{"alg", "format", "result"},
+	)
+)
+
+// トークンの形式
+type tokenFormat struct {
+	name   string
+	issue  func(signer, claims) ([]byte, error)
+	verify func(signer, []byte) error
+}
+
+// 比較するトークンの形式（JWT: JSON + Base64URL、COSE: CBORのCOSE_Sign1 + CWTクレーム）
+var formats = []tokenFormat{
+	{
+		name: "jwt",
+		issue: func(s signer, c claims) ([]byte, error) {
+			token, err := issue(s, c)
+			return []byte(token), err
+		},
+		verify: func(s signer, token []byte) error { return verify(s, string(token)) },
+	},
+	{
+		name:   "cose",
+		issue:  func(s signer, c claims) ([]byte, error) { return issueCOSE(s, encodeCWTClaims(c)) },
+		verify: verifyCOSE,
+	},
+}
+
+// ベンチマークの設定
+type Config struct {
+	Interval time.Duration // トークンを発行する間隔
+}
+
+// デフォルト設定
+func DefaultConfig() Config {
+	return Config{Interval: time.Second}
+}
+
+// 一定間隔でトークンの発行と検証を繰り返す
+func Run(cfg Config) error {
+	signers, err := newSigners()
+	if err != nil {
+		return err
+	}
+	for _, s := range signers {
+		publicKeySize.WithLabelValues(s.alg()).Set(float64(s.publicKeySize()))
+		if sig, err := s.sign([]byte("probe")); err == nil {
+			signatureSize.WithLabelValues(s.alg()).Set(float64(len(sig)))
+		}
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		c, err := newClaims()
+		if err != nil {
+			log.Printf("クレームの作成に失敗: %v", err)
+			continue
+		}
+		for _, s := range signers {
+			for _, f := range formats {
+				if err := benchmark(s, f, c); err != nil {
+					tokensTotal.WithLabelValues(s.alg(), f.name, "failure").Inc()
+					log.Printf("トークンの発行・検証に失敗 [%s, %s]: %v", s.alg(), f.name, err)
+					continue
+				}
+				tokensTotal.WithLabelValues(s.alg(), f.name, "success").Inc()
+			}
+		}
+	}
+	return nil
+}
+
+// 1つの署名方式と形式でトークンを発行して検証する
+func benchmark(s signer, f tokenFormat, c claims) error {
+	start := time.Now()
+	token, err := f.issue(s, c)
+	if err != nil {
+		return fmt.Errorf("署名エラー: %w", err)
+	}
+	signDuration.WithLabelValues(s.alg(), f.name).Observe(time.Since(start).Seconds())
+
+	start = time.Now()
+	if err := f.verify(s, token); err != nil {
+		return err
+	}
+	verifyDuration.WithLabelValues(s.alg(), f.name).Observe(time.Since(start).Seconds())
+
+	tokenSize.WithLabelValues(s.alg(), f.name).Set(float64(len(token)))
+	return nil
+}
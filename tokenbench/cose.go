@@ -0,0 +1,214 @@
+package tokenbench
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// COSEのアルゴリズム識別子（RFC 9053、ML-DSAはIETFドラフトの値）
+var coseAlgorithms = map[string]int64{
+	"EdDSA":     -8,
+	"ES256":     -7,
+	"ML-DSA-65": -49,
+}
+
+// COSE_Sign1のCBORタグ
+const coseSign1Tag = 18
+
+// CBORのメジャータイプ
+const (
+	cborUnsigned   = 0
+	cborNegative   = 1
+	cborByteString = 2
+	cborTextString = 3
+	cborArray      = 4
+	cborMap        = 5
+	cborTag        = 6
+)
+
+// COSE_Sign1で使う範囲に限ったCBORエンコーダー（RFC 8949の決定的エンコーディング）
+type cborEncoder struct {
+	bytes.Buffer
+}
+
+// メジャータイプと引数を書き込む
+func (e *cborEncoder) head(major byte, n uint64) {
+	switch {
+	case n < 24:
+		e.WriteByte(major<<5 | byte(n))
+	case n <= 0xff:
+		e.WriteByte(major<<5 | 24)
+		e.WriteByte(byte(n))
+	case n <= 0xffff:
+		e.WriteByte(major<<5 | 25)
+		e.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	case n <= 0xffffffff:
+		e.WriteByte(major<<5 | 26)
+		e.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	default:
+		e.WriteByte(major<<5 | 27)
+		e.Write(binary.BigEndian.AppendUint64(nil, n))
+	}
+}
+
+func (e *cborEncoder) int(v int64) {
+	if v < 0 {
+		e.head(cborNegative, uint64(-1-v))
+		return
+	}
+	e.head(cborUnsigned, uint64(v))
+}
+
+func (e *cborEncoder) bytes(b []byte) {
+	e.head(cborByteString, uint64(len(b)))
+	e.Write(b)
+}
+
+func (e *cborEncoder) text(s string) {
+	e.head(cborTextString, uint64(len(s)))
+	e.WriteString(s)
+}
+
+// CWT（RFC 8392）のクレームとしてエンコードする
+func encodeCWTClaims(c claims) []byte {
+	cti, err := hex.DecodeString(c.ID)
+	if err != nil {
+		cti = []byte(c.ID)
+	}
+	var e cborEncoder
+	e.head(cborMap, 7)
+	e.int(1) // iss
+	e.text(c.Issuer)
+	e.int(2) // sub
+	e.text(c.Subject)
+	e.int(3) // aud
+	e.text(c.Audience)
+	e.int(4) // exp
+	e.int(c.ExpiresAt)
+	e.int(6) // iat
+	e.int(c.IssuedAt)
+	e.int(7) // cti
+	e.bytes(cti)
+	e.text("scope") // 登録されていないクレームは文字列のキーを使う
+	e.text(c.Scope)
+	return e.Bytes()
+}
+
+// 保護ヘッダー（{1: alg}）をエンコードする
+func coseProtectedHeader(s signer) []byte {
+	var e cborEncoder
+	e.head(cborMap, 1)
+	e.int(1)
+	e.int(coseAlgorithms[s.alg()])
+	return e.Bytes()
+}
+
+// 署名対象のSig_structure（["Signature1", protected, external_aad, payload]）
+func coseSigStructure(protected, payload []byte) []byte {
+	var e cborEncoder
+	e.head(cborArray, 4)
+	e.text("Signature1")
+	e.bytes(protected)
+	e.bytes(nil)
+	e.bytes(payload)
+	return e.Bytes()
+}
+
+// COSE_Sign1メッセージを作成する
+func issueCOSE(s signer, payload []byte) ([]byte, error) {
+	protected := coseProtectedHeader(s)
+	sig, err := s.sign(coseSigStructure(protected, payload))
+	if err != nil {
+		return nil, err
+	}
+
+	var e cborEncoder
+	e.head(cborTag, coseSign1Tag)
+	e.head(cborArray, 4)
+	e.bytes(protected)
+	e.head(cborMap, 0) // 非保護ヘッダー
+	e.bytes(payload)
+	e.bytes(sig)
+	return e.Bytes(), nil
+}
+
+// COSE_Sign1メッセージの署名を検証する
+// issueCOSEが作成する構造のみを受け付ける
+func verifyCOSE(s signer, msg []byte) error {
+	d := cborDecoder{buf: msg}
+	if !d.expectHead(cborTag, coseSign1Tag) || !d.expectHead(cborArray, 4) {
+		return errMalformedToken
+	}
+	protected, ok := d.bytes()
+	if !ok || !d.expectHead(cborMap, 0) {
+		return errMalformedToken
+	}
+	payload, ok := d.bytes()
+	if !ok {
+		return errMalformedToken
+	}
+	sig, ok := d.bytes()
+	if !ok || len(d.buf) != 0 {
+		return errMalformedToken
+	}
+	if !bytes.Equal(protected, coseProtectedHeader(s)) {
+		return errMalformedToken
+	}
+	if !s.verify(coseSigStructure(protected, payload), sig) {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// 検証に必要な範囲に限ったCBORデコーダー
+type cborDecoder struct {
+	buf []byte
+}
+
+// メジャータイプと引数を読み込む
+func (d *cborDecoder) head() (major byte, n uint64, ok bool) {
+	if len(d.buf) == 0 {
+		return 0, 0, false
+	}
+	major, info := d.buf[0]>>5, d.buf[0]&0x1f
+	d.buf = d.buf[1:]
+	size := 0
+	switch {
+	case info < 24:
+		return major, uint64(info), true
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, false
+	}
+	if len(d.buf) < size {
+		return 0, 0, false
+	}
+	for _, b := range d.buf[:size] {
+		n = n<<8 | uint64(b)
+	}
+	d.buf = d.buf[size:]
+	return major, n, true
+}
+
+func (d *cborDecoder) expectHead(major byte, n uint64) bool {
+	m, v, ok := d.head()
+	return ok && m == major && v == n
+}
+
+func (d *cborDecoder) bytes() ([]byte, bool) {
+	m, n, ok := d.head()
+	if !ok || m != cborByteString || uint64(len(d.buf)) < n {
+		return nil, false
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b, true
+}
@@ -0,0 +1,133 @@
+package tokenbench
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"math/big"
+
+	"github.com/cloudflare/circl/sign/mldsa/mldsa65"
+)
+
+// トークンの署名方式
+type signer interface {
+	// JWSヘッダーのalg
+	alg() string
+	sign(msg []byte) ([]byte, error)
+	verify(msg, sig []byte) bool
+	// 検証者に配布する公開鍵のサイズ
+	publicKeySize() int
+}
+
+// すべての署名方式の鍵ペアを生成する
+func newSigners() ([]signer, error) {
+	ed, err := newEd25519Signer()
+	if err != nil {
+		return nil, err
+	}
+	es, err := newES256Signer()
+	if err != nil {
+		return nil, err
+	}
+	ml, err := newMLDSA65Signer()
+	if err != nil {
+		return nil, err
+	}
+	return []signer{ed, es, ml}, nil
+}
+
+// Ed25519（JWSのalgはEdDSA）
+type ed25519Signer struct {
+	pub  ed25519.PublicKey
+	priv ed25519.PrivateKey
+}
+
+func newEd25519Signer() (*ed25519Signer, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("Ed25519鍵生成エラー: %w", err)
+	}
+	return &ed25519Signer{pub: pub, priv: priv}, nil
+}
+
+func (s *ed25519Signer) alg() string                     { return "EdDSA" }
+func (s *ed25519Signer) sign(msg []byte) ([]byte, error) { return ed25519.Sign(s.priv, msg), nil }
+func (s *ed25519Signer) verify(msg, sig []byte) bool     { return ed25519.Verify(s.pub, msg, sig) }
+func (s *ed25519Signer) publicKeySize() int              { return len(s.pub) }
+
+// ECDSA P-256 + SHA-256（JWSのalgはES256）
+// JWSでは署名をASN.1ではなく r || s の固定長で表す
+type es256Signer struct {
+	priv *ecdsa.PrivateKey
+}
+
+func newES256Signer() (*es256Signer, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("ECDSA鍵生成エラー: %w", err)
+	}
+	return &es256Signer{priv: priv}, nil
+}
+
+func (s *es256Signer) alg() string { return "ES256" }
+
+func (s *es256Signer) sign(msg []byte) ([]byte, error) {
+	digest := sha256.Sum256(msg)
+	r, ss, err := ecdsa.Sign(rand.Reader, s.priv, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	ss.FillBytes(sig[32:])
+	return sig, nil
+}
+
+func (s *es256Signer) verify(msg, sig []byte) bool {
+	if len(sig) != 64 {
+		return false
+	}
+	digest := sha256.Sum256(msg)
+	r := new(big.Int).SetBytes(sig[:32])
+	ss := new(big.Int).SetBytes(sig[32:])
+	return ecdsa.Verify(&s.priv.PublicKey, digest[:], r, ss)
+}
+
+func (s *es256Signer) publicKeySize() int {
+	der, err := x509.MarshalPKIXPublicKey(&s.priv.PublicKey)
+	if err != nil {
+		return 0
+	}
+	return len(der)
+}
+
+// ML-DSA-65（FIPS 204、JWSのalgはIETFドラフトの ML-DSA-65）
+type mldsa65Signer struct {
+	pub  *mldsa65.PublicKey
+	priv *mldsa65.PrivateKey
+}
+
+func newMLDSA65Signer() (*mldsa65Signer, error) {
+	pub, priv, err := mldsa65.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("ML-DSA鍵生成エラー: %w", err)
+	}
+	return &mldsa65Signer{pub: pub, priv: priv}, nil
+}
+
+func (s *mldsa65Signer) alg() string { return "ML-DSA-65" }
+
+func (s *mldsa65Signer) sign(msg []byte) ([]byte, error) {
+	sig := make([]byte, mldsa65.SignatureSize)
+	if err := mldsa65.SignTo(s.priv, msg, nil, true, sig); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+func (s *mldsa65Signer) verify(msg, sig []byte) bool { return mldsa65.Verify(s.pub, msg, nil, sig) }
+func (s *mldsa65Signer) publicKeySize() int          { return mldsa65.PublicKeySize }
@@ -0,0 +1,194 @@
+// Package toolchainbench は計測用のバイナリを別のGoのツールチェーン（GOTOOLCHAIN）でビルドして子プロセスとして実行し、
+// RSAとML-KEMの自己ベンチマークの結果を、子プロセスのGoとcirclのバージョンをラベルとして記録する
+//
+// 同じホストで続けて計測するため、ツールチェーンの違いだけを比較できる（「Goを上げてKyberは速くなったか」）
+package toolchainbench
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/keyi1000/PQC_grafana/mlkemserver"
+	"github.com/keyi1000/PQC_grafana/rsaserver"
+	"github.com/keyi1000/PQC_grafana/selfbench"
+	"github.com/keyi1000/PQC_grafana/wire"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "toolchain-bench"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は toolchain_bench_）
+var factory = metrics.NewFactory(ServiceName, "toolchain_bench_")
+
+var (
+	opsPerSecond = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "toolchain_bench_ops_per_second",
+			Help: "Operations per second of the latest pinned self-benchmark in a child process, by requested toolchain, the child's Go and circl versions, and primitive",
+		},
+		[]string{"toolchain", "goversion", "circl_version", "primitive"},
+	)
+	perOpSeconds = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "toolchain_bench_per_op_seconds",
+			Help: "Mean duration of one operation in the latest self-benchmark in a child process, by requested toolchain, the child's Go and circl versions, and primitive",
+		},
+		[]string{"toolchain", "goversion", "circl_version", "primitive"},
+	)
+	buildDuration = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "toolchain_bench_build_duration_seconds",
+			Help: "Time taken to build the child benchmark binary with the toolchain (including toolchain download), by requested toolchain",
+		},
+		[]string{"toolchain"},
+	)
+	runsTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "toolchain_bench_runs_total",
+			Help: "Total number of child benchmark builds and runs, by requested toolchain and result (success, build_failure, run_failure)",
+		},
+		[]string{"toolchain", "result"},
+	)
+)
+
+// ベンチマークの設定
+type Config struct {
+	Toolchains []string      // GOTOOLCHAINに指定するツールチェーン（例: go1.24.0、localは実行中のgoコマンドのもの）
+	Package    string        // 子プロセスとしてビルドするパッケージ（-child で計測してReportを出力するもの）
+	Dir        string        // ビルドするモジュールのディレクトリ
+	Duration   time.Duration // 暗号処理ごとの計測時間
+	Interval   time.Duration // 計測を繰り返す間隔（0の場合は1回だけ実行する）
+}
+
+// デフォルト設定
+func DefaultConfig() Config {
+	return Config{
+		Toolchains: []string{"local"},
+		Package:    "./cmd/toolchain-bench",
+		Dir:        ".",
+		Duration:   2 * time.Second,
+		Interval:   10 * time.Minute,
+	}
+}
+
+// 子プロセスが標準出力に書き出す計測結果
+type Report struct {
+	Build   metrics.BuildInfo            `json:"build"`
+	Results []wire.SelfBenchmarkResponse `json:"results"`
+}
+
+// 子プロセスとしてRSA-OAEPの復号とML-KEMの脱カプセル化を順番に計測する
+func RunChild(duration time.Duration) (Report, error) {
+	report := Report{Build: metrics.ReadBuildInfo()}
+	runs := []func(selfbench.Options) (wire.SelfBenchmarkResponse, error){rsaserver.SelfBenchmark, mlkemserver.SelfBenchmark}
+	for _, run := range runs {
+		resp, err := run(selfbench.Options{Duration: duration})
+		if err != nil {
+			return report, err
+		}
+		report.Results = append(report.Results, resp)
+	}
+	return report, nil
+}
+
+// ツールチェーンごとに子プロセスのバイナリをビルドし、一定間隔で実行して結果を記録する
+func Run(cfg Config) error {
+	if len(cfg.Toolchains) == 0 {
+		return errors.New("ツールチェーンを指定してください")
+	}
+	dir, err := os.MkdirTemp("", "toolchain-bench-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	binaries := make(map[string]string, len(cfg.Toolchains))
+	for i, toolchain := range cfg.Toolchains {
+		bin := filepath.Join(dir, fmt.Sprintf("toolchain-bench-%d", i))
+		if err := build(cfg, toolchain, bin); err != nil {
+			runsTotal.WithLabelValues(toolchain, "build_failure").Inc()
+			log.Printf("ビルドに失敗 [%s]: %v", toolchain, err)
+			continue
+		}
+		binaries[toolchain] = bin
+	}
+	if len(binaries) == 0 {
+		return errors.New("どのツールチェーンでもビルドできませんでした")
+	}
+
+	measure(cfg, binaries)
+	if cfg.Interval <= 0 {
+		return nil
+	}
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		measure(cfg, binaries)
+	}
+	return nil
+}
+
+// GOTOOLCHAINを指定してパッケージをビルドする（未取得のツールチェーンはgoコマンドがダウンロードする）
+func build(cfg Config, toolchain, bin string) error {
+	start := time.Now()
+	cmd := exec.Command("go", "build", "-o", bin, cfg.Package)
+	cmd.Dir = cfg.Dir
+	cmd.Env = append(os.Environ(), "GOTOOLCHAIN="+toolchain)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	buildDuration.WithLabelValues(toolchain).Set(time.Since(start).Seconds())
+	log.Printf("ビルドしました [%s] (%v)", toolchain, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// ツールチェーンごとの子プロセスを順番に実行する（同時に実行すると互いにCPUを奪い合うため）
+func measure(cfg Config, binaries map[string]string) {
+	for _, toolchain := range cfg.Toolchains {
+		bin, ok := binaries[toolchain]
+		if !ok {
+			continue
+		}
+		report, err := runChild(bin, cfg.Duration)
+		if err != nil {
+			runsTotal.WithLabelValues(toolchain, "run_failure").Inc()
+			log.Printf("計測に失敗 [%s]: %v", toolchain, err)
+			continue
+		}
+		runsTotal.WithLabelValues(toolchain, "success").Inc()
+		for _, r := range report.Results {
+			labels := []string{toolchain, report.Build.GoVersion, report.Build.CirclVersion, r.Primitive}
+			opsPerSecond.WithLabelValues(labels...).Set(r.OpsPerSecond)
+			perOpSeconds.WithLabelValues(labels...).Set(time.Duration(r.PerOpNanos).Seconds())
+			log.Printf("[%s] %s (circl %s) %s: %.0f ops/s", toolchain, report.Build.GoVersion, report.Build.CirclVersion, r.Primitive, r.OpsPerSecond)
+		}
+	}
+}
+
+// 子プロセスを -child で実行し、標準出力のReportを読み取る
+func runChild(bin string, duration time.Duration) (Report, error) {
+	// 計測用の鍵の生成を含めても十分な時間で打ち切る
+	ctx, cancel := context.WithTimeout(context.Background(), 2*duration+time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, bin, "-child", "-duration", duration.String())
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return Report{}, err
+	}
+	var report Report
+	if err := json.Unmarshal(out, &report); err != nil {
+		return Report{}, fmt.Errorf("結果の形式が不正です: %w", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,219 @@
+// Package vpnsim はWireGuard（Noise IK）と同じ形のVPNのハンドシェイクを、X25519のDHだけの従来方式と
+// ML-KEMを加えたハイブリッド方式で行い、メッセージのサイズと、応答側（VPN集約装置）が1秒あたりに処理できるハンドシェイク数を比較する
+package vpnsim
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/keyi1000/PQC_grafana/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// メトリクスに付与するサービス名
+const ServiceName = "vpn-handshake-sim"
+
+// すべてのメトリクスにservice ラベルを付与して登録する（接頭辞は vpn_handshake_）
+var factory = metrics.NewFactory(ServiceName, "vpn_handshake_")
+
+var (
+	phaseDuration = factory.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "vpn_handshake_phase_duration_seconds",
+			Help:    "Histogram of handshake duration in seconds, by scheme and phase (initiate, respond, finish)",
+			Buckets: []float64{0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.0025},
+		},
+		[]string{"scheme", "phase"},
+	)
+	messageSize = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "vpn_handshake_message_size_bytes",
+			Help: "Size of the handshake message in bytes, by scheme and message (initiation or response)",
+		},
+		[]string{"scheme", "message"},
+	)
+	capacity = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "vpn_handshake_capacity_per_second",
+			Help: "Handshakes per second the responder sustained in the last load run, using all configured workers",
+		},
+		[]string{"scheme"},
+	)
+	capacityPerCore = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "vpn_handshake_capacity_per_core_per_second",
+			Help: "Handshakes per second the responder sustained per worker (CPU core) in the last load run",
+		},
+		[]string{"scheme"},
+	)
+	capacityRatio = factory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "vpn_handshake_capacity_ratio",
+			Help: "Ratio of the responder capacity to the classical X25519 handshake (1 means no loss of capacity)",
+		},
+		[]string{"scheme"},
+	)
+	workersGauge = factory.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "vpn_handshake_load_workers",
+			Help: "Number of goroutines processing initiations concurrently in the load run",
+		},
+	)
+	handshakesTotal = factory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "vpn_handshake_handshakes_total",
+			Help: "Total number of complete handshakes between initiator and responder, by result",
+		},
+		[]string{"scheme", "result"},
+	)
+)
+
+// 負荷をかける前に作成しておく開始メッセージの数
+// （応答側はタイムスタンプによるリプレイの確認を行わないため、同じメッセージを繰り返し処理させる）
+const initiationPool = 64
+
+// ベンチマークの設定
+type Config struct {
+	Interval     time.Duration // ハンドシェイクと負荷の計測を行う間隔
+	LoadDuration time.Duration // 方式ごとに応答側へ負荷をかける時間（0の場合は処理能力を計測しない）
+	Workers      int           // 負荷をかけるゴルーチンの数（0の場合はGOMAXPROCS）
+}
+
+// デフォルト設定
+func DefaultConfig() Config {
+	return Config{Interval: 30 * time.Second, LoadDuration: time.Second}
+}
+
+// 一定間隔ですべての方式のハンドシェイクを行い、応答側の処理能力を計測する
+func Run(cfg Config) error {
+	if cfg.Workers < 0 {
+		return fmt.Errorf("ワーカー数は0以上で指定してください: %d", cfg.Workers)
+	}
+	if cfg.Workers == 0 {
+		cfg.Workers = runtime.GOMAXPROCS(0)
+	}
+	workersGauge.Set(float64(cfg.Workers))
+
+	type peers struct {
+		scheme    scheme
+		initiator *initiator
+		responder *responder
+	}
+	var all []peers
+	for _, s := range schemes() {
+		in, r, err := newPeers(s)
+		if err != nil {
+			return err
+		}
+		all = append(all, peers{scheme: s, initiator: in, responder: r})
+		messageSize.WithLabelValues(s.name, "initiation").Set(float64(s.initiationSize()))
+		messageSize.WithLabelValues(s.name, "response").Set(float64(s.responseSize()))
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		for _, p := range all {
+			if err := handshake(p.initiator, p.responder); err != nil {
+				handshakesTotal.WithLabelValues(p.scheme.name, "failure").Inc()
+				log.Printf("ハンドシェイクに失敗 [%s]: %v", p.scheme.name, err)
+				continue
+			}
+			handshakesTotal.WithLabelValues(p.scheme.name, "success").Inc()
+		}
+
+		if cfg.LoadDuration <= 0 {
+			continue
+		}
+		var baseline float64
+		for _, p := range all {
+			rate, err := load(p.initiator, p.responder, cfg.Workers, cfg.LoadDuration)
+			if err != nil {
+				log.Printf("処理能力の計測に失敗 [%s]: %v", p.scheme.name, err)
+				continue
+			}
+			capacity.WithLabelValues(p.scheme.name).Set(rate)
+			capacityPerCore.WithLabelValues(p.scheme.name).Set(rate / float64(cfg.Workers))
+			if p.scheme.kem == nil {
+				baseline = rate
+			}
+			if baseline > 0 {
+				capacityRatio.WithLabelValues(p.scheme.name).Set(rate / baseline)
+			}
+		}
+	}
+}
+
+// 1回のハンドシェイクを段階ごとに計測し、両者のトランスポート鍵が一致することを確認する
+func handshake(in *initiator, r *responder) error {
+	name := in.scheme.name
+	start := time.Now()
+	initiation, err := in.initiate()
+	if err != nil {
+		return err
+	}
+	phaseDuration.WithLabelValues(name, phaseInitiate).Observe(time.Since(start).Seconds())
+
+	start = time.Now()
+	response, responderKey, err := r.respond(initiation)
+	if err != nil {
+		return err
+	}
+	phaseDuration.WithLabelValues(name, phaseRespond).Observe(time.Since(start).Seconds())
+
+	start = time.Now()
+	initiatorKey, err := in.finish(response)
+	if err != nil {
+		return err
+	}
+	phaseDuration.WithLabelValues(name, phaseFinish).Observe(time.Since(start).Seconds())
+
+	if !bytes.Equal(initiatorKey, responderKey) {
+		return errKeyMismatch
+	}
+	return nil
+}
+
+// 指定した時間、複数のゴルーチンから応答側に開始メッセージを処理させ、1秒あたりのハンドシェイク数を返す
+func load(in *initiator, r *responder, workers int, duration time.Duration) (float64, error) {
+	pool := make([][]byte, initiationPool)
+	for i := range pool {
+		msg, err := in.initiate()
+		if err != nil {
+			return 0, err
+		}
+		pool[i] = msg
+	}
+
+	var (
+		completed atomic.Int64
+		firstErr  error
+		once      sync.Once
+		wg        sync.WaitGroup
+	)
+	deadline := time.Now().Add(duration)
+	start := time.Now()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; time.Now().Before(deadline); i++ {
+				if _, _, err := r.respond(pool[i%len(pool)]); err != nil {
+					once.Do(func() { firstErr = err })
+					return
+				}
+				completed.Add(1)
+			}
+		}(w)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return 0, firstErr
+	}
+	return float64(completed.Load()) / time.Since(start).Seconds(), nil
+}
@@ -0,0 +1,431 @@
+package vpnsim
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudflare/circl/kem"
+	"github.com/cloudflare/circl/kem/mlkem/mlkem1024"
+	"github.com/cloudflare/circl/kem/mlkem/mlkem768"
+)
+
+// ハンドシェイクの段階
+const (
+	phaseInitiate = "initiate" // 開始側のハンドシェイク開始メッセージの作成
+	phaseRespond  = "respond"  // 応答側の開始メッセージの処理と応答メッセージの作成（VPN集約装置の負荷）
+	phaseFinish   = "finish"   // 開始側の応答メッセージの処理とトランスポート鍵の導出
+)
+
+// WireGuardのメッセージの種類
+const (
+	messageInitiation = 1
+	messageResponse   = 2
+)
+
+// 固定長のフィールドのサイズ（WireGuardと同じ）
+const (
+	dhSize        = 32 // X25519の公開鍵
+	tagSize       = 16 // AEADの認証タグ
+	timestampSize = 12 // TAI64N
+	macSize       = 16 // mac1、mac2
+)
+
+var (
+	// 開始側と応答側のトランスポート鍵が一致しない
+	errKeyMismatch = errors.New("トランスポート鍵が一致しません")
+	// メッセージの長さや種類が方式と一致しない
+	errMalformed = errors.New("ハンドシェイクメッセージの形式が不正です")
+)
+
+// ハンドシェイクの方式（kemがnilの場合はX25519だけの従来のWireGuard）
+type scheme struct {
+	name string
+	kem  kem.Scheme
+}
+
+// 比較する方式
+// ハイブリッド方式はPQ-WireGuardやRosenpassと同様に、応答側の静的なKEM公開鍵へのカプセル化と、
+// 開始側の一時的なKEM公開鍵へのカプセル化の両方の共有秘密をX25519のDHに加えて鍵の導出に混ぜる
+func schemes() []scheme {
+	return []scheme{
+		{name: "X25519"},
+		{name: "X25519+ML-KEM-768", kem: mlkem768.Scheme()},
+		{name: "X25519+ML-KEM-1024", kem: mlkem1024.Scheme()},
+	}
+}
+
+// 開始メッセージのサイズ（種類と予約4、送信者ID4、一時鍵、[一時KEM公開鍵、静的KEMカプセル化テキスト]、静的鍵、タイムスタンプ、mac1、mac2）
+func (s scheme) initiationSize() int {
+	n := 8 + dhSize + dhSize + tagSize + timestampSize + tagSize + 2*macSize
+	if s.kem != nil {
+		n += s.kem.PublicKeySize() + s.kem.CiphertextSize()
+	}
+	return n
+}
+
+// 応答メッセージのサイズ（種類と予約4、送信者ID4、受信者ID4、一時鍵、[一時KEMカプセル化テキスト]、空のペイロード、mac1、mac2）
+func (s scheme) responseSize() int {
+	n := 12 + dhSize + tagSize + 2*macSize
+	if s.kem != nil {
+		n += s.kem.CiphertextSize()
+	}
+	return n
+}
+
+// 鍵の導出の状態（Noiseの連鎖鍵とハンドシェイクハッシュ）
+// WireGuardのBLAKE2sとChaCha20-Poly1305の代わりに、標準ライブラリのSHA-256（HMAC）とAES-256-GCMを使う
+type symmetricState struct {
+	ck, h []byte
+}
+
+func newSymmetricState(s scheme, responderStatic []byte) *symmetricState {
+	protocol := sha256.Sum256([]byte("Noise_IKpsk2_25519_AESGCM_SHA256+" + s.name))
+	st := &symmetricState{ck: protocol[:], h: protocol[:]}
+	st.mixHash([]byte("WireGuard v1 PQC_grafana"))
+	st.mixHash(responderStatic)
+	return st
+}
+
+func (st *symmetricState) mixHash(data []byte) {
+	h := sha256.New()
+	h.Write(st.h)
+	h.Write(data)
+	st.h = h.Sum(nil)
+}
+
+// 連鎖鍵に入力を混ぜ、暗号化用の鍵を返す
+func (st *symmetricState) mixKey(input []byte) []byte {
+	var key []byte
+	st.ck, key = kdf2(st.ck, input)
+	return key
+}
+
+func (st *symmetricState) encryptAndHash(key, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := aead.Seal(nil, make([]byte, aead.NonceSize()), plaintext, st.h)
+	st.mixHash(ciphertext)
+	return ciphertext, nil
+}
+
+func (st *symmetricState) decryptAndHash(key, ciphertext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, make([]byte, aead.NonceSize()), ciphertext, st.h)
+	if err != nil {
+		return nil, err
+	}
+	st.mixHash(ciphertext)
+	return plaintext, nil
+}
+
+// 送信用と受信用のトランスポート鍵
+func (st *symmetricState) split() ([]byte, []byte) {
+	return kdf2(st.ck, nil)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// HKDFで2つの鍵を導出する（WireGuardのKdf2）
+func kdf2(ck, input []byte) ([]byte, []byte) {
+	prk := hmacSHA256(ck, input)
+	t1 := hmacSHA256(prk, []byte{1})
+	t2 := hmacSHA256(prk, append(t1, 2))
+	return t1, t2
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// mac1（応答側の静的公開鍵を知っている相手からのメッセージであることを、DHの前に安価に確認する）
+func mac1(responderStatic, msg []byte) []byte {
+	key := sha256.Sum256(append([]byte("mac1----"), responderStatic...))
+	return hmacSHA256(key[:], msg)[:macSize]
+}
+
+// 応答側（VPN集約装置）の静的な鍵
+type responder struct {
+	scheme    scheme
+	static    *ecdh.PrivateKey
+	kemPublic kem.PublicKey
+	kemSecret kem.PrivateKey
+	// 登録済みの開始側の静的公開鍵
+	peer []byte
+}
+
+// 開始側（クライアント）の静的な鍵と、応答を待っている間の一時的な状態
+type initiator struct {
+	scheme    scheme
+	static    *ecdh.PrivateKey
+	responder *responder
+
+	ephemeral *ecdh.PrivateKey
+	kemSecret kem.PrivateKey
+	state     *symmetricState
+}
+
+// 応答側と、それに登録された開始側の静的な鍵を生成する
+func newPeers(s scheme) (*initiator, *responder, error) {
+	static, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := &responder{scheme: s, static: static}
+	if s.kem != nil {
+		if r.kemPublic, r.kemSecret, err = s.kem.GenerateKeyPair(); err != nil {
+			return nil, nil, fmt.Errorf("%sの鍵生成エラー: %w", s.kem.Name(), err)
+		}
+	}
+	initiatorStatic, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	r.peer = initiatorStatic.PublicKey().Bytes()
+	return &initiator{scheme: s, static: initiatorStatic, responder: r}, r, nil
+}
+
+// 開始メッセージを作成する
+func (in *initiator) initiate() ([]byte, error) {
+	s := in.scheme
+	responderStatic := in.responder.static.PublicKey()
+	st := newSymmetricState(s, responderStatic.Bytes())
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	msg := binary.LittleEndian.AppendUint32(make([]byte, 0, s.initiationSize()), messageInitiation)
+	msg = binary.LittleEndian.AppendUint32(msg, 1)
+	e := ephemeral.PublicKey().Bytes()
+	msg = append(msg, e...)
+	st.mixHash(e)
+	st.mixKey(e)
+	es, err := ephemeral.ECDH(responderStatic)
+	if err != nil {
+		return nil, err
+	}
+	key := st.mixKey(es)
+
+	if s.kem != nil {
+		kemPublic, kemSecret, err := s.kem.GenerateKeyPair()
+		if err != nil {
+			return nil, err
+		}
+		ek, err := kemPublic.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		ct, ss, err := s.kem.Encapsulate(in.responder.kemPublic)
+		if err != nil {
+			return nil, err
+		}
+		msg = append(append(msg, ek...), ct...)
+		st.mixHash(ek)
+		st.mixHash(ct)
+		key = st.mixKey(ss)
+		in.kemSecret = kemSecret
+	}
+
+	encStatic, err := st.encryptAndHash(key, in.static.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	msg = append(msg, encStatic...)
+	ss, err := in.static.ECDH(responderStatic)
+	if err != nil {
+		return nil, err
+	}
+	encTimestamp, err := st.encryptAndHash(st.mixKey(ss), tai64n(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	msg = append(msg, encTimestamp...)
+	msg = append(msg, mac1(responderStatic.Bytes(), msg)...)
+	msg = append(msg, make([]byte, macSize)...) // mac2（クッキーは使わない）
+
+	in.ephemeral = ephemeral
+	in.state = st
+	return msg, nil
+}
+
+// 開始メッセージを処理して応答メッセージを作成し、応答側のトランスポート鍵を返す
+// 複数のゴルーチンから同時に呼び出せる
+func (r *responder) respond(initiation []byte) ([]byte, []byte, error) {
+	s := r.scheme
+	if len(initiation) != s.initiationSize() || binary.LittleEndian.Uint32(initiation) != messageInitiation {
+		return nil, nil, errMalformed
+	}
+	static := r.static.PublicKey().Bytes()
+	body := initiation[:len(initiation)-2*macSize]
+	if !hmac.Equal(mac1(static, body), initiation[len(body):len(body)+macSize]) {
+		return nil, nil, errors.New("mac1が一致しません")
+	}
+	st := newSymmetricState(s, static)
+
+	rest := body[8:]
+	e := rest[:dhSize]
+	rest = rest[dhSize:]
+	st.mixHash(e)
+	st.mixKey(e)
+	initiatorEphemeral, err := ecdh.X25519().NewPublicKey(e)
+	if err != nil {
+		return nil, nil, err
+	}
+	es, err := r.static.ECDH(initiatorEphemeral)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := st.mixKey(es)
+
+	var initiatorKEM kem.PublicKey
+	if s.kem != nil {
+		ek := rest[:s.kem.PublicKeySize()]
+		ct := rest[len(ek) : len(ek)+s.kem.CiphertextSize()]
+		rest = rest[len(ek)+len(ct):]
+		if initiatorKEM, err = s.kem.UnmarshalBinaryPublicKey(ek); err != nil {
+			return nil, nil, err
+		}
+		ss, err := s.kem.Decapsulate(r.kemSecret, ct)
+		if err != nil {
+			return nil, nil, err
+		}
+		st.mixHash(ek)
+		st.mixHash(ct)
+		key = st.mixKey(ss)
+	}
+
+	peer, err := st.decryptAndHash(key, rest[:dhSize+tagSize])
+	if err != nil {
+		return nil, nil, fmt.Errorf("静的鍵の復号に失敗: %w", err)
+	}
+	if !bytes.Equal(peer, r.peer) {
+		return nil, nil, errors.New("登録されていない開始側です")
+	}
+	initiatorStatic, err := ecdh.X25519().NewPublicKey(peer)
+	if err != nil {
+		return nil, nil, err
+	}
+	ss, err := r.static.ECDH(initiatorStatic)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := st.decryptAndHash(st.mixKey(ss), rest[dhSize+tagSize:]); err != nil {
+		return nil, nil, fmt.Errorf("タイムスタンプの復号に失敗: %w", err)
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	msg := binary.LittleEndian.AppendUint32(make([]byte, 0, s.responseSize()), messageResponse)
+	msg = binary.LittleEndian.AppendUint32(msg, 2)
+	msg = binary.LittleEndian.AppendUint32(msg, 1)
+	re := ephemeral.PublicKey().Bytes()
+	msg = append(msg, re...)
+	st.mixHash(re)
+	st.mixKey(re)
+	ee, err := ephemeral.ECDH(initiatorEphemeral)
+	if err != nil {
+		return nil, nil, err
+	}
+	st.mixKey(ee)
+	se, err := ephemeral.ECDH(initiatorStatic)
+	if err != nil {
+		return nil, nil, err
+	}
+	key = st.mixKey(se)
+	if s.kem != nil {
+		ct, ss, err := s.kem.Encapsulate(initiatorKEM)
+		if err != nil {
+			return nil, nil, err
+		}
+		msg = append(msg, ct...)
+		st.mixHash(ct)
+		key = st.mixKey(ss)
+	}
+	empty, err := st.encryptAndHash(key, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	msg = append(msg, empty...)
+	msg = append(msg, mac1(peer, msg)...)
+	msg = append(msg, make([]byte, macSize)...)
+
+	receive, _ := st.split()
+	return msg, receive, nil
+}
+
+// 応答メッセージを処理し、開始側の送信用のトランスポート鍵を返す
+func (in *initiator) finish(response []byte) ([]byte, error) {
+	s, st := in.scheme, in.state
+	if len(response) != s.responseSize() || binary.LittleEndian.Uint32(response) != messageResponse {
+		return nil, errMalformed
+	}
+	body := response[:len(response)-2*macSize]
+	if !hmac.Equal(mac1(in.static.PublicKey().Bytes(), body), response[len(body):len(body)+macSize]) {
+		return nil, errors.New("mac1が一致しません")
+	}
+
+	rest := body[12:]
+	re := rest[:dhSize]
+	rest = rest[dhSize:]
+	st.mixHash(re)
+	st.mixKey(re)
+	responderEphemeral, err := ecdh.X25519().NewPublicKey(re)
+	if err != nil {
+		return nil, err
+	}
+	ee, err := in.ephemeral.ECDH(responderEphemeral)
+	if err != nil {
+		return nil, err
+	}
+	st.mixKey(ee)
+	se, err := in.static.ECDH(responderEphemeral)
+	if err != nil {
+		return nil, err
+	}
+	key := st.mixKey(se)
+	if s.kem != nil {
+		ct := rest[:s.kem.CiphertextSize()]
+		rest = rest[len(ct):]
+		ss, err := s.kem.Decapsulate(in.kemSecret, ct)
+		if err != nil {
+			return nil, err
+		}
+		st.mixHash(ct)
+		key = st.mixKey(ss)
+	}
+	if _, err := st.decryptAndHash(key, rest); err != nil {
+		return nil, fmt.Errorf("応答の復号に失敗: %w", err)
+	}
+	send, _ := st.split()
+	return send, nil
+}
+
+// TAI64Nのタイムスタンプ（リプレイ攻撃の検出に使う）
+func tai64n(t time.Time) []byte {
+	b := binary.BigEndian.AppendUint64(nil, uint64(0x400000000000000a+t.Unix()))
+	return binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond()))
+}
@@ -0,0 +1,15 @@
+package wire
+
+// 暗号化データの通信量の内訳（メトリクスのcomponentラベル）
+const (
+	ComponentKeyMaterial = "key_material" // AES鍵の受け渡し（保護したAES鍵・カプセル化テキスト・KEK・一時公開鍵）
+	ComponentCiphertext  = "ciphertext"   // メッセージ（暗号文・IV・MAC）
+)
+
+// 鍵の受け渡しとメッセージのフィールドのJSONでの大きさ（Base64の文字数）
+// 残り（フィールド名、鍵ID、方式、nonceなど）はJSONの本文の大きさとの差になる
+func (d *EncryptedData) FieldSizes() (keyMaterial, ciphertext int) {
+	keyMaterial = len(d.EncryptedAESKey) + len(d.KEMCiphertext) + len(d.EncryptedKEK) + len(d.EphemeralPublicKey)
+	ciphertext = len(d.EncryptedMessage) + len(d.IV) + len(d.MAC)
+	return keyMaterial, ciphertext
+}
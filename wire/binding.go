@@ -0,0 +1,78 @@
+package wire
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// POST /public-key のnonceのサイズ（バイト）
+const (
+	MinNonceSize = 16
+	MaxNonceSize = 64
+)
+
+// KeyBindingの入力の先頭に付けるラベル
+const keyBindingLabel = "pqc-grafana public key binding v1"
+
+// 公開鍵のレスポンスの署名
+const (
+	SignatureAlgorithmMLDSA65 = "ML-DSA-65"
+	// ML-DSAの署名に指定するコンテキスト文字列（他の用途の署名と区別する）
+	SignatureContext = "pqc-grafana public key signature v1"
+)
+
+// nonce・鍵ID・公開鍵を1つの値に結び付ける
+// SHA-256(ラベル || 長さ付きのnonce || 長さ付きの鍵ID || 長さ付きの公開鍵)
+//
+// この値だけでは経路上の改ざんは防げない（再送と転送中の破損だけを検出する）
+// ML-KEMサーバーはこの値に長期署名鍵で署名し、Signatureとして返す
+func KeyBinding(nonce []byte, keyID string, publicKey []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte(keyBindingLabel))
+	for _, field := range [][]byte{nonce, []byte(keyID), publicKey} {
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], uint32(len(field)))
+		h.Write(n[:])
+		h.Write(field)
+	}
+	return h.Sum(nil)
+}
+
+// Base64エンコードされたnonceをデコードし、サイズを確認する
+func DecodeNonce(encoded string) ([]byte, error) {
+	nonce, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("nonceのBase64デコードエラー: %w", err)
+	}
+	if len(nonce) < MinNonceSize || len(nonce) > MaxNonceSize {
+		return nil, fmt.Errorf("nonceは%d〜%dバイトで指定してください: %dバイト", MinNonceSize, MaxNonceSize, len(nonce))
+	}
+	return nonce, nil
+}
+
+// POST /public-key のリクエストからnonceを読み取る（GETの場合はnilを返す）
+func ReadNonce(r *http.Request) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, nil
+	}
+	var req PublicKeyRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1024)).Decode(&req); err != nil {
+		return nil, fmt.Errorf("リクエストの形式が不正です: %w", err)
+	}
+	return DecodeNonce(req.Nonce)
+}
+
+// nonceがある場合は、レスポンスにnonceと公開鍵を結び付けた値を設定する
+// publicKeyはBase64エンコード前の公開鍵
+func (p *PublicKeyResponse) Bind(nonce, publicKey []byte) {
+	if nonce == nil {
+		return
+	}
+	p.Nonce = base64.StdEncoding.EncodeToString(nonce)
+	p.Binding = base64.StdEncoding.EncodeToString(KeyBinding(nonce, p.KeyID, publicKey))
+}
@@ -0,0 +1,55 @@
+package wire
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// エラーレスポンスのコード（RSAサーバー、ML-KEMサーバーの復号エンドポイント）
+const (
+	ErrorCodeMalformed            = "malformed"             // JSONまたはBase64の形式が不正
+	ErrorCodeInvalidLength        = "invalid_length"        // フィールドの長さが方式の期待する長さと異なる
+	ErrorCodeUnsupportedAlgorithm = "unsupported_algorithm" // サポートしていないデータ暗号化方式
+	ErrorCodeUnsupportedVersion   = "unsupported_version"   // サポートしていない暗号化データの形式の版
+	ErrorCodeUnknownKey           = "unknown_key"           // 鍵IDが見つからない
+	ErrorCodeDecrypt              = "decrypt"               // 復号に失敗（理由は区別しない）
+	ErrorCodePadding              = "padding"               // 【教育用・脆弱】パディングが不正（オラクルモードのみ）
+	ErrorCodeAuth                 = "auth"                  // 【教育用・脆弱】メッセージ認証に失敗（オラクルモードのみ）
+	ErrorCodeReplay               = "replay"                // 既に受け付けた要求の再送（再送の検出を有効にした場合）
+	ErrorCodeStale                = "stale_request"         // timestampが許容する時間の範囲外（再送の検出を有効にした場合）
+	ErrorCodeReplayCacheFull      = "replay_cache_full"     // 再送の検出の記録が一杯で、新しい要求を覚えられない（再送の検出を有効にした場合）
+)
+
+// 復号エンドポイントのエラーレスポンス
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"` // 検証に失敗したフィールド（JSONの名前）
+}
+
+func (e *ErrorResponse) Error() string { return e.Message }
+
+// Base64のフィールドをデコードする
+func DecodeField(field, s string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, &ErrorResponse{Code: ErrorCodeMalformed, Field: field, Message: fmt.Sprintf("%sのBase64デコードに失敗しました", field)}
+	}
+	return b, nil
+}
+
+// デコードしたフィールドの長さが期待する長さと一致するかを検証する
+func CheckLength(field string, b []byte, want int) error {
+	if len(b) != want {
+		return &ErrorResponse{Code: ErrorCodeInvalidLength, Field: field, Message: fmt.Sprintf("%sの長さが不正です（%dバイト、期待する長さは%dバイト）", field, len(b), want)}
+	}
+	return nil
+}
+
+// デコードしたフィールドの長さがブロック長の正の倍数かを検証する
+func CheckBlocks(field string, b []byte, blockSize int) error {
+	if len(b) == 0 || len(b)%blockSize != 0 {
+		return &ErrorResponse{Code: ErrorCodeInvalidLength, Field: field, Message: fmt.Sprintf("%sの長さが不正です（%dバイト、%dバイトの正の倍数が必要）", field, len(b), blockSize)}
+	}
+	return nil
+}
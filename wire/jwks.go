@@ -0,0 +1,114 @@
+package wire
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+)
+
+// GET /keys のContent-Type（RFC 7517）
+const ContentTypeJWKSet = "application/jwk-set+json"
+
+// JWKのktyとalg
+// ML-KEMのJWKはまだ標準化されていないため、IETFのドラフト（AKP: Algorithm Key Pair）に倣った実験的な表現にする
+const (
+	KeyTypeRSA       = "RSA"
+	KeyTypeAKP       = "AKP"
+	JWKAlgRSAOAEP256 = "RSA-OAEP-256"
+	JWKAlgMLKEM768   = "ML-KEM-768"
+	JWKUseEncryption = "enc"
+)
+
+// GET /keys のレスポンス（staticモードのRSA・ML-KEMサーバー）
+// 新しいセッションに渡すすべての公開鍵をJWK Setの形で返す（ephemeralモードでは空）
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// 1つの公開鍵
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"` // 復号時に指定する鍵ID（/public-key のkey_idと同じ）
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`   // RSAの法（Base64URL、パディングなし）
+	E         string `json:"e,omitempty"`   // RSAの公開指数（Base64URL、パディングなし）
+	Pub       string `json:"pub,omitempty"` // ML-KEMの公開鍵（Base64URL、パディングなし）
+	Expires   int64  `json:"exp,omitempty"` // 鍵を更新する時刻（Unix秒、期限がない場合は0）
+}
+
+// RSA公開鍵のJWK
+func NewRSAJWK(keyID string, pub *rsa.PublicKey) JWK {
+	return JWK{
+		KeyType:   KeyTypeRSA,
+		KeyID:     keyID,
+		Use:       JWKUseEncryption,
+		Algorithm: JWKAlgRSAOAEP256,
+		N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+// ML-KEM公開鍵のJWK（実験的）
+func NewMLKEMJWK(keyID string, pub []byte) JWK {
+	return JWK{
+		KeyType:   KeyTypeAKP,
+		KeyID:     keyID,
+		Use:       JWKUseEncryption,
+		Algorithm: JWKAlgMLKEM768,
+		Pub:       base64.RawURLEncoding.EncodeToString(pub),
+	}
+}
+
+// 鍵IDでJWKを探す
+func (s JWKSet) Lookup(keyID string) (JWK, bool) {
+	for _, k := range s.Keys {
+		if k.KeyID == keyID {
+			return k, true
+		}
+	}
+	return JWK{}, false
+}
+
+// GET /public-key と同じ形のレスポンスに変換する（RSAはPKIX DER、ML-KEMは公開鍵のバイト列をBase64にする）
+func (k JWK) PublicKeyResponse() (PublicKeyResponse, error) {
+	switch {
+	case k.KeyType == KeyTypeRSA && k.Algorithm == JWKAlgRSAOAEP256:
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return PublicKeyResponse{}, fmt.Errorf("JWKのnのデコードエラー: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return PublicKeyResponse{}, fmt.Errorf("JWKのeのデコードエラー: %w", err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return PublicKeyResponse{}, fmt.Errorf("JWKのRSA公開鍵が不正です (kid: %s)", k.KeyID)
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return PublicKeyResponse{}, err
+		}
+		return PublicKeyResponse{
+			PublicKey: base64.StdEncoding.EncodeToString(der),
+			KeyID:     k.KeyID,
+			KeySize:   pub.Size() * 8,
+		}, nil
+	case k.KeyType == KeyTypeAKP && k.Algorithm == JWKAlgMLKEM768:
+		pub, err := base64.RawURLEncoding.DecodeString(k.Pub)
+		if err != nil {
+			return PublicKeyResponse{}, fmt.Errorf("JWKのpubのデコードエラー: %w", err)
+		}
+		return PublicKeyResponse{
+			PublicKey: base64.StdEncoding.EncodeToString(pub),
+			KeyID:     k.KeyID,
+			Algorithm: k.Algorithm,
+			KeySize:   len(pub),
+		}, nil
+	}
+	return PublicKeyResponse{}, fmt.Errorf("対応していないJWKです (kty: %s, alg: %s)", k.KeyType, k.Algorithm)
+}
@@ -0,0 +1,82 @@
+package wire
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 事前にシリアライズした公開鍵のレスポンス（staticモードのGET /public-key で使い回す）
+// 鍵が変わらない限り同じ内容のため、JSONとBase64のエンコードを鍵ごとに1回だけ行い、ETagで条件付きリクエストに応える
+type CachedPublicKey struct {
+	ETag string
+	body []byte // server_timingを除いたJSON（閉じ括弧を除く）
+}
+
+// server_timingを除いたレスポンスをシリアライズする
+func NewCachedPublicKey(p PublicKeyResponse) (*CachedPublicKey, error) {
+	p.ServerTiming = nil
+	body, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return &CachedPublicKey{
+		ETag: NewETag(body),
+		body: bytes.TrimSuffix(body, []byte("}")),
+	}, nil
+}
+
+// レスポンスの本文から強いETagを作る（SHA-256の先頭16バイト）
+func NewETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// リクエストのIf-None-MatchがETagと一致するか
+func (c *CachedPublicKey) NotModified(r *http.Request) bool {
+	return MatchETag(r.Header.Get("If-None-Match"), c.ETag)
+}
+
+// If-None-Matchの値がETagと一致するか（弱いETagと複数の値、*も扱う）
+func MatchETag(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ETagを付けてレスポンスを書き出す（server_timingだけはリクエストごとに付け加える）
+func (c *CachedPublicKey) Write(w http.ResponseWriter, receivedAt time.Time) error {
+	timing, err := json.Marshal(NewServerTiming(receivedAt))
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", c.ETag)
+	w.WriteHeader(http.StatusOK)
+	var buf bytes.Buffer
+	buf.Grow(len(c.body) + len(timing) + 20)
+	buf.Write(c.body)
+	buf.WriteString(`,"server_timing":`)
+	buf.Write(timing)
+	buf.WriteString("}\n")
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// 304 Not Modifiedを返す
+func (c *CachedPublicKey) WriteNotModified(w http.ResponseWriter) {
+	w.Header().Set("ETag", c.ETag)
+	w.WriteHeader(http.StatusNotModified)
+}
@@ -0,0 +1,28 @@
+package wire
+
+import "time"
+
+// POST /results で送る計測結果のまとまり（result-collector）
+// クライアントはJSONにしたResultBatchを、ML-KEMの/decapsulateと同じ形式のEncryptedDataに暗号化して送る
+type ResultBatch struct {
+	Client  string         `json:"client"`  // 送信元のクライアント（ホスト名）
+	Release string         `json:"release"` // 送信元のバイナリのバージョンとコミット
+	SentAt  time.Time      `json:"sent_at"`
+	Records []ResultRecord `json:"records"`
+}
+
+// 1回の鍵合意セッションの結果
+type ResultRecord struct {
+	Time            time.Time          `json:"time"`
+	Algorithm       string             `json:"algorithm"` // rsa / mlkem / dual / ecdh
+	Transport       string             `json:"transport"` // network / inmemory / datagram / unix
+	Result          string             `json:"result"`    // success / failure
+	DurationSeconds float64            `json:"duration_seconds,omitempty"`
+	Phases          map[string]float64 `json:"phases,omitempty"` // フェーズごとの所要時間（秒）
+}
+
+// POST /results のレスポンス
+type ResultUploadResponse struct {
+	Accepted     int           `json:"accepted"` // 受け付けた結果の件数
+	ServerTiming *ServerTiming `json:"server_timing,omitempty"`
+}
@@ -0,0 +1,120 @@
+package wire
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// EncryptedDataの形式の版（過去のリリースの暗号化データを復号できなくなる変更をした場合に上げる）
+const EnvelopeFormatVersion = 1
+
+// サーバーが受け付ける最も古い版（古い版のクライアントがいなくなったら上げる）
+const MinEnvelopeFormatVersion = 1
+
+// 暗号化データの形式の版の交渉に使うヘッダー
+// クライアントは公開鍵の取得時に書ける版をAccept-Versionで送り、サーバーは選んだ版をEnvelope-Versionで返す
+const (
+	AcceptVersionHeader   = "Accept-Version"   // クライアントが書ける版（例: "1, 2"）
+	EnvelopeVersionHeader = "Envelope-Version" // サーバーが選んだ版
+)
+
+// versionのない古いクライアントの暗号化データのメトリクスのラベル
+const EnvelopeVersionUnspecified = "unspecified"
+
+// サーバーが受け付ける版（古い順）
+func SupportedEnvelopeVersions() []int {
+	versions := make([]int, 0, EnvelopeFormatVersion-MinEnvelopeFormatVersion+1)
+	for v := MinEnvelopeFormatVersion; v <= EnvelopeFormatVersion; v++ {
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+// Accept-Versionの値を作る
+func FormatAcceptVersion(versions []int) string {
+	s := make([]string, len(versions))
+	for i, v := range versions {
+		s[i] = strconv.Itoa(v)
+	}
+	return strings.Join(s, ", ")
+}
+
+// Accept-Versionから双方が扱える最も新しい版を選ぶ
+// ヘッダーのない古いクライアントには最初の版を返し、共通の版がない場合はfalseを返す
+func NegotiateEnvelopeVersion(accept string) (int, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return 1, MinEnvelopeFormatVersion <= 1
+	}
+	chosen := 0
+	for _, part := range strings.Split(accept, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || v < MinEnvelopeFormatVersion || v > EnvelopeFormatVersion {
+			continue
+		}
+		chosen = max(chosen, v)
+	}
+	return chosen, chosen != 0
+}
+
+// 公開鍵のレスポンスに交渉した版を付ける
+// 共通の版がない場合は406を返してfalseを返す（公開鍵を渡しても受け付けられる暗号化データを作れないため）
+func WriteEnvelopeVersion(w http.ResponseWriter, r *http.Request) bool {
+	// 共有キャッシュがクライアントの版ごとにレスポンスを分けるようにする
+	w.Header().Add("Vary", AcceptVersionHeader)
+	v, ok := NegotiateEnvelopeVersion(r.Header.Get(AcceptVersionHeader))
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotAcceptable)
+		json.NewEncoder(w).Encode(ErrorResponse{
+			Code:    ErrorCodeUnsupportedVersion,
+			Message: fmt.Sprintf("共通の暗号化データの形式の版がありません（サーバーが受け付ける版: %s）", FormatAcceptVersion(SupportedEnvelopeVersions())),
+		})
+		return false
+	}
+	w.Header().Set(EnvelopeVersionHeader, strconv.Itoa(v))
+	return true
+}
+
+// レスポンスのEnvelope-Versionを読む（版を交渉しない古いサーバーの場合は0）
+func ParseEnvelopeVersion(h http.Header) int {
+	v, err := strconv.Atoi(strings.TrimSpace(h.Get(EnvelopeVersionHeader)))
+	if err != nil || v < 1 {
+		return 0
+	}
+	return v
+}
+
+// 暗号化データの形式の版（versionのない古いクライアントのデータは最初の版）
+func (d *EncryptedData) FormatVersion() int {
+	if d.Version == 0 {
+		return 1
+	}
+	return d.Version
+}
+
+// 受け付けられる版か検証する
+func (d *EncryptedData) CheckVersion() error {
+	if v := d.FormatVersion(); v < MinEnvelopeFormatVersion || v > EnvelopeFormatVersion {
+		return &ErrorResponse{
+			Code:    ErrorCodeUnsupportedVersion,
+			Field:   "version",
+			Message: fmt.Sprintf("サポートしていない暗号化データの形式の版です: %d（受け付ける版: %s）", d.Version, FormatAcceptVersion(SupportedEnvelopeVersions())),
+		}
+	}
+	return nil
+}
+
+// リクエストの数を版ごとに数えるメトリクスのラベル
+// versionのないデータはunspecified、受け付けない版はunsupportedにまとめる
+func (d *EncryptedData) VersionLabel() string {
+	switch {
+	case d.Version == 0:
+		return EnvelopeVersionUnspecified
+	case d.CheckVersion() != nil:
+		return "unsupported"
+	}
+	return strconv.Itoa(d.Version)
+}
@@ -0,0 +1,198 @@
+// Package wire はサーバーとクライアントがHTTPでやり取りするリクエスト・レスポンスの型を定義する
+// /openapi.json のスキーマもこの型から生成するため、Go以外のクライアントも同じ定義を参照できる
+// 暗号化の手順は clients/README.md に記載しており、互換性のない変更をする場合は参照クライアントも更新する
+package wire
+
+import "time"
+
+// サーバー側のタイムスタンプ
+type ServerTiming struct {
+	ReceivedAtUnixNano  int64 `json:"received_at_unix_nano"`  // リクエスト受信時刻（壁時計）
+	RespondedAtUnixNano int64 `json:"responded_at_unix_nano"` // レスポンス送信時刻（壁時計）
+	ProcessingNanos     int64 `json:"processing_ns"`          // 受信から送信までの処理時間（単調時計）
+}
+
+// 受信時刻からの処理時間を計算してServerTimingを作成
+func NewServerTiming(receivedAt time.Time) *ServerTiming {
+	respondedAt := time.Now()
+	return &ServerTiming{
+		ReceivedAtUnixNano:  receivedAt.UnixNano(),
+		RespondedAtUnixNano: respondedAt.UnixNano(),
+		ProcessingNanos:     respondedAt.Sub(receivedAt).Nanoseconds(),
+	}
+}
+
+// GET /public-key、POST /public-key のレスポンス（RSAサーバー、ML-KEMサーバー、ECDHサーバー）
+type PublicKeyResponse struct {
+	PublicKey          string        `json:"public_key"`                    // Base64（RSAとECDHはPKIX DER）
+	KeyID              string        `json:"key_id"`                        // 復号時に指定する鍵ID
+	Algorithm          string        `json:"algorithm,omitempty"`           // 鍵の方式（ML-KEMサーバーとECDHサーバーのみ）
+	KeySize            int           `json:"key_size"`                      // RSAとECDHはビット数、ML-KEMは公開鍵のバイト数
+	KeyMode            string        `json:"key_mode,omitempty"`            // 鍵の運用モード（ephemeral / static）
+	KeyBackend         string        `json:"key_backend,omitempty"`         // 秘密鍵を保持するバックエンド（local / vault / aws-kms、RSAサーバーのみ）
+	Nonce              string        `json:"nonce,omitempty"`               // POSTで送られたnonce（Base64）
+	Binding            string        `json:"binding,omitempty"`             // nonce・鍵ID・公開鍵を結び付けるKeyBindingの値（Base64）
+	Signature          string        `json:"signature,omitempty"`           // 長期署名鍵によるKeyBindingの値への署名（Base64、ML-KEMサーバーのみ）
+	SignatureAlgorithm string        `json:"signature_algorithm,omitempty"` // 署名の方式
+	ServerTiming       *ServerTiming `json:"server_timing,omitempty"`
+}
+
+// GET /signing-key のレスポンス（ML-KEMサーバー）
+// 公開鍵のレスポンスの署名を検証するための長期署名鍵
+type SigningKeyResponse struct {
+	PublicKey string `json:"public_key"` // Base64
+	Algorithm string `json:"algorithm"`
+}
+
+// POST /public-key のリクエスト
+// クライアントが選んだnonceをレスポンスに含めさせ、古いレスポンスの再送でないことを確認する
+type PublicKeyRequest struct {
+	Nonce string `json:"nonce"` // Base64（MinNonceSize〜MaxNonceSizeバイト）
+}
+
+// GET /public-key のレスポンス（二重保護サーバー）
+type DualPublicKeyResponse struct {
+	RSAPublicKey   string        `json:"rsa_public_key"`
+	MLKEMPublicKey string        `json:"mlkem_public_key"`
+	KeyID          string        `json:"key_id"`
+	KeySize        int           `json:"key_size"` // 2つの公開鍵の合計サイズ
+	ServerTiming   *ServerTiming `json:"server_timing,omitempty"`
+}
+
+// POST /decrypt（RSA、二重保護、ECDH）、POST /decapsulate（ML-KEM）のリクエスト
+type EncryptedData struct {
+	Version            int    `json:"version,omitempty"`              // 形式の版（Envelope-Versionで交渉した版、ない場合は1）
+	KeyID              string `json:"key_id"`                         // 暗号化に使った公開鍵のID
+	Algorithm          string `json:"algorithm"`                      // データ暗号化方式
+	KEMCiphertext      string `json:"kem_ciphertext,omitempty"`       // ML-KEMのカプセル化テキスト（ML-KEM、二重保護）
+	EphemeralPublicKey string `json:"ephemeral_public_key,omitempty"` // クライアントの一時公開鍵（ECDH、非圧縮形式の点）
+	EncryptedAESKey    string `json:"encrypted_aes_key"`              // 公開鍵（または共有秘密鍵）で保護されたAES鍵
+	KeyWrap            string `json:"key_wrap,omitempty"`             // AES鍵のラップ方式（aes-gcm、aes-kw、ない場合はaes-gcmまたはRSA-OAEPで直接暗号化）
+	EncryptedKEK       string `json:"encrypted_kek,omitempty"`        // RSA-OAEPで暗号化したKEK（RSAでaes-kwを使う場合）
+	EncryptedMessage   string `json:"encrypted_message"`              // AESで暗号化されたメッセージ
+	IV                 string `json:"iv"`                             // AESの初期化ベクトル
+	MAC                string `json:"mac"`                            // IVと暗号文に対するHMAC
+	RequestNonce       string `json:"request_nonce,omitempty"`        // 再送の検出に使う要求ごとの乱数（Base64、MinNonceSize〜MaxNonceSizeバイト）
+	Timestamp          int64  `json:"timestamp,omitempty"`            // 暗号化データを作った時刻（Unixミリ秒、再送の検出に使う）
+}
+
+// EncryptedDataのJSONの最大サイズ（64MiBのメッセージをBase64にしても収まる大きさ）
+const MaxEncryptedDataSize = 96 << 20
+
+// 復号結果のレスポンス
+// 平文そのものは返さず、クライアントが検証できるようにハッシュ値を返す
+type DecryptResponse struct {
+	PlaintextSHA256 string        `json:"plaintext_sha256"`
+	PlaintextSize   int           `json:"plaintext_size"`
+	KeyID           string        `json:"key_id,omitempty"` // 復号に使った鍵ID（kid、RSA・ML-KEMサーバー）
+	ServerTiming    *ServerTiming `json:"server_timing,omitempty"`
+}
+
+// GET /algorithms のレスポンス
+type AlgorithmsResponse struct {
+	KeyEstablishment []string `json:"key_establishment"` // AES鍵の保護に使う方式（例: RSA-OAEP-2048-SHA256）
+	DataEncryption   []string `json:"data_encryption"`   // EncryptedData.Algorithm に指定できる方式
+	EnvelopeVersions []int    `json:"envelope_versions"` // EncryptedData.Version に指定できる形式の版
+}
+
+// POST /rotate-key のレスポンス（staticモードのRSA・ML-KEMサーバー、adminのロールが必要）
+type RotateKeyResponse struct {
+	KeyID         string `json:"key_id"`                    // 新しい鍵ID
+	PreviousKeyID string `json:"previous_key_id,omitempty"` // 処理中のセッションのために残す直前の鍵ID
+}
+
+// POST /encapsulate-batch のリクエスト（ML-KEMサーバー）
+type EncapsulateBatchRequest struct {
+	Count int `json:"count"` // カプセル化の回数（1〜MaxBatchCount）
+}
+
+// POST /encapsulate-batch のレスポンス
+// HTTPとJSONの処理を含まない、サーバー内でのカプセル化だけの時間を返す
+type EncapsulateBatchResponse struct {
+	Algorithm    string        `json:"algorithm"`
+	Count        int           `json:"count"`
+	TotalNanos   int64         `json:"total_ns"`  // N回のカプセル化の合計時間
+	PerOpNanos   int64         `json:"per_op_ns"` // 1回あたりの平均時間
+	MinNanos     int64         `json:"min_ns"`    // 最も速かった1回
+	MaxNanos     int64         `json:"max_ns"`    // 最も遅かった1回
+	OpsPerSecond float64       `json:"ops_per_second"`
+	ServerTiming *ServerTiming `json:"server_timing,omitempty"`
+}
+
+// 1回のバッチで実行できるカプセル化の最大回数
+const MaxBatchCount = 10000
+
+// EncapsulateBatchRequestのJSONの最大サイズ
+const MaxBatchRequestSize = 1 << 10
+
+// GET /calibrate のレスポンス（GET /calibrate?size=N は公開鍵の代わりにNバイトの詰め物を返す）
+// POST /calibrate は暗号化データと同じJSONを受け取り、暗号処理を行わずに受信したサイズを返す
+type CalibrateResponse struct {
+	Padding      string        `json:"padding,omitempty"`
+	ReceivedSize int           `json:"received_size,omitempty"`
+	ServerTiming *ServerTiming `json:"server_timing,omitempty"`
+}
+
+// GET /calibrate?size=N で指定できる詰め物の最大サイズ
+const MaxCalibratePadding = 1 << 20
+
+// GET /benchmark/self のレスポンス
+// 暗号処理を1つのOSスレッドに固定して繰り返した回数で、HTTPとJSONの処理を含まない
+type SelfBenchmarkResponse struct {
+	Primitive    string        `json:"primitive"` // 計測した暗号処理（例: RSA-OAEP-2048-decrypt）
+	Operations   int           `json:"operations"`
+	ElapsedNanos int64         `json:"elapsed_ns"`
+	PerOpNanos   int64         `json:"per_op_ns"`
+	OpsPerSecond float64       `json:"ops_per_second"`
+	GOMAXPROCS   int           `json:"gomaxprocs"` // 計測中のGOMAXPROCS
+	NumCPU       int           `json:"num_cpu"`
+	LockedThread bool          `json:"locked_thread"` // 計測中のゴルーチンをOSスレッドに固定したか
+	ServerTiming *ServerTiming `json:"server_timing,omitempty"`
+}
+
+// GET /benchmark/load のレスポンス
+// 内部のキューに積んだ暗号処理を複数のワーカーで最大の速度で処理した結果で、HTTPとJSONの処理を含まない
+type LoadBenchmarkResponse struct {
+	Primitive          string        `json:"primitive"`
+	Workers            int           `json:"workers"`
+	QueueSize          int           `json:"queue_size"`
+	Operations         int64         `json:"operations"`
+	ElapsedNanos       int64         `json:"elapsed_ns"`
+	OpsPerSecond       float64       `json:"ops_per_second"`
+	CPUSeconds         float64       `json:"cpu_seconds,omitempty"`        // 計測中にプロセスが使ったCPU時間（ユーザー+システム）
+	CPUUtilization     float64       `json:"cpu_utilization,omitempty"`    // CPU時間 / (経過時間 × GOMAXPROCS)
+	OpsPerCPUSecond    float64       `json:"ops_per_cpu_second,omitempty"` // 1コアを1秒使い切った場合の処理回数
+	MeanQueueWaitNanos int64         `json:"mean_queue_wait_ns"`           // キューに積まれてからワーカーが取り出すまでの平均
+	GOMAXPROCS         int           `json:"gomaxprocs"`
+	NumCPU             int           `json:"num_cpu"`
+	ServerTiming       *ServerTiming `json:"server_timing,omitempty"`
+}
+
+// GET /benchmark/scaling のレスポンス
+// GOMAXPROCSを1, 2, 4, ...と増やしながら /benchmark/load と同じ負荷計測を繰り返した結果
+type ScalingBenchmarkResponse struct {
+	Primitive    string         `json:"primitive"`
+	NumCPU       int            `json:"num_cpu"`
+	Points       []ScalingPoint `json:"points"`
+	ServerTiming *ServerTiming  `json:"server_timing,omitempty"`
+}
+
+// GOMAXPROCSごとの結果（ワーカー数もGOMAXPROCSと同じにする）
+type ScalingPoint struct {
+	GOMAXPROCS     int     `json:"gomaxprocs"`
+	OpsPerSecond   float64 `json:"ops_per_second"`
+	Speedup        float64 `json:"speedup"`    // GOMAXPROCS=1 に対する倍率
+	Efficiency     float64 `json:"efficiency"` // Speedup / GOMAXPROCS（1なら理想的に並列化できている）
+	CPUUtilization float64 `json:"cpu_utilization,omitempty"`
+}
+
+// サーバーレス関数として実行したクライアントの1回の鍵交換の結果（coldstart）
+type ColdStartResponse struct {
+	Algorithm        string  `json:"algorithm"`
+	Cold             bool    `json:"cold"`                   // インスタンスの最初の呼び出しか
+	InitSeconds      float64 `json:"init_seconds,omitempty"` // プロセスの開始からハンドラーを作るまで（コールドスタートのみ）
+	OperationSeconds float64 `json:"operation_seconds"`      // 鍵交換（公開鍵の取得から復号の確認まで）
+	CryptoSeconds    float64 `json:"crypto_seconds"`         // 鍵交換のうちクライアントの暗号処理（カプセル化・暗号化とラップ）
+	TotalSeconds     float64 `json:"total_seconds"`          // 呼び出しの処理全体
+	Error            string  `json:"error,omitempty"`
+}
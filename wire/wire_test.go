@@ -0,0 +1,92 @@
+package wire
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+)
+
+// 任意の暗号化データのJSONでパニックせず、各フィールドのデコードと版の検査が一貫することを確かめる
+func FuzzDecodeEncryptedData(f *testing.F) {
+	f.Add([]byte(`{"version":1,"key_id":"k","algorithm":"AES-256-GCM","kem_ciphertext":"AA==","encrypted_aes_key":"AA==","encrypted_message":"AA==","iv":"AA==","mac":"AA==","request_nonce":"AAAAAAAAAAAAAAAAAAAAAA==","timestamp":1}`))
+	f.Add([]byte(`{"version":99,"iv":"not base64"}`))
+	f.Add([]byte(`{"version":-1,"mac":"AA"}`))
+	f.Add([]byte(`{}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		var d EncryptedData
+		if json.Unmarshal(body, &d) != nil {
+			return
+		}
+		if err := d.CheckVersion(); err == nil {
+			if v := d.FormatVersion(); v < MinEnvelopeFormatVersion || v > EnvelopeFormatVersion {
+				t.Fatalf("版%dを受け付けました", v)
+			}
+		}
+		d.VersionLabel()
+		keyMaterial, ciphertext := d.FieldSizes()
+		if keyMaterial < 0 || ciphertext < 0 {
+			t.Fatalf("FieldSizes = %d, %d", keyMaterial, ciphertext)
+		}
+		for field, s := range map[string]string{
+			"kem_ciphertext": d.KEMCiphertext, "ephemeral_public_key": d.EphemeralPublicKey, "encrypted_aes_key": d.EncryptedAESKey,
+			"encrypted_kek": d.EncryptedKEK, "encrypted_message": d.EncryptedMessage, "iv": d.IV, "mac": d.MAC,
+		} {
+			b, err := DecodeField(field, s)
+			if err != nil {
+				if resp, ok := err.(*ErrorResponse); !ok || resp.Code != ErrorCodeMalformed || resp.Field != field {
+					t.Fatalf("%sのエラー: %#v", field, err)
+				}
+				continue
+			}
+			if !bytes.Equal(b, mustDecode(t, s)) {
+				t.Fatalf("%sのデコード結果が標準のデコードと異なります", field)
+			}
+		}
+		if d.RequestNonce != "" {
+			if nonce, err := DecodeNonce(d.RequestNonce); err == nil && (len(nonce) < MinNonceSize || len(nonce) > MaxNonceSize) {
+				t.Fatalf("%dバイトのnonceを受け付けました", len(nonce))
+			}
+		}
+	})
+}
+
+func mustDecode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// 任意のJWKでパニックせず、変換できた公開鍵はそのまま使える形であることを確かめる
+func FuzzJWKPublicKeyResponse(f *testing.F) {
+	f.Add([]byte(`{"kty":"RSA","kid":"k","use":"enc","alg":"RSA-OAEP-256","n":"0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw","e":"AQAB"}`))
+	f.Add([]byte(`{"kty":"AKP","kid":"k","use":"enc","alg":"ML-KEM-768","pub":"AAAA"}`))
+	f.Add([]byte(`{"kty":"RSA","alg":"RSA-OAEP-256","n":"","e":"AQAB"}`))
+	f.Add([]byte(`{"kty":"RSA","alg":"RSA-OAEP-256","n":"AQ","e":"__________8"}`))
+	f.Add([]byte(`{"kty":"EC"}`))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		var k JWK
+		if json.Unmarshal(body, &k) != nil {
+			return
+		}
+		resp, err := k.PublicKeyResponse()
+		if err != nil {
+			return
+		}
+		der := mustDecode(t, resp.PublicKey)
+		if resp.KeyID != k.KeyID {
+			t.Fatalf("kid = %q, want %q", resp.KeyID, k.KeyID)
+		}
+		if k.KeyType == KeyTypeRSA {
+			if _, err := x509.ParsePKIXPublicKey(der); err != nil {
+				t.Fatalf("変換したRSA公開鍵をパースできません: %v", err)
+			}
+		} else if resp.KeySize != len(der) {
+			t.Fatalf("key_size = %d, want %d", resp.KeySize, len(der))
+		}
+	})
+}